@@ -25,6 +25,12 @@ func main() {
 		port = "8080"
 	}
 
+	// Start background jobs, they are stopped when the service shuts down
+	application.StartJobs()
+
+	// Start passing database changes on to live dashboards
+	application.StartEvents()
+
 	log.Printf("Starting HTTP service on port %s", port)
 
 	// HTTP listener is in a goroutine as it's blocking
@@ -41,6 +47,14 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	log.Println("Stopping background jobs")
+	if err := application.StopJobs(ctx); err != nil {
+		log.Printf("Background jobs did not stop in time: %v", err)
+	}
+
+	// Ends the event streams, which would otherwise keep the server from shutting down
+	application.StopEvents()
+
 	// Log the shutdown process
 	log.Println("Shutting HTTP service down")
 	if err := application.Router.Shutdown(ctx); err != nil {
@@ -3,12 +3,17 @@ package app
 import (
 	"log"
 	"os"
+	"time"
 
 	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/config"
 	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/database"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/events"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/scheduler"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/storage"
 	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/utils"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	gomail "gopkg.in/mail.v2"
 )
 
 // App holds the application state including database and router
@@ -16,6 +21,21 @@ type App struct {
 	DB     *database.DB
 	Router *echo.Echo
 	Logger *log.Logger
+	Store  storage.Store
+	// Key of the tamper-evident hash sealing each inspection
+	SigningKey []byte
+	// Address the app is reached at, used for links in emails
+	BaseURL string
+	// Mail server emails are sent through, nil when it is not configured
+	Mailer *gomail.Dialer
+	// Sender address of emails from the app
+	MailFrom string
+	// Time zone of dates that are not for one site, sites have their own
+	Location *time.Location
+	// Runs background jobs, started by StartJobs
+	Scheduler *scheduler.Scheduler
+	// Passes database changes on to the clients streaming /api/events, started by StartEvents
+	Events *events.Broker
 }
 
 // handleError is a method of App for handling errors
@@ -28,6 +48,19 @@ func (a *App) handleLogger(message string) {
 	a.Logger.Printf("\033[34m%s\033[0m", message)
 }
 
+// localNow returns the current time in the app's time zone
+func (a *App) localNow() time.Time {
+	return time.Now().In(a.Location)
+}
+
+// siteLocation returns a site's time zone, falling back to the app's time zone
+func (a *App) siteLocation(timeZone string) *time.Location {
+	if location, err := utils.LoadLocation(timeZone); err == nil {
+		return location
+	}
+	return a.Location
+}
+
 // NewApp creates a new instance of App
 func NewApp(cfg config.Config) *App {
 	// Initialize Echo
@@ -61,6 +94,17 @@ func NewApp(cfg config.Config) *App {
 		panic(err)
 	}
 
+	// Initialize file storage
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		panic(err)
+	}
+
+	location, err := utils.LoadLocation(cfg.TimeZone)
+	if err != nil {
+		panic(err)
+	}
+
 	// Initialize Logger
 	logger := log.New(os.Stdout, "\033[34mAPP: \033[0m", log.LstdFlags)
 
@@ -68,8 +112,26 @@ func NewApp(cfg config.Config) *App {
 		DB:     db,
 		Router: router,
 		Logger: logger,
+		Store:  store,
+
+		SigningKey: []byte(cfg.SigningKey),
+		BaseURL:    cfg.BaseURL,
+		MailFrom:   cfg.MailFrom,
+		Location:   location,
+		Scheduler:  scheduler.New(db, logger),
+		Events:     events.NewBroker(database.ConnString(cfg), logger),
 	}
 
+	if cfg.SMTPUsername != "" && cfg.SMTPPassword != "" {
+		app.Mailer = gomail.NewDialer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword)
+	}
+
+	// Move site maps saved by earlier versions under ./static into the store
+	app.migrateSiteMaps()
+
+	// Register background jobs
+	app.registerJobs()
+
 	// Initialize routes
 	app.initRoutes()
 
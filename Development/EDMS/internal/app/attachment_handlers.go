@@ -0,0 +1,409 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/database"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/storage"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	maxAttachmentSize = 10 << 20 // 10 MB, same as the site map upload
+	thumbnailSize     = 256
+)
+
+// allowedAttachmentTypes maps the sniffed content type to the extension used in storage
+var allowedAttachmentTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"application/pdf": ".pdf",
+}
+
+// allowedPhotoTypes are the types accepted where a photo is required
+var allowedPhotoTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// HandleGetDeviceAttachments lists the attachments of a device
+func (a *App) HandleGetDeviceAttachments(c echo.Context) error {
+	deviceID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid device ID", err)
+	}
+
+	attachments, err := a.DB.GetAttachmentsByDeviceID(deviceID)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	return c.JSON(http.StatusOK, attachments)
+}
+
+// HandleGetInspectionAttachments lists the attachments of an inspection
+func (a *App) HandleGetInspectionAttachments(c echo.Context) error {
+	inspectionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid inspection ID", err)
+	}
+
+	attachments, err := a.DB.GetAttachmentsByInspectionID(inspectionID)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	return c.JSON(http.StatusOK, attachments)
+}
+
+// HandlePostDeviceAttachment uploads a photo or document against a device
+func (a *App) HandlePostDeviceAttachment(c echo.Context) error {
+	deviceID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid device ID", err)
+	}
+
+	if _, err := a.DB.GetDeviceByID(deviceID); err != nil {
+		return a.handleError(c, http.StatusNotFound, "Device not found", err)
+	}
+
+	attachment := &models.Attachment{
+		EmergencyDeviceID: sql.NullInt64{Int64: int64(deviceID), Valid: true},
+	}
+
+	return a.saveAttachment(c, attachment)
+}
+
+// HandlePostInspectionAttachment uploads a photo or document against an inspection
+func (a *App) HandlePostInspectionAttachment(c echo.Context) error {
+	inspectionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid inspection ID", err)
+	}
+
+	if _, err := a.DB.GetInspectionByID(inspectionID); err != nil {
+		return a.handleError(c, http.StatusNotFound, "Inspection not found", err)
+	}
+
+	attachment := &models.Attachment{
+		EmergencyDeviceInspectionID: sql.NullInt64{Int64: int64(inspectionID), Valid: true},
+	}
+
+	return a.saveAttachment(c, attachment)
+}
+
+// workOrderInspection returns the ID of the inspection that raised a work order, or the
+// status and message to respond with
+func (a *App) workOrderInspection(c echo.Context) (int, int, string) {
+	inspectionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return 0, http.StatusBadRequest, "Invalid inspection ID"
+	}
+
+	inspection, err := a.DB.GetInspectionByID(inspectionID)
+	if err != nil {
+		return 0, http.StatusNotFound, "Inspection not found"
+	}
+	if !inspection.WorkOrderRequired.Bool {
+		return 0, http.StatusBadRequest, "Inspection did not raise a work order"
+	}
+
+	return inspectionID, 0, ""
+}
+
+// HandleGetWorkOrderAttachments lists the attachments of the work order an inspection
+// raised
+func (a *App) HandleGetWorkOrderAttachments(c echo.Context) error {
+	inspectionID, status, message := a.workOrderInspection(c)
+	if message != "" {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	attachments, err := a.DB.GetAttachmentsByWorkOrderID(inspectionID)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	return c.JSON(http.StatusOK, attachments)
+}
+
+// HandlePostWorkOrderAttachment uploads an invoice, certificate or photo of the repair
+// against the work order an inspection raised
+func (a *App) HandlePostWorkOrderAttachment(c echo.Context) error {
+	inspectionID, status, message := a.workOrderInspection(c)
+	if message != "" {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	attachment := &models.Attachment{
+		WorkOrderInspectionID: sql.NullInt64{Int64: int64(inspectionID), Valid: true},
+	}
+
+	return a.saveAttachment(c, attachment)
+}
+
+// saveAttachment validates the uploaded file, writes it and its thumbnail to the file
+// store and records it against the owner already set on attachment
+func (a *App) saveAttachment(c echo.Context, attachment *models.Attachment) error {
+	userID, _, err := currentUser(c)
+	if err != nil {
+		return a.handleError(c, http.StatusUnauthorized, "Not logged in", err)
+	}
+
+	// Cap the request body so an oversized upload is rejected while streaming
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, maxAttachmentSize+(1<<20))
+
+	file, header, err := c.Request().FormFile("file")
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "A file is required, maximum size 10 MB", err)
+	}
+	defer file.Close()
+
+	description := strings.TrimSpace(c.FormValue("description"))
+	if len(description) > 255 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Description must be less than 255 characters"})
+	}
+	attachment.Description = sql.NullString{String: description, Valid: description != ""}
+	attachment.UploadedBy = userID
+
+	if err := a.storeAttachmentFile(c.Request().Context(), attachment, file, header, allowedAttachmentTypes); err != nil {
+		var uploadErr *uploadError
+		if errors.As(err, &uploadErr) {
+			return c.JSON(uploadErr.status, map[string]string{"error": uploadErr.message})
+		}
+		return a.handleError(c, http.StatusInternalServerError, "Error saving file", err)
+	}
+
+	attachmentID, err := a.DB.AddAttachment(attachment)
+	if err != nil {
+		a.removeAttachmentFiles([]models.Attachment{*attachment})
+		return a.handleError(c, http.StatusInternalServerError, "Error saving attachment", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":       "Attachment uploaded successfully",
+		"attachment_id": attachmentID,
+	})
+}
+
+// uploadError is a problem with the uploaded file itself, reported back to the user
+type uploadError struct {
+	status  int
+	message string
+}
+
+func (e *uploadError) Error() string {
+	return e.message
+}
+
+// storeAttachmentFile checks an uploaded file's size and sniffed type against allowed,
+// writes it and a thumbnail for images to the file store and fills in the file fields
+// of attachment. The caller saves the attachment row.
+func (a *App) storeAttachmentFile(ctx context.Context, attachment *models.Attachment, file multipart.File, header *multipart.FileHeader, allowed map[string]string) error {
+	if header.Size > maxAttachmentSize {
+		return &uploadError{http.StatusRequestEntityTooLarge, "File is too large, maximum size 10 MB"}
+	}
+
+	data, err := utils.ReadLimited(file, maxAttachmentSize)
+	if err != nil {
+		return &uploadError{http.StatusRequestEntityTooLarge, "File is too large, maximum size 10 MB"}
+	}
+
+	return a.storeAttachmentData(ctx, attachment, header.Filename, data, allowed)
+}
+
+// storeAttachmentData saves the contents of an upload that has already been read
+func (a *App) storeAttachmentData(ctx context.Context, attachment *models.Attachment, fileName string, data []byte, allowed map[string]string) error {
+	if int64(len(data)) > maxAttachmentSize {
+		return &uploadError{http.StatusRequestEntityTooLarge, "File is too large, maximum size 10 MB"}
+	}
+
+	// Trust the file contents, not the client's file name or Content-Type header
+	contentType := http.DetectContentType(data)
+	ext, ok := allowed[contentType]
+	if !ok {
+		return &uploadError{http.StatusUnsupportedMediaType, "Invalid file type. Allowed types: " + allowedTypeNames(allowed)}
+	}
+
+	fileName = filepath.Base(fileName)
+	if len(fileName) > 255 {
+		fileName = fileName[len(fileName)-255:]
+	}
+
+	key, err := newStorageKey()
+	if err != nil {
+		return err
+	}
+
+	attachment.FileName = fileName
+	attachment.ContentType = contentType
+	attachment.SizeBytes = int64(len(data))
+	attachment.SHA256 = sql.NullString{String: sha256Hex(data), Valid: true}
+	attachment.StorageKey = "attachments/" + key + ext
+
+	if err := a.Store.Put(ctx, attachment.StorageKey, bytes.NewReader(data), contentType); err != nil {
+		return err
+	}
+
+	// A thumbnail is a convenience, so a failure only means the image is shown full size
+	if strings.HasPrefix(contentType, "image/") {
+		if thumbnail, err := utils.MakeThumbnail(data, thumbnailSize); err != nil {
+			a.handleLogger("Could not create thumbnail: " + err.Error())
+		} else {
+			thumbnailKey := "attachments/" + key + "_thumb.jpg"
+			if err := a.Store.Put(ctx, thumbnailKey, bytes.NewReader(thumbnail), "image/jpeg"); err != nil {
+				a.handleLogger("Could not save thumbnail: " + err.Error())
+			} else {
+				attachment.ThumbnailKey = sql.NullString{String: thumbnailKey, Valid: true}
+			}
+		}
+	}
+
+	return nil
+}
+
+// allowedTypeNames lists the extensions of the allowed types for error messages
+func allowedTypeNames(allowed map[string]string) string {
+	names := make([]string, 0, len(allowed))
+	for _, ext := range allowed {
+		names = append(names, strings.TrimPrefix(ext, "."))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// HandleGetAttachment streams an attachment's file to a user allowed to see it
+func (a *App) HandleGetAttachment(c echo.Context) error {
+	return a.serveAttachment(c, false)
+}
+
+// HandleGetAttachmentThumbnail streams an image attachment's thumbnail
+func (a *App) HandleGetAttachmentThumbnail(c echo.Context) error {
+	return a.serveAttachment(c, true)
+}
+
+func (a *App) serveAttachment(c echo.Context, thumbnail bool) error {
+	attachmentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid attachment ID", err)
+	}
+
+	attachment, err := a.DB.GetAttachmentByID(attachmentID)
+	if err != nil {
+		return a.handleError(c, http.StatusNotFound, "Attachment not found", err)
+	}
+
+	_, role, err := currentUser(c)
+	if err != nil {
+		return a.handleError(c, http.StatusUnauthorized, "Not logged in", err)
+	}
+	if !canViewAttachment(attachment, role) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "You do not have permission to view this attachment"})
+	}
+
+	key, contentType := attachment.StorageKey, attachment.ContentType
+	if thumbnail {
+		if !attachment.ThumbnailKey.Valid {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Attachment has no thumbnail"})
+		}
+		key, contentType = attachment.ThumbnailKey.String, "image/jpeg"
+	}
+
+	file, err := a.Store.Get(c.Request().Context(), key)
+	if err == storage.ErrNotFound {
+		return a.handleError(c, http.StatusNotFound, "Attachment file not found", err)
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error reading attachment", err)
+	}
+	defer file.Close()
+
+	header := c.Response().Header()
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Cache-Control", "private, max-age=3600")
+	header.Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", attachment.FileName))
+
+	return c.Stream(http.StatusOK, contentType, file)
+}
+
+// HandleDeleteAttachment removes an attachment. Admins may remove any attachment, and
+// users the device attachments they uploaded. Photos answering a checklist question are
+// part of the inspection record and are never removed.
+func (a *App) HandleDeleteAttachment(c echo.Context) error {
+	attachmentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid attachment ID", err)
+	}
+
+	attachment, err := a.DB.GetAttachmentByID(attachmentID)
+	if err != nil {
+		return a.handleError(c, http.StatusNotFound, "Attachment not found", err)
+	}
+
+	userID, role, err := currentUser(c)
+	if err != nil {
+		return a.handleError(c, http.StatusUnauthorized, "Not logged in", err)
+	}
+	if role != "Admin" && !(canViewAttachment(attachment, role) && attachment.UploadedBy == userID) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "You do not have permission to delete this attachment"})
+	}
+
+	err = a.DB.DeleteAttachment(attachmentID)
+	if errors.Is(err, database.ErrAttachmentIsAnswer) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Photos answering a checklist question are part of the inspection record and cannot be deleted"})
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error deleting attachment", err)
+	}
+
+	a.removeAttachmentFiles([]models.Attachment{*attachment})
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Attachment deleted successfully"})
+}
+
+// canViewAttachment applies the access rules of the attachment's owner, so an attachment
+// is never more visible than what it is attached to. Device attachments are visible to
+// every logged in user, like the devices themselves. Inspection and work order
+// attachments follow the inspection routes and are limited to admins.
+func canViewAttachment(attachment *models.Attachment, role string) bool {
+	return role == "Admin" || attachment.EmergencyDeviceID.Valid
+}
+
+// removeAttachmentFiles deletes the stored files of attachments whose rows are gone.
+// Failures are logged, a leftover file is harmless once nothing references it.
+func (a *App) removeAttachmentFiles(attachments []models.Attachment) {
+	for _, attachment := range attachments {
+		keys := []string{attachment.StorageKey}
+		if attachment.ThumbnailKey.Valid {
+			keys = append(keys, attachment.ThumbnailKey.String)
+		}
+		for _, key := range keys {
+			if err := a.Store.Delete(context.Background(), key); err != nil {
+				a.handleLogger("Could not remove attachment file " + key + ": " + err.Error())
+			}
+		}
+	}
+}
+
+// newStorageKey returns a random name so stored files cannot be guessed or collide
+func newStorageKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -65,7 +65,7 @@ func (a *App) HandlePostForgotPassword(c echo.Context) error {
 	a.handleLogger(emailmessage)
 
 	// Send the new password to the user's email
-	if err := sendPasswordResetEmail(email, user.Username, newPassword); err != nil {
+	if err := a.sendPasswordResetEmail(email, user.Username, newPassword); err != nil {
 		return c.Redirect(http.StatusSeeOther, "/?message="+emailmessage)
 	}
 	message := fmt.Sprintf("Password reset successful. Check your %s for the new password.", email)
@@ -268,6 +268,9 @@ func (a *App) HandleGetLogout(c echo.Context) error {
 		})
 	}
 
+	// Revoke the token so a copy of it cannot be used after logging out
+	a.revokeToken(c)
+
 	// Clear JWT or session cookie
 	cookie := &http.Cookie{
 		Name:     "token",
@@ -291,6 +294,12 @@ func (a *App) HandleGetLogout(c echo.Context) error {
 
 // GenerateToken generates a JWT token
 func GenerateToken(user *models.User, expiresAt time.Time) (string, error) {
+	// A unique ID lets the token be revoked when the user logs out
+	tokenID, err := newStorageKey()
+	if err != nil {
+		return "", err
+	}
+
 	claims := &CustomClaims{
 		UserID:       strconv.Itoa(user.UserID),
 		Email:        user.Email,
@@ -298,6 +307,7 @@ func GenerateToken(user *models.User, expiresAt time.Time) (string, error) {
 		Role:         user.Role,
 		DefaultAdmin: user.DefaultAdmin,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 		},
 	}
@@ -307,6 +317,27 @@ func GenerateToken(user *models.User, expiresAt time.Time) (string, error) {
 	return token.SignedString([]byte(secret))
 }
 
+// revokeToken records the ID of the request's token until the token expires
+func (a *App) revokeToken(c echo.Context) {
+	cookie, err := c.Cookie("token")
+	if err != nil || cookie.Value == "" {
+		return
+	}
+
+	token, err := parseToken(cookie.Value)
+	if err != nil || !token.Valid {
+		return
+	}
+	claims := token.Claims.(*CustomClaims)
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return
+	}
+
+	if err := a.DB.RevokeToken(claims.ID, claims.ExpiresAt.Time); err != nil {
+		a.handleLogger("Error revoking token: " + err.Error())
+	}
+}
+
 // parseToken parses and validates the JWT token
 func parseToken(tokenString string) (*jwt.Token, error) {
 	secret := config.LoadConfig().JWTSecret
@@ -319,10 +350,9 @@ func parseToken(tokenString string) (*jwt.Token, error) {
 }
 
 // sendPasswordResetEmail sends a password reset email
-func sendPasswordResetEmail(email, username, newPassword string) error {
+func (a *App) sendPasswordResetEmail(email, username, newPassword string) error {
 	m := gomail.NewMessage()
 	m.Reset()
-	m.SetHeader("From", "MS_kAX6BH@trial-jpzkmgqev0vg059v.mlsender.net")
 	m.SetHeader("To", email)
 	m.SetHeader("Subject", "EDMS PASSWORD RESET")
 	m.SetBody("text/plain", "Your Username is "+username+", Your new password is: "+newPassword)
@@ -332,10 +362,8 @@ func sendPasswordResetEmail(email, username, newPassword string) error {
 		<p>Your new password is: <strong>`+newPassword+`</strong></p>
 	</body></html>`)
 
-	d := gomail.NewDialer("smtp.gmail.com", 587, "edms4758@gmail.com", "dksz kwoc zjiv cqub")
-
 	fmt.Println("Sending email to", email)
 	fmt.Println("Username:", username)
 	fmt.Println("New Password:", newPassword)
-	return d.DialAndSend(m)
+	return a.sendEmail(m)
 }
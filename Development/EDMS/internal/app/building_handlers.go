@@ -1,6 +1,9 @@
 package app
 
 import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -9,6 +12,58 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+// Most points a building outline can have
+const maxMapPolygonPoints = 200
+
+// parseBuildingMapPosition reads a building's position on its site map and optional
+// outline, given as a JSON array of [x, y] points. Both are in pixels of the site map
+// image from its top left corner, and all may be left blank.
+func parseBuildingMapPosition(mapX, mapY, mapPolygon string) (sql.NullFloat64, sql.NullFloat64, [][2]float64, error) {
+	var x, y sql.NullFloat64
+	mapX, mapY, mapPolygon = strings.TrimSpace(mapX), strings.TrimSpace(mapY), strings.TrimSpace(mapPolygon)
+
+	if mapX != "" || mapY != "" {
+		if mapX == "" || mapY == "" {
+			return x, y, nil, fmt.Errorf("map X and Y must both be set")
+		}
+		parsedX, errX := strconv.ParseFloat(mapX, 64)
+		parsedY, errY := strconv.ParseFloat(mapY, 64)
+		if errX != nil || errY != nil || parsedX < 0 || parsedY < 0 {
+			return x, y, nil, fmt.Errorf("map X and Y must be numbers of at least 0")
+		}
+		x = sql.NullFloat64{Float64: parsedX, Valid: true}
+		y = sql.NullFloat64{Float64: parsedY, Valid: true}
+	}
+
+	if mapPolygon == "" {
+		return x, y, nil, nil
+	}
+	var polygon [][2]float64
+	if err := json.Unmarshal([]byte(mapPolygon), &polygon); err != nil {
+		return x, y, nil, fmt.Errorf("map outline must be a list of [x, y] points")
+	}
+	if len(polygon) < 3 || len(polygon) > maxMapPolygonPoints {
+		return x, y, nil, fmt.Errorf("map outline must have between 3 and %d points", maxMapPolygonPoints)
+	}
+	for _, point := range polygon {
+		if point[0] < 0 || point[1] < 0 {
+			return x, y, nil, fmt.Errorf("map outline points must be at least 0")
+		}
+	}
+	// A building with an outline is positioned at its centre unless told otherwise
+	if !x.Valid {
+		var sumX, sumY float64
+		for _, point := range polygon {
+			sumX += point[0]
+			sumY += point[1]
+		}
+		x = sql.NullFloat64{Float64: sumX / float64(len(polygon)), Valid: true}
+		y = sql.NullFloat64{Float64: sumY / float64(len(polygon)), Valid: true}
+	}
+
+	return x, y, polygon, nil
+}
+
 func (a *App) HandleGetAllBuildings(c echo.Context) error {
 	// Check if request if a POST request
 	if c.Request().Method != http.MethodGet {
@@ -85,9 +140,21 @@ func (a *App) HandlePostBuilding(c echo.Context) error {
 		return c.Redirect(http.StatusSeeOther, "/admin?error=Building already exists at the site")
 	}
 
+	mapX, mapY, mapPolygon, err := parseBuildingMapPosition(
+		c.FormValue("addBuildingMapX"),
+		c.FormValue("addBuildingMapY"),
+		c.FormValue("addBuildingMapPolygon"),
+	)
+	if err != nil {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Invalid map position, "+err.Error())
+	}
+
 	building := &models.Building{
 		SiteID:       siteIdNum,
 		BuildingCode: buildingCode,
+		MapX:         mapX,
+		MapY:         mapY,
+		MapPolygon:   mapPolygon,
 	}
 
 	err = a.DB.AddBuilding(building)
@@ -161,19 +228,31 @@ func (a *App) HandleEditBuilding(c echo.Context) error {
 		})
 	}
 
-	// Check if the building already exists
-	_, err = a.DB.GetBuildingByCodeandSite(building.BuildingCode, siteIdNum)
-	if err == nil {
+	// Check if another building already has the code, the building's own code may be
+	// kept while its map position is changed
+	existing, err := a.DB.GetBuildingByCodeandSite(building.BuildingCode, siteIdNum)
+	if err == nil && existing.BuildingID != buildingIDNum {
 		return c.JSON(http.StatusOK, map[string]string{
 			"error":       "Building already exists at the site",
 			"redirectURL": "/admin?error=Building already exists at the site",
 		})
 	}
 
+	mapX, mapY, mapPolygon, err := parseBuildingMapPosition(building.MapX, building.MapY, building.MapPolygon)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Invalid map position, " + err.Error(),
+			"redirectURL": "/admin?error=Invalid map position, " + err.Error(),
+		})
+	}
+
 	buildingModel := &models.Building{
 		BuildingID:   buildingIDNum,
 		SiteID:       siteIdNum,
 		BuildingCode: building.BuildingCode,
+		MapX:         mapX,
+		MapY:         mapY,
+		MapPolygon:   mapPolygon,
 	}
 
 	err = a.DB.UpdateBuilding(buildingModel)
@@ -255,6 +334,15 @@ func (a *App) HandleDeleteBuilding(c echo.Context) error {
 		})
 	}
 
+	// The building's floors are deleted with it
+	floors, err := a.DB.GetAllFloors(buildingID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error":       "Error fetching floors",
+			"redirectURL": "/admin?error=Error fetching floors",
+		})
+	}
+
 	// Delete the building from the database
 	err = a.DB.DeleteBuilding(buildingID)
 	if err != nil {
@@ -264,6 +352,11 @@ func (a *App) HandleDeleteBuilding(c echo.Context) error {
 		})
 	}
 
+	a.deleteFloorPlan(c.Request().Context(), building.FloorPlanImagePath)
+	for _, floor := range floors {
+		a.deleteFloorPlan(c.Request().Context(), floor.FloorPlanImagePath)
+	}
+
 	// Respond to the client
 	return c.JSON(http.StatusOK, map[string]string{
 		"message":     "Building deleted successfully",
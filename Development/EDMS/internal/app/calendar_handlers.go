@@ -0,0 +1,259 @@
+package app
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/ical"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/labstack/echo/v4"
+)
+
+// Calendar apps are asked to fetch the feed this often, so recorded inspections show up
+const calendarRefreshInterval = time.Hour
+
+// newCalendarToken returns a random token for a calendar feed URL
+func newCalendarToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// calendarFeedURL returns the address calendar apps subscribe to
+func (a *App) calendarFeedURL(token string) string {
+	return a.BaseURL + "/calendar/" + token + ".ics"
+}
+
+// deviceURL returns a link to a device on the dashboard
+func (a *App) deviceURL(deviceID int) string {
+	return fmt.Sprintf("%s/dashboard?device=%d", a.BaseURL, deviceID)
+}
+
+// calendarEvents returns an event for each device's next inspection and expiry. The
+// UID includes the date, so an event is replaced once an inspection moves the date on.
+func (a *App) calendarEvents(devices []models.EmergencyDevice) []ical.Event {
+	events := []ical.Event{}
+	for _, device := range devices {
+		name := device.EmergencyDeviceTypeName
+		if device.SerialNumber.Valid && device.SerialNumber.String != "" {
+			name += " " + device.SerialNumber.String
+		}
+		location := fmt.Sprintf("%s, Building %s, Room %s", device.SiteName, device.BuildingCode, device.RoomCode)
+		description := "View device: " + a.deviceURL(device.EmergencyDeviceID)
+		if device.Status.Valid {
+			description = "Status: " + device.Status.String + "\n" + description
+		}
+
+		if device.NextInspectionDate.Valid {
+			events = append(events, ical.Event{
+				UID:         fmt.Sprintf("inspection-%d-%s@edms", device.EmergencyDeviceID, device.NextInspectionDate.Time.Format("20060102")),
+				Date:        device.NextInspectionDate.Time,
+				Summary:     "Inspection due: " + name,
+				Location:    location,
+				Description: description,
+				URL:         a.deviceURL(device.EmergencyDeviceID),
+			})
+		}
+		if device.ExpireDate.Valid {
+			events = append(events, ical.Event{
+				UID:         fmt.Sprintf("expiry-%d-%s@edms", device.EmergencyDeviceID, device.ExpireDate.Time.Format("20060102")),
+				Date:        device.ExpireDate.Time,
+				Summary:     "Expires: " + name,
+				Location:    location,
+				Description: description,
+				URL:         a.deviceURL(device.EmergencyDeviceID),
+			})
+		}
+	}
+	return events
+}
+
+// HandleGetCalendarFeed serves a user's calendar feed to calendar apps, which cannot log
+// in, so the token in the URL is checked instead
+func (a *App) HandleGetCalendarFeed(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.String(http.StatusMethodNotAllowed, "Method not allowed")
+	}
+
+	token, ok := strings.CutSuffix(c.Param("file"), ".ics")
+	if !ok || token == "" {
+		return c.String(http.StatusNotFound, "Calendar not found")
+	}
+
+	feed, err := a.DB.GetCalendarFeedByToken(token)
+	if err == sql.ErrNoRows {
+		return c.String(http.StatusNotFound, "Calendar not found")
+	} else if err != nil {
+		a.handleLogger("Error fetching calendar feed: " + err.Error())
+		return c.String(http.StatusInternalServerError, "Error fetching calendar")
+	}
+
+	devices, err := a.DB.GetCalendarDevices(feed.UserID)
+	if err != nil {
+		a.handleLogger("Error fetching calendar devices: " + err.Error())
+		return c.String(http.StatusInternalServerError, "Error fetching calendar")
+	}
+	if err := a.DB.MarkCalendarFeedFetched(feed.UserID); err != nil {
+		a.handleLogger("Error recording calendar fetch: " + err.Error())
+	}
+
+	cal := ical.Calendar{
+		Name:            "EDMS inspections and expiries",
+		RefreshInterval: calendarRefreshInterval,
+		Events:          a.calendarEvents(devices),
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/calendar; charset=utf-8")
+	res.Header().Set(echo.HeaderContentDisposition, `inline; filename="edms.ics"`)
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.WriteHeader(http.StatusOK)
+	return cal.Write(res, time.Now())
+}
+
+// calendarSettings returns the sites the user follows and their feed URL
+func (a *App) calendarSettings(userID int) (models.CalendarSettings, error) {
+	settings := models.CalendarSettings{}
+
+	siteIDs, err := a.DB.GetFollowedSiteIDs(userID)
+	if err != nil {
+		return settings, err
+	}
+	settings.SiteIDs = siteIDs
+
+	feed, err := a.DB.GetCalendarFeed(userID)
+	if err == sql.ErrNoRows {
+		return settings, nil
+	} else if err != nil {
+		return settings, err
+	}
+	settings.FeedURL = a.calendarFeedURL(feed.Token)
+	settings.LastFetchedAt = feed.LastFetchedAt
+
+	return settings, nil
+}
+
+// HandleGetCalendarSettings returns the logged in user's followed sites and feed URL
+func (a *App) HandleGetCalendarSettings(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	userID, _, err := currentUser(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	settings, err := a.calendarSettings(userID)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	return c.JSON(http.StatusOK, settings)
+}
+
+// HandlePutCalendarSettings sets the sites the logged in user follows, and gives them a
+// feed if they do not have one yet
+func (a *App) HandlePutCalendarSettings(c echo.Context) error {
+	// Check if request is a PUT request
+	if c.Request().Method != http.MethodPut {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+
+	userID, _, err := currentUser(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	var dto models.CalendarSettingsDto
+	if err := c.Bind(&dto); err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid request", err)
+	}
+	for _, siteID := range dto.SiteIDs {
+		if _, err := a.DB.GetSiteByID(strconv.Itoa(siteID)); err != nil {
+			return a.handleError(c, http.StatusBadRequest, "Site not found", err)
+		}
+	}
+
+	if err := a.DB.SetFollowedSites(userID, dto.SiteIDs); err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error saving calendar settings", err)
+	}
+
+	if _, err := a.DB.GetCalendarFeed(userID); err == sql.ErrNoRows {
+		token, err := newCalendarToken()
+		if err != nil {
+			return a.handleError(c, http.StatusInternalServerError, "Error saving calendar settings", err)
+		}
+		if err := a.DB.SaveCalendarFeed(userID, token); err != nil {
+			return a.handleError(c, http.StatusInternalServerError, "Error saving calendar settings", err)
+		}
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error saving calendar settings", err)
+	}
+
+	settings, err := a.calendarSettings(userID)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	return c.JSON(http.StatusOK, settings)
+}
+
+// HandleResetCalendarFeed gives the logged in user a new feed URL, the old one stops
+// working, for when it has been shared by mistake
+func (a *App) HandleResetCalendarFeed(c echo.Context) error {
+	// Check if request is a POST request
+	if c.Request().Method != http.MethodPost {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+
+	userID, _, err := currentUser(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	token, err := newCalendarToken()
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error resetting calendar feed", err)
+	}
+	if err := a.DB.SaveCalendarFeed(userID, token); err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error resetting calendar feed", err)
+	}
+
+	settings, err := a.calendarSettings(userID)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	return c.JSON(http.StatusOK, settings)
+}
+
+// HandleDeleteCalendarFeed turns off the logged in user's feed, the sites they follow
+// are kept
+func (a *App) HandleDeleteCalendarFeed(c echo.Context) error {
+	// Check if request is a DELETE request
+	if c.Request().Method != http.MethodDelete {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+
+	userID, _, err := currentUser(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	if err := a.DB.DeleteCalendarFeed(userID); err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error turning off calendar feed", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Calendar feed turned off"})
+}
@@ -0,0 +1,349 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/labstack/echo/v4"
+)
+
+var checklistAnswerTypes = map[string]bool{
+	models.AnswerTypeYesNoNA: true,
+	models.AnswerTypeNumber:  true,
+	models.AnswerTypeText:    true,
+	models.AnswerTypePhoto:   true,
+}
+
+// HandleGetAllChecklistTemplates lists every checklist template version, optionally for one device type
+func (a *App) HandleGetAllChecklistTemplates(c echo.Context) error {
+	// Check if request if a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	templates, err := a.DB.GetAllChecklistTemplates(c.QueryParam("device_type_id"))
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	// Return the results as JSON
+	return c.JSON(http.StatusOK, templates)
+}
+
+// HandleGetChecklistTemplateByID returns a checklist template version with its questions
+func (a *App) HandleGetChecklistTemplateByID(c echo.Context) error {
+	// Check if request if a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	templateID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid checklist template ID", err)
+	}
+
+	template, err := a.DB.GetChecklistTemplateByID(templateID)
+	if err == sql.ErrNoRows {
+		return a.handleError(c, http.StatusNotFound, "Checklist template not found", err)
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	// Return the results as JSON
+	return c.JSON(http.StatusOK, template)
+}
+
+// HandleGetDeviceChecklist returns the checklist a new inspection of the device is answered against
+func (a *App) HandleGetDeviceChecklist(c echo.Context) error {
+	// Check if request if a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	deviceID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid device ID", err)
+	}
+
+	device, err := a.DB.GetDeviceByID(deviceID)
+	if err != nil {
+		return a.handleError(c, http.StatusNotFound, "Device not found", err)
+	}
+
+	template, err := a.DB.GetLatestChecklistTemplate(device.EmergencyDeviceTypeID)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "No checklist template for " + device.EmergencyDeviceTypeName})
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	// Return the results as JSON
+	return c.JSON(http.StatusOK, template)
+}
+
+// HandlePostChecklistTemplate saves a question set as the next version of a device type's checklist.
+// Existing versions are never changed so past inspections keep the questions they answered.
+func (a *App) HandlePostChecklistTemplate(c echo.Context) error {
+	// Check if request is not a post request
+	if c.Request().Method != http.MethodPost {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{
+			"error":       "Method not allowed",
+			"redirectURL": "/admin?error=Method not allowed",
+		})
+	}
+
+	var templateDto models.ChecklistTemplateDto
+	if err := c.Bind(&templateDto); err != nil {
+		a.handleLogger("Error binding request body: " + err.Error())
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Invalid request body",
+			"redirectURL": "/admin?error=Invalid request body",
+		})
+	}
+
+	template, err := a.validateChecklistTemplate(&templateDto)
+	if err != nil {
+		a.handleLogger("Error validating checklist template: " + err.Error())
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Error validating checklist template: " + err.Error(),
+			"redirectURL": "/admin?error=" + err.Error(),
+		})
+	}
+
+	if userID, _, err := currentUser(c); err == nil {
+		template.CreatedBy = sql.NullInt64{Int64: int64(userID), Valid: true}
+	}
+
+	templateID, err := a.DB.AddChecklistTemplate(template)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error saving checklist template", err)
+	}
+
+	message := fmt.Sprintf("Checklist template %s v%d added successfully", template.TemplateName, template.Version)
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":               message,
+		"checklist_template_id": templateID,
+		"version":               template.Version,
+		"redirectURL":           "/admin?message=" + message,
+	})
+}
+
+// HandleDeleteChecklistTemplate removes a template version that has never been used
+func (a *App) HandleDeleteChecklistTemplate(c echo.Context) error {
+	// Check if request is not a delete request
+	if c.Request().Method != http.MethodDelete {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{
+			"error":       "Method not allowed",
+			"redirectURL": "/admin?error=Method not allowed",
+		})
+	}
+
+	templateID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Invalid checklist template ID",
+			"redirectURL": "/admin?error=Invalid checklist template ID",
+		})
+	}
+
+	template, err := a.DB.GetChecklistTemplateByID(templateID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error":       "Checklist template not found",
+			"redirectURL": "/admin?error=Checklist template not found",
+		})
+	}
+
+	if template.InspectionCount > 0 {
+		return c.JSON(http.StatusOK, map[string]string{
+			"error":       "Cannot delete a checklist template that inspections have been recorded against",
+			"redirectURL": "/admin?error=Cannot delete a checklist template that inspections have been recorded against",
+		})
+	}
+
+	err = a.DB.DeleteChecklistTemplate(templateID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error":       "Error deleting checklist template",
+			"redirectURL": "/admin?error=Error deleting checklist template",
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message":     "Checklist template deleted successfully",
+		"redirectURL": "/admin?message=Checklist template deleted successfully",
+	})
+}
+
+func (a *App) validateChecklistTemplate(dto *models.ChecklistTemplateDto) (*models.ChecklistTemplate, error) {
+	var template models.ChecklistTemplate
+
+	deviceTypeID, err := strconv.Atoi(dto.EmergencyDeviceTypeID)
+	if err != nil {
+		return nil, errors.New("device type is required")
+	}
+	if _, err := a.DB.GetEmergencyDeviceTypeByID(deviceTypeID); err != nil {
+		return nil, errors.New("device type does not exist")
+	}
+	template.EmergencyDeviceTypeID = deviceTypeID
+
+	templateName := strings.TrimSpace(dto.TemplateName)
+	if templateName == "" || len(templateName) > 100 {
+		return nil, errors.New("template name must be between 1 and 100 characters")
+	}
+	template.TemplateName = templateName
+
+	if len(dto.Questions) == 0 {
+		return nil, errors.New("a checklist needs at least one question")
+	}
+
+	for i, questionDto := range dto.Questions {
+		questionText := strings.TrimSpace(questionDto.QuestionText)
+		if questionText == "" || len(questionText) > 255 {
+			return nil, fmt.Errorf("question %d must be between 1 and 255 characters", i+1)
+		}
+		if !checklistAnswerTypes[questionDto.AnswerType] {
+			return nil, fmt.Errorf("question %d has an invalid answer type, allowed types: YesNoNA, Number, Text, Photo", i+1)
+		}
+		severity := questionDto.Severity
+		if severity == "" {
+			severity = models.SeverityCritical
+		}
+		if severity != models.SeverityCritical && severity != models.SeverityAdvisory && severity != models.SeverityInformational {
+			return nil, fmt.Errorf("question %d has an invalid severity, allowed severities: Critical, Advisory, Informational", i+1)
+		}
+
+		template.Questions = append(template.Questions, models.ChecklistQuestion{
+			SortOrder:    i + 1,
+			QuestionText: questionText,
+			AnswerType:   questionDto.AnswerType,
+			IsRequired:   questionDto.IsRequired,
+			Severity:     severity,
+		})
+	}
+
+	return &template, nil
+}
+
+// parseChecklistAnswers reads the submitted answer to each question of the template.
+// Answers are posted as answer_<question id>, photos as the file photo_<question id>.
+// Photos are written to the file store straight away; they are removed again if an
+// answer is invalid, otherwise the caller owns them.
+func (a *App) parseChecklistAnswers(c echo.Context, template *models.ChecklistTemplate, userID int) ([]models.InspectionResponse, error) {
+	var responses []models.InspectionResponse
+
+	fail := func(err error) ([]models.InspectionResponse, error) {
+		a.removeResponsePhotos(responses)
+		return nil, err
+	}
+
+	for _, question := range template.Questions {
+		response := models.InspectionResponse{
+			ChecklistQuestionID: question.ChecklistQuestionID,
+			QuestionText:        question.QuestionText,
+			AnswerType:          question.AnswerType,
+			Severity:            question.Severity,
+		}
+		if question.AnswerType == models.AnswerTypePhoto {
+			file, header, err := c.Request().FormFile(fmt.Sprintf("photo_%d", question.ChecklistQuestionID))
+			if err == nil {
+				photo := &models.Attachment{
+					Description: sql.NullString{String: question.QuestionText, Valid: true},
+					UploadedBy:  userID,
+				}
+				err = a.storeAttachmentFile(c.Request().Context(), photo, file, header, allowedPhotoTypes)
+				file.Close()
+				if err != nil {
+					return fail(fmt.Errorf("%s: %v", question.QuestionText, err))
+				}
+				response.Photo = photo
+			}
+		} else {
+			value := c.FormValue(fmt.Sprintf("answer_%d", question.ChecklistQuestionID))
+			if err := setChecklistAnswer(&response, question, value); err != nil {
+				return fail(err)
+			}
+		}
+
+		answered := response.AnswerYesNo.Valid || response.AnswerNumber.Valid || response.AnswerText.Valid || response.Photo != nil
+		if question.IsRequired && !answered {
+			return fail(fmt.Errorf("%s is required", question.QuestionText))
+		}
+		if answered {
+			responses = append(responses, response)
+		}
+	}
+
+	return responses, nil
+}
+
+// setChecklistAnswer validates a typed answer to a question and stores it on the response,
+// an empty value leaves the question unanswered
+func setChecklistAnswer(response *models.InspectionResponse, question models.ChecklistQuestion, value string) error {
+	value = strings.TrimSpace(value)
+
+	switch question.AnswerType {
+	case models.AnswerTypeYesNoNA:
+		if value != "" && value != "Yes" && value != "No" && value != "N/A" {
+			return fmt.Errorf("%s must be answered Yes, No or N/A", question.QuestionText)
+		}
+		response.AnswerYesNo = sql.NullString{String: value, Valid: value != ""}
+	case models.AnswerTypeNumber:
+		response.AnswerNumber = sql.NullFloat64{}
+		if value != "" {
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("%s must be a number", question.QuestionText)
+			}
+			// Answers are stored to three decimal places
+			number = math.Round(number*1000) / 1000
+			response.AnswerNumber = sql.NullFloat64{Float64: number, Valid: true}
+		}
+	case models.AnswerTypeText:
+		if len(value) > 1000 {
+			return fmt.Errorf("%s must be less than 1000 characters", question.QuestionText)
+		}
+		response.AnswerText = sql.NullString{String: value, Valid: value != ""}
+	default:
+		return fmt.Errorf("%s must be answered with a photo", question.QuestionText)
+	}
+
+	return nil
+}
+
+// computeInspectionOutcome derives the inspection status from the checklist answers.
+// Any critical question answered "No" fails the inspection, an advisory one passes it
+// with defects and an informational one has no effect. Only Yes/No/N/A questions count
+// towards the outcome.
+func computeInspectionOutcome(responses []models.InspectionResponse) string {
+	outcome := models.InspectionStatusPassed
+	for _, response := range responses {
+		if response.AnswerType != models.AnswerTypeYesNoNA || response.AnswerYesNo.String != "No" {
+			continue
+		}
+		switch response.Severity {
+		case models.SeverityCritical:
+			return models.InspectionStatusFailed
+		case models.SeverityAdvisory:
+			outcome = models.InspectionStatusPassedWithDefects
+		}
+	}
+	return outcome
+}
+
+// removeResponsePhotos deletes the stored files of photo answers that were not saved
+func (a *App) removeResponsePhotos(responses []models.InspectionResponse) {
+	var photos []models.Attachment
+	for _, response := range responses {
+		if response.Photo != nil {
+			photos = append(photos, *response.Photo)
+		}
+	}
+	a.removeAttachmentFiles(photos)
+}
@@ -3,6 +3,7 @@ package app
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -20,8 +21,9 @@ func (a *App) HandleGetAllDevices(c echo.Context) error {
 	}
 	siteId := c.QueryParam("site_id")
 	buildingCode := c.QueryParam("building_code")
+	floorId := c.QueryParam("floor_id")
 
-	emergencyDevices, err := a.DB.GetAllDevices(siteId, buildingCode)
+	emergencyDevices, err := a.DB.GetDevicesByLocation(siteId, buildingCode, floorId)
 	if err != nil {
 		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
 	}
@@ -71,6 +73,8 @@ func (a *App) HandlePostDevice(c echo.Context) error {
 	size := c.FormValue("size")
 	description := c.FormValue("description")
 	status := c.FormValue("status")
+	deviceModelIDStr := c.FormValue("device_model")
+	batchNumber := c.FormValue("batch_number")
 	a.handleLogger("Room: " + roomIDStr)
 	a.handleLogger("Emergency Device Type: " + emergencyDeviceTypeIDStr)
 	a.handleLogger("extinguisher_type_id: " + extinguisherTypeIDStr)
@@ -79,14 +83,19 @@ func (a *App) HandlePostDevice(c echo.Context) error {
 	a.handleLogger("size: " + size)
 	a.handleLogger("description: " + description)
 	a.handleLogger("status: " + status)
+	a.handleLogger("device_model: " + deviceModelIDStr)
+	a.handleLogger("batch_number: " + batchNumber)
 
 	// Validate input
-	emergencyDevice, err := validateDevice(roomIDStr, emergencyDeviceTypeIDStr, extinguisherTypeIDStr, serialNumber, manufactureDateStr, size, description, status)
+	emergencyDevice, err := validateDevice(roomIDStr, emergencyDeviceTypeIDStr, extinguisherTypeIDStr, serialNumber, manufactureDateStr, size, description, status, deviceModelIDStr, batchNumber)
 	if err != nil {
 		a.handleLogger("Error validating device: " + err.Error())
 		// Redirect to dashboard with error message
 		return c.Redirect(http.StatusSeeOther, "/dashboard?error="+"Error validating device: "+err.Error())
 	}
+	if err := a.validateDeviceModel(emergencyDevice); err != nil {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error="+"Error validating device: "+err.Error())
+	}
 
 	// Insert new emergency device
 	err = a.DB.AddEmergencyDevice(emergencyDevice)
@@ -95,6 +104,9 @@ func (a *App) HandlePostDevice(c echo.Context) error {
 		return c.Redirect(http.StatusSeeOther, "/dashboard?error="+err.Error())
 	}
 
+	// Flag the new device if it falls under an open recall
+	a.flagRecalledDevices()
+
 	// Redirect to dashboard with success message
 	return c.Redirect(http.StatusFound, "/dashboard?message=Device added successfully")
 }
@@ -138,19 +150,36 @@ func (a *App) HandlePutDevice(c echo.Context) error {
 	a.handleLogger("Size: " + device.Size)
 	a.handleLogger("Description: " + device.Description)
 	a.handleLogger("Status: " + device.Status)
+	a.handleLogger("Device Model: " + device.DeviceModelID)
+	a.handleLogger("Batch Number: " + device.BatchNumber)
 
 	// Validate input
-	emergencyDevice, err := validateDevice(device.RoomID, device.EmergencyDeviceTypeID, device.ExtinguisherTypeID, device.SerialNumber, device.ManufactureDate, device.Size, device.Description, device.Status)
+	emergencyDevice, err := validateDevice(device.RoomID, device.EmergencyDeviceTypeID, device.ExtinguisherTypeID, device.SerialNumber, device.ManufactureDate, device.Size, device.Description, device.Status, device.DeviceModelID, device.BatchNumber)
 	if err != nil {
 		a.handleLogger("Error validating device: " + err.Error())
 		// Redirect to dashboard with error message
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Error validating device: " + err.Error(),
 			"redirectURL": "/dashboard?error=" + err.Error()})
 	}
+	if err := a.validateDeviceModel(emergencyDevice); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Error validating device: " + err.Error(),
+			"redirectURL": "/dashboard?error=" + err.Error()})
+	}
 
 	// Add the device ID to the emergency device model
 	emergencyDevice.EmergencyDeviceID = deviceID
 
+	// A recalled device keeps its status until the recall is resolved
+	existingDevice, err := a.DB.GetDeviceByID(deviceID)
+	if err != nil {
+		a.handleLogger("Error fetching device: " + err.Error())
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Device not found",
+			"redirectURL": "/dashboard?error=Device not found"})
+	}
+	if existingDevice.Status.String == "Recalled" {
+		emergencyDevice.Status = existingDevice.Status
+	}
+
 	// Update the device in the database
 	err = a.DB.UpdateEmergencyDevice(emergencyDevice)
 	if err != nil {
@@ -159,11 +188,14 @@ func (a *App) HandlePutDevice(c echo.Context) error {
 			"redirectURL": "/dashboard?error=" + err.Error()})
 	}
 
+	// The model, batch or serial number may now fall under an open recall
+	a.flagRecalledDevices()
+
 	// Redirect to dashboard with success message
 	return c.JSON(http.StatusOK, map[string]string{"message": "Device updated successfully", "redirectURL": "/dashboard?message=Device updated successfully"})
 }
 
-func validateDevice(roomIDStr, emergencyDeviceTypeIDStr, extinguisherTypeIDStr, serialNumber, manufactureDateStr, size, description, status string) (*models.EmergencyDevice, error) {
+func validateDevice(roomIDStr, emergencyDeviceTypeIDStr, extinguisherTypeIDStr, serialNumber, manufactureDateStr, size, description, status, deviceModelIDStr, batchNumber string) (*models.EmergencyDevice, error) {
 	const (
 		ErrDeviceTypeRequired        string = "device type is required"
 		ErrRoomRequired              string = "room is required"
@@ -179,6 +211,8 @@ func validateDevice(roomIDStr, emergencyDeviceTypeIDStr, extinguisherTypeIDStr,
 		ErrDescriptionTooLong        string = "description is too long, maximum 255 characters"
 		ErrSizeTooLong               string = "size is too long, maximum 50 characters"
 		ErrStatusTooLong             string = "status is too long, maximum 50 characters"
+		ErrInvalidDeviceModelID      string = "invalid device model ID"
+		ErrBatchNumberTooLong        string = "batch number is too long, maximum 50 characters"
 	)
 
 	var device models.EmergencyDevice
@@ -212,6 +246,15 @@ func validateDevice(roomIDStr, emergencyDeviceTypeIDStr, extinguisherTypeIDStr,
 		extinguisherTypeID.Valid = false
 	}
 
+	var deviceModelID sql.NullInt64
+	if deviceModelIDStr != "" {
+		deviceModelID.Int64, err = strconv.ParseInt(deviceModelIDStr, 10, 32)
+		if err != nil {
+			return &device, errors.New(ErrInvalidDeviceModelID)
+		}
+		deviceModelID.Valid = true
+	}
+
 	manufactureDate, err := parseDate(manufactureDateStr)
 	if err != nil {
 		return &device, errors.New(ErrInvalidManufactureDate)
@@ -237,6 +280,10 @@ func validateDevice(roomIDStr, emergencyDeviceTypeIDStr, extinguisherTypeIDStr,
 		return &device, errors.New(ErrStatusTooLong)
 	}
 
+	if len(batchNumber) > 50 {
+		return &device, errors.New(ErrBatchNumberTooLong)
+	}
+
 	// Set the values of the device model
 	// Initialize sql.NullString for optional fields
 	device.SerialNumber = sql.NullString{String: serialNumber, Valid: serialNumber != ""}
@@ -247,10 +294,24 @@ func validateDevice(roomIDStr, emergencyDeviceTypeIDStr, extinguisherTypeIDStr,
 	device.EmergencyDeviceTypeID = emergencyDeviceTypeID
 	device.ExtinguisherTypeID = extinguisherTypeID
 	device.ManufactureDate = manufactureDate
+	device.DeviceModelID = deviceModelID
+	device.BatchNumber = sql.NullString{String: batchNumber, Valid: batchNumber != ""}
 
 	return &device, nil
 }
 
+// validateDeviceModel checks the device's model is in the catalog, as recalls are matched
+// against it
+func (a *App) validateDeviceModel(device *models.EmergencyDevice) error {
+	if !device.DeviceModelID.Valid {
+		return nil
+	}
+	if _, err := a.DB.GetDeviceModelByID(int(device.DeviceModelID.Int64)); err != nil {
+		return errors.New("device model does not exist")
+	}
+	return nil
+}
+
 func parseDate(dateStr string) (sql.NullTime, error) {
 	if dateStr == "" {
 		return sql.NullTime{}, nil
@@ -282,6 +343,15 @@ func (a *App) HandleDeleteDevice(c echo.Context) error {
 		})
 	}
 
+	// Collect the device's attachments first, their rows go with the device (ON DELETE CASCADE)
+	attachments, err := a.DB.GetAttachmentsForDeviceTree(deviceID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error":       "Error deleting device",
+			"redirectURL": "/dashboard?error=Error deleting device: " + err.Error(),
+		})
+	}
+
 	// Delete the device from the database
 	err = a.DB.DeleteEmergencyDevice(deviceID)
 	if err != nil {
@@ -291,6 +361,8 @@ func (a *App) HandleDeleteDevice(c echo.Context) error {
 		})
 	}
 
+	a.removeAttachmentFiles(attachments)
+
 	return c.JSON(http.StatusOK, map[string]string{
 		"message":     "Device deleted successfully",
 		"redirectURL": "/dashboard?message=Device deleted successfully",
@@ -346,6 +418,13 @@ func (a *App) HandlePutDeviceStatus(c echo.Context) error {
 			"redirectURL": "/dashboard?error=Device not found"})
 	}
 
+	// Recalled devices keep their status until the recall is resolved
+	if device.Status.String == "Recalled" {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error":       "Device is under recall",
+			"redirectURL": "/dashboard?error=Device is under recall"})
+	}
+
 	// Validate status
 	if req.Status == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{
@@ -375,3 +454,16 @@ func (a *App) HandlePutDeviceStatus(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{
 		"message": "Device status updated successfully"})
 }
+
+// flagRecalledDevices applies every open recall after a device change. A failure is
+// logged rather than returned because the device itself was saved successfully.
+func (a *App) flagRecalledDevices() {
+	flaggedDeviceIDs, err := a.DB.FlagRecalledDevices(0)
+	if err != nil {
+		a.Logger.Printf("\033[31mError: flagging recalled devices: %v\033[0m", err)
+		return
+	}
+	if len(flaggedDeviceIDs) > 0 {
+		a.handleLogger(fmt.Sprintf("Recalled devices flagged: %v", flaggedDeviceIDs))
+	}
+}
@@ -0,0 +1,266 @@
+package app
+
+import (
+	"database/sql"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/labstack/echo/v4"
+)
+
+// Largest pin coordinate accepted, in pixels of the floor plan image
+const maxPinCoordinate = 100000
+
+// Colours pins are drawn in for each device status, matching the status badges on the
+// dashboard. Other statuses, such as Inspection Due, use defaultPinColour.
+var pinStatusColours = map[string]string{
+	"Active":            "#198754",
+	"Expired":           "#ffc107",
+	"Inspection Failed": "#dc3545",
+	"Recalled":          "#dc3545",
+	"Inactive":          "#6c757d",
+}
+
+const defaultPinColour = "#ffc107"
+
+// floorPlanPins fills in the colour of each pin and splits the placed pins from the
+// devices still to be placed
+func floorPlanPins(plan *models.FloorPlanPins, pins []models.DevicePin) {
+	plan.Pins = []models.DevicePin{}
+	plan.Unplaced = []models.DevicePin{}
+	for _, pin := range pins {
+		pin.StatusColour = defaultPinColour
+		if colour, ok := pinStatusColours[pin.Status.String]; ok {
+			pin.StatusColour = colour
+		}
+		if pin.PinX.Valid && pin.PinY.Valid {
+			plan.Pins = append(plan.Pins, pin)
+		} else {
+			plan.Unplaced = append(plan.Unplaced, pin)
+		}
+	}
+}
+
+// HandleGetFloorPins returns a floor's plan with the devices pinned on it and those on
+// the floor still to be placed
+func (a *App) HandleGetFloorPins(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	floorID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid floor ID", err)
+	}
+
+	floor, err := a.DB.GetFloorByID(floorID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return a.handleError(c, http.StatusNotFound, "Floor not found", err)
+		}
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	pins, err := a.DB.GetFloorDevicePins(floorID)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	plan := models.FloorPlanPins{
+		BuildingID:         floor.BuildingID,
+		BuildingCode:       floor.BuildingCode,
+		FloorID:            sql.NullInt64{Int64: int64(floor.FloorID), Valid: true},
+		FloorName:          floor.FloorName,
+		FloorPlanImagePath: floor.FloorPlanImagePath,
+	}
+	floorPlanPins(&plan, pins)
+
+	return c.JSON(http.StatusOK, plan)
+}
+
+// HandleGetBuildingPins returns a building's plan with the devices pinned on it, which
+// are those on the building's floors without a plan of their own
+func (a *App) HandleGetBuildingPins(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	buildingID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid building ID", err)
+	}
+
+	building, err := a.DB.GetBuildingById(buildingID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return a.handleError(c, http.StatusNotFound, "Building not found", err)
+		}
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	pins, err := a.DB.GetBuildingDevicePins(buildingID)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	plan := models.FloorPlanPins{
+		BuildingID:         building.BuildingID,
+		BuildingCode:       building.BuildingCode,
+		FloorPlanImagePath: building.FloorPlanImagePath,
+	}
+	floorPlanPins(&plan, pins)
+
+	return c.JSON(http.StatusOK, plan)
+}
+
+// HandlePutDevicePin places a device on its floor plan at pin_x, pin_y, in pixels of the
+// plan image from its top left corner, or removes it from the plan when both are null
+func (a *App) HandlePutDevicePin(c echo.Context) error {
+	// Check if request is a PUT request
+	if c.Request().Method != http.MethodPut {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{
+			"error": "Method not allowed",
+		})
+	}
+
+	deviceID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid device ID",
+		})
+	}
+
+	var req struct {
+		PinX *float64 `json:"pin_x"`
+		PinY *float64 `json:"pin_y"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	device, err := a.DB.GetDeviceByID(deviceID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "Device not found",
+		})
+	}
+
+	var pinX, pinY sql.NullFloat64
+	if req.PinX != nil || req.PinY != nil {
+		if req.PinX == nil || req.PinY == nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Both pin_x and pin_y are required to place a device",
+			})
+		}
+		for _, v := range []float64{*req.PinX, *req.PinY} {
+			if math.IsNaN(v) || v < 0 || v > maxPinCoordinate {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": "Pin must be on the floor plan",
+				})
+			}
+		}
+
+		// The device is pinned on its floor's plan, or its building's plan
+		hasPlan, err := a.deviceHasFloorPlan(device)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "Error fetching floor plan",
+			})
+		}
+		if !hasPlan {
+			return c.JSON(http.StatusConflict, map[string]string{
+				"error": "Upload a floor plan for the device's floor or building first",
+			})
+		}
+
+		pinX = sql.NullFloat64{Float64: *req.PinX, Valid: true}
+		pinY = sql.NullFloat64{Float64: *req.PinY, Valid: true}
+	}
+
+	if err := a.DB.UpdateDevicePin(deviceID, pinX, pinY); err != nil {
+		if err == sql.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": "Device not found",
+			})
+		}
+		a.handleLogger("Error saving device pin: " + err.Error())
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error saving device pin",
+		})
+	}
+
+	if !pinX.Valid {
+		return c.JSON(http.StatusOK, map[string]string{
+			"message": "Device removed from the floor plan",
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "Device pin saved",
+	})
+}
+
+// deviceHasFloorPlan reports whether the device's floor or building has a floor plan
+func (a *App) deviceHasFloorPlan(device *models.EmergencyDevice) (bool, error) {
+	floor, err := a.DB.GetFloorByID(device.FloorID)
+	if err != nil {
+		return false, err
+	}
+	if floor.FloorPlanImagePath.Valid {
+		return true, nil
+	}
+
+	building, err := a.DB.GetBuildingById(device.BuildingID)
+	if err != nil {
+		return false, err
+	}
+	return building.FloorPlanImagePath.Valid, nil
+}
+
+// HandlePostBuildingFloorPlan uploads a building's floor plan, used for the building's
+// floors without a plan of their own, or removes it when removeFloorPlan is set
+func (a *App) HandlePostBuildingFloorPlan(c echo.Context) error {
+	// Check if request is a POST request
+	if c.Request().Method != http.MethodPost {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Method not allowed")
+	}
+
+	// Parse the form, which carries the plan image
+	if err := c.Request().ParseMultipartForm(maxSiteMapSize); err != nil {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Error parsing form")
+	}
+
+	buildingID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Invalid building ID")
+	}
+
+	building, err := a.DB.GetBuildingById(buildingID)
+	if err != nil {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Building does not exist")
+	}
+
+	floorPlan, err := a.saveFloorPlan(c)
+	if err != nil {
+		return c.Redirect(http.StatusSeeOther, "/admin?error="+err.Error())
+	}
+	if !floorPlan.Valid && c.FormValue("removeFloorPlan") == "" {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Please choose a floor plan to upload")
+	}
+
+	if err := a.DB.UpdateBuildingFloorPlan(buildingID, floorPlan); err != nil {
+		a.deleteFloorPlan(c.Request().Context(), floorPlan)
+		return a.handleError(c, http.StatusInternalServerError, "Error saving floor plan", err)
+	}
+	a.deleteFloorPlan(c.Request().Context(), building.FloorPlanImagePath)
+
+	if !floorPlan.Valid {
+		return c.Redirect(http.StatusFound, "/admin?message=Floor plan removed successfully")
+	}
+	return c.Redirect(http.StatusFound, "/admin?message=Floor plan updated successfully")
+}
@@ -0,0 +1,489 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/labstack/echo/v4"
+	gomail "gopkg.in/mail.v2"
+)
+
+// Digests are not sent before this hour of the day, in the app's time zone
+const digestSendHour = 7
+
+// SendDigests emails every subscriber whose digest is due. Digests with nothing in them
+// are not sent but still count as sent, so the next one waits for the next period.
+func (a *App) SendDigests(ctx context.Context) error {
+	subscriptions, err := a.DB.GetAllDigestSubscriptions()
+	if err != nil {
+		return err
+	}
+
+	now := a.localNow()
+	sent := 0
+	var errs []error
+	for _, subscription := range subscriptions {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !digestDue(subscription, now) {
+			continue
+		}
+
+		digest, err := a.buildDigest(subscription, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("digest for user %d: %w", subscription.UserID, err))
+			continue
+		}
+		if len(digest.Sections) > 0 {
+			if err := a.sendDigest(digest, now); err != nil {
+				errs = append(errs, fmt.Errorf("digest for user %d: %w", subscription.UserID, err))
+				continue
+			}
+			sent++
+		}
+
+		if err := a.DB.MarkDigestSent(subscription.UserID, now); err != nil {
+			errs = append(errs, fmt.Errorf("digest for user %d: %w", subscription.UserID, err))
+		}
+	}
+
+	if sent > 0 {
+		a.handleLogger(fmt.Sprintf("Digests sent: %d", sent))
+	}
+	return errors.Join(errs...)
+}
+
+// digestDue reports whether a subscriber has not had their digest for the current day,
+// or for weekly digests the current week starting on Monday
+func digestDue(subscription models.DigestSubscription, now time.Time) bool {
+	if now.Hour() < digestSendHour {
+		return false
+	}
+	if !subscription.LastSentAt.Valid {
+		return true
+	}
+
+	periodStart := civilDate(now)
+	if subscription.Frequency == models.DigestFrequencyWeekly {
+		daysSinceMonday := (int(now.Weekday()) + 6) % 7
+		periodStart = periodStart.AddDate(0, 0, -daysSinceMonday)
+	}
+
+	return civilDate(subscription.LastSentAt.Time.In(now.Location())).Before(periodStart)
+}
+
+// buildDigest lists the devices needing attention within the subscriber's filters, using
+// the same due and expiry dates as the device list and notifications
+func (a *App) buildDigest(subscription models.DigestSubscription, now time.Time) (models.Digest, error) {
+	siteID := ""
+	if subscription.SiteID.Valid {
+		siteID = strconv.FormatInt(subscription.SiteID.Int64, 10)
+	}
+	buildingCode := ""
+	if subscription.BuildingID.Valid {
+		buildingCode = subscription.BuildingCode.String
+	}
+
+	devices, err := a.DB.GetAllDevices(siteID, buildingCode)
+	if err != nil {
+		return models.Digest{}, err
+	}
+	devicesByID := make(map[int]models.EmergencyDevice, len(devices))
+	for _, device := range devices {
+		devicesByID[device.EmergencyDeviceID] = device
+	}
+
+	sections := map[string]*models.DigestSection{}
+	for _, notification := range deviceNotifications(devices, now) {
+		device := devicesByID[notification.EmergencyDeviceID]
+		section, ok := sections[notification.NotificationType]
+		if !ok {
+			section = &models.DigestSection{NotificationType: notification.NotificationType}
+			sections[notification.NotificationType] = section
+		}
+		section.Items = append(section.Items, models.DigestItem{
+			EmergencyDeviceID:       device.EmergencyDeviceID,
+			EmergencyDeviceTypeName: device.EmergencyDeviceTypeName,
+			SerialNumber:            device.SerialNumber.String,
+			BuildingCode:            device.BuildingCode,
+			RoomCode:                device.RoomCode,
+			ReferenceDate:           notification.ReferenceDate,
+		})
+	}
+
+	digest := models.Digest{Subscription: subscription}
+	for _, section := range sections {
+		sort.Slice(section.Items, func(i, j int) bool {
+			x, y := section.Items[i], section.Items[j]
+			if x.BuildingCode != y.BuildingCode {
+				return x.BuildingCode < y.BuildingCode
+			}
+			if x.RoomCode != y.RoomCode {
+				return x.RoomCode < y.RoomCode
+			}
+			return x.EmergencyDeviceID < y.EmergencyDeviceID
+		})
+		digest.Sections = append(digest.Sections, *section)
+	}
+	sort.Slice(digest.Sections, func(i, j int) bool {
+		return models.NotificationTypePriority[digest.Sections[i].NotificationType] <
+			models.NotificationTypePriority[digest.Sections[j].NotificationType]
+	})
+
+	return digest, nil
+}
+
+// digestView is the data the digest templates are rendered with
+type digestView struct {
+	Username       string
+	Scope          string
+	Date           string
+	Total          int
+	Sections       []digestViewSection
+	DashboardURL   string
+	UnsubscribeURL string
+}
+
+type digestViewSection struct {
+	Title string
+	Items []digestViewItem
+}
+
+type digestViewItem struct {
+	Device   string
+	Location string
+	Date     string
+}
+
+// digestDateLabels describe the reference date of each kind of notification
+var digestDateLabels = map[string]string{
+	models.NotificationTypeExpired:           "Expired",
+	models.NotificationTypeInspectionOverdue: "Due",
+	models.NotificationTypeExpiringSoon:      "Expires",
+	models.NotificationTypeInspectionDue:     "Due",
+}
+
+func (a *App) newDigestView(digest models.Digest, now time.Time) digestView {
+	subscription := digest.Subscription
+
+	scope := "All sites"
+	if subscription.SiteName.Valid {
+		scope = subscription.SiteName.String
+		if subscription.BuildingCode.Valid {
+			scope += ", building " + subscription.BuildingCode.String
+		}
+	}
+
+	view := digestView{
+		Username:       subscription.Username,
+		Scope:          scope,
+		Date:           now.Format("Monday 2 January 2006"),
+		DashboardURL:   a.BaseURL + "/dashboard",
+		UnsubscribeURL: a.digestUnsubscribeURL(subscription.UserID),
+	}
+	for _, section := range digest.Sections {
+		viewSection := digestViewSection{Title: section.NotificationType}
+		for _, item := range section.Items {
+			device := item.EmergencyDeviceTypeName
+			if item.SerialNumber != "" {
+				device += " (" + item.SerialNumber + ")"
+			}
+			date := ""
+			if label, ok := digestDateLabels[section.NotificationType]; ok && item.ReferenceDate.Valid {
+				date = label + " " + item.ReferenceDate.Time.Format("02/01/2006")
+			}
+			viewSection.Items = append(viewSection.Items, digestViewItem{
+				Device:   device,
+				Location: "Building " + item.BuildingCode + ", room " + item.RoomCode,
+				Date:     date,
+			})
+		}
+		view.Total += len(section.Items)
+		view.Sections = append(view.Sections, viewSection)
+	}
+
+	return view
+}
+
+var digestHTMLTemplate = htmltemplate.Must(htmltemplate.New("digest").Parse(`<html><body style="font-family: Arial, sans-serif; padding: 20px; color: #333;">
+	<h2>EDMS DEVICE DIGEST</h2>
+	<p>Hi {{.Username}}, here are the devices needing attention at <strong>{{.Scope}}</strong> as of {{.Date}}.</p>
+	{{range .Sections}}
+	<h3 style="margin-top: 24px;">{{.Title}} ({{len .Items}})</h3>
+	<table style="border-collapse: collapse; width: 100%;">
+		<tr style="background: #f2f2f2; text-align: left;">
+			<th style="padding: 6px; border: 1px solid #ddd;">Device</th>
+			<th style="padding: 6px; border: 1px solid #ddd;">Location</th>
+			<th style="padding: 6px; border: 1px solid #ddd;">Date</th>
+		</tr>
+		{{range .Items}}
+		<tr>
+			<td style="padding: 6px; border: 1px solid #ddd;">{{.Device}}</td>
+			<td style="padding: 6px; border: 1px solid #ddd;">{{.Location}}</td>
+			<td style="padding: 6px; border: 1px solid #ddd;">{{.Date}}</td>
+		</tr>
+		{{end}}
+	</table>
+	{{else}}
+	<p>Nothing needs attention.</p>
+	{{end}}
+	<p style="margin-top: 24px;"><a href="{{.DashboardURL}}">Open the dashboard</a></p>
+	<p style="font-size: 12px; color: #777;">You receive this digest because you subscribed to it in EDMS.
+		<a href="{{.UnsubscribeURL}}">Unsubscribe</a></p>
+</body></html>`))
+
+var digestTextTemplate = texttemplate.Must(texttemplate.New("digest").Parse(`EDMS DEVICE DIGEST
+
+Hi {{.Username}}, here are the devices needing attention at {{.Scope}} as of {{.Date}}.
+{{range .Sections}}
+{{.Title}} ({{len .Items}})
+{{range .Items}}- {{.Device}}, {{.Location}}{{if .Date}}, {{.Date}}{{end}}
+{{end}}{{else}}
+Nothing needs attention.
+{{end}}
+Open the dashboard: {{.DashboardURL}}
+
+To stop receiving this digest, unsubscribe: {{.UnsubscribeURL}}
+`))
+
+// renderDigest returns the plain text and HTML versions of a digest
+func (a *App) renderDigest(digest models.Digest, now time.Time) (string, string, error) {
+	view := a.newDigestView(digest, now)
+
+	var text, html bytes.Buffer
+	if err := digestTextTemplate.Execute(&text, view); err != nil {
+		return "", "", err
+	}
+	if err := digestHTMLTemplate.Execute(&html, view); err != nil {
+		return "", "", err
+	}
+	return text.String(), html.String(), nil
+}
+
+func (a *App) sendDigest(digest models.Digest, now time.Time) error {
+	text, html, err := a.renderDigest(digest, now)
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	for _, section := range digest.Sections {
+		total += len(section.Items)
+	}
+
+	m := gomail.NewMessage()
+	m.SetHeader("To", digest.Subscription.Email)
+	m.SetHeader("Subject", fmt.Sprintf("EDMS digest: %d devices need attention", total))
+	// Lets mail clients offer a one-click unsubscribe button
+	m.SetHeader("List-Unsubscribe", "<"+a.digestUnsubscribeURL(digest.Subscription.UserID)+">")
+	m.SetHeader("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+	m.SetBody("text/plain", text)
+	m.AddAlternative("text/html", html)
+
+	return a.sendEmail(m)
+}
+
+// digestUnsubscribeToken signs a user ID so an unsubscribe link works without logging in
+func (a *App) digestUnsubscribeToken(userID int) string {
+	mac := hmac.New(sha256.New, a.SigningKey)
+	mac.Write([]byte("digest-unsubscribe:" + strconv.Itoa(userID)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (a *App) digestUnsubscribeURL(userID int) string {
+	query := url.Values{}
+	query.Set("user", strconv.Itoa(userID))
+	query.Set("token", a.digestUnsubscribeToken(userID))
+	return a.BaseURL + "/digest/unsubscribe?" + query.Encode()
+}
+
+// HandleGetDigestSubscription returns the logged in user's digest settings, with an
+// empty frequency when they are not subscribed
+func (a *App) HandleGetDigestSubscription(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	userID, _, err := currentUser(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	subscription, err := a.DB.GetDigestSubscription(userID)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusOK, models.DigestSubscription{UserID: userID})
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	return c.JSON(http.StatusOK, subscription)
+}
+
+// HandlePutDigestSubscription subscribes the logged in user to a digest, changes its
+// settings, or unsubscribes them when the frequency is empty
+func (a *App) HandlePutDigestSubscription(c echo.Context) error {
+	// Check if request is a PUT request
+	if c.Request().Method != http.MethodPut {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+
+	userID, _, err := currentUser(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	var dto models.DigestSubscriptionDto
+	if err := c.Bind(&dto); err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid request", err)
+	}
+
+	if dto.Frequency == "" {
+		if err := a.DB.DeleteDigestSubscription(userID); err != nil {
+			return a.handleError(c, http.StatusInternalServerError, "Error updating digest", err)
+		}
+		return c.JSON(http.StatusOK, map[string]string{"message": "Unsubscribed from the digest"})
+	}
+
+	subscription, err := a.parseDigestSubscription(userID, dto)
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, err.Error(), err)
+	}
+
+	if err := a.DB.SaveDigestSubscription(subscription); err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error updating digest", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Digest settings saved successfully"})
+}
+
+// parseDigestSubscription checks the digest settings, a building filter also limits the
+// digest to the building's site
+func (a *App) parseDigestSubscription(userID int, dto models.DigestSubscriptionDto) (models.DigestSubscription, error) {
+	subscription := models.DigestSubscription{UserID: userID, Frequency: dto.Frequency}
+	if dto.Frequency != models.DigestFrequencyDaily && dto.Frequency != models.DigestFrequencyWeekly {
+		return subscription, errors.New("frequency must be Daily or Weekly")
+	}
+
+	if siteIDStr := strings.TrimSpace(dto.SiteID); siteIDStr != "" {
+		site, err := a.DB.GetSiteByID(siteIDStr)
+		if err != nil {
+			return subscription, errors.New("site not found")
+		}
+		subscription.SiteID = sql.NullInt64{Int64: int64(site.SiteID), Valid: true}
+	}
+
+	if buildingIDStr := strings.TrimSpace(dto.BuildingID); buildingIDStr != "" {
+		buildingID, err := strconv.Atoi(buildingIDStr)
+		if err != nil {
+			return subscription, errors.New("invalid building ID")
+		}
+		building, err := a.DB.GetBuildingById(buildingID)
+		if err != nil {
+			return subscription, errors.New("building not found")
+		}
+		if subscription.SiteID.Valid && subscription.SiteID.Int64 != int64(building.SiteID) {
+			return subscription, errors.New("building is not at the selected site")
+		}
+		subscription.SiteID = sql.NullInt64{Int64: int64(building.SiteID), Valid: true}
+		subscription.BuildingID = sql.NullInt64{Int64: int64(building.BuildingID), Valid: true}
+	}
+
+	return subscription, nil
+}
+
+// HandleGetDigestPreview shows the logged in user's digest as it would be sent now
+func (a *App) HandleGetDigestPreview(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	userID, _, err := currentUser(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	subscription, err := a.DB.GetDigestSubscription(userID)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "You are not subscribed to the digest"})
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	now := a.localNow()
+	digest, err := a.buildDigest(subscription, now)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error building digest", err)
+	}
+
+	text, html, err := a.renderDigest(digest, now)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error building digest", err)
+	}
+	if c.QueryParam("format") == "text" {
+		return c.String(http.StatusOK, text)
+	}
+	return c.HTML(http.StatusOK, html)
+}
+
+// HandleDigestUnsubscribe handles the signed unsubscribe link of a digest email. GET only
+// asks the user to confirm, as mail scanners and link previews open links without the
+// user. POST unsubscribes, from the confirmation page or mail clients' one-click
+// unsubscribe button, which posts to the link itself.
+func (a *App) HandleDigestUnsubscribe(c echo.Context) error {
+	// Check if request is a GET or POST request
+	if c.Request().Method != http.MethodGet && c.Request().Method != http.MethodPost {
+		return c.Redirect(http.StatusSeeOther, "/?error=Method not allowed")
+	}
+
+	// The link carries the user and token in the query, the confirmation page in the form
+	userID, err := strconv.Atoi(c.FormValue("user"))
+	token := c.FormValue("token")
+	if err != nil || !hmac.Equal([]byte(token), []byte(a.digestUnsubscribeToken(userID))) {
+		return c.Redirect(http.StatusSeeOther, "/?error=Invalid unsubscribe link")
+	}
+
+	if c.Request().Method == http.MethodGet {
+		subscription, err := a.DB.GetDigestSubscription(userID)
+		if err == sql.ErrNoRows {
+			return c.Redirect(http.StatusSeeOther, "/?message=You are not subscribed to the email digest")
+		} else if err != nil {
+			a.handleLogger("Error fetching digest subscription: " + err.Error())
+			return c.Redirect(http.StatusSeeOther, "/?error=Could not unsubscribe, please try again later")
+		}
+
+		return c.Render(http.StatusOK, "digest_unsubscribe.html", map[string]interface{}{
+			"user":  userID,
+			"token": token,
+			"email": subscription.Email,
+		})
+	}
+
+	if err := a.DB.DeleteDigestSubscription(userID); err != nil {
+		a.handleLogger("Error unsubscribing from digest: " + err.Error())
+		return c.Redirect(http.StatusSeeOther, "/?error=Could not unsubscribe, please try again later")
+	}
+
+	// One-click unsubscribes only need to know it worked
+	if c.FormValue("confirm") != "true" {
+		return c.NoContent(http.StatusOK)
+	}
+	return c.Redirect(http.StatusSeeOther, "/?message=You have been unsubscribed from the email digest")
+}
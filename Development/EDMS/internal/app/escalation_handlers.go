@@ -0,0 +1,511 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/labstack/echo/v4"
+	gomail "gopkg.in/mail.v2"
+)
+
+// EscalateDevices takes the escalation steps that have become due for overdue, failed,
+// expired and recalled devices. A step is recorded once it has been sent to a recipient,
+// so one that could not be sent at all is tried again on the next run. Recipients it
+// could not be sent to are kept with the step and tried again on each run.
+func (a *App) EscalateDevices(ctx context.Context) error {
+	notifications, err := a.DB.GetEscalationCandidates()
+	if err != nil {
+		return err
+	}
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	policies, err := a.DB.GetAllEscalationPolicies()
+	if err != nil {
+		return err
+	}
+	openEscalations, err := a.DB.GetOpenEscalations()
+	if err != nil {
+		return err
+	}
+	taken := make(map[int][]models.DeviceEscalation)
+	for _, escalation := range openEscalations {
+		taken[escalation.NotificationID] = append(taken[escalation.NotificationID], escalation)
+	}
+
+	now := time.Now()
+	recipients := make(map[string][]string)
+	escalated := 0
+	var errs []error
+	for _, notification := range notifications {
+		policy := selectEscalationPolicy(policies, notification.SiteID, notification.EmergencyDeviceTypeID)
+		if policy == nil {
+			continue
+		}
+
+		days := daysInCondition(notification, now.In(a.siteLocation(notification.SiteTimeZone)))
+
+		for _, escalation := range taken[notification.NotificationID] {
+			if escalation.PendingTo == "" {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			step := models.EscalationStep{DaysAfter: escalation.DaysAfter, Recipient: escalation.Recipient}
+			sentTo, pendingTo, err := a.sendEscalation(strings.Split(escalation.PendingTo, ", "), notification, step, days)
+			errs = append(errs, err)
+			if len(sentTo) == 0 {
+				continue
+			}
+			if escalation.SentTo != "" {
+				sentTo = append(strings.Split(escalation.SentTo, ", "), sentTo...)
+			}
+			if err := a.DB.UpdateDeviceEscalationRecipients(escalation.DeviceEscalationID, strings.Join(sentTo, ", "), strings.Join(pendingTo, ", ")); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		for _, step := range dueEscalationSteps(*policy, notification.NotificationType, days, taken[notification.NotificationID]) {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			key := fmt.Sprintf("%d:%s", notification.SiteID, step.Recipient)
+			emails, ok := recipients[key]
+			if !ok {
+				emails, err = a.DB.GetEscalationRecipients(notification.SiteID, step.Recipient)
+				if err != nil {
+					return err
+				}
+				recipients[key] = emails
+			}
+
+			sentTo, pendingTo, err := a.sendEscalation(emails, notification, step, days)
+			errs = append(errs, err)
+			if len(emails) > 0 && len(sentTo) == 0 {
+				continue
+			}
+
+			err = a.DB.AddDeviceEscalation(models.DeviceEscalation{
+				EmergencyDeviceID: notification.EmergencyDeviceID,
+				NotificationID:    notification.NotificationID,
+				EscalationStepID:  sql.NullInt64{Int64: int64(step.EscalationStepID), Valid: true},
+				NotificationType:  notification.NotificationType,
+				DaysAfter:         step.DaysAfter,
+				Recipient:         step.Recipient,
+				SentTo:            strings.Join(sentTo, ", "),
+				PendingTo:         strings.Join(pendingTo, ", "),
+			})
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			escalated++
+		}
+	}
+
+	if escalated > 0 {
+		a.handleLogger(fmt.Sprintf("Escalation steps taken: %d", escalated))
+	}
+	return errors.Join(errs...)
+}
+
+// sendEscalation emails a step to each address, returning the addresses it was sent to
+// and those it could not be sent to
+func (a *App) sendEscalation(emails []string, notification models.Notification, step models.EscalationStep, days int) ([]string, []string, error) {
+	sentTo, pendingTo := []string{}, []string{}
+	var errs []error
+	for _, email := range emails {
+		if err := a.sendEscalationEmail(email, notification, step, days); err != nil {
+			errs = append(errs, fmt.Errorf("escalating device %d to %s: %w", notification.EmergencyDeviceID, email, err))
+			pendingTo = append(pendingTo, email)
+			continue
+		}
+		sentTo = append(sentTo, email)
+	}
+	return sentTo, pendingTo, errors.Join(errs...)
+}
+
+// selectEscalationPolicy returns the most specific policy for a site and device type,
+// a policy for the site beats one for the device type, or nil if none applies
+func selectEscalationPolicy(policies []models.EscalationPolicy, siteID, deviceTypeID int) *models.EscalationPolicy {
+	var best *models.EscalationPolicy
+	bestScore := -1
+	for i, policy := range policies {
+		if policy.SiteID.Valid && policy.SiteID.Int64 != int64(siteID) {
+			continue
+		}
+		if policy.EmergencyDeviceTypeID.Valid && policy.EmergencyDeviceTypeID.Int64 != int64(deviceTypeID) {
+			continue
+		}
+
+		score := 0
+		if policy.SiteID.Valid {
+			score += 2
+		}
+		if policy.EmergencyDeviceTypeID.Valid {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = &policies[i], score
+		}
+	}
+	return best
+}
+
+// daysInCondition counts the days since a device became due for inspection or expired,
+// or since it failed an inspection or was recalled, now is in the time zone of the
+// device's site
+func daysInCondition(notification models.Notification, now time.Time) int {
+	since := notification.CreatedAt.Time.In(now.Location())
+	dated := notification.NotificationType == models.NotificationTypeInspectionOverdue ||
+		notification.NotificationType == models.NotificationTypeExpired
+	if dated && notification.ReferenceDate.Valid {
+		since = notification.ReferenceDate.Time
+	}
+	return int(civilDate(now).Sub(civilDate(since)).Hours() / 24)
+}
+
+// dueEscalationSteps returns the policy's steps for the condition that have been reached
+// and not yet taken
+func dueEscalationSteps(policy models.EscalationPolicy, notificationType string, days int, taken []models.DeviceEscalation) []models.EscalationStep {
+	steps := []models.EscalationStep{}
+	for _, step := range policy.Steps {
+		if step.NotificationType != notificationType || step.DaysAfter > days {
+			continue
+		}
+
+		done := false
+		for _, escalation := range taken {
+			done = done || (escalation.DaysAfter == step.DaysAfter && escalation.Recipient == step.Recipient)
+		}
+		if !done {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+func (a *App) sendEscalationEmail(email string, notification models.Notification, step models.EscalationStep, days int) error {
+	device := notification.EmergencyDeviceTypeName
+	if notification.SerialNumber.Valid && notification.SerialNumber.String != "" {
+		device += " " + notification.SerialNumber.String
+	}
+	location := fmt.Sprintf("%s, building %s, room %s", notification.SiteName, notification.BuildingCode, notification.RoomCode)
+
+	var condition string
+	switch notification.NotificationType {
+	case models.NotificationTypeInspectionFailed:
+		condition = "failed its inspection"
+		if days > 0 {
+			condition = fmt.Sprintf("failed its inspection %d days ago and has not been fixed", days)
+		}
+	case models.NotificationTypeExpired:
+		condition = "has expired"
+		if days > 0 {
+			condition = fmt.Sprintf("expired %d days ago and has not been replaced", days)
+		}
+	case models.NotificationTypeRecalled:
+		condition = "has been recalled"
+		if days > 0 {
+			condition = fmt.Sprintf("was recalled %d days ago and has not been dealt with", days)
+		}
+	default:
+		condition = "is due for inspection"
+		if days > 0 {
+			condition = fmt.Sprintf("has been overdue for inspection for %d days", days)
+		}
+	}
+
+	m := gomail.NewMessage()
+	m.SetHeader("To", email)
+	m.SetHeader("Subject", "EDMS ESCALATION: "+device+" "+notification.NotificationType)
+	m.SetBody("text/plain", fmt.Sprintf("The %s at %s %s.\n\nYou are notified as one of the %s.",
+		device, location, condition, strings.ToLower(step.Recipient)))
+	m.AddAlternative("text/html", fmt.Sprintf(`<html><body style="font-family: Arial, sans-serif; padding: 20px;">
+		<h2 style="color: #333;">EDMS ESCALATION</h2>
+		<p style="margin-top: 20px;">The <strong>%s</strong> at <strong>%s</strong> %s.</p>
+		<p style="color: #777;">You are notified as one of the %s.</p>
+	</body></html>`, html.EscapeString(device), html.EscapeString(location), condition, strings.ToLower(step.Recipient)))
+
+	return a.sendEmail(m)
+}
+
+// HandleGetEscalationPolicies returns every escalation policy with its steps
+func (a *App) HandleGetEscalationPolicies(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	policies, err := a.DB.GetAllEscalationPolicies()
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	return c.JSON(http.StatusOK, policies)
+}
+
+// HandlePostEscalationPolicy adds an escalation policy
+func (a *App) HandlePostEscalationPolicy(c echo.Context) error {
+	// Check if request is a POST request
+	if c.Request().Method != http.MethodPost {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+
+	var dto models.EscalationPolicyDto
+	if err := c.Bind(&dto); err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid request", err)
+	}
+	policy, err := a.parseEscalationPolicy(dto)
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, err.Error(), err)
+	}
+
+	policyID, err := a.DB.AddEscalationPolicy(policy)
+	if err != nil {
+		if strings.Contains(err.Error(), "idx_escalation_policy_scope") {
+			return a.handleError(c, http.StatusConflict, "A policy for this site and device type already exists", err)
+		}
+		return a.handleError(c, http.StatusInternalServerError, "Error adding escalation policy", err)
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"message":              "Escalation policy added successfully",
+		"escalation_policy_id": policyID,
+	})
+}
+
+// HandlePutEscalationPolicy replaces an escalation policy and its steps
+func (a *App) HandlePutEscalationPolicy(c echo.Context) error {
+	// Check if request is a PUT request
+	if c.Request().Method != http.MethodPut {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+
+	policyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid escalation policy ID", err)
+	}
+
+	var dto models.EscalationPolicyDto
+	if err := c.Bind(&dto); err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid request", err)
+	}
+	policy, err := a.parseEscalationPolicy(dto)
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, err.Error(), err)
+	}
+	policy.EscalationPolicyID = policyID
+
+	err = a.DB.UpdateEscalationPolicy(policy)
+	if err == sql.ErrNoRows {
+		return a.handleError(c, http.StatusNotFound, "Escalation policy not found", err)
+	} else if err != nil {
+		if strings.Contains(err.Error(), "idx_escalation_policy_scope") {
+			return a.handleError(c, http.StatusConflict, "A policy for this site and device type already exists", err)
+		}
+		return a.handleError(c, http.StatusInternalServerError, "Error updating escalation policy", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Escalation policy updated successfully"})
+}
+
+// HandleDeleteEscalationPolicy removes an escalation policy, devices it covered fall
+// back to a less specific policy
+func (a *App) HandleDeleteEscalationPolicy(c echo.Context) error {
+	// Check if request is a DELETE request
+	if c.Request().Method != http.MethodDelete {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+
+	policyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid escalation policy ID", err)
+	}
+
+	err = a.DB.DeleteEscalationPolicy(policyID)
+	if err == sql.ErrNoRows {
+		return a.handleError(c, http.StatusNotFound, "Escalation policy not found", err)
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error deleting escalation policy", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Escalation policy deleted successfully"})
+}
+
+// parseEscalationPolicy checks a policy and its steps
+func (a *App) parseEscalationPolicy(dto models.EscalationPolicyDto) (models.EscalationPolicy, error) {
+	policy := models.EscalationPolicy{PolicyName: strings.TrimSpace(dto.PolicyName)}
+	if policy.PolicyName == "" || len(policy.PolicyName) > 100 {
+		return policy, errors.New("please enter a policy name of up to 100 characters")
+	}
+
+	if siteIDStr := strings.TrimSpace(dto.SiteID); siteIDStr != "" {
+		site, err := a.DB.GetSiteByID(siteIDStr)
+		if err != nil {
+			return policy, errors.New("site not found")
+		}
+		policy.SiteID = sql.NullInt64{Int64: int64(site.SiteID), Valid: true}
+	}
+	if typeIDStr := strings.TrimSpace(dto.EmergencyDeviceTypeID); typeIDStr != "" {
+		typeID, err := strconv.Atoi(typeIDStr)
+		if err != nil {
+			return policy, errors.New("invalid device type ID")
+		}
+		if _, err := a.DB.GetEmergencyDeviceTypeByID(typeID); err != nil {
+			return policy, errors.New("device type not found")
+		}
+		policy.EmergencyDeviceTypeID = sql.NullInt64{Int64: int64(typeID), Valid: true}
+	}
+
+	if len(dto.Steps) == 0 {
+		return policy, errors.New("please add at least one escalation step")
+	}
+	seen := map[string]bool{}
+	for _, stepDto := range dto.Steps {
+		step := models.EscalationStep{
+			NotificationType: stepDto.NotificationType,
+			DaysAfter:        stepDto.DaysAfter,
+			Recipient:        stepDto.Recipient,
+		}
+		switch step.NotificationType {
+		case models.NotificationTypeInspectionOverdue, models.NotificationTypeInspectionFailed,
+			models.NotificationTypeExpired, models.NotificationTypeRecalled:
+		default:
+			return policy, errors.New("steps apply to Inspection Overdue, Inspection Failed, Expired or Recalled devices")
+		}
+		if step.DaysAfter < 0 {
+			return policy, errors.New("days after cannot be negative")
+		}
+		switch step.Recipient {
+		case models.EscalationRecipientSiteInspectors, models.EscalationRecipientSiteManagers, models.EscalationRecipientAdmins:
+		default:
+			return policy, errors.New("recipient must be Site Inspectors, Site Managers or Admins")
+		}
+
+		key := fmt.Sprintf("%s:%d:%s", step.NotificationType, step.DaysAfter, step.Recipient)
+		if seen[key] {
+			return policy, errors.New("escalation steps must not repeat")
+		}
+		seen[key] = true
+		policy.Steps = append(policy.Steps, step)
+	}
+
+	return policy, nil
+}
+
+// HandleGetSiteMembers returns the inspectors and managers of a site
+func (a *App) HandleGetSiteMembers(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	siteID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid site ID", err)
+	}
+
+	members, err := a.DB.GetSiteMembers(siteID)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	return c.JSON(http.StatusOK, members)
+}
+
+// HandlePutSiteMember makes a user an inspector or manager of a site
+func (a *App) HandlePutSiteMember(c echo.Context) error {
+	// Check if request is a PUT request
+	if c.Request().Method != http.MethodPut {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+
+	siteID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid site ID", err)
+	}
+	if _, err := a.DB.GetSiteByID(c.Param("id")); err != nil {
+		return a.handleError(c, http.StatusNotFound, "Site not found", err)
+	}
+
+	var dto models.SiteMemberDto
+	if err := c.Bind(&dto); err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid request", err)
+	}
+	userID, err := strconv.Atoi(dto.UserID)
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid user ID", err)
+	}
+	if _, err := a.DB.GetUserByID(userID); err != nil {
+		return a.handleError(c, http.StatusNotFound, "User not found", err)
+	}
+	if dto.SiteRole != models.SiteRoleInspector && dto.SiteRole != models.SiteRoleManager {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Site role must be Inspector or Manager"})
+	}
+
+	err = a.DB.SaveSiteMember(models.SiteMember{SiteID: siteID, UserID: userID, SiteRole: dto.SiteRole})
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error updating site member", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Site member saved successfully"})
+}
+
+// HandleDeleteSiteMember removes a user from a site
+func (a *App) HandleDeleteSiteMember(c echo.Context) error {
+	// Check if request is a DELETE request
+	if c.Request().Method != http.MethodDelete {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+
+	siteID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid site ID", err)
+	}
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid user ID", err)
+	}
+
+	err = a.DB.DeleteSiteMember(siteID, userID)
+	if err == sql.ErrNoRows {
+		return a.handleError(c, http.StatusNotFound, "Site member not found", err)
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error removing site member", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Site member removed successfully"})
+}
+
+// HandleGetDeviceEscalations returns the escalation steps taken for a device
+func (a *App) HandleGetDeviceEscalations(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	deviceID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid device ID", err)
+	}
+
+	escalations, err := a.DB.GetDeviceEscalations(deviceID)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	return c.JSON(http.StatusOK, escalations)
+}
@@ -0,0 +1,169 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/events"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// Events the stream sends besides the ones announced by the database
+const (
+	// The user's navbar notification count, sent on connecting and when it changes
+	eventNotificationCount = "notification.count"
+	// Sent when the user's token expires or is revoked, the client should log in again
+	eventStreamExpired = "stream.expired"
+)
+
+// Comment sent on an idle stream so proxies do not close it
+const eventStreamHeartbeat = 25 * time.Second
+
+// StartEvents starts passing database changes on to the clients streaming /api/events
+func (a *App) StartEvents() {
+	a.Events.Start()
+}
+
+// StopEvents stops listening for database changes and ends the open streams
+func (a *App) StopEvents() {
+	a.Events.Stop()
+}
+
+// HandleGetEvents streams device status changes, new inspections and the user's
+// notification count as server-sent events, until the client disconnects or the user's
+// token expires or is revoked
+func (a *App) HandleGetEvents(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	userID, _, err := currentUser(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	// The stream ends when the token does, so an expired login stops receiving. Revoked
+	// tokens are checked with each heartbeat, as logging out revokes the token.
+	expires := time.Now().Add(24 * time.Hour)
+	var tokenID string
+	if token, ok := c.Get("user").(*jwt.Token); ok {
+		if exp, err := token.Claims.GetExpirationTime(); err == nil && exp != nil {
+			expires = exp.Time
+		}
+		if claims, ok := token.Claims.(jwt.MapClaims); ok {
+			tokenID, _ = claims["jti"].(string)
+		}
+	}
+	expired := time.NewTimer(time.Until(expires))
+	defer expired.Stop()
+
+	sub := a.Events.Subscribe(userID)
+	defer a.Events.Unsubscribe(sub)
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	// Stops nginx buffering the stream
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+
+	// Clients reconnect after 5 seconds if the stream drops
+	if _, err := fmt.Fprint(res, "retry: 5000\n\n"); err != nil {
+		return nil
+	}
+	var lastCount *models.NotificationCount
+	if err := a.sendNotificationCount(res, userID, &lastCount); err != nil {
+		return nil
+	}
+	res.Flush()
+
+	heartbeat := time.NewTicker(eventStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		var err error
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-expired.C:
+			writeServerSentEvent(res, eventStreamExpired, json.RawMessage(`{}`))
+			res.Flush()
+			return nil
+		case <-heartbeat.C:
+			if a.isStreamTokenRevoked(tokenID) {
+				writeServerSentEvent(res, eventStreamExpired, json.RawMessage(`{}`))
+				res.Flush()
+				return nil
+			}
+			_, err = fmt.Fprint(res, ": heartbeat\n\n")
+		case event, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+			switch event.Type {
+			case events.TypeNotificationsChanged:
+				err = a.sendNotificationCount(res, userID, &lastCount)
+			case events.TypeResync:
+				// Changes may have been missed, so the count is sent even if unchanged
+				lastCount = nil
+				if err = writeServerSentEvent(res, event.Type, event.Data); err == nil {
+					err = a.sendNotificationCount(res, userID, &lastCount)
+				}
+			default:
+				err = writeServerSentEvent(res, event.Type, event.Data)
+			}
+		}
+		if err != nil {
+			return nil
+		}
+		res.Flush()
+	}
+}
+
+// isStreamTokenRevoked reports whether the token of an event stream has been revoked.
+// Tokens issued before revocation was added have no ID. A failed check keeps the stream
+// open, the next heartbeat checks again.
+func (a *App) isStreamTokenRevoked(tokenID string) bool {
+	if tokenID == "" {
+		return false
+	}
+	revoked, err := a.DB.IsTokenRevoked(tokenID)
+	if err != nil {
+		a.handleLogger("Error checking revoked token: " + err.Error())
+		return false
+	}
+	return revoked
+}
+
+// sendNotificationCount sends the user's notification count if it differs from the last
+// one sent
+func (a *App) sendNotificationCount(w io.Writer, userID int, last **models.NotificationCount) error {
+	count, err := a.DB.GetNotificationCount(userID)
+	if err != nil {
+		a.handleLogger("Error counting notifications: " + err.Error())
+		return nil
+	}
+	if *last != nil && **last == *count {
+		return nil
+	}
+	*last = count
+
+	data, err := json.Marshal(count)
+	if err != nil {
+		return err
+	}
+	return writeServerSentEvent(w, eventNotificationCount, data)
+}
+
+// writeServerSentEvent writes one event in the text/event-stream format
+func writeServerSentEvent(w io.Writer, event string, data json.RawMessage) error {
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
@@ -0,0 +1,330 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/storage"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Floor plans are stored under floorPlanKeyPrefix with a random name and served from
+	// floorPlanURLPrefix, FloorT.FloorPlanImagePath holds the URL
+	floorPlanKeyPrefix = "floor_plans/"
+	floorPlanURLPrefix = "/api/floor-plan/"
+)
+
+var (
+	floorPlanNameRegex = regexp.MustCompile(`^[0-9a-f]{32}\.(jpg|jpeg|png|gif|svg)$`)
+
+	errInvalidFloorPlan = errors.New("Invalid floor plan, upload a jpg, jpeg, png, gif or svg of up to 10 MB")
+	errSavingFloorPlan  = errors.New("Error saving floor plan")
+)
+
+// floorPlanKey returns the store key of a floor plan path, ok is false when the floor
+// has no plan
+func floorPlanKey(floorPlanImagePath sql.NullString) (string, bool) {
+	if !floorPlanImagePath.Valid || !strings.HasPrefix(floorPlanImagePath.String, floorPlanURLPrefix) {
+		return "", false
+	}
+	return floorPlanKeyPrefix + strings.TrimPrefix(floorPlanImagePath.String, floorPlanURLPrefix), true
+}
+
+// saveFloorPlan writes the floor plan uploaded with the form, if there is one, to the
+// file store and returns the path to save against the floor. The error is the message
+// to show the user.
+func (a *App) saveFloorPlan(c echo.Context) (sql.NullString, error) {
+	file, header, err := c.Request().FormFile("floorPlanImgInput")
+	if err == http.ErrMissingFile {
+		return sql.NullString{}, nil
+	} else if err != nil {
+		return sql.NullString{}, errInvalidFloorPlan
+	}
+	defer file.Close()
+
+	fileExt := strings.ToLower(filepath.Ext(header.Filename))
+	if !siteMapExtensions[fileExt] {
+		return sql.NullString{}, errInvalidFloorPlan
+	}
+
+	data, err := utils.ReadLimited(file, maxSiteMapSize)
+	if err != nil {
+		return sql.NullString{}, errInvalidFloorPlan
+	}
+
+	name, err := newStorageKey()
+	if err != nil {
+		a.handleLogger("Error saving floor plan: " + err.Error())
+		return sql.NullString{}, errSavingFloorPlan
+	}
+	name += fileExt
+	if err := a.Store.Put(c.Request().Context(), floorPlanKeyPrefix+name, bytes.NewReader(data), mime.TypeByExtension(fileExt)); err != nil {
+		a.handleLogger("Error saving floor plan: " + err.Error())
+		return sql.NullString{}, errSavingFloorPlan
+	}
+
+	return sql.NullString{String: floorPlanURLPrefix + name, Valid: true}, nil
+}
+
+// deleteFloorPlan removes a floor plan that is no longer used from the file store
+func (a *App) deleteFloorPlan(ctx context.Context, floorPlanImagePath sql.NullString) {
+	if key, ok := floorPlanKey(floorPlanImagePath); ok {
+		if err := a.Store.Delete(ctx, key); err != nil && err != storage.ErrNotFound {
+			a.handleLogger("Error deleting floor plan " + key + ": " + err.Error())
+		}
+	}
+}
+
+// parseFloorForm reads the floor name and order from a floor form. The order may be
+// left blank. The error is the message to show the user.
+func parseFloorForm(floorName, floorOrder string) (string, sql.NullInt64, error) {
+	floorName = strings.TrimSpace(floorName)
+	if floorName == "" || len(floorName) > 100 {
+		return "", sql.NullInt64{}, errors.New("Floor name must be between 1 and 100 characters long")
+	}
+
+	floorOrder = strings.TrimSpace(floorOrder)
+	if floorOrder == "" {
+		return floorName, sql.NullInt64{}, nil
+	}
+	order, err := strconv.Atoi(floorOrder)
+	if err != nil || order < -100 || order > 1000 {
+		return "", sql.NullInt64{}, errors.New("Floor order must be a whole number, use negative numbers for basements")
+	}
+	return floorName, sql.NullInt64{Int64: int64(order), Valid: true}, nil
+}
+
+// HandleGetAllFloors returns the floors of every building, or of ?buildingId, from the lowest
+func (a *App) HandleGetAllFloors(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	floors, err := a.DB.GetAllFloors(c.QueryParam("buildingId"))
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	return c.JSON(http.StatusOK, floors)
+}
+
+func (a *App) HandleGetFloorByID(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	floorID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid floor ID", err)
+	}
+
+	floor, err := a.DB.GetFloorByID(floorID)
+	if err == sql.ErrNoRows {
+		return a.handleError(c, http.StatusNotFound, "Floor not found", err)
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	return c.JSON(http.StatusOK, floor)
+}
+
+// HandleGetFloorPlan serves a floor plan image from the file store
+func (a *App) HandleGetFloorPlan(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	name := c.Param("name")
+	if !floorPlanNameRegex.MatchString(name) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Floor plan not found"})
+	}
+
+	file, err := a.Store.Get(c.Request().Context(), floorPlanKeyPrefix+name)
+	if err == storage.ErrNotFound {
+		return a.handleError(c, http.StatusNotFound, "Floor plan not found", err)
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error reading floor plan", err)
+	}
+	defer file.Close()
+
+	header := c.Response().Header()
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Cache-Control", "private, no-cache")
+	// SVG plans are uploaded by admins but could still carry script, never run it
+	header.Set("Content-Security-Policy", "default-src 'none'; img-src 'self' data:; style-src 'unsafe-inline'")
+
+	return c.Stream(http.StatusOK, mime.TypeByExtension(path.Ext(name)), file)
+}
+
+func (a *App) HandlePostFloor(c echo.Context) error {
+	// Check if request is a POST request
+	if c.Request().Method != http.MethodPost {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Method not allowed")
+	}
+
+	// Parse the form, limiting upload size to 10MB
+	if err := c.Request().ParseMultipartForm(maxSiteMapSize); err != nil {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Error parsing form")
+	}
+
+	buildingID, err := strconv.Atoi(c.FormValue("addFloorBuilding"))
+	if err != nil {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Building is required")
+	}
+	if _, err := a.DB.GetBuildingById(buildingID); err != nil {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Building does not exist")
+	}
+
+	floorName, floorOrder, err := parseFloorForm(c.FormValue("addFloorName"), c.FormValue("addFloorOrder"))
+	if err != nil {
+		return c.Redirect(http.StatusSeeOther, "/admin?error="+err.Error())
+	}
+
+	// Check if the floor already exists
+	if _, err := a.DB.GetFloorByNameAndBuilding(floorName, buildingID); err == nil {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Floor already exists at this building")
+	}
+
+	floorPlan, err := a.saveFloorPlan(c)
+	if err != nil {
+		return c.Redirect(http.StatusSeeOther, "/admin?error="+err.Error())
+	}
+
+	floor := &models.Floor{
+		BuildingID:         buildingID,
+		FloorName:          floorName,
+		FloorPlanImagePath: floorPlan,
+	}
+	if err := a.DB.AddFloor(floor, floorOrder); err != nil {
+		a.deleteFloorPlan(c.Request().Context(), floorPlan)
+		return a.handleError(c, http.StatusInternalServerError, "Error saving floor", err)
+	}
+
+	return c.Redirect(http.StatusFound, "/admin?message=Floor added successfully")
+}
+
+// HandleEditFloor renames and reorders a floor and replaces its plan if a new one is
+// uploaded. Floors stay in their building, move rooms to another building's floors instead.
+func (a *App) HandleEditFloor(c echo.Context) error {
+	// Check if request is a POST request
+	if c.Request().Method != http.MethodPost {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Method not allowed")
+	}
+
+	// Parse the form, limiting upload size to 10MB
+	if err := c.Request().ParseMultipartForm(maxSiteMapSize); err != nil {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Error parsing form")
+	}
+
+	floorID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Invalid floor ID")
+	}
+	existing, err := a.DB.GetFloorByID(floorID)
+	if err != nil {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Floor does not exist")
+	}
+
+	floorName, floorOrder, err := parseFloorForm(c.FormValue("editFloorName"), c.FormValue("editFloorOrder"))
+	if err != nil {
+		return c.Redirect(http.StatusSeeOther, "/admin?error="+err.Error())
+	}
+
+	// Check if another floor of the building already has the name
+	if other, err := a.DB.GetFloorByNameAndBuilding(floorName, existing.BuildingID); err == nil && other.FloorID != floorID {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Floor already exists at this building")
+	}
+
+	floorPlan, err := a.saveFloorPlan(c)
+	if err != nil {
+		return c.Redirect(http.StatusSeeOther, "/admin?error="+err.Error())
+	}
+
+	floor := *existing
+	floor.FloorName = floorName
+	if floorOrder.Valid {
+		floor.FloorOrder = int(floorOrder.Int64)
+	}
+	if floorPlan.Valid {
+		floor.FloorPlanImagePath = floorPlan
+	}
+
+	if err := a.DB.UpdateFloor(&floor); err != nil {
+		a.deleteFloorPlan(c.Request().Context(), floorPlan)
+		return a.handleError(c, http.StatusInternalServerError, "Error saving floor", err)
+	}
+	if floorPlan.Valid {
+		a.deleteFloorPlan(c.Request().Context(), existing.FloorPlanImagePath)
+	}
+
+	return c.Redirect(http.StatusFound, "/admin?message=Floor updated successfully")
+}
+
+func (a *App) HandleDeleteFloor(c echo.Context) error {
+	// Check if request is a DELETE request
+	if c.Request().Method != http.MethodDelete {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{
+			"error":       "Method not allowed",
+			"redirectURL": "/admin?error=Method not allowed",
+		})
+	}
+
+	floorID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Invalid floor ID",
+			"redirectURL": "/admin?error=Invalid floor ID",
+		})
+	}
+
+	floor, err := a.DB.GetFloorByID(floorID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error":       "Floor does not exist",
+			"redirectURL": "/admin?error=Floor does not exist",
+		})
+	}
+
+	// Check if the floor has any rooms
+	rooms, err := a.DB.CountFloorRooms(floorID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error":       "Error fetching rooms",
+			"redirectURL": "/admin?error=Error fetching rooms",
+		})
+	}
+	if rooms > 0 {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error":       "Cannot delete floor with associated rooms",
+			"redirectURL": "/admin?error=Cannot delete floor with associated rooms",
+		})
+	}
+
+	if err := a.DB.DeleteFloor(floorID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error":       "Error deleting floor",
+			"redirectURL": "/admin?error=Error deleting floor",
+		})
+	}
+	a.deleteFloorPlan(c.Request().Context(), floor.FloorPlanImagePath)
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message":     "Floor deleted successfully",
+		"redirectURL": "/admin?message=Floor deleted successfully",
+	})
+}
@@ -2,9 +2,11 @@ package app
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
@@ -51,6 +53,12 @@ func (a *App) HandleGetInspectionByID(c echo.Context) error {
 	return c.JSON(http.StatusOK, inspection)
 }
 
+var inspectionStatuses = map[string]bool{
+	models.InspectionStatusPassed:            true,
+	models.InspectionStatusPassedWithDefects: true,
+	models.InspectionStatusFailed:            true,
+}
+
 // Helper function to parse "on" as true and anything else (including "") as false
 func parseCheckbox(value string) bool {
 	return value == "on"
@@ -72,56 +80,27 @@ func (a *App) HandlePostInspection(c echo.Context) error {
 		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Invalid Device ID")
 	}
 
-	userId, err := strconv.Atoi(c.FormValue("user_id"))
+	// The inspector is the logged in user, never a user ID sent with the form
+	userId, _, err := currentUser(c)
 	if err != nil {
 		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Invalid User ID")
 	}
-	// Usage example for each form field with checkboxes
-	inspection.IsConspicuous.Bool = parseCheckbox(c.FormValue("isConspicuous"))
-	inspection.IsAccessible.Bool = parseCheckbox(c.FormValue("isAccessible"))
-	inspection.IsAssignedLocation.Bool = parseCheckbox(c.FormValue("isAssignedLocation"))
-	inspection.IsSignVisible.Bool = parseCheckbox(c.FormValue("isSignVisible"))
-	inspection.IsAntiTamperDeviceIntact.Bool = parseCheckbox(c.FormValue("isAntiTamperDeviceIntact"))
-	inspection.IsSupportBracketSecure.Bool = parseCheckbox(c.FormValue("isSupportBracketSecure"))
 	inspection.WorkOrderRequired.Bool = parseCheckbox(c.FormValue("workOrderRequired"))
-	inspection.AreOperatingInstructionsClear.Bool = parseCheckbox(c.FormValue("areOperatingInstructionsClear"))
-	inspection.IsMaintenanceTagAttached.Bool = parseCheckbox(c.FormValue("isMaintenanceTagAttached"))
-	inspection.IsNoExternalDamage.Bool = parseCheckbox(c.FormValue("isNoExternalDamage"))
-	inspection.IsChargeGaugeNormal.Bool = parseCheckbox(c.FormValue("isChargeGaugeNormal"))
-	inspection.IsReplaced.Bool = parseCheckbox(c.FormValue("isReplaced"))
-	inspection.AreMaintenanceRecordsComplete.Bool = parseCheckbox(c.FormValue("areMaintenanceRecordsComplete"))
 	inspection_status := c.FormValue("inspection_status")
 
-	// Log the inspection details
-	fmt.Println("Inspection Date:", inspectionDateTime)
-	fmt.Println("Notes:", notes)
-	fmt.Println("Device ID:", deviceID)
-	fmt.Println("User ID:", userId)
-	fmt.Println("IsConspicuous:", inspection.IsConspicuous.Bool)
-	fmt.Println("IsAccessible:", inspection.IsAccessible.Bool)
-	fmt.Println("IsAssignedLocation:", inspection.IsAssignedLocation.Bool)
-	fmt.Println("IsSignVisible:", inspection.IsSignVisible.Bool)
-	fmt.Println("IsAntiTamperDeviceIntact:", inspection.IsAntiTamperDeviceIntact.Bool)
-	fmt.Println("IsSupportBracketSecure:", inspection.IsSupportBracketSecure.Bool)
-	fmt.Println("WorkOrderRequired:", inspection.WorkOrderRequired.Bool)
-	fmt.Println("AreOperatingInstructionsClear:", inspection.AreOperatingInstructionsClear.Bool)
-	fmt.Println("IsMaintenanceTagAttached:", inspection.IsMaintenanceTagAttached.Bool)
-	fmt.Println("IsNoExternalDamage:", inspection.IsNoExternalDamage.Bool)
-	fmt.Println("IsChargeGaugeNormal:", inspection.IsChargeGaugeNormal.Bool)
-	fmt.Println("IsReplaced:", inspection.IsReplaced.Bool)
-	fmt.Println("AreMaintenanceRecordsComplete:", inspection.AreMaintenanceRecordsComplete.Bool)
-	fmt.Println("InspectionStatus:", inspection_status)
-
-	// Validate required fields
-	if inspectionDateTime == "" || deviceID == 0 || userId == 0 || inspection_status == "" {
+	// Validate required fields, the status is calculated when the device has a checklist
+	if inspectionDateTime == "" || deviceID == 0 || userId == 0 {
 		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Invalid request payload")
 	}
 
 	// Check if the device ID exists
-	_, err = a.DB.GetDeviceByID(deviceID)
+	device, err := a.DB.GetDeviceByID(deviceID)
 	if err != nil {
 		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Invalid Device ID")
 	}
+	if device.BuildingArchived {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Devices of an archived building cannot be inspected")
+	}
 
 	// Check if the user ID exists
 	_, err = a.DB.GetUserByID(userId)
@@ -129,28 +108,20 @@ func (a *App) HandlePostInspection(c echo.Context) error {
 		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Invalid User ID")
 	}
 
-	// Parse the input date and time, assuming it's in local time
-	localLocation, err := time.LoadLocation("Pacific/Auckland") // Load NZDT timezone
-	if err != nil {
-		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Invalid Timezone")
-	}
+	// Parse the input date and time, entered in the time zone of the device's site
+	localLocation := a.siteLocation(device.SiteTimeZone)
 	formattedInspectionDateTime, err := time.ParseInLocation("2006-01-02T15:04", inspectionDateTime, localLocation)
 	if err != nil {
 		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Invalid Inspection Date and Time")
 	}
 
-	// Log the formatted inspection date time
-	fmt.Println("Formatted Inspection Date Time:", formattedInspectionDateTime)
-
 	// Create the sql.NullTime struct
 	nullTimeDate := sql.NullTime{
 		Time:  formattedInspectionDateTime,
 		Valid: true,
 	}
 
-	// Log the current time in local timezone
 	currentTime := time.Now().In(localLocation) // Get current local time
-	fmt.Println("Current Local Time:", currentTime)
 
 	// Check if the formatted inspection date time is valid and in the future
 	if nullTimeDate.Valid && nullTimeDate.Time.After(currentTime) {
@@ -162,22 +133,110 @@ func (a *App) HandlePostInspection(c echo.Context) error {
 		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Notes must be less than 255 characters")
 	}
 
+	// Read the answers to the current checklist for the device's type, device types
+	// without a checklist template are inspected with notes only
+	var responses []models.InspectionResponse
+	template, err := a.DB.GetLatestChecklistTemplate(device.EmergencyDeviceTypeID)
+	if err != nil && err != sql.ErrNoRows {
+		a.handleLogger("Error fetching checklist template: " + err.Error())
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Error fetching checklist")
+	}
+	if err == nil {
+		responses, err = a.parseChecklistAnswers(c, template, userId)
+		if err != nil {
+			return c.Redirect(http.StatusSeeOther, "/dashboard?error="+err.Error())
+		}
+		inspection.ChecklistTemplateID = sql.NullInt64{Int64: int64(template.ChecklistTemplateID), Valid: true}
+	}
+
+	err = a.resolveInspectionStatus(c, inspection, responses, inspection_status, c.FormValue("override_justification"))
+	if err != nil {
+		a.removeResponsePhotos(responses)
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error="+err.Error())
+	}
+
 	// Set the remaining inspection fields
 	inspection.InspectionDateTime = nullTimeDate
 	inspection.Notes.String = notes
 	inspection.EmergencyDeviceID = deviceID
 	inspection.UserID = userId
-	inspection.InspectionStatus = inspection_status
+
+	// The inspector signs the inspection, then its content is sealed with a hash
+	signature := models.InspectionSignatureDto{
+		SignatureType: c.FormValue("signature_type"),
+		SignedName:    c.FormValue("signed_name"),
+		SignatureData: c.FormValue("signature_data"),
+		Attest:        parseCheckbox(c.FormValue("attest")),
+	}
+	if err := a.signInspection(c, inspection, &signature); err != nil {
+		a.removeResponsePhotos(responses)
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error="+err.Error())
+	}
+	if err := a.sealInspection(inspection, responses); err != nil {
+		a.removeResponsePhotos(responses)
+		a.removeSignatureImage(inspection)
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
 
 	// Log the inspection details (consider using structured logging)
 	a.handleLogger(fmt.Sprintf("New inspection submission: deviceID=%d, userID=%d, date=%s",
 		deviceID, userId, inspectionDateTime))
 
 	// Add the inspection to the database
-	err = a.DB.AddInspection(inspection)
+	_, err = a.DB.AddInspection(inspection, responses)
 	if err != nil {
+		a.removeResponsePhotos(responses)
+		a.removeSignatureImage(inspection)
 		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
 
 	return c.Redirect(http.StatusSeeOther, "/dashboard?message=Inspection added successfully")
 }
+
+// resolveInspectionStatus sets the status of the inspection. The outcome of a checklist
+// inspection comes from its answers; a submitted status that disagrees overrides it and
+// needs a justification. Only admins reach the inspection routes, so the override is
+// recorded against the current user. Inspections without a checklist take the submitted
+// status.
+func (a *App) resolveInspectionStatus(c echo.Context, inspection *models.Inspection, responses []models.InspectionResponse, submitted, justification string) error {
+	if submitted != "" && !inspectionStatuses[submitted] {
+		return errors.New("Invalid Inspection Status")
+	}
+
+	inspection.ComputedStatus = sql.NullString{}
+	inspection.OverriddenBy = sql.NullInt64{}
+	inspection.OverrideJustification = sql.NullString{}
+
+	if !inspection.ChecklistTemplateID.Valid {
+		if submitted == "" {
+			return errors.New("Invalid request payload")
+		}
+		inspection.InspectionStatus = submitted
+		return nil
+	}
+
+	computedStatus := computeInspectionOutcome(responses)
+	inspection.ComputedStatus = sql.NullString{String: computedStatus, Valid: true}
+
+	if submitted == "" || submitted == computedStatus {
+		inspection.InspectionStatus = computedStatus
+		return nil
+	}
+
+	currentUserID, _, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	justification = strings.TrimSpace(justification)
+	if justification == "" || len(justification) > 500 {
+		return errors.New("A justification of up to 500 characters is required to override the calculated status of " + computedStatus)
+	}
+
+	inspection.InspectionStatus = submitted
+	inspection.OverriddenBy = sql.NullInt64{Int64: int64(currentUserID), Valid: true}
+	inspection.OverrideJustification = sql.NullString{String: justification, Valid: true}
+	a.handleLogger(fmt.Sprintf("Inspection status overridden from %s to %s by userID=%d", computedStatus, submitted, currentUserID))
+
+	return nil
+}
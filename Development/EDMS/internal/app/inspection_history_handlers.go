@@ -0,0 +1,214 @@
+package app
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/labstack/echo/v4"
+)
+
+// Inspections per page of the history unless ?page_size says otherwise
+const (
+	defaultInspectionPageSize = 50
+	maxInspectionPageSize     = 500
+)
+
+// parseInspectionHistoryFilter reads the history filters from the query string
+func parseInspectionHistoryFilter(c echo.Context) (models.InspectionHistoryFilter, error) {
+	filter := models.InspectionHistoryFilter{}
+
+	ids := []struct {
+		param string
+		name  string
+		dest  *int
+	}{
+		{"site_id", "site", &filter.SiteID},
+		{"building_id", "building", &filter.BuildingID},
+		{"room_id", "room", &filter.RoomID},
+		{"device_type_id", "device type", &filter.EmergencyDeviceTypeID},
+		{"user_id", "inspector", &filter.UserID},
+	}
+	for _, id := range ids {
+		value := strings.TrimSpace(c.QueryParam(id.param))
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return filter, fmt.Errorf("invalid %s ID", id.name)
+		}
+		*id.dest = parsed
+	}
+
+	filter.Inspector = strings.TrimSpace(c.QueryParam("inspector"))
+
+	// Statuses can be repeated or comma separated
+	for _, value := range c.QueryParams()["status"] {
+		for _, status := range strings.Split(value, ",") {
+			status = strings.TrimSpace(status)
+			if status == "" {
+				continue
+			}
+			if !inspectionStatuses[status] {
+				return filter, fmt.Errorf("invalid status %q", status)
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	for _, date := range []struct {
+		param string
+		dest  *sql.NullTime
+	}{
+		{"from", &filter.From},
+		{"to", &filter.To},
+	} {
+		value := strings.TrimSpace(c.QueryParam(date.param))
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s date, use YYYY-MM-DD", date.param)
+		}
+		*date.dest = sql.NullTime{Time: parsed, Valid: true}
+	}
+	if filter.From.Valid && filter.To.Valid && filter.To.Time.Before(filter.From.Time) {
+		return filter, fmt.Errorf("the to date is before the from date")
+	}
+
+	if value := strings.TrimSpace(c.QueryParam("work_order_required")); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("work_order_required must be true or false")
+		}
+		filter.WorkOrderRequired = sql.NullBool{Bool: parsed, Valid: true}
+	}
+
+	if value := strings.TrimSpace(c.QueryParam("include_revised")); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("include_revised must be true or false")
+		}
+		filter.IncludeRevised = parsed
+	}
+
+	return filter, nil
+}
+
+// HandleGetInspectionHistory returns inspections across devices, filtered by site,
+// building, room, device type, inspector, status, date range and whether a work order is
+// required. Results are paged with ?page and ?page_size, or ?format=csv downloads every
+// match.
+func (a *App) HandleGetInspectionHistory(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	filter, err := parseInspectionHistoryFilter(c)
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, err.Error(), err)
+	}
+
+	if c.QueryParam("format") == "csv" {
+		inspections, err := a.DB.GetInspectionHistory(filter, 0, 0)
+		if err != nil {
+			return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+		}
+		return a.writeInspectionHistoryCSV(c, inspections)
+	}
+
+	page, pageSize := 1, defaultInspectionPageSize
+	if value := c.QueryParam("page"); value != "" {
+		page, err = strconv.Atoi(value)
+		if err != nil || page < 1 {
+			return a.handleError(c, http.StatusBadRequest, "Invalid page", err)
+		}
+	}
+	if value := c.QueryParam("page_size"); value != "" {
+		pageSize, err = strconv.Atoi(value)
+		if err != nil || pageSize < 1 || pageSize > maxInspectionPageSize {
+			return a.handleError(c, http.StatusBadRequest, "Invalid page size", err)
+		}
+	}
+
+	total, err := a.DB.CountInspectionHistory(filter)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+	inspections, err := a.DB.GetInspectionHistory(filter, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	return c.JSON(http.StatusOK, models.InspectionHistoryPage{
+		Inspections: inspections,
+		Page:        page,
+		PageSize:    pageSize,
+		Total:       total,
+		TotalPages:  (total + pageSize - 1) / pageSize,
+	})
+}
+
+// writeInspectionHistoryCSV sends the inspections as a CSV download
+func (a *App) writeInspectionHistoryCSV(c echo.Context, inspections []models.InspectionHistoryItem) error {
+	fileName := fmt.Sprintf("inspections_%s.csv", a.localNow().Format("2006-01-02"))
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", fileName))
+	res.WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(res)
+	w.Write([]string{
+		"Inspection ID", "Inspection Date", "Status", "Work Order Required", "Inspector",
+		"Device ID", "Device Type", "Serial Number", "Site", "Building", "Room", "Notes", "Revision",
+	})
+	for _, inspection := range inspections {
+		inspectionDate := ""
+		if inspection.InspectionDateTime.Valid {
+			inspectionDate = inspection.InspectionDateTime.Time.Format("2006-01-02 15:04")
+		}
+		workOrderRequired := "No"
+		if inspection.WorkOrderRequired.Bool {
+			workOrderRequired = "Yes"
+		}
+		w.Write([]string{
+			strconv.Itoa(inspection.EmergencyDeviceInspectionID),
+			inspectionDate,
+			inspection.InspectionStatus,
+			workOrderRequired,
+			csvSafe(inspection.InspectorName),
+			strconv.Itoa(inspection.EmergencyDeviceID),
+			csvSafe(inspection.EmergencyDeviceTypeName),
+			csvSafe(inspection.SerialNumber.String),
+			csvSafe(inspection.SiteName),
+			csvSafe(inspection.BuildingCode),
+			csvSafe(inspection.RoomCode),
+			csvSafe(inspection.Notes.String),
+			inspection.RevisionAction.String,
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// csvFormulaStart are the characters that start a formula in a spreadsheet
+const csvFormulaStart = "=+-@\t\r"
+
+// csvSafe stops text typed by users being run as a formula when the CSV is opened in a
+// spreadsheet. Text that already looks escaped is escaped again, so csvValue reads it
+// back as it was.
+func csvSafe(value string) string {
+	unquoted := strings.TrimLeft(value, "'")
+	if unquoted != "" && strings.ContainsRune(csvFormulaStart, rune(unquoted[0])) {
+		return "'" + value
+	}
+	return value
+}
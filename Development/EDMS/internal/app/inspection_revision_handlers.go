@@ -0,0 +1,349 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/database"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/labstack/echo/v4"
+)
+
+// HandleGetInspectionRevisions returns the amendments and voids of an inspection's revision chain
+func (a *App) HandleGetInspectionRevisions(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	inspectionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid inspection ID", err)
+	}
+
+	revisions, err := a.DB.GetInspectionRevisions(inspectionID)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	// Return the results as JSON
+	return c.JSON(http.StatusOK, revisions)
+}
+
+// HandleAmendInspection corrects an inspection. The original is kept unchanged and
+// replaced by an amended copy, the revision records the reason and who made it.
+func (a *App) HandleAmendInspection(c echo.Context) error {
+	// Check if request is not a post request
+	if c.Request().Method != http.MethodPost {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{
+			"error":       "Method not allowed",
+			"redirectURL": "/dashboard?error=Method not allowed",
+		})
+	}
+
+	inspectionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Invalid inspection ID",
+			"redirectURL": "/dashboard?error=Invalid inspection ID",
+		})
+	}
+
+	var amendDto models.InspectionAmendDto
+	if err := c.Bind(&amendDto); err != nil {
+		a.handleLogger("Error binding request body: " + err.Error())
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Invalid request body",
+			"redirectURL": "/dashboard?error=Invalid request body",
+		})
+	}
+
+	original, err := a.DB.GetInspectionByID(inspectionID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error":       "Inspection not found",
+			"redirectURL": "/dashboard?error=Inspection not found",
+		})
+	}
+
+	amended, responses, err := a.validateInspectionAmendment(c, original, &amendDto)
+	if err != nil {
+		a.handleLogger("Error validating inspection amendment: " + err.Error())
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Error validating inspection amendment: " + err.Error(),
+			"redirectURL": "/dashboard?error=" + err.Error(),
+		})
+	}
+
+	if err := a.sealInspection(amended, responses); err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error amending inspection", err)
+	}
+
+	revision := &models.InspectionRevision{Reason: strings.TrimSpace(amendDto.Reason)}
+	if userID, _, err := currentUser(c); err == nil {
+		revision.RevisedBy = sql.NullInt64{Int64: int64(userID), Valid: true}
+	}
+
+	amendedID, err := a.DB.AmendInspection(inspectionID, amended, responses, revision)
+	if errors.Is(err, database.ErrInspectionRevised) {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error":       "This inspection has already been amended or voided",
+			"redirectURL": "/dashboard?error=This inspection has already been amended or voided",
+		})
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error amending inspection", err)
+	}
+
+	a.handleLogger(fmt.Sprintf("Inspection %d amended as %d: %s", inspectionID, amendedID, revision.Reason))
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":                        "Inspection amended successfully",
+		"emergency_device_inspection_id": amendedID,
+		"redirectURL":                    "/dashboard?message=Inspection amended successfully",
+	})
+}
+
+// HandleVoidInspection marks an inspection as no longer counting towards its device
+func (a *App) HandleVoidInspection(c echo.Context) error {
+	// Check if request is not a post request
+	if c.Request().Method != http.MethodPost {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{
+			"error":       "Method not allowed",
+			"redirectURL": "/dashboard?error=Method not allowed",
+		})
+	}
+
+	inspectionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Invalid inspection ID",
+			"redirectURL": "/dashboard?error=Invalid inspection ID",
+		})
+	}
+
+	var voidDto models.InspectionVoidDto
+	if err := c.Bind(&voidDto); err != nil {
+		a.handleLogger("Error binding request body: " + err.Error())
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Invalid request body",
+			"redirectURL": "/dashboard?error=Invalid request body",
+		})
+	}
+
+	reason, err := validateRevisionReason(voidDto.Reason)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       err.Error(),
+			"redirectURL": "/dashboard?error=" + err.Error(),
+		})
+	}
+
+	revision := &models.InspectionRevision{Reason: reason}
+	if userID, _, err := currentUser(c); err == nil {
+		revision.RevisedBy = sql.NullInt64{Int64: int64(userID), Valid: true}
+	}
+
+	err = a.DB.VoidInspection(inspectionID, revision)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error":       "Inspection not found",
+			"redirectURL": "/dashboard?error=Inspection not found",
+		})
+	} else if errors.Is(err, database.ErrInspectionRevised) {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error":       "This inspection has already been amended or voided",
+			"redirectURL": "/dashboard?error=This inspection has already been amended or voided",
+		})
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error voiding inspection", err)
+	}
+
+	a.handleLogger(fmt.Sprintf("Inspection %d voided: %s", inspectionID, reason))
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message":     "Inspection voided successfully",
+		"redirectURL": "/dashboard?message=Inspection voided successfully",
+	})
+}
+
+func validateRevisionReason(reason string) (string, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" || len(reason) > 500 {
+		return "", errors.New("a reason of up to 500 characters is required")
+	}
+	return reason, nil
+}
+
+// validateInspectionAmendment builds the amended copy of an inspection. Fields left out of
+// the request keep their original value, as does an empty device or time. Answers are only
+// replaced for the questions given.
+func (a *App) validateInspectionAmendment(c echo.Context, original *models.Inspection, dto *models.InspectionAmendDto) (*models.Inspection, []models.InspectionResponse, error) {
+	if original.RevisionAction.Valid {
+		return nil, nil, errors.New("this inspection has already been amended or voided")
+	}
+
+	if _, err := validateRevisionReason(dto.Reason); err != nil {
+		return nil, nil, err
+	}
+
+	// Start from the original so legacy checklist columns carry over. The inspector's
+	// signature covered the original content, so it is not carried over to the copy.
+	amended := *original
+	amended.Responses = nil
+	amended.ClientUUID = sql.NullString{}
+	amended.SignatureType = sql.NullString{}
+	amended.SignedName = sql.NullString{}
+	amended.AttestationText = sql.NullString{}
+	amended.SignatureKey = sql.NullString{}
+	amended.SignatureSHA256 = sql.NullString{}
+	amended.SignedAt = sql.NullTime{}
+
+	// Moving the inspection to another device is only possible within the same device
+	// type, as the checklist answers belong to that type. A new time is entered in the
+	// time zone of the site the inspection ends up at.
+	timeZone := original.SiteTimeZone
+	deviceID := original.EmergencyDeviceID
+	if dto.EmergencyDeviceID != "" {
+		var err error
+		deviceID, err = strconv.Atoi(dto.EmergencyDeviceID)
+		if err != nil {
+			return nil, nil, errors.New("invalid device ID")
+		}
+	}
+	device, err := a.DB.GetDeviceByID(deviceID)
+	if err != nil {
+		return nil, nil, errors.New("device does not exist")
+	}
+	if device.BuildingArchived {
+		return nil, nil, errors.New("devices of an archived building cannot be inspected")
+	}
+	if deviceID != original.EmergencyDeviceID {
+		originalDevice, err := a.DB.GetDeviceByID(original.EmergencyDeviceID)
+		if err != nil {
+			return nil, nil, errors.New("original device does not exist")
+		}
+		if original.ChecklistTemplateID.Valid && device.EmergencyDeviceTypeID != originalDevice.EmergencyDeviceTypeID {
+			return nil, nil, errors.New("the inspection can only be moved to a device of the same type")
+		}
+		amended.EmergencyDeviceID = deviceID
+		timeZone = device.SiteTimeZone
+	}
+
+	if dto.InspectionDateTime != "" {
+		inspectionDateTime, err := parseInspectionDateTime(dto.InspectionDateTime, a.siteLocation(timeZone))
+		if err != nil {
+			return nil, nil, err
+		}
+		amended.InspectionDateTime = sql.NullTime{Time: inspectionDateTime, Valid: true}
+	}
+
+	if dto.Notes != nil {
+		// Validate notes length is less than 255 characters
+		if len(*dto.Notes) > 255 {
+			return nil, nil, errors.New("notes must be less than 255 characters")
+		}
+		amended.Notes = sql.NullString{String: *dto.Notes, Valid: true}
+	}
+	if dto.WorkOrderRequired != nil {
+		amended.WorkOrderRequired = sql.NullBool{Bool: *dto.WorkOrderRequired, Valid: true}
+	}
+
+	responses, err := a.amendChecklistAnswers(original, dto.Answers)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Keep an existing override when nothing affecting the outcome was changed
+	if original.OverrideJustification.Valid && dto.InspectionStatus == "" && dto.OverrideJustification == "" &&
+		computeInspectionOutcome(responses) == original.ComputedStatus.String {
+		return &amended, responses, nil
+	}
+
+	submitted := dto.InspectionStatus
+	if submitted == "" && !original.ChecklistTemplateID.Valid {
+		submitted = original.InspectionStatus
+	}
+	if err := a.resolveInspectionStatus(c, &amended, responses, submitted, dto.OverrideJustification); err != nil {
+		return nil, nil, err
+	}
+
+	return &amended, responses, nil
+}
+
+// amendChecklistAnswers copies the original answers, replacing those given by question ID.
+// Photo answers keep the original attachment.
+func (a *App) amendChecklistAnswers(original *models.Inspection, answers map[string]string) ([]models.InspectionResponse, error) {
+	var responses []models.InspectionResponse
+	if !original.ChecklistTemplateID.Valid {
+		if len(answers) > 0 {
+			return nil, errors.New("this inspection has no checklist")
+		}
+		return responses, nil
+	}
+
+	template, err := a.DB.GetChecklistTemplateByID(int(original.ChecklistTemplateID.Int64))
+	if err != nil {
+		return nil, errors.New("checklist template not found")
+	}
+
+	existing := make(map[int]models.InspectionResponse)
+	for _, response := range original.Responses {
+		existing[response.ChecklistQuestionID] = response
+	}
+
+	questionIDs := make(map[string]bool)
+	for _, question := range template.Questions {
+		key := strconv.Itoa(question.ChecklistQuestionID)
+		questionIDs[key] = true
+
+		response, ok := existing[question.ChecklistQuestionID]
+		response.InspectionResponseID = 0
+		response.EmergencyDeviceInspectionID = 0
+		response.ChecklistQuestionID = question.ChecklistQuestionID
+		response.QuestionText = question.QuestionText
+		response.AnswerType = question.AnswerType
+		response.Severity = question.Severity
+
+		if value, given := answers[key]; given {
+			if err := setChecklistAnswer(&response, question, value); err != nil {
+				return nil, err
+			}
+			ok = response.AnswerYesNo.Valid || response.AnswerNumber.Valid || response.AnswerText.Valid
+		}
+
+		if question.IsRequired && !ok {
+			return nil, fmt.Errorf("%s is required", question.QuestionText)
+		}
+		if ok {
+			responses = append(responses, response)
+		}
+	}
+
+	for key := range answers {
+		if !questionIDs[key] {
+			return nil, fmt.Errorf("question %s is not part of this inspection's checklist", key)
+		}
+	}
+
+	return responses, nil
+}
+
+// parseInspectionDateTime parses a datetime-local value entered in the time zone of the
+// device's site, inspections cannot be dated in the future
+func parseInspectionDateTime(value string, location *time.Location) (time.Time, error) {
+	inspectionDateTime, err := time.ParseInLocation("2006-01-02T15:04", value, location)
+	if err != nil {
+		return time.Time{}, errors.New("invalid inspection date and time")
+	}
+
+	if inspectionDateTime.After(time.Now()) {
+		return time.Time{}, errors.New("inspection date and time cannot be in the future")
+	}
+
+	return inspectionDateTime, nil
+}
@@ -0,0 +1,416 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/database"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/labstack/echo/v4"
+)
+
+// HandleGetAllInspectionRounds lists inspection rounds, assigned_to=me only returns the
+// logged in user's rounds
+func (a *App) HandleGetAllInspectionRounds(c echo.Context) error {
+	// Check if request if a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	assignedTo := 0
+	switch filter := c.QueryParam("assigned_to"); filter {
+	case "":
+	case "me":
+		userID, _, err := currentUser(c)
+		if err != nil {
+			return a.handleError(c, http.StatusUnauthorized, "Unauthorized", err)
+		}
+		assignedTo = userID
+	default:
+		userID, err := strconv.Atoi(filter)
+		if err != nil {
+			return a.handleError(c, http.StatusBadRequest, "Invalid user ID", err)
+		}
+		assignedTo = userID
+	}
+
+	rounds, err := a.DB.GetAllInspectionRounds(assignedTo, c.QueryParam("status"))
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	now := time.Now()
+	for i := range rounds {
+		a.setRoundOverdue(&rounds[i], now)
+	}
+
+	// Return the results as JSON
+	return c.JSON(http.StatusOK, rounds)
+}
+
+// HandleGetInspectionRoundByID returns a round with its devices in route order and its progress
+func (a *App) HandleGetInspectionRoundByID(c echo.Context) error {
+	// Check if request if a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	roundID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid inspection round ID", err)
+	}
+
+	round, err := a.DB.GetInspectionRoundByID(roundID)
+	if err == sql.ErrNoRows {
+		return a.handleError(c, http.StatusNotFound, "Inspection round not found", err)
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+	a.setRoundOverdue(round, time.Now())
+
+	// Return the results as JSON
+	return c.JSON(http.StatusOK, round)
+}
+
+// setRoundOverdue marks an open round overdue once its due date has passed at its site
+func (a *App) setRoundOverdue(round *models.InspectionRound, now time.Time) {
+	if !round.DueDate.Valid || round.Status == models.RoundStatusCompleted || round.Status == models.RoundStatusCancelled {
+		return
+	}
+	today := civilDate(now.In(a.siteLocation(round.SiteTimeZone)))
+	round.Stats.IsOverdue = civilDate(round.DueDate.Time).Before(today)
+}
+
+// HandlePostInspectionRound generates a round from the devices due in a site or building
+func (a *App) HandlePostInspectionRound(c echo.Context) error {
+	// Check if request is not a post request
+	if c.Request().Method != http.MethodPost {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{
+			"error":       "Method not allowed",
+			"redirectURL": "/dashboard?error=Method not allowed",
+		})
+	}
+
+	var roundDto models.InspectionRoundDto
+	if err := c.Bind(&roundDto); err != nil {
+		a.handleLogger("Error binding request body: " + err.Error())
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Invalid request body",
+			"redirectURL": "/dashboard?error=Invalid request body",
+		})
+	}
+
+	round, err := a.validateInspectionRound(&roundDto)
+	if err != nil {
+		a.handleLogger("Error validating inspection round: " + err.Error())
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Error validating inspection round: " + err.Error(),
+			"redirectURL": "/dashboard?error=" + err.Error(),
+		})
+	}
+
+	if userID, _, err := currentUser(c); err == nil {
+		round.CreatedBy = sql.NullInt64{Int64: int64(userID), Valid: true}
+	}
+
+	roundID, err := a.DB.AddInspectionRound(round)
+	if errors.Is(err, database.ErrNoDevicesDue) {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "No devices are due for inspection by this date",
+			"redirectURL": "/dashboard?error=No devices are due for inspection by this date",
+		})
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error saving inspection round", err)
+	}
+
+	a.handleLogger(fmt.Sprintf("Inspection round %d generated for site %d", roundID, round.SiteID))
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":             "Inspection round created successfully",
+		"inspection_round_id": roundID,
+		"redirectURL":         "/dashboard?message=Inspection round created successfully",
+	})
+}
+
+// HandlePutInspectionRoundAssignment reassigns a round to another inspector or due date
+func (a *App) HandlePutInspectionRoundAssignment(c echo.Context) error {
+	// Check if request is not a put request
+	if c.Request().Method != http.MethodPut {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{
+			"error":       "Method not allowed",
+			"redirectURL": "/dashboard?error=Method not allowed",
+		})
+	}
+
+	roundID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Invalid inspection round ID",
+			"redirectURL": "/dashboard?error=Invalid inspection round ID",
+		})
+	}
+
+	var roundDto models.InspectionRoundDto
+	if err := c.Bind(&roundDto); err != nil {
+		a.handleLogger("Error binding request body: " + err.Error())
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Invalid request body",
+			"redirectURL": "/dashboard?error=Invalid request body",
+		})
+	}
+
+	round, err := a.DB.GetInspectionRoundByID(roundID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error":       "Inspection round not found",
+			"redirectURL": "/dashboard?error=Inspection round not found",
+		})
+	}
+	if round.Status == models.RoundStatusCompleted || round.Status == models.RoundStatusCancelled {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error":       "Only open inspection rounds can be reassigned",
+			"redirectURL": "/dashboard?error=Only open inspection rounds can be reassigned",
+		})
+	}
+
+	assignedTo, err := a.validateRoundInspector(roundDto.AssignedTo)
+	if err == nil && roundDto.DueDate != "" {
+		round.DueDate.Time, err = parseRoundDueDate(roundDto.DueDate, a.siteLocation(round.SiteTimeZone))
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       err.Error(),
+			"redirectURL": "/dashboard?error=" + err.Error(),
+		})
+	}
+
+	if err := a.DB.UpdateInspectionRoundAssignment(roundID, int(assignedTo.Int64), round.DueDate.Time); err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error updating inspection round", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message":     "Inspection round reassigned successfully",
+		"redirectURL": "/dashboard?message=Inspection round reassigned successfully",
+	})
+}
+
+// HandleCancelInspectionRound cancels an open round
+func (a *App) HandleCancelInspectionRound(c echo.Context) error {
+	// Check if request is not a post request
+	if c.Request().Method != http.MethodPost {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{
+			"error":       "Method not allowed",
+			"redirectURL": "/dashboard?error=Method not allowed",
+		})
+	}
+
+	roundID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Invalid inspection round ID",
+			"redirectURL": "/dashboard?error=Invalid inspection round ID",
+		})
+	}
+
+	if err := a.DB.CancelInspectionRound(roundID); err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error cancelling inspection round", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message":     "Inspection round cancelled successfully",
+		"redirectURL": "/dashboard?message=Inspection round cancelled successfully",
+	})
+}
+
+// HandlePutInspectionRoundItem skips a device on the round with a reason, or puts a
+// skipped device back on the round. Devices are marked inspected by recording an inspection.
+func (a *App) HandlePutInspectionRoundItem(c echo.Context) error {
+	// Check if request is not a put request
+	if c.Request().Method != http.MethodPut {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{
+			"error":       "Method not allowed",
+			"redirectURL": "/dashboard?error=Method not allowed",
+		})
+	}
+
+	roundID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Invalid inspection round ID",
+			"redirectURL": "/dashboard?error=Invalid inspection round ID",
+		})
+	}
+	itemID, err := strconv.Atoi(c.Param("itemId"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Invalid inspection round item ID",
+			"redirectURL": "/dashboard?error=Invalid inspection round item ID",
+		})
+	}
+
+	var itemDto models.InspectionRoundItemDto
+	if err := c.Bind(&itemDto); err != nil {
+		a.handleLogger("Error binding request body: " + err.Error())
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Invalid request body",
+			"redirectURL": "/dashboard?error=Invalid request body",
+		})
+	}
+
+	item, err := validateInspectionRoundItem(&itemDto)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       err.Error(),
+			"redirectURL": "/dashboard?error=" + err.Error(),
+		})
+	}
+
+	round, err := a.DB.GetInspectionRoundByID(roundID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error":       "Inspection round not found",
+			"redirectURL": "/dashboard?error=Inspection round not found",
+		})
+	}
+	if round.Status == models.RoundStatusCancelled {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error":       "This inspection round has been cancelled",
+			"redirectURL": "/dashboard?error=This inspection round has been cancelled",
+		})
+	}
+
+	err = a.DB.UpdateInspectionRoundItem(roundID, itemID, item)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error":       "Device not found on this round or already inspected",
+			"redirectURL": "/dashboard?error=Device not found on this round or already inspected",
+		})
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error updating inspection round", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message":     "Inspection round updated successfully",
+		"redirectURL": "/dashboard?message=Inspection round updated successfully",
+	})
+}
+
+func (a *App) validateInspectionRound(dto *models.InspectionRoundDto) (*models.InspectionRound, error) {
+	round := &models.InspectionRound{}
+
+	round.RoundName = strings.TrimSpace(dto.RoundName)
+	if round.RoundName == "" || len(round.RoundName) > 100 {
+		return nil, errors.New("round name is required and must be less than 100 characters")
+	}
+
+	site, err := a.DB.GetSiteByID(dto.SiteID)
+	if err != nil {
+		return nil, errors.New("site does not exist")
+	}
+	round.SiteID = site.SiteID
+	round.SiteName = site.SiteName
+
+	// Leaving the building empty covers the whole site
+	if dto.BuildingID != "" {
+		buildingID, err := strconv.Atoi(dto.BuildingID)
+		if err != nil {
+			return nil, errors.New("invalid building ID")
+		}
+		building, err := a.DB.GetBuildingById(buildingID)
+		if err != nil {
+			return nil, errors.New("building does not exist")
+		}
+		if building.SiteID != site.SiteID {
+			return nil, errors.New("building is not on the selected site")
+		}
+		round.BuildingID = sql.NullInt64{Int64: int64(buildingID), Valid: true}
+	}
+
+	round.AssignedTo, err = a.validateRoundInspector(dto.AssignedTo)
+	if err != nil {
+		return nil, err
+	}
+
+	dueDate, err := parseRoundDueDate(dto.DueDate, a.siteLocation(site.TimeZone))
+	if err != nil {
+		return nil, err
+	}
+	round.DueDate = sql.NullTime{Time: dueDate, Valid: true}
+
+	return round, nil
+}
+
+// validateRoundInspector checks the round is assigned to a user who can record inspections
+func (a *App) validateRoundInspector(value string) (sql.NullInt64, error) {
+	userID, err := strconv.Atoi(value)
+	if err != nil {
+		return sql.NullInt64{}, errors.New("an inspector is required")
+	}
+
+	user, err := a.DB.GetUserByID(userID)
+	if err != nil {
+		return sql.NullInt64{}, errors.New("inspector does not exist")
+	}
+	if user.Role != "Admin" {
+		return sql.NullInt64{}, errors.New("only admin users can record inspections")
+	}
+
+	return sql.NullInt64{Int64: int64(userID), Valid: true}, nil
+}
+
+// parseRoundDueDate reads a round's due date, which cannot be before today at the site
+func parseRoundDueDate(value string, location *time.Location) (time.Time, error) {
+	dueDate, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, errors.New("invalid due date")
+	}
+
+	today := time.Now().In(location).Format("2006-01-02")
+	if value < today {
+		return time.Time{}, errors.New("due date cannot be in the past")
+	}
+
+	return dueDate, nil
+}
+
+func validateInspectionRoundItem(dto *models.InspectionRoundItemDto) (*models.InspectionRoundItem, error) {
+	item := &models.InspectionRoundItem{Status: dto.Status}
+
+	switch dto.Status {
+	case models.RoundItemStatusPending:
+		return item, nil
+	case models.RoundItemStatusSkipped:
+	default:
+		return nil, errors.New("a device can only be skipped or put back to pending")
+	}
+
+	validReason := false
+	for _, reason := range models.RoundSkipReasons {
+		if dto.SkipReason == reason {
+			validReason = true
+			break
+		}
+	}
+	if !validReason {
+		return nil, errors.New("invalid skip reason")
+	}
+	item.SkipReason = sql.NullString{String: dto.SkipReason, Valid: true}
+
+	notes := strings.TrimSpace(dto.SkipNotes)
+	if len(notes) > 255 {
+		return nil, errors.New("skip notes must be less than 255 characters")
+	}
+	if dto.SkipReason == "Other" && notes == "" {
+		return nil, errors.New("notes are required when skipping for another reason")
+	}
+	if notes != "" {
+		item.SkipNotes = sql.NullString{String: notes, Valid: true}
+	}
+
+	return item, nil
+}
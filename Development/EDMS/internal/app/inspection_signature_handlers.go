@@ -0,0 +1,378 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/storage"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// inspectionHashVersion identifies the content covered by the hash, bump it when
+// inspectionSealContent changes so older inspections are still verified the old way.
+// Version 1 hashed the inspection time as New Zealand wall clock time, from before sites
+// had their own time zone, version 2 hashes it in UTC.
+const inspectionHashVersion = 2
+
+// legacyHashTimeZone is the time zone version 1 hashed inspection times in
+const legacyHashTimeZone = "Pacific/Auckland"
+
+const maxSignatureSize = 512 << 10 // 512 KB
+
+// inspectionSealContent is the canonical form of an inspection that is hashed. IDs given
+// by the database are left out so the hash can be computed before the inspection is saved.
+type inspectionSealContent struct {
+	Version               int                   `json:"version"`
+	ClientUUID            *string               `json:"client_uuid"`
+	EmergencyDeviceID     int                   `json:"device_id"`
+	UserID                int                   `json:"user_id"`
+	InspectionDateTime    string                `json:"inspection_datetime"`
+	LegacyChecklist       []*bool               `json:"legacy_checklist"`
+	WorkOrderRequired     bool                  `json:"work_order_required"`
+	InspectionStatus      string                `json:"inspection_status"`
+	ComputedStatus        *string               `json:"computed_status"`
+	OverriddenBy          *int64                `json:"overridden_by"`
+	OverrideJustification *string               `json:"override_justification"`
+	Notes                 string                `json:"notes"`
+	ChecklistTemplateID   *int64                `json:"checklist_template_id"`
+	Responses             []responseSealContent `json:"responses"`
+	Signature             *signatureSealContent `json:"signature"`
+}
+
+type responseSealContent struct {
+	ChecklistQuestionID int      `json:"question_id"`
+	AnswerYesNo         *string  `json:"yes_no"`
+	AnswerNumber        *float64 `json:"number"`
+	AnswerText          *string  `json:"text"`
+	PhotoSHA256         *string  `json:"photo_sha256"`
+}
+
+type signatureSealContent struct {
+	SignatureType   string  `json:"type"`
+	SignedName      string  `json:"signed_name"`
+	AttestationText string  `json:"attestation"`
+	SignatureSHA256 *string `json:"image_sha256"`
+	SignedAt        string  `json:"signed_at"` // UTC
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func nullStringPtr(value sql.NullString) *string {
+	if !value.Valid {
+		return nil
+	}
+	return &value.String
+}
+
+func nullInt64Ptr(value sql.NullInt64) *int64 {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Int64
+}
+
+func nullBoolPtr(value sql.NullBool) *bool {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Bool
+}
+
+// canonicalInspectionContent returns the content of an inspection hashed by the given
+// version of the hash
+func canonicalInspectionContent(inspection *models.Inspection, responses []models.InspectionResponse, version int64) ([]byte, error) {
+	inspectionDateTime := inspection.InspectionDateTime.Time.UTC().Format("2006-01-02T15:04:05.000000Z")
+	if version == 1 {
+		legacyLocation, err := utils.LoadLocation(legacyHashTimeZone)
+		if err != nil {
+			return nil, err
+		}
+		inspectionDateTime = inspection.InspectionDateTime.Time.In(legacyLocation).Format("2006-01-02T15:04:05.000000")
+	}
+
+	content := inspectionSealContent{
+		Version:            int(version),
+		ClientUUID:         nullStringPtr(inspection.ClientUUID),
+		EmergencyDeviceID:  inspection.EmergencyDeviceID,
+		UserID:             inspection.UserID,
+		InspectionDateTime: inspectionDateTime,
+		LegacyChecklist: []*bool{
+			nullBoolPtr(inspection.IsConspicuous),
+			nullBoolPtr(inspection.IsAccessible),
+			nullBoolPtr(inspection.IsAssignedLocation),
+			nullBoolPtr(inspection.IsSignVisible),
+			nullBoolPtr(inspection.IsAntiTamperDeviceIntact),
+			nullBoolPtr(inspection.IsSupportBracketSecure),
+			nullBoolPtr(inspection.AreOperatingInstructionsClear),
+			nullBoolPtr(inspection.IsMaintenanceTagAttached),
+			nullBoolPtr(inspection.IsNoExternalDamage),
+			nullBoolPtr(inspection.IsChargeGaugeNormal),
+			nullBoolPtr(inspection.IsReplaced),
+			nullBoolPtr(inspection.AreMaintenanceRecordsComplete),
+		},
+		WorkOrderRequired:     inspection.WorkOrderRequired.Bool,
+		InspectionStatus:      inspection.InspectionStatus,
+		ComputedStatus:        nullStringPtr(inspection.ComputedStatus),
+		OverriddenBy:          nullInt64Ptr(inspection.OverriddenBy),
+		OverrideJustification: nullStringPtr(inspection.OverrideJustification),
+		Notes:                 inspection.Notes.String,
+		ChecklistTemplateID:   nullInt64Ptr(inspection.ChecklistTemplateID),
+		Responses:             []responseSealContent{},
+	}
+
+	for _, response := range responses {
+		responseContent := responseSealContent{
+			ChecklistQuestionID: response.ChecklistQuestionID,
+			AnswerYesNo:         nullStringPtr(response.AnswerYesNo),
+			AnswerText:          nullStringPtr(response.AnswerText),
+			PhotoSHA256:         nullStringPtr(response.PhotoSHA256),
+		}
+		if response.AnswerNumber.Valid {
+			number := response.AnswerNumber.Float64
+			responseContent.AnswerNumber = &number
+		}
+		if response.Photo != nil {
+			responseContent.PhotoSHA256 = nullStringPtr(response.Photo.SHA256)
+		}
+		content.Responses = append(content.Responses, responseContent)
+	}
+	sort.Slice(content.Responses, func(i, j int) bool {
+		return content.Responses[i].ChecklistQuestionID < content.Responses[j].ChecklistQuestionID
+	})
+
+	if inspection.SignatureType.Valid {
+		content.Signature = &signatureSealContent{
+			SignatureType:   inspection.SignatureType.String,
+			SignedName:      inspection.SignedName.String,
+			AttestationText: inspection.AttestationText.String,
+			SignatureSHA256: nullStringPtr(inspection.SignatureSHA256),
+			SignedAt:        inspection.SignedAt.Time.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		}
+	}
+
+	return json.Marshal(content)
+}
+
+func (a *App) inspectionHash(inspection *models.Inspection, responses []models.InspectionResponse, version int64) (string, error) {
+	content, err := canonicalInspectionContent(inspection, responses, version)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, a.SigningKey)
+	mac.Write(content)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// sealInspection sets the hash of the inspection as it is about to be saved. Times are
+// cut to the microsecond precision the database keeps so the saved copy hashes the same.
+func (a *App) sealInspection(inspection *models.Inspection, responses []models.InspectionResponse) error {
+	inspection.InspectionDateTime.Time = inspection.InspectionDateTime.Time.Truncate(time.Microsecond)
+
+	hash, err := a.inspectionHash(inspection, responses, inspectionHashVersion)
+	if err != nil {
+		return err
+	}
+
+	inspection.ContentHash = sql.NullString{String: hash, Valid: true}
+	inspection.HashVersion = sql.NullInt64{Int64: inspectionHashVersion, Valid: true}
+	return nil
+}
+
+// signInspection records the inspector's signature on a new inspection. A drawn
+// signature is saved to the store, remove it with removeSignatureImage if the
+// inspection is not saved.
+func (a *App) signInspection(c echo.Context, inspection *models.Inspection, dto *models.InspectionSignatureDto) error {
+	signedName := strings.TrimSpace(dto.SignedName)
+	if signedName == "" || len(signedName) > 100 {
+		return errors.New("please type your full name to sign the inspection")
+	}
+	if !dto.Attest {
+		return errors.New("please confirm the attestation to sign the inspection")
+	}
+
+	inspection.SignatureType = sql.NullString{}
+	inspection.SignatureKey = sql.NullString{}
+	inspection.SignatureSHA256 = sql.NullString{}
+
+	switch dto.SignatureType {
+	case models.SignatureTypeTyped:
+	case models.SignatureTypeDrawn:
+		data, err := decodeSignatureImage(dto.SignatureData)
+		if err != nil {
+			return err
+		}
+
+		key, err := newStorageKey()
+		if err != nil {
+			return err
+		}
+		key = "signatures/" + key + ".png"
+		if err := a.Store.Put(c.Request().Context(), key, bytes.NewReader(data), "image/png"); err != nil {
+			return err
+		}
+
+		inspection.SignatureKey = sql.NullString{String: key, Valid: true}
+		inspection.SignatureSHA256 = sql.NullString{String: sha256Hex(data), Valid: true}
+	default:
+		return errors.New("please draw your signature or type your name to sign the inspection")
+	}
+
+	inspection.SignatureType = sql.NullString{String: dto.SignatureType, Valid: true}
+	inspection.SignedName = sql.NullString{String: signedName, Valid: true}
+	inspection.AttestationText = sql.NullString{String: models.InspectionAttestation, Valid: true}
+	signedAt := time.Now()
+	if !dto.SignedAt.IsZero() {
+		if dto.SignedAt.After(signedAt.Add(maxSyncClockSkew)) {
+			return errors.New("the signature cannot be dated in the future")
+		}
+		signedAt = dto.SignedAt
+	}
+	inspection.SignedAt = sql.NullTime{Time: signedAt.Truncate(time.Microsecond), Valid: true}
+
+	return nil
+}
+
+// decodeSignatureImage reads a drawn signature sent as a PNG data URL or plain base64
+func decodeSignatureImage(value string) ([]byte, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "data:image/png;base64,")
+	if value == "" {
+		return nil, errors.New("please draw your signature")
+	}
+	if base64.StdEncoding.DecodedLen(len(value)) > maxSignatureSize {
+		return nil, errors.New("the signature image is too large")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || http.DetectContentType(data) != "image/png" {
+		return nil, errors.New("the signature must be a PNG image")
+	}
+
+	return data, nil
+}
+
+func (a *App) removeSignatureImage(inspection *models.Inspection) {
+	if !inspection.SignatureKey.Valid {
+		return
+	}
+	if err := a.Store.Delete(context.Background(), inspection.SignatureKey.String); err != nil && err != storage.ErrNotFound {
+		a.handleLogger("Could not remove signature " + inspection.SignatureKey.String + ": " + err.Error())
+	}
+}
+
+// HandleGetInspectionSignature returns the drawn signature of an inspection
+func (a *App) HandleGetInspectionSignature(c echo.Context) error {
+	// Check if request if a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	inspectionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid inspection ID", err)
+	}
+
+	inspection, err := a.DB.GetInspectionByID(inspectionID)
+	if err != nil {
+		return a.handleError(c, http.StatusNotFound, "Inspection not found", err)
+	}
+	if !inspection.SignatureKey.Valid {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Inspection has no drawn signature"})
+	}
+
+	file, err := a.Store.Get(c.Request().Context(), inspection.SignatureKey.String)
+	if err == storage.ErrNotFound {
+		return a.handleError(c, http.StatusNotFound, "Signature file not found", err)
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error reading signature", err)
+	}
+	defer file.Close()
+
+	header := c.Response().Header()
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Cache-Control", "private, max-age=3600")
+
+	return c.Stream(http.StatusOK, "image/png", file)
+}
+
+// HandleVerifyInspection recomputes the hash of an inspection from what is stored now and
+// compares it with the hash sealed when it was recorded, including the drawn signature image
+func (a *App) HandleVerifyInspection(c echo.Context) error {
+	// Check if request if a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	inspectionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid inspection ID", err)
+	}
+
+	inspection, err := a.DB.GetInspectionByID(inspectionID)
+	if err != nil {
+		return a.handleError(c, http.StatusNotFound, "Inspection not found", err)
+	}
+
+	verification := models.InspectionVerification{EmergencyDeviceInspectionID: inspectionID}
+	if !inspection.ContentHash.Valid {
+		verification.Message = "This inspection was recorded before inspections were sealed and cannot be verified"
+		return c.JSON(http.StatusOK, verification)
+	}
+	verification.Sealed = true
+	verification.HashVersion = inspection.HashVersion.Int64
+
+	if inspection.HashVersion.Int64 < 1 || inspection.HashVersion.Int64 > inspectionHashVersion {
+		verification.Message = "Unknown hash version"
+		return c.JSON(http.StatusOK, verification)
+	}
+
+	hash, err := a.inspectionHash(inspection, inspection.Responses, inspection.HashVersion.Int64)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error verifying inspection", err)
+	}
+	verification.ContentValid = hmac.Equal([]byte(hash), []byte(inspection.ContentHash.String))
+
+	if inspection.SignatureKey.Valid {
+		signatureValid := false
+		if file, err := a.Store.Get(c.Request().Context(), inspection.SignatureKey.String); err == nil {
+			data, err := utils.ReadLimited(file, maxSignatureSize)
+			file.Close()
+			signatureValid = err == nil && sha256Hex(data) == inspection.SignatureSHA256.String
+		} else if err != storage.ErrNotFound {
+			return a.handleError(c, http.StatusInternalServerError, "Error reading signature", err)
+		}
+		verification.SignatureValid = &signatureValid
+	}
+
+	switch {
+	case !verification.ContentValid:
+		verification.Message = "The inspection has been changed since it was recorded"
+	case verification.SignatureValid != nil && !*verification.SignatureValid:
+		verification.Message = "The signature image has been changed or is missing"
+	default:
+		verification.Message = "The inspection is unchanged since it was recorded"
+	}
+
+	if !verification.ContentValid || (verification.SignatureValid != nil && !*verification.SignatureValid) {
+		a.handleLogger("Inspection " + strconv.Itoa(inspectionID) + " failed verification: " + verification.Message)
+	}
+
+	return c.JSON(http.StatusOK, verification)
+}
@@ -0,0 +1,165 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/scheduler"
+	"github.com/labstack/echo/v4"
+)
+
+// Names of the background jobs, also used in the run history
+const (
+	jobRecomputeDeviceStatuses = "recompute-device-statuses"
+	jobGenerateNotifications   = "generate-notifications"
+	jobPurgeExpiredTokens      = "purge-expired-tokens"
+	jobSendDigests             = "send-digests"
+	jobEscalateDevices         = "escalate-devices"
+	jobDeliverWebhooks         = "deliver-webhooks"
+)
+
+// registerJobs adds the background jobs to the scheduler
+func (a *App) registerJobs() {
+	a.Scheduler.Register(scheduler.Job{
+		Name:     jobRecomputeDeviceStatuses,
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			return a.RecomputeDeviceStatuses()
+		},
+	})
+	a.Scheduler.Register(scheduler.Job{
+		Name:     jobGenerateNotifications,
+		Interval: 10 * time.Minute,
+		Run: func(ctx context.Context) error {
+			return a.GenerateNotifications()
+		},
+	})
+	a.Scheduler.Register(scheduler.Job{
+		Name:     jobEscalateDevices,
+		Interval: 15 * time.Minute,
+		Run:      a.EscalateDevices,
+	})
+	a.Scheduler.Register(scheduler.Job{
+		Name:     jobDeliverWebhooks,
+		Interval: time.Minute,
+		Run:      a.DeliverWebhooks,
+	})
+	a.Scheduler.Register(scheduler.Job{
+		Name: jobSendDigests,
+		// Each subscriber is sent one digest a day or week, checking hourly sends it
+		// soon after digestSendHour
+		Interval: time.Hour,
+		Run:      a.SendDigests,
+	})
+	a.Scheduler.Register(scheduler.Job{
+		Name:     jobPurgeExpiredTokens,
+		Interval: 24 * time.Hour,
+		Run: func(ctx context.Context) error {
+			purged, err := a.DB.PurgeExpiredTokens()
+			if err != nil {
+				return err
+			}
+			if purged > 0 {
+				a.handleLogger(fmt.Sprintf("Purged %d expired tokens", purged))
+			}
+			return nil
+		},
+	})
+}
+
+// StartJobs starts running the background jobs
+func (a *App) StartJobs() {
+	a.Scheduler.Start()
+}
+
+// StopJobs cancels the background jobs and waits for them to finish, or until ctx is done
+func (a *App) StopJobs(ctx context.Context) error {
+	return a.Scheduler.Stop(ctx)
+}
+
+// RecomputeDeviceStatuses marks devices that have expired or are due for inspection
+func (a *App) RecomputeDeviceStatuses() error {
+	updated, err := a.DB.RecomputeDeviceStatuses()
+	if err != nil {
+		return err
+	}
+	if updated > 0 {
+		a.handleLogger(fmt.Sprintf("Device statuses updated: %d", updated))
+	}
+	return nil
+}
+
+// HandleGetJobs returns the registered background jobs
+func (a *App) HandleGetJobs(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	type jobInfo struct {
+		Name     string `json:"name"`
+		Interval string `json:"interval"`
+	}
+	jobs := []jobInfo{}
+	for _, job := range a.Scheduler.Jobs() {
+		jobs = append(jobs, jobInfo{Name: job.Name, Interval: job.Interval.String()})
+	}
+
+	return c.JSON(http.StatusOK, jobs)
+}
+
+// HandleGetJobRuns returns the latest background job runs, optionally for ?job=name only
+func (a *App) HandleGetJobRuns(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	limit := 50
+	if limitStr := c.QueryParam("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 || parsed > 500 {
+			return a.handleError(c, http.StatusBadRequest, "Invalid limit", err)
+		}
+		limit = parsed
+	}
+
+	runs, err := a.DB.GetJobRuns(strings.TrimSpace(c.QueryParam("job")), limit)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	return c.JSON(http.StatusOK, runs)
+}
+
+// HandleRunJob runs a background job straight away
+func (a *App) HandleRunJob(c echo.Context) error {
+	// Check if request is a POST request
+	if c.Request().Method != http.MethodPost {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+
+	name := c.Param("name")
+	known := false
+	for _, job := range a.Scheduler.Jobs() {
+		known = known || job.Name == name
+	}
+	if !known {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Job not found"})
+	}
+
+	err := a.Scheduler.RunNow(c.Request().Context(), name)
+	if errors.Is(err, scheduler.ErrJobLocked) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Job is already running, try again once it has finished"})
+	}
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error running job", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Job run successfully"})
+}
@@ -0,0 +1,222 @@
+package app
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/labstack/echo/v4"
+)
+
+// locationChangeRequest is the body of a location tree operation, which is only
+// previewed unless Apply is set
+type locationChangeRequest struct {
+	SiteID     int    `json:"site_id"`
+	BuildingID int    `json:"building_id"`
+	FloorID    string `json:"floor_id"` // Blank for the building's lowest floor
+	RoomID     int    `json:"room_id"`  // Room merged into
+	Apply      bool   `json:"apply"`
+}
+
+// locationError returns the message of a location tree operation that cannot be done
+func locationError(c echo.Context, status int, message string) error {
+	return c.JSON(status, map[string]string{
+		"error":       message,
+		"redirectURL": "/admin?error=" + message,
+	})
+}
+
+// locationChangeResult returns the preview of a location tree operation, or the message
+// once it is applied
+func (a *App) locationChangeResult(c echo.Context, change *models.LocationChange, err error, message string) error {
+	if err == sql.ErrNoRows {
+		return locationError(c, http.StatusNotFound, "Nothing to change, reload the page and try again")
+	} else if err != nil {
+		a.handleLogger("Error changing locations: " + err.Error())
+		return locationError(c, http.StatusInternalServerError, "Error changing locations")
+	}
+
+	if !change.Applied {
+		return c.JSON(http.StatusOK, change)
+	}
+	return c.JSON(http.StatusOK, map[string]string{
+		"message":     message,
+		"redirectURL": "/admin?message=" + message,
+	})
+}
+
+// activeBuilding returns a building that is not archived, the error is the message to
+// show the user
+func (a *App) activeBuilding(buildingID int) (*models.Building, string) {
+	building, err := a.DB.GetBuildingById(buildingID)
+	if err != nil {
+		return nil, "Building does not exist"
+	}
+	if building.ArchivedAt.Valid {
+		return nil, "Building " + building.BuildingCode + " is archived"
+	}
+	return building, ""
+}
+
+// activeRoom returns a room of a building that is not archived, the error is the message
+// to show the user
+func (a *App) activeRoom(roomID int) (*models.Room, string) {
+	room, err := a.DB.GetRoomByID(roomID)
+	if err != nil {
+		return nil, "Room does not exist"
+	}
+	if _, message := a.activeBuilding(room.BuildingID); message != "" {
+		return nil, message
+	}
+	return room, ""
+}
+
+// HandleMoveRoom previews or applies moving a room, with its devices, to another
+// building
+func (a *App) HandleMoveRoom(c echo.Context) error {
+	roomID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return locationError(c, http.StatusBadRequest, "Invalid room ID")
+	}
+	var req locationChangeRequest
+	if err := c.Bind(&req); err != nil {
+		return locationError(c, http.StatusBadRequest, "Invalid request data")
+	}
+
+	room, message := a.activeRoom(roomID)
+	if message != "" {
+		return locationError(c, http.StatusNotFound, message)
+	}
+	building, message := a.activeBuilding(req.BuildingID)
+	if message != "" {
+		return locationError(c, http.StatusNotFound, message)
+	}
+	floor, err := a.roomFloor(building.BuildingID, req.FloorID)
+	if err != nil {
+		return locationError(c, http.StatusBadRequest, err.Error())
+	}
+	if floor.FloorID == room.FloorID {
+		return locationError(c, http.StatusBadRequest, "Room is already on the floor")
+	}
+
+	// Room codes are unique at a site, as in HandlePutRoom
+	existing, err := a.DB.GetRoomByCodeAndSite(room.RoomCode, building.SiteID)
+	if err == nil && existing.RoomID != room.RoomID {
+		return locationError(c, http.StatusConflict, "Room "+room.RoomCode+" already exists at the site")
+	}
+
+	change, err := a.DB.MoveRoom(room.RoomID, building.BuildingID, floor.FloorID, req.Apply)
+	return a.locationChangeResult(c, change, err, "Room moved successfully")
+}
+
+// HandleMoveBuilding previews or applies moving a building, with its floors, rooms and
+// devices, to another site
+func (a *App) HandleMoveBuilding(c echo.Context) error {
+	buildingID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return locationError(c, http.StatusBadRequest, "Invalid building ID")
+	}
+	var req locationChangeRequest
+	if err := c.Bind(&req); err != nil {
+		return locationError(c, http.StatusBadRequest, "Invalid request data")
+	}
+
+	building, message := a.activeBuilding(buildingID)
+	if message != "" {
+		return locationError(c, http.StatusNotFound, message)
+	}
+	site, err := a.DB.GetSiteByID(strconv.Itoa(req.SiteID))
+	if err != nil {
+		return locationError(c, http.StatusNotFound, "Site does not exist")
+	}
+	if site.SiteID == building.SiteID {
+		return locationError(c, http.StatusBadRequest, "Building is already at the site")
+	}
+
+	// Building codes are unique at a site, archived buildings included
+	if _, err := a.DB.GetBuildingByCodeandSite(building.BuildingCode, site.SiteID); err == nil {
+		return locationError(c, http.StatusConflict, "Building "+building.BuildingCode+" already exists at "+site.SiteName)
+	}
+
+	// Room codes are unique at a site too
+	rooms, err := a.DB.GetAllRooms(strconv.Itoa(building.BuildingID), "")
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching rooms", err)
+	}
+	siteRooms, err := a.DB.GetRoomsBySiteID(strconv.Itoa(site.SiteID))
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching rooms", err)
+	}
+	siteRoomCodes := map[string]bool{}
+	for _, room := range siteRooms {
+		siteRoomCodes[room.RoomCode] = true
+	}
+	var conflicts []string
+	for _, room := range rooms {
+		if siteRoomCodes[room.RoomCode] {
+			conflicts = append(conflicts, room.RoomCode)
+		}
+	}
+	if len(conflicts) > 0 {
+		return locationError(c, http.StatusConflict, "Rooms already exist at "+site.SiteName+": "+strings.Join(conflicts, ", "))
+	}
+
+	change, err := a.DB.MoveBuilding(building.BuildingID, site.SiteID, req.Apply)
+	return a.locationChangeResult(c, change, err, "Building moved successfully")
+}
+
+// HandleMergeRoom previews or applies merging a room into another at the same site,
+// moving its devices and deleting it
+func (a *App) HandleMergeRoom(c echo.Context) error {
+	roomID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return locationError(c, http.StatusBadRequest, "Invalid room ID")
+	}
+	var req locationChangeRequest
+	if err := c.Bind(&req); err != nil {
+		return locationError(c, http.StatusBadRequest, "Invalid request data")
+	}
+
+	room, message := a.activeRoom(roomID)
+	if message != "" {
+		return locationError(c, http.StatusNotFound, message)
+	}
+	into, message := a.activeRoom(req.RoomID)
+	if message != "" {
+		return locationError(c, http.StatusNotFound, message)
+	}
+	if into.RoomID == room.RoomID {
+		return locationError(c, http.StatusBadRequest, "Choose another room to merge into")
+	}
+
+	// Rooms are only merged within a site, as their devices would otherwise leave it
+	if room.SiteID != into.SiteID {
+		return locationError(c, http.StatusBadRequest, "Rooms can only be merged into a room at the same site")
+	}
+
+	change, err := a.DB.MergeRooms(room.RoomID, into.RoomID, req.Apply)
+	return a.locationChangeResult(c, change, err, "Rooms merged successfully")
+}
+
+// HandleArchiveBuilding previews or applies archiving a building with its rooms and
+// devices
+func (a *App) HandleArchiveBuilding(c echo.Context) error {
+	buildingID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return locationError(c, http.StatusBadRequest, "Invalid building ID")
+	}
+	var req locationChangeRequest
+	if err := c.Bind(&req); err != nil {
+		return locationError(c, http.StatusBadRequest, "Invalid request data")
+	}
+
+	building, message := a.activeBuilding(buildingID)
+	if message != "" {
+		return locationError(c, http.StatusNotFound, message)
+	}
+
+	change, err := a.DB.ArchiveBuilding(building.BuildingID, req.Apply)
+	return a.locationChangeResult(c, change, err, "Building archived successfully")
+}
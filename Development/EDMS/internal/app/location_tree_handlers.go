@@ -0,0 +1,570 @@
+package app
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/database"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// locationTreeColumns are the columns of a location tree CSV. Each row is a room, or a
+// site, building or floor with nothing under it.
+var locationTreeColumns = []string{"site_name", "site_address", "time_zone", "building_code", "floor_name", "floor_order", "room_code"}
+
+// maxLocationTreeSize is the largest location tree file that can be imported
+const maxLocationTreeSize = 5 << 20 // 5 MB
+
+// errLocationImportConflicts is returned when a location import has conflicts
+var errLocationImportConflicts = errors.New("location import has conflicts")
+
+// csvValue undoes csvSafe, for values read back from an exported CSV
+func csvValue(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) > 1 && value[0] == '\'' && csvSafe(value[1:]) == value {
+		return value[1:]
+	}
+	return value
+}
+
+// locationTreeReader builds a location tree from the rows of an import, merging the
+// rows of each site, building, floor and room. The same thing given twice with
+// different values is an error.
+type locationTreeReader struct {
+	sites     []models.LocationTreeSite
+	siteIndex map[string]int
+	buildings map[string][2]int // Site and building index, by site and building code
+	floors    map[string]int    // Floor index, by site, building code and floor name
+	rooms     map[string]int    // Room index, by site, building code and room code
+}
+
+func newLocationTreeReader() *locationTreeReader {
+	return &locationTreeReader{
+		sites:     []models.LocationTreeSite{},
+		siteIndex: map[string]int{},
+		buildings: map[string][2]int{},
+		floors:    map[string]int{},
+		rooms:     map[string]int{},
+	}
+}
+
+// mergeValue sets a value that may be given on more than one row, blank values are left
+// to the other rows
+func mergeValue(current *string, value, what string) error {
+	if value == "" || *current == value {
+		return nil
+	}
+	if *current != "" {
+		return fmt.Errorf("%s is given as both %s and %s", what, *current, value)
+	}
+	*current = value
+	return nil
+}
+
+func (r *locationTreeReader) addSite(siteName, siteAddress, timeZone string) (int, error) {
+	if siteName == "" || len(siteName) > 100 {
+		return 0, errors.New("Site name must be between 1 and 100 characters long")
+	}
+	if len(siteAddress) > 255 {
+		return 0, errors.New("Site address should be less than 255 characters")
+	}
+	if timeZone != "" {
+		if _, err := utils.LoadLocation(timeZone); err != nil {
+			return 0, fmt.Errorf("Unknown time zone %s, use a name such as Pacific/Auckland", timeZone)
+		}
+	}
+
+	i, ok := r.siteIndex[siteName]
+	if !ok {
+		i = len(r.sites)
+		r.siteIndex[siteName] = i
+		r.sites = append(r.sites, models.LocationTreeSite{SiteName: siteName, Buildings: []models.LocationTreeBuilding{}})
+	}
+	site := &r.sites[i]
+	if err := mergeValue(&site.SiteAddress, siteAddress, "Address of site "+siteName); err != nil {
+		return 0, err
+	}
+	if err := mergeValue(&site.TimeZone, timeZone, "Time zone of site "+siteName); err != nil {
+		return 0, err
+	}
+	return i, nil
+}
+
+func (r *locationTreeReader) addBuilding(siteIndex int, buildingCode string) (*models.LocationTreeBuilding, string, error) {
+	if buildingCode == "" || len(buildingCode) > 100 {
+		return nil, "", errors.New("Building codes must be between 1 and 100 characters long")
+	}
+
+	site := &r.sites[siteIndex]
+	key := site.SiteName + "\x00" + buildingCode
+	index, ok := r.buildings[key]
+	if !ok {
+		index = [2]int{siteIndex, len(site.Buildings)}
+		r.buildings[key] = index
+		site.Buildings = append(site.Buildings, models.LocationTreeBuilding{
+			BuildingCode: buildingCode,
+			Floors:       []models.LocationTreeFloor{},
+			Rooms:        []models.LocationTreeRoom{},
+		})
+	}
+	return &site.Buildings[index[1]], key, nil
+}
+
+func (r *locationTreeReader) addFloor(building *models.LocationTreeBuilding, buildingKey, floorName, floorOrder string) error {
+	floorName, order, err := parseFloorForm(floorName, floorOrder)
+	if err != nil {
+		return err
+	}
+
+	key := buildingKey + "\x00" + floorName
+	i, ok := r.floors[key]
+	if !ok {
+		i = len(building.Floors)
+		r.floors[key] = i
+		building.Floors = append(building.Floors, models.LocationTreeFloor{FloorName: floorName})
+	}
+	if !order.Valid {
+		return nil
+	}
+	floor := &building.Floors[i]
+	if floor.FloorOrder != nil && *floor.FloorOrder != int(order.Int64) {
+		return fmt.Errorf("Order of floor %s of building %s is given as both %d and %d", floorName, building.BuildingCode, *floor.FloorOrder, order.Int64)
+	}
+	value := int(order.Int64)
+	floor.FloorOrder = &value
+	return nil
+}
+
+func (r *locationTreeReader) addRoom(building *models.LocationTreeBuilding, buildingKey, roomCode, floorName string) error {
+	if len(roomCode) < 1 || len(roomCode) > 100 {
+		return errors.New("Room code must be between 1 and 100 characters long")
+	}
+	if floorName != "" {
+		if err := r.addFloor(building, buildingKey, floorName, ""); err != nil {
+			return err
+		}
+	}
+
+	key := buildingKey + "\x00" + roomCode
+	i, ok := r.rooms[key]
+	if !ok {
+		i = len(building.Rooms)
+		r.rooms[key] = i
+		building.Rooms = append(building.Rooms, models.LocationTreeRoom{RoomCode: roomCode})
+	}
+	return mergeValue(&building.Rooms[i].FloorName, floorName, "Floor of room "+roomCode)
+}
+
+// readLocationTreeCSV reads a location tree from a CSV with a header row of
+// locationTreeColumns, in any order. Only site_name is required.
+func readLocationTreeCSV(data []byte) ([]models.LocationTreeSite, error) {
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.New("CSV file is empty or could not be read")
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := columns["site_name"]; !ok {
+		return nil, errors.New("CSV file must have a header row with a site_name column")
+	}
+
+	r := newLocationTreeReader()
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := cr.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d could not be read", line)
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return csvValue(record[i])
+			}
+			return ""
+		}
+		if err := r.addCSVRow(field); err != nil {
+			return nil, fmt.Errorf("Line %d: %s", line, err.Error())
+		}
+	}
+	return r.sites, nil
+}
+
+func (r *locationTreeReader) addCSVRow(field func(name string) string) error {
+	if strings.Join([]string{field("site_name"), field("building_code"), field("floor_name"), field("room_code")}, "") == "" {
+		return nil // Blank rows are skipped
+	}
+
+	siteIndex, err := r.addSite(field("site_name"), field("site_address"), field("time_zone"))
+	if err != nil {
+		return err
+	}
+	if field("building_code") == "" {
+		if field("floor_name") != "" || field("floor_order") != "" || field("room_code") != "" {
+			return errors.New("Floors and rooms need a building code")
+		}
+		return nil
+	}
+
+	building, key, err := r.addBuilding(siteIndex, field("building_code"))
+	if err != nil {
+		return err
+	}
+	if field("floor_name") != "" {
+		if err := r.addFloor(building, key, field("floor_name"), field("floor_order")); err != nil {
+			return err
+		}
+	} else if field("floor_order") != "" {
+		return errors.New("Floor order needs a floor name")
+	}
+	if field("room_code") != "" {
+		return r.addRoom(building, key, field("room_code"), field("floor_name"))
+	}
+	return nil
+}
+
+// readLocationTreeJSON reads a location tree as it is exported, rooms may name floors
+// that are not listed
+func readLocationTreeJSON(data []byte) ([]models.LocationTreeSite, error) {
+	var tree models.LocationTree
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, errors.New("JSON file could not be read, export the location tree for an example")
+	}
+
+	r := newLocationTreeReader()
+	for _, site := range tree.Sites {
+		siteIndex, err := r.addSite(strings.TrimSpace(site.SiteName), strings.TrimSpace(site.SiteAddress), strings.TrimSpace(site.TimeZone))
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range site.Buildings {
+			building, key, err := r.addBuilding(siteIndex, strings.TrimSpace(b.BuildingCode))
+			if err != nil {
+				return nil, fmt.Errorf("Site %s: %s", site.SiteName, err.Error())
+			}
+			for _, floor := range b.Floors {
+				order := ""
+				if floor.FloorOrder != nil {
+					order = strconv.Itoa(*floor.FloorOrder)
+				}
+				if err := r.addFloor(building, key, floor.FloorName, order); err != nil {
+					return nil, fmt.Errorf("Building %s: %s", b.BuildingCode, err.Error())
+				}
+			}
+			for _, room := range b.Rooms {
+				if err := r.addRoom(building, key, strings.TrimSpace(room.RoomCode), strings.TrimSpace(room.FloorName)); err != nil {
+					return nil, fmt.Errorf("Building %s: %s", b.BuildingCode, err.Error())
+				}
+			}
+		}
+	}
+	return r.sites, nil
+}
+
+// readLocationTree reads an uploaded location tree as CSV or JSON, by its extension or
+// otherwise its content. The error is the message to show the user.
+func readLocationTree(fileName string, data []byte) ([]models.LocationTreeSite, error) {
+	var sites []models.LocationTreeSite
+	var err error
+	switch ext := strings.ToLower(filepath.Ext(fileName)); {
+	case ext == ".json", ext != ".csv" && bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")):
+		sites, err = readLocationTreeJSON(data)
+	default:
+		sites, err = readLocationTreeCSV(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(sites) == 0 {
+		return nil, errors.New("No sites were found in the file")
+	}
+	return sites, nil
+}
+
+// planLocationImport compares an imported location tree with the current one and returns
+// what importing it does. Blank addresses and time zones of the imported sites are filled
+// in from the current sites, or timeZone for new sites.
+func planLocationImport(current, sites []models.LocationTreeSite, timeZone string) *models.LocationImport {
+	existingSites := map[string]models.LocationTreeSite{}
+	existingBuildings := map[string]models.LocationTreeBuilding{}
+	existingFloors := map[string]models.LocationTreeFloor{}
+	existingRooms := map[string][2]string{} // Building code and floor name, by site and room code
+	for _, site := range current {
+		existingSites[site.SiteName] = site
+		for _, building := range site.Buildings {
+			buildingKey := site.SiteName + "\x00" + building.BuildingCode
+			existingBuildings[buildingKey] = building
+			for _, floor := range building.Floors {
+				existingFloors[buildingKey+"\x00"+floor.FloorName] = floor
+			}
+			for _, room := range building.Rooms {
+				existingRooms[site.SiteName+"\x00"+room.RoomCode] = [2]string{building.BuildingCode, room.FloorName}
+			}
+		}
+	}
+
+	result := &models.LocationImport{Rows: []models.LocationImportRow{}}
+	add := func(row models.LocationImportRow) {
+		switch row.Action {
+		case models.LocationImportCreate:
+			result.Creates++
+		case models.LocationImportUpdate:
+			result.Updates++
+		case models.LocationImportConflict:
+			result.Conflicts++
+		}
+		result.Rows = append(result.Rows, row)
+	}
+
+	for i := range sites {
+		site := &sites[i]
+		row := models.LocationImportRow{Kind: models.LocationChangeSite, SiteName: site.SiteName}
+		existing, ok := existingSites[site.SiteName]
+		if !ok {
+			if site.TimeZone == "" {
+				site.TimeZone = timeZone
+			}
+			if site.SiteAddress == "" {
+				row.Action, row.Detail = models.LocationImportConflict, "New sites need an address"
+			} else if !siteNameRegex.MatchString(site.SiteName) {
+				row.Action, row.Detail = models.LocationImportConflict, "Site name can only contain letters, numbers, spaces, hyphens, and underscores"
+			} else {
+				row.Action, row.Detail = models.LocationImportCreate, site.SiteAddress+", "+site.TimeZone
+			}
+			add(row)
+			if row.Action == models.LocationImportConflict {
+				continue
+			}
+		} else {
+			var changes []string
+			if site.SiteAddress == "" {
+				site.SiteAddress = existing.SiteAddress
+			} else if site.SiteAddress != existing.SiteAddress {
+				changes = append(changes, "Address changed from "+existing.SiteAddress+" to "+site.SiteAddress)
+			}
+			if site.TimeZone == "" {
+				site.TimeZone = existing.TimeZone
+			} else if site.TimeZone != existing.TimeZone {
+				changes = append(changes, "Time zone changed from "+existing.TimeZone+" to "+site.TimeZone)
+			}
+			if len(changes) > 0 {
+				row.Action, row.Detail = models.LocationImportUpdate, strings.Join(changes, ", ")
+				add(row)
+			} else {
+				result.Unchanged++
+			}
+		}
+
+		// Room codes are unique at a site, as in HandlePutRoom
+		importedRooms := map[string]string{}
+		for _, building := range site.Buildings {
+			buildingKey := site.SiteName + "\x00" + building.BuildingCode
+			row := models.LocationImportRow{Kind: models.LocationChangeBuilding, SiteName: site.SiteName, BuildingCode: building.BuildingCode}
+			existingBuilding, ok := existingBuildings[buildingKey]
+			switch {
+			case ok && existingBuilding.Archived:
+				row.Action, row.Detail = models.LocationImportConflict, "Building is archived"
+				add(row)
+				continue
+			case !ok:
+				row.Action = models.LocationImportCreate
+				add(row)
+			default:
+				result.Unchanged++
+			}
+
+			for _, floor := range building.Floors {
+				row := models.LocationImportRow{Kind: models.LocationChangeFloor, SiteName: site.SiteName, BuildingCode: building.BuildingCode, FloorName: floor.FloorName}
+				existingFloor, ok := existingFloors[buildingKey+"\x00"+floor.FloorName]
+				switch {
+				case !ok && floor.FloorOrder == nil:
+					row.Action, row.Detail = models.LocationImportCreate, "Above the other floors"
+					add(row)
+				case !ok:
+					row.Action, row.Detail = models.LocationImportCreate, fmt.Sprintf("Floor order %d", *floor.FloorOrder)
+					add(row)
+				case floor.FloorOrder != nil && *floor.FloorOrder != *existingFloor.FloorOrder:
+					row.Action, row.Detail = models.LocationImportUpdate, fmt.Sprintf("Floor order changed from %d to %d", *existingFloor.FloorOrder, *floor.FloorOrder)
+					add(row)
+				default:
+					result.Unchanged++
+				}
+			}
+			if len(building.Floors) == 0 && len(existingBuilding.Floors) == 0 {
+				add(models.LocationImportRow{
+					Action: models.LocationImportCreate, Kind: models.LocationChangeFloor, SiteName: site.SiteName,
+					BuildingCode: building.BuildingCode, FloorName: database.DefaultFloorName, Detail: "Default floor",
+				})
+			}
+
+			for _, room := range building.Rooms {
+				row := models.LocationImportRow{Kind: models.LocationChangeRoom, SiteName: site.SiteName, BuildingCode: building.BuildingCode, FloorName: room.FloorName, RoomCode: room.RoomCode}
+				roomKey := site.SiteName + "\x00" + room.RoomCode
+				existingRoom, ok := existingRooms[roomKey]
+				switch {
+				case ok && existingRoom[0] != building.BuildingCode:
+					row.Action, row.Detail = models.LocationImportConflict, "Room code is already used in building "+existingRoom[0]
+				case importedRooms[room.RoomCode] != "" && importedRooms[room.RoomCode] != building.BuildingCode:
+					row.Action, row.Detail = models.LocationImportConflict, "Room code is also imported in building "+importedRooms[room.RoomCode]
+				case !ok:
+					row.Action = models.LocationImportCreate
+				case room.FloorName != "" && room.FloorName != existingRoom[1]:
+					row.Action, row.Detail = models.LocationImportUpdate, "Moved from floor "+existingRoom[1]+", device pins cleared"
+				}
+				importedRooms[room.RoomCode] = building.BuildingCode
+				if row.Action == "" {
+					result.Unchanged++
+					continue
+				}
+				add(row)
+			}
+		}
+	}
+
+	return result
+}
+
+// HandleExportLocationTree downloads every site with its buildings, floors and rooms as
+// JSON, or as CSV with ?format=csv. Archived buildings are left out.
+func (a *App) HandleExportLocationTree(c echo.Context) error {
+	sites, err := a.DB.GetLocationTree()
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching locations", err)
+	}
+	for i := range sites {
+		buildings := []models.LocationTreeBuilding{}
+		for _, building := range sites[i].Buildings {
+			if !building.Archived {
+				buildings = append(buildings, building)
+			}
+		}
+		sites[i].Buildings = buildings
+	}
+
+	fileName := "locations_" + a.localNow().Format("2006-01-02")
+	res := c.Response()
+	if c.QueryParam("format") != "csv" {
+		res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", fileName+".json"))
+		return c.JSON(http.StatusOK, models.LocationTree{Sites: sites})
+	}
+
+	res.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", fileName+".csv"))
+	res.WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(res)
+	w.Write(locationTreeColumns)
+	for _, site := range sites {
+		write := func(buildingCode, floorName, floorOrder, roomCode string) {
+			w.Write([]string{
+				csvSafe(site.SiteName),
+				csvSafe(site.SiteAddress),
+				site.TimeZone,
+				csvSafe(buildingCode),
+				csvSafe(floorName),
+				floorOrder,
+				csvSafe(roomCode),
+			})
+		}
+		if len(site.Buildings) == 0 {
+			write("", "", "", "")
+		}
+		for _, building := range site.Buildings {
+			if len(building.Floors) == 0 {
+				write(building.BuildingCode, "", "", "")
+			}
+			for _, floor := range building.Floors {
+				floorOrder := strconv.Itoa(*floor.FloorOrder)
+				rooms := 0
+				for _, room := range building.Rooms {
+					if room.FloorName == floor.FloorName {
+						write(building.BuildingCode, floor.FloorName, floorOrder, room.RoomCode)
+						rooms++
+					}
+				}
+				if rooms == 0 {
+					write(building.BuildingCode, floor.FloorName, floorOrder, "")
+				}
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// HandleImportLocationTree reads an uploaded CSV or JSON location tree and returns the
+// sites, buildings, floors and rooms it creates or updates, and those it cannot import.
+// It is only applied when apply is set and there are no conflicts. Nothing is deleted,
+// and blank addresses, time zones, floor orders and room floors keep their current value.
+func (a *App) HandleImportLocationTree(c echo.Context) error {
+	invalid := func(status int, message string) error {
+		return c.JSON(status, map[string]string{
+			"error":       message,
+			"redirectURL": "/admin?error=" + message,
+		})
+	}
+
+	file, header, err := c.Request().FormFile("locationTreeFile")
+	if err != nil {
+		return invalid(http.StatusBadRequest, "Please choose a CSV or JSON file")
+	}
+	defer file.Close()
+
+	data, err := utils.ReadLimited(file, maxLocationTreeSize)
+	if err != nil {
+		return invalid(http.StatusBadRequest, "File must be no larger than 5 MB")
+	}
+	sites, err := readLocationTree(header.Filename, data)
+	if err != nil {
+		return invalid(http.StatusBadRequest, err.Error())
+	}
+
+	if c.FormValue("apply") != "true" {
+		current, err := a.DB.GetLocationTree()
+		if err != nil {
+			a.handleLogger("Error comparing location tree: " + err.Error())
+			return invalid(http.StatusInternalServerError, "Error fetching locations")
+		}
+		return c.JSON(http.StatusOK, planLocationImport(current, sites, a.Location.String()))
+	}
+
+	// The import is planned again as it is applied, in case the locations have changed
+	// since the dry run
+	var result *models.LocationImport
+	err = a.DB.ApplyLocationImport(sites, func(current []models.LocationTreeSite) error {
+		result = planLocationImport(current, sites, a.Location.String())
+		if result.Conflicts > 0 {
+			return errLocationImportConflicts
+		}
+		return nil
+	})
+	if errors.Is(err, errLocationImportConflicts) {
+		return invalid(http.StatusConflict, "Resolve the conflicts before importing")
+	} else if err != nil {
+		a.handleLogger("Error importing location tree: " + err.Error())
+		return invalid(http.StatusInternalServerError, "Error importing locations")
+	}
+
+	message := fmt.Sprintf("Locations imported successfully, %d created and %d updated", result.Creates, result.Updates)
+	return c.JSON(http.StatusOK, map[string]string{
+		"message":     message,
+		"redirectURL": "/admin?message=" + message,
+	})
+}
@@ -0,0 +1,174 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadLocationTreeCSV(t *testing.T) {
+	data := "\ufeffRoom_Code,site_name,building_code,floor_name,floor_order,site_address,time_zone\n" +
+		"J101,Taradale,J,Ground,0,501 Gloucester Street,Pacific/Auckland\n" +
+		"J201,Taradale,J,Level 1,1,,\n" +
+		",,,,,,\n" +
+		"'=1+1,Taradale,'-K,,,,\n" +
+		",Napier,,,,1 Main Road,\n"
+
+	sites, err := readLocationTreeCSV([]byte(data))
+	require.NoError(t, err)
+	require.Len(t, sites, 2)
+
+	// Rows of the same site are merged, blank values are left to the other rows
+	taradale := sites[0]
+	assert.Equal(t, "Taradale", taradale.SiteName)
+	assert.Equal(t, "501 Gloucester Street", taradale.SiteAddress)
+	assert.Equal(t, "Pacific/Auckland", taradale.TimeZone)
+	require.Len(t, taradale.Buildings, 2)
+
+	j := taradale.Buildings[0]
+	assert.Equal(t, "J", j.BuildingCode)
+	require.Len(t, j.Floors, 2)
+	assert.Equal(t, "Ground", j.Floors[0].FloorName)
+	require.NotNil(t, j.Floors[1].FloorOrder)
+	assert.Equal(t, 1, *j.Floors[1].FloorOrder)
+	assert.Equal(t, []models.LocationTreeRoom{
+		{RoomCode: "J101", FloorName: "Ground"},
+		{RoomCode: "J201", FloorName: "Level 1"},
+	}, j.Rooms)
+
+	// Values escaped by csvSafe are read back as they were
+	k := taradale.Buildings[1]
+	assert.Equal(t, "-K", k.BuildingCode)
+	assert.Equal(t, []models.LocationTreeRoom{{RoomCode: "=1+1"}}, k.Rooms)
+
+	assert.Equal(t, "Napier", sites[1].SiteName)
+	assert.Equal(t, "1 Main Road", sites[1].SiteAddress)
+	assert.Empty(t, sites[1].Buildings)
+}
+
+func TestReadLocationTreeCSVErrors(t *testing.T) {
+	tests := map[string]struct {
+		data string
+		err  string
+	}{
+		"no site_name column": {
+			data: "building_code\nJ\n",
+			err:  "CSV file must have a header row with a site_name column",
+		},
+		"address given twice": {
+			data: "site_name,site_address\nTaradale,1 Main Road\nTaradale,2 Main Road\n",
+			err:  "Line 3: Address of site Taradale is given as both 1 Main Road and 2 Main Road",
+		},
+		"room without building": {
+			data: "site_name,room_code\nTaradale,J101\n",
+			err:  "Line 2: Floors and rooms need a building code",
+		},
+		"floor order without floor": {
+			data: "site_name,building_code,floor_order\nTaradale,J,1\n",
+			err:  "Line 2: Floor order needs a floor name",
+		},
+		"unknown time zone": {
+			data: "site_name,time_zone\nTaradale,Mars/Olympus\n",
+			err:  "Line 2: Unknown time zone Mars/Olympus, use a name such as Pacific/Auckland",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := readLocationTreeCSV([]byte(test.data))
+			assert.EqualError(t, err, test.err)
+		})
+	}
+}
+
+func TestReadLocationTreeJSON(t *testing.T) {
+	data := `{"sites": [{
+		"site_name": " Taradale ",
+		"site_address": "501 Gloucester Street",
+		"buildings": [{
+			"building_code": "J",
+			"floors": [{"floor_name": "Ground", "floor_order": 0}],
+			"rooms": [{"room_code": "J101", "floor_name": "Ground"}, {"room_code": "J201", "floor_name": "Level 1"}]
+		}]
+	}]}`
+
+	sites, err := readLocationTreeJSON([]byte(data))
+	require.NoError(t, err)
+	require.Len(t, sites, 1)
+	assert.Equal(t, "Taradale", sites[0].SiteName)
+	require.Len(t, sites[0].Buildings, 1)
+
+	// Rooms may name floors that are not listed
+	j := sites[0].Buildings[0]
+	require.Len(t, j.Floors, 2)
+	assert.Equal(t, "Level 1", j.Floors[1].FloorName)
+	assert.Nil(t, j.Floors[1].FloorOrder)
+	assert.Len(t, j.Rooms, 2)
+
+	_, err = readLocationTreeJSON([]byte(`{"sites": [{"site_name": "Taradale", "buildings": [{"building_code": ""}]}]}`))
+	assert.EqualError(t, err, "Site Taradale: Building codes must be between 1 and 100 characters long")
+
+	_, err = readLocationTreeJSON([]byte(`site_name`))
+	assert.Error(t, err)
+}
+
+func TestCSVValueUndoesCSVSafe(t *testing.T) {
+	for _, value := range []string{"J101", "=SUM(A1:A2)", "+64", "-1", "@here", "\tx", "'quoted", "'=x", "''=x", "'", "''"} {
+		assert.Equal(t, value, csvValue(csvSafe(value)), "value %q", value)
+	}
+}
+
+func TestPlanLocationImport(t *testing.T) {
+	ground := 0
+	current := []models.LocationTreeSite{{
+		SiteName:    "Taradale",
+		SiteAddress: "501 Gloucester Street",
+		TimeZone:    "Pacific/Auckland",
+		Buildings: []models.LocationTreeBuilding{
+			{
+				BuildingCode: "J",
+				Floors:       []models.LocationTreeFloor{{FloorName: "Ground", FloorOrder: &ground}},
+				Rooms:        []models.LocationTreeRoom{{RoomCode: "J101", FloorName: "Ground"}},
+			},
+			{BuildingCode: "OLD", Archived: true},
+		},
+	}}
+	sites := []models.LocationTreeSite{
+		{SiteName: "Taradale", Buildings: []models.LocationTreeBuilding{
+			{BuildingCode: "J", Rooms: []models.LocationTreeRoom{{RoomCode: "J101"}}},
+			{BuildingCode: "K", Rooms: []models.LocationTreeRoom{{RoomCode: "J101"}, {RoomCode: "K1"}}},
+			{BuildingCode: "L", Rooms: []models.LocationTreeRoom{{RoomCode: "K1"}}},
+			{BuildingCode: "OLD"},
+		}},
+		{SiteName: "Hastings"},
+		{SiteName: "Napier/Central", SiteAddress: "1 Main Road"},
+		{SiteName: "Napier", SiteAddress: "1 Main Road"},
+	}
+
+	result := planLocationImport(current, sites, "Pacific/Chatham")
+
+	conflicts := map[string]string{}
+	for _, row := range result.Rows {
+		if row.Action == models.LocationImportConflict {
+			conflicts[row.Kind+" "+row.SiteName+" "+row.BuildingCode+" "+row.RoomCode] = row.Detail
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"room Taradale K J101":   "Room code is already used in building J",
+		"room Taradale L K1":     "Room code is also imported in building K",
+		"building Taradale OLD ": "Building is archived",
+		"site Hastings  ":        "New sites need an address",
+		"site Napier/Central  ":  "Site name can only contain letters, numbers, spaces, hyphens, and underscores",
+	}, conflicts)
+	assert.Equal(t, len(conflicts), result.Conflicts)
+
+	// Blank values are filled in from the current site, or the given time zone
+	assert.Equal(t, "501 Gloucester Street", sites[0].SiteAddress)
+	assert.Equal(t, "Pacific/Auckland", sites[0].TimeZone)
+	assert.Equal(t, "Pacific/Chatham", sites[3].TimeZone)
+
+	// Site Napier, buildings K and L with their default floors and room K1 of building K
+	assert.Equal(t, 6, result.Creates)
+	assert.Equal(t, 0, result.Updates)
+}
@@ -0,0 +1,16 @@
+package app
+
+import (
+	"errors"
+
+	gomail "gopkg.in/mail.v2"
+)
+
+// sendEmail sends a message from the app's address through the configured mail server
+func (a *App) sendEmail(m *gomail.Message) error {
+	if a.Mailer == nil {
+		return errors.New("email is not configured, set SMTP_USERNAME and SMTP_PASSWORD")
+	}
+	m.SetHeader("From", a.MailFrom)
+	return a.Mailer.DialAndSend(m)
+}
@@ -0,0 +1,192 @@
+package app
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/labstack/echo/v4"
+)
+
+var catalogNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_ .&/-]{1,100}$`)
+
+func (a *App) HandleGetAllManufacturers(c echo.Context) error {
+	// Check if request if a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	manufacturers, err := a.DB.GetAllManufacturers()
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	// Return the results as JSON
+	return c.JSON(http.StatusOK, manufacturers)
+}
+
+func (a *App) HandlePostManufacturer(c echo.Context) error {
+	// Check if request is not a post request
+	if c.Request().Method != http.MethodPost {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Method not allowed")
+	}
+
+	manufacturerName := strings.TrimSpace(c.FormValue("manufacturer_name"))
+	a.handleLogger("Manufacturer Name: " + manufacturerName)
+
+	// Validate manufacturer name
+	if !catalogNameRegex.MatchString(manufacturerName) {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Manufacturer Name must be between 1 and 100 characters long")
+	}
+
+	// Check manufacturer name is unique
+	if _, err := a.DB.GetManufacturerByName(manufacturerName); err == nil {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Manufacturer Name already exists")
+	}
+
+	err := a.DB.AddManufacturer(manufacturerName)
+	if err != nil {
+		a.handleLogger("Error adding Manufacturer: " + err.Error())
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Error adding manufacturer")
+	}
+
+	return c.Redirect(http.StatusFound, "/admin?message=Manufacturer added successfully")
+}
+
+func (a *App) HandleDeleteManufacturer(c echo.Context) error {
+	// Check if request is not a delete request
+	if c.Request().Method != http.MethodDelete {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{
+			"error":       "Method not allowed",
+			"redirectURL": "/admin?error=Method not allowed",
+		})
+	}
+
+	manufacturerID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Invalid manufacturer ID",
+			"redirectURL": "/admin?error=Invalid manufacturer ID",
+		})
+	}
+
+	// Check if the manufacturer has any models
+	deviceModels, err := a.DB.GetAllDeviceModels(strconv.Itoa(manufacturerID))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error":       "Error fetching device models",
+			"redirectURL": "/admin?error=Error fetching device models",
+		})
+	}
+
+	if len(deviceModels) > 0 {
+		return c.JSON(http.StatusOK, map[string]string{
+			"error":       "Cannot delete manufacturer with associated models",
+			"redirectURL": "/admin?error=Cannot delete manufacturer with associated models",
+		})
+	}
+
+	err = a.DB.DeleteManufacturer(manufacturerID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error":       "Error deleting manufacturer",
+			"redirectURL": "/admin?error=Error deleting manufacturer",
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message":     "Manufacturer deleted successfully",
+		"redirectURL": "/admin?message=Manufacturer deleted successfully",
+	})
+}
+
+func (a *App) HandleGetAllDeviceModels(c echo.Context) error {
+	// Check if request if a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	manufacturerId := c.QueryParam("manufacturer_id")
+	deviceModels, err := a.DB.GetAllDeviceModels(manufacturerId)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	// Return an empty list rather than null so the model dropdown can be populated
+	if deviceModels == nil {
+		deviceModels = []models.DeviceModel{}
+	}
+
+	// Return the results as JSON
+	return c.JSON(http.StatusOK, deviceModels)
+}
+
+func (a *App) HandlePostDeviceModel(c echo.Context) error {
+	// Check if request is not a post request
+	if c.Request().Method != http.MethodPost {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Method not allowed")
+	}
+
+	manufacturerIDStr := c.FormValue("manufacturer_id")
+	modelName := strings.TrimSpace(c.FormValue("model_name"))
+	a.handleLogger("Manufacturer ID: " + manufacturerIDStr)
+	a.handleLogger("Model Name: " + modelName)
+
+	manufacturerID, err := strconv.Atoi(manufacturerIDStr)
+	if err != nil {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Invalid manufacturer ID")
+	}
+
+	// Validate model name
+	if !catalogNameRegex.MatchString(modelName) {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Model Name must be between 1 and 100 characters long")
+	}
+
+	deviceModel := &models.DeviceModel{
+		ManufacturerID: manufacturerID,
+		ModelName:      modelName,
+	}
+
+	err = a.DB.AddDeviceModel(deviceModel)
+	if err != nil {
+		a.handleLogger("Error adding Device Model: " + err.Error())
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Error adding device model")
+	}
+
+	return c.Redirect(http.StatusFound, "/admin?message=Device Model added successfully")
+}
+
+func (a *App) HandleDeleteDeviceModel(c echo.Context) error {
+	// Check if request is not a delete request
+	if c.Request().Method != http.MethodDelete {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{
+			"error":       "Method not allowed",
+			"redirectURL": "/admin?error=Method not allowed",
+		})
+	}
+
+	deviceModelID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Invalid device model ID",
+			"redirectURL": "/admin?error=Invalid device model ID",
+		})
+	}
+
+	// Devices keep their record but lose the model link (ON DELETE SET NULL),
+	// recalls against the model block the delete (ON DELETE RESTRICT)
+	err = a.DB.DeleteDeviceModel(deviceModelID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error":       "Error deleting device model",
+			"redirectURL": "/admin?error=Error deleting device model",
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message":     "Device Model deleted successfully",
+		"redirectURL": "/admin?message=Device Model deleted successfully",
+	})
+}
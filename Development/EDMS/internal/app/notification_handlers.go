@@ -0,0 +1,238 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/scheduler"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// Devices due or expiring within this many days are notified in advance
+const notificationLeadDays = 30
+
+// GenerateNotifications raises a notification for every device that needs attention and
+// resolves those that no longer do
+func (a *App) GenerateNotifications() error {
+	devices, err := a.DB.GetAllDevices("", "")
+	if err != nil {
+		return err
+	}
+
+	created, resolved, err := a.DB.SyncNotifications(deviceNotifications(devices, a.localNow()))
+	if err != nil {
+		return err
+	}
+	if created > 0 || resolved > 0 {
+		a.handleLogger(fmt.Sprintf("Notifications generated: %d created, %d resolved", created, resolved))
+	}
+
+	return nil
+}
+
+// deviceNotifications returns the most urgent condition of each device on the current
+// day at its site. Due and expiry dates come from the same calculation as the device list.
+func deviceNotifications(devices []models.EmergencyDevice, now time.Time) []models.Notification {
+	notifications := []models.Notification{}
+	for _, device := range devices {
+		notification := models.Notification{EmergencyDeviceID: device.EmergencyDeviceID}
+		today := civilDate(utils.InLocation(now, device.SiteTimeZone))
+		leadDate := today.AddDate(0, 0, notificationLeadDays)
+
+		var expiry, nextInspection time.Time
+		if device.ExpireDate.Valid {
+			expiry = civilDate(device.ExpireDate.Time)
+		}
+		if device.NextInspectionDate.Valid {
+			nextInspection = civilDate(device.NextInspectionDate.Time)
+		}
+
+		switch {
+		case device.Status.String == "Inactive":
+			continue
+		case device.Status.String == "Recalled":
+			notification.NotificationType = models.NotificationTypeRecalled
+		case device.Status.String == "Inspection Failed":
+			notification.NotificationType = models.NotificationTypeInspectionFailed
+		case !expiry.IsZero() && !expiry.After(today):
+			notification.NotificationType = models.NotificationTypeExpired
+			notification.ReferenceDate = sql.NullTime{Time: expiry, Valid: true}
+		case !nextInspection.IsZero() && !nextInspection.After(today):
+			notification.NotificationType = models.NotificationTypeInspectionOverdue
+			notification.ReferenceDate = sql.NullTime{Time: nextInspection, Valid: true}
+		case !expiry.IsZero() && !expiry.After(leadDate):
+			notification.NotificationType = models.NotificationTypeExpiringSoon
+			notification.ReferenceDate = sql.NullTime{Time: expiry, Valid: true}
+		case !nextInspection.IsZero() && !nextInspection.After(leadDate):
+			notification.NotificationType = models.NotificationTypeInspectionDue
+			notification.ReferenceDate = sql.NullTime{Time: nextInspection, Valid: true}
+		default:
+			continue
+		}
+
+		notifications = append(notifications, notification)
+	}
+
+	return notifications
+}
+
+// civilDate drops the time of day, keeping the date as it was written
+func civilDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// HandleGetNotifications returns the logged in user's notifications, most urgent first.
+// Dismissed notifications are only included with ?include_dismissed=true.
+func (a *App) HandleGetNotifications(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	userID, _, err := currentUser(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	notifications, err := a.DB.GetNotificationsForUser(userID, c.QueryParam("include_dismissed") == "true")
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	now := time.Now()
+	for i := range notifications {
+		if !notifications[i].ReferenceDate.Valid {
+			continue
+		}
+		today := civilDate(now.In(a.siteLocation(notifications[i].SiteTimeZone)))
+		days := int(today.Sub(civilDate(notifications[i].ReferenceDate.Time)).Hours() / 24)
+		if days < 0 {
+			days = -days
+		}
+		notifications[i].Days = days
+	}
+
+	// Return the results as JSON
+	return c.JSON(http.StatusOK, notifications)
+}
+
+// HandleGetNotificationCount returns the number of notifications for the navbar
+func (a *App) HandleGetNotificationCount(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	userID, _, err := currentUser(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	count, err := a.DB.GetNotificationCount(userID)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	return c.JSON(http.StatusOK, count)
+}
+
+// HandleReadNotification marks a notification as read by the logged in user
+func (a *App) HandleReadNotification(c echo.Context) error {
+	return a.updateNotificationState(c, false)
+}
+
+// HandleDismissNotification hides a notification from the logged in user
+func (a *App) HandleDismissNotification(c echo.Context) error {
+	return a.updateNotificationState(c, true)
+}
+
+func (a *App) updateNotificationState(c echo.Context, dismiss bool) error {
+	// Check if request is a PUT request
+	if c.Request().Method != http.MethodPut {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+
+	userID, _, err := currentUser(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	notificationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid notification ID", err)
+	}
+
+	if dismiss {
+		err = a.DB.DismissNotification(notificationID, userID)
+	} else {
+		err = a.DB.MarkNotificationRead(notificationID, userID)
+	}
+	if err == sql.ErrNoRows {
+		return a.handleError(c, http.StatusNotFound, "Notification not found", err)
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error updating notification", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Notification updated successfully"})
+}
+
+// HandleReadAllNotifications marks every notification as read by the logged in user
+func (a *App) HandleReadAllNotifications(c echo.Context) error {
+	return a.updateAllNotificationsState(c, false)
+}
+
+// HandleDismissAllNotifications hides every current notification from the logged in user
+func (a *App) HandleDismissAllNotifications(c echo.Context) error {
+	return a.updateAllNotificationsState(c, true)
+}
+
+func (a *App) updateAllNotificationsState(c echo.Context, dismiss bool) error {
+	// Check if request is a POST request
+	if c.Request().Method != http.MethodPost {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+
+	userID, _, err := currentUser(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	if dismiss {
+		err = a.DB.DismissAllNotifications(userID)
+	} else {
+		err = a.DB.MarkAllNotificationsRead(userID)
+	}
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error updating notifications", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Notifications updated successfully"})
+}
+
+// HandleGenerateNotifications regenerates notifications straight away, for example
+// after devices were imported. It runs the scheduled jobs so it never runs alongside them.
+func (a *App) HandleGenerateNotifications(c echo.Context) error {
+	// Check if request is a POST request
+	if c.Request().Method != http.MethodPost {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+
+	// Bring device statuses up to date first so the notifications match them
+	for _, job := range []string{jobRecomputeDeviceStatuses, jobGenerateNotifications} {
+		err := a.Scheduler.RunNow(c.Request().Context(), job)
+		if errors.Is(err, scheduler.ErrJobLocked) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Notifications are already being generated, try again once it has finished"})
+		}
+		if err != nil {
+			return a.handleError(c, http.StatusInternalServerError, "Error generating notifications", err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Notifications generated successfully"})
+}
@@ -0,0 +1,232 @@
+package app
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/labstack/echo/v4"
+)
+
+func (a *App) HandleGetAllRecalls(c echo.Context) error {
+	// Check if request if a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	recalls, err := a.DB.GetAllRecalls()
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	// Return the results as JSON
+	return c.JSON(http.StatusOK, recalls)
+}
+
+// HandleGetRecallDevices lists the devices flagged by a recall
+func (a *App) HandleGetRecallDevices(c echo.Context) error {
+	// Check if request if a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	recallID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid recall ID", err)
+	}
+
+	deviceRecalls, err := a.DB.GetDevicesByRecallID(recallID)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	// Return the results as JSON
+	return c.JSON(http.StatusOK, deviceRecalls)
+}
+
+// HandlePostRecall registers a recall and flags every matching device
+func (a *App) HandlePostRecall(c echo.Context) error {
+	// Check if request is not a post request
+	if c.Request().Method != http.MethodPost {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{
+			"error":       "Method not allowed",
+			"redirectURL": "/admin?error=Method not allowed",
+		})
+	}
+
+	var recallDto models.RecallDto
+	if err := c.Bind(&recallDto); err != nil {
+		a.handleLogger("Error binding request body: " + err.Error())
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Invalid request body",
+			"redirectURL": "/admin?error=Invalid request body",
+		})
+	}
+
+	recall, err := a.validateRecall(&recallDto)
+	if err != nil {
+		a.handleLogger("Error validating recall: " + err.Error())
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Error validating recall: " + err.Error(),
+			"redirectURL": "/admin?error=" + err.Error(),
+		})
+	}
+
+	recallID, err := a.DB.AddRecall(recall)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error saving recall", err)
+	}
+
+	flaggedDeviceIDs, err := a.DB.FlagRecalledDevices(recallID)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error flagging recalled devices", err)
+	}
+
+	a.handleLogger(fmt.Sprintf("Recall %d registered, %d device(s) flagged: %v", recallID, len(flaggedDeviceIDs), flaggedDeviceIDs))
+
+	message := fmt.Sprintf("Recall added successfully, %d device(s) flagged", len(flaggedDeviceIDs))
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":         message,
+		"recall_id":       recallID,
+		"flagged_devices": flaggedDeviceIDs,
+		"redirectURL":     "/admin?message=" + message,
+	})
+}
+
+// HandleCloseRecall stops a recall from flagging further devices
+func (a *App) HandleCloseRecall(c echo.Context) error {
+	// Check if request is not a put request
+	if c.Request().Method != http.MethodPut {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{
+			"error":       "Method not allowed",
+			"redirectURL": "/admin?error=Method not allowed",
+		})
+	}
+
+	recallID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Invalid recall ID",
+			"redirectURL": "/admin?error=Invalid recall ID",
+		})
+	}
+
+	err = a.DB.CloseRecall(recallID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error":       "Error closing recall",
+			"redirectURL": "/admin?error=Error closing recall",
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message":     "Recall closed successfully",
+		"redirectURL": "/admin?message=Recall closed successfully",
+	})
+}
+
+// HandleResolveDeviceRecall records that the recall action has been carried out on a device
+func (a *App) HandleResolveDeviceRecall(c echo.Context) error {
+	// Check if request is not a put request
+	if c.Request().Method != http.MethodPut {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{
+			"error":       "Method not allowed",
+			"redirectURL": "/dashboard?error=Method not allowed",
+		})
+	}
+
+	recallID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Invalid recall ID",
+			"redirectURL": "/dashboard?error=Invalid recall ID",
+		})
+	}
+
+	deviceID, err := strconv.Atoi(c.Param("deviceId"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Invalid device ID",
+			"redirectURL": "/dashboard?error=Invalid device ID",
+		})
+	}
+
+	err = a.DB.ResolveDeviceRecall(deviceID, recallID)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error":       "Device has no open flag for this recall",
+			"redirectURL": "/dashboard?error=Device has no open flag for this recall",
+		})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error":       "Error resolving recall",
+			"redirectURL": "/dashboard?error=Error resolving recall",
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message":     "Recall resolved for device",
+		"redirectURL": "/dashboard?message=Recall resolved for device",
+	})
+}
+
+func (a *App) validateRecall(dto *models.RecallDto) (*models.Recall, error) {
+	var recall models.Recall
+
+	manufacturerID, err := strconv.Atoi(dto.ManufacturerID)
+	if err != nil {
+		return nil, fmt.Errorf("manufacturer is required")
+	}
+	recall.ManufacturerID = manufacturerID
+
+	if dto.DeviceModelID != "" {
+		deviceModelID, err := strconv.Atoi(dto.DeviceModelID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid device model ID")
+		}
+		deviceModel, err := a.DB.GetDeviceModelByID(deviceModelID)
+		if err != nil {
+			return nil, fmt.Errorf("device model does not exist")
+		}
+		if deviceModel.ManufacturerID != manufacturerID {
+			return nil, fmt.Errorf("device model does not belong to the manufacturer")
+		}
+		recall.DeviceModelID = sql.NullInt64{Int64: int64(deviceModelID), Valid: true}
+	}
+
+	serialFrom := strings.TrimSpace(dto.SerialNumberFrom)
+	serialTo := strings.TrimSpace(dto.SerialNumberTo)
+	batchNumber := strings.TrimSpace(dto.BatchNumber)
+	if len(serialFrom) > 50 || len(serialTo) > 50 || len(batchNumber) > 50 {
+		return nil, fmt.Errorf("serial numbers and batch number must be 50 characters or less")
+	}
+	recall.SerialNumberFrom = sql.NullString{String: serialFrom, Valid: serialFrom != ""}
+	recall.SerialNumberTo = sql.NullString{String: serialTo, Valid: serialTo != ""}
+	recall.BatchNumber = sql.NullString{String: batchNumber, Valid: batchNumber != ""}
+
+	// A recall must be narrower than the whole manufacturer
+	if !recall.DeviceModelID.Valid && !recall.SerialNumberFrom.Valid && !recall.SerialNumberTo.Valid && !recall.BatchNumber.Valid {
+		return nil, fmt.Errorf("a model, serial number range or batch number is required")
+	}
+
+	recallDate, err := parseDate(dto.RecallDate)
+	if err != nil || !recallDate.Valid {
+		return nil, fmt.Errorf("invalid recall date")
+	}
+	if recallDate.Time.After(time.Now()) {
+		return nil, fmt.Errorf("recall date cannot be in the future")
+	}
+	recall.RecallDate = recallDate
+
+	actionRequired := strings.TrimSpace(dto.ActionRequired)
+	if actionRequired == "" || len(actionRequired) > 255 {
+		return nil, fmt.Errorf("action required must be between 1 and 255 characters")
+	}
+	recall.ActionRequired = actionRequired
+
+	return &recall, nil
+}
@@ -0,0 +1,385 @@
+package app
+
+import (
+	"database/sql"
+	"fmt"
+	"image/png"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/pdf"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	reportDateFormat     = "2 January 2006"
+	reportDateTimeFormat = "2 January 2006 3:04 PM"
+)
+
+// HandleGetInspectionCertificate returns a PDF certificate of a single inspection with
+// the device, its location, the checklist answers and the inspector's signature
+func (a *App) HandleGetInspectionCertificate(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	inspectionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid inspection ID", err)
+	}
+
+	inspection, err := a.DB.GetInspectionByID(inspectionID)
+	if err == sql.ErrNoRows {
+		return a.handleError(c, http.StatusNotFound, "Inspection not found", err)
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	device, err := a.DB.GetDeviceByID(inspection.EmergencyDeviceID)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	doc := pdf.New(fmt.Sprintf("Inspection Certificate #%d", inspection.EmergencyDeviceInspectionID), reportFooter(a.siteLocation(inspection.SiteTimeZone)))
+	doc.Title("Inspection Certificate")
+	doc.Field("Certificate", fmt.Sprintf("Inspection #%d", inspection.EmergencyDeviceInspectionID))
+	doc.Field("Result", inspection.InspectionStatus)
+	if inspection.RevisionAction.String == "Void" {
+		doc.Field("Revision", "This inspection has been voided and is no longer valid")
+	} else if inspection.RevisionAction.Valid {
+		doc.Field("Revision", fmt.Sprintf("This inspection has been amended, see inspection #%d", inspection.ReplacedByID.Int64))
+	} else if inspection.AmendsInspectionID.Valid {
+		doc.Field("Revision", fmt.Sprintf("Amends inspection #%d", inspection.AmendsInspectionID.Int64))
+	}
+
+	doc.Heading("Device")
+	reportDeviceFields(doc, device)
+
+	doc.Heading("Inspection")
+	doc.Field("Inspected", formatReportDateTime(inspection.InspectionDateTime))
+	doc.Field("Recorded", formatReportDateTime(inspection.CreatedAt))
+	doc.Field("Inspector", inspection.InspectorName)
+	doc.Field("Work Order Required", yesNo(inspection.WorkOrderRequired.Valid && inspection.WorkOrderRequired.Bool))
+	if inspection.OverrideJustification.Valid {
+		doc.Field("Status Override", fmt.Sprintf("Calculated as %s, overridden by %s: %s",
+			inspection.ComputedStatus.String, inspection.OverriddenByName.String, inspection.OverrideJustification.String))
+	}
+	doc.Field("Notes", reportString(inspection.Notes))
+
+	doc.Heading("Checklist")
+	if len(inspection.Responses) == 0 {
+		doc.Paragraph("No checklist answers were recorded for this inspection.")
+	} else {
+		if inspection.ChecklistTemplateName.Valid {
+			doc.Paragraph(inspection.ChecklistTemplateName.String)
+		}
+		rows := make([][]string, 0, len(inspection.Responses))
+		for _, response := range inspection.Responses {
+			rows = append(rows, []string{response.QuestionText, response.Severity, reportAnswer(response)})
+		}
+		doc.Table([]pdf.Column{
+			{Title: "Question", Width: 255},
+			{Title: "Severity", Width: 70},
+			{Title: "Answer", Width: pdf.ContentWidth - 325},
+		}, rows)
+	}
+
+	doc.Heading("Signature")
+	a.reportSignature(c, doc, inspection)
+
+	if inspection.ContentHash.Valid {
+		doc.Note(fmt.Sprintf("Content hash (v%d): %s. The recorded inspection can be checked against this hash in EDMS.",
+			inspection.HashVersion.Int64, inspection.ContentHash.String))
+	}
+
+	return sendPDF(c, fmt.Sprintf("inspection-certificate-%d.pdf", inspection.EmergencyDeviceInspectionID), doc)
+}
+
+// HandleGetDeviceInspectionReport returns a PDF of a device with every inspection made of it
+func (a *App) HandleGetDeviceInspectionReport(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	deviceID, err := strconv.Atoi(c.QueryParam("device_id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid device ID", err)
+	}
+
+	device, err := a.DB.GetDeviceByID(deviceID)
+	if err == sql.ErrNoRows {
+		return a.handleError(c, http.StatusNotFound, "Device not found", err)
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	inspections, err := a.DB.GetAllInspectionsByDeviceID(deviceID)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	doc := pdf.New(fmt.Sprintf("Device History - %s", reportString(device.SerialNumber)), reportFooter(a.siteLocation(device.SiteTimeZone)))
+	doc.Title("Device Inspection History")
+
+	doc.Heading("Device")
+	reportDeviceFields(doc, device)
+
+	doc.Heading("Inspections")
+	if len(inspections) == 0 {
+		doc.Paragraph("This device has not been inspected.")
+	} else {
+		rows := make([][]string, 0, len(inspections))
+		for _, inspection := range inspections {
+			result := inspection.InspectionStatus
+			switch {
+			case inspection.RevisionAction.String == "Void":
+				result += " (voided)"
+			case inspection.RevisionAction.Valid:
+				result += fmt.Sprintf(" (amended by #%d)", inspection.ReplacedByID.Int64)
+			}
+			rows = append(rows, []string{
+				strconv.Itoa(inspection.EmergencyDeviceInspectionID),
+				formatReportDateTime(inspection.InspectionDateTime),
+				inspection.InspectorName,
+				result,
+				yesNo(inspection.WorkOrderRequired.Valid && inspection.WorkOrderRequired.Bool),
+				reportString(inspection.Notes),
+			})
+		}
+		doc.Table([]pdf.Column{
+			{Title: "#", Width: 35},
+			{Title: "Inspected", Width: 90},
+			{Title: "Inspector", Width: 75},
+			{Title: "Result", Width: 90},
+			{Title: "Work Order", Width: 50},
+			{Title: "Notes", Width: pdf.ContentWidth - 340},
+		}, rows)
+		doc.Note("Voided and amended inspections are listed for the audit trail, only current inspections count towards compliance.")
+	}
+
+	return sendPDF(c, fmt.Sprintf("device-history-%d.pdf", device.EmergencyDeviceID), doc)
+}
+
+// HandleGetBuildingComplianceReport returns a PDF listing every device in a building with
+// its last inspection, next due date and expiry
+func (a *App) HandleGetBuildingComplianceReport(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	buildingID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid building ID", err)
+	}
+
+	building, err := a.DB.GetBuildingById(buildingID)
+	if err == sql.ErrNoRows {
+		return a.handleError(c, http.StatusNotFound, "Building not found", err)
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	site, err := a.DB.GetSiteByID(strconv.Itoa(building.SiteID))
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	devices, err := a.DB.GetAllDevices(strconv.Itoa(building.SiteID), building.BuildingCode)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+	sort.SliceStable(devices, func(i, j int) bool {
+		if devices[i].RoomCode != devices[j].RoomCode {
+			return devices[i].RoomCode < devices[j].RoomCode
+		}
+		if devices[i].EmergencyDeviceTypeName != devices[j].EmergencyDeviceTypeName {
+			return devices[i].EmergencyDeviceTypeName < devices[j].EmergencyDeviceTypeName
+		}
+		return devices[i].SerialNumber.String < devices[j].SerialNumber.String
+	})
+
+	now := time.Now().In(a.siteLocation(site.TimeZone))
+	today := now.Format("2006-01-02")
+	statusCounts := make(map[string]int)
+	overdue, expired := 0, 0
+	rows := make([][]string, 0, len(devices))
+	for _, device := range devices {
+		status := reportString(device.Status)
+		statusCounts[status]++
+
+		nextDue := formatReportDate(device.NextInspectionDate)
+		if !device.NextInspectionDate.Valid {
+			nextDue = "Not inspected"
+		} else if device.NextInspectionDate.Time.Format("2006-01-02") < today {
+			nextDue += " (overdue)"
+			overdue++
+		}
+		expiry := formatReportDate(device.ExpireDate)
+		if device.ExpireDate.Valid && device.ExpireDate.Time.Format("2006-01-02") < today {
+			expiry += " (expired)"
+			expired++
+		}
+
+		rows = append(rows, []string{
+			device.RoomCode,
+			device.EmergencyDeviceTypeName,
+			reportString(device.SerialNumber),
+			status,
+			formatReportDate(device.LastInspectionDateTime),
+			nextDue,
+			expiry,
+		})
+	}
+
+	doc := pdf.New(fmt.Sprintf("Compliance Report - %s %s", site.SiteName, building.BuildingCode), reportFooter(now.Location()))
+	doc.Title("Building Compliance Report")
+	doc.Field("Site", site.SiteName)
+	doc.Field("Building", building.BuildingCode)
+	doc.Field("Report Date", now.Format(reportDateFormat))
+
+	doc.Heading("Summary")
+	doc.Field("Devices", strconv.Itoa(len(devices)))
+	statuses := make([]string, 0, len(statusCounts))
+	for status := range statusCounts {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	for _, status := range statuses {
+		doc.Field(status, strconv.Itoa(statusCounts[status]))
+	}
+	doc.Field("Inspection Overdue", strconv.Itoa(overdue))
+	doc.Field("Expired", strconv.Itoa(expired))
+
+	doc.Heading("Devices")
+	if len(rows) == 0 {
+		doc.Paragraph("There are no devices in this building.")
+	} else {
+		doc.Table([]pdf.Column{
+			{Title: "Room", Width: 50},
+			{Title: "Type", Width: 80},
+			{Title: "Serial Number", Width: 75},
+			{Title: "Status", Width: 70},
+			{Title: "Last Inspection", Width: 75},
+			{Title: "Next Due", Width: 70},
+			{Title: "Expiry", Width: pdf.ContentWidth - 420},
+		}, rows)
+	}
+
+	return sendPDF(c, fmt.Sprintf("compliance-%s-%s.pdf", site.SiteName, building.BuildingCode), doc)
+}
+
+// reportDeviceFields prints the details and location of a device
+func reportDeviceFields(doc *pdf.Document, device *models.EmergencyDevice) {
+	doc.Field("Device Type", device.EmergencyDeviceTypeName)
+	if device.ExtinguisherTypeName.Valid {
+		doc.Field("Extinguisher Type", device.ExtinguisherTypeName.String)
+	}
+	doc.Field("Serial Number", reportString(device.SerialNumber))
+	doc.Field("Model", fmt.Sprintf("%s %s", reportString(device.ManufacturerName), reportString(device.ModelName)))
+	doc.Field("Location", fmt.Sprintf("%s, building %s, room %s", device.SiteName, device.BuildingCode, device.RoomCode))
+	doc.Field("Description", reportString(device.Description))
+	doc.Field("Status", reportString(device.Status))
+	doc.Field("Manufactured", formatReportDate(device.ManufactureDate))
+	doc.Field("Last Inspection", formatReportDate(device.LastInspectionDateTime))
+	doc.Field("Next Inspection Due", formatReportDate(device.NextInspectionDate))
+	doc.Field("Expiry", formatReportDate(device.ExpireDate))
+}
+
+// reportSignature prints who signed the inspection and their drawn signature
+func (a *App) reportSignature(c echo.Context, doc *pdf.Document, inspection *models.Inspection) {
+	if !inspection.SignatureType.Valid {
+		doc.Paragraph("This inspection was recorded before inspections were signed.")
+		return
+	}
+
+	doc.Field("Signed By", fmt.Sprintf("%s (%s signature)", inspection.SignedName.String, inspection.SignatureType.String))
+	doc.Field("Signed At", inspection.SignedAt.Time.In(a.siteLocation(inspection.SiteTimeZone)).Format(reportDateTimeFormat))
+	doc.Paragraph(inspection.AttestationText.String)
+
+	if !inspection.SignatureKey.Valid {
+		return
+	}
+	file, err := a.Store.Get(c.Request().Context(), inspection.SignatureKey.String)
+	if err != nil {
+		a.handleLogger("Error reading signature for certificate: " + err.Error())
+		doc.Paragraph("The signature image could not be loaded.")
+		return
+	}
+	defer file.Close()
+
+	img, err := png.Decode(file)
+	if err != nil {
+		a.handleLogger("Error decoding signature for certificate: " + err.Error())
+		doc.Paragraph("The signature image could not be loaded.")
+		return
+	}
+	doc.Image(img, 220, 80)
+}
+
+// reportAnswer describes the answer to a checklist question
+func reportAnswer(response models.InspectionResponse) string {
+	switch response.AnswerType {
+	case models.AnswerTypeYesNoNA:
+		return reportString(response.AnswerYesNo)
+	case models.AnswerTypeNumber:
+		if !response.AnswerNumber.Valid {
+			return "N/A"
+		}
+		return strconv.FormatFloat(response.AnswerNumber.Float64, 'f', -1, 64)
+	case models.AnswerTypePhoto:
+		if !response.AttachmentID.Valid {
+			return "N/A"
+		}
+		return fmt.Sprintf("Photo attached (#%d)", response.AttachmentID.Int64)
+	default:
+		return reportString(response.AnswerText)
+	}
+}
+
+// Inspection and device dates are loaded in the time zone of their site, so they are
+// formatted as they are
+func formatReportDate(value sql.NullTime) string {
+	if !value.Valid || value.Time.IsZero() {
+		return "N/A"
+	}
+	return value.Time.Format(reportDateFormat)
+}
+
+func formatReportDateTime(value sql.NullTime) string {
+	if !value.Valid || value.Time.IsZero() {
+		return "N/A"
+	}
+	return value.Time.Format(reportDateTimeFormat)
+}
+
+func reportString(value sql.NullString) string {
+	if !value.Valid || value.String == "" {
+		return "N/A"
+	}
+	return value.String
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "Yes"
+	}
+	return "No"
+}
+
+// reportFooter stamps a report with when it was generated, in the time zone of its site
+func reportFooter(location *time.Location) string {
+	return "EDMS - generated " + time.Now().In(location).Format(reportDateTimeFormat)
+}
+
+// sendPDF returns the document as a download
+func sendPDF(c echo.Context, fileName string, doc *pdf.Document) error {
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", fileName))
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.Blob(http.StatusOK, "application/pdf", doc.Bytes())
+}
@@ -1,6 +1,8 @@
 package app
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -15,8 +17,9 @@ func (a *App) HandleGetAllRooms(c echo.Context) error {
 	}
 
 	buildingId := c.QueryParam("buildingId")
+	floorId := c.QueryParam("floorId")
 
-	rooms, err := a.DB.GetAllRooms(buildingId)
+	rooms, err := a.DB.GetAllRooms(buildingId, floorId)
 	if err != nil {
 		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
 	}
@@ -25,6 +28,31 @@ func (a *App) HandleGetAllRooms(c echo.Context) error {
 	return c.JSON(http.StatusOK, rooms)
 }
 
+// roomFloor returns the floor a room in the building is put on, the building's lowest
+// floor when none is chosen. The error is the message to show the user.
+func (a *App) roomFloor(buildingID int, floorID string) (*models.Floor, error) {
+	if floorID == "" {
+		floor, err := a.DB.GetDefaultFloor(buildingID)
+		if err == sql.ErrNoRows {
+			return nil, errors.New("Building has no floors, add a floor first")
+		} else if err != nil {
+			a.handleLogger("Error fetching floor: " + err.Error())
+			return nil, errors.New("Error fetching floor")
+		}
+		return floor, nil
+	}
+
+	floorIDInt, err := strconv.Atoi(floorID)
+	if err != nil {
+		return nil, errors.New("Invalid floor ID")
+	}
+	floor, err := a.DB.GetFloorByID(floorIDInt)
+	if err != nil || floor.BuildingID != buildingID {
+		return nil, errors.New("Floor is not in the building")
+	}
+	return floor, nil
+}
+
 func (a *App) HandleGetRoomByID(c echo.Context) error {
 	// Check if request if a POST request
 	if c.Request().Method != http.MethodGet {
@@ -107,9 +135,15 @@ func (a *App) HandlePostRoom(c echo.Context) error {
 		return c.Redirect(http.StatusSeeOther, "/admin?error=Room already exists at this building")
 	}
 
+	floor, err := a.roomFloor(buildingIdInt, c.FormValue("addRoomFloor"))
+	if err != nil {
+		return c.Redirect(http.StatusSeeOther, "/admin?error="+err.Error())
+	}
+
 	var room = models.Room{
 		RoomCode:   roomCode,
 		BuildingID: buildingIdInt,
+		FloorID:    floor.FloorID,
 	}
 
 	// Add the room to the database
@@ -194,29 +228,39 @@ func (a *App) HandlePutRoom(c echo.Context) error {
 		})
 	}
 
-	// Check if the room already exists at the site
+	// Check if another room already has the code at the site, the room's own code may
+	// be kept while it moves floor
 	existingRoomAtSite, err := a.DB.GetRoomByCodeAndSite(roomDto.RoomCode, building.SiteID)
-	if err == nil || existingRoomAtSite != nil {
+	if err == nil && existingRoomAtSite.RoomID != roomIdInt {
 		return c.JSON(http.StatusConflict, map[string]string{
 			"error":       "Room already exists at this site",
 			"redirectURL": "/admin?error=Room already exists at this site",
 		})
 	}
 
-	// Check if the room already exists at the building
+	// Check if another room already has the code at the building
 	existingRoom, err := a.DB.GetRoomByCodeAndBuilding(roomDto.RoomCode, buildingIdInt)
-	if err == nil || existingRoom != nil {
+	if err == nil && existingRoom.RoomID != roomIdInt {
 		return c.JSON(http.StatusConflict, map[string]string{
 			"error":       "Room already exists at this building",
 			"redirectURL": "/admin?error=Room already exists at this building",
 		})
 	}
 
+	floor, err := a.roomFloor(buildingIdInt, roomDto.FloorID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       err.Error(),
+			"redirectURL": "/admin?error=" + err.Error(),
+		})
+	}
+
 	// Create a new room object
 	room := models.Room{
 		RoomID:     roomIdInt,
 		RoomCode:   roomDto.RoomCode,
 		BuildingID: buildingIdInt,
+		FloorID:    floor.FloorID,
 	}
 
 	// Update the room in the database
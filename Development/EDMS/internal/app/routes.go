@@ -1,7 +1,9 @@
 package app
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/config"
 	"github.com/golang-jwt/jwt/v5"
@@ -23,6 +25,45 @@ func (a *App) AdminOnly(next echo.HandlerFunc) echo.HandlerFunc {
 	}
 }
 
+// RejectRevokedTokens middleware sends users whose token was revoked back to the login page
+func (a *App) RejectRevokedTokens(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := c.Get("user").(*jwt.Token)
+		claims := user.Claims.(jwt.MapClaims)
+
+		// Tokens issued before revocation was added have no ID
+		if tokenID, _ := claims["jti"].(string); tokenID != "" {
+			revoked, err := a.DB.IsTokenRevoked(tokenID)
+			if err != nil {
+				a.handleLogger("Error checking revoked token: " + err.Error())
+				return c.Redirect(http.StatusSeeOther, "/")
+			}
+			if revoked {
+				return c.Redirect(http.StatusSeeOther, "/")
+			}
+		}
+		return next(c)
+	}
+}
+
+// currentUser returns the ID and role of the logged in user from the JWT claims
+func currentUser(c echo.Context) (int, string, error) {
+	user, ok := c.Get("user").(*jwt.Token)
+	if !ok {
+		return 0, "", errors.New("no authenticated user")
+	}
+	claims := user.Claims.(jwt.MapClaims)
+
+	userIDStr, _ := claims["user_id"].(string)
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return 0, "", errors.New("invalid user ID in token")
+	}
+	role, _ := claims["role"].(string)
+
+	return userID, role, nil
+}
+
 func (a *App) initRoutes() {
 	secret := config.LoadConfig().JWTSecret
 	// Public routes
@@ -34,6 +75,11 @@ func (a *App) initRoutes() {
 	a.Router.POST("/forgot-password", a.HandlePostForgotPassword)
 	a.Router.POST("/login", a.HandlePostLogin)
 	a.Router.GET("/logout", a.HandleGetLogout)
+	// Signed links in digest emails work without logging in
+	a.Router.GET("/digest/unsubscribe", a.HandleDigestUnsubscribe)
+	a.Router.POST("/digest/unsubscribe", a.HandleDigestUnsubscribe)
+	// Calendar feeds are fetched by calendar apps, the token in the URL is checked instead
+	a.Router.GET("/calendar/:file", a.HandleGetCalendarFeed)
 
 	// JWT middleware
 	jwtMiddleware := echojwt.WithConfig(echojwt.Config{
@@ -47,6 +93,7 @@ func (a *App) initRoutes() {
 	// Protected routes
 	protected := a.Router.Group("")
 	protected.Use(jwtMiddleware)
+	protected.Use(a.RejectRevokedTokens)
 
 	protected.GET("/dashboard", a.HandleGetDashboard)
 
@@ -58,8 +105,20 @@ func (a *App) initRoutes() {
 	admin.PUT("/api/emergency-device/:id/status", a.HandlePutDeviceStatus)
 	// Inspection management routes - Alex
 	admin.GET("/api/inspection", a.HandleGetAllInspectionsByDeviceID)
+	admin.GET("/api/inspection/history", a.HandleGetInspectionHistory)
 	admin.GET("/api/inspection/:id", a.HandleGetInspectionByID)
 	admin.POST("/api/inspection", a.HandlePostInspection)
+	admin.POST("/api/inspection/:id/amend", a.HandleAmendInspection)
+	admin.POST("/api/inspection/:id/void", a.HandleVoidInspection)
+	admin.GET("/api/inspection/:id/revisions", a.HandleGetInspectionRevisions)
+	admin.GET("/api/inspection/:id/attachment", a.HandleGetInspectionAttachments)
+	admin.POST("/api/inspection/:id/attachment", a.HandlePostInspectionAttachment)
+	admin.GET("/api/inspection/:id/work-order/attachment", a.HandleGetWorkOrderAttachments)
+	admin.POST("/api/inspection/:id/work-order/attachment", a.HandlePostWorkOrderAttachment)
+	admin.GET("/api/inspection/:id/signature", a.HandleGetInspectionSignature)
+	admin.GET("/api/inspection/:id/verify", a.HandleVerifyInspection)
+	admin.GET("/api/inspection/:id/certificate", a.HandleGetInspectionCertificate)
+	admin.GET("/api/inspection/report", a.HandleGetDeviceInspectionReport)
 
 	// User management routes - Alex
 	admin.GET("/api/user", a.HandleGetAllUsers)
@@ -70,14 +129,28 @@ func (a *App) initRoutes() {
 	admin.POST("/api/site", a.HandlePostSite)
 	admin.POST("/api/site/:id", a.HandleEditSite)
 	admin.DELETE("/api/site/:id", a.HandleDeleteSite)
+	admin.POST("/api/site/:id/map-import", a.HandlePreviewSiteMapImport)
+	admin.POST("/api/site/:id/map-import/apply", a.HandleApplySiteMapImport)
 	// Building management routes - Joe
 	admin.POST("/api/building", a.HandlePostBuilding)
 	admin.PUT("/api/building/:id", a.HandleEditBuilding)
 	admin.DELETE("/api/building/:id", a.HandleDeleteBuilding)
+	admin.POST("/api/building/:id/floor-plan", a.HandlePostBuildingFloorPlan)
+	admin.POST("/api/building/:id/move", a.HandleMoveBuilding)
+	admin.POST("/api/building/:id/archive", a.HandleArchiveBuilding)
+	// Floor management routes
+	admin.POST("/api/floor", a.HandlePostFloor)
+	admin.POST("/api/floor/:id", a.HandleEditFloor)
+	admin.DELETE("/api/floor/:id", a.HandleDeleteFloor)
 	// Room management routes
 	admin.POST("/api/room", a.HandlePostRoom)
 	admin.PUT("/api/room/:id", a.HandlePutRoom)
 	admin.DELETE("/api/room/:id", a.HandleDeleteRoom)
+	admin.POST("/api/room/:id/move", a.HandleMoveRoom)
+	admin.POST("/api/room/:id/merge", a.HandleMergeRoom)
+	// Location tree import and export
+	admin.GET("/api/location-tree", a.HandleExportLocationTree)
+	admin.POST("/api/location-tree/import", a.HandleImportLocationTree)
 	// Device type management routes - James
 	admin.POST("/api/emergency-device-type", a.HandlePostDeviceType)
 	admin.GET("/api/emergency-device-type/:id", a.HandleGetAllDeviceTypeByID)
@@ -87,19 +160,103 @@ func (a *App) initRoutes() {
 	admin.POST("/api/emergency-device", a.HandlePostDevice)
 	admin.PUT("/api/emergency-device/:id", a.HandlePutDevice)
 	admin.DELETE("/api/emergency-device/:id", a.HandleDeleteDevice)
+	admin.PUT("/api/emergency-device/:id/pin", a.HandlePutDevicePin)
+	// Manufacturer and model catalog routes
+	admin.POST("/api/manufacturer", a.HandlePostManufacturer)
+	admin.DELETE("/api/manufacturer/:id", a.HandleDeleteManufacturer)
+	admin.POST("/api/device-model", a.HandlePostDeviceModel)
+	admin.DELETE("/api/device-model/:id", a.HandleDeleteDeviceModel)
+	// Checklist template routes
+	admin.POST("/api/checklist-template", a.HandlePostChecklistTemplate)
+	admin.DELETE("/api/checklist-template/:id", a.HandleDeleteChecklistTemplate)
+	// Recall register routes
+	admin.GET("/api/recall", a.HandleGetAllRecalls)
+	admin.GET("/api/recall/:id/device", a.HandleGetRecallDevices)
+	admin.POST("/api/recall", a.HandlePostRecall)
+	admin.PUT("/api/recall/:id/close", a.HandleCloseRecall)
+	admin.PUT("/api/recall/:id/device/:deviceId/resolve", a.HandleResolveDeviceRecall)
+	// Inspection round routes
+	admin.GET("/api/inspection-round", a.HandleGetAllInspectionRounds)
+	admin.GET("/api/inspection-round/:id", a.HandleGetInspectionRoundByID)
+	admin.POST("/api/inspection-round", a.HandlePostInspectionRound)
+	admin.PUT("/api/inspection-round/:id/assign", a.HandlePutInspectionRoundAssignment)
+	admin.POST("/api/inspection-round/:id/cancel", a.HandleCancelInspectionRound)
+	admin.PUT("/api/inspection-round/:id/item/:itemId", a.HandlePutInspectionRoundItem)
+	// Offline sync routes for inspectors working without a connection
+	admin.GET("/api/sync/snapshot", a.HandleGetSyncSnapshot)
+	admin.POST("/api/sync/inspections", a.HandlePostSyncInspections)
+	// Escalation policy and site member routes
+	admin.GET("/api/escalation-policy", a.HandleGetEscalationPolicies)
+	admin.POST("/api/escalation-policy", a.HandlePostEscalationPolicy)
+	admin.PUT("/api/escalation-policy/:id", a.HandlePutEscalationPolicy)
+	admin.DELETE("/api/escalation-policy/:id", a.HandleDeleteEscalationPolicy)
+	admin.GET("/api/site/:id/member", a.HandleGetSiteMembers)
+	admin.PUT("/api/site/:id/member", a.HandlePutSiteMember)
+	admin.DELETE("/api/site/:id/member/:userId", a.HandleDeleteSiteMember)
+	admin.GET("/api/emergency-device/:id/escalation", a.HandleGetDeviceEscalations)
+	// Webhook routes
+	admin.GET("/api/webhook", a.HandleGetWebhooks)
+	admin.POST("/api/webhook", a.HandlePostWebhook)
+	admin.PUT("/api/webhook/:id", a.HandlePutWebhook)
+	admin.DELETE("/api/webhook/:id", a.HandleDeleteWebhook)
+	admin.POST("/api/webhook/:id/ping", a.HandlePingWebhook)
+	admin.GET("/api/webhook-delivery", a.HandleGetWebhookDeliveries)
+	admin.GET("/api/webhook-delivery/:id", a.HandleGetWebhookDelivery)
+	admin.POST("/api/webhook-delivery/:id/redeliver", a.HandleRedeliverWebhook)
+	// Background job routes
+	admin.GET("/api/job", a.HandleGetJobs)
+	admin.GET("/api/job-run", a.HandleGetJobRuns)
+	admin.POST("/api/job/:name/run", a.HandleRunJob)
+	admin.POST("/api/notification/generate", a.HandleGenerateNotifications)
 
 	// Other protected API routes
 	api := protected.Group("/api")
 	api.GET("/emergency-device", a.HandleGetAllDevices)
 	api.GET("/emergency-device/:id", a.HandleGetDeviceByID)
+	api.GET("/emergency-device/:id/checklist", a.HandleGetDeviceChecklist)
 	api.GET("/emergency-device-type", a.HandleGetAllDeviceTypes)
+	api.GET("/checklist-template", a.HandleGetAllChecklistTemplates)
+	api.GET("/checklist-template/:id", a.HandleGetChecklistTemplateByID)
 	api.GET("/extinguisher-type", a.HandleGetAllExtinguisherTypes)
+	api.GET("/manufacturer", a.HandleGetAllManufacturers)
+	api.GET("/device-model", a.HandleGetAllDeviceModels)
+	api.GET("/floor", a.HandleGetAllFloors)
+	api.GET("/floor/:id", a.HandleGetFloorByID)
+	api.GET("/floor/:id/pin", a.HandleGetFloorPins)
+	api.GET("/floor-plan/:name", a.HandleGetFloorPlan)
 	api.GET("/room", a.HandleGetAllRooms)
 	api.GET("/room/:id", a.HandleGetRoomByID)
 	api.GET("/building", a.HandleGetAllBuildings)
 	api.GET("/building/:id", a.HandleGetBuildingByID)
+	api.GET("/building/:id/pin", a.HandleGetBuildingPins)
+	api.GET("/building/:id/compliance-report", a.HandleGetBuildingComplianceReport)
 	api.GET("/site", a.HandleGetAllSites)
 	api.GET("/site/:id", a.HamdleGetSiteByID)
+	api.GET("/site-map/:name", a.HandleGetSiteMap)
+	// Attachment routes, each attachment is as visible as what it is attached to
+	api.GET("/emergency-device/:id/attachment", a.HandleGetDeviceAttachments)
+	api.POST("/emergency-device/:id/attachment", a.HandlePostDeviceAttachment)
+	api.GET("/attachment/:id", a.HandleGetAttachment)
+	api.GET("/attachment/:id/thumbnail", a.HandleGetAttachmentThumbnail)
+	api.DELETE("/attachment/:id", a.HandleDeleteAttachment)
+	// Notification routes, read and dismissed state is per user
+	api.GET("/notification", a.HandleGetNotifications)
+	api.GET("/notification/count", a.HandleGetNotificationCount)
+	api.PUT("/notification/:id/read", a.HandleReadNotification)
+	api.PUT("/notification/:id/dismiss", a.HandleDismissNotification)
+	api.POST("/notification/read-all", a.HandleReadAllNotifications)
+	api.POST("/notification/dismiss-all", a.HandleDismissAllNotifications)
+	// Email digest routes, settings are per user
+	api.GET("/digest", a.HandleGetDigestSubscription)
+	api.PUT("/digest", a.HandlePutDigestSubscription)
+	api.GET("/digest/preview", a.HandleGetDigestPreview)
+	// Calendar feed routes, settings are per user
+	api.GET("/calendar", a.HandleGetCalendarSettings)
+	api.PUT("/calendar", a.HandlePutCalendarSettings)
+	api.DELETE("/calendar", a.HandleDeleteCalendarFeed)
+	api.POST("/calendar/reset", a.HandleResetCalendarFeed)
+	// Live updates for the dashboard
+	api.GET("/events", a.HandleGetEvents)
 
 	// Add any other routes as needed
 }
@@ -2,17 +2,22 @@ package app
 
 import (
 	"database/sql"
-	"io"
+	"mime"
 	"net/http"
-	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
 
 	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/storage"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/utils"
 	"github.com/labstack/echo/v4"
 )
 
+// siteNameRegex allows only letters, numbers, spaces, hyphens, and underscores in site names
+var siteNameRegex = regexp.MustCompile(`^[a-zA-Z0-9\s_-]+$`)
+
 func (a *App) HandlePostSite(c echo.Context) error {
 	// Check if request if a GET request
 	if c.Request().Method != http.MethodPost {
@@ -28,19 +33,28 @@ func (a *App) HandlePostSite(c echo.Context) error {
 	// Get the form values
 	siteName := strings.TrimSpace(c.FormValue("addSiteName"))       // Trim whitespace
 	siteAddress := strings.TrimSpace(c.FormValue("addSiteAddress")) // Trim whitespace
+	timeZone := strings.TrimSpace(c.FormValue("addSiteTimeZone"))   // Trim whitespace
 
 	// Validate input
 	if siteName == "" || siteAddress == "" {
 		return c.Redirect(http.StatusSeeOther, "/admin?error=All fields are required")
 	}
 
+	// New sites are in the app's time zone unless another is given
+	if timeZone == "" {
+		timeZone = a.Location.String()
+	}
+	if _, err := utils.LoadLocation(timeZone); err != nil {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Unknown time zone, use a name such as Pacific/Auckland")
+	}
+
 	// Validate site name & address length (site name should be less than 100 characters) (address should be less than 255 characters)
 	if len(siteName) > 100 || len(siteAddress) > 255 {
 		return c.Redirect(http.StatusSeeOther, "/admin?error=Site name should be less than 100 characters and address should be less than 255 characters")
 	}
 
 	// Additional validation for siteName (allow only alphanumeric, spaces, hyphens, and underscores)
-	if !regexp.MustCompile(`^[a-zA-Z0-9\s_-]+$`).MatchString(siteName) {
+	if !siteNameRegex.MatchString(siteName) {
 		return c.Redirect(http.StatusSeeOther, "/admin?error=Site name can only contain letters, numbers, spaces, hyphens, and underscores")
 	}
 
@@ -61,35 +75,17 @@ func (a *App) HandlePostSite(c echo.Context) error {
 		defer file.Close()
 		// Validate file extension
 		// Create unique file name based on the site name
-		fileExt := filepath.Ext(header.Filename)
-		allowedExtensions := map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".svg": true}
-		if !allowedExtensions[fileExt] {
+		fileExt := strings.ToLower(filepath.Ext(header.Filename))
+		if !siteMapExtensions[fileExt] {
 			return c.Redirect(http.StatusSeeOther, "/admin?error=Invalid file type. Allowed types: jpg, jpeg, png, gif, svg")
 		}
-		// Define static directory for site maps
-		staticDir := "./static/site_maps"
-		if _, err := os.Stat(staticDir); os.IsNotExist(err) {
-			os.MkdirAll(staticDir, os.ModePerm) // Create directory if it doesn't exist
-		}
-
-		sanitizedSiteName := strings.ReplaceAll(siteName, " ", "_")
-		sanitizedSiteName = regexp.MustCompile(`[^a-zA-Z0-9_-]`).ReplaceAllString(sanitizedSiteName, "")
-		fileName := filepath.Join(staticDir, sanitizedSiteName+fileExt)
-
-		out, err := os.Create(fileName)
-		if err != nil {
-			return c.Redirect(http.StatusInternalServerError, "/admin?error=Error creating file")
-		}
-		defer out.Close()
 
-		// Copy the uploaded file data to the new file
-		_, err = io.Copy(out, file)
+		// Save the map in the file store, the path is the URL it is served from
+		filePath, err = a.saveSiteMap(c.Request().Context(), siteName, file, fileExt)
 		if err != nil {
-			return c.Redirect(http.StatusInternalServerError, "/admin?error=Error copying file")
+			a.handleLogger("Error saving site map: " + err.Error())
+			return c.Redirect(http.StatusSeeOther, "/admin?error=Error saving site map")
 		}
-
-		// Save the relative path as a sql.NullString
-		filePath = sql.NullString{String: "/static/site_maps/" + sanitizedSiteName + fileExt, Valid: true}
 	}
 
 	// Save site information and file path in the database
@@ -97,6 +93,7 @@ func (a *App) HandlePostSite(c echo.Context) error {
 		SiteName:         siteName,
 		SiteAddress:      siteAddress,
 		SiteMapImagePath: filePath,
+		TimeZone:         timeZone,
 	}
 
 	err = a.DB.AddSite(site)
@@ -124,19 +121,25 @@ func (a *App) HandleEditSite(c echo.Context) error {
 	siteID := c.FormValue("editSiteID")
 	siteName := strings.TrimSpace(c.FormValue("editSiteName"))       // Trim whitespace
 	siteAddress := strings.TrimSpace(c.FormValue("editSiteAddress")) // Trim whitespace
+	timeZone := strings.TrimSpace(c.FormValue("editSiteTimeZone"))   // Trim whitespace
 
 	// Validate input
-	if siteName == "" || siteAddress == "" {
+	if siteName == "" || siteAddress == "" || timeZone == "" {
 		return c.Redirect(http.StatusSeeOther, "/admin?error=All fields are required")
 	}
 
+	// Validate the time zone is a known IANA name
+	if _, err := utils.LoadLocation(timeZone); err != nil {
+		return c.Redirect(http.StatusSeeOther, "/admin?error=Unknown time zone, use a name such as Pacific/Auckland")
+	}
+
 	// Validate site name & address length (site name should be less than 100 characters) (address should be less than 255 characters)
 	if len(siteName) > 100 || len(siteAddress) > 255 {
 		return c.Redirect(http.StatusSeeOther, "/admin?error=Site name should be less than 100 characters and address should be less than 255 characters")
 	}
 
 	// Additional validation for siteName (allow only alphanumeric, spaces, hyphens, and underscores)
-	if !regexp.MustCompile(`^[a-zA-Z0-9\s_-]+$`).MatchString(siteName) {
+	if !siteNameRegex.MatchString(siteName) {
 		return c.Redirect(http.StatusSeeOther, "/admin?error=Site name can only contain letters, numbers, spaces, hyphens, and underscores")
 	}
 
@@ -159,77 +162,42 @@ func (a *App) HandleEditSite(c echo.Context) error {
 	// Initialize filePath as an empty sql.NullString
 	filePath := sql.NullString{String: "", Valid: false}
 
-	// Define static directory for site maps
-	staticDir := "./static/site_maps"
-
-	// Create sanitized site name
-	sanitizedSiteName := strings.ReplaceAll(siteName, " ", "_")
-	sanitizedSiteName = regexp.MustCompile(`[^a-zA-Z0-9_-]`).ReplaceAllString(sanitizedSiteName, "")
-
-	// Initialize file extension
-	var fileExt string
+	ctx := c.Request().Context()
 
 	// Retrieve the file from the form
 	file, header, err := c.Request().FormFile("siteMapImgInput")
 	if err == nil {
 		defer file.Close()
 
-		// If a new image is being uploaded and the existing site has an image, delete the old image
-		if existingSite != nil && existingSite.SiteMapImagePath.Valid {
-			oldImagePath := "." + existingSite.SiteMapImagePath.String
-			if err := os.Remove(oldImagePath); err != nil {
-				return c.Redirect(http.StatusInternalServerError, "/admin?error=Error deleting old image")
-			}
-		}
-
 		// Validate file extension
-		// Create unique file name based on the site name
-		fileExt = filepath.Ext(header.Filename)
-		allowedExtensions := map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".svg": true}
-		if !allowedExtensions[fileExt] {
+		fileExt := strings.ToLower(filepath.Ext(header.Filename))
+		if !siteMapExtensions[fileExt] {
 			return c.Redirect(http.StatusSeeOther, "/admin?error=Invalid file type. Allowed types: jpg, jpeg, png, gif, svg")
 		}
 
-		// Define static directory for site maps
-		if _, err := os.Stat(staticDir); os.IsNotExist(err) {
-			os.MkdirAll(staticDir, os.ModePerm) // Create directory if it doesn't exist
+		// If a new image is being uploaded and the existing site has an image, delete the old image
+		if oldKey, ok := siteMapKey(existingSite.SiteMapImagePath); ok {
+			if err := a.Store.Delete(ctx, oldKey); err != nil {
+				return c.Redirect(http.StatusSeeOther, "/admin?error=Error deleting old image")
+			}
 		}
 
-		sanitizedSiteName = strings.ReplaceAll(siteName, " ", "_")
-		sanitizedSiteName = regexp.MustCompile(`[^a-zA-Z0-9_-]`).ReplaceAllString(sanitizedSiteName, "")
-		fileName := filepath.Join(staticDir, sanitizedSiteName+fileExt)
-
-		out, err := os.Create(fileName)
+		filePath, err = a.saveSiteMap(ctx, siteName, file, fileExt)
 		if err != nil {
-			return c.Redirect(http.StatusInternalServerError, "/admin?error=Error creating file")
+			a.handleLogger("Error saving site map: " + err.Error())
+			return c.Redirect(http.StatusSeeOther, "/admin?error=Error saving site map")
 		}
-		defer out.Close()
-
-		// Copy the uploaded file data to the new file
-		_, err = io.Copy(out, file)
-		if err != nil {
-			return c.Redirect(http.StatusInternalServerError, "/admin?error=Error copying file")
+	} else if oldKey, ok := siteMapKey(existingSite.SiteMapImagePath); ok && siteName != existingSite.SiteName {
+		// The site name has changed and a map exists, rename the stored map to match
+		fileExt := path.Ext(oldKey)
+		newName := sanitizeSiteName(siteName) + fileExt
+		if err := storage.Move(ctx, a.Store, oldKey, siteMapKeyPrefix+newName, mime.TypeByExtension(fileExt)); err != nil {
+			a.handleLogger("Error renaming site map: " + err.Error())
+			return c.Redirect(http.StatusSeeOther, "/admin?error=Error renaming image")
 		}
 
-		// Save the relative path as a sql.NullString
-		filePath = sql.NullString{String: "/static/site_maps/" + sanitizedSiteName + fileExt, Valid: true}
-	} else {
-		fileExt = filepath.Ext(existingSite.SiteMapImagePath.String)
-	}
-
-	// check if the site name has changed and a map exists
-	if siteName != existingSite.SiteName && existingSite.SiteMapImagePath.Valid {
-		// Only rename the file if no new file is uploaded
-		if err != nil {
-			oldImagePath := "." + existingSite.SiteMapImagePath.String
-			newImagePath := filepath.Join(staticDir, sanitizedSiteName+fileExt)
-			if err := os.Rename(oldImagePath, newImagePath); err != nil {
-				return c.Redirect(http.StatusInternalServerError, "/admin?error=Error renaming image")
-			}
-
-			// Update the file path
-			filePath = sql.NullString{String: "/static/site_maps/" + sanitizedSiteName + fileExt, Valid: true}
-		}
+		// Update the file path
+		filePath = sql.NullString{String: siteMapURLPrefix + newName, Valid: true}
 	}
 
 	// Save site information and file path in the database
@@ -245,6 +213,7 @@ func (a *App) HandleEditSite(c echo.Context) error {
 		SiteName:         siteName,
 		SiteAddress:      siteAddress,
 		SiteMapImagePath: siteMapImagePath, // Use the existing path if no new file was uploaded
+		TimeZone:         timeZone,
 	}
 
 	err = a.DB.UpdateSite(site)
@@ -339,10 +308,9 @@ func (a *App) HandleDeleteSite(c echo.Context) error {
 	}
 
 	// Check if the site has a map image
-	if site.SiteMapImagePath.Valid {
+	if key, ok := siteMapKey(site.SiteMapImagePath); ok {
 		// Delete the map image file
-		imagePath := "." + site.SiteMapImagePath.String
-		if err := os.Remove(imagePath); err != nil {
+		if err := a.Store.Delete(c.Request().Context(), key); err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{
 				"error":       "Error deleting site map image",
 				"redirectURL": "/admin?error=Error deleting site map image",
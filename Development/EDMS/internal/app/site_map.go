@@ -0,0 +1,138 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/storage"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Site maps are stored under siteMapKeyPrefix and served from siteMapURLPrefix,
+	// SiteT.SiteMapImagePath holds the URL so the dashboard can use it directly
+	siteMapKeyPrefix = "site_maps/"
+	siteMapURLPrefix = "/api/site-map/"
+	// legacySiteMapPrefix is where maps were written before the file store existed
+	legacySiteMapPrefix = "/static/site_maps/"
+	maxSiteMapSize      = 10 << 20 // 10 MB
+)
+
+var (
+	siteMapExtensions  = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".svg": true}
+	siteMapNameRegex   = regexp.MustCompile(`^[a-zA-Z0-9_-]+\.(jpg|jpeg|png|gif|svg)$`)
+	siteNameCleanRegex = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+)
+
+// sanitizeSiteName turns a site name into the base name of its map file
+func sanitizeSiteName(siteName string) string {
+	return siteNameCleanRegex.ReplaceAllString(strings.ReplaceAll(siteName, " ", "_"), "")
+}
+
+// siteMapKey returns the store key of a site map path, ok is false when the site
+// has no map or the map has not been moved into the store
+func siteMapKey(siteMapImagePath sql.NullString) (string, bool) {
+	if !siteMapImagePath.Valid || !strings.HasPrefix(siteMapImagePath.String, siteMapURLPrefix) {
+		return "", false
+	}
+	return siteMapKeyPrefix + strings.TrimPrefix(siteMapImagePath.String, siteMapURLPrefix), true
+}
+
+// saveSiteMap writes an uploaded site map to the file store and returns the path to save against the site
+func (a *App) saveSiteMap(ctx context.Context, siteName string, file io.Reader, fileExt string) (sql.NullString, error) {
+	data, err := utils.ReadLimited(file, maxSiteMapSize)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+
+	fileName := sanitizeSiteName(siteName) + fileExt
+	if err := a.Store.Put(ctx, siteMapKeyPrefix+fileName, bytes.NewReader(data), mime.TypeByExtension(fileExt)); err != nil {
+		return sql.NullString{}, err
+	}
+
+	return sql.NullString{String: siteMapURLPrefix + fileName, Valid: true}, nil
+}
+
+// HandleGetSiteMap serves a site map image from the file store
+func (a *App) HandleGetSiteMap(c echo.Context) error {
+	// Check if request if a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	name := c.Param("name")
+	if !siteMapNameRegex.MatchString(name) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Site map not found"})
+	}
+
+	file, err := a.Store.Get(c.Request().Context(), siteMapKeyPrefix+name)
+	if err == storage.ErrNotFound {
+		return a.handleError(c, http.StatusNotFound, "Site map not found", err)
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error reading site map", err)
+	}
+	defer file.Close()
+
+	header := c.Response().Header()
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Cache-Control", "private, no-cache")
+	// SVG maps are uploaded by admins but could still carry script, never run it
+	header.Set("Content-Security-Policy", "default-src 'none'; img-src 'self' data:; style-src 'unsafe-inline'")
+
+	return c.Stream(http.StatusOK, mime.TypeByExtension(path.Ext(name)), file)
+}
+
+// migrateSiteMaps copies site maps that were saved under ./static/site_maps into the
+// file store and points the sites at the new location. Sites already using the store
+// are skipped, so it only does work once. The old files are left in place because
+// the seeded maps are part of the repository.
+func (a *App) migrateSiteMaps() {
+	sites, err := a.DB.GetSitesByMapPathPrefix(legacySiteMapPrefix)
+	if err != nil {
+		a.handleLogger("Site map migration skipped: " + err.Error())
+		return
+	}
+
+	for _, site := range sites {
+		fileName := path.Base(site.SiteMapImagePath.String)
+		if !siteMapNameRegex.MatchString(fileName) {
+			a.handleLogger("Site map migration skipped unexpected path " + site.SiteMapImagePath.String)
+			continue
+		}
+
+		if err := a.migrateSiteMap(fileName); err != nil {
+			a.handleLogger("Site map migration failed for " + site.SiteName + ": " + err.Error())
+			continue
+		}
+
+		if err := a.DB.UpdateSiteMapImagePath(site.SiteID, siteMapURLPrefix+fileName); err != nil {
+			a.handleLogger("Site map migration failed for " + site.SiteName + ": " + err.Error())
+			continue
+		}
+
+		a.handleLogger("Moved site map for " + site.SiteName + " into the file store")
+	}
+}
+
+func (a *App) migrateSiteMap(fileName string) error {
+	file, err := os.Open(filepath.Join("static", "site_maps", fileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return errors.New("file " + fileName + " not found")
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return a.Store.Put(context.Background(), siteMapKeyPrefix+fileName, file, mime.TypeByExtension(path.Ext(fileName)))
+}
@@ -0,0 +1,359 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/database"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/svgmap"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// roundMapPoint rounds a map position to a tenth of a pixel and keeps it on the map, as
+// shapes drawn past the edge of the map would otherwise have a negative position
+func roundMapPoint(v float64) float64 {
+	return math.Max(0, math.Round(v*10)/10)
+}
+
+// importOutline returns a building's outline to store, with no more than
+// maxMapPolygonPoints points, or nil when it has too few points to outline the building
+func importOutline(outline [][2]float64) [][2]float64 {
+	if len(outline) < 3 {
+		return nil
+	}
+
+	// The outline is convex, so every few points can be dropped and it still fits
+	step := 1.0
+	if len(outline) > maxMapPolygonPoints {
+		step = float64(len(outline)) / maxMapPolygonPoints
+	}
+	polygon := [][2]float64{}
+	for i := 0.0; int(i) < len(outline) && len(polygon) < maxMapPolygonPoints; i += step {
+		point := outline[int(i)]
+		polygon = append(polygon, [2]float64{roundMapPoint(point[0]), roundMapPoint(point[1])})
+	}
+	return polygon
+}
+
+func samePolygon(a, b [][2]float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i][0]-b[i][0]) > 0.5 || math.Abs(a[i][1]-b[i][1]) > 0.5 {
+			return false
+		}
+	}
+	return true
+}
+
+// siteMapImport compares the buildings and rooms found on a site map with those at the
+// site
+func (a *App) siteMapImport(siteID int, found *svgmap.Map) (*models.SiteMapImport, error) {
+	siteIDStr := strconv.Itoa(siteID)
+	buildings, err := a.DB.GetAllBuildings(siteIDStr)
+	if err != nil {
+		return nil, err
+	}
+	rooms, err := a.DB.GetRoomsBySiteID(siteIDStr)
+	if err != nil {
+		return nil, err
+	}
+
+	existingBuildings := map[string]models.Building{}
+	for _, building := range buildings {
+		existingBuildings[building.BuildingCode] = building
+	}
+	// Room codes are unique across the site, so rooms are found by code alone
+	existingRooms := map[string]string{}
+	for _, room := range rooms {
+		existingRooms[room.RoomCode] = room.BuildingCode
+	}
+
+	proposal := &models.SiteMapImport{
+		SiteID:    siteID,
+		Width:     found.Width,
+		Height:    found.Height,
+		Buildings: []models.SiteMapImportBuilding{},
+		Rooms:     []models.SiteMapImportRoom{},
+		Warnings:  []string{},
+	}
+
+	proposed := map[string]bool{}
+	for _, feature := range found.Buildings {
+		if len(feature.BuildingCode) > 100 {
+			proposal.Warnings = append(proposal.Warnings, fmt.Sprintf("Building code %.20s... is longer than 100 characters", feature.BuildingCode))
+			continue
+		}
+
+		building := models.SiteMapImportBuilding{
+			Action:       models.SiteMapImportCreate,
+			BuildingCode: feature.BuildingCode,
+			MapX:         roundMapPoint(feature.X),
+			MapY:         roundMapPoint(feature.Y),
+			MapPolygon:   importOutline(feature.Outline),
+		}
+		if existing, ok := existingBuildings[feature.BuildingCode]; ok {
+			building.CurrentMapX = existing.MapX
+			building.CurrentMapY = existing.MapY
+			building.CurrentMapPolygon = existing.MapPolygon
+
+			building.Action = models.SiteMapImportUpdate
+			if existing.MapX.Valid && existing.MapY.Valid &&
+				math.Abs(existing.MapX.Float64-building.MapX) <= 0.5 &&
+				math.Abs(existing.MapY.Float64-building.MapY) <= 0.5 &&
+				samePolygon(existing.MapPolygon, building.MapPolygon) {
+				building.Action = models.SiteMapImportUnchanged
+			}
+		}
+		proposed[building.BuildingCode] = true
+		proposal.Buildings = append(proposal.Buildings, building)
+	}
+
+	importedRooms := map[string]string{}
+	for _, feature := range found.Rooms {
+		if len(feature.RoomCode) > 100 {
+			proposal.Warnings = append(proposal.Warnings, fmt.Sprintf("Room code %.20s... is longer than 100 characters", feature.RoomCode))
+			continue
+		}
+		if _, ok := existingBuildings[feature.BuildingCode]; !ok && !proposed[feature.BuildingCode] {
+			proposal.Warnings = append(proposal.Warnings, fmt.Sprintf("Room %s was skipped, building %s is not at the site or on the map", feature.RoomCode, feature.BuildingCode))
+			continue
+		}
+
+		room := models.SiteMapImportRoom{
+			Action:       models.SiteMapImportCreate,
+			BuildingCode: feature.BuildingCode,
+			RoomCode:     feature.RoomCode,
+			MapX:         roundMapPoint(feature.X),
+			MapY:         roundMapPoint(feature.Y),
+		}
+		existing, ok := existingRooms[feature.RoomCode]
+		switch {
+		case ok && existing != feature.BuildingCode:
+			room.Action, room.Detail = models.SiteMapImportConflict, "Room code is already used in building "+existing
+		case importedRooms[feature.RoomCode] != "" && importedRooms[feature.RoomCode] != feature.BuildingCode:
+			room.Action, room.Detail = models.SiteMapImportConflict, "Room code is also found in building "+importedRooms[feature.RoomCode]
+		case ok:
+			room.Action = models.SiteMapImportUnchanged
+		}
+		if importedRooms[feature.RoomCode] == "" {
+			importedRooms[feature.RoomCode] = feature.BuildingCode
+		}
+		proposal.Rooms = append(proposal.Rooms, room)
+	}
+
+	if len(proposal.Rooms) > 0 {
+		proposal.Warnings = append(proposal.Warnings, "Room positions are not saved, rooms are added to the lowest floor of their building")
+	}
+	if len(proposal.Buildings) == 0 && len(proposal.Rooms) == 0 {
+		proposal.Warnings = append(proposal.Warnings, "No buildings or rooms were found, name their shapes building-<code> or room-<building>-<room>")
+	}
+
+	sort.Slice(proposal.Buildings, func(i, j int) bool {
+		return proposal.Buildings[i].BuildingCode < proposal.Buildings[j].BuildingCode
+	})
+	sort.Slice(proposal.Rooms, func(i, j int) bool {
+		if proposal.Rooms[i].BuildingCode != proposal.Rooms[j].BuildingCode {
+			return proposal.Rooms[i].BuildingCode < proposal.Rooms[j].BuildingCode
+		}
+		return proposal.Rooms[i].RoomCode < proposal.Rooms[j].RoomCode
+	})
+
+	return proposal, nil
+}
+
+// HandlePreviewSiteMapImport reads the buildings and rooms drawn on an uploaded SVG site
+// map and returns how they differ from those at the site, nothing is saved. Shapes are
+// found by the naming convention of the svgmap package, and with shortIds set, ids such
+// as j or n1 are read as building codes.
+func (a *App) HandlePreviewSiteMapImport(c echo.Context) error {
+	// Check if request is a POST request
+	if c.Request().Method != http.MethodPost {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{
+			"error": "Method not allowed",
+		})
+	}
+
+	siteID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid site ID",
+		})
+	}
+	if _, err := a.DB.GetSiteByID(c.Param("id")); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "Site does not exist",
+		})
+	}
+
+	file, header, err := c.Request().FormFile("siteMapSvgInput")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Please choose an SVG site map",
+		})
+	}
+	defer file.Close()
+
+	if strings.ToLower(filepath.Ext(header.Filename)) != ".svg" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Site map must be an SVG",
+		})
+	}
+	data, err := utils.ReadLimited(file, maxSiteMapSize)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Site map must be no larger than 10 MB",
+		})
+	}
+
+	found, err := svgmap.Parse(bytes.NewReader(data), svgmap.Options{
+		ShortIDs: c.FormValue("shortIds") != "",
+	})
+	if err != nil {
+		a.handleLogger("Error reading site map: " + err.Error())
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Site map could not be read as an SVG",
+		})
+	}
+
+	proposal, err := a.siteMapImport(siteID, found)
+	if err != nil {
+		a.handleLogger("Error comparing site map: " + err.Error())
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Error fetching buildings",
+		})
+	}
+
+	return c.JSON(http.StatusOK, proposal)
+}
+
+// validMapPoint reports whether a position is on the map
+func validMapPoint(x, y float64) bool {
+	return !math.IsNaN(x) && !math.IsNaN(y) && !math.IsInf(x, 0) && !math.IsInf(y, 0) && x >= 0 && y >= 0
+}
+
+// HandleApplySiteMapImport saves the buildings and rooms of a site map import the admin
+// has reviewed. Buildings already at the site are moved to their imported position and
+// rooms the site already has are left as they are. Rooms whose code another building of
+// the site uses are conflicts and are not imported.
+func (a *App) HandleApplySiteMapImport(c echo.Context) error {
+	// Check if request is a POST request
+	if c.Request().Method != http.MethodPost {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{
+			"error":       "Method not allowed",
+			"redirectURL": "/admin?error=Method not allowed",
+		})
+	}
+
+	siteID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Invalid site ID",
+			"redirectURL": "/admin?error=Invalid site ID",
+		})
+	}
+	if _, err := a.DB.GetSiteByID(c.Param("id")); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error":       "Site does not exist",
+			"redirectURL": "/admin?error=Site does not exist",
+		})
+	}
+
+	var req struct {
+		Buildings []models.SiteMapImportBuilding `json:"buildings"`
+		Rooms     []models.SiteMapImportRoom     `json:"rooms"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       "Invalid request body",
+			"redirectURL": "/admin?error=Invalid request body",
+		})
+	}
+
+	invalid := func(message string) error {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error":       message,
+			"redirectURL": "/admin?error=" + message,
+		})
+	}
+
+	// Buildings are found by code, so each may only be given once
+	buildingCodes := map[string]bool{}
+	for i, building := range req.Buildings {
+		building.BuildingCode = strings.TrimSpace(building.BuildingCode)
+		if building.BuildingCode == "" || len(building.BuildingCode) > 100 {
+			return invalid("Building codes must be between 1 and 100 characters long")
+		}
+		if buildingCodes[building.BuildingCode] {
+			return invalid("Building " + building.BuildingCode + " is given more than once")
+		}
+		if !validMapPoint(building.MapX, building.MapY) {
+			return invalid("Building " + building.BuildingCode + " is not on the map")
+		}
+		if len(building.MapPolygon) > 0 && (len(building.MapPolygon) < 3 || len(building.MapPolygon) > maxMapPolygonPoints) {
+			return invalid(fmt.Sprintf("Building %s outline must have between 3 and %d points", building.BuildingCode, maxMapPolygonPoints))
+		}
+		for _, point := range building.MapPolygon {
+			if !validMapPoint(point[0], point[1]) {
+				return invalid("Building " + building.BuildingCode + " outline is not on the map")
+			}
+		}
+		buildingCodes[building.BuildingCode] = true
+		req.Buildings[i] = building
+	}
+
+	// Rooms go in a building being imported or already at the site
+	buildings, err := a.DB.GetAllBuildings(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching buildings", err)
+	}
+	for _, building := range buildings {
+		buildingCodes[building.BuildingCode] = true
+	}
+	for i, room := range req.Rooms {
+		room.BuildingCode = strings.TrimSpace(room.BuildingCode)
+		room.RoomCode = strings.TrimSpace(room.RoomCode)
+		if room.RoomCode == "" || len(room.RoomCode) > 100 {
+			return invalid("Room codes must be between 1 and 100 characters long")
+		}
+		if !buildingCodes[room.BuildingCode] {
+			return invalid("Building " + room.BuildingCode + " of room " + room.RoomCode + " is not at the site")
+		}
+		if room.Action == models.SiteMapImportConflict {
+			return invalid("Room " + room.RoomCode + " conflicts with a room at the site")
+		}
+		req.Rooms[i] = room
+	}
+
+	result, err := a.DB.ApplySiteMapImport(siteID, req.Buildings, req.Rooms)
+	if errors.Is(err, database.ErrRoomCodeInUse) {
+		message := "Site map not imported, " + err.Error()
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error":       message,
+			"redirectURL": "/admin?error=" + message,
+		})
+	} else if err != nil {
+		a.handleLogger("Error applying site map import: " + err.Error())
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error":       "Error applying site map import",
+			"redirectURL": "/admin?error=Error applying site map import",
+		})
+	}
+
+	message := fmt.Sprintf("Site map imported, %d buildings added, %d buildings moved and %d rooms added",
+		result.BuildingsCreated, result.BuildingsUpdated, result.RoomsCreated)
+	return c.JSON(http.StatusOK, map[string]string{
+		"message":     message,
+		"redirectURL": "/admin?message=" + message,
+	})
+}
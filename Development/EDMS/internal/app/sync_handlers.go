@@ -0,0 +1,355 @@
+package app
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	maxSyncBatchSize = 100
+	// Offline devices keep their own time, allow them to run a little fast
+	maxSyncClockSkew = 5 * time.Minute
+)
+
+var clientUUIDPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// HandleGetSyncSnapshot returns the devices, rooms and checklists of a site, or of one of
+// its buildings, for recording inspections offline
+func (a *App) HandleGetSyncSnapshot(c echo.Context) error {
+	// Check if request if a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+
+	siteID, err := strconv.Atoi(c.QueryParam("site_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid site ID"})
+	}
+
+	var buildingID sql.NullInt64
+	if value := c.QueryParam("building_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid building ID"})
+		}
+		building, err := a.DB.GetBuildingById(id)
+		if err != nil || building.SiteID != siteID {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Building not found on this site"})
+		}
+		buildingID = sql.NullInt64{Int64: int64(id), Valid: true}
+	}
+
+	snapshot, err := a.DB.GetSyncSnapshot(siteID, buildingID)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Site not found"})
+	} else if err != nil {
+		a.handleLogger("Error fetching sync snapshot: " + err.Error())
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Error fetching data"})
+	}
+
+	// Return the results as JSON
+	return c.JSON(http.StatusOK, snapshot)
+}
+
+// HandlePostSyncInspections records a batch of inspections made offline. Each inspection
+// is recorded on its own and reported back by its client UUID, so the client can retry
+// the whole batch safely. Inspections of devices edited, moved or inspected since the
+// snapshot are reported as conflicts and only recorded once resent with accept_conflicts.
+func (a *App) HandlePostSyncInspections(c echo.Context) error {
+	// Check if request is not a post request
+	if c.Request().Method != http.MethodPost {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+
+	var uploadDto models.SyncUploadDto
+	if err := c.Bind(&uploadDto); err != nil {
+		a.handleLogger("Error binding request body: " + err.Error())
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	if uploadDto.SnapshotAt.IsZero() {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "snapshot_at is required"})
+	}
+	if len(uploadDto.Inspections) == 0 || len(uploadDto.Inspections) > maxSyncBatchSize {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("A batch must contain between 1 and %d inspections", maxSyncBatchSize),
+		})
+	}
+
+	// The inspector is whoever is logged in, not a user ID sent by the client
+	userID, _, err := currentUser(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	response := models.SyncUploadResponse{Results: []models.SyncResult{}}
+	for i := range uploadDto.Inspections {
+		result := a.syncInspection(c, userID, uploadDto.SnapshotAt, &uploadDto.Inspections[i])
+		if result.Result == models.SyncResultCreated {
+			response.Created++
+		} else {
+			response.Skipped++
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	a.handleLogger(fmt.Sprintf("Sync upload by userID=%d: %d created, %d skipped", userID, response.Created, response.Skipped))
+
+	return c.JSON(http.StatusOK, response)
+}
+
+func (a *App) syncInspection(c echo.Context, userID int, snapshotAt time.Time, dto *models.SyncInspectionDto) models.SyncResult {
+	clientUUID := strings.ToLower(strings.TrimSpace(dto.ClientUUID))
+	result := models.SyncResult{ClientUUID: clientUUID}
+	reject := func(err error) models.SyncResult {
+		result.Result = models.SyncResultRejected
+		result.Error = err.Error()
+		return result
+	}
+
+	if !clientUUIDPattern.MatchString(clientUUID) {
+		return reject(errors.New("client_uuid must be a UUID"))
+	}
+
+	// A retried upload returns the inspection recorded the first time
+	if a.findSyncedInspection(clientUUID, &result) {
+		return result
+	}
+
+	device, err := a.DB.GetDeviceByID(dto.EmergencyDeviceID)
+	if err == sql.ErrNoRows {
+		result.Conflicts = []models.SyncConflict{{
+			Type:    models.SyncConflictDeviceDeleted,
+			Message: "The device no longer exists",
+		}}
+		return reject(errors.New("device not found"))
+	} else if err != nil {
+		a.handleLogger("Error fetching device for sync: " + err.Error())
+		return reject(errors.New("error fetching device"))
+	}
+	if device.BuildingArchived {
+		result.Conflicts = []models.SyncConflict{{
+			Type:    models.SyncConflictBuildingArchived,
+			Message: "The device's building has been archived",
+		}}
+		return reject(errors.New("devices of an archived building cannot be inspected"))
+	}
+
+	state, err := a.DB.GetSyncDeviceState(device.EmergencyDeviceID, snapshotAt)
+	if err != nil {
+		a.handleLogger("Error fetching device state for sync: " + err.Error())
+		return reject(errors.New("error fetching device"))
+	}
+	result.Conflicts = syncConflicts(state, dto)
+	if len(result.Conflicts) > 0 && !dto.AcceptConflicts {
+		result.Result = models.SyncResultConflict
+		return result
+	}
+
+	inspection, responses, err := a.validateSyncInspection(c, userID, device, dto)
+	if err != nil {
+		return reject(err)
+	}
+	inspection.ClientUUID = sql.NullString{String: clientUUID, Valid: true}
+	if err := a.sealInspection(inspection, responses); err != nil {
+		a.removeResponsePhotos(responses)
+		a.removeSignatureImage(inspection)
+		a.handleLogger("Error sealing synced inspection: " + err.Error())
+		return reject(errors.New("error saving inspection"))
+	}
+
+	inspectionID, err := a.DB.AddInspection(inspection, responses)
+	if err != nil {
+		a.removeResponsePhotos(responses)
+		a.removeSignatureImage(inspection)
+		// The same inspection may have been uploaded by a concurrent retry
+		if a.findSyncedInspection(clientUUID, &result) {
+			return result
+		}
+		a.handleLogger("Error saving synced inspection: " + err.Error())
+		return reject(errors.New("error saving inspection"))
+	}
+
+	result.Result = models.SyncResultCreated
+	result.EmergencyDeviceInspectionID = inspectionID
+	result.InspectionStatus = inspection.InspectionStatus
+	return result
+}
+
+func (a *App) findSyncedInspection(clientUUID string, result *models.SyncResult) bool {
+	inspectionID, status, err := a.DB.GetInspectionByClientUUID(clientUUID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			a.handleLogger("Error checking client UUID: " + err.Error())
+		}
+		return false
+	}
+
+	result.Result = models.SyncResultDuplicate
+	result.EmergencyDeviceInspectionID = inspectionID
+	result.InspectionStatus = status
+	return true
+}
+
+func syncConflicts(state *models.SyncDeviceState, dto *models.SyncInspectionDto) []models.SyncConflict {
+	var conflicts []models.SyncConflict
+
+	if state.RoomID != dto.RoomID {
+		conflicts = append(conflicts, models.SyncConflict{
+			Type:    models.SyncConflictDeviceRelocated,
+			Message: fmt.Sprintf("The device has been moved to %s %s", state.BuildingCode, state.RoomCode),
+		})
+	}
+	if state.Changed {
+		conflicts = append(conflicts, models.SyncConflict{
+			Type:    models.SyncConflictDeviceChanged,
+			Message: "The device has been edited since the snapshot was taken",
+		})
+	}
+	if state.Status.String == "Inactive" {
+		conflicts = append(conflicts, models.SyncConflict{
+			Type:    models.SyncConflictDeviceInactive,
+			Message: "The device is inactive",
+		})
+	}
+	if state.InspectedSince {
+		conflicts = append(conflicts, models.SyncConflict{
+			Type:    models.SyncConflictInspectedSince,
+			Message: "The device has been inspected since the snapshot was taken",
+		})
+	}
+
+	return conflicts
+}
+
+// validateSyncInspection builds the inspection the same way as HandlePostInspection, the
+// checklist answers are checked against the template version the client used
+func (a *App) validateSyncInspection(c echo.Context, userID int, device *models.EmergencyDevice, dto *models.SyncInspectionDto) (*models.Inspection, []models.InspectionResponse, error) {
+	if dto.InspectionDateTime.IsZero() {
+		return nil, nil, errors.New("inspection_datetime is required")
+	}
+	if dto.InspectionDateTime.After(time.Now().Add(maxSyncClockSkew)) {
+		return nil, nil, errors.New("inspection date and time cannot be in the future")
+	}
+
+	// Validate notes length is less than 255 characters
+	if len(dto.Notes) > 255 {
+		return nil, nil, errors.New("notes must be less than 255 characters")
+	}
+
+	inspection := &models.Inspection{
+		EmergencyDeviceID:  device.EmergencyDeviceID,
+		UserID:             userID,
+		InspectionDateTime: sql.NullTime{Time: dto.InspectionDateTime.In(a.siteLocation(device.SiteTimeZone)), Valid: true},
+		Notes:              sql.NullString{String: dto.Notes, Valid: true},
+		WorkOrderRequired:  sql.NullBool{Bool: dto.WorkOrderRequired, Valid: true},
+	}
+
+	var responses []models.InspectionResponse
+	if dto.ChecklistTemplateID != 0 {
+		template, err := a.DB.GetChecklistTemplateByID(dto.ChecklistTemplateID)
+		if err != nil {
+			return nil, nil, errors.New("checklist template not found")
+		}
+		if template.EmergencyDeviceTypeID != device.EmergencyDeviceTypeID {
+			return nil, nil, errors.New("the checklist template is for another device type")
+		}
+		responses, err = a.syncChecklistAnswers(c, template, userID, dto)
+		if err != nil {
+			return nil, nil, err
+		}
+		inspection.ChecklistTemplateID = sql.NullInt64{Int64: int64(template.ChecklistTemplateID), Valid: true}
+	} else if _, err := a.DB.GetLatestChecklistTemplate(device.EmergencyDeviceTypeID); err == nil {
+		return nil, nil, errors.New("checklist answers are required for " + device.EmergencyDeviceTypeName)
+	} else if err != sql.ErrNoRows {
+		a.handleLogger("Error fetching checklist template: " + err.Error())
+		return nil, nil, errors.New("error fetching checklist")
+	}
+
+	if err := a.resolveInspectionStatus(c, inspection, responses, dto.InspectionStatus, dto.OverrideJustification); err != nil {
+		a.removeResponsePhotos(responses)
+		return nil, nil, err
+	}
+
+	if err := a.signInspection(c, inspection, &dto.Signature); err != nil {
+		a.removeResponsePhotos(responses)
+		return nil, nil, err
+	}
+
+	return inspection, responses, nil
+}
+
+// syncChecklistAnswers reads the answers of an offline inspection, photos are sent base64 encoded
+func (a *App) syncChecklistAnswers(c echo.Context, template *models.ChecklistTemplate, userID int, dto *models.SyncInspectionDto) ([]models.InspectionResponse, error) {
+	var responses []models.InspectionResponse
+
+	fail := func(err error) ([]models.InspectionResponse, error) {
+		a.removeResponsePhotos(responses)
+		return nil, err
+	}
+
+	questionIDs := make(map[string]bool)
+	for _, question := range template.Questions {
+		key := strconv.Itoa(question.ChecklistQuestionID)
+		questionIDs[key] = true
+
+		response := models.InspectionResponse{
+			ChecklistQuestionID: question.ChecklistQuestionID,
+			QuestionText:        question.QuestionText,
+			AnswerType:          question.AnswerType,
+			Severity:            question.Severity,
+		}
+		if question.AnswerType == models.AnswerTypePhoto {
+			if photoDto, ok := dto.Photos[key]; ok {
+				if base64.StdEncoding.DecodedLen(len(photoDto.Data)) > maxAttachmentSize {
+					return fail(fmt.Errorf("%s: File is too large, maximum size 10 MB", question.QuestionText))
+				}
+				data, err := base64.StdEncoding.DecodeString(photoDto.Data)
+				if err != nil {
+					return fail(fmt.Errorf("%s: photo must be base64 encoded", question.QuestionText))
+				}
+				photo := &models.Attachment{
+					Description: sql.NullString{String: question.QuestionText, Valid: true},
+					UploadedBy:  userID,
+				}
+				if err := a.storeAttachmentData(c.Request().Context(), photo, photoDto.FileName, data, allowedPhotoTypes); err != nil {
+					return fail(fmt.Errorf("%s: %v", question.QuestionText, err))
+				}
+				response.Photo = photo
+			}
+		} else if err := setChecklistAnswer(&response, question, dto.Answers[key]); err != nil {
+			return fail(err)
+		}
+
+		answered := response.AnswerYesNo.Valid || response.AnswerNumber.Valid || response.AnswerText.Valid || response.Photo != nil
+		if question.IsRequired && !answered {
+			return fail(fmt.Errorf("%s is required", question.QuestionText))
+		}
+		if answered {
+			responses = append(responses, response)
+		}
+	}
+
+	for key := range dto.Answers {
+		if !questionIDs[key] {
+			return fail(fmt.Errorf("question %s is not part of this checklist", key))
+		}
+	}
+	for key := range dto.Photos {
+		if !questionIDs[key] {
+			return fail(fmt.Errorf("question %s is not part of this checklist", key))
+		}
+	}
+
+	return responses, nil
+}
@@ -0,0 +1,347 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/scheduler"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/webhook"
+	"github.com/labstack/echo/v4"
+)
+
+// Most deliveries sent per run, the rest wait for the next one
+const webhookDeliveryBatch = 100
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// DeliverWebhooks queues new events for the endpoints subscribed to them, then sends the
+// deliveries that are due. A failed delivery is retried with backoff until it runs out
+// of attempts and is dead-lettered.
+func (a *App) DeliverWebhooks(ctx context.Context) error {
+	queued, err := a.DB.DispatchWebhookEvents()
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := a.DB.GetDueWebhookDeliveries(webhookDeliveryBatch)
+	if err != nil {
+		return err
+	}
+
+	delivered, dead := 0, 0
+	var errs []error
+	for _, delivery := range deliveries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		result := webhook.Send(ctx, webhookClient, webhook.Delivery{
+			ID:     delivery.WebhookDeliveryID,
+			Event:  delivery.EventType,
+			URL:    delivery.URL,
+			Secret: delivery.Secret,
+			Body:   delivery.Payload,
+		}, now)
+
+		attempt := models.WebhookDeliveryAttempt{
+			WebhookDeliveryID: delivery.WebhookDeliveryID,
+			ResponseStatus:    sql.NullInt64{Int64: int64(result.StatusCode), Valid: result.StatusCode != 0},
+			ResponseBody:      sql.NullString{String: result.ResponseBody, Valid: result.StatusCode != 0},
+			DurationMS:        int(result.Duration.Milliseconds()),
+		}
+		if result.Err != nil {
+			attempt.Error = sql.NullString{String: result.Err.Error(), Valid: true}
+		}
+
+		attempts := delivery.Attempts + 1
+		isDead := !result.OK() && attempts >= webhook.MaxAttempts
+		err := a.DB.RecordWebhookAttempt(attempt, result.OK(), isDead, now.Add(webhook.Backoff(attempts)))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("recording webhook delivery %d: %w", delivery.WebhookDeliveryID, err))
+			continue
+		}
+		if result.OK() {
+			delivered++
+		} else if isDead {
+			dead++
+		}
+	}
+
+	if queued > 0 || delivered > 0 || dead > 0 {
+		a.handleLogger(fmt.Sprintf("Webhooks queued: %d, delivered: %d, dead-lettered: %d", queued, delivered, dead))
+	}
+	return errors.Join(errs...)
+}
+
+// deliverWebhooksSoon sends due deliveries without waiting for the next scheduled run
+func (a *App) deliverWebhooksSoon() {
+	go func() {
+		// When another replica is delivering, it sends the new deliveries too
+		err := a.Scheduler.RunNow(context.Background(), jobDeliverWebhooks)
+		if err != nil && !errors.Is(err, scheduler.ErrJobLocked) {
+			a.handleLogger("Error delivering webhooks: " + err.Error())
+		}
+	}()
+}
+
+// HandleGetWebhooks returns every webhook endpoint and the events they can subscribe to
+func (a *App) HandleGetWebhooks(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	endpoints, err := a.DB.GetAllWebhookEndpoints()
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"endpoints": endpoints,
+		"events":    webhook.Events,
+	})
+}
+
+// HandlePostWebhook adds a webhook endpoint. Its signing secret is only returned here.
+func (a *App) HandlePostWebhook(c echo.Context) error {
+	// Check if request is a POST request
+	if c.Request().Method != http.MethodPost {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+
+	var dto models.WebhookEndpointDto
+	if err := c.Bind(&dto); err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid request", err)
+	}
+	endpoint, err := parseWebhookEndpoint(dto)
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, err.Error(), err)
+	}
+
+	endpoint.Secret, err = webhook.NewSecret()
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error adding webhook", err)
+	}
+
+	endpoint.WebhookEndpointID, err = a.DB.AddWebhookEndpoint(endpoint)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error adding webhook", err)
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"message":             "Webhook added successfully",
+		"webhook_endpoint_id": endpoint.WebhookEndpointID,
+		"secret":              endpoint.Secret,
+	})
+}
+
+// HandlePutWebhook updates a webhook endpoint, its secret is kept
+func (a *App) HandlePutWebhook(c echo.Context) error {
+	// Check if request is a PUT request
+	if c.Request().Method != http.MethodPut {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+
+	endpointID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid webhook ID", err)
+	}
+
+	var dto models.WebhookEndpointDto
+	if err := c.Bind(&dto); err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid request", err)
+	}
+	endpoint, err := parseWebhookEndpoint(dto)
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, err.Error(), err)
+	}
+	endpoint.WebhookEndpointID = endpointID
+
+	err = a.DB.UpdateWebhookEndpoint(endpoint)
+	if err == sql.ErrNoRows {
+		return a.handleError(c, http.StatusNotFound, "Webhook not found", err)
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error updating webhook", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Webhook updated successfully"})
+}
+
+// HandleDeleteWebhook removes a webhook endpoint and its delivery log
+func (a *App) HandleDeleteWebhook(c echo.Context) error {
+	// Check if request is a DELETE request
+	if c.Request().Method != http.MethodDelete {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+
+	endpointID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid webhook ID", err)
+	}
+
+	err = a.DB.DeleteWebhookEndpoint(endpointID)
+	if err == sql.ErrNoRows {
+		return a.handleError(c, http.StatusNotFound, "Webhook not found", err)
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error deleting webhook", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Webhook deleted successfully"})
+}
+
+// HandlePingWebhook sends a test event to a webhook endpoint
+func (a *App) HandlePingWebhook(c echo.Context) error {
+	// Check if request is a POST request
+	if c.Request().Method != http.MethodPost {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+
+	endpointID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid webhook ID", err)
+	}
+
+	deliveryID, err := a.DB.AddWebhookPing(endpointID, webhook.EventPing)
+	if err == sql.ErrNoRows {
+		return a.handleError(c, http.StatusNotFound, "Webhook not found", err)
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error sending ping", err)
+	}
+	a.deliverWebhooksSoon()
+
+	return c.JSON(http.StatusAccepted, map[string]interface{}{
+		"message":             "Ping queued",
+		"webhook_delivery_id": deliveryID,
+	})
+}
+
+// HandleGetWebhookDeliveries returns the delivery log, optionally for ?endpoint_id and
+// ?status. ?status=Dead lists the dead-lettered deliveries.
+func (a *App) HandleGetWebhookDeliveries(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	endpointID := 0
+	if endpointIDStr := c.QueryParam("endpoint_id"); endpointIDStr != "" {
+		parsed, err := strconv.Atoi(endpointIDStr)
+		if err != nil {
+			return a.handleError(c, http.StatusBadRequest, "Invalid webhook ID", err)
+		}
+		endpointID = parsed
+	}
+
+	status := c.QueryParam("status")
+	switch status {
+	case "", models.WebhookDeliveryStatusPending, models.WebhookDeliveryStatusSucceeded, models.WebhookDeliveryStatusDead:
+	default:
+		return a.handleError(c, http.StatusBadRequest, "Invalid status", fmt.Errorf("invalid webhook delivery status %q", status))
+	}
+
+	limit := 50
+	if limitStr := c.QueryParam("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 || parsed > 500 {
+			return a.handleError(c, http.StatusBadRequest, "Invalid limit", err)
+		}
+		limit = parsed
+	}
+
+	deliveries, err := a.DB.GetWebhookDeliveries(endpointID, status, limit)
+	if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	return c.JSON(http.StatusOK, deliveries)
+}
+
+// HandleGetWebhookDelivery returns a delivery with each attempt to send it
+func (a *App) HandleGetWebhookDelivery(c echo.Context) error {
+	// Check if request is a GET request
+	if c.Request().Method != http.MethodGet {
+		return c.Redirect(http.StatusSeeOther, "/dashboard?error=Method not allowed")
+	}
+
+	deliveryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid delivery ID", err)
+	}
+
+	delivery, err := a.DB.GetWebhookDeliveryByID(deliveryID)
+	if err == sql.ErrNoRows {
+		return a.handleError(c, http.StatusNotFound, "Delivery not found", err)
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error fetching data", err)
+	}
+
+	return c.JSON(http.StatusOK, delivery)
+}
+
+// HandleRedeliverWebhook sends a delivery again, including a dead-lettered one, with a
+// fresh set of attempts
+func (a *App) HandleRedeliverWebhook(c echo.Context) error {
+	// Check if request is a POST request
+	if c.Request().Method != http.MethodPost {
+		return c.JSON(http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+
+	deliveryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return a.handleError(c, http.StatusBadRequest, "Invalid delivery ID", err)
+	}
+
+	err = a.DB.RedeliverWebhook(deliveryID)
+	if err == sql.ErrNoRows {
+		return a.handleError(c, http.StatusNotFound, "Delivery not found", err)
+	} else if err != nil {
+		return a.handleError(c, http.StatusInternalServerError, "Error redelivering webhook", err)
+	}
+	a.deliverWebhooksSoon()
+
+	return c.JSON(http.StatusAccepted, map[string]string{"message": "Redelivery queued"})
+}
+
+// parseWebhookEndpoint checks an endpoint's URL and events
+func parseWebhookEndpoint(dto models.WebhookEndpointDto) (models.WebhookEndpoint, error) {
+	endpoint := models.WebhookEndpoint{
+		Description: strings.TrimSpace(dto.Description),
+		URL:         strings.TrimSpace(dto.URL),
+		Active:      dto.Active,
+	}
+	if len(endpoint.Description) > 100 {
+		return endpoint, errors.New("description must be up to 100 characters")
+	}
+
+	parsed, err := url.Parse(endpoint.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return endpoint, errors.New("please enter an http or https URL")
+	}
+	if len(endpoint.URL) > 2048 {
+		return endpoint, errors.New("URL must be up to 2048 characters")
+	}
+
+	if len(dto.Events) == 0 {
+		return endpoint, errors.New("please subscribe to at least one event")
+	}
+	for _, event := range dto.Events {
+		if !slices.Contains(webhook.Events, event) {
+			return endpoint, fmt.Errorf("unknown event %q", event)
+		}
+		if !slices.Contains(endpoint.Events, event) {
+			endpoint.Events = append(endpoint.Events, event)
+		}
+	}
+
+	return endpoint, nil
+}
@@ -4,6 +4,10 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/storage"
 
 	"github.com/joho/godotenv"
 )
@@ -16,6 +20,15 @@ type Config struct {
 	DBPort        int
 	AdminPassword string
 	JWTSecret     string
+	SigningKey    string
+	BaseURL       string
+	TimeZone      string
+	Storage       storage.Config
+	SMTPHost      string
+	SMTPPort      int
+	SMTPUsername  string
+	SMTPPassword  string
+	MailFrom      string
 }
 
 func LoadConfig() Config {
@@ -55,6 +68,64 @@ func LoadConfig() Config {
 		log.Fatalf("Invalid DB_PORT value: %v", err)
 	}
 
+	// Uploaded files are kept outside the public static tree, default to ./uploads
+	uploadDir := os.Getenv("UPLOAD_DIR")
+	if uploadDir == "" {
+		uploadDir = "uploads"
+	}
+
+	// STORAGE_BACKEND=s3 keeps uploads in an S3-compatible bucket so they survive redeploys
+	storageCfg := storage.Config{
+		Backend:     os.Getenv("STORAGE_BACKEND"),
+		LocalDir:    uploadDir,
+		S3Endpoint:  os.Getenv("S3_ENDPOINT"),
+		S3Region:    os.Getenv("S3_REGION"),
+		S3Bucket:    os.Getenv("S3_BUCKET"),
+		S3AccessKey: os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey: os.Getenv("S3_SECRET_KEY"),
+	}
+
+	// Key for the tamper-evident hash of inspections, changing it makes earlier
+	// inspections fail verification so it defaults to the JWT secret
+	signingKey := os.Getenv("INSPECTION_SIGNING_KEY")
+	if signingKey == "" {
+		signingKey = os.Getenv("JWT_SECRET")
+	}
+
+	// Address the app is reached at, used for links in emails
+	baseURL := strings.TrimRight(os.Getenv("APP_URL"), "/")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+
+	// Time zone of dates that are not for one site, such as digests and report footers,
+	// and the zone suggested for new sites
+	timeZone := os.Getenv("TIME_ZONE")
+	if timeZone == "" {
+		timeZone = "Pacific/Auckland"
+	}
+	if _, err := time.LoadLocation(timeZone); err != nil {
+		log.Fatalf("Invalid TIME_ZONE value: %v", err)
+	}
+
+	// Mail server for password resets, digests and escalations. Emails are not sent
+	// until SMTP_USERNAME and SMTP_PASSWORD are set.
+	smtpHost := os.Getenv("SMTP_HOST")
+	if smtpHost == "" {
+		smtpHost = "smtp.gmail.com"
+	}
+	smtpPort := 587
+	if smtpPortStr := os.Getenv("SMTP_PORT"); smtpPortStr != "" {
+		smtpPort, err = strconv.Atoi(smtpPortStr)
+		if err != nil {
+			log.Fatalf("Invalid SMTP_PORT value: %v", err)
+		}
+	}
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = os.Getenv("SMTP_USERNAME")
+	}
+
 	// Create and return the config
 	return Config{
 		DBUser:        os.Getenv("DB_USER"),
@@ -64,5 +135,14 @@ func LoadConfig() Config {
 		DBPort:        dbPort,
 		AdminPassword: os.Getenv("ADMIN_PASSWORD"),
 		JWTSecret:     os.Getenv("JWT_SECRET"),
+		SigningKey:    signingKey,
+		BaseURL:       baseURL,
+		TimeZone:      timeZone,
+		Storage:       storageCfg,
+		SMTPHost:      smtpHost,
+		SMTPPort:      smtpPort,
+		SMTPUsername:  os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:  os.Getenv("SMTP_PASSWORD"),
+		MailFrom:      mailFrom,
 	}
 }
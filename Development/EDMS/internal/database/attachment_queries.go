@@ -0,0 +1,185 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+)
+
+// ErrAttachmentIsAnswer is returned when deleting an attachment that is the photo answer
+// of an inspection checklist, which is part of the inspection record
+var ErrAttachmentIsAnswer = errors.New("attachment is a checklist answer of an inspection")
+
+const attachmentColumns = `
+	a.attachmentid, a.emergencydeviceid, a.emergencydeviceinspectionid, a.workorderinspectionid, a.filename, a.contenttype, a.sizebytes,
+	a.storagekey, a.thumbnailkey, a.description, a.uploadedby, u.username, a.uploadedat,
+	EXISTS (SELECT 1 FROM inspection_responseT r WHERE r.attachmentid = a.attachmentid)
+`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// rowQuerier is satisfied by both DB and a transaction
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func scanAttachment(row rowScanner) (*models.Attachment, error) {
+	var attachment models.Attachment
+	err := row.Scan(
+		&attachment.AttachmentID,
+		&attachment.EmergencyDeviceID,
+		&attachment.EmergencyDeviceInspectionID,
+		&attachment.WorkOrderInspectionID,
+		&attachment.FileName,
+		&attachment.ContentType,
+		&attachment.SizeBytes,
+		&attachment.StorageKey,
+		&attachment.ThumbnailKey,
+		&attachment.Description,
+		&attachment.UploadedBy,
+		&attachment.UploaderName,
+		&attachment.UploadedAt,
+		&attachment.IsAnswer,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	attachment.HasThumbnail = attachment.ThumbnailKey.Valid
+
+	return &attachment, nil
+}
+
+func (db *DB) getAttachments(where string, args ...interface{}) ([]models.Attachment, error) {
+	query := `
+	SELECT ` + attachmentColumns + `
+	FROM attachmentT a
+	JOIN userT u ON a.uploadedby = u.userid
+	WHERE ` + where + `
+	ORDER BY a.uploadedat DESC
+	`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []models.Attachment{}
+
+	// Scan the results
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		attachments = append(attachments, *attachment)
+	}
+
+	return attachments, nil
+}
+
+func (db *DB) GetAttachmentsByDeviceID(deviceID int) ([]models.Attachment, error) {
+	return db.getAttachments("a.emergencydeviceid = $1", deviceID)
+}
+
+func (db *DB) GetAttachmentsByInspectionID(inspectionID int) ([]models.Attachment, error) {
+	return db.getAttachments("a.emergencydeviceinspectionid = $1", inspectionID)
+}
+
+// GetAttachmentsByWorkOrderID returns the attachments of the work order raised by an
+// inspection
+func (db *DB) GetAttachmentsByWorkOrderID(inspectionID int) ([]models.Attachment, error) {
+	return db.getAttachments("a.workorderinspectionid = $1", inspectionID)
+}
+
+// GetAttachmentsForDeviceTree returns the device's own attachments and those of all its
+// inspections and their work orders
+func (db *DB) GetAttachmentsForDeviceTree(deviceID int) ([]models.Attachment, error) {
+	return db.getAttachments(`a.emergencydeviceid = $1 OR a.emergencydeviceinspectionid IN (
+		SELECT emergencydeviceinspectionid FROM emergency_device_inspectionT WHERE emergencydeviceid = $1
+	) OR a.workorderinspectionid IN (
+		SELECT emergencydeviceinspectionid FROM emergency_device_inspectionT WHERE emergencydeviceid = $1
+	)`, deviceID)
+}
+
+func (db *DB) GetAttachmentByID(attachmentID int) (*models.Attachment, error) {
+	query := `
+	SELECT ` + attachmentColumns + `
+	FROM attachmentT a
+	JOIN userT u ON a.uploadedby = u.userid
+	WHERE a.attachmentid = $1
+	`
+
+	return scanAttachment(db.QueryRow(query, attachmentID))
+}
+
+// AddAttachment inserts the attachment and returns its new ID
+func (db *DB) AddAttachment(attachment *models.Attachment) (int, error) {
+	return insertAttachment(db, attachment)
+}
+
+func insertAttachment(q rowQuerier, attachment *models.Attachment) (int, error) {
+	query := `
+	INSERT INTO attachmentT (emergencydeviceid, emergencydeviceinspectionid, workorderinspectionid, filename, contenttype, sizebytes, storagekey, thumbnailkey, description, uploadedby, sha256)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	RETURNING attachmentid
+	`
+
+	var attachmentID int
+	err := q.QueryRow(query,
+		attachment.EmergencyDeviceID,
+		attachment.EmergencyDeviceInspectionID,
+		attachment.WorkOrderInspectionID,
+		attachment.FileName,
+		attachment.ContentType,
+		attachment.SizeBytes,
+		attachment.StorageKey,
+		attachment.ThumbnailKey,
+		attachment.Description,
+		attachment.UploadedBy,
+		attachment.SHA256,
+	).Scan(&attachmentID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return attachmentID, nil
+}
+
+// DeleteAttachment deletes an attachment unless it is the photo answer of an inspection
+// checklist, when ErrAttachmentIsAnswer is returned
+func (db *DB) DeleteAttachment(attachmentID int) error {
+	query := `
+	DELETE FROM attachmentT a
+	WHERE a.attachmentid = $1
+	  AND NOT EXISTS (SELECT 1 FROM inspection_responseT r WHERE r.attachmentid = a.attachmentid)
+	`
+	deleteStmt, err := db.Prepare(query)
+	if err != nil {
+		return err
+	}
+
+	defer deleteStmt.Close()
+
+	res, err := deleteStmt.Exec(attachmentID)
+	if err != nil {
+		return err
+	}
+
+	// The attachment was found before it was deleted, so only an answer is left behind
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrAttachmentIsAnswer
+	}
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package database
+
+import (
+	"encoding/json"
+)
+
+// encodeMapPolygon returns a building outline as the JSON stored in BuildingT.MapPolygon,
+// or nil when the building has no outline
+func encodeMapPolygon(polygon [][2]float64) (interface{}, error) {
+	if len(polygon) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(polygon)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// decodeMapPolygon reads a building outline stored in BuildingT.MapPolygon
+func decodeMapPolygon(data []byte) ([][2]float64, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var polygon [][2]float64
+	if err := json.Unmarshal(data, &polygon); err != nil {
+		return nil, err
+	}
+	return polygon, nil
+}
@@ -0,0 +1,157 @@
+package database
+
+import (
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/lib/pq"
+)
+
+// GetCalendarFeed returns the user's calendar feed, or sql.ErrNoRows if they have none
+func (db *DB) GetCalendarFeed(userID int) (models.CalendarFeed, error) {
+	var feed models.CalendarFeed
+	err := db.QueryRow(`
+	SELECT userid, token, createdat, lastfetchedat
+	FROM calendar_feedT
+	WHERE userid = $1
+	`, userID).Scan(&feed.UserID, &feed.Token, &feed.CreatedAt, &feed.LastFetchedAt)
+	return feed, err
+}
+
+// GetCalendarFeedByToken returns the calendar feed with the token, or sql.ErrNoRows
+func (db *DB) GetCalendarFeedByToken(token string) (models.CalendarFeed, error) {
+	var feed models.CalendarFeed
+	err := db.QueryRow(`
+	SELECT userid, token, createdat, lastfetchedat
+	FROM calendar_feedT
+	WHERE token = $1
+	`, token).Scan(&feed.UserID, &feed.Token, &feed.CreatedAt, &feed.LastFetchedAt)
+	return feed, err
+}
+
+// SaveCalendarFeed gives the user a feed with the token, replacing any earlier token
+func (db *DB) SaveCalendarFeed(userID int, token string) error {
+	_, err := db.Exec(`
+	INSERT INTO calendar_feedT (userid, token)
+	VALUES ($1, $2)
+	ON CONFLICT (userid) DO UPDATE
+	SET token = EXCLUDED.token, createdat = CURRENT_TIMESTAMP, lastfetchedat = NULL
+	`, userID, token)
+	return err
+}
+
+// DeleteCalendarFeed removes the user's feed, its URL stops working
+func (db *DB) DeleteCalendarFeed(userID int) error {
+	_, err := db.Exec(`DELETE FROM calendar_feedT WHERE userid = $1`, userID)
+	return err
+}
+
+// MarkCalendarFeedFetched records when a calendar app last fetched the feed
+func (db *DB) MarkCalendarFeedFetched(userID int) error {
+	_, err := db.Exec(`UPDATE calendar_feedT SET lastfetchedat = CURRENT_TIMESTAMP WHERE userid = $1`, userID)
+	return err
+}
+
+// GetFollowedSiteIDs returns the IDs of the sites the user follows
+func (db *DB) GetFollowedSiteIDs(userID int) ([]int, error) {
+	rows, err := db.Query(`SELECT siteid FROM site_followT WHERE userid = $1 ORDER BY siteid`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	siteIDs := []int{}
+	for rows.Next() {
+		var siteID int
+		if err := rows.Scan(&siteID); err != nil {
+			return nil, err
+		}
+		siteIDs = append(siteIDs, siteID)
+	}
+
+	return siteIDs, rows.Err()
+}
+
+// SetFollowedSites makes the user follow exactly the given sites
+func (db *DB) SetFollowedSites(userID int, siteIDs []int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ids := make([]int64, len(siteIDs))
+	for i, siteID := range siteIDs {
+		ids[i] = int64(siteID)
+	}
+
+	_, err = tx.Exec(`DELETE FROM site_followT WHERE userid = $1 AND NOT siteid = ANY($2)`, userID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+	INSERT INTO site_followT (userid, siteid)
+	SELECT $1, siteid FROM siteT WHERE siteid = ANY($2)
+	ON CONFLICT DO NOTHING
+	`, userID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetCalendarDevices returns the devices at the sites the user follows with their next
+// inspection and expiry dates, leaving out inactive devices
+func (db *DB) GetCalendarDevices(userID int) ([]models.EmergencyDevice, error) {
+	rows, err := db.Query(`
+	SELECT
+		ed.emergencydeviceid,
+		edt.emergencydevicetypename,
+		r.roomcode,
+		b.buildingcode,
+		s.siteid,
+		s.sitename,
+		s.timezone,
+		ed.serialnumber,
+		ed.manufacturedate,
+		ed.LastInspectionDateTime,
+		ed.status
+	FROM site_followT f
+	JOIN siteT s ON f.siteid = s.siteid
+	JOIN buildingT b ON b.siteid = s.siteid
+	JOIN roomT r ON r.buildingid = b.buildingid
+	JOIN emergency_deviceT ed ON ed.roomid = r.roomid
+	JOIN emergency_device_typeT edt ON ed.emergencydevicetypeid = edt.emergencydevicetypeid
+	WHERE f.userid = $1
+	  AND COALESCE(ed.status, '') <> 'Inactive'
+	ORDER BY s.sitename, b.buildingcode, r.roomcode, ed.emergencydeviceid
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []models.EmergencyDevice{}
+	for rows.Next() {
+		var device models.EmergencyDevice
+		err := rows.Scan(
+			&device.EmergencyDeviceID,
+			&device.EmergencyDeviceTypeName,
+			&device.RoomCode,
+			&device.BuildingCode,
+			&device.SiteID,
+			&device.SiteName,
+			&device.SiteTimeZone,
+			&device.SerialNumber,
+			&device.ManufactureDate,
+			&device.LastInspectionDateTime,
+			&device.Status,
+		)
+		if err != nil {
+			return nil, err
+		}
+		calculateDeviceDates(&device)
+		devices = append(devices, device)
+	}
+
+	return devices, rows.Err()
+}
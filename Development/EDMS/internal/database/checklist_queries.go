@@ -0,0 +1,312 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+)
+
+const checklistTemplateColumns = `
+	ct.checklisttemplateid, ct.emergencydevicetypeid, edt.emergencydevicetypename, ct.templatename, ct.version,
+	ct.createdby, ct.createdat,
+	(SELECT COUNT(*) FROM emergency_device_inspectionT edi WHERE edi.checklisttemplateid = ct.checklisttemplateid) AS inspectioncount
+`
+
+func scanChecklistTemplate(row rowScanner) (*models.ChecklistTemplate, error) {
+	var template models.ChecklistTemplate
+	err := row.Scan(
+		&template.ChecklistTemplateID,
+		&template.EmergencyDeviceTypeID,
+		&template.EmergencyDeviceTypeName,
+		&template.TemplateName,
+		&template.Version,
+		&template.CreatedBy,
+		&template.CreatedAt,
+		&template.InspectionCount,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &template, nil
+}
+
+// GetAllChecklistTemplates returns every template version, optionally limited to a device type
+func (db *DB) GetAllChecklistTemplates(deviceTypeID string) ([]models.ChecklistTemplate, error) {
+	query := `
+	SELECT ` + checklistTemplateColumns + `
+	FROM checklist_templateT ct
+	JOIN emergency_device_typeT edt ON ct.emergencydevicetypeid = edt.emergencydevicetypeid
+	`
+
+	var args []interface{}
+	if deviceTypeID != "" {
+		query += " WHERE ct.emergencydevicetypeid = $1"
+		args = append(args, deviceTypeID)
+	}
+	query += " ORDER BY edt.emergencydevicetypename, ct.version DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []models.ChecklistTemplate{}
+
+	// Scan the results
+	for rows.Next() {
+		template, err := scanChecklistTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		templates = append(templates, *template)
+	}
+
+	return templates, nil
+}
+
+// GetChecklistTemplateByID returns a template version with its questions
+func (db *DB) GetChecklistTemplateByID(templateID int) (*models.ChecklistTemplate, error) {
+	query := `
+	SELECT ` + checklistTemplateColumns + `
+	FROM checklist_templateT ct
+	JOIN emergency_device_typeT edt ON ct.emergencydevicetypeid = edt.emergencydevicetypeid
+	WHERE ct.checklisttemplateid = $1
+	`
+
+	template, err := scanChecklistTemplate(db.QueryRow(query, templateID))
+	if err != nil {
+		return nil, err
+	}
+
+	template.Questions, err = db.getChecklistQuestions(template.ChecklistTemplateID)
+	if err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+// GetLatestChecklistTemplate returns the version new inspections of the device type use,
+// sql.ErrNoRows when the device type has no template
+func (db *DB) GetLatestChecklistTemplate(deviceTypeID int) (*models.ChecklistTemplate, error) {
+	query := `
+	SELECT ` + checklistTemplateColumns + `
+	FROM checklist_templateT ct
+	JOIN emergency_device_typeT edt ON ct.emergencydevicetypeid = edt.emergencydevicetypeid
+	WHERE ct.emergencydevicetypeid = $1
+	ORDER BY ct.version DESC
+	LIMIT 1
+	`
+
+	template, err := scanChecklistTemplate(db.QueryRow(query, deviceTypeID))
+	if err != nil {
+		return nil, err
+	}
+
+	template.Questions, err = db.getChecklistQuestions(template.ChecklistTemplateID)
+	if err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+func (db *DB) getChecklistQuestions(templateID int) ([]models.ChecklistQuestion, error) {
+	query := `
+	SELECT checklistquestionid, checklisttemplateid, sortorder, questiontext, answertype, isrequired, severity
+	FROM checklist_questionT
+	WHERE checklisttemplateid = $1
+	ORDER BY sortorder
+	`
+
+	rows, err := db.Query(query, templateID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	questions := []models.ChecklistQuestion{}
+
+	// Scan the results
+	for rows.Next() {
+		var question models.ChecklistQuestion
+		err := rows.Scan(
+			&question.ChecklistQuestionID,
+			&question.ChecklistTemplateID,
+			&question.SortOrder,
+			&question.QuestionText,
+			&question.AnswerType,
+			&question.IsRequired,
+			&question.Severity,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		questions = append(questions, question)
+	}
+
+	return questions, nil
+}
+
+// AddChecklistTemplate saves the template and its questions as the next version for
+// its device type and returns the new template ID
+func (db *DB) AddChecklistTemplate(template *models.ChecklistTemplate) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Serialise versioning per device type so two admins cannot claim the same version
+	_, err = tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('checklist_template'), $1)`, template.EmergencyDeviceTypeID)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+	INSERT INTO checklist_templateT (emergencydevicetypeid, templatename, version, createdby)
+	SELECT $1, $2, COALESCE(MAX(version), 0) + 1, $3
+	FROM checklist_templateT
+	WHERE emergencydevicetypeid = $1
+	RETURNING checklisttemplateid, version
+	`
+
+	var templateID int
+	err = tx.QueryRow(query, template.EmergencyDeviceTypeID, template.TemplateName, template.CreatedBy).Scan(&templateID, &template.Version)
+	if err != nil {
+		return 0, err
+	}
+
+	insertStmt, err := tx.Prepare(`
+	INSERT INTO checklist_questionT (checklisttemplateid, sortorder, questiontext, answertype, isrequired, severity)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer insertStmt.Close()
+
+	for i, question := range template.Questions {
+		_, err = insertStmt.Exec(templateID, i+1, question.QuestionText, question.AnswerType, question.IsRequired, question.Severity)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return templateID, nil
+}
+
+// DeleteChecklistTemplate removes a template version no inspection has been answered against
+func (db *DB) DeleteChecklistTemplate(templateID int) error {
+	query := "DELETE FROM checklist_templateT WHERE checklisttemplateid = $1"
+	deleteStmt, err := db.Prepare(query)
+	if err != nil {
+		return err
+	}
+
+	defer deleteStmt.Close()
+
+	_, err = deleteStmt.Exec(templateID)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetInspectionResponses returns the checklist answers of an inspection in question order
+func (db *DB) GetInspectionResponses(inspectionID int) ([]models.InspectionResponse, error) {
+	query := `
+	SELECT ir.inspectionresponseid, ir.emergencydeviceinspectionid, ir.checklistquestionid, q.sortorder, q.questiontext, q.answertype, q.severity,
+		   ir.answeryesno, ir.answernumber, ir.answertext, ir.attachmentid, a.sha256
+	FROM inspection_responseT ir
+	JOIN checklist_questionT q ON ir.checklistquestionid = q.checklistquestionid
+	LEFT JOIN attachmentT a ON ir.attachmentid = a.attachmentid
+	WHERE ir.emergencydeviceinspectionid = $1
+	ORDER BY q.sortorder
+	`
+
+	rows, err := db.Query(query, inspectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	responses := []models.InspectionResponse{}
+
+	// Scan the results
+	for rows.Next() {
+		var response models.InspectionResponse
+		err := rows.Scan(
+			&response.InspectionResponseID,
+			&response.EmergencyDeviceInspectionID,
+			&response.ChecklistQuestionID,
+			&response.SortOrder,
+			&response.QuestionText,
+			&response.AnswerType,
+			&response.Severity,
+			&response.AnswerYesNo,
+			&response.AnswerNumber,
+			&response.AnswerText,
+			&response.AttachmentID,
+			&response.PhotoSHA256,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		responses = append(responses, response)
+	}
+
+	return responses, nil
+}
+
+func addInspectionResponses(tx *sql.Tx, inspectionID int, responses []models.InspectionResponse) error {
+	if len(responses) == 0 {
+		return nil
+	}
+
+	insertStmt, err := tx.Prepare(`
+	INSERT INTO inspection_responseT (emergencydeviceinspectionid, checklistquestionid, answeryesno, answernumber, answertext, attachmentid)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	`)
+	if err != nil {
+		return err
+	}
+	defer insertStmt.Close()
+
+	for _, response := range responses {
+		// Photo answers are saved as attachments of the inspection
+		if response.Photo != nil {
+			response.Photo.EmergencyDeviceInspectionID = sql.NullInt64{Int64: int64(inspectionID), Valid: true}
+			attachmentID, err := insertAttachment(tx, response.Photo)
+			if err != nil {
+				return err
+			}
+			response.AttachmentID = sql.NullInt64{Int64: int64(attachmentID), Valid: true}
+		}
+
+		_, err = insertStmt.Exec(
+			inspectionID,
+			response.ChecklistQuestionID,
+			response.AnswerYesNo,
+			response.AnswerNumber,
+			response.AnswerText,
+			response.AttachmentID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -13,11 +13,15 @@ type DB struct {
 	*sql.DB
 }
 
+// ConnString returns the connection string of the configured database
+func ConnString(cfg config.Config) string {
+	return fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%d sslmode=disable",
+		cfg.DBUser, cfg.DBPassword, cfg.DBName, cfg.DBHost, cfg.DBPort)
+}
+
 func NewDB(cfg config.Config) (*DB, error) {
 	log.Println("Connecting to database...")
-	connStr := fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%d sslmode=disable",
-		cfg.DBUser, cfg.DBPassword, cfg.DBName, cfg.DBHost, cfg.DBPort)
-	db, err := sql.Open("postgres", connStr)
+	db, err := sql.Open("postgres", ConnString(cfg))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+)
+
+const devicePinSelect = `
+	SELECT ed.emergencydeviceid, edt.emergencydevicetypename, ed.serialnumber,
+		   r.roomid, r.roomcode, f.floorid, f.floorname, ed.status, ed.pinx, ed.piny
+	FROM emergency_deviceT ed
+	JOIN emergency_device_typeT edt ON ed.emergencydevicetypeid = edt.emergencydevicetypeid
+	JOIN roomT r ON ed.roomid = r.roomid
+	JOIN floorT f ON r.floorid = f.floorid
+	`
+
+func (db *DB) getDevicePins(where string, arg interface{}) ([]models.DevicePin, error) {
+	rows, err := db.Query(devicePinSelect+where+` ORDER BY f.floororder, r.roomcode, ed.emergencydeviceid`, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pins := []models.DevicePin{}
+	for rows.Next() {
+		var pin models.DevicePin
+		err := rows.Scan(
+			&pin.EmergencyDeviceID,
+			&pin.EmergencyDeviceTypeName,
+			&pin.SerialNumber,
+			&pin.RoomID,
+			&pin.RoomCode,
+			&pin.FloorID,
+			&pin.FloorName,
+			&pin.Status,
+			&pin.PinX,
+			&pin.PinY,
+		)
+		if err != nil {
+			return nil, err
+		}
+		pins = append(pins, pin)
+	}
+
+	return pins, rows.Err()
+}
+
+// GetFloorDevicePins returns the devices on a floor, for its floor plan
+func (db *DB) GetFloorDevicePins(floorID int) ([]models.DevicePin, error) {
+	return db.getDevicePins(`WHERE r.floorid = $1`, floorID)
+}
+
+// GetBuildingDevicePins returns the devices on the building's floors that have no floor
+// plan of their own, for the building's plan
+func (db *DB) GetBuildingDevicePins(buildingID int) ([]models.DevicePin, error) {
+	return db.getDevicePins(`WHERE r.buildingid = $1 AND f.floorplanimagepath IS NULL`, buildingID)
+}
+
+// UpdateDevicePin places a device on its floor plan, or removes it when x and y are null
+func (db *DB) UpdateDevicePin(deviceID int, pinX, pinY sql.NullFloat64) error {
+	result, err := db.Exec(`UPDATE emergency_deviceT SET pinx = $1, piny = $2 WHERE emergencydeviceid = $3`, pinX, pinY, deviceID)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(result)
+}
+
+// UpdateBuildingFloorPlan sets or removes a building's floor plan
+func (db *DB) UpdateBuildingFloorPlan(buildingID int, floorPlanImagePath sql.NullString) error {
+	result, err := db.Exec(`UPDATE buildingT SET floorplanimagepath = $1 WHERE buildingid = $2`, floorPlanImagePath, buildingID)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(result)
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+)
+
+const digestSubscriptionQuery = `
+	SELECT u.userid, u.username, u.email, ds.frequency, ds.siteid, s.sitename,
+		   ds.buildingid, b.buildingcode, ds.lastsentat
+	FROM digest_subscriptionT ds
+	JOIN userT u ON ds.userid = u.userid
+	LEFT JOIN buildingT b ON ds.buildingid = b.buildingid
+	LEFT JOIN siteT s ON s.siteid = COALESCE(ds.siteid, b.siteid)
+	`
+
+func scanDigestSubscription(row interface{ Scan(...any) error }) (models.DigestSubscription, error) {
+	var subscription models.DigestSubscription
+	err := row.Scan(
+		&subscription.UserID,
+		&subscription.Username,
+		&subscription.Email,
+		&subscription.Frequency,
+		&subscription.SiteID,
+		&subscription.SiteName,
+		&subscription.BuildingID,
+		&subscription.BuildingCode,
+		&subscription.LastSentAt,
+	)
+	return subscription, err
+}
+
+// GetDigestSubscription returns a user's digest settings, or sql.ErrNoRows if the user
+// is not subscribed
+func (db *DB) GetDigestSubscription(userID int) (models.DigestSubscription, error) {
+	return scanDigestSubscription(db.QueryRow(digestSubscriptionQuery+`WHERE ds.userid = $1`, userID))
+}
+
+// GetAllDigestSubscriptions returns every user's digest settings
+func (db *DB) GetAllDigestSubscriptions() ([]models.DigestSubscription, error) {
+	rows, err := db.Query(digestSubscriptionQuery + `ORDER BY u.userid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []models.DigestSubscription{}
+	for rows.Next() {
+		subscription, err := scanDigestSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+// SaveDigestSubscription creates or updates a user's digest settings. When the
+// frequency or filters change the next digest is sent as soon as it is due.
+func (db *DB) SaveDigestSubscription(subscription models.DigestSubscription) error {
+	_, err := db.Exec(`
+	INSERT INTO digest_subscriptionT (userid, frequency, siteid, buildingid)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (userid) DO UPDATE
+	SET frequency = EXCLUDED.frequency,
+		siteid = EXCLUDED.siteid,
+		buildingid = EXCLUDED.buildingid
+	`, subscription.UserID, subscription.Frequency, subscription.SiteID, subscription.BuildingID)
+	return err
+}
+
+// DeleteDigestSubscription unsubscribes a user, it is not an error if they were not subscribed
+func (db *DB) DeleteDigestSubscription(userID int) error {
+	_, err := db.Exec(`DELETE FROM digest_subscriptionT WHERE userid = $1`, userID)
+	return err
+}
+
+// MarkDigestSent records when a user's digest was last sent
+func (db *DB) MarkDigestSent(userID int, sentAt time.Time) error {
+	result, err := db.Exec(`UPDATE digest_subscriptionT SET lastsentat = $2 WHERE userid = $1`, userID, sentAt)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -1,13 +1,40 @@
 -- First truncate all tables (in correct order due to foreign key constraints)
 TRUNCATE TABLE 
+    calendar_feedt,
+    site_followt,
+    webhook_delivery_attemptt,
+    webhook_deliveryt,
+    webhook_eventt,
+    webhook_endpointt,
+    device_escalationt,
+    escalation_stept,
+    escalation_policyt,
+    site_membert,
+    digest_subscriptiont,
+    revoked_tokent,
+    job_runt,
+    notification_user_statet,
+    notificationt,
+    inspection_round_itemt,
+    inspection_roundt,
+    inspection_revisiont,
+    inspection_responset,
+    attachmentt,
+    device_recallt,
+    recallt,
     emergency_device_inspectiont,
     emergency_devicet,
     roomt,
+    floort,
     buildingt,
     sitet,
     usert,
     emergency_device_typet,
-    extinguisher_typet
+    extinguisher_typet,
+    device_modelt,
+    manufacturert,
+    checklist_questiont,
+    checklist_templatet
 CASCADE;
 -- Then reset all sequences
 ALTER SEQUENCE buildingt_buildingid_seq RESTART WITH 1;
@@ -16,6 +43,26 @@ ALTER SEQUENCE emergency_device_typet_emergencydevicetypeid_seq RESTART WITH 1;
 ALTER SEQUENCE emergency_devicet_emergencydeviceid_seq RESTART WITH 1;
 ALTER SEQUENCE extinguisher_typet_extinguishertypeid_seq RESTART WITH 1;
 ALTER SEQUENCE roomt_roomid_seq RESTART WITH 1;
+ALTER SEQUENCE floort_floorid_seq RESTART WITH 1;
 ALTER SEQUENCE sitet_siteid_seq RESTART WITH 1;
 ALTER SEQUENCE usert_userid_seq RESTART WITH 1;
+ALTER SEQUENCE manufacturert_manufacturerid_seq RESTART WITH 1;
+ALTER SEQUENCE device_modelt_devicemodelid_seq RESTART WITH 1;
+ALTER SEQUENCE recallt_recallid_seq RESTART WITH 1;
+ALTER SEQUENCE attachmentt_attachmentid_seq RESTART WITH 1;
+ALTER SEQUENCE checklist_templatet_checklisttemplateid_seq RESTART WITH 1;
+ALTER SEQUENCE checklist_questiont_checklistquestionid_seq RESTART WITH 1;
+ALTER SEQUENCE inspection_responset_inspectionresponseid_seq RESTART WITH 1;
+ALTER SEQUENCE inspection_revisiont_inspectionrevisionid_seq RESTART WITH 1;
+ALTER SEQUENCE inspection_roundt_inspectionroundid_seq RESTART WITH 1;
+ALTER SEQUENCE inspection_round_itemt_inspectionrounditemid_seq RESTART WITH 1;
+ALTER SEQUENCE notificationt_notificationid_seq RESTART WITH 1;
+ALTER SEQUENCE job_runt_jobrunid_seq RESTART WITH 1;
+ALTER SEQUENCE escalation_policyt_escalationpolicyid_seq RESTART WITH 1;
+ALTER SEQUENCE escalation_stept_escalationstepid_seq RESTART WITH 1;
+ALTER SEQUENCE device_escalationt_deviceescalationid_seq RESTART WITH 1;
+ALTER SEQUENCE webhook_endpointt_webhookendpointid_seq RESTART WITH 1;
+ALTER SEQUENCE webhook_eventt_webhookeventid_seq RESTART WITH 1;
+ALTER SEQUENCE webhook_deliveryt_webhookdeliveryid_seq RESTART WITH 1;
+ALTER SEQUENCE webhook_delivery_attemptt_webhookdeliveryattemptid_seq RESTART WITH 1;
 -- Generate select script for all tables and data
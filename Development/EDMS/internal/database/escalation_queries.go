@@ -0,0 +1,393 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+)
+
+// GetSiteMembers returns the users looking after a site
+func (db *DB) GetSiteMembers(siteID int) ([]models.SiteMember, error) {
+	query := `
+	SELECT sm.siteid, sm.userid, u.username, u.email, sm.siterole
+	FROM site_memberT sm
+	JOIN userT u ON sm.userid = u.userid
+	WHERE sm.siteid = $1
+	ORDER BY sm.siterole, u.username
+	`
+
+	rows, err := db.Query(query, siteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.SiteMember{}
+	for rows.Next() {
+		var member models.SiteMember
+		err := rows.Scan(&member.SiteID, &member.UserID, &member.Username, &member.Email, &member.SiteRole)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+// SaveSiteMember adds a user to a site or changes their role there
+func (db *DB) SaveSiteMember(member models.SiteMember) error {
+	_, err := db.Exec(`
+	INSERT INTO site_memberT (siteid, userid, siterole)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (siteid, userid) DO UPDATE SET siterole = EXCLUDED.siterole
+	`, member.SiteID, member.UserID, member.SiteRole)
+	return err
+}
+
+// DeleteSiteMember removes a user from a site, it returns sql.ErrNoRows if they were not a member
+func (db *DB) DeleteSiteMember(siteID, userID int) error {
+	result, err := db.Exec(`DELETE FROM site_memberT WHERE siteid = $1 AND userid = $2`, siteID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetEscalationRecipients returns the email addresses an escalation step notifies at a site
+func (db *DB) GetEscalationRecipients(siteID int, recipient string) ([]string, error) {
+	var rows *sql.Rows
+	var err error
+	switch recipient {
+	case models.EscalationRecipientAdmins:
+		rows, err = db.Query(`SELECT email FROM userT WHERE role = 'Admin' ORDER BY userid`)
+	case models.EscalationRecipientSiteManagers:
+		rows, err = db.Query(`
+		SELECT u.email FROM site_memberT sm JOIN userT u ON sm.userid = u.userid
+		WHERE sm.siteid = $1 AND sm.siterole = $2 ORDER BY u.userid
+		`, siteID, models.SiteRoleManager)
+	default:
+		rows, err = db.Query(`
+		SELECT u.email FROM site_memberT sm JOIN userT u ON sm.userid = u.userid
+		WHERE sm.siteid = $1 AND sm.siterole = $2 ORDER BY u.userid
+		`, siteID, models.SiteRoleInspector)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emails := []string{}
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+
+	return emails, rows.Err()
+}
+
+// GetAllEscalationPolicies returns every escalation policy with its steps, most
+// specific first
+func (db *DB) GetAllEscalationPolicies() ([]models.EscalationPolicy, error) {
+	rows, err := db.Query(`
+	SELECT p.escalationpolicyid, p.policyname, p.siteid, s.sitename,
+		   p.emergencydevicetypeid, edt.emergencydevicetypename
+	FROM escalation_policyT p
+	LEFT JOIN siteT s ON p.siteid = s.siteid
+	LEFT JOIN emergency_device_typeT edt ON p.emergencydevicetypeid = edt.emergencydevicetypeid
+	ORDER BY p.siteid IS NULL, p.emergencydevicetypeid IS NULL, s.sitename, edt.emergencydevicetypename
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	policies := []models.EscalationPolicy{}
+	index := map[int]int{}
+	for rows.Next() {
+		var policy models.EscalationPolicy
+		err := rows.Scan(
+			&policy.EscalationPolicyID,
+			&policy.PolicyName,
+			&policy.SiteID,
+			&policy.SiteName,
+			&policy.EmergencyDeviceTypeID,
+			&policy.EmergencyDeviceTypeName,
+		)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		policy.Steps = []models.EscalationStep{}
+		index[policy.EscalationPolicyID] = len(policies)
+		policies = append(policies, policy)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`
+	SELECT escalationstepid, escalationpolicyid, notificationtype, daysafter, recipient
+	FROM escalation_stepT
+	ORDER BY notificationtype, daysafter, escalationstepid
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var step models.EscalationStep
+		err := rows.Scan(&step.EscalationStepID, &step.EscalationPolicyID, &step.NotificationType, &step.DaysAfter, &step.Recipient)
+		if err != nil {
+			return nil, err
+		}
+		if i, ok := index[step.EscalationPolicyID]; ok {
+			policies[i].Steps = append(policies[i].Steps, step)
+		}
+	}
+
+	return policies, rows.Err()
+}
+
+// AddEscalationPolicy saves a new policy with its steps and returns its ID
+func (db *DB) AddEscalationPolicy(policy models.EscalationPolicy) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var policyID int
+	err = tx.QueryRow(`
+	INSERT INTO escalation_policyT (policyname, siteid, emergencydevicetypeid)
+	VALUES ($1, $2, $3)
+	RETURNING escalationpolicyid
+	`, policy.PolicyName, policy.SiteID, policy.EmergencyDeviceTypeID).Scan(&policyID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := insertEscalationSteps(tx, policyID, policy.Steps); err != nil {
+		return 0, err
+	}
+
+	return policyID, tx.Commit()
+}
+
+// UpdateEscalationPolicy replaces a policy and its steps, it returns sql.ErrNoRows if
+// there is no such policy
+func (db *DB) UpdateEscalationPolicy(policy models.EscalationPolicy) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+	UPDATE escalation_policyT
+	SET policyname = $2, siteid = $3, emergencydevicetypeid = $4
+	WHERE escalationpolicyid = $1
+	`, policy.EscalationPolicyID, policy.PolicyName, policy.SiteID, policy.EmergencyDeviceTypeID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec(`DELETE FROM escalation_stepT WHERE escalationpolicyid = $1`, policy.EscalationPolicyID); err != nil {
+		return err
+	}
+	if err := insertEscalationSteps(tx, policy.EscalationPolicyID, policy.Steps); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertEscalationSteps(tx *sql.Tx, policyID int, steps []models.EscalationStep) error {
+	for _, step := range steps {
+		_, err := tx.Exec(`
+		INSERT INTO escalation_stepT (escalationpolicyid, notificationtype, daysafter, recipient)
+		VALUES ($1, $2, $3, $4)
+		`, policyID, step.NotificationType, step.DaysAfter, step.Recipient)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteEscalationPolicy removes a policy, it returns sql.ErrNoRows if there is no such policy
+func (db *DB) DeleteEscalationPolicy(policyID int) error {
+	result, err := db.Exec(`DELETE FROM escalation_policyT WHERE escalationpolicyid = $1`, policyID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetEscalationCandidates returns the open overdue, failed, expired and recalled
+// notifications with the device's type and location
+func (db *DB) GetEscalationCandidates() ([]models.Notification, error) {
+	query := `
+	SELECT n.notificationid, n.emergencydeviceid, n.notificationtype, n.referencedate, n.createdat,
+		   ed.emergencydevicetypeid, edt.emergencydevicetypename, ed.serialnumber,
+		   r.roomcode, b.buildingcode, si.siteid, si.sitename, si.timezone
+	FROM notificationT n
+	JOIN emergency_deviceT ed ON n.emergencydeviceid = ed.emergencydeviceid
+	JOIN emergency_device_typeT edt ON ed.emergencydevicetypeid = edt.emergencydevicetypeid
+	JOIN roomT r ON ed.roomid = r.roomid
+	JOIN buildingT b ON r.buildingid = b.buildingid
+	JOIN siteT si ON b.siteid = si.siteid
+	WHERE n.resolvedat IS NULL
+	  AND n.notificationtype IN ('Inspection Overdue', 'Inspection Failed', 'Expired', 'Recalled')
+	ORDER BY n.notificationid
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var notification models.Notification
+		err := rows.Scan(
+			&notification.NotificationID,
+			&notification.EmergencyDeviceID,
+			&notification.NotificationType,
+			&notification.ReferenceDate,
+			&notification.CreatedAt,
+			&notification.EmergencyDeviceTypeID,
+			&notification.EmergencyDeviceTypeName,
+			&notification.SerialNumber,
+			&notification.RoomCode,
+			&notification.BuildingCode,
+			&notification.SiteID,
+			&notification.SiteName,
+			&notification.SiteTimeZone,
+		)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, rows.Err()
+}
+
+const deviceEscalationColumns = `
+	de.deviceescalationid, de.emergencydeviceid, de.notificationid, de.escalationstepid,
+	de.notificationtype, de.daysafter, de.recipient, de.sentto, de.pendingto, de.escalatedat
+	`
+
+func scanDeviceEscalations(rows *sql.Rows) ([]models.DeviceEscalation, error) {
+	escalations := []models.DeviceEscalation{}
+	for rows.Next() {
+		var escalation models.DeviceEscalation
+		err := rows.Scan(
+			&escalation.DeviceEscalationID,
+			&escalation.EmergencyDeviceID,
+			&escalation.NotificationID,
+			&escalation.EscalationStepID,
+			&escalation.NotificationType,
+			&escalation.DaysAfter,
+			&escalation.Recipient,
+			&escalation.SentTo,
+			&escalation.PendingTo,
+			&escalation.EscalatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		escalations = append(escalations, escalation)
+	}
+	return escalations, rows.Err()
+}
+
+// GetOpenEscalations returns the steps taken for notifications that are still open
+func (db *DB) GetOpenEscalations() ([]models.DeviceEscalation, error) {
+	rows, err := db.Query(`
+	SELECT ` + deviceEscalationColumns + `
+	FROM device_escalationT de
+	JOIN notificationT n ON de.notificationid = n.notificationid
+	WHERE n.resolvedat IS NULL
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDeviceEscalations(rows)
+}
+
+// GetDeviceEscalations returns the escalation steps taken for a device, latest first
+func (db *DB) GetDeviceEscalations(deviceID int) ([]models.DeviceEscalation, error) {
+	rows, err := db.Query(`
+	SELECT `+deviceEscalationColumns+`
+	FROM device_escalationT de
+	WHERE de.emergencydeviceid = $1
+	ORDER BY de.escalatedat DESC, de.deviceescalationid DESC
+	`, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDeviceEscalations(rows)
+}
+
+// AddDeviceEscalation records an escalation step taken for a device
+func (db *DB) AddDeviceEscalation(escalation models.DeviceEscalation) error {
+	_, err := db.Exec(`
+	INSERT INTO device_escalationT
+	(emergencydeviceid, notificationid, escalationstepid, notificationtype, daysafter, recipient, sentto, pendingto)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	ON CONFLICT (notificationid, daysafter, recipient) DO NOTHING
+	`,
+		escalation.EmergencyDeviceID,
+		escalation.NotificationID,
+		escalation.EscalationStepID,
+		escalation.NotificationType,
+		escalation.DaysAfter,
+		escalation.Recipient,
+		escalation.SentTo,
+		escalation.PendingTo,
+	)
+	return err
+}
+
+// UpdateDeviceEscalationRecipients records who a step taken earlier has now been sent to
+// and who is still waiting for it
+func (db *DB) UpdateDeviceEscalationRecipients(deviceEscalationID int, sentTo, pendingTo string) error {
+	_, err := db.Exec(`
+	UPDATE device_escalationT
+	SET sentto = $2, pendingto = $3
+	WHERE deviceescalationid = $1
+	`, deviceEscalationID, sentTo, pendingTo)
+	return err
+}
@@ -0,0 +1,128 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+)
+
+// DefaultFloorName is the floor every building is given when it is added
+const DefaultFloorName = "Ground"
+
+const floorSelect = `
+	SELECT f.floorid, f.buildingid, f.floorname, f.floororder, f.floorplanimagepath,
+		   b.buildingcode, s.siteid, s.sitename
+	FROM floorT f
+	JOIN buildingT b ON f.buildingid = b.buildingid
+	JOIN siteT s ON b.siteid = s.siteid
+	`
+
+func scanFloor(row interface{ Scan(...interface{}) error }, floor *models.Floor) error {
+	return row.Scan(
+		&floor.FloorID,
+		&floor.BuildingID,
+		&floor.FloorName,
+		&floor.FloorOrder,
+		&floor.FloorPlanImagePath,
+		&floor.BuildingCode,
+		&floor.SiteID,
+		&floor.SiteName,
+	)
+}
+
+// GetAllFloors returns the floors of every building that is not archived, or of one
+// building, from the lowest
+func (db *DB) GetAllFloors(buildingId string) ([]models.Floor, error) {
+	query := floorSelect + ` WHERE b.archivedat IS NULL`
+	var args []interface{}
+	if buildingId != "" {
+		query += ` AND f.buildingid = $1`
+		args = append(args, buildingId)
+	}
+	query += ` ORDER BY s.sitename, b.buildingcode, f.floororder, f.floorname`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	floors := []models.Floor{}
+	for rows.Next() {
+		var floor models.Floor
+		if err := scanFloor(rows, &floor); err != nil {
+			return nil, err
+		}
+		floors = append(floors, floor)
+	}
+
+	return floors, rows.Err()
+}
+
+func (db *DB) GetFloorByID(floorID int) (*models.Floor, error) {
+	var floor models.Floor
+	err := scanFloor(db.QueryRow(floorSelect+` WHERE f.floorid = $1`, floorID), &floor)
+	if err != nil {
+		return nil, err
+	}
+	return &floor, nil
+}
+
+func (db *DB) GetFloorByNameAndBuilding(floorName string, buildingID int) (*models.Floor, error) {
+	var floor models.Floor
+	err := scanFloor(db.QueryRow(floorSelect+` WHERE f.floorname = $1 AND f.buildingid = $2`, floorName, buildingID), &floor)
+	if err != nil {
+		return nil, err
+	}
+	return &floor, nil
+}
+
+// GetDefaultFloor returns the lowest floor of a building, which rooms are added to when
+// no floor is given
+func (db *DB) GetDefaultFloor(buildingID int) (*models.Floor, error) {
+	var floor models.Floor
+	err := scanFloor(db.QueryRow(floorSelect+`
+	WHERE f.buildingid = $1
+	ORDER BY f.floororder, f.floorid
+	LIMIT 1
+	`, buildingID), &floor)
+	if err != nil {
+		return nil, err
+	}
+	return &floor, nil
+}
+
+// AddFloor adds a floor, above the building's other floors when no order is given
+func (db *DB) AddFloor(floor *models.Floor, floorOrder sql.NullInt64) error {
+	return db.QueryRow(`
+	INSERT INTO FloorT (BuildingID, FloorName, FloorOrder, FloorPlanImagePath)
+	VALUES ($1, $2, COALESCE($3, (SELECT COALESCE(MAX(FloorOrder) + 1, 0) FROM FloorT WHERE BuildingID = $1)), $4)
+	RETURNING FloorID, FloorOrder
+	`, floor.BuildingID, floor.FloorName, floorOrder, floor.FloorPlanImagePath).Scan(&floor.FloorID, &floor.FloorOrder)
+}
+
+func (db *DB) UpdateFloor(floor *models.Floor) error {
+	result, err := db.Exec(`
+	UPDATE FloorT SET FloorName = $1, FloorOrder = $2, FloorPlanImagePath = $3
+	WHERE FloorID = $4
+	`, floor.FloorName, floor.FloorOrder, floor.FloorPlanImagePath, floor.FloorID)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(result)
+}
+
+func (db *DB) DeleteFloor(floorID int) error {
+	result, err := db.Exec(`DELETE FROM FloorT WHERE FloorID = $1`, floorID)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(result)
+}
+
+// CountFloorRooms counts the rooms on a floor
+func (db *DB) CountFloorRooms(floorID int) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM RoomT WHERE FloorID = $1`, floorID).Scan(&count)
+	return count, err
+}
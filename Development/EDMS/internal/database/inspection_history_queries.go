@@ -0,0 +1,136 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/utils"
+	"github.com/lib/pq"
+)
+
+const inspectionHistoryFrom = `
+	FROM emergency_device_inspectionT edi
+	JOIN userT u ON edi.userid = u.userid
+	JOIN emergency_deviceT ed ON edi.emergencydeviceid = ed.emergencydeviceid
+	JOIN emergency_device_typeT edt ON ed.emergencydevicetypeid = edt.emergencydevicetypeid
+	JOIN roomT r ON ed.roomid = r.roomid
+	JOIN buildingT b ON r.buildingid = b.buildingid
+	JOIN siteT s ON b.siteid = s.siteid
+	LEFT JOIN inspection_revisionT rev ON rev.emergencydeviceinspectionid = edi.emergencydeviceinspectionid
+	`
+
+// inspectionHistoryWhere returns the WHERE clause matching the filter and its arguments
+func inspectionHistoryWhere(filter models.InspectionHistoryFilter) (string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.SiteID != 0 {
+		add("s.siteid = $%d", filter.SiteID)
+	}
+	if filter.BuildingID != 0 {
+		add("b.buildingid = $%d", filter.BuildingID)
+	}
+	if filter.RoomID != 0 {
+		add("r.roomid = $%d", filter.RoomID)
+	}
+	if filter.EmergencyDeviceTypeID != 0 {
+		add("ed.emergencydevicetypeid = $%d", filter.EmergencyDeviceTypeID)
+	}
+	if filter.UserID != 0 {
+		add("edi.userid = $%d", filter.UserID)
+	}
+	if filter.Inspector != "" {
+		add("LOWER(u.username) = LOWER($%d)", filter.Inspector)
+	}
+	if len(filter.Statuses) > 0 {
+		add("edi.inspectionstatus = ANY($%d)", pq.Array(filter.Statuses))
+	}
+	if filter.From.Valid {
+		add("(edi.inspectiondatetime AT TIME ZONE s.timezone)::DATE >= $%d", filter.From.Time.Format("2006-01-02"))
+	}
+	if filter.To.Valid {
+		add("(edi.inspectiondatetime AT TIME ZONE s.timezone)::DATE <= $%d", filter.To.Time.Format("2006-01-02"))
+	}
+	if filter.WorkOrderRequired.Valid {
+		add("COALESCE(edi.workorderrequired, FALSE) = $%d", filter.WorkOrderRequired.Bool)
+	}
+	if !filter.IncludeRevised {
+		conditions = append(conditions, "rev.inspectionrevisionid IS NULL")
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// CountInspectionHistory counts the inspections matching the filter
+func (db *DB) CountInspectionHistory(filter models.InspectionHistoryFilter) (int, error) {
+	where, args := inspectionHistoryWhere(filter)
+
+	var total int
+	err := db.QueryRow("SELECT COUNT(*) "+inspectionHistoryFrom+where, args...).Scan(&total)
+	return total, err
+}
+
+// GetInspectionHistory returns the inspections matching the filter, latest first. A
+// limit of 0 returns every match.
+func (db *DB) GetInspectionHistory(filter models.InspectionHistoryFilter, limit, offset int) ([]models.InspectionHistoryItem, error) {
+	where, args := inspectionHistoryWhere(filter)
+
+	query := `
+	SELECT edi.emergencydeviceinspectionid, edi.emergencydeviceid, edt.emergencydevicetypename, ed.serialnumber,
+		   s.siteid, s.sitename, s.timezone, b.buildingid, b.buildingcode, r.roomid, r.roomcode,
+		   edi.userid, u.username, edi.inspectiondatetime,
+		   edi.inspectionstatus, edi.workorderrequired, edi.notes, rev.action
+	` + inspectionHistoryFrom + where + `
+	ORDER BY edi.inspectiondatetime DESC, edi.emergencydeviceinspectionid DESC
+	`
+	if limit > 0 {
+		args = append(args, limit, offset)
+		query += fmt.Sprintf("LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	inspections := []models.InspectionHistoryItem{}
+	for rows.Next() {
+		var inspection models.InspectionHistoryItem
+		err := rows.Scan(
+			&inspection.EmergencyDeviceInspectionID,
+			&inspection.EmergencyDeviceID,
+			&inspection.EmergencyDeviceTypeName,
+			&inspection.SerialNumber,
+			&inspection.SiteID,
+			&inspection.SiteName,
+			&inspection.SiteTimeZone,
+			&inspection.BuildingID,
+			&inspection.BuildingCode,
+			&inspection.RoomID,
+			&inspection.RoomCode,
+			&inspection.UserID,
+			&inspection.InspectorName,
+			&inspection.InspectionDateTime,
+			&inspection.InspectionStatus,
+			&inspection.WorkOrderRequired,
+			&inspection.Notes,
+			&inspection.RevisionAction,
+		)
+		if err != nil {
+			return nil, err
+		}
+		inspection.InspectionDateTime.Time = utils.InLocation(inspection.InspectionDateTime.Time, inspection.SiteTimeZone)
+		inspections = append(inspections, inspection)
+	}
+
+	return inspections, rows.Err()
+}
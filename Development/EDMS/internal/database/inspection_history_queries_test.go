@@ -0,0 +1,50 @@
+package database_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/database"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetInspectionHistoryFilters(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	dbInstance := &database.DB{DB: db}
+
+	filter := models.InspectionHistoryFilter{
+		SiteID:            2,
+		Statuses:          []string{models.InspectionStatusFailed},
+		From:              sql.NullTime{Time: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+		To:                sql.NullTime{Time: time.Date(2024, 9, 30, 0, 0, 0, 0, time.UTC), Valid: true},
+		WorkOrderRequired: sql.NullBool{Bool: true, Valid: true},
+	}
+
+	mock.ExpectQuery(`WHERE s.siteid = \$1 AND edi.inspectionstatus = ANY\(\$2\) AND .*::DATE >= \$3 AND .*::DATE <= \$4 AND COALESCE\(edi.workorderrequired, FALSE\) = \$5 AND rev.inspectionrevisionid IS NULL\s+ORDER BY .*LIMIT \$6 OFFSET \$7`).
+		WithArgs(2, pq.Array([]string{"Failed"}), "2024-07-01", "2024-09-30", true, 25, 50).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"emergencydeviceinspectionid", "emergencydeviceid", "emergencydevicetypename", "serialnumber",
+			"siteid", "sitename", "timezone", "buildingid", "buildingcode", "roomid", "roomcode",
+			"userid", "username", "inspectiondatetime", "inspectionstatus", "workorderrequired", "notes", "action",
+		}).AddRow(
+			9, 4, "Fire Extinguisher", "SN123",
+			2, "EIT Hastings", "Pacific/Auckland", 3, "B", 5, "B101",
+			12, "user12", time.Date(2024, 8, 14, 10, 30, 0, 0, time.UTC), "Failed", true, "Gauge low", nil,
+		))
+
+	inspections, err := dbInstance.GetInspectionHistory(filter, 25, 50)
+	require.NoError(t, err)
+	require.Len(t, inspections, 1)
+	assert.Equal(t, "EIT Hastings", inspections[0].SiteName)
+	assert.Equal(t, "user12", inspections[0].InspectorName)
+	assert.Equal(t, "2024-08-14 22:30", inspections[0].InspectionDateTime.Time.Format("2006-01-02 15:04"))
+	assert.False(t, inspections[0].RevisionAction.Valid)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+)
+
+// ErrInspectionRevised is returned when an inspection has already been amended or voided
+var ErrInspectionRevised = errors.New("inspection has already been amended or voided")
+
+// lockCurrentInspection locks the inspection row for the rest of the transaction and
+// checks it has not been amended or voided
+func lockCurrentInspection(tx *sql.Tx, inspectionID int) error {
+	query := `
+	SELECT EXISTS (SELECT 1 FROM inspection_revisionT r WHERE r.emergencydeviceinspectionid = edi.emergencydeviceinspectionid)
+	FROM emergency_device_inspectionT edi
+	WHERE edi.emergencydeviceinspectionid = $1
+	FOR UPDATE
+	`
+
+	var revised bool
+	if err := tx.QueryRow(query, inspectionID).Scan(&revised); err != nil {
+		return err
+	}
+	if revised {
+		return ErrInspectionRevised
+	}
+
+	return nil
+}
+
+func insertInspectionRevision(tx *sql.Tx, revision *models.InspectionRevision) error {
+	query := `
+	INSERT INTO inspection_revisionT (emergencydeviceinspectionid, replacementinspectionid, action, reason, revisedby)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING inspectionrevisionid
+	`
+
+	return tx.QueryRow(query,
+		revision.EmergencyDeviceInspectionID,
+		revision.ReplacementInspectionID,
+		revision.Action,
+		revision.Reason,
+		revision.RevisedBy,
+	).Scan(&revision.InspectionRevisionID)
+}
+
+// AmendInspection saves the corrected inspection as a new record that replaces the
+// original and returns its ID. The original is left as it was.
+func (db *DB) AmendInspection(originalID int, amended *models.Inspection, responses []models.InspectionResponse, revision *models.InspectionRevision) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := lockCurrentInspection(tx, originalID); err != nil {
+		return 0, err
+	}
+
+	inspectionID, err := insertInspection(tx, amended, responses)
+	if err != nil {
+		return 0, err
+	}
+
+	revision.EmergencyDeviceInspectionID = originalID
+	revision.ReplacementInspectionID = sql.NullInt64{Int64: int64(inspectionID), Valid: true}
+	revision.Action = models.RevisionActionAmend
+	if err := insertInspectionRevision(tx, revision); err != nil {
+		return 0, err
+	}
+
+	if err := reopenRoundItems(tx, originalID, amended, inspectionID); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return inspectionID, nil
+}
+
+// VoidInspection records that the inspection no longer counts towards its device
+func (db *DB) VoidInspection(inspectionID int, revision *models.InspectionRevision) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockCurrentInspection(tx, inspectionID); err != nil {
+		return err
+	}
+
+	revision.EmergencyDeviceInspectionID = inspectionID
+	revision.ReplacementInspectionID = sql.NullInt64{}
+	revision.Action = models.RevisionActionVoid
+	if err := insertInspectionRevision(tx, revision); err != nil {
+		return err
+	}
+
+	if err := reopenRoundItems(tx, inspectionID, nil, 0); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetInspectionRevisions returns every amendment and void in the revision chain the
+// inspection belongs to, oldest first
+func (db *DB) GetInspectionRevisions(inspectionID int) ([]models.InspectionRevision, error) {
+	query := `
+	WITH RECURSIVE earlier AS (
+		SELECT $1::INT AS inspectionid
+		UNION
+		SELECT r.emergencydeviceinspectionid
+		FROM inspection_revisionT r
+		JOIN earlier ON r.replacementinspectionid = earlier.inspectionid
+	), chain AS (
+		SELECT inspectionid
+		FROM earlier
+		WHERE NOT EXISTS (SELECT 1 FROM inspection_revisionT r WHERE r.replacementinspectionid = earlier.inspectionid)
+		UNION
+		SELECT r.replacementinspectionid
+		FROM inspection_revisionT r
+		JOIN chain ON r.emergencydeviceinspectionid = chain.inspectionid
+		WHERE r.replacementinspectionid IS NOT NULL
+	)
+	SELECT r.inspectionrevisionid, r.emergencydeviceinspectionid, r.replacementinspectionid, r.action, r.reason,
+		   r.revisedby, u.username, r.revisedat
+	FROM inspection_revisionT r
+	JOIN chain ON r.emergencydeviceinspectionid = chain.inspectionid
+	LEFT JOIN userT u ON r.revisedby = u.userid
+	ORDER BY r.revisedat, r.inspectionrevisionid
+	`
+
+	rows, err := db.Query(query, inspectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []models.InspectionRevision{}
+
+	// Scan the results
+	for rows.Next() {
+		var revision models.InspectionRevision
+		err := rows.Scan(
+			&revision.InspectionRevisionID,
+			&revision.EmergencyDeviceInspectionID,
+			&revision.ReplacementInspectionID,
+			&revision.Action,
+			&revision.Reason,
+			&revision.RevisedBy,
+			&revision.RevisedByName,
+			&revision.RevisedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, nil
+}
@@ -0,0 +1,411 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+)
+
+// ErrNoDevicesDue is returned when a round would be generated without any devices
+var ErrNoDevicesDue = errors.New("no devices are due for inspection")
+
+const inspectionRoundQuery = `
+	SELECT ir.inspectionroundid, ir.roundname, ir.siteid, s.sitename, s.timezone, ir.buildingid, b.buildingcode,
+		   ir.assignedto, u.username, ir.duedate, ir.status, ir.createdby, ir.createdat, ir.completedat,
+		   COUNT(i.inspectionrounditemid) AS totalitems,
+		   COUNT(*) FILTER (WHERE i.status = 'Pending') AS pendingitems,
+		   COUNT(*) FILTER (WHERE i.status = 'Inspected') AS inspecteditems,
+		   COUNT(*) FILTER (WHERE i.status = 'Skipped') AS skippeditems,
+		   COUNT(*) FILTER (WHERE edi.inspectionstatus = 'Passed') AS passedinspections,
+		   COUNT(*) FILTER (WHERE edi.inspectionstatus = 'Passed with defects') AS defectinspections,
+		   COUNT(*) FILTER (WHERE edi.inspectionstatus = 'Failed') AS failedinspections
+	FROM inspection_roundT ir
+	JOIN siteT s ON ir.siteid = s.siteid
+	LEFT JOIN buildingT b ON ir.buildingid = b.buildingid
+	LEFT JOIN userT u ON ir.assignedto = u.userid
+	LEFT JOIN inspection_round_itemT i ON i.inspectionroundid = ir.inspectionroundid
+	LEFT JOIN emergency_device_inspectionT edi ON i.emergencydeviceinspectionid = edi.emergencydeviceinspectionid
+`
+
+const inspectionRoundGroupBy = `
+	GROUP BY ir.inspectionroundid, s.sitename, s.timezone, b.buildingcode, u.username
+`
+
+func scanInspectionRound(row rowScanner) (*models.InspectionRound, error) {
+	var round models.InspectionRound
+	err := row.Scan(
+		&round.InspectionRoundID,
+		&round.RoundName,
+		&round.SiteID,
+		&round.SiteName,
+		&round.SiteTimeZone,
+		&round.BuildingID,
+		&round.BuildingCode,
+		&round.AssignedTo,
+		&round.AssignedToName,
+		&round.DueDate,
+		&round.Status,
+		&round.CreatedBy,
+		&round.CreatedAt,
+		&round.CompletedAt,
+		&round.Stats.TotalItems,
+		&round.Stats.PendingItems,
+		&round.Stats.InspectedItems,
+		&round.Stats.SkippedItems,
+		&round.Stats.PassedInspections,
+		&round.Stats.DefectInspections,
+		&round.Stats.FailedInspections,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if round.Stats.TotalItems > 0 {
+		done := round.Stats.InspectedItems + round.Stats.SkippedItems
+		round.Stats.PercentComplete = float64(done*100) / float64(round.Stats.TotalItems)
+	}
+
+	return &round, nil
+}
+
+// GetAllInspectionRounds returns rounds newest first, optionally only those assigned to a user
+// or with a status
+func (db *DB) GetAllInspectionRounds(assignedTo int, status string) ([]models.InspectionRound, error) {
+	query := inspectionRoundQuery + `
+	WHERE ($1 = 0 OR ir.assignedto = $1)
+	  AND ($2 = '' OR ir.status = $2)
+	` + inspectionRoundGroupBy + `
+	ORDER BY ir.duedate DESC, ir.inspectionroundid DESC
+	`
+
+	rows, err := db.Query(query, assignedTo, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rounds := []models.InspectionRound{}
+
+	// Scan the results
+	for rows.Next() {
+		round, err := scanInspectionRound(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		rounds = append(rounds, *round)
+	}
+
+	return rounds, nil
+}
+
+// GetInspectionRoundByID returns a round with its devices in route order
+func (db *DB) GetInspectionRoundByID(roundID int) (*models.InspectionRound, error) {
+	query := inspectionRoundQuery + `
+	WHERE ir.inspectionroundid = $1
+	` + inspectionRoundGroupBy
+
+	round, err := scanInspectionRound(db.QueryRow(query, roundID))
+	if err != nil {
+		return nil, err
+	}
+
+	round.Items, err = db.getInspectionRoundItems(roundID)
+	if err != nil {
+		return nil, err
+	}
+
+	round.Stats.SkippedByReason = make(map[string]int)
+	for _, item := range round.Items {
+		if item.Status == models.RoundItemStatusSkipped {
+			round.Stats.SkippedByReason[item.SkipReason.String]++
+		}
+	}
+
+	return round, nil
+}
+
+func (db *DB) getInspectionRoundItems(roundID int) ([]models.InspectionRoundItem, error) {
+	query := `
+	SELECT i.inspectionrounditemid, i.inspectionroundid, i.emergencydeviceid, ed.serialnumber, edt.emergencydevicetypename,
+		   b.buildingcode, r.roomcode, ed.status, ed.lastinspectiondatetime,
+		   i.sortorder, i.status, i.skipreason, i.skipnotes, i.emergencydeviceinspectionid, edi.inspectionstatus,
+		   i.updatedat
+	FROM inspection_round_itemT i
+	JOIN emergency_deviceT ed ON i.emergencydeviceid = ed.emergencydeviceid
+	JOIN emergency_device_typeT edt ON ed.emergencydevicetypeid = edt.emergencydevicetypeid
+	JOIN roomT r ON ed.roomid = r.roomid
+	JOIN buildingT b ON r.buildingid = b.buildingid
+	LEFT JOIN emergency_device_inspectionT edi ON i.emergencydeviceinspectionid = edi.emergencydeviceinspectionid
+	WHERE i.inspectionroundid = $1
+	ORDER BY i.sortorder
+	`
+
+	rows, err := db.Query(query, roundID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.InspectionRoundItem{}
+
+	// Scan the results
+	for rows.Next() {
+		var item models.InspectionRoundItem
+		err := rows.Scan(
+			&item.InspectionRoundItemID,
+			&item.InspectionRoundID,
+			&item.EmergencyDeviceID,
+			&item.SerialNumber,
+			&item.EmergencyDeviceTypeName,
+			&item.BuildingCode,
+			&item.RoomCode,
+			&item.DeviceStatus,
+			&item.LastInspectionDateTime,
+			&item.SortOrder,
+			&item.Status,
+			&item.SkipReason,
+			&item.SkipNotes,
+			&item.EmergencyDeviceInspectionID,
+			&item.InspectionStatus,
+			&item.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// AddInspectionRound creates the round with every device in its site or building that is
+// due for inspection by the round's due date, ordered by building and room code. Devices
+// already waiting on another open round are left out. Returns ErrNoDevicesDue when there
+// is nothing to inspect.
+func (db *DB) AddInspectionRound(round *models.InspectionRound) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO inspection_roundT (roundname, siteid, buildingid, assignedto, duedate, createdby)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING inspectionroundid
+	`
+
+	var roundID int
+	err = tx.QueryRow(query,
+		round.RoundName,
+		round.SiteID,
+		round.BuildingID,
+		round.AssignedTo,
+		round.DueDate.Time,
+		round.CreatedBy,
+	).Scan(&roundID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Devices are due three months after their last inspection at the site, the same as
+	// GetAllDevices, or straight away when never inspected or the last inspection failed
+	itemsQuery := `
+	INSERT INTO inspection_round_itemT (inspectionroundid, emergencydeviceid, sortorder)
+	SELECT $1, ed.emergencydeviceid, ROW_NUMBER() OVER (ORDER BY b.buildingcode, r.roomcode, ed.serialnumber, ed.emergencydeviceid)
+	FROM emergency_deviceT ed
+	JOIN roomT r ON ed.roomid = r.roomid
+	JOIN buildingT b ON r.buildingid = b.buildingid
+	JOIN siteT s ON b.siteid = s.siteid
+	WHERE b.siteid = $2
+	  AND ($3::INT IS NULL OR b.buildingid = $3)
+	  AND COALESCE(ed.status, '') <> 'Inactive'
+	  AND (ed.lastinspectiondatetime IS NULL
+		   OR (ed.lastinspectiondatetime AT TIME ZONE s.timezone) + INTERVAL '3 months' < $4::DATE + 1
+		   OR ed.status = 'Inspection Failed')
+	  AND NOT EXISTS (
+		  SELECT 1
+		  FROM inspection_round_itemT oi
+		  JOIN inspection_roundT o ON oi.inspectionroundid = o.inspectionroundid
+		  WHERE oi.emergencydeviceid = ed.emergencydeviceid
+			AND oi.status = 'Pending'
+			AND o.status IN ('Assigned', 'In Progress')
+	  )
+	`
+
+	result, err := tx.Exec(itemsQuery, roundID, round.SiteID, round.BuildingID, round.DueDate.Time)
+	if err != nil {
+		return 0, err
+	}
+
+	itemCount, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if itemCount == 0 {
+		return 0, ErrNoDevicesDue
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return roundID, nil
+}
+
+// UpdateInspectionRoundAssignment reassigns a round and moves its due date
+func (db *DB) UpdateInspectionRoundAssignment(roundID int, assignedTo int, dueDate time.Time) error {
+	query := `
+	UPDATE inspection_roundT
+	SET assignedto = $1, duedate = $2
+	WHERE inspectionroundid = $3
+	`
+
+	_, err := db.Exec(query, assignedTo, dueDate, roundID)
+	return err
+}
+
+// CancelInspectionRound stops a round, its items are kept for the record
+func (db *DB) CancelInspectionRound(roundID int) error {
+	query := `
+	UPDATE inspection_roundT
+	SET status = 'Cancelled'
+	WHERE inspectionroundid = $1 AND status <> 'Completed'
+	`
+
+	_, err := db.Exec(query, roundID)
+	return err
+}
+
+// UpdateInspectionRoundItem skips a device on the round or puts it back to pending
+func (db *DB) UpdateInspectionRoundItem(roundID int, itemID int, item *models.InspectionRoundItem) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE inspection_round_itemT
+	SET status = $1, skipreason = $2, skipnotes = $3, updatedat = CURRENT_TIMESTAMP
+	WHERE inspectionrounditemid = $4 AND inspectionroundid = $5 AND status <> 'Inspected'
+	`
+
+	result, err := tx.Exec(query, item.Status, item.SkipReason, item.SkipNotes, itemID, roundID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err := refreshInspectionRoundStatus(tx, roundID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// refreshInspectionRoundStatus moves a round to in progress once work has started and to
+// completed when no device is left pending
+func refreshInspectionRoundStatus(tx *sql.Tx, roundID int) error {
+	query := `
+	UPDATE inspection_roundT ir
+	SET status = CASE
+					WHEN NOT EXISTS (SELECT 1 FROM inspection_round_itemT i WHERE i.inspectionroundid = ir.inspectionroundid AND i.status = 'Pending')
+						THEN 'Completed'
+					WHEN EXISTS (SELECT 1 FROM inspection_round_itemT i WHERE i.inspectionroundid = ir.inspectionroundid AND i.status <> 'Pending')
+						THEN 'In Progress'
+					ELSE 'Assigned'
+				 END,
+		completedat = CASE
+						WHEN NOT EXISTS (SELECT 1 FROM inspection_round_itemT i WHERE i.inspectionroundid = ir.inspectionroundid AND i.status = 'Pending')
+							THEN COALESCE(ir.completedat, CURRENT_TIMESTAMP)
+						ELSE NULL
+					  END
+	WHERE ir.inspectionroundid = $1 AND ir.status <> 'Cancelled'
+	`
+
+	_, err := tx.Exec(query, roundID)
+	return err
+}
+
+// completeRoundItems marks the device as inspected on every open round waiting on it.
+// Only inspections carried out once the round was created count, so a late entered
+// inspection from before the round does not complete a planned visit.
+func completeRoundItems(tx *sql.Tx, deviceID int, inspectionID int) error {
+	query := `
+	UPDATE inspection_round_itemT i
+	SET status = 'Inspected', skipreason = NULL, skipnotes = NULL,
+		emergencydeviceinspectionid = $2, updatedat = CURRENT_TIMESTAMP
+	FROM inspection_roundT ir, emergency_device_inspectionT edi
+	WHERE i.inspectionroundid = ir.inspectionroundid
+	  AND i.emergencydeviceid = $1
+	  AND i.status <> 'Inspected'
+	  AND ir.status IN ('Assigned', 'In Progress')
+	  AND edi.emergencydeviceinspectionid = $2
+	  AND edi.inspectiondatetime >= ir.createdat
+	RETURNING i.inspectionroundid
+	`
+
+	return refreshRoundsFromQuery(tx, query, deviceID, inspectionID)
+}
+
+// reopenRoundItems puts devices completed by an inspection that no longer counts back on
+// their rounds. An amendment of the same device keeps the item completed by the copy.
+func reopenRoundItems(tx *sql.Tx, inspectionID int, replacement *models.Inspection, replacementID int) error {
+	if replacement != nil {
+		_, err := tx.Exec(`
+		UPDATE inspection_round_itemT
+		SET emergencydeviceinspectionid = $1, updatedat = CURRENT_TIMESTAMP
+		WHERE emergencydeviceinspectionid = $2 AND emergencydeviceid = $3
+		`, replacementID, inspectionID, replacement.EmergencyDeviceID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+	UPDATE inspection_round_itemT
+	SET status = 'Pending', emergencydeviceinspectionid = NULL, updatedat = CURRENT_TIMESTAMP
+	WHERE emergencydeviceinspectionid = $1
+	RETURNING inspectionroundid
+	`
+
+	return refreshRoundsFromQuery(tx, query, inspectionID)
+}
+
+func refreshRoundsFromQuery(tx *sql.Tx, query string, args ...interface{}) error {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return err
+	}
+
+	var roundIDs []int
+	for rows.Next() {
+		var roundID int
+		if err := rows.Scan(&roundID); err != nil {
+			rows.Close()
+			return err
+		}
+		roundIDs = append(roundIDs, roundID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, roundID := range roundIDs {
+		if err := refreshInspectionRoundStatus(tx, roundID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
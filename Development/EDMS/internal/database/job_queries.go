@@ -0,0 +1,181 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"hash/fnv"
+	"time"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+)
+
+// TryLockJob takes a Postgres advisory lock for the job without waiting. The lock is held
+// by a dedicated connection until unlock is called, so it is released if the replica dies.
+func (db *DB) TryLockJob(ctx context.Context, name string) (func(), bool, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	key := jobLockKey(name)
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&locked); err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+	if !locked {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	unlock := func() {
+		conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, key)
+		conn.Close()
+	}
+	return unlock, true, nil
+}
+
+// jobLockKey turns a job name into an advisory lock key
+func jobLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("edms-job:" + name))
+	return int64(h.Sum64())
+}
+
+// LastJobRun returns when the job was last started, or the zero time if it never was
+func (db *DB) LastJobRun(ctx context.Context, name string) (time.Time, error) {
+	var startedAt sql.NullTime
+	err := db.QueryRowContext(ctx, `SELECT MAX(startedat) FROM job_runT WHERE jobname = $1`, name).Scan(&startedAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return startedAt.Time, nil
+}
+
+// StartJobRun records the start of a job run and returns its ID
+func (db *DB) StartJobRun(ctx context.Context, name, instance string) (int, error) {
+	var runID int
+	err := db.QueryRowContext(ctx, `
+	INSERT INTO job_runT (jobname, instance)
+	VALUES ($1, $2)
+	RETURNING jobrunid
+	`, name, instance).Scan(&runID)
+	return runID, err
+}
+
+// FinishJobRun records the outcome of a job run
+func (db *DB) FinishJobRun(ctx context.Context, runID int, runErr error) error {
+	status := models.JobRunStatusSucceeded
+	var message sql.NullString
+	if runErr != nil {
+		status = models.JobRunStatusFailed
+		message = sql.NullString{String: runErr.Error(), Valid: true}
+	}
+
+	_, err := db.ExecContext(ctx, `
+	UPDATE job_runT
+	SET finishedat = CURRENT_TIMESTAMP, status = $2, error = $3
+	WHERE jobrunid = $1
+	`, runID, status, message)
+	return err
+}
+
+// GetJobRuns returns the latest runs of a job, or of every job when name is empty
+func (db *DB) GetJobRuns(name string, limit int) ([]models.JobRun, error) {
+	query := `
+	SELECT jobrunid, jobname, instance, startedat, finishedat, status, error
+	FROM job_runT
+	WHERE ($1 = '' OR jobname = $1)
+	ORDER BY startedat DESC, jobrunid DESC
+	LIMIT $2
+	`
+
+	rows, err := db.Query(query, name, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []models.JobRun{}
+	for rows.Next() {
+		var run models.JobRun
+		err := rows.Scan(
+			&run.JobRunID,
+			&run.JobName,
+			&run.Instance,
+			&run.StartedAt,
+			&run.FinishedAt,
+			&run.Status,
+			&run.Error,
+		)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+// RecomputeDeviceStatuses marks devices whose expiry or next inspection date has been
+// reached, using the same dates as calculateDeviceDates on the current date at each
+// device's site. Expiry takes precedence, recalled, failed and inactive devices are left alone.
+func (db *DB) RecomputeDeviceStatuses() (int64, error) {
+	query := `
+	WITH calculated AS (
+		SELECT ed.emergencydeviceid,
+			   CASE
+				   WHEN edt.emergencydevicetypename = 'Fire Extinguisher'
+						AND ed.manufacturedate + INTERVAL '5 years' <= today.d THEN 'Expired'
+				   WHEN ((ed.lastinspectiondatetime AT TIME ZONE s.timezone) + INTERVAL '3 months')::DATE <= today.d THEN 'Inspection Due'
+			   END AS status
+		FROM emergency_deviceT ed
+		JOIN emergency_device_typeT edt ON ed.emergencydevicetypeid = edt.emergencydevicetypeid
+		JOIN roomT r ON ed.roomid = r.roomid
+		JOIN buildingT b ON r.buildingid = b.buildingid
+		JOIN siteT s ON b.siteid = s.siteid
+		CROSS JOIN LATERAL (
+			SELECT (CURRENT_TIMESTAMP AT TIME ZONE s.timezone)::DATE AS d
+		) today
+		WHERE COALESCE(ed.status, '') NOT IN ('Recalled', 'Inspection Failed', 'Inactive')
+	)
+	UPDATE emergency_deviceT ed
+	SET status = calculated.status
+	FROM calculated
+	WHERE ed.emergencydeviceid = calculated.emergencydeviceid
+	  AND calculated.status IS NOT NULL
+	  AND ed.status IS DISTINCT FROM calculated.status
+	`
+
+	result, err := db.Exec(query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// RevokeToken stops a login token from being used again before it expires
+func (db *DB) RevokeToken(tokenID string, expiresAt time.Time) error {
+	_, err := db.Exec(`
+	INSERT INTO revoked_tokenT (tokenid, expiresat)
+	VALUES ($1, $2)
+	ON CONFLICT (tokenid) DO NOTHING
+	`, tokenID, expiresAt)
+	return err
+}
+
+// IsTokenRevoked reports whether a login token has been revoked
+func (db *DB) IsTokenRevoked(tokenID string) (bool, error) {
+	var revoked bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM revoked_tokenT WHERE tokenid = $1)`, tokenID).Scan(&revoked)
+	return revoked, err
+}
+
+// PurgeExpiredTokens removes revoked tokens that have expired anyway
+func (db *DB) PurgeExpiredTokens() (int64, error) {
+	result, err := db.Exec(`DELETE FROM revoked_tokenT WHERE expiresat < CURRENT_TIMESTAMP`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,332 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+)
+
+// locationDeviceLabel names a device in a location change, by type and serial number
+const locationDeviceLabel = `edt.emergencydevicetypename || COALESCE(' ' || ed.serialnumber, '')`
+
+// runLocationChange runs a location tree operation in a transaction. A preview is rolled
+// back, so it lists exactly the rows applying the operation would change.
+func (db *DB) runLocationChange(apply bool, operation func(tx *sql.Tx, change *models.LocationChange) error) (*models.LocationChange, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	change := &models.LocationChange{Rows: []models.LocationChangeRow{}}
+	if err := operation(tx, change); err != nil {
+		return nil, err
+	}
+
+	if apply {
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		change.Applied = true
+	}
+	return change, nil
+}
+
+// addLocationRows adds the rows returned by a query of ID, label and change to a
+// location change, and returns how many there were
+func addLocationRows(tx *sql.Tx, change *models.LocationChange, kind string, query string, args ...interface{}) (int, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		row := models.LocationChangeRow{Kind: kind}
+		if err := rows.Scan(&row.ID, &row.Label, &row.Change); err != nil {
+			return 0, err
+		}
+		change.Rows = append(change.Rows, row)
+		count++
+	}
+	return count, rows.Err()
+}
+
+// MoveRoom moves a room and its devices to a floor of another building. The devices'
+// pins are cleared when the room changes floor, as they are on another plan. Its devices
+// still pending on an open round of the old building, or of a site the room has left,
+// are skipped.
+func (db *DB) MoveRoom(roomID, buildingID, floorID int, apply bool) (*models.LocationChange, error) {
+	return db.runLocationChange(apply, func(tx *sql.Tx, change *models.LocationChange) error {
+		var oldFloorID int
+		err := tx.QueryRow(`SELECT floorid FROM roomT WHERE roomid = $1 FOR UPDATE`, roomID).Scan(&oldFloorID)
+		if err != nil {
+			return err
+		}
+
+		count, err := addLocationRows(tx, change, models.LocationChangeRoom, `
+		UPDATE roomT r
+		SET buildingid = nf.buildingid, floorid = nf.floorid
+		FROM buildingT ob, floorT oldf, floorT nf
+		JOIN buildingT nb ON nf.buildingid = nb.buildingid
+		WHERE r.roomid = $1 AND ob.buildingid = oldf.buildingid AND oldf.floorid = $4
+		  AND nf.floorid = $3 AND nf.buildingid = $2
+		RETURNING r.roomid, r.roomcode,
+			'Moved from ' || ob.buildingcode || ' (' || oldf.floorname || ') to ' || nb.buildingcode || ' (' || nf.floorname || ')'
+		`, roomID, buildingID, floorID, oldFloorID)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return sql.ErrNoRows
+		}
+
+		_, err = addLocationRows(tx, change, models.LocationChangeDevice, `
+		WITH device AS (
+			SELECT ed.emergencydeviceid, `+locationDeviceLabel+` AS label, ed.pinx IS NOT NULL AND $2 AS cleared
+			FROM emergency_deviceT ed
+			JOIN emergency_device_typeT edt ON ed.emergencydevicetypeid = edt.emergencydevicetypeid
+			WHERE ed.roomid = $1
+		), cleared AS (
+			UPDATE emergency_deviceT ed
+			SET pinx = NULL, piny = NULL
+			FROM device
+			WHERE ed.emergencydeviceid = device.emergencydeviceid AND device.cleared
+		)
+		SELECT emergencydeviceid, label,
+			CASE WHEN cleared THEN 'Moves with the room, pin cleared' ELSE 'Moves with the room' END
+		FROM device
+		ORDER BY label
+		`, roomID, floorID != oldFloorID)
+		if err != nil {
+			return err
+		}
+
+		start := len(change.Rows)
+		_, err = addLocationRows(tx, change, models.LocationChangeInspectionRound, `
+		UPDATE inspection_round_itemT i
+		SET status = 'Skipped', skipreason = 'Other', skipnotes = 'Room moved to another building', updatedat = CURRENT_TIMESTAMP
+		FROM emergency_deviceT ed, buildingT nb, inspection_roundT ir
+		WHERE i.emergencydeviceid = ed.emergencydeviceid AND ed.roomid = $1 AND nb.buildingid = $2
+		  AND ir.inspectionroundid = i.inspectionroundid AND i.status = 'Pending'
+		  AND (ir.buildingid <> $2 OR ir.siteid <> nb.siteid) AND ir.status NOT IN ('Completed', 'Cancelled')
+		RETURNING ir.inspectionroundid, ir.roundname,
+			'Skipped pending device ' || COALESCE(ed.serialnumber, '#' || ed.emergencydeviceid)
+		`, roomID, buildingID)
+		if err != nil {
+			return err
+		}
+		return refreshLocationRounds(tx, change.Rows[start:])
+	})
+}
+
+// MoveBuilding moves a building, with its floors, rooms and devices, to another site.
+// Its position on the old site map is cleared, and its inspection rounds and digest
+// subscriptions follow it to the new site. Its devices still pending on an open round of
+// the whole old site are skipped, as they are no longer at that site.
+func (db *DB) MoveBuilding(buildingID, siteID int, apply bool) (*models.LocationChange, error) {
+	return db.runLocationChange(apply, func(tx *sql.Tx, change *models.LocationChange) error {
+		count, err := addLocationRows(tx, change, models.LocationChangeBuilding, `
+		UPDATE buildingT b
+		SET siteid = ns.siteid, mapx = NULL, mapy = NULL, mappolygon = NULL
+		FROM buildingT old
+		JOIN siteT os ON old.siteid = os.siteid,
+		siteT ns
+		WHERE b.buildingid = $1 AND old.buildingid = b.buildingid AND ns.siteid = $2
+		RETURNING b.buildingid, b.buildingcode,
+			'Moved from ' || os.sitename || ' to ' || ns.sitename ||
+			CASE WHEN old.mapx IS NOT NULL OR old.mappolygon IS NOT NULL THEN ', site map position cleared' ELSE '' END
+		`, buildingID, siteID)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return sql.ErrNoRows
+		}
+
+		steps := []struct {
+			kind  string
+			query string
+			args  []interface{}
+		}{
+			{models.LocationChangeRoom, `
+			SELECT r.roomid, r.roomcode, 'Moves with the building'
+			FROM roomT r
+			JOIN floorT f ON r.floorid = f.floorid
+			WHERE r.buildingid = $1
+			ORDER BY f.floororder, r.roomcode
+			`, []interface{}{buildingID}},
+			{models.LocationChangeDevice, `
+			SELECT ed.emergencydeviceid, r.roomcode || ': ' || ` + locationDeviceLabel + `, 'Moves with the building'
+			FROM emergency_deviceT ed
+			JOIN emergency_device_typeT edt ON ed.emergencydevicetypeid = edt.emergencydevicetypeid
+			JOIN roomT r ON ed.roomid = r.roomid
+			WHERE r.buildingid = $1
+			ORDER BY r.roomcode, ed.serialnumber
+			`, []interface{}{buildingID}},
+			{models.LocationChangeInspectionRound, `
+			UPDATE inspection_roundT
+			SET siteid = $2
+			WHERE buildingid = $1
+			RETURNING inspectionroundid, roundname, 'Moves to the new site'
+			`, []interface{}{buildingID, siteID}},
+			{models.LocationChangeDigestSubscription, `
+			UPDATE digest_subscriptionT ds
+			SET siteid = $2
+			FROM userT u
+			WHERE ds.buildingid = $1 AND u.userid = ds.userid
+			RETURNING ds.userid, u.username, 'Digest moves to the new site'
+			`, []interface{}{buildingID, siteID}},
+		}
+		for _, step := range steps {
+			if _, err := addLocationRows(tx, change, step.kind, step.query, step.args...); err != nil {
+				return err
+			}
+		}
+
+		// Rounds of the building have moved with it, so any other round still at another
+		// site covers the whole old site
+		start := len(change.Rows)
+		_, err = addLocationRows(tx, change, models.LocationChangeInspectionRound, `
+		UPDATE inspection_round_itemT i
+		SET status = 'Skipped', skipreason = 'Other', skipnotes = 'Building moved to another site', updatedat = CURRENT_TIMESTAMP
+		FROM emergency_deviceT ed, roomT r, inspection_roundT ir
+		WHERE i.emergencydeviceid = ed.emergencydeviceid AND ed.roomid = r.roomid AND r.buildingid = $1
+		  AND ir.inspectionroundid = i.inspectionroundid AND i.status = 'Pending'
+		  AND ir.siteid <> $2 AND ir.status NOT IN ('Completed', 'Cancelled')
+		RETURNING ir.inspectionroundid, ir.roundname,
+			'Skipped pending device ' || COALESCE(ed.serialnumber, '#' || ed.emergencydeviceid)
+		`, buildingID, siteID)
+		if err != nil {
+			return err
+		}
+		return refreshLocationRounds(tx, change.Rows[start:])
+	})
+}
+
+// MergeRooms moves the devices of one room into another and deletes the room, for rooms
+// added twice. The devices' pins are cleared when the rooms are on different floors.
+func (db *DB) MergeRooms(roomID, intoRoomID int, apply bool) (*models.LocationChange, error) {
+	return db.runLocationChange(apply, func(tx *sql.Tx, change *models.LocationChange) error {
+		_, err := addLocationRows(tx, change, models.LocationChangeDevice, `
+		WITH device AS (
+			SELECT ed.emergencydeviceid, `+locationDeviceLabel+` AS label, ed.pinx IS NOT NULL AND r.floorid <> target.floorid AS cleared,
+				   target.roomcode AS targetcode
+			FROM emergency_deviceT ed
+			JOIN emergency_device_typeT edt ON ed.emergencydevicetypeid = edt.emergencydevicetypeid
+			JOIN roomT r ON ed.roomid = r.roomid
+			JOIN roomT target ON target.roomid = $2
+			WHERE ed.roomid = $1
+		)
+		UPDATE emergency_deviceT ed
+		SET roomid = $2,
+			pinx = CASE WHEN device.cleared THEN NULL ELSE ed.pinx END,
+			piny = CASE WHEN device.cleared THEN NULL ELSE ed.piny END
+		FROM device
+		WHERE ed.emergencydeviceid = device.emergencydeviceid
+		RETURNING ed.emergencydeviceid, device.label,
+			'Moved to room ' || device.targetcode || CASE WHEN device.cleared THEN ', pin cleared' ELSE '' END
+		`, roomID, intoRoomID)
+		if err != nil {
+			return err
+		}
+
+		count, err := addLocationRows(tx, change, models.LocationChangeRoom, `
+		DELETE FROM roomT r
+		USING roomT target
+		WHERE r.roomid = $1 AND target.roomid = $2 AND r.roomid <> target.roomid
+		RETURNING r.roomid, r.roomcode, 'Deleted, merged into room ' || target.roomcode
+		`, roomID, intoRoomID)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
+
+// ArchiveBuilding archives a building with its rooms and makes its devices inactive, so
+// they are no longer listed, inspected or notified about. The status each device had is
+// kept in statusbeforearchive. Devices still pending on an open inspection round are
+// skipped so the round can be completed.
+func (db *DB) ArchiveBuilding(buildingID int, apply bool) (*models.LocationChange, error) {
+	return db.runLocationChange(apply, func(tx *sql.Tx, change *models.LocationChange) error {
+		count, err := addLocationRows(tx, change, models.LocationChangeBuilding, `
+		UPDATE buildingT
+		SET archivedat = CURRENT_TIMESTAMP
+		WHERE buildingid = $1 AND archivedat IS NULL
+		RETURNING buildingid, buildingcode, 'Archived'
+		`, buildingID)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return sql.ErrNoRows
+		}
+
+		_, err = addLocationRows(tx, change, models.LocationChangeRoom, `
+		SELECT r.roomid, r.roomcode, 'Archived with the building'
+		FROM roomT r
+		JOIN floorT f ON r.floorid = f.floorid
+		WHERE r.buildingid = $1
+		ORDER BY f.floororder, r.roomcode
+		`, buildingID)
+		if err != nil {
+			return err
+		}
+
+		_, err = addLocationRows(tx, change, models.LocationChangeDevice, `
+		WITH device AS (
+			SELECT ed.emergencydeviceid, r.roomcode || ': ' || `+locationDeviceLabel+` AS label, COALESCE(ed.status, 'No status') AS status
+			FROM emergency_deviceT ed
+			JOIN emergency_device_typeT edt ON ed.emergencydevicetypeid = edt.emergencydevicetypeid
+			JOIN roomT r ON ed.roomid = r.roomid
+			WHERE r.buildingid = $1 AND COALESCE(ed.status, '') <> 'Inactive'
+		)
+		UPDATE emergency_deviceT ed
+		SET status = 'Inactive', statusbeforearchive = ed.status
+		FROM device
+		WHERE ed.emergencydeviceid = device.emergencydeviceid
+		RETURNING ed.emergencydeviceid, device.label, device.status || ' changed to Inactive'
+		`, buildingID)
+		if err != nil {
+			return err
+		}
+
+		start := len(change.Rows)
+		_, err = addLocationRows(tx, change, models.LocationChangeInspectionRound, `
+		UPDATE inspection_round_itemT i
+		SET status = 'Skipped', skipreason = 'Other', skipnotes = 'Building archived', updatedat = CURRENT_TIMESTAMP
+		FROM emergency_deviceT ed, roomT r, inspection_roundT ir
+		WHERE i.emergencydeviceid = ed.emergencydeviceid AND ed.roomid = r.roomid AND r.buildingid = $1
+		  AND ir.inspectionroundid = i.inspectionroundid AND i.status = 'Pending'
+		  AND ir.status NOT IN ('Completed', 'Cancelled')
+		RETURNING ir.inspectionroundid, ir.roundname,
+			'Skipped pending device ' || COALESCE(ed.serialnumber, '#' || ed.emergencydeviceid)
+		`, buildingID)
+		if err != nil {
+			return err
+		}
+
+		return refreshLocationRounds(tx, change.Rows[start:])
+	})
+}
+
+// refreshLocationRounds refreshes the status of the rounds a location change skipped
+// devices of, as they may be complete now their pending devices are skipped
+func refreshLocationRounds(tx *sql.Tx, rows []models.LocationChangeRow) error {
+	refreshed := map[int]bool{}
+	for _, row := range rows {
+		if refreshed[row.ID] {
+			continue
+		}
+		if err := refreshInspectionRoundStatus(tx, row.ID); err != nil {
+			return err
+		}
+		refreshed[row.ID] = true
+	}
+	return nil
+}
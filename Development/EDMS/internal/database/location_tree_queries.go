@@ -0,0 +1,180 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+)
+
+// rowsQuerier is satisfied by both DB and a transaction
+type rowsQuerier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// GetLocationTree returns every site with its buildings, their floors from the lowest and
+// their rooms. Archived buildings are included and marked, as their codes are still
+// taken.
+func (db *DB) GetLocationTree() ([]models.LocationTreeSite, error) {
+	return getLocationTree(db)
+}
+
+func getLocationTree(q rowsQuerier) ([]models.LocationTreeSite, error) {
+	rows, err := q.Query(`
+	SELECT s.sitename, COALESCE(s.siteaddress, ''), s.timezone,
+		   b.buildingcode, b.archivedat IS NOT NULL, f.floorname, f.floororder, r.roomcode
+	FROM siteT s
+	LEFT JOIN buildingT b ON b.siteid = s.siteid
+	LEFT JOIN floorT f ON f.buildingid = b.buildingid
+	LEFT JOIN roomT r ON r.floorid = f.floorid
+	ORDER BY s.sitename, b.buildingcode, f.floororder, f.floorname, r.roomcode
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sites := []models.LocationTreeSite{}
+	for rows.Next() {
+		var site models.LocationTreeSite
+		var buildingCode, floorName, roomCode sql.NullString
+		var archived sql.NullBool
+		var floorOrder sql.NullInt64
+		err := rows.Scan(&site.SiteName, &site.SiteAddress, &site.TimeZone,
+			&buildingCode, &archived, &floorName, &floorOrder, &roomCode)
+		if err != nil {
+			return nil, err
+		}
+
+		// Rows are ordered, so each row adds to the last site, building and floor
+		if len(sites) == 0 || sites[len(sites)-1].SiteName != site.SiteName {
+			site.Buildings = []models.LocationTreeBuilding{}
+			sites = append(sites, site)
+		}
+		current := &sites[len(sites)-1]
+		if !buildingCode.Valid {
+			continue
+		}
+
+		buildings := current.Buildings
+		if len(buildings) == 0 || buildings[len(buildings)-1].BuildingCode != buildingCode.String {
+			current.Buildings = append(current.Buildings, models.LocationTreeBuilding{
+				BuildingCode: buildingCode.String,
+				Floors:       []models.LocationTreeFloor{},
+				Rooms:        []models.LocationTreeRoom{},
+				Archived:     archived.Bool,
+			})
+		}
+		building := &current.Buildings[len(current.Buildings)-1]
+		if !floorName.Valid {
+			continue
+		}
+
+		floors := building.Floors
+		if len(floors) == 0 || floors[len(floors)-1].FloorName != floorName.String {
+			order := int(floorOrder.Int64)
+			building.Floors = append(building.Floors, models.LocationTreeFloor{FloorName: floorName.String, FloorOrder: &order})
+		}
+		if roomCode.Valid {
+			building.Rooms = append(building.Rooms, models.LocationTreeRoom{RoomCode: roomCode.String, FloorName: floorName.String})
+		}
+	}
+
+	return sites, rows.Err()
+}
+
+// ApplyLocationImport adds or updates the sites, buildings, floors and rooms of an
+// imported location tree, matching them on their unique keys. Sites are matched by name,
+// buildings by (SiteID, BuildingCode), floors by (BuildingID, FloorName) and rooms by
+// (BuildingID, RoomCode). check is given the location tree as it is when the import is
+// applied, and the import is not applied if it returns an error. Nothing is changed if
+// any of it fails.
+func (db *DB) ApplyLocationImport(sites []models.LocationTreeSite, check func(current []models.LocationTreeSite) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Locations cannot change until the import is committed, so they are still as checked
+	if _, err := tx.Exec(`LOCK TABLE SiteT, BuildingT, FloorT, RoomT IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return err
+	}
+	current, err := getLocationTree(tx)
+	if err != nil {
+		return err
+	}
+	if err := check(current); err != nil {
+		return err
+	}
+
+	for _, site := range sites {
+		var siteID int
+		err := tx.QueryRow(`
+		INSERT INTO SiteT (SiteName, SiteAddress, TimeZone) VALUES ($1, $2, $3)
+		ON CONFLICT (SiteName) DO UPDATE SET SiteAddress = EXCLUDED.SiteAddress, TimeZone = EXCLUDED.TimeZone
+		RETURNING SiteID
+		`, site.SiteName, site.SiteAddress, site.TimeZone).Scan(&siteID)
+		if err != nil {
+			return err
+		}
+
+		for _, building := range site.Buildings {
+			var buildingID int
+			err := tx.QueryRow(`
+			INSERT INTO BuildingT (SiteID, BuildingCode) VALUES ($1, $2)
+			ON CONFLICT (SiteID, BuildingCode) DO UPDATE SET BuildingCode = EXCLUDED.BuildingCode
+			RETURNING BuildingID
+			`, siteID, building.BuildingCode).Scan(&buildingID)
+			if err != nil {
+				return err
+			}
+
+			for _, floor := range building.Floors {
+				_, err := tx.Exec(`
+				INSERT INTO FloorT (BuildingID, FloorName, FloorOrder)
+				VALUES ($1, $2, COALESCE($3, (SELECT COALESCE(MAX(FloorOrder) + 1, 0) FROM FloorT WHERE BuildingID = $1)))
+				ON CONFLICT (BuildingID, FloorName) DO UPDATE SET FloorOrder = COALESCE($3, FloorT.FloorOrder)
+				`, buildingID, floor.FloorName, floor.FloorOrder)
+				if err != nil {
+					return err
+				}
+			}
+
+			// A new building imported without floors gets its default floor, as in AddBuilding
+			_, err = tx.Exec(`
+			INSERT INTO FloorT (BuildingID, FloorName, FloorOrder)
+			SELECT $1, $2, 0
+			WHERE NOT EXISTS (SELECT 1 FROM FloorT WHERE BuildingID = $1)
+			`, buildingID, DefaultFloorName)
+			if err != nil {
+				return err
+			}
+
+			// A room moved to another floor has its devices' pins cleared, as in UpdateRoom
+			for _, room := range building.Rooms {
+				_, err := tx.Exec(`
+				WITH floor AS (
+					SELECT COALESCE(
+						(SELECT FloorID FROM FloorT WHERE BuildingID = $1 AND FloorName = $3),
+						(SELECT FloorID FROM RoomT WHERE BuildingID = $1 AND RoomCode = $2),
+						(SELECT FloorID FROM FloorT WHERE BuildingID = $1 ORDER BY FloorOrder, FloorID LIMIT 1)
+					) AS FloorID
+				), unpinned AS (
+					UPDATE Emergency_DeviceT ed
+					SET PinX = NULL, PinY = NULL
+					FROM RoomT r, floor
+					WHERE ed.RoomID = r.RoomID AND r.BuildingID = $1 AND r.RoomCode = $2 AND r.FloorID <> floor.FloorID
+				)
+				INSERT INTO RoomT (BuildingID, FloorID, RoomCode)
+				SELECT $1, FloorID, $2 FROM floor
+				ON CONFLICT (BuildingID, RoomCode) DO UPDATE SET FloorID = EXCLUDED.FloorID
+				`, buildingID, room.RoomCode, room.FloorName)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,137 @@
+-- +goose Up
+
+-- Manufacturer table to store the companies that make emergency devices
+CREATE TABLE ManufacturerT (
+    ManufacturerID SERIAL PRIMARY KEY,
+    ManufacturerName VARCHAR(100) NOT NULL UNIQUE
+);
+
+-- Device Model table to store the catalog of models offered by each manufacturer
+CREATE TABLE Device_ModelT (
+    DeviceModelID SERIAL PRIMARY KEY,
+    ManufacturerID INT NOT NULL,
+    ModelName VARCHAR(100) NOT NULL,
+    FOREIGN KEY (ManufacturerID) REFERENCES ManufacturerT(ManufacturerID)
+        ON UPDATE CASCADE  -- If a ManufacturerID changes, update it in Device_ModelT
+        ON DELETE RESTRICT, -- Prevent deletion of a Manufacturer if it has associated Models
+    UNIQUE (ManufacturerID, ModelName)  -- Ensure unique model names within each manufacturer
+);
+
+-- Link devices to the model catalog and record the production batch
+ALTER TABLE Emergency_DeviceT
+    ADD COLUMN DeviceModelID INT NULL,
+    ADD COLUMN BatchNumber VARCHAR(50) NULL,
+    ADD FOREIGN KEY (DeviceModelID) REFERENCES Device_ModelT(DeviceModelID)
+        ON UPDATE CASCADE  -- If a DeviceModelID changes, update it in Emergency_DeviceT
+        ON DELETE SET NULL; -- If a Model is deleted, set the DeviceModelID to NULL in Emergency_DeviceT
+
+-- Recall table to store manufacturer recalls, scoped by model, serial number range and/or batch
+CREATE TABLE RecallT (
+    RecallID SERIAL PRIMARY KEY,
+    ManufacturerID INT NOT NULL,
+    DeviceModelID INT NULL,           -- NULL means every model from the manufacturer
+    SerialNumberFrom VARCHAR(50) NULL, -- Inclusive lower bound of the affected serial numbers
+    SerialNumberTo VARCHAR(50) NULL,   -- Inclusive upper bound of the affected serial numbers
+    BatchNumber VARCHAR(50) NULL,
+    RecallDate DATE NOT NULL,
+    ActionRequired VARCHAR(255) NOT NULL,
+    IsClosed BOOLEAN NOT NULL DEFAULT FALSE,
+    CreatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (ManufacturerID) REFERENCES ManufacturerT(ManufacturerID)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT, -- Prevent deletion of a Manufacturer if it has associated Recalls
+    FOREIGN KEY (DeviceModelID) REFERENCES Device_ModelT(DeviceModelID)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT -- Prevent deletion of a Model if it has associated Recalls
+);
+
+-- Device Recall table to store which devices have been flagged by which recall
+CREATE TABLE Device_RecallT (
+    EmergencyDeviceID INT NOT NULL,
+    RecallID INT NOT NULL,
+    PreviousStatus VARCHAR(50) NULL, -- Device status before it was flagged, restored on resolution
+    FlaggedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ResolvedAt TIMESTAMP NULL,
+    PRIMARY KEY (EmergencyDeviceID, RecallID),
+    FOREIGN KEY (EmergencyDeviceID) REFERENCES Emergency_DeviceT(EmergencyDeviceID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE, -- Delete associated flags if an Emergency Device is deleted
+    FOREIGN KEY (RecallID) REFERENCES RecallT(RecallID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE -- Delete associated flags if a Recall is deleted
+);
+
+-- Keep recalled devices in the Recalled status when they are inspected
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION update_device_status_on_inspection()
+RETURNS TRIGGER AS $$
+DECLARE
+    current_last_inspection_timestamp TIMESTAMP;
+    calculated_expire_date TIMESTAMP;
+BEGIN
+    -- Retrieve the current last inspection timestamp and manufacture date for the device
+    SELECT LastInspectionDateTime, ManufactureDate INTO current_last_inspection_timestamp, calculated_expire_date
+    FROM Emergency_DeviceT
+    WHERE EmergencyDeviceID = NEW.EmergencyDeviceID;
+
+    -- Calculate the expiration date as ManufactureDate + 5 years
+    calculated_expire_date := calculated_expire_date + INTERVAL '5 years';
+
+    -- Check if the new inspection timestamp is more recent than the current last inspection timestamp
+    IF current_last_inspection_timestamp IS NULL OR NEW.InspectionDateTime > current_last_inspection_timestamp THEN
+        -- Determine the status based on inspection and expiration conditions
+        UPDATE Emergency_DeviceT
+        SET LastInspectionDateTime = NEW.InspectionDateTime,
+            Status = CASE
+                        WHEN Status = 'Recalled' THEN Status
+                        WHEN NEW.InspectionStatus = 'Failed' THEN 'Inspection Failed'
+                        WHEN calculated_expire_date <= NOW() THEN 'Expired'
+                        WHEN NEW.InspectionStatus = 'Passed' THEN 'Active'
+                        ELSE Status
+                    END
+        WHERE EmergencyDeviceID = NEW.EmergencyDeviceID;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION update_device_status_on_inspection()
+RETURNS TRIGGER AS $$
+DECLARE
+    current_last_inspection_timestamp TIMESTAMP;
+    calculated_expire_date TIMESTAMP;
+BEGIN
+    SELECT LastInspectionDateTime, ManufactureDate INTO current_last_inspection_timestamp, calculated_expire_date
+    FROM Emergency_DeviceT
+    WHERE EmergencyDeviceID = NEW.EmergencyDeviceID;
+
+    calculated_expire_date := calculated_expire_date + INTERVAL '5 years';
+
+    IF current_last_inspection_timestamp IS NULL OR NEW.InspectionDateTime > current_last_inspection_timestamp THEN
+        UPDATE Emergency_DeviceT
+        SET LastInspectionDateTime = NEW.InspectionDateTime,
+            Status = CASE
+                        WHEN NEW.InspectionStatus = 'Failed' THEN 'Inspection Failed'
+                        WHEN calculated_expire_date <= NOW() THEN 'Expired'
+                        WHEN NEW.InspectionStatus = 'Passed' THEN 'Active'
+                        ELSE Status
+                    END
+        WHERE EmergencyDeviceID = NEW.EmergencyDeviceID;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+DROP TABLE IF EXISTS Device_RecallT;
+DROP TABLE IF EXISTS RecallT;
+ALTER TABLE Emergency_DeviceT
+    DROP COLUMN IF EXISTS BatchNumber,
+    DROP COLUMN IF EXISTS DeviceModelID;
+DROP TABLE IF EXISTS Device_ModelT;
+DROP TABLE IF EXISTS ManufacturerT;
@@ -0,0 +1,35 @@
+-- +goose Up
+
+-- Attachment table to store photos and documents uploaded against devices and inspections.
+-- File contents live in the upload store, not in the public /static tree; StorageKey and
+-- ThumbnailKey locate them there.
+CREATE TABLE AttachmentT (
+    AttachmentID SERIAL PRIMARY KEY,
+    EmergencyDeviceID INT NULL,
+    EmergencyDeviceInspectionID INT NULL,
+    FileName VARCHAR(255) NOT NULL,    -- Original file name, only used for downloads
+    ContentType VARCHAR(100) NOT NULL, -- Sniffed from the file contents, not taken from the client
+    SizeBytes BIGINT NOT NULL,
+    StorageKey VARCHAR(255) NOT NULL UNIQUE,
+    ThumbnailKey VARCHAR(255) NULL,    -- Only set for images
+    Description VARCHAR(255) NULL,
+    UploadedBy INT NOT NULL,
+    UploadedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (EmergencyDeviceID) REFERENCES Emergency_DeviceT(EmergencyDeviceID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE, -- Delete associated Attachments if an Emergency Device is deleted
+    FOREIGN KEY (EmergencyDeviceInspectionID) REFERENCES Emergency_Device_InspectionT(EmergencyDeviceInspectionID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE, -- Delete associated Attachments if an Inspection is deleted
+    FOREIGN KEY (UploadedBy) REFERENCES UserT(UserID)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT, -- Prevent deletion of a User if they have uploaded Attachments
+    -- Each attachment belongs to exactly one owner
+    CHECK ((EmergencyDeviceID IS NOT NULL)::INT + (EmergencyDeviceInspectionID IS NOT NULL)::INT = 1)
+);
+
+CREATE INDEX idx_attachment_device ON AttachmentT(EmergencyDeviceID);
+CREATE INDEX idx_attachment_inspection ON AttachmentT(EmergencyDeviceInspectionID);
+
+-- +goose Down
+DROP TABLE IF EXISTS AttachmentT;
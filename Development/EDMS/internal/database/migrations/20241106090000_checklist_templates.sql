@@ -0,0 +1,142 @@
+-- +goose Up
+
+-- Checklist templates replace the fixed extinguisher questions on Emergency_Device_InspectionT.
+-- Each device type has its own versioned question sets; a version is never edited once
+-- created, changes are made by adding the next version, and new inspections use the
+-- latest version for the device's type.
+CREATE TABLE Checklist_TemplateT (
+    ChecklistTemplateID SERIAL PRIMARY KEY,
+    EmergencyDeviceTypeID INT NOT NULL,
+    TemplateName VARCHAR(100) NOT NULL,
+    Version INT NOT NULL,
+    CreatedBy INT NULL,
+    CreatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (EmergencyDeviceTypeID) REFERENCES Emergency_Device_TypeT(EmergencyDeviceTypeID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE, -- A Device Type can only be deleted once it has no devices, so no answers are lost
+    FOREIGN KEY (CreatedBy) REFERENCES UserT(UserID)
+        ON UPDATE CASCADE
+        ON DELETE SET NULL,
+    UNIQUE (EmergencyDeviceTypeID, Version)
+);
+
+CREATE TABLE Checklist_QuestionT (
+    ChecklistQuestionID SERIAL PRIMARY KEY,
+    ChecklistTemplateID INT NOT NULL,
+    SortOrder INT NOT NULL,
+    QuestionText VARCHAR(255) NOT NULL,
+    AnswerType VARCHAR(20) NOT NULL CHECK (AnswerType IN ('YesNoNA', 'Number', 'Text', 'Photo')),
+    IsRequired BOOLEAN NOT NULL DEFAULT TRUE,
+    LegacyColumn VARCHAR(50) NULL, -- Emergency_Device_InspectionT column the question was migrated from
+    FOREIGN KEY (ChecklistTemplateID) REFERENCES Checklist_TemplateT(ChecklistTemplateID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE,
+    UNIQUE (ChecklistTemplateID, SortOrder)
+);
+
+ALTER TABLE Emergency_Device_InspectionT
+    ADD COLUMN ChecklistTemplateID INT NULL
+        REFERENCES Checklist_TemplateT(ChecklistTemplateID)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT; -- Prevent deletion of a template that inspections were answered against
+
+-- One answer per question per inspection, only the column matching the question's AnswerType is set
+CREATE TABLE Inspection_ResponseT (
+    InspectionResponseID SERIAL PRIMARY KEY,
+    EmergencyDeviceInspectionID INT NOT NULL,
+    ChecklistQuestionID INT NOT NULL,
+    AnswerYesNo VARCHAR(3) NULL CHECK (AnswerYesNo IN ('Yes', 'No', 'N/A')),
+    AnswerNumber NUMERIC(12, 3) NULL,
+    AnswerText VARCHAR(1000) NULL,
+    AttachmentID INT NULL, -- Photo answers point at an attachment of the inspection
+    FOREIGN KEY (EmergencyDeviceInspectionID) REFERENCES Emergency_Device_InspectionT(EmergencyDeviceInspectionID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE, -- Delete associated Responses if an Inspection is deleted
+    FOREIGN KEY (ChecklistQuestionID) REFERENCES Checklist_QuestionT(ChecklistQuestionID)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    FOREIGN KEY (AttachmentID) REFERENCES AttachmentT(AttachmentID)
+        ON UPDATE CASCADE
+        ON DELETE SET NULL,
+    UNIQUE (EmergencyDeviceInspectionID, ChecklistQuestionID)
+);
+
+CREATE INDEX idx_checklist_template_device_type ON Checklist_TemplateT(EmergencyDeviceTypeID);
+CREATE INDEX idx_inspection_response_question ON Inspection_ResponseT(ChecklistQuestionID);
+
+-- migrate_legacy_inspections creates the default "Fire Extinguisher" v1 template from the
+-- fixed checklist columns and copies the answers of every inspection recorded with those
+-- columns into Inspection_ResponseT. The columns are kept so no data is lost. It is run
+-- below for existing databases and again by the seeder after it inserts its inspections.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION migrate_legacy_inspections()
+RETURNS INTEGER AS $$
+DECLARE
+    extinguisher_type_id INT;
+    template_id INT;
+    migrated_count INT;
+BEGIN
+    SELECT EmergencyDeviceTypeID INTO extinguisher_type_id
+    FROM Emergency_Device_TypeT
+    WHERE EmergencyDeviceTypeName = 'Fire Extinguisher';
+
+    IF extinguisher_type_id IS NULL THEN
+        RETURN 0;
+    END IF;
+
+    SELECT ChecklistTemplateID INTO template_id
+    FROM Checklist_TemplateT
+    WHERE EmergencyDeviceTypeID = extinguisher_type_id AND Version = 1;
+
+    IF template_id IS NULL THEN
+        INSERT INTO Checklist_TemplateT (EmergencyDeviceTypeID, TemplateName, Version)
+        VALUES (extinguisher_type_id, 'Fire Extinguisher', 1)
+        RETURNING ChecklistTemplateID INTO template_id;
+
+        INSERT INTO Checklist_QuestionT (ChecklistTemplateID, SortOrder, QuestionText, AnswerType, IsRequired, LegacyColumn)
+        VALUES
+            (template_id, 1, 'Is Conspicuous', 'YesNoNA', TRUE, 'isconspicuous'),
+            (template_id, 2, 'Is Accessible', 'YesNoNA', TRUE, 'isaccessible'),
+            (template_id, 3, 'Is in Assigned Location', 'YesNoNA', TRUE, 'isassignedlocation'),
+            (template_id, 4, 'Is Sign Visible', 'YesNoNA', TRUE, 'issignvisible'),
+            (template_id, 5, 'Is Anti-Tamper Device Intact', 'YesNoNA', TRUE, 'isantitamperdeviceintact'),
+            (template_id, 6, 'Is Support Bracket Secure', 'YesNoNA', TRUE, 'issupportbracketsecure'),
+            (template_id, 7, 'Are Operating Instructions Clear', 'YesNoNA', TRUE, 'areoperatinginstructionsclear'),
+            (template_id, 8, 'Is Maintenance Tag Attached', 'YesNoNA', TRUE, 'ismaintenancetagattached'),
+            (template_id, 9, 'Is No External Damage', 'YesNoNA', TRUE, 'isnoexternaldamage'),
+            (template_id, 10, 'Is Charge Gauge Normal', 'YesNoNA', TRUE, 'ischargegaugenormal'),
+            (template_id, 11, 'Are Maintenance Records Complete', 'YesNoNA', TRUE, 'aremaintenancerecordscomplete'),
+            (template_id, 12, 'Is Replaced', 'YesNoNA', TRUE, 'isreplaced');
+    END IF;
+
+    -- Inspections answered on the old form have at least one checklist column set.
+    -- An unchecked box was saved as false or NULL, both become "No".
+    WITH legacy AS (
+        UPDATE Emergency_Device_InspectionT
+        SET ChecklistTemplateID = template_id
+        WHERE ChecklistTemplateID IS NULL
+          AND num_nonnulls(IsConspicuous, IsAccessible, IsAssignedLocation, IsSignVisible, IsAntiTamperDeviceIntact,
+                           IsSupportBracketSecure, AreOperatingInstructionsClear, IsMaintenanceTagAttached,
+                           IsNoExternalDamage, IsChargeGaugeNormal, IsReplaced, AreMaintenanceRecordsComplete) > 0
+        RETURNING *
+    )
+    INSERT INTO Inspection_ResponseT (EmergencyDeviceInspectionID, ChecklistQuestionID, AnswerYesNo)
+    SELECT legacy.EmergencyDeviceInspectionID, q.ChecklistQuestionID,
+           CASE WHEN COALESCE((to_jsonb(legacy) ->> q.LegacyColumn)::BOOLEAN, FALSE) THEN 'Yes' ELSE 'No' END
+    FROM legacy
+    JOIN Checklist_QuestionT q ON q.ChecklistTemplateID = template_id AND q.LegacyColumn IS NOT NULL;
+
+    GET DIAGNOSTICS migrated_count = ROW_COUNT;
+    RETURN migrated_count;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+SELECT migrate_legacy_inspections();
+
+-- +goose Down
+DROP FUNCTION IF EXISTS migrate_legacy_inspections();
+DROP TABLE IF EXISTS Inspection_ResponseT;
+ALTER TABLE Emergency_Device_InspectionT DROP COLUMN IF EXISTS ChecklistTemplateID;
+DROP TABLE IF EXISTS Checklist_QuestionT;
+DROP TABLE IF EXISTS Checklist_TemplateT;
@@ -0,0 +1,236 @@
+-- +goose Up
+
+-- Each checklist question is critical or advisory. A critical question answered "No" fails
+-- the inspection, an advisory one passes it with defects. The outcome is calculated by the
+-- server and stored in ComputedStatus; InspectionStatus only differs from it when an admin
+-- overrode the result, in which case who did it and why is recorded.
+ALTER TABLE Checklist_QuestionT
+    ADD COLUMN Severity VARCHAR(10) NOT NULL DEFAULT 'Critical'
+        CHECK (Severity IN ('Critical', 'Advisory'));
+
+-- Items that do not stop the extinguisher from being used are advisory
+UPDATE Checklist_QuestionT
+SET Severity = 'Advisory'
+WHERE LegacyColumn IN ('issignvisible', 'areoperatinginstructionsclear', 'ismaintenancetagattached',
+                       'aremaintenancerecordscomplete', 'isreplaced');
+
+ALTER TABLE Emergency_Device_InspectionT
+    ADD COLUMN ComputedStatus VARCHAR(20) NULL,
+    ADD COLUMN OverriddenBy INT NULL
+        REFERENCES UserT(UserID)
+        ON UPDATE CASCADE
+        ON DELETE SET NULL,
+    ADD COLUMN OverrideJustification VARCHAR(500) NULL;
+
+-- NOT VALID keeps any older free form values while new rows are checked
+ALTER TABLE Emergency_Device_InspectionT
+    ADD CONSTRAINT chk_inspection_status
+        CHECK (InspectionStatus IN ('Passed', 'Passed with defects', 'Failed')) NOT VALID;
+
+-- Recreate the legacy migration so the default extinguisher template is seeded with severities
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION migrate_legacy_inspections()
+RETURNS INTEGER AS $$
+DECLARE
+    extinguisher_type_id INT;
+    template_id INT;
+    migrated_count INT;
+BEGIN
+    SELECT EmergencyDeviceTypeID INTO extinguisher_type_id
+    FROM Emergency_Device_TypeT
+    WHERE EmergencyDeviceTypeName = 'Fire Extinguisher';
+
+    IF extinguisher_type_id IS NULL THEN
+        RETURN 0;
+    END IF;
+
+    SELECT ChecklistTemplateID INTO template_id
+    FROM Checklist_TemplateT
+    WHERE EmergencyDeviceTypeID = extinguisher_type_id AND Version = 1;
+
+    IF template_id IS NULL THEN
+        INSERT INTO Checklist_TemplateT (EmergencyDeviceTypeID, TemplateName, Version)
+        VALUES (extinguisher_type_id, 'Fire Extinguisher', 1)
+        RETURNING ChecklistTemplateID INTO template_id;
+
+        INSERT INTO Checklist_QuestionT (ChecklistTemplateID, SortOrder, QuestionText, AnswerType, IsRequired, Severity, LegacyColumn)
+        VALUES
+            (template_id, 1, 'Is Conspicuous', 'YesNoNA', TRUE, 'Critical', 'isconspicuous'),
+            (template_id, 2, 'Is Accessible', 'YesNoNA', TRUE, 'Critical', 'isaccessible'),
+            (template_id, 3, 'Is in Assigned Location', 'YesNoNA', TRUE, 'Critical', 'isassignedlocation'),
+            (template_id, 4, 'Is Sign Visible', 'YesNoNA', TRUE, 'Advisory', 'issignvisible'),
+            (template_id, 5, 'Is Anti-Tamper Device Intact', 'YesNoNA', TRUE, 'Critical', 'isantitamperdeviceintact'),
+            (template_id, 6, 'Is Support Bracket Secure', 'YesNoNA', TRUE, 'Critical', 'issupportbracketsecure'),
+            (template_id, 7, 'Are Operating Instructions Clear', 'YesNoNA', TRUE, 'Advisory', 'areoperatinginstructionsclear'),
+            (template_id, 8, 'Is Maintenance Tag Attached', 'YesNoNA', TRUE, 'Advisory', 'ismaintenancetagattached'),
+            (template_id, 9, 'Is No External Damage', 'YesNoNA', TRUE, 'Critical', 'isnoexternaldamage'),
+            (template_id, 10, 'Is Charge Gauge Normal', 'YesNoNA', TRUE, 'Critical', 'ischargegaugenormal'),
+            (template_id, 11, 'Are Maintenance Records Complete', 'YesNoNA', TRUE, 'Advisory', 'aremaintenancerecordscomplete'),
+            (template_id, 12, 'Is Replaced', 'YesNoNA', TRUE, 'Advisory', 'isreplaced');
+    END IF;
+
+    -- Inspections answered on the old form have at least one checklist column set.
+    -- An unchecked box was saved as false or NULL, both become "No".
+    WITH legacy AS (
+        UPDATE Emergency_Device_InspectionT
+        SET ChecklistTemplateID = template_id
+        WHERE ChecklistTemplateID IS NULL
+          AND num_nonnulls(IsConspicuous, IsAccessible, IsAssignedLocation, IsSignVisible, IsAntiTamperDeviceIntact,
+                           IsSupportBracketSecure, AreOperatingInstructionsClear, IsMaintenanceTagAttached,
+                           IsNoExternalDamage, IsChargeGaugeNormal, IsReplaced, AreMaintenanceRecordsComplete) > 0
+        RETURNING *
+    )
+    INSERT INTO Inspection_ResponseT (EmergencyDeviceInspectionID, ChecklistQuestionID, AnswerYesNo)
+    SELECT legacy.EmergencyDeviceInspectionID, q.ChecklistQuestionID,
+           CASE WHEN COALESCE((to_jsonb(legacy) ->> q.LegacyColumn)::BOOLEAN, FALSE) THEN 'Yes' ELSE 'No' END
+    FROM legacy
+    JOIN Checklist_QuestionT q ON q.ChecklistTemplateID = template_id AND q.LegacyColumn IS NOT NULL;
+
+    GET DIAGNOSTICS migrated_count = ROW_COUNT;
+    RETURN migrated_count;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- A device that passed with defects is still in service
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION update_device_status_on_inspection()
+RETURNS TRIGGER AS $$
+DECLARE
+    current_last_inspection_timestamp TIMESTAMP;
+    calculated_expire_date TIMESTAMP;
+BEGIN
+    -- Retrieve the current last inspection timestamp and manufacture date for the device
+    SELECT LastInspectionDateTime, ManufactureDate INTO current_last_inspection_timestamp, calculated_expire_date
+    FROM Emergency_DeviceT
+    WHERE EmergencyDeviceID = NEW.EmergencyDeviceID;
+
+    -- Calculate the expiration date as ManufactureDate + 5 years
+    calculated_expire_date := calculated_expire_date + INTERVAL '5 years';
+
+    -- Check if the new inspection timestamp is more recent than the current last inspection timestamp
+    IF current_last_inspection_timestamp IS NULL OR NEW.InspectionDateTime > current_last_inspection_timestamp THEN
+        -- Determine the status based on inspection and expiration conditions
+        UPDATE Emergency_DeviceT
+        SET LastInspectionDateTime = NEW.InspectionDateTime,
+            Status = CASE
+                        WHEN Status = 'Recalled' THEN Status
+                        WHEN NEW.InspectionStatus = 'Failed' THEN 'Inspection Failed'
+                        WHEN calculated_expire_date <= NOW() THEN 'Expired'
+                        WHEN NEW.InspectionStatus IN ('Passed', 'Passed with defects') THEN 'Active'
+                        ELSE Status
+                    END
+        WHERE EmergencyDeviceID = NEW.EmergencyDeviceID;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION update_device_status_on_inspection()
+RETURNS TRIGGER AS $$
+DECLARE
+    current_last_inspection_timestamp TIMESTAMP;
+    calculated_expire_date TIMESTAMP;
+BEGIN
+    -- Retrieve the current last inspection timestamp and manufacture date for the device
+    SELECT LastInspectionDateTime, ManufactureDate INTO current_last_inspection_timestamp, calculated_expire_date
+    FROM Emergency_DeviceT
+    WHERE EmergencyDeviceID = NEW.EmergencyDeviceID;
+
+    -- Calculate the expiration date as ManufactureDate + 5 years
+    calculated_expire_date := calculated_expire_date + INTERVAL '5 years';
+
+    -- Check if the new inspection timestamp is more recent than the current last inspection timestamp
+    IF current_last_inspection_timestamp IS NULL OR NEW.InspectionDateTime > current_last_inspection_timestamp THEN
+        -- Determine the status based on inspection and expiration conditions
+        UPDATE Emergency_DeviceT
+        SET LastInspectionDateTime = NEW.InspectionDateTime,
+            Status = CASE
+                        WHEN Status = 'Recalled' THEN Status
+                        WHEN NEW.InspectionStatus = 'Failed' THEN 'Inspection Failed'
+                        WHEN calculated_expire_date <= NOW() THEN 'Expired'
+                        WHEN NEW.InspectionStatus = 'Passed' THEN 'Active'
+                        ELSE Status
+                    END
+        WHERE EmergencyDeviceID = NEW.EmergencyDeviceID;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION migrate_legacy_inspections()
+RETURNS INTEGER AS $$
+DECLARE
+    extinguisher_type_id INT;
+    template_id INT;
+    migrated_count INT;
+BEGIN
+    SELECT EmergencyDeviceTypeID INTO extinguisher_type_id
+    FROM Emergency_Device_TypeT
+    WHERE EmergencyDeviceTypeName = 'Fire Extinguisher';
+
+    IF extinguisher_type_id IS NULL THEN
+        RETURN 0;
+    END IF;
+
+    SELECT ChecklistTemplateID INTO template_id
+    FROM Checklist_TemplateT
+    WHERE EmergencyDeviceTypeID = extinguisher_type_id AND Version = 1;
+
+    IF template_id IS NULL THEN
+        INSERT INTO Checklist_TemplateT (EmergencyDeviceTypeID, TemplateName, Version)
+        VALUES (extinguisher_type_id, 'Fire Extinguisher', 1)
+        RETURNING ChecklistTemplateID INTO template_id;
+
+        INSERT INTO Checklist_QuestionT (ChecklistTemplateID, SortOrder, QuestionText, AnswerType, IsRequired, LegacyColumn)
+        VALUES
+            (template_id, 1, 'Is Conspicuous', 'YesNoNA', TRUE, 'isconspicuous'),
+            (template_id, 2, 'Is Accessible', 'YesNoNA', TRUE, 'isaccessible'),
+            (template_id, 3, 'Is in Assigned Location', 'YesNoNA', TRUE, 'isassignedlocation'),
+            (template_id, 4, 'Is Sign Visible', 'YesNoNA', TRUE, 'issignvisible'),
+            (template_id, 5, 'Is Anti-Tamper Device Intact', 'YesNoNA', TRUE, 'isantitamperdeviceintact'),
+            (template_id, 6, 'Is Support Bracket Secure', 'YesNoNA', TRUE, 'issupportbracketsecure'),
+            (template_id, 7, 'Are Operating Instructions Clear', 'YesNoNA', TRUE, 'areoperatinginstructionsclear'),
+            (template_id, 8, 'Is Maintenance Tag Attached', 'YesNoNA', TRUE, 'ismaintenancetagattached'),
+            (template_id, 9, 'Is No External Damage', 'YesNoNA', TRUE, 'isnoexternaldamage'),
+            (template_id, 10, 'Is Charge Gauge Normal', 'YesNoNA', TRUE, 'ischargegaugenormal'),
+            (template_id, 11, 'Are Maintenance Records Complete', 'YesNoNA', TRUE, 'aremaintenancerecordscomplete'),
+            (template_id, 12, 'Is Replaced', 'YesNoNA', TRUE, 'isreplaced');
+    END IF;
+
+    -- Inspections answered on the old form have at least one checklist column set.
+    -- An unchecked box was saved as false or NULL, both become "No".
+    WITH legacy AS (
+        UPDATE Emergency_Device_InspectionT
+        SET ChecklistTemplateID = template_id
+        WHERE ChecklistTemplateID IS NULL
+          AND num_nonnulls(IsConspicuous, IsAccessible, IsAssignedLocation, IsSignVisible, IsAntiTamperDeviceIntact,
+                           IsSupportBracketSecure, AreOperatingInstructionsClear, IsMaintenanceTagAttached,
+                           IsNoExternalDamage, IsChargeGaugeNormal, IsReplaced, AreMaintenanceRecordsComplete) > 0
+        RETURNING *
+    )
+    INSERT INTO Inspection_ResponseT (EmergencyDeviceInspectionID, ChecklistQuestionID, AnswerYesNo)
+    SELECT legacy.EmergencyDeviceInspectionID, q.ChecklistQuestionID,
+           CASE WHEN COALESCE((to_jsonb(legacy) ->> q.LegacyColumn)::BOOLEAN, FALSE) THEN 'Yes' ELSE 'No' END
+    FROM legacy
+    JOIN Checklist_QuestionT q ON q.ChecklistTemplateID = template_id AND q.LegacyColumn IS NOT NULL;
+
+    GET DIAGNOSTICS migrated_count = ROW_COUNT;
+    RETURN migrated_count;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+ALTER TABLE Emergency_Device_InspectionT DROP CONSTRAINT IF EXISTS chk_inspection_status;
+ALTER TABLE Emergency_Device_InspectionT
+    DROP COLUMN IF EXISTS OverrideJustification,
+    DROP COLUMN IF EXISTS OverriddenBy,
+    DROP COLUMN IF EXISTS ComputedStatus;
+ALTER TABLE Checklist_QuestionT DROP COLUMN IF EXISTS Severity;
@@ -0,0 +1,150 @@
+-- +goose Up
+
+-- Inspections are never updated or deleted once recorded. A correction is saved as a new
+-- inspection that replaces the original, and voiding only records why the inspection no
+-- longer counts. Either way a revision row keeps the reason and who made the change.
+-- An inspection with a revision is no longer current; a replacement can be amended or
+-- voided again, so the revisions of an inspection form a chain.
+CREATE TABLE Inspection_RevisionT (
+    InspectionRevisionID SERIAL PRIMARY KEY,
+    EmergencyDeviceInspectionID INT NOT NULL, -- The inspection that was amended or voided
+    ReplacementInspectionID INT NULL, -- The corrected copy, only set for amendments
+    Action VARCHAR(10) NOT NULL CHECK (Action IN ('Amend', 'Void')),
+    Reason VARCHAR(500) NOT NULL,
+    RevisedBy INT NULL,
+    RevisedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (EmergencyDeviceInspectionID) REFERENCES Emergency_Device_InspectionT(EmergencyDeviceInspectionID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE,
+    FOREIGN KEY (ReplacementInspectionID) REFERENCES Emergency_Device_InspectionT(EmergencyDeviceInspectionID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE,
+    FOREIGN KEY (RevisedBy) REFERENCES UserT(UserID)
+        ON UPDATE CASCADE
+        ON DELETE SET NULL,
+    UNIQUE (EmergencyDeviceInspectionID), -- An inspection can only be amended or voided once
+    UNIQUE (ReplacementInspectionID),
+    CHECK ((Action = 'Amend') = (ReplacementInspectionID IS NOT NULL))
+);
+
+-- recompute_device_inspection_status sets the device's last inspection date and status
+-- from its latest inspection that has not been amended or voided
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION recompute_device_inspection_status(device_id INT)
+RETURNS VOID AS $$
+DECLARE
+    latest_inspection_timestamp TIMESTAMP;
+    latest_inspection_status VARCHAR(20);
+    calculated_expire_date TIMESTAMP;
+BEGIN
+    SELECT edi.InspectionDateTime, edi.InspectionStatus INTO latest_inspection_timestamp, latest_inspection_status
+    FROM Emergency_Device_InspectionT edi
+    WHERE edi.EmergencyDeviceID = device_id
+      AND NOT EXISTS (
+          SELECT 1 FROM Inspection_RevisionT r
+          WHERE r.EmergencyDeviceInspectionID = edi.EmergencyDeviceInspectionID
+      )
+    ORDER BY edi.InspectionDateTime DESC, edi.EmergencyDeviceInspectionID DESC
+    LIMIT 1;
+
+    -- Calculate the expiration date as ManufactureDate + 5 years
+    SELECT ManufactureDate + INTERVAL '5 years' INTO calculated_expire_date
+    FROM Emergency_DeviceT
+    WHERE EmergencyDeviceID = device_id;
+
+    UPDATE Emergency_DeviceT
+    SET LastInspectionDateTime = latest_inspection_timestamp,
+        Status = CASE
+                    WHEN Status = 'Recalled' THEN Status
+                    WHEN latest_inspection_status = 'Failed' THEN 'Inspection Failed'
+                    WHEN calculated_expire_date <= NOW() THEN 'Expired'
+                    WHEN latest_inspection_status IN ('Passed', 'Passed with defects') THEN 'Active'
+                    -- The failed inspection was voided and no other inspection is left
+                    WHEN latest_inspection_status IS NULL AND Status = 'Inspection Failed' THEN 'Active'
+                    ELSE Status
+                END
+    WHERE EmergencyDeviceID = device_id;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION update_device_status_on_inspection()
+RETURNS TRIGGER AS $$
+DECLARE
+    current_last_inspection_timestamp TIMESTAMP;
+BEGIN
+    SELECT LastInspectionDateTime INTO current_last_inspection_timestamp
+    FROM Emergency_DeviceT
+    WHERE EmergencyDeviceID = NEW.EmergencyDeviceID;
+
+    -- An older inspection recorded late does not change the device
+    IF current_last_inspection_timestamp IS NULL OR NEW.InspectionDateTime > current_last_inspection_timestamp THEN
+        PERFORM recompute_device_inspection_status(NEW.EmergencyDeviceID);
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION update_device_status_on_inspection_revision()
+RETURNS TRIGGER AS $$
+BEGIN
+    -- An amendment can move the inspection to another device, so recompute both
+    PERFORM recompute_device_inspection_status(edi.EmergencyDeviceID)
+    FROM Emergency_Device_InspectionT edi
+    WHERE edi.EmergencyDeviceInspectionID IN (NEW.EmergencyDeviceInspectionID, NEW.ReplacementInspectionID);
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER trg_update_device_status_on_revision
+AFTER INSERT ON Inspection_RevisionT
+FOR EACH ROW
+EXECUTE FUNCTION update_device_status_on_inspection_revision();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS trg_update_device_status_on_revision ON Inspection_RevisionT;
+DROP FUNCTION IF EXISTS update_device_status_on_inspection_revision();
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION update_device_status_on_inspection()
+RETURNS TRIGGER AS $$
+DECLARE
+    current_last_inspection_timestamp TIMESTAMP;
+    calculated_expire_date TIMESTAMP;
+BEGIN
+    -- Retrieve the current last inspection timestamp and manufacture date for the device
+    SELECT LastInspectionDateTime, ManufactureDate INTO current_last_inspection_timestamp, calculated_expire_date
+    FROM Emergency_DeviceT
+    WHERE EmergencyDeviceID = NEW.EmergencyDeviceID;
+
+    -- Calculate the expiration date as ManufactureDate + 5 years
+    calculated_expire_date := calculated_expire_date + INTERVAL '5 years';
+
+    -- Check if the new inspection timestamp is more recent than the current last inspection timestamp
+    IF current_last_inspection_timestamp IS NULL OR NEW.InspectionDateTime > current_last_inspection_timestamp THEN
+        -- Determine the status based on inspection and expiration conditions
+        UPDATE Emergency_DeviceT
+        SET LastInspectionDateTime = NEW.InspectionDateTime,
+            Status = CASE
+                        WHEN Status = 'Recalled' THEN Status
+                        WHEN NEW.InspectionStatus = 'Failed' THEN 'Inspection Failed'
+                        WHEN calculated_expire_date <= NOW() THEN 'Expired'
+                        WHEN NEW.InspectionStatus IN ('Passed', 'Passed with defects') THEN 'Active'
+                        ELSE Status
+                    END
+        WHERE EmergencyDeviceID = NEW.EmergencyDeviceID;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+DROP FUNCTION IF EXISTS recompute_device_inspection_status(INT);
+DROP TABLE IF EXISTS Inspection_RevisionT;
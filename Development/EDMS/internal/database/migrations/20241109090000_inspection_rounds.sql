@@ -0,0 +1,59 @@
+-- +goose Up
+
+-- An inspection round is the list of devices due for inspection in a site or building,
+-- generated by a supervisor and assigned to an inspector with a due date. Items are
+-- ordered by building and room so the inspector can walk the round in order.
+CREATE TABLE Inspection_RoundT (
+    InspectionRoundID SERIAL PRIMARY KEY,
+    RoundName VARCHAR(100) NOT NULL,
+    SiteID INT NOT NULL,
+    BuildingID INT NULL, -- NULL when the round covers the whole site
+    AssignedTo INT NULL,
+    DueDate DATE NOT NULL,
+    Status VARCHAR(20) NOT NULL DEFAULT 'Assigned' CHECK (Status IN ('Assigned', 'In Progress', 'Completed', 'Cancelled')),
+    CreatedBy INT NULL,
+    CreatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CompletedAt TIMESTAMP NULL,
+    FOREIGN KEY (SiteID) REFERENCES SiteT(SiteID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE,
+    FOREIGN KEY (BuildingID) REFERENCES BuildingT(BuildingID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE,
+    FOREIGN KEY (AssignedTo) REFERENCES UserT(UserID)
+        ON UPDATE CASCADE
+        ON DELETE SET NULL,
+    FOREIGN KEY (CreatedBy) REFERENCES UserT(UserID)
+        ON UPDATE CASCADE
+        ON DELETE SET NULL
+);
+
+CREATE TABLE Inspection_Round_ItemT (
+    InspectionRoundItemID SERIAL PRIMARY KEY,
+    InspectionRoundID INT NOT NULL,
+    EmergencyDeviceID INT NOT NULL,
+    SortOrder INT NOT NULL,
+    Status VARCHAR(20) NOT NULL DEFAULT 'Pending' CHECK (Status IN ('Pending', 'Inspected', 'Skipped')),
+    SkipReason VARCHAR(30) NULL CHECK (SkipReason IN ('Locked Room', 'Device Missing', 'Access Blocked', 'Other')),
+    SkipNotes VARCHAR(255) NULL,
+    EmergencyDeviceInspectionID INT NULL, -- The inspection that completed the item
+    UpdatedAt TIMESTAMP NULL,
+    FOREIGN KEY (InspectionRoundID) REFERENCES Inspection_RoundT(InspectionRoundID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE,
+    FOREIGN KEY (EmergencyDeviceID) REFERENCES Emergency_DeviceT(EmergencyDeviceID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE,
+    FOREIGN KEY (EmergencyDeviceInspectionID) REFERENCES Emergency_Device_InspectionT(EmergencyDeviceInspectionID)
+        ON UPDATE CASCADE
+        ON DELETE SET NULL,
+    UNIQUE (InspectionRoundID, EmergencyDeviceID),
+    CHECK ((Status = 'Skipped') = (SkipReason IS NOT NULL))
+);
+
+CREATE INDEX idx_inspection_round_assigned_to ON Inspection_RoundT(AssignedTo);
+CREATE INDEX idx_inspection_round_item_device ON Inspection_Round_ItemT(EmergencyDeviceID);
+
+-- +goose Down
+DROP TABLE IF EXISTS Inspection_Round_ItemT;
+DROP TABLE IF EXISTS Inspection_RoundT;
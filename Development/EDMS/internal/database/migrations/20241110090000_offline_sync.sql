@@ -0,0 +1,40 @@
+-- +goose Up
+
+-- Inspections recorded offline carry the UUID the client generated for them, so an
+-- upload that is retried after a dropped connection is only recorded once
+ALTER TABLE Emergency_Device_InspectionT ADD COLUMN ClientUUID UUID NULL UNIQUE;
+
+-- Devices record when they were last edited, so inspections recorded against an
+-- older offline snapshot can be reported as conflicts
+ALTER TABLE Emergency_DeviceT ADD COLUMN UpdatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+-- Inspections update the last inspection date and status of the device, those changes
+-- are not edits of the device itself
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION set_emergency_device_updated_at()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF ROW(NEW.EmergencyDeviceTypeID, NEW.RoomID, NEW.ExtinguisherTypeID, NEW.ManufactureDate, NEW.SerialNumber,
+           NEW.Description, NEW.Size, NEW.DeviceModelID, NEW.BatchNumber)
+       IS DISTINCT FROM
+       ROW(OLD.EmergencyDeviceTypeID, OLD.RoomID, OLD.ExtinguisherTypeID, OLD.ManufactureDate, OLD.SerialNumber,
+           OLD.Description, OLD.Size, OLD.DeviceModelID, OLD.BatchNumber)
+       OR (NEW.Status IS DISTINCT FROM OLD.Status AND 'Inactive' IN (NEW.Status, OLD.Status)) THEN
+        NEW.UpdatedAt = CURRENT_TIMESTAMP;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER trg_set_emergency_device_updated_at
+BEFORE UPDATE ON Emergency_DeviceT
+FOR EACH ROW
+EXECUTE FUNCTION set_emergency_device_updated_at();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS trg_set_emergency_device_updated_at ON Emergency_DeviceT;
+DROP FUNCTION IF EXISTS set_emergency_device_updated_at();
+ALTER TABLE Emergency_DeviceT DROP COLUMN IF EXISTS UpdatedAt;
+ALTER TABLE Emergency_Device_InspectionT DROP COLUMN IF EXISTS ClientUUID;
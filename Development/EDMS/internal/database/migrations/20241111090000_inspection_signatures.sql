@@ -0,0 +1,32 @@
+-- +goose Up
+
+-- Inspections are signed by the inspector, either with a drawn signature or by typing
+-- their name under an attestation, and sealed with a keyed hash of their content so
+-- any later change to the stored inspection can be detected.
+-- Inspections recorded before this have no signature or hash.
+ALTER TABLE Emergency_Device_InspectionT
+    ADD COLUMN SignatureType VARCHAR(10) NULL CHECK (SignatureType IN ('Drawn', 'Typed')),
+    ADD COLUMN SignedName VARCHAR(100) NULL,
+    ADD COLUMN AttestationText VARCHAR(500) NULL,
+    ADD COLUMN SignatureKey VARCHAR(255) NULL,  -- Storage key of a drawn signature image
+    ADD COLUMN SignatureSHA256 CHAR(64) NULL,   -- Hash of the drawn signature image
+    ADD COLUMN SignedAt TIMESTAMPTZ NULL,
+    ADD COLUMN ContentHash CHAR(64) NULL,
+    ADD COLUMN HashVersion SMALLINT NULL,
+    ADD CHECK ((SignatureType IS NULL) = (SignedAt IS NULL)),
+    ADD CHECK ((SignatureType = 'Drawn') = (SignatureKey IS NOT NULL));
+
+-- Photo answers are part of the sealed content, so attachments record a hash of the file
+ALTER TABLE AttachmentT ADD COLUMN SHA256 CHAR(64) NULL;
+
+-- +goose Down
+ALTER TABLE AttachmentT DROP COLUMN IF EXISTS SHA256;
+ALTER TABLE Emergency_Device_InspectionT
+    DROP COLUMN IF EXISTS SignatureType,
+    DROP COLUMN IF EXISTS SignedName,
+    DROP COLUMN IF EXISTS AttestationText,
+    DROP COLUMN IF EXISTS SignatureKey,
+    DROP COLUMN IF EXISTS SignatureSHA256,
+    DROP COLUMN IF EXISTS SignedAt,
+    DROP COLUMN IF EXISTS ContentHash,
+    DROP COLUMN IF EXISTS HashVersion;
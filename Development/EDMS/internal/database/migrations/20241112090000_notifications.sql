@@ -0,0 +1,37 @@
+-- +goose Up
+
+-- A notification is raised for a device while it is due, overdue, expiring, expired,
+-- failed or recalled. Only the most urgent condition of a device is open at a time and a
+-- notification is resolved, not deleted, once its condition no longer applies.
+CREATE TABLE NotificationT (
+    NotificationID SERIAL PRIMARY KEY,
+    EmergencyDeviceID INT NOT NULL,
+    NotificationType VARCHAR(30) NOT NULL CHECK (NotificationType IN ('Recalled', 'Inspection Failed', 'Expired', 'Inspection Overdue', 'Expiring Soon', 'Inspection Due')),
+    ReferenceDate DATE NULL, -- The due or expiry date the notification is about
+    CreatedAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ResolvedAt TIMESTAMPTZ NULL,
+    FOREIGN KEY (EmergencyDeviceID) REFERENCES Emergency_DeviceT(EmergencyDeviceID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+);
+
+-- Each user reads and dismisses notifications separately
+CREATE TABLE Notification_User_StateT (
+    NotificationID INT NOT NULL,
+    UserID INT NOT NULL,
+    ReadAt TIMESTAMPTZ NULL,
+    DismissedAt TIMESTAMPTZ NULL,
+    PRIMARY KEY (NotificationID, UserID),
+    FOREIGN KEY (NotificationID) REFERENCES NotificationT(NotificationID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE,
+    FOREIGN KEY (UserID) REFERENCES UserT(UserID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX idx_notification_open_device ON NotificationT(EmergencyDeviceID) WHERE ResolvedAt IS NULL;
+
+-- +goose Down
+DROP TABLE IF EXISTS Notification_User_StateT;
+DROP TABLE IF EXISTS NotificationT;
@@ -0,0 +1,26 @@
+-- +goose Up
+
+-- History of background job runs, shared by every replica. A job is only started again
+-- once its interval has passed since the last run started.
+CREATE TABLE Job_RunT (
+    JobRunID SERIAL PRIMARY KEY,
+    JobName VARCHAR(50) NOT NULL,
+    Instance VARCHAR(100) NOT NULL, -- The replica that ran the job
+    StartedAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FinishedAt TIMESTAMPTZ NULL,
+    Status VARCHAR(20) NOT NULL DEFAULT 'Running' CHECK (Status IN ('Running', 'Succeeded', 'Failed')),
+    Error TEXT NULL
+);
+
+CREATE INDEX idx_job_run_name_started ON Job_RunT(JobName, StartedAt DESC);
+
+-- Login tokens revoked by logging out before they expired. Rows are purged once the
+-- token has expired anyway.
+CREATE TABLE Revoked_TokenT (
+    TokenID VARCHAR(64) PRIMARY KEY,
+    ExpiresAt TIMESTAMPTZ NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS Revoked_TokenT;
+DROP TABLE IF EXISTS Job_RunT;
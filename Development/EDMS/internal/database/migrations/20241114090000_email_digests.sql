@@ -0,0 +1,21 @@
+-- +goose Up
+
+-- Email digest of devices needing attention, one subscription per user. The digest
+-- covers every site unless limited to a site or a building.
+CREATE TABLE Digest_SubscriptionT (
+    UserID INT PRIMARY KEY,
+    Frequency VARCHAR(10) NOT NULL CHECK (Frequency IN ('Daily', 'Weekly')),
+    SiteID INT NULL,
+    BuildingID INT NULL,
+    LastSentAt TIMESTAMPTZ NULL,
+    CreatedAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (UserID) REFERENCES UserT(UserID)
+        ON DELETE CASCADE,
+    FOREIGN KEY (SiteID) REFERENCES SiteT(SiteID)
+        ON DELETE CASCADE, -- A digest for a removed site is no longer wanted
+    FOREIGN KEY (BuildingID) REFERENCES BuildingT(BuildingID)
+        ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS Digest_SubscriptionT;
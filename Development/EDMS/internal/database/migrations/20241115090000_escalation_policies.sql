@@ -0,0 +1,93 @@
+-- +goose Up
+
+-- Users looking after a site. Inspectors are told first when a device needs attention,
+-- then managers if it is not dealt with.
+CREATE TABLE Site_MemberT (
+    SiteID INT NOT NULL,
+    UserID INT NOT NULL,
+    SiteRole VARCHAR(20) NOT NULL CHECK (SiteRole IN ('Inspector', 'Manager')),
+    PRIMARY KEY (SiteID, UserID),
+    FOREIGN KEY (SiteID) REFERENCES SiteT(SiteID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE,
+    FOREIGN KEY (UserID) REFERENCES UserT(UserID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+);
+
+-- An escalation policy applies to a site and device type. A policy without a site or
+-- device type applies to every site or type, the most specific policy is used.
+CREATE TABLE Escalation_PolicyT (
+    EscalationPolicyID SERIAL PRIMARY KEY,
+    PolicyName VARCHAR(100) NOT NULL,
+    SiteID INT NULL,
+    EmergencyDeviceTypeID INT NULL,
+    FOREIGN KEY (SiteID) REFERENCES SiteT(SiteID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE,
+    FOREIGN KEY (EmergencyDeviceTypeID) REFERENCES Emergency_Device_TypeT(EmergencyDeviceTypeID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX idx_escalation_policy_scope ON Escalation_PolicyT(COALESCE(SiteID, 0), COALESCE(EmergencyDeviceTypeID, 0));
+
+-- A step notifies recipients once a device has been overdue, or failed, for DaysAfter days
+CREATE TABLE Escalation_StepT (
+    EscalationStepID SERIAL PRIMARY KEY,
+    EscalationPolicyID INT NOT NULL,
+    NotificationType VARCHAR(30) NOT NULL CHECK (NotificationType IN ('Inspection Overdue', 'Inspection Failed')),
+    DaysAfter INT NOT NULL CHECK (DaysAfter >= 0),
+    Recipient VARCHAR(20) NOT NULL CHECK (Recipient IN ('Site Inspectors', 'Site Managers', 'Admins')),
+    FOREIGN KEY (EscalationPolicyID) REFERENCES Escalation_PolicyT(EscalationPolicyID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+);
+
+-- Each step taken for a device. A step is taken once per notification, so a device that
+-- becomes overdue again is escalated again. Steps are matched on their days and
+-- recipient, so editing a policy does not repeat steps already taken.
+CREATE TABLE Device_EscalationT (
+    DeviceEscalationID SERIAL PRIMARY KEY,
+    EmergencyDeviceID INT NOT NULL,
+    NotificationID INT NOT NULL,
+    EscalationStepID INT NULL, -- Kept after the policy is changed
+    NotificationType VARCHAR(30) NOT NULL,
+    DaysAfter INT NOT NULL,
+    Recipient VARCHAR(20) NOT NULL,
+    SentTo TEXT NOT NULL, -- Email addresses notified, empty if nobody holds the role
+    EscalatedAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (EmergencyDeviceID) REFERENCES Emergency_DeviceT(EmergencyDeviceID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE,
+    FOREIGN KEY (NotificationID) REFERENCES NotificationT(NotificationID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE,
+    FOREIGN KEY (EscalationStepID) REFERENCES Escalation_StepT(EscalationStepID)
+        ON UPDATE CASCADE
+        ON DELETE SET NULL,
+    UNIQUE (NotificationID, DaysAfter, Recipient)
+);
+
+CREATE INDEX idx_device_escalation_device ON Device_EscalationT(EmergencyDeviceID, EscalatedAt DESC);
+
+-- Default policy for every site and device type
+INSERT INTO Escalation_PolicyT (PolicyName) VALUES ('Default');
+INSERT INTO Escalation_StepT (EscalationPolicyID, NotificationType, DaysAfter, Recipient)
+SELECT EscalationPolicyID, step.NotificationType, step.DaysAfter, step.Recipient
+FROM Escalation_PolicyT
+CROSS JOIN (VALUES
+    ('Inspection Overdue', 0, 'Site Inspectors'),
+    ('Inspection Overdue', 7, 'Site Managers'),
+    ('Inspection Overdue', 30, 'Admins'),
+    ('Inspection Failed', 0, 'Site Inspectors'),
+    ('Inspection Failed', 7, 'Site Managers'),
+    ('Inspection Failed', 30, 'Admins')
+) AS step(NotificationType, DaysAfter, Recipient)
+WHERE PolicyName = 'Default';
+
+-- +goose Down
+DROP TABLE IF EXISTS Device_EscalationT;
+DROP TABLE IF EXISTS Escalation_StepT;
+DROP TABLE IF EXISTS Escalation_PolicyT;
+DROP TABLE IF EXISTS Site_MemberT;
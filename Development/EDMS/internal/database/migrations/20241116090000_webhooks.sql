@@ -0,0 +1,160 @@
+-- +goose Up
+
+-- Endpoints of other systems told about changes to EDMS data
+CREATE TABLE Webhook_EndpointT (
+    WebhookEndpointID SERIAL PRIMARY KEY,
+    Description VARCHAR(100) NOT NULL,
+    URL VARCHAR(2048) NOT NULL,
+    Secret VARCHAR(64) NOT NULL, -- Key of the HMAC signature of each payload
+    Events TEXT[] NOT NULL,
+    Active BOOLEAN NOT NULL DEFAULT TRUE,
+    CreatedAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Events waiting to be handed to the endpoints subscribed to them. Events are recorded
+-- by triggers so every change is caught, whichever code made it.
+CREATE TABLE Webhook_EventT (
+    WebhookEventID BIGSERIAL PRIMARY KEY,
+    EventType VARCHAR(50) NOT NULL,
+    Payload JSONB NOT NULL,
+    CreatedAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    DispatchedAt TIMESTAMPTZ NULL
+);
+
+CREATE INDEX idx_webhook_event_undispatched ON Webhook_EventT(WebhookEventID) WHERE DispatchedAt IS NULL;
+
+-- An event sent to an endpoint. Failed deliveries are retried with exponential backoff
+-- until they run out of attempts and are dead-lettered.
+CREATE TABLE Webhook_DeliveryT (
+    WebhookDeliveryID SERIAL PRIMARY KEY,
+    WebhookEndpointID INT NOT NULL,
+    WebhookEventID BIGINT NULL, -- NULL for pings
+    EventType VARCHAR(50) NOT NULL,
+    Payload JSONB NOT NULL,
+    Status VARCHAR(20) NOT NULL DEFAULT 'Pending' CHECK (Status IN ('Pending', 'Succeeded', 'Dead')),
+    Attempts INT NOT NULL DEFAULT 0,
+    NextAttemptAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CreatedAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    DeliveredAt TIMESTAMPTZ NULL,
+    FOREIGN KEY (WebhookEndpointID) REFERENCES Webhook_EndpointT(WebhookEndpointID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE,
+    FOREIGN KEY (WebhookEventID) REFERENCES Webhook_EventT(WebhookEventID)
+        ON UPDATE CASCADE
+        ON DELETE SET NULL
+);
+
+CREATE INDEX idx_webhook_delivery_due ON Webhook_DeliveryT(NextAttemptAt) WHERE Status = 'Pending';
+CREATE INDEX idx_webhook_delivery_endpoint ON Webhook_DeliveryT(WebhookEndpointID, CreatedAt DESC);
+
+-- Each attempt to deliver, with the endpoint's response
+CREATE TABLE Webhook_Delivery_AttemptT (
+    WebhookDeliveryAttemptID SERIAL PRIMARY KEY,
+    WebhookDeliveryID INT NOT NULL,
+    AttemptedAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ResponseStatus INT NULL, -- NULL if no response was received
+    ResponseBody VARCHAR(1024) NULL,
+    Error TEXT NULL,
+    DurationMS INT NOT NULL,
+    FOREIGN KEY (WebhookDeliveryID) REFERENCES Webhook_DeliveryT(WebhookDeliveryID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+);
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION webhook_device_payload(device_id INT)
+RETURNS JSONB AS $$
+    SELECT jsonb_build_object(
+        'emergency_device_id', ed.EmergencyDeviceID,
+        'emergency_device_type_name', edt.EmergencyDeviceTypeName,
+        'serial_number', ed.SerialNumber,
+        'status', ed.Status,
+        'room_code', r.RoomCode,
+        'building_code', b.BuildingCode,
+        'site_id', s.SiteID,
+        'site_name', s.SiteName
+    )
+    FROM Emergency_DeviceT ed
+    JOIN Emergency_Device_TypeT edt ON ed.EmergencyDeviceTypeID = edt.EmergencyDeviceTypeID
+    JOIN RoomT r ON ed.RoomID = r.RoomID
+    JOIN BuildingT b ON r.BuildingID = b.BuildingID
+    JOIN SiteT s ON b.SiteID = s.SiteID
+    WHERE ed.EmergencyDeviceID = device_id;
+$$ LANGUAGE sql STABLE;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION record_device_webhook_event()
+RETURNS TRIGGER AS $$
+DECLARE
+    device JSONB;
+BEGIN
+    device := webhook_device_payload(NEW.EmergencyDeviceID);
+
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO Webhook_EventT (EventType, Payload)
+        VALUES ('device.created', jsonb_build_object('device', device));
+    ELSIF NEW.Status IS DISTINCT FROM OLD.Status THEN
+        INSERT INTO Webhook_EventT (EventType, Payload)
+        VALUES ('device.status_changed', jsonb_build_object('device', device, 'previous_status', OLD.Status));
+
+        IF NEW.Status = 'Expired' THEN
+            INSERT INTO Webhook_EventT (EventType, Payload)
+            VALUES ('device.expired', jsonb_build_object('device', device));
+        END IF;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- Named to run after trg_update_device_status, so the device's new status is included
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION record_inspection_webhook_event()
+RETURNS TRIGGER AS $$
+DECLARE
+    payload JSONB;
+BEGIN
+    payload := jsonb_build_object(
+        'inspection', jsonb_build_object(
+            'emergency_device_inspection_id', NEW.EmergencyDeviceInspectionID,
+            'inspection_datetime', NEW.InspectionDateTime AT TIME ZONE 'Pacific/Auckland',
+            'inspection_status', NEW.InspectionStatus,
+            'work_order_required', NEW.WorkOrderRequired,
+            'user_id', NEW.UserID,
+            'notes', NEW.Notes
+        ),
+        'device', webhook_device_payload(NEW.EmergencyDeviceID)
+    );
+
+    INSERT INTO Webhook_EventT (EventType, Payload) VALUES ('inspection.created', payload);
+    IF NEW.InspectionStatus = 'Failed' THEN
+        INSERT INTO Webhook_EventT (EventType, Payload) VALUES ('inspection.failed', payload);
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER trg_webhook_device_event
+AFTER INSERT OR UPDATE OF Status ON Emergency_DeviceT
+FOR EACH ROW
+EXECUTE FUNCTION record_device_webhook_event();
+
+CREATE TRIGGER trg_webhook_inspection_event
+AFTER INSERT ON Emergency_Device_InspectionT
+FOR EACH ROW
+EXECUTE FUNCTION record_inspection_webhook_event();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS trg_webhook_inspection_event ON Emergency_Device_InspectionT;
+DROP TRIGGER IF EXISTS trg_webhook_device_event ON Emergency_DeviceT;
+DROP FUNCTION IF EXISTS record_inspection_webhook_event();
+DROP FUNCTION IF EXISTS record_device_webhook_event();
+DROP FUNCTION IF EXISTS webhook_device_payload(INT);
+DROP TABLE IF EXISTS Webhook_Delivery_AttemptT;
+DROP TABLE IF EXISTS Webhook_DeliveryT;
+DROP TABLE IF EXISTS Webhook_EventT;
+DROP TABLE IF EXISTS Webhook_EndpointT;
@@ -0,0 +1,105 @@
+-- +goose Up
+-- Changes are announced on the edms_events channel so every app instance can push them
+-- to the dashboards streaming /api/events. Payloads are kept small, clients fetch the
+-- details they need.
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION notify_edms_event(event_type TEXT, data JSONB, user_id INT DEFAULT NULL)
+RETURNS VOID AS $$
+BEGIN
+    PERFORM pg_notify('edms_events', jsonb_build_object(
+        'type', event_type,
+        'user_id', user_id,
+        'data', data
+    )::TEXT);
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION notify_device_status_event()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' OR NEW.Status IS DISTINCT FROM OLD.Status THEN
+        PERFORM notify_edms_event('device.status_changed', jsonb_build_object(
+            'emergency_device_id', NEW.EmergencyDeviceID,
+            'room_id', NEW.RoomID,
+            'status', NEW.Status,
+            'previous_status', CASE WHEN TG_OP = 'UPDATE' THEN OLD.Status END
+        ));
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION notify_inspection_event()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM notify_edms_event('inspection.created', jsonb_build_object(
+        'emergency_device_inspection_id', NEW.EmergencyDeviceInspectionID,
+        'emergency_device_id', NEW.EmergencyDeviceID,
+        'inspection_status', NEW.InspectionStatus,
+        'user_id', NEW.UserID
+    ));
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- Notifications change for everyone, read and dismissed state only for one user.
+-- Identical notifications in a transaction are delivered once, so a notification run
+-- announces a single change.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION notify_notifications_event()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM notify_edms_event('notifications.changed', '{}'::JSONB);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION notify_notification_state_event()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM notify_edms_event('notifications.changed', '{}'::JSONB, NEW.UserID);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER trg_notify_device_status
+AFTER INSERT OR UPDATE OF Status ON Emergency_DeviceT
+FOR EACH ROW
+EXECUTE FUNCTION notify_device_status_event();
+
+CREATE TRIGGER trg_notify_inspection
+AFTER INSERT ON Emergency_Device_InspectionT
+FOR EACH ROW
+EXECUTE FUNCTION notify_inspection_event();
+
+CREATE TRIGGER trg_notify_notifications
+AFTER INSERT OR UPDATE OR DELETE ON NotificationT
+FOR EACH STATEMENT
+EXECUTE FUNCTION notify_notifications_event();
+
+CREATE TRIGGER trg_notify_notification_state
+AFTER INSERT OR UPDATE ON Notification_User_StateT
+FOR EACH ROW
+EXECUTE FUNCTION notify_notification_state_event();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS trg_notify_notification_state ON Notification_User_StateT;
+DROP TRIGGER IF EXISTS trg_notify_notifications ON NotificationT;
+DROP TRIGGER IF EXISTS trg_notify_inspection ON Emergency_Device_InspectionT;
+DROP TRIGGER IF EXISTS trg_notify_device_status ON Emergency_DeviceT;
+DROP FUNCTION IF EXISTS notify_notification_state_event();
+DROP FUNCTION IF EXISTS notify_notifications_event();
+DROP FUNCTION IF EXISTS notify_inspection_event();
+DROP FUNCTION IF EXISTS notify_device_status_event();
+DROP FUNCTION IF EXISTS notify_edms_event(TEXT, JSONB, INT);
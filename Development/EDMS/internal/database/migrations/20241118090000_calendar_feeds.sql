@@ -0,0 +1,29 @@
+-- +goose Up
+
+-- Sites a user follows, their calendar feed covers devices at these sites
+CREATE TABLE Site_FollowT (
+    UserID INT NOT NULL,
+    SiteID INT NOT NULL,
+    CreatedAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (UserID, SiteID),
+    FOREIGN KEY (UserID) REFERENCES UserT(UserID)
+        ON DELETE CASCADE,
+    FOREIGN KEY (SiteID) REFERENCES SiteT(SiteID)
+        ON DELETE CASCADE
+);
+
+-- Calendar feed of a user's upcoming inspections and expiries. Calendar apps fetch the
+-- feed without logging in, so the token in its URL is the only protection; resetting
+-- it stops the old URL working.
+CREATE TABLE Calendar_FeedT (
+    UserID INT PRIMARY KEY,
+    Token VARCHAR(64) NOT NULL UNIQUE,
+    CreatedAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    LastFetchedAt TIMESTAMPTZ NULL,
+    FOREIGN KEY (UserID) REFERENCES UserT(UserID)
+        ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS Calendar_FeedT;
+DROP TABLE IF EXISTS Site_FollowT;
@@ -0,0 +1,18 @@
+-- +goose Up
+
+-- Where a building is drawn on its site's map, in pixels of the site map image from
+-- its top left corner. MapPolygon optionally outlines the building as a JSON array of
+-- [x, y] points in the same space, otherwise a marker is drawn at MapX, MapY.
+ALTER TABLE BuildingT
+    ADD COLUMN MapX DOUBLE PRECISION NULL,
+    ADD COLUMN MapY DOUBLE PRECISION NULL,
+    ADD COLUMN MapPolygon JSONB NULL,
+    ADD CONSTRAINT chk_building_map_position
+        CHECK ((MapX IS NULL) = (MapY IS NULL) AND (MapX IS NULL OR (MapX >= 0 AND MapY >= 0)));
+
+-- +goose Down
+ALTER TABLE BuildingT
+    DROP CONSTRAINT IF EXISTS chk_building_map_position,
+    DROP COLUMN IF EXISTS MapPolygon,
+    DROP COLUMN IF EXISTS MapY,
+    DROP COLUMN IF EXISTS MapX;
@@ -0,0 +1,43 @@
+-- +goose Up
+
+-- Floors of a building, listed by FloorOrder from the lowest. FloorPlanImagePath holds
+-- the URL the floor plan is served from, like SiteT.SiteMapImagePath.
+CREATE TABLE FloorT (
+    FloorID SERIAL PRIMARY KEY,
+    BuildingID INT NOT NULL,
+    FloorName VARCHAR(100) NOT NULL,
+    FloorOrder INT NOT NULL DEFAULT 0,
+    FloorPlanImagePath VARCHAR(255) NULL,
+    FOREIGN KEY (BuildingID) REFERENCES BuildingT(BuildingID)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT, -- Prevent deletion of a Building if it has Floors
+    UNIQUE (BuildingID, FloorName),
+    -- Lets RoomT check a room's floor is in the room's building
+    UNIQUE (FloorID, BuildingID)
+);
+
+-- Every building gets a default floor and the rooms it already has are put on it
+INSERT INTO FloorT (BuildingID, FloorName, FloorOrder)
+SELECT BuildingID, 'Ground', 0 FROM BuildingT;
+
+ALTER TABLE RoomT ADD COLUMN FloorID INT NULL;
+
+UPDATE RoomT r
+SET FloorID = f.FloorID
+FROM FloorT f
+WHERE f.BuildingID = r.BuildingID;
+
+ALTER TABLE RoomT
+    ALTER COLUMN FloorID SET NOT NULL,
+    ADD CONSTRAINT fk_room_floor FOREIGN KEY (FloorID, BuildingID)
+        REFERENCES FloorT(FloorID, BuildingID)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT; -- Prevent deletion of a Floor if it has Rooms
+
+CREATE INDEX idx_room_floor ON RoomT(FloorID);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_room_floor;
+ALTER TABLE RoomT DROP CONSTRAINT IF EXISTS fk_room_floor;
+ALTER TABLE RoomT DROP COLUMN IF EXISTS FloorID;
+DROP TABLE IF EXISTS FloorT;
@@ -0,0 +1,23 @@
+-- +goose Up
+
+-- A building can have a floor plan of its own, used for floors without one
+ALTER TABLE BuildingT
+    ADD COLUMN FloorPlanImagePath VARCHAR(255) NULL;
+
+-- Where a device is pinned on its floor plan, in pixels of the plan image from its top
+-- left corner. The plan is the device's floor plan, or its building's plan when the
+-- floor has none.
+ALTER TABLE Emergency_DeviceT
+    ADD COLUMN PinX DOUBLE PRECISION NULL,
+    ADD COLUMN PinY DOUBLE PRECISION NULL,
+    ADD CONSTRAINT chk_device_pin
+        CHECK ((PinX IS NULL) = (PinY IS NULL) AND (PinX IS NULL OR (PinX >= 0 AND PinY >= 0)));
+
+-- +goose Down
+ALTER TABLE Emergency_DeviceT
+    DROP CONSTRAINT IF EXISTS chk_device_pin,
+    DROP COLUMN IF EXISTS PinY,
+    DROP COLUMN IF EXISTS PinX;
+
+ALTER TABLE BuildingT
+    DROP COLUMN IF EXISTS FloorPlanImagePath;
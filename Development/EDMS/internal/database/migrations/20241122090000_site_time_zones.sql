@@ -0,0 +1,300 @@
+-- +goose Up
+
+-- Each site has its own time zone, an IANA name such as Pacific/Auckland, that its
+-- inspection times are entered and shown in. Every site so far is in New Zealand, new
+-- sites are given their zone when they are added.
+ALTER TABLE SiteT
+    ADD COLUMN TimeZone VARCHAR(64) NOT NULL DEFAULT 'Pacific/Auckland';
+ALTER TABLE SiteT
+    ALTER COLUMN TimeZone DROP DEFAULT;
+
+-- Inspection times were saved as the wall clock time at the site, which has been New
+-- Zealand time at every site. The other times were set from the database clock, so they
+-- are read in the server's time zone, the default conversion.
+ALTER TABLE Emergency_Device_InspectionT
+    ALTER COLUMN InspectionDateTime TYPE TIMESTAMPTZ USING InspectionDateTime AT TIME ZONE 'Pacific/Auckland',
+    ALTER COLUMN CreatedAt TYPE TIMESTAMPTZ;
+
+ALTER TABLE Emergency_DeviceT
+    ALTER COLUMN LastInspectionDateTime TYPE TIMESTAMPTZ USING LastInspectionDateTime AT TIME ZONE 'Pacific/Auckland',
+    ALTER COLUMN UpdatedAt TYPE TIMESTAMPTZ;
+
+ALTER TABLE RecallT
+    ALTER COLUMN CreatedAt TYPE TIMESTAMPTZ;
+
+ALTER TABLE Device_RecallT
+    ALTER COLUMN FlaggedAt TYPE TIMESTAMPTZ,
+    ALTER COLUMN ResolvedAt TYPE TIMESTAMPTZ;
+
+ALTER TABLE AttachmentT
+    ALTER COLUMN UploadedAt TYPE TIMESTAMPTZ;
+
+ALTER TABLE Checklist_TemplateT
+    ALTER COLUMN CreatedAt TYPE TIMESTAMPTZ;
+
+ALTER TABLE Inspection_RevisionT
+    ALTER COLUMN RevisedAt TYPE TIMESTAMPTZ;
+
+ALTER TABLE Inspection_RoundT
+    ALTER COLUMN CreatedAt TYPE TIMESTAMPTZ,
+    ALTER COLUMN CompletedAt TYPE TIMESTAMPTZ;
+
+ALTER TABLE Inspection_Round_ItemT
+    ALTER COLUMN UpdatedAt TYPE TIMESTAMPTZ;
+
+-- The latest inspection time is kept with its offset while the device is updated
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION recompute_device_inspection_status(device_id INT)
+RETURNS VOID AS $$
+DECLARE
+    latest_inspection_timestamp TIMESTAMPTZ;
+    latest_inspection_status VARCHAR(20);
+    calculated_expire_date TIMESTAMP;
+BEGIN
+    SELECT edi.InspectionDateTime, edi.InspectionStatus INTO latest_inspection_timestamp, latest_inspection_status
+    FROM Emergency_Device_InspectionT edi
+    WHERE edi.EmergencyDeviceID = device_id
+      AND NOT EXISTS (
+          SELECT 1 FROM Inspection_RevisionT r
+          WHERE r.EmergencyDeviceInspectionID = edi.EmergencyDeviceInspectionID
+      )
+    ORDER BY edi.InspectionDateTime DESC, edi.EmergencyDeviceInspectionID DESC
+    LIMIT 1;
+
+    -- Calculate the expiration date as ManufactureDate + 5 years
+    SELECT ManufactureDate + INTERVAL '5 years' INTO calculated_expire_date
+    FROM Emergency_DeviceT
+    WHERE EmergencyDeviceID = device_id;
+
+    UPDATE Emergency_DeviceT
+    SET LastInspectionDateTime = latest_inspection_timestamp,
+        Status = CASE
+                    WHEN Status = 'Recalled' THEN Status
+                    WHEN latest_inspection_status = 'Failed' THEN 'Inspection Failed'
+                    WHEN calculated_expire_date <= NOW() THEN 'Expired'
+                    WHEN latest_inspection_status IN ('Passed', 'Passed with defects') THEN 'Active'
+                    -- The failed inspection was voided and no other inspection is left
+                    WHEN latest_inspection_status IS NULL AND Status = 'Inspection Failed' THEN 'Active'
+                    ELSE Status
+                END
+    WHERE EmergencyDeviceID = device_id;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION update_device_status_on_inspection()
+RETURNS TRIGGER AS $$
+DECLARE
+    current_last_inspection_timestamp TIMESTAMPTZ;
+BEGIN
+    SELECT LastInspectionDateTime INTO current_last_inspection_timestamp
+    FROM Emergency_DeviceT
+    WHERE EmergencyDeviceID = NEW.EmergencyDeviceID;
+
+    -- An older inspection recorded late does not change the device
+    IF current_last_inspection_timestamp IS NULL OR NEW.InspectionDateTime > current_last_inspection_timestamp THEN
+        PERFORM recompute_device_inspection_status(NEW.EmergencyDeviceID);
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- The inspection time is sent with its UTC offset, receivers convert it to the site's zone
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION record_inspection_webhook_event()
+RETURNS TRIGGER AS $$
+DECLARE
+    payload JSONB;
+BEGIN
+    payload := jsonb_build_object(
+        'inspection', jsonb_build_object(
+            'emergency_device_inspection_id', NEW.EmergencyDeviceInspectionID,
+            'inspection_datetime', NEW.InspectionDateTime,
+            'inspection_status', NEW.InspectionStatus,
+            'work_order_required', NEW.WorkOrderRequired,
+            'user_id', NEW.UserID,
+            'notes', NEW.Notes
+        ),
+        'device', webhook_device_payload(NEW.EmergencyDeviceID)
+    );
+
+    INSERT INTO Webhook_EventT (EventType, Payload) VALUES ('inspection.created', payload);
+    IF NEW.InspectionStatus = 'Failed' THEN
+        INSERT INTO Webhook_EventT (EventType, Payload) VALUES ('inspection.failed', payload);
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- The site's zone is sent with the device
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION webhook_device_payload(device_id INT)
+RETURNS JSONB AS $$
+    SELECT jsonb_build_object(
+        'emergency_device_id', ed.EmergencyDeviceID,
+        'emergency_device_type_name', edt.EmergencyDeviceTypeName,
+        'serial_number', ed.SerialNumber,
+        'status', ed.Status,
+        'room_code', r.RoomCode,
+        'building_code', b.BuildingCode,
+        'site_id', s.SiteID,
+        'site_name', s.SiteName,
+        'site_time_zone', s.TimeZone
+    )
+    FROM Emergency_DeviceT ed
+    JOIN Emergency_Device_TypeT edt ON ed.EmergencyDeviceTypeID = edt.EmergencyDeviceTypeID
+    JOIN RoomT r ON ed.RoomID = r.RoomID
+    JOIN BuildingT b ON r.BuildingID = b.BuildingID
+    JOIN SiteT s ON b.SiteID = s.SiteID
+    WHERE ed.EmergencyDeviceID = device_id;
+$$ LANGUAGE sql STABLE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION webhook_device_payload(device_id INT)
+RETURNS JSONB AS $$
+    SELECT jsonb_build_object(
+        'emergency_device_id', ed.EmergencyDeviceID,
+        'emergency_device_type_name', edt.EmergencyDeviceTypeName,
+        'serial_number', ed.SerialNumber,
+        'status', ed.Status,
+        'room_code', r.RoomCode,
+        'building_code', b.BuildingCode,
+        'site_id', s.SiteID,
+        'site_name', s.SiteName
+    )
+    FROM Emergency_DeviceT ed
+    JOIN Emergency_Device_TypeT edt ON ed.EmergencyDeviceTypeID = edt.EmergencyDeviceTypeID
+    JOIN RoomT r ON ed.RoomID = r.RoomID
+    JOIN BuildingT b ON r.BuildingID = b.BuildingID
+    JOIN SiteT s ON b.SiteID = s.SiteID
+    WHERE ed.EmergencyDeviceID = device_id;
+$$ LANGUAGE sql STABLE;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION record_inspection_webhook_event()
+RETURNS TRIGGER AS $$
+DECLARE
+    payload JSONB;
+BEGIN
+    payload := jsonb_build_object(
+        'inspection', jsonb_build_object(
+            'emergency_device_inspection_id', NEW.EmergencyDeviceInspectionID,
+            'inspection_datetime', NEW.InspectionDateTime AT TIME ZONE 'Pacific/Auckland',
+            'inspection_status', NEW.InspectionStatus,
+            'work_order_required', NEW.WorkOrderRequired,
+            'user_id', NEW.UserID,
+            'notes', NEW.Notes
+        ),
+        'device', webhook_device_payload(NEW.EmergencyDeviceID)
+    );
+
+    INSERT INTO Webhook_EventT (EventType, Payload) VALUES ('inspection.created', payload);
+    IF NEW.InspectionStatus = 'Failed' THEN
+        INSERT INTO Webhook_EventT (EventType, Payload) VALUES ('inspection.failed', payload);
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION update_device_status_on_inspection()
+RETURNS TRIGGER AS $$
+DECLARE
+    current_last_inspection_timestamp TIMESTAMP;
+BEGIN
+    SELECT LastInspectionDateTime INTO current_last_inspection_timestamp
+    FROM Emergency_DeviceT
+    WHERE EmergencyDeviceID = NEW.EmergencyDeviceID;
+
+    -- An older inspection recorded late does not change the device
+    IF current_last_inspection_timestamp IS NULL OR NEW.InspectionDateTime > current_last_inspection_timestamp THEN
+        PERFORM recompute_device_inspection_status(NEW.EmergencyDeviceID);
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION recompute_device_inspection_status(device_id INT)
+RETURNS VOID AS $$
+DECLARE
+    latest_inspection_timestamp TIMESTAMP;
+    latest_inspection_status VARCHAR(20);
+    calculated_expire_date TIMESTAMP;
+BEGIN
+    SELECT edi.InspectionDateTime, edi.InspectionStatus INTO latest_inspection_timestamp, latest_inspection_status
+    FROM Emergency_Device_InspectionT edi
+    WHERE edi.EmergencyDeviceID = device_id
+      AND NOT EXISTS (
+          SELECT 1 FROM Inspection_RevisionT r
+          WHERE r.EmergencyDeviceInspectionID = edi.EmergencyDeviceInspectionID
+      )
+    ORDER BY edi.InspectionDateTime DESC, edi.EmergencyDeviceInspectionID DESC
+    LIMIT 1;
+
+    -- Calculate the expiration date as ManufactureDate + 5 years
+    SELECT ManufactureDate + INTERVAL '5 years' INTO calculated_expire_date
+    FROM Emergency_DeviceT
+    WHERE EmergencyDeviceID = device_id;
+
+    UPDATE Emergency_DeviceT
+    SET LastInspectionDateTime = latest_inspection_timestamp,
+        Status = CASE
+                    WHEN Status = 'Recalled' THEN Status
+                    WHEN latest_inspection_status = 'Failed' THEN 'Inspection Failed'
+                    WHEN calculated_expire_date <= NOW() THEN 'Expired'
+                    WHEN latest_inspection_status IN ('Passed', 'Passed with defects') THEN 'Active'
+                    -- The failed inspection was voided and no other inspection is left
+                    WHEN latest_inspection_status IS NULL AND Status = 'Inspection Failed' THEN 'Active'
+                    ELSE Status
+                END
+    WHERE EmergencyDeviceID = device_id;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+ALTER TABLE Inspection_Round_ItemT
+    ALTER COLUMN UpdatedAt TYPE TIMESTAMP;
+
+ALTER TABLE Inspection_RoundT
+    ALTER COLUMN CompletedAt TYPE TIMESTAMP,
+    ALTER COLUMN CreatedAt TYPE TIMESTAMP;
+
+ALTER TABLE Inspection_RevisionT
+    ALTER COLUMN RevisedAt TYPE TIMESTAMP;
+
+ALTER TABLE Checklist_TemplateT
+    ALTER COLUMN CreatedAt TYPE TIMESTAMP;
+
+ALTER TABLE AttachmentT
+    ALTER COLUMN UploadedAt TYPE TIMESTAMP;
+
+ALTER TABLE Device_RecallT
+    ALTER COLUMN ResolvedAt TYPE TIMESTAMP,
+    ALTER COLUMN FlaggedAt TYPE TIMESTAMP;
+
+ALTER TABLE RecallT
+    ALTER COLUMN CreatedAt TYPE TIMESTAMP;
+
+ALTER TABLE Emergency_DeviceT
+    ALTER COLUMN UpdatedAt TYPE TIMESTAMP,
+    ALTER COLUMN LastInspectionDateTime TYPE TIMESTAMP USING LastInspectionDateTime AT TIME ZONE 'Pacific/Auckland';
+
+ALTER TABLE Emergency_Device_InspectionT
+    ALTER COLUMN CreatedAt TYPE TIMESTAMP,
+    ALTER COLUMN InspectionDateTime TYPE TIMESTAMP USING InspectionDateTime AT TIME ZONE 'Pacific/Auckland';
+
+ALTER TABLE SiteT
+    DROP COLUMN IF EXISTS TimeZone;
@@ -0,0 +1,10 @@
+-- +goose Up
+
+-- An archived building is kept with its rooms, devices and their inspection history but
+-- is no longer listed. Its devices are made inactive when it is archived.
+ALTER TABLE BuildingT
+    ADD COLUMN ArchivedAt TIMESTAMPTZ NULL;
+
+-- +goose Down
+ALTER TABLE BuildingT
+    DROP COLUMN IF EXISTS ArchivedAt;
@@ -0,0 +1,26 @@
+-- +goose Up
+
+-- Work orders are raised by inspections that need one, their invoices, service certificates
+-- and photos of the repair are attached to the work order, apart from the inspection's own
+-- photos
+ALTER TABLE AttachmentT
+    ADD COLUMN WorkOrderInspectionID INT NULL,
+    ADD FOREIGN KEY (WorkOrderInspectionID) REFERENCES Emergency_Device_InspectionT(EmergencyDeviceInspectionID)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE; -- Delete associated Attachments if an Inspection is deleted
+
+-- Each attachment belongs to exactly one owner
+ALTER TABLE AttachmentT DROP CONSTRAINT attachmentt_check;
+ALTER TABLE AttachmentT ADD CONSTRAINT chk_attachment_owner CHECK (
+    (EmergencyDeviceID IS NOT NULL)::INT + (EmergencyDeviceInspectionID IS NOT NULL)::INT + (WorkOrderInspectionID IS NOT NULL)::INT = 1
+);
+
+CREATE INDEX idx_attachment_work_order ON AttachmentT(WorkOrderInspectionID);
+
+-- +goose Down
+DELETE FROM AttachmentT WHERE WorkOrderInspectionID IS NOT NULL;
+ALTER TABLE AttachmentT DROP CONSTRAINT chk_attachment_owner;
+ALTER TABLE AttachmentT DROP COLUMN WorkOrderInspectionID;
+ALTER TABLE AttachmentT ADD CONSTRAINT attachmentt_check CHECK (
+    (EmergencyDeviceID IS NOT NULL)::INT + (EmergencyDeviceInspectionID IS NOT NULL)::INT = 1
+);
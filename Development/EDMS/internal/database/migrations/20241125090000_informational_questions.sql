@@ -0,0 +1,186 @@
+-- +goose Up
+
+-- Informational questions are recorded but never change the outcome of an inspection.
+-- "Is Replaced" is answered "No" for almost every extinguisher, and the legacy migration
+-- turned every unticked box into "No", so as an advisory question it gave nearly every
+-- inspection a defect.
+ALTER TABLE Checklist_QuestionT DROP CONSTRAINT IF EXISTS checklist_questiont_severity_check;
+ALTER TABLE Checklist_QuestionT
+    ADD CONSTRAINT checklist_questiont_severity_check
+        CHECK (Severity IN ('Critical', 'Advisory', 'Informational'));
+
+UPDATE Checklist_QuestionT
+SET Severity = 'Informational'
+WHERE LegacyColumn = 'isreplaced';
+
+-- Recalculate the outcome of inspections that are not sealed. Their answers are left as
+-- they were recorded, only the outcome worked out from them changes, as it came from the
+-- severity "Is Replaced" was wrongly given rather than from anything the inspector wrote.
+-- Unsealed rows have no hash to break and most were migrated from the old form, so
+-- revising each of them would bury the real amendments among thousands of corrections.
+-- Sealed inspections keep the status they were recorded with so they still verify, and
+-- inspections already amended or voided are never changed, both are corrected by
+-- revising them. A status that was not overridden follows the new outcome.
+WITH outcome AS (
+    SELECT i.EmergencyDeviceInspectionID,
+           CASE
+               WHEN bool_or(r.AnswerYesNo = 'No' AND q.Severity = 'Critical') THEN 'Failed'
+               WHEN bool_or(r.AnswerYesNo = 'No' AND q.Severity = 'Advisory') THEN 'Passed with defects'
+               ELSE 'Passed'
+           END AS ComputedStatus
+    FROM Emergency_Device_InspectionT i
+    JOIN Inspection_ResponseT r ON r.EmergencyDeviceInspectionID = i.EmergencyDeviceInspectionID
+    JOIN Checklist_QuestionT q ON q.ChecklistQuestionID = r.ChecklistQuestionID
+    WHERE i.ComputedStatus IS NOT NULL
+      AND i.ContentHash IS NULL
+      AND NOT EXISTS (SELECT 1 FROM Inspection_RevisionT rev WHERE rev.EmergencyDeviceInspectionID = i.EmergencyDeviceInspectionID)
+    GROUP BY i.EmergencyDeviceInspectionID
+)
+UPDATE Emergency_Device_InspectionT i
+SET InspectionStatus = CASE
+                           WHEN i.OverriddenBy IS NULL AND i.InspectionStatus = i.ComputedStatus THEN outcome.ComputedStatus
+                           ELSE i.InspectionStatus
+                       END,
+    ComputedStatus = outcome.ComputedStatus
+FROM outcome
+WHERE i.EmergencyDeviceInspectionID = outcome.EmergencyDeviceInspectionID
+  AND i.ComputedStatus <> outcome.ComputedStatus;
+
+-- Seed "Is Replaced" as informational when the default extinguisher template is created
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION migrate_legacy_inspections()
+RETURNS INTEGER AS $$
+DECLARE
+    extinguisher_type_id INT;
+    template_id INT;
+    migrated_count INT;
+BEGIN
+    SELECT EmergencyDeviceTypeID INTO extinguisher_type_id
+    FROM Emergency_Device_TypeT
+    WHERE EmergencyDeviceTypeName = 'Fire Extinguisher';
+
+    IF extinguisher_type_id IS NULL THEN
+        RETURN 0;
+    END IF;
+
+    SELECT ChecklistTemplateID INTO template_id
+    FROM Checklist_TemplateT
+    WHERE EmergencyDeviceTypeID = extinguisher_type_id AND Version = 1;
+
+    IF template_id IS NULL THEN
+        INSERT INTO Checklist_TemplateT (EmergencyDeviceTypeID, TemplateName, Version)
+        VALUES (extinguisher_type_id, 'Fire Extinguisher', 1)
+        RETURNING ChecklistTemplateID INTO template_id;
+
+        INSERT INTO Checklist_QuestionT (ChecklistTemplateID, SortOrder, QuestionText, AnswerType, IsRequired, Severity, LegacyColumn)
+        VALUES
+            (template_id, 1, 'Is Conspicuous', 'YesNoNA', TRUE, 'Critical', 'isconspicuous'),
+            (template_id, 2, 'Is Accessible', 'YesNoNA', TRUE, 'Critical', 'isaccessible'),
+            (template_id, 3, 'Is in Assigned Location', 'YesNoNA', TRUE, 'Critical', 'isassignedlocation'),
+            (template_id, 4, 'Is Sign Visible', 'YesNoNA', TRUE, 'Advisory', 'issignvisible'),
+            (template_id, 5, 'Is Anti-Tamper Device Intact', 'YesNoNA', TRUE, 'Critical', 'isantitamperdeviceintact'),
+            (template_id, 6, 'Is Support Bracket Secure', 'YesNoNA', TRUE, 'Critical', 'issupportbracketsecure'),
+            (template_id, 7, 'Are Operating Instructions Clear', 'YesNoNA', TRUE, 'Advisory', 'areoperatinginstructionsclear'),
+            (template_id, 8, 'Is Maintenance Tag Attached', 'YesNoNA', TRUE, 'Advisory', 'ismaintenancetagattached'),
+            (template_id, 9, 'Is No External Damage', 'YesNoNA', TRUE, 'Critical', 'isnoexternaldamage'),
+            (template_id, 10, 'Is Charge Gauge Normal', 'YesNoNA', TRUE, 'Critical', 'ischargegaugenormal'),
+            (template_id, 11, 'Are Maintenance Records Complete', 'YesNoNA', TRUE, 'Advisory', 'aremaintenancerecordscomplete'),
+            (template_id, 12, 'Is Replaced', 'YesNoNA', TRUE, 'Informational', 'isreplaced');
+    END IF;
+
+    -- Inspections answered on the old form have at least one checklist column set.
+    -- An unchecked box was saved as false or NULL, both become "No".
+    WITH legacy AS (
+        UPDATE Emergency_Device_InspectionT
+        SET ChecklistTemplateID = template_id
+        WHERE ChecklistTemplateID IS NULL
+          AND num_nonnulls(IsConspicuous, IsAccessible, IsAssignedLocation, IsSignVisible, IsAntiTamperDeviceIntact,
+                           IsSupportBracketSecure, AreOperatingInstructionsClear, IsMaintenanceTagAttached,
+                           IsNoExternalDamage, IsChargeGaugeNormal, IsReplaced, AreMaintenanceRecordsComplete) > 0
+        RETURNING *
+    )
+    INSERT INTO Inspection_ResponseT (EmergencyDeviceInspectionID, ChecklistQuestionID, AnswerYesNo)
+    SELECT legacy.EmergencyDeviceInspectionID, q.ChecklistQuestionID,
+           CASE WHEN COALESCE((to_jsonb(legacy) ->> q.LegacyColumn)::BOOLEAN, FALSE) THEN 'Yes' ELSE 'No' END
+    FROM legacy
+    JOIN Checklist_QuestionT q ON q.ChecklistTemplateID = template_id AND q.LegacyColumn IS NOT NULL;
+
+    GET DIAGNOSTICS migrated_count = ROW_COUNT;
+    RETURN migrated_count;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION migrate_legacy_inspections()
+RETURNS INTEGER AS $$
+DECLARE
+    extinguisher_type_id INT;
+    template_id INT;
+    migrated_count INT;
+BEGIN
+    SELECT EmergencyDeviceTypeID INTO extinguisher_type_id
+    FROM Emergency_Device_TypeT
+    WHERE EmergencyDeviceTypeName = 'Fire Extinguisher';
+
+    IF extinguisher_type_id IS NULL THEN
+        RETURN 0;
+    END IF;
+
+    SELECT ChecklistTemplateID INTO template_id
+    FROM Checklist_TemplateT
+    WHERE EmergencyDeviceTypeID = extinguisher_type_id AND Version = 1;
+
+    IF template_id IS NULL THEN
+        INSERT INTO Checklist_TemplateT (EmergencyDeviceTypeID, TemplateName, Version)
+        VALUES (extinguisher_type_id, 'Fire Extinguisher', 1)
+        RETURNING ChecklistTemplateID INTO template_id;
+
+        INSERT INTO Checklist_QuestionT (ChecklistTemplateID, SortOrder, QuestionText, AnswerType, IsRequired, Severity, LegacyColumn)
+        VALUES
+            (template_id, 1, 'Is Conspicuous', 'YesNoNA', TRUE, 'Critical', 'isconspicuous'),
+            (template_id, 2, 'Is Accessible', 'YesNoNA', TRUE, 'Critical', 'isaccessible'),
+            (template_id, 3, 'Is in Assigned Location', 'YesNoNA', TRUE, 'Critical', 'isassignedlocation'),
+            (template_id, 4, 'Is Sign Visible', 'YesNoNA', TRUE, 'Advisory', 'issignvisible'),
+            (template_id, 5, 'Is Anti-Tamper Device Intact', 'YesNoNA', TRUE, 'Critical', 'isantitamperdeviceintact'),
+            (template_id, 6, 'Is Support Bracket Secure', 'YesNoNA', TRUE, 'Critical', 'issupportbracketsecure'),
+            (template_id, 7, 'Are Operating Instructions Clear', 'YesNoNA', TRUE, 'Advisory', 'areoperatinginstructionsclear'),
+            (template_id, 8, 'Is Maintenance Tag Attached', 'YesNoNA', TRUE, 'Advisory', 'ismaintenancetagattached'),
+            (template_id, 9, 'Is No External Damage', 'YesNoNA', TRUE, 'Critical', 'isnoexternaldamage'),
+            (template_id, 10, 'Is Charge Gauge Normal', 'YesNoNA', TRUE, 'Critical', 'ischargegaugenormal'),
+            (template_id, 11, 'Are Maintenance Records Complete', 'YesNoNA', TRUE, 'Advisory', 'aremaintenancerecordscomplete'),
+            (template_id, 12, 'Is Replaced', 'YesNoNA', TRUE, 'Advisory', 'isreplaced');
+    END IF;
+
+    -- Inspections answered on the old form have at least one checklist column set.
+    -- An unchecked box was saved as false or NULL, both become "No".
+    WITH legacy AS (
+        UPDATE Emergency_Device_InspectionT
+        SET ChecklistTemplateID = template_id
+        WHERE ChecklistTemplateID IS NULL
+          AND num_nonnulls(IsConspicuous, IsAccessible, IsAssignedLocation, IsSignVisible, IsAntiTamperDeviceIntact,
+                           IsSupportBracketSecure, AreOperatingInstructionsClear, IsMaintenanceTagAttached,
+                           IsNoExternalDamage, IsChargeGaugeNormal, IsReplaced, AreMaintenanceRecordsComplete) > 0
+        RETURNING *
+    )
+    INSERT INTO Inspection_ResponseT (EmergencyDeviceInspectionID, ChecklistQuestionID, AnswerYesNo)
+    SELECT legacy.EmergencyDeviceInspectionID, q.ChecklistQuestionID,
+           CASE WHEN COALESCE((to_jsonb(legacy) ->> q.LegacyColumn)::BOOLEAN, FALSE) THEN 'Yes' ELSE 'No' END
+    FROM legacy
+    JOIN Checklist_QuestionT q ON q.ChecklistTemplateID = template_id AND q.LegacyColumn IS NOT NULL;
+
+    GET DIAGNOSTICS migrated_count = ROW_COUNT;
+    RETURN migrated_count;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+UPDATE Checklist_QuestionT
+SET Severity = 'Advisory'
+WHERE Severity = 'Informational';
+
+ALTER TABLE Checklist_QuestionT DROP CONSTRAINT IF EXISTS checklist_questiont_severity_check;
+ALTER TABLE Checklist_QuestionT
+    ADD CONSTRAINT checklist_questiont_severity_check
+        CHECK (Severity IN ('Critical', 'Advisory'));
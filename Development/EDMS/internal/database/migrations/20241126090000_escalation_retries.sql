@@ -0,0 +1,21 @@
+-- +goose Up
+
+-- Expired and recalled devices can be escalated too
+ALTER TABLE Escalation_StepT DROP CONSTRAINT IF EXISTS escalation_stept_notificationtype_check;
+ALTER TABLE Escalation_StepT
+    ADD CONSTRAINT escalation_stept_notificationtype_check
+        CHECK (NotificationType IN ('Inspection Overdue', 'Inspection Failed', 'Expired', 'Recalled'));
+
+-- Email addresses a step could not be sent to, tried again on each run until the
+-- notification is resolved
+ALTER TABLE Device_EscalationT
+    ADD COLUMN PendingTo TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE Device_EscalationT DROP COLUMN IF EXISTS PendingTo;
+
+DELETE FROM Escalation_StepT WHERE NotificationType IN ('Expired', 'Recalled');
+ALTER TABLE Escalation_StepT DROP CONSTRAINT IF EXISTS escalation_stept_notificationtype_check;
+ALTER TABLE Escalation_StepT
+    ADD CONSTRAINT escalation_stept_notificationtype_check
+        CHECK (NotificationType IN ('Inspection Overdue', 'Inspection Failed'));
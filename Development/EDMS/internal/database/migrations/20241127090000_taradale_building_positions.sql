@@ -0,0 +1,83 @@
+-- +goose Up
+
+-- The EIT Taradale building positions used to be read by the dashboard from
+-- static/assets/buildings.json. They were drawn on the Taradale map in its SVG user
+-- space, and are stored as pixels from the top left of the map at the centre of the
+-- 19 unit marker the dashboard drew. The seed calls the function again for new databases.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION import_taradale_building_positions()
+RETURNS INTEGER AS $$
+DECLARE
+    taradale_id INT;
+    updated_count INT;
+BEGIN
+    SELECT SiteID INTO taradale_id
+    FROM SiteT
+    WHERE SiteName = 'EIT Taradale';
+
+    IF taradale_id IS NULL THEN
+        RETURN 0;
+    END IF;
+
+    -- Positions set by admins are kept
+    IF EXISTS (SELECT 1 FROM BuildingT WHERE SiteID = taradale_id AND MapX IS NOT NULL) THEN
+        RETURN 0;
+    END IF;
+
+    UPDATE BuildingT b
+    SET MapX = p.MapX, MapY = p.MapY
+    FROM (
+        VALUES
+            ('O', 76.291, 28.169),
+            ('T', 167.991, 82.169),
+            ('R', 284.891, 126.869),
+            ('E2', 453.491, 115.069),
+            ('E', 454.691, 162.269),
+            ('E1', 501.791, 208.869),
+            ('D', 316.491, 242.069),
+            ('P1', 181.191, 175.369),
+            ('P', 133.691, 173.269),
+            ('N1', 124.591, 213.869),
+            ('N2', 180.191, 226.369),
+            ('N', 140.391, 273.469),
+            ('M', 242.891, 295.969),
+            ('F1', 410.391, 255.669),
+            ('F', 457.091, 297.269),
+            ('C', 351.191, 331.869),
+            ('B', 291.191, 347.069),
+            ('L', 177.691, 373.569),
+            ('L1', 119.391, 361.769),
+            ('K1', 126.491, 405.069),
+            ('K', 201.691, 451.869),
+            ('J', 295.391, 492.169),
+            ('G', 404.791, 461.469),
+            ('G1', 515.691, 453.469),
+            ('G2', 420.291, 378.469),
+            ('I', 439.191, 581.769),
+            ('I1', 378.491, 602.969),
+            ('H', 500.091, 649.269),
+            ('Q', 397.791, 854.669),
+            ('S', 245.591, 808.569),
+            ('A', 325.291, 398.969),
+            ('J1', 302.591, 452.269)
+    ) AS p(BuildingCode, MapX, MapY)
+    WHERE b.SiteID = taradale_id AND b.BuildingCode = p.BuildingCode;
+
+    GET DIAGNOSTICS updated_count = ROW_COUNT;
+
+    -- The positions belong to the Taradale map, which is moved into the file store on start up
+    IF updated_count > 0 THEN
+        UPDATE SiteT
+        SET SiteMapImagePath = '/static/site_maps/EIT_Taradale.svg'
+        WHERE SiteID = taradale_id AND COALESCE(SiteMapImagePath, '') = '';
+    END IF;
+
+    RETURN updated_count;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+SELECT import_taradale_building_positions();
+
+-- +goose Down
+DROP FUNCTION IF EXISTS import_taradale_building_positions();
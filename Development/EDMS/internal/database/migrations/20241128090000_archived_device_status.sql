@@ -0,0 +1,10 @@
+-- +goose Up
+
+-- The status a device had before its building was archived made it inactive, kept so
+-- resolving a recall does not bring the device back while the building is archived
+ALTER TABLE Emergency_DeviceT
+    ADD COLUMN StatusBeforeArchive VARCHAR(50) NULL;
+
+-- +goose Down
+ALTER TABLE Emergency_DeviceT
+    DROP COLUMN IF EXISTS StatusBeforeArchive;
@@ -0,0 +1,87 @@
+-- +goose Up
+
+-- Devices of an archived building stay inactive when an inspection is recorded, amended
+-- or voided, so they do not come back into rounds, calendars and notifications
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION recompute_device_inspection_status(device_id INT)
+RETURNS VOID AS $$
+DECLARE
+    latest_inspection_timestamp TIMESTAMPTZ;
+    latest_inspection_status VARCHAR(20);
+    calculated_expire_date TIMESTAMP;
+    device_archived BOOLEAN;
+BEGIN
+    SELECT edi.InspectionDateTime, edi.InspectionStatus INTO latest_inspection_timestamp, latest_inspection_status
+    FROM Emergency_Device_InspectionT edi
+    WHERE edi.EmergencyDeviceID = device_id
+      AND NOT EXISTS (
+          SELECT 1 FROM Inspection_RevisionT r
+          WHERE r.EmergencyDeviceInspectionID = edi.EmergencyDeviceInspectionID
+      )
+    ORDER BY edi.InspectionDateTime DESC, edi.EmergencyDeviceInspectionID DESC
+    LIMIT 1;
+
+    -- Calculate the expiration date as ManufactureDate + 5 years. Devices of an archived
+    -- building keep the status archiving gave them.
+    SELECT ed.ManufactureDate + INTERVAL '5 years', b.ArchivedAt IS NOT NULL
+    INTO calculated_expire_date, device_archived
+    FROM Emergency_DeviceT ed
+    JOIN RoomT r ON ed.RoomID = r.RoomID
+    JOIN BuildingT b ON r.BuildingID = b.BuildingID
+    WHERE ed.EmergencyDeviceID = device_id;
+
+    UPDATE Emergency_DeviceT
+    SET LastInspectionDateTime = latest_inspection_timestamp,
+        Status = CASE
+                    WHEN Status = 'Recalled' OR device_archived THEN Status
+                    WHEN latest_inspection_status = 'Failed' THEN 'Inspection Failed'
+                    WHEN calculated_expire_date <= NOW() THEN 'Expired'
+                    WHEN latest_inspection_status IN ('Passed', 'Passed with defects') THEN 'Active'
+                    -- The failed inspection was voided and no other inspection is left
+                    WHEN latest_inspection_status IS NULL AND Status = 'Inspection Failed' THEN 'Active'
+                    ELSE Status
+                END
+    WHERE EmergencyDeviceID = device_id;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION recompute_device_inspection_status(device_id INT)
+RETURNS VOID AS $$
+DECLARE
+    latest_inspection_timestamp TIMESTAMPTZ;
+    latest_inspection_status VARCHAR(20);
+    calculated_expire_date TIMESTAMP;
+BEGIN
+    SELECT edi.InspectionDateTime, edi.InspectionStatus INTO latest_inspection_timestamp, latest_inspection_status
+    FROM Emergency_Device_InspectionT edi
+    WHERE edi.EmergencyDeviceID = device_id
+      AND NOT EXISTS (
+          SELECT 1 FROM Inspection_RevisionT r
+          WHERE r.EmergencyDeviceInspectionID = edi.EmergencyDeviceInspectionID
+      )
+    ORDER BY edi.InspectionDateTime DESC, edi.EmergencyDeviceInspectionID DESC
+    LIMIT 1;
+
+    -- Calculate the expiration date as ManufactureDate + 5 years
+    SELECT ManufactureDate + INTERVAL '5 years' INTO calculated_expire_date
+    FROM Emergency_DeviceT
+    WHERE EmergencyDeviceID = device_id;
+
+    UPDATE Emergency_DeviceT
+    SET LastInspectionDateTime = latest_inspection_timestamp,
+        Status = CASE
+                    WHEN Status = 'Recalled' THEN Status
+                    WHEN latest_inspection_status = 'Failed' THEN 'Inspection Failed'
+                    WHEN calculated_expire_date <= NOW() THEN 'Expired'
+                    WHEN latest_inspection_status IN ('Passed', 'Passed with defects') THEN 'Active'
+                    -- The failed inspection was voided and no other inspection is left
+                    WHEN latest_inspection_status IS NULL AND Status = 'Inspection Failed' THEN 'Active'
+                    ELSE Status
+                END
+    WHERE EmergencyDeviceID = device_id;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
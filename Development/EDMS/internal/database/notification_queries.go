@@ -0,0 +1,239 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+)
+
+// SyncNotifications makes the open notifications match the conditions devices are in now.
+// Unchanged notifications are kept with their read state, a device whose condition
+// changed has its old notification resolved and a new one raised.
+func (db *DB) SyncNotifications(current []models.Notification) (created int, resolved int, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+	SELECT notificationid, emergencydeviceid, notificationtype, referencedate
+	FROM notificationT
+	WHERE resolvedat IS NULL
+	FOR UPDATE
+	`)
+	if err != nil {
+		return 0, 0, err
+	}
+	open := make(map[int]models.Notification)
+	for rows.Next() {
+		var notification models.Notification
+		err := rows.Scan(
+			&notification.NotificationID,
+			&notification.EmergencyDeviceID,
+			&notification.NotificationType,
+			&notification.ReferenceDate,
+		)
+		if err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		open[notification.EmergencyDeviceID] = notification
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	resolve := func(notificationID int) error {
+		_, err := tx.Exec(`UPDATE notificationT SET resolvedat = CURRENT_TIMESTAMP WHERE notificationid = $1`, notificationID)
+		if err == nil {
+			resolved++
+		}
+		return err
+	}
+
+	for _, notification := range current {
+		existing, ok := open[notification.EmergencyDeviceID]
+		delete(open, notification.EmergencyDeviceID)
+		if ok && existing.NotificationType == notification.NotificationType && sameDate(existing.ReferenceDate, notification.ReferenceDate) {
+			continue
+		}
+		if ok {
+			if err := resolve(existing.NotificationID); err != nil {
+				return 0, 0, err
+			}
+		}
+
+		_, err := tx.Exec(`
+		INSERT INTO notificationT (emergencydeviceid, notificationtype, referencedate)
+		VALUES ($1, $2, $3)
+		`, notification.EmergencyDeviceID, notification.NotificationType, notification.ReferenceDate)
+		if err != nil {
+			return 0, 0, err
+		}
+		created++
+	}
+
+	// Devices no longer in any condition
+	for _, existing := range open {
+		if err := resolve(existing.NotificationID); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+
+	return created, resolved, nil
+}
+
+func sameDate(a, b sql.NullTime) bool {
+	if a.Valid != b.Valid {
+		return false
+	}
+	return !a.Valid || a.Time.Format("2006-01-02") == b.Time.Format("2006-01-02")
+}
+
+// GetNotificationsForUser returns the open notifications with the user's read state, most
+// urgent first. Dismissed notifications are left out unless includeDismissed is set.
+func (db *DB) GetNotificationsForUser(userID int, includeDismissed bool) ([]models.Notification, error) {
+	query := `
+	SELECT n.notificationid, n.emergencydeviceid, n.notificationtype, n.referencedate, n.createdat, n.resolvedat,
+		   s.readat, s.dismissedat,
+		   edt.emergencydevicetypename, ed.serialnumber, r.roomcode, b.buildingcode, si.siteid, si.sitename, si.timezone
+	FROM notificationT n
+	JOIN emergency_deviceT ed ON n.emergencydeviceid = ed.emergencydeviceid
+	JOIN emergency_device_typeT edt ON ed.emergencydevicetypeid = edt.emergencydevicetypeid
+	JOIN roomT r ON ed.roomid = r.roomid
+	JOIN buildingT b ON r.buildingid = b.buildingid
+	JOIN siteT si ON b.siteid = si.siteid
+	LEFT JOIN notification_user_stateT s ON s.notificationid = n.notificationid AND s.userid = $1
+	WHERE n.resolvedat IS NULL
+	  AND ($2 OR s.dismissedat IS NULL)
+	ORDER BY CASE n.notificationtype
+				WHEN 'Recalled' THEN 0
+				WHEN 'Inspection Failed' THEN 1
+				WHEN 'Expired' THEN 2
+				WHEN 'Inspection Overdue' THEN 3
+				WHEN 'Expiring Soon' THEN 4
+				ELSE 5
+			 END,
+			 n.referencedate NULLS FIRST, n.notificationid
+	`
+
+	rows, err := db.Query(query, userID, includeDismissed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var notification models.Notification
+		err := rows.Scan(
+			&notification.NotificationID,
+			&notification.EmergencyDeviceID,
+			&notification.NotificationType,
+			&notification.ReferenceDate,
+			&notification.CreatedAt,
+			&notification.ResolvedAt,
+			&notification.ReadAt,
+			&notification.DismissedAt,
+			&notification.EmergencyDeviceTypeName,
+			&notification.SerialNumber,
+			&notification.RoomCode,
+			&notification.BuildingCode,
+			&notification.SiteID,
+			&notification.SiteName,
+			&notification.SiteTimeZone,
+		)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, rows.Err()
+}
+
+// GetNotificationCount counts the open notifications the user has not dismissed
+func (db *DB) GetNotificationCount(userID int) (*models.NotificationCount, error) {
+	query := `
+	SELECT COUNT(*), COUNT(*) FILTER (WHERE s.readat IS NULL)
+	FROM notificationT n
+	LEFT JOIN notification_user_stateT s ON s.notificationid = n.notificationid AND s.userid = $1
+	WHERE n.resolvedat IS NULL AND s.dismissedat IS NULL
+	`
+
+	var count models.NotificationCount
+	if err := db.QueryRow(query, userID).Scan(&count.Total, &count.Unread); err != nil {
+		return nil, err
+	}
+
+	return &count, nil
+}
+
+// MarkNotificationRead marks an open notification as read by the user, it returns
+// sql.ErrNoRows if there is no such open notification
+func (db *DB) MarkNotificationRead(notificationID, userID int) error {
+	return db.setNotificationState(notificationID, userID, false)
+}
+
+// DismissNotification hides an open notification from the user, it returns
+// sql.ErrNoRows if there is no such open notification
+func (db *DB) DismissNotification(notificationID, userID int) error {
+	return db.setNotificationState(notificationID, userID, true)
+}
+
+func (db *DB) setNotificationState(notificationID, userID int, dismiss bool) error {
+	query := `
+	INSERT INTO notification_user_stateT (notificationid, userid, readat, dismissedat)
+	SELECT n.notificationid, $2, CURRENT_TIMESTAMP, CASE WHEN $3 THEN CURRENT_TIMESTAMP END
+	FROM notificationT n
+	WHERE n.notificationid = $1 AND n.resolvedat IS NULL
+	ON CONFLICT (notificationid, userid) DO UPDATE
+	SET readat = COALESCE(notification_user_stateT.readat, EXCLUDED.readat),
+		dismissedat = COALESCE(notification_user_stateT.dismissedat, EXCLUDED.dismissedat)
+	`
+
+	result, err := db.Exec(query, notificationID, userID, dismiss)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// MarkAllNotificationsRead marks every open notification as read by the user
+func (db *DB) MarkAllNotificationsRead(userID int) error {
+	return db.setAllNotificationsState(userID, false)
+}
+
+// DismissAllNotifications hides every open notification from the user
+func (db *DB) DismissAllNotifications(userID int) error {
+	return db.setAllNotificationsState(userID, true)
+}
+
+func (db *DB) setAllNotificationsState(userID int, dismiss bool) error {
+	query := `
+	INSERT INTO notification_user_stateT (notificationid, userid, readat, dismissedat)
+	SELECT n.notificationid, $1, CURRENT_TIMESTAMP, CASE WHEN $2 THEN CURRENT_TIMESTAMP END
+	FROM notificationT n
+	WHERE n.resolvedat IS NULL
+	ON CONFLICT (notificationid, userid) DO UPDATE
+	SET readat = COALESCE(notification_user_stateT.readat, EXCLUDED.readat),
+		dismissedat = COALESCE(notification_user_stateT.dismissedat, EXCLUDED.dismissedat)
+	`
+
+	_, err := db.Exec(query, userID, dismiss)
+	return err
+}
@@ -2,9 +2,12 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/utils"
 )
 
 // GetAllUsers function
@@ -226,6 +229,12 @@ func (db *DB) GetUserByEmail(email string) (*models.User, error) {
 }
 
 func (db *DB) GetAllDevices(siteId string, buildingCode string) ([]models.EmergencyDevice, error) {
+	return db.GetDevicesByLocation(siteId, buildingCode, "")
+}
+
+// GetDevicesByLocation returns the devices at a site, building and floor, each of which
+// may be left blank to include them all
+func (db *DB) GetDevicesByLocation(siteId string, buildingCode string, floorId string) ([]models.EmergencyDevice, error) {
 	var query string
 	var args []interface{}
 
@@ -264,39 +273,48 @@ func (db *DB) GetAllDevices(siteId string, buildingCode string) ([]models.Emerge
 		edt.emergencydevicetypename,
 		et.extinguishertypename AS ExtinguisherTypeName,
 		r.roomcode,
+		f.floorid,
+		f.floorname,
 		b.buildingcode,
+		s.timezone,
 		ed.serialnumber,
 		ed.manufacturedate,
-		ed.LastInspectionDateTime AT TIME ZONE 'Pacific/Auckland' AS lastinspectiondatetime_nzdt,
+		ed.LastInspectionDateTime,
 		ed.description,
 		ed.size,
-		ed.status 
+		ed.status,
+		dm.modelname,
+		m.manufacturername,
+		ed.batchnumber,
+		ed.pinx,
+		ed.piny
 	FROM emergency_deviceT ed
 	JOIN roomT r ON ed.roomid = r.roomid
+	JOIN floorT f ON r.floorid = f.floorid
 	JOIN buildingT b ON r.buildingid = b.buildingid
+	JOIN siteT s ON b.siteid = s.siteid
 	LEFT JOIN emergency_device_typeT edt ON ed.emergencydevicetypeid = edt.emergencydevicetypeid
 	LEFT JOIN Extinguisher_TypeT et ON ed.extinguishertypeid = et.extinguishertypeid
+	LEFT JOIN device_modelT dm ON ed.devicemodelid = dm.devicemodelid
+	LEFT JOIN manufacturerT m ON dm.manufacturerid = m.manufacturerid
 	`
 
-	// Add filtering by site name and building code if provided
-	if siteId != "" && buildingCode != "" {
-		query += `
-		JOIN siteT s ON b.siteid = s.siteid
-		WHERE s.siteid = $1 AND b.buildingcode = $2
-		`
-		args = append(args, siteId, buildingCode)
-	} else if siteId != "" {
-		query += `
-		JOIN siteT s ON b.siteid = s.siteid
-		WHERE s.siteid = $1
-		`
+	// Add filtering by site, building code and floor if provided, devices of archived
+	// buildings are not listed
+	conditions := []string{"b.archivedat IS NULL"}
+	if siteId != "" {
 		args = append(args, siteId)
-	} else if buildingCode != "" {
-		query += `
-		WHERE b.buildingcode = $1
-		`
+		conditions = append(conditions, fmt.Sprintf("b.siteid = $%d", len(args)))
+	}
+	if buildingCode != "" {
 		args = append(args, buildingCode)
+		conditions = append(conditions, fmt.Sprintf("b.buildingcode = $%d", len(args)))
 	}
+	if floorId != "" {
+		args = append(args, floorId)
+		conditions = append(conditions, fmt.Sprintf("f.floorid = $%d", len(args)))
+	}
+	query += " WHERE " + strings.Join(conditions, " AND ")
 
 	// Prepare and execute the query
 	rows, err := db.Query(query, args...)
@@ -316,13 +334,21 @@ func (db *DB) GetAllDevices(siteId string, buildingCode string) ([]models.Emerge
 			&device.EmergencyDeviceTypeName,
 			&device.ExtinguisherTypeName,
 			&device.RoomCode,
+			&device.FloorID,
+			&device.FloorName,
 			&device.BuildingCode,
+			&device.SiteTimeZone,
 			&device.SerialNumber,
 			&device.ManufactureDate,
 			&device.LastInspectionDateTime,
 			&device.Description,
 			&device.Size,
 			&device.Status,
+			&device.ModelName,
+			&device.ManufacturerName,
+			&device.BatchNumber,
+			&device.PinX,
+			&device.PinY,
 		)
 		if err != nil {
 			return nil, err
@@ -350,51 +376,8 @@ func (db *DB) GetAllDevices(siteId string, buildingCode string) ([]models.Emerge
 			device.Status.Valid = false
 		}
 
-		// Handle dates (same as before)
-		if device.ManufactureDate.Valid {
-			expiryDate := device.ManufactureDate.Time.AddDate(5, 0, 0) // Hardcoded 5 years + manuafcture date
-			device.ExpireDate = sql.NullTime{
-				Time:  expiryDate,
-				Valid: true,
-			}
-			// if device type is not "Fire Extinguisher", set expire date to null
-			if device.EmergencyDeviceTypeName != "Fire Extinguisher" {
-				device.ExpireDate = sql.NullTime{
-					Time:  time.Time{},
-					Valid: false,
-				}
-			}
-		} else {
-			device.ManufactureDate = sql.NullTime{
-				Time:  time.Time{},
-				Valid: false,
-			}
-			device.ExpireDate = sql.NullTime{
-				Time:  time.Time{},
-				Valid: false,
-			}
-		}
-
-		// check if manufacture date is null or zero value, if true, set expire date to null
-		if device.ManufactureDate.Time.IsZero() {
-			device.ExpireDate = sql.NullTime{
-				Time:  time.Time{},
-				Valid: false,
-			}
-		}
-
-		if device.LastInspectionDateTime.Valid {
-			nextInspectionDate := device.LastInspectionDateTime.Time.AddDate(0, 3, 0)
-			device.NextInspectionDate = sql.NullTime{
-				Time:  nextInspectionDate,
-				Valid: true,
-			}
-		} else {
-			device.NextInspectionDate = sql.NullTime{
-				Time:  time.Time{},
-				Valid: false,
-			}
-		}
+		// Calculate the expiry and next inspection dates
+		calculateDeviceDates(&device)
 
 		emergencyDevices = append(emergencyDevices, device)
 	}
@@ -411,6 +394,58 @@ func (db *DB) GetAllDevices(siteId string, buildingCode string) ([]models.Emerge
 }
 
 // GetDeviceByID function
+// calculateDeviceDates sets the expiry date of fire extinguishers, five years after they
+// were manufactured, and the next inspection date, three months after the last inspection
+// at the device's site
+func calculateDeviceDates(device *models.EmergencyDevice) {
+	device.LastInspectionDateTime.Time = utils.InLocation(device.LastInspectionDateTime.Time, device.SiteTimeZone)
+
+	if device.ManufactureDate.Valid {
+		expiryDate := device.ManufactureDate.Time.AddDate(5, 0, 0) // Hardcoded 5 years + manuafcture date
+		device.ExpireDate = sql.NullTime{
+			Time:  expiryDate,
+			Valid: true,
+		}
+		// if device type is not "Fire Extinguisher", set expire date to null
+		if device.EmergencyDeviceTypeName != "Fire Extinguisher" {
+			device.ExpireDate = sql.NullTime{
+				Time:  time.Time{},
+				Valid: false,
+			}
+		}
+	} else {
+		device.ManufactureDate = sql.NullTime{
+			Time:  time.Time{},
+			Valid: false,
+		}
+		device.ExpireDate = sql.NullTime{
+			Time:  time.Time{},
+			Valid: false,
+		}
+	}
+
+	// check if manufacture date is null or zero value, if true, set expire date to null
+	if device.ManufactureDate.Time.IsZero() {
+		device.ExpireDate = sql.NullTime{
+			Time:  time.Time{},
+			Valid: false,
+		}
+	}
+
+	if device.LastInspectionDateTime.Valid {
+		nextInspectionDate := device.LastInspectionDateTime.Time.AddDate(0, 3, 0)
+		device.NextInspectionDate = sql.NullTime{
+			Time:  nextInspectionDate,
+			Valid: true,
+		}
+	} else {
+		device.NextInspectionDate = sql.NullTime{
+			Time:  time.Time{},
+			Valid: false,
+		}
+	}
+}
+
 func (db *DB) GetDeviceByID(deviceID int) (*models.EmergencyDevice, error) {
 	query := `
 	SELECT
@@ -421,22 +456,35 @@ func (db *DB) GetDeviceByID(deviceID int) (*models.EmergencyDevice, error) {
 		ed.extinguishertypeid,
 		ed.roomid,
 		r.roomcode,
+		f.floorid,
+		f.floorname,
 		b.buildingid,
 		b.buildingcode,
 		s.siteid,
 		s.sitename,
+		s.timezone,
+		b.archivedat IS NOT NULL,
 		ed.serialnumber,
 		ed.manufacturedate,
-		ed.LastInspectionDateTime AT TIME ZONE 'Pacific/Auckland' AS lastinspectiondatetime_nzdt,
+		ed.LastInspectionDateTime,
 		ed.description,
 		ed.size,
-		ed.status
+		ed.status,
+		ed.devicemodelid,
+		dm.modelname,
+		m.manufacturername,
+		ed.batchnumber,
+		ed.pinx,
+		ed.piny
 	FROM emergency_deviceT ed
 	JOIN emergency_device_typeT edt ON ed.emergencydevicetypeid = edt.emergencydevicetypeid
 	LEFT JOIN Extinguisher_TypeT et ON ed.extinguishertypeid = et.extinguishertypeid
 	JOIN roomT r ON ed.roomid = r.roomid
+	JOIN floorT f ON r.floorid = f.floorid
 	JOIN buildingT b ON r.buildingid = b.buildingid
 	JOIN siteT s ON b.siteid = s.siteid
+	LEFT JOIN device_modelT dm ON ed.devicemodelid = dm.devicemodelid
+	LEFT JOIN manufacturerT m ON dm.manufacturerid = m.manufacturerid
 	WHERE ed.emergencydeviceid = $1
 	`
 	var device models.EmergencyDevice
@@ -448,22 +496,35 @@ func (db *DB) GetDeviceByID(deviceID int) (*models.EmergencyDevice, error) {
 		&device.ExtinguisherTypeID,   // Extinguisher type ID (int, can be NULL)
 		&device.RoomID,
 		&device.RoomCode,
+		&device.FloorID,
+		&device.FloorName,
 		&device.BuildingID,
 		&device.BuildingCode,
 		&device.SiteID,
 		&device.SiteName,
+		&device.SiteTimeZone,
+		&device.BuildingArchived,
 		&device.SerialNumber,
 		&device.ManufactureDate,
 		&device.LastInspectionDateTime,
 		&device.Description,
 		&device.Size,
 		&device.Status,
+		&device.DeviceModelID,
+		&device.ModelName,
+		&device.ManufacturerName,
+		&device.BatchNumber,
+		&device.PinX,
+		&device.PinY,
 	)
 
 	if err != nil {
 		return nil, err
 	}
 
+	// Calculate the expiry and next inspection dates
+	calculateDeviceDates(&device)
+
 	return &device, nil
 }
 
@@ -481,12 +542,15 @@ func (db *DB) GetDevicesByRoomID(roomID int) ([]models.EmergencyDevice, error) {
 		b.buildingcode,
 		s.siteid,
 		s.sitename,
+		s.timezone,
 		ed.serialnumber,
 		ed.manufacturedate,
-		ed.LastInspectionDateTime AT TIME ZONE 'Pacific/Auckland' AS lastinspectiondatetime_nzdt,
+		ed.LastInspectionDateTime,
 		ed.description,
 		ed.size,
-		ed.status
+		ed.status,
+		ed.pinx,
+		ed.piny
 	FROM emergency_deviceT ed
 	JOIN emergency_device_typeT edt ON ed.emergencydevicetypeid = edt.emergencydevicetypeid
 	LEFT JOIN Extinguisher_TypeT et ON ed.extinguishertypeid = et.extinguishertypeid
@@ -519,16 +583,20 @@ func (db *DB) GetDevicesByRoomID(roomID int) ([]models.EmergencyDevice, error) {
 			&device.BuildingCode,
 			&device.SiteID,
 			&device.SiteName,
+			&device.SiteTimeZone,
 			&device.SerialNumber,
 			&device.ManufactureDate,
 			&device.LastInspectionDateTime,
 			&device.Description,
 			&device.Size,
 			&device.Status,
+			&device.PinX,
+			&device.PinY,
 		)
 		if err != nil {
 			return nil, err
 		}
+		device.LastInspectionDateTime.Time = utils.InLocation(device.LastInspectionDateTime.Time, device.SiteTimeZone)
 
 		emergencyDevices = append(emergencyDevices, device)
 	}
@@ -600,22 +668,33 @@ func (db *DB) GetAllExtinguisherTypes() ([]models.ExtinguisherType, error) {
 	return extinguisherTypes, nil
 }
 
-func (db *DB) GetAllRooms(buildingId string) ([]models.Room, error) {
+func (db *DB) GetAllRooms(buildingId string, floorId string) ([]models.Room, error) {
 	var query string
 	var args []interface{}
 
 	// Define the base query
-	query = ` SELECT r.roomid, r.buildingid, r.roomcode, b.buildingcode, s.sitename
+	query = ` SELECT r.roomid, r.buildingid, r.floorid, r.roomcode, b.buildingcode, f.floorname, s.sitename
               FROM roomT r
               JOIN buildingT b ON r.buildingid = b.buildingid
-              JOIN siteT s ON b.siteid = s.siteid`
-
-	// Add filtering by building code if provided
-	if buildingId != "" {
-		query += ` WHERE b.buildingId = $1`
+              JOIN floorT f ON r.floorid = f.floorid
+              JOIN siteT s ON b.siteid = s.siteid
+              WHERE b.archivedat IS NULL`
+
+	// Add filtering by building and floor if provided
+	if buildingId != "" && floorId != "" {
+		query += ` AND b.buildingId = $1 AND f.floorId = $2`
+		args = append(args, buildingId, floorId)
+	} else if buildingId != "" {
+		query += ` AND b.buildingId = $1`
 		args = append(args, buildingId)
+	} else if floorId != "" {
+		query += ` AND f.floorId = $1`
+		args = append(args, floorId)
 	}
 
+	// Rooms are listed floor by floor
+	query += ` ORDER BY s.sitename, b.buildingcode, f.floororder, r.roomcode`
+
 	// Prepare and execute the query
 	rows, err := db.Query(query, args...)
 	if err != nil {
@@ -632,9 +711,11 @@ func (db *DB) GetAllRooms(buildingId string) ([]models.Room, error) {
 		err := rows.Scan(
 			&room.RoomID,
 			&room.BuildingID,
+			&room.FloorID,
 			&room.RoomCode,
 			&room.BuildingCode, // Assuming you have added this field to the Room model
-			&room.SiteName,     // Assuming you have added this field to the Room model
+			&room.FloorName,
+			&room.SiteName, // Assuming you have added this field to the Room model
 		)
 		if err != nil {
 			return nil, err
@@ -649,14 +730,15 @@ func (db *DB) GetAllRooms(buildingId string) ([]models.Room, error) {
 func (db *DB) GetAllBuildings(siteId string) ([]models.Building, error) {
 	var args []interface{}
 	query := `
-    SELECT b.buildingid, b.buildingcode, b.siteid, s.sitename
+    SELECT b.buildingid, b.buildingcode, b.siteid, s.sitename, b.mapx, b.mapy, b.mappolygon, b.floorplanimagepath
     FROM buildingT b
     JOIN siteT s ON b.siteid = s.siteid
+    WHERE b.archivedat IS NULL
     `
 
 	// Add filtering by site name if provided
 	if siteId != "" {
-		query += ` WHERE s.siteid = $1`
+		query += ` AND s.siteid = $1`
 		args = append(args, siteId)
 	}
 
@@ -677,15 +759,23 @@ func (db *DB) GetAllBuildings(siteId string) ([]models.Building, error) {
 	// Scan the results
 	for rows.Next() {
 		var building models.Building
+		var polygon []byte
 		err := rows.Scan(
 			&building.BuildingID,
 			&building.BuildingCode,
 			&building.SiteID,
 			&building.SiteName, // Assuming you have added this field to the Building model
+			&building.MapX,
+			&building.MapY,
+			&polygon,
+			&building.FloorPlanImagePath,
 		)
 		if err != nil {
 			return nil, err
 		}
+		if building.MapPolygon, err = decodeMapPolygon(polygon); err != nil {
+			return nil, err
+		}
 
 		buildings = append(buildings, building)
 	}
@@ -695,21 +785,32 @@ func (db *DB) GetAllBuildings(siteId string) ([]models.Building, error) {
 
 func (db *DB) GetBuildingById(buildingID int) (*models.Building, error) {
 	query := `
-	SELECT buildingid, siteid, buildingcode
+	SELECT buildingid, siteid, buildingcode, mapx, mapy, mappolygon, floorplanimagepath, archivedat
 	FROM buildingT
 	WHERE buildingid = $1
 	`
 	var building models.Building
+	var polygon []byte
 	err := db.QueryRow(query, buildingID).Scan(
 		&building.BuildingID,
 		&building.SiteID,
 		&building.BuildingCode,
+		&building.MapX,
+		&building.MapY,
+		&polygon,
+		&building.FloorPlanImagePath,
+		&building.ArchivedAt,
 	)
 
 	if err != nil {
 		return nil, err
 	}
 
+	building.MapPolygon, err = decodeMapPolygon(polygon)
+	if err != nil {
+		return nil, err
+	}
+
 	return &building, nil
 }
 
@@ -735,7 +836,20 @@ func (db *DB) GetBuildingByCodeandSite(buildingCode string, siteId int) (*models
 }
 
 func (db *DB) AddBuilding(building *models.Building) error {
-	query := "INSERT INTO buildingT (siteId, buildingCode) VALUES ($1, $2)"
+	polygon, err := encodeMapPolygon(building.MapPolygon)
+	if err != nil {
+		return err
+	}
+
+	// The building is given its default floor, so rooms can be added to it straight away
+	query := `
+	WITH b AS (
+		INSERT INTO buildingT (siteId, buildingCode, mapX, mapY, mapPolygon) VALUES ($1, $2, $3, $4, $5)
+		RETURNING buildingId
+	)
+	INSERT INTO FloorT (buildingId, floorName, floorOrder)
+	SELECT buildingId, $6, 0 FROM b
+	`
 	insertStmt, err := db.Prepare(query)
 	if err != nil {
 		return err
@@ -743,7 +857,7 @@ func (db *DB) AddBuilding(building *models.Building) error {
 
 	defer insertStmt.Close()
 
-	_, err = insertStmt.Exec(building.SiteID, building.BuildingCode)
+	_, err = insertStmt.Exec(building.SiteID, building.BuildingCode, building.MapX, building.MapY, polygon, DefaultFloorName)
 
 	if err != nil {
 		return err
@@ -753,7 +867,12 @@ func (db *DB) AddBuilding(building *models.Building) error {
 }
 
 func (db *DB) UpdateBuilding(building *models.Building) error {
-	query := "UPDATE BuildingT SET siteId = $1, buildingCode = $2 WHERE buildingID = $3"
+	polygon, err := encodeMapPolygon(building.MapPolygon)
+	if err != nil {
+		return err
+	}
+
+	query := "UPDATE BuildingT SET siteId = $1, buildingCode = $2, mapX = $3, mapY = $4, mapPolygon = $5 WHERE buildingID = $6"
 	updateStmt, err := db.Prepare(query)
 	if err != nil {
 		return err
@@ -761,7 +880,7 @@ func (db *DB) UpdateBuilding(building *models.Building) error {
 
 	defer updateStmt.Close()
 
-	_, err = updateStmt.Exec(building.SiteID, building.BuildingCode, building.BuildingID)
+	_, err = updateStmt.Exec(building.SiteID, building.BuildingCode, building.MapX, building.MapY, polygon, building.BuildingID)
 
 	if err != nil {
 		return err
@@ -770,22 +889,22 @@ func (db *DB) UpdateBuilding(building *models.Building) error {
 	return nil
 }
 
+// DeleteBuilding deletes a building and its floors, which must have no rooms
 func (db *DB) DeleteBuilding(buildingID string) error {
-	query := "DELETE FROM BuildingT WHERE buildingID = $1"
-	deleteStmt, err := db.Prepare(query)
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	defer deleteStmt.Close()
-
-	_, err = deleteStmt.Exec(buildingID)
-
-	if err != nil {
+	if _, err := tx.Exec("DELETE FROM FloorT WHERE buildingID = $1", buildingID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM BuildingT WHERE buildingID = $1", buildingID); err != nil {
 		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
 func (db *DB) GetRoomsByBuildingID(buildingID string) ([]models.Room, error) {
@@ -823,7 +942,7 @@ func (db *DB) GetRoomsByBuildingID(buildingID string) ([]models.Room, error) {
 
 func (db *DB) GetAllSites() ([]models.Site, error) {
 	query := `
-	SELECT siteid, sitename, siteaddress
+	SELECT siteid, sitename, siteaddress, timezone
 	FROM siteT
 	ORDER BY sitename
 	`
@@ -844,6 +963,7 @@ func (db *DB) GetAllSites() ([]models.Site, error) {
 			&site.SiteID,
 			&site.SiteName,
 			&site.SiteAddress,
+			&site.TimeZone,
 		)
 		if err != nil {
 			return nil, err
@@ -858,7 +978,7 @@ func (db *DB) GetAllSites() ([]models.Site, error) {
 
 func (db *DB) GetSiteByID(siteID string) (*models.Site, error) {
 	query := `
-	SELECT siteid, sitename, siteaddress, sitemapimagepath
+	SELECT siteid, sitename, siteaddress, sitemapimagepath, timezone
 	FROM siteT
 	WHERE siteid = $1
 	`
@@ -868,6 +988,7 @@ func (db *DB) GetSiteByID(siteID string) (*models.Site, error) {
 		&site.SiteName,
 		&site.SiteAddress,
 		&site.SiteMapImagePath,
+		&site.TimeZone,
 	)
 
 	if err != nil {
@@ -880,7 +1001,7 @@ func (db *DB) GetSiteByID(siteID string) (*models.Site, error) {
 // Get site by name function
 func (db *DB) GetSiteByName(siteName string) (*models.Site, error) {
 	query := `
-	SELECT siteid, sitename, siteaddress, sitemapimagepath
+	SELECT siteid, sitename, siteaddress, sitemapimagepath, timezone
 	FROM siteT
 	WHERE sitename = $1
 	`
@@ -891,6 +1012,7 @@ func (db *DB) GetSiteByName(siteName string) (*models.Site, error) {
 		&site.SiteName,
 		&site.SiteAddress,
 		&site.SiteMapImagePath,
+		&site.TimeZone,
 	)
 
 	if err != nil {
@@ -901,7 +1023,7 @@ func (db *DB) GetSiteByName(siteName string) (*models.Site, error) {
 }
 
 func (db *DB) AddSite(site *models.Site) error {
-	query := "INSERT INTO SiteT (siteName, siteAddress, siteMapImagePath) VALUES ($1, $2, $3)"
+	query := "INSERT INTO SiteT (siteName, siteAddress, siteMapImagePath, timeZone) VALUES ($1, $2, $3, $4)"
 	insertStmt, err := db.Prepare(query)
 	if err != nil {
 		return err
@@ -909,7 +1031,7 @@ func (db *DB) AddSite(site *models.Site) error {
 
 	defer insertStmt.Close()
 
-	_, err = insertStmt.Exec(site.SiteName, site.SiteAddress, site.SiteMapImagePath)
+	_, err = insertStmt.Exec(site.SiteName, site.SiteAddress, site.SiteMapImagePath, site.TimeZone)
 
 	if err != nil {
 		return err
@@ -919,7 +1041,7 @@ func (db *DB) AddSite(site *models.Site) error {
 }
 
 func (db *DB) UpdateSite(site *models.Site) error {
-	query := "UPDATE SiteT SET siteName = $1, siteAddress = $2, siteMapImagePath = $3 WHERE siteID = $4"
+	query := "UPDATE SiteT SET siteName = $1, siteAddress = $2, siteMapImagePath = $3, timeZone = $4 WHERE siteID = $5"
 	updateStmt, err := db.Prepare(query)
 	if err != nil {
 		return err
@@ -927,7 +1049,62 @@ func (db *DB) UpdateSite(site *models.Site) error {
 
 	defer updateStmt.Close()
 
-	_, err = updateStmt.Exec(site.SiteName, site.SiteAddress, site.SiteMapImagePath, site.SiteID)
+	_, err = updateStmt.Exec(site.SiteName, site.SiteAddress, site.SiteMapImagePath, site.TimeZone, site.SiteID)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetSitesByMapPathPrefix returns the sites whose map path starts with prefix
+func (db *DB) GetSitesByMapPathPrefix(prefix string) ([]models.Site, error) {
+	query := `
+	SELECT siteid, sitename, siteaddress, sitemapimagepath
+	FROM siteT
+	WHERE sitemapimagepath LIKE $1 || '%'
+	ORDER BY sitename
+	`
+
+	rows, err := db.Query(query, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var sites []models.Site
+
+	// Scan the results
+	for rows.Next() {
+		var site models.Site
+		err := rows.Scan(
+			&site.SiteID,
+			&site.SiteName,
+			&site.SiteAddress,
+			&site.SiteMapImagePath,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		sites = append(sites, site)
+	}
+
+	return sites, nil
+}
+
+func (db *DB) UpdateSiteMapImagePath(siteID int, siteMapImagePath string) error {
+	query := "UPDATE SiteT SET siteMapImagePath = $1 WHERE siteID = $2"
+	updateStmt, err := db.Prepare(query)
+	if err != nil {
+		return err
+	}
+
+	defer updateStmt.Close()
+
+	_, err = updateStmt.Exec(siteMapImagePath, siteID)
 
 	if err != nil {
 		return err
@@ -994,9 +1171,10 @@ func (db *DB) GetRoomsBySiteID(siteID string) ([]models.Room, error) {
 
 func (db *DB) GetRoomByID(roomID int) (*models.Room, error) {
 	query := `
-	SELECT r.roomid, r.roomcode, b.buildingid,b.buildingcode, s.sitename, s.siteid
+	SELECT r.roomid, r.roomcode, b.buildingid,b.buildingcode, f.floorid, f.floorname, s.sitename, s.siteid
 	FROM roomT r
 	JOIN buildingT b ON r.buildingid = b.buildingid
+	JOIN floorT f ON r.floorid = f.floorid
 	JOIN siteT s ON b.siteid = s.siteid
 	WHERE r.roomid = $1
 	`
@@ -1007,6 +1185,8 @@ func (db *DB) GetRoomByID(roomID int) (*models.Room, error) {
 		&room.RoomCode,
 		&room.BuildingID,
 		&room.BuildingCode,
+		&room.FloorID,
+		&room.FloorName,
 		&room.SiteName,
 		&room.SiteID,
 	)
@@ -1068,7 +1248,7 @@ func (db *DB) GetRoomByCodeAndBuilding(roomCode string, buildingId int) (*models
 }
 
 func (db *DB) AddRoom(room *models.Room) error {
-	query := "INSERT INTO RoomT (buildingId, roomCode) VALUES ($1, $2)"
+	query := "INSERT INTO RoomT (buildingId, floorId, roomCode) VALUES ($1, $2, $3)"
 	insertStmt, err := db.Prepare(query)
 	if err != nil {
 		return err
@@ -1076,7 +1256,7 @@ func (db *DB) AddRoom(room *models.Room) error {
 
 	defer insertStmt.Close()
 
-	_, err = insertStmt.Exec(room.BuildingID, room.RoomCode)
+	_, err = insertStmt.Exec(room.BuildingID, room.FloorID, room.RoomCode)
 
 	if err != nil {
 		return err
@@ -1086,7 +1266,14 @@ func (db *DB) AddRoom(room *models.Room) error {
 }
 
 func (db *DB) UpdateRoom(room *models.Room) error {
-	query := "UPDATE RoomT SET buildingId = $1, roomCode = $2 WHERE roomID = $3"
+	// The room's devices are on a different plan when it moves floor, so their pins
+	// are cleared
+	query := `
+	WITH moved AS (
+		UPDATE emergency_deviceT SET pinX = NULL, pinY = NULL
+		WHERE roomID = $4 AND (SELECT floorId FROM RoomT WHERE roomID = $4) <> $2
+	)
+	UPDATE RoomT SET buildingId = $1, floorId = $2, roomCode = $3 WHERE roomID = $4`
 	updateStmt, err := db.Prepare(query)
 	if err != nil {
 		return err
@@ -1094,7 +1281,7 @@ func (db *DB) UpdateRoom(room *models.Room) error {
 
 	defer updateStmt.Close()
 
-	_, err = updateStmt.Exec(room.BuildingID, room.RoomCode, room.RoomID)
+	_, err = updateStmt.Exec(room.BuildingID, room.FloorID, room.RoomCode, room.RoomID)
 
 	if err != nil {
 		return err
@@ -1242,9 +1429,10 @@ func (db *DB) GetDevicesByTypeID(emergencyDeviceTypeID int) ([]models.EmergencyD
         b.buildingcode,
         s.siteid,
         s.sitename,
+        s.timezone,
         ed.serialnumber,
         ed.manufacturedate,
-        ed.LastInspectionDateTime AT TIME ZONE 'Pacific/Auckland' AS lastinspectiondatetime_nzdt,
+        ed.LastInspectionDateTime,
         ed.description,
         ed.size,
         ed.status
@@ -1277,6 +1465,7 @@ func (db *DB) GetDevicesByTypeID(emergencyDeviceTypeID int) ([]models.EmergencyD
 			&device.BuildingCode,
 			&device.SiteID,
 			&device.SiteName,
+			&device.SiteTimeZone,
 			&device.SerialNumber,
 			&device.ManufactureDate,
 			&device.LastInspectionDateTime,
@@ -1287,6 +1476,7 @@ func (db *DB) GetDevicesByTypeID(emergencyDeviceTypeID int) ([]models.EmergencyD
 		if err != nil {
 			return nil, err
 		}
+		device.LastInspectionDateTime.Time = utils.InLocation(device.LastInspectionDateTime.Time, device.SiteTimeZone)
 		devices = append(devices, device)
 	}
 	if err = rows.Err(); err != nil {
@@ -1318,8 +1508,8 @@ func (db *DB) GetExtinguisherTypeByID(extinguisherTypeID int) (*models.Extinguis
 
 func (db *DB) AddEmergencyDevice(device *models.EmergencyDevice) error {
 	query := `
-	INSERT INTO emergency_deviceT (emergencydevicetypeid, extinguishertypeid, roomid, serialnumber, manufacturedate, description, size, status)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	INSERT INTO emergency_deviceT (emergencydevicetypeid, extinguishertypeid, roomid, serialnumber, manufacturedate, description, size, status, devicemodelid, batchnumber)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 	`
 	insertStmt, err := db.Prepare(query)
 	if err != nil {
@@ -1337,6 +1527,8 @@ func (db *DB) AddEmergencyDevice(device *models.EmergencyDevice) error {
 		device.Description,
 		device.Size,
 		device.Status,
+		device.DeviceModelID,
+		device.BatchNumber,
 	)
 
 	if err != nil {
@@ -1347,10 +1539,13 @@ func (db *DB) AddEmergencyDevice(device *models.EmergencyDevice) error {
 }
 
 func (db *DB) UpdateEmergencyDevice(device *models.EmergencyDevice) error {
+	// A device moved to another floor is on a different plan, so its pin is cleared
 	query := `
 	UPDATE emergency_deviceT
-	SET emergencydevicetypeid = $1, extinguishertypeid = $2, roomid = $3, serialnumber = $4, manufacturedate = $5, description = $6, size = $7, status = $8
-	WHERE emergencydeviceid = $9
+	SET emergencydevicetypeid = $1, extinguishertypeid = $2, roomid = $3, serialnumber = $4, manufacturedate = $5, description = $6, size = $7, status = $8, devicemodelid = $9, batchnumber = $10,
+		pinx = CASE WHEN (SELECT floorid FROM roomT WHERE roomid = $3) = (SELECT floorid FROM roomT WHERE roomid = emergency_deviceT.roomid) THEN pinx END,
+		piny = CASE WHEN (SELECT floorid FROM roomT WHERE roomid = $3) = (SELECT floorid FROM roomT WHERE roomid = emergency_deviceT.roomid) THEN piny END
+	WHERE emergencydeviceid = $11
 	`
 	updateStmt, err := db.Prepare(query)
 	if err != nil {
@@ -1368,6 +1563,8 @@ func (db *DB) UpdateEmergencyDevice(device *models.EmergencyDevice) error {
 		device.Description,
 		device.Size,
 		device.Status,
+		device.DeviceModelID,
+		device.BatchNumber,
 		device.EmergencyDeviceID,
 	)
 
@@ -1398,14 +1595,23 @@ func (db *DB) DeleteEmergencyDevice(deviceID int) error {
 
 func (db *DB) GetAllInspectionsByDeviceID(deviceID int) ([]models.Inspection, error) {
 	query := `
-	SELECT edi.emergencydeviceinspectionid, edi.emergencydeviceid, ed.serialnumber, edi.userid, u.username, edi.inspectiondatetime AT TIME ZONE 'Pacific/Auckland' AS lastinspectiondate_nzdt, edi.createdat AT TIME ZONE 'Pacific/Auckland' AS createdat_nzdt,
+	SELECT edi.emergencydeviceinspectionid, edi.emergencydeviceid, ed.serialnumber, edi.userid, u.username, edi.inspectiondatetime, edi.createdat, s.timezone,
 		   edi.IsConspicuous, edi.IsAccessible, edi.IsAssignedLocation, edi.IsSignVisible, edi.IsAntiTamperDeviceIntact,
 		   edi.IsSupportBracketSecure, edi.AreOperatingInstructionsClear, edi.IsMaintenanceTagAttached,
 		   edi.isNoExternalDamage, edi.IsChargeGaugeNormal, edi.IsReplaced, edi.AreMaintenanceRecordsComplete, edi.WorkOrderRequired,
-		   edi.InspectionStatus, edi.Notes
+		   edi.InspectionStatus, edi.Notes, edi.ChecklistTemplateID, ct.templatename || ' v' || ct.version AS checklisttemplatename,
+		   edi.ComputedStatus, edi.OverriddenBy, ou.username AS overriddenbyname, edi.OverrideJustification,
+		   rev.action, rev.replacementinspectionid, prev.emergencydeviceinspectionid AS amendsinspectionid
 	FROM emergency_device_inspectionT edi
 	JOIN userT u ON edi.userid = u.userid
 	JOIN emergency_deviceT ed ON edi.emergencydeviceid = ed.emergencydeviceid
+	JOIN roomT r ON ed.roomid = r.roomid
+	JOIN buildingT b ON r.buildingid = b.buildingid
+	JOIN siteT s ON b.siteid = s.siteid
+	LEFT JOIN checklist_templateT ct ON edi.checklisttemplateid = ct.checklisttemplateid
+	LEFT JOIN userT ou ON edi.overriddenby = ou.userid
+	LEFT JOIN inspection_revisionT rev ON rev.emergencydeviceinspectionid = edi.emergencydeviceinspectionid
+	LEFT JOIN inspection_revisionT prev ON prev.replacementinspectionid = edi.emergencydeviceinspectionid
 	WHERE edi.emergencydeviceid = $1
 	ORDER BY edi.inspectiondatetime DESC
 	`
@@ -1429,6 +1635,7 @@ func (db *DB) GetAllInspectionsByDeviceID(deviceID int) ([]models.Inspection, er
 			&inspection.InspectorName, // Scans the `username` field into `InspectorName`
 			&inspection.InspectionDateTime,
 			&inspection.CreatedAt,
+			&inspection.SiteTimeZone,
 			&inspection.IsConspicuous,
 			&inspection.IsAccessible,
 			&inspection.IsAssignedLocation,
@@ -1444,10 +1651,20 @@ func (db *DB) GetAllInspectionsByDeviceID(deviceID int) ([]models.Inspection, er
 			&inspection.WorkOrderRequired,
 			&inspection.InspectionStatus,
 			&inspection.Notes,
+			&inspection.ChecklistTemplateID,
+			&inspection.ChecklistTemplateName,
+			&inspection.ComputedStatus,
+			&inspection.OverriddenBy,
+			&inspection.OverriddenByName,
+			&inspection.OverrideJustification,
+			&inspection.RevisionAction,
+			&inspection.ReplacedByID,
+			&inspection.AmendsInspectionID,
 		)
 		if err != nil {
 			return nil, err
 		}
+		inspectionTimesInSite(&inspection)
 
 		inspections = append(inspections, inspection)
 	}
@@ -1457,14 +1674,25 @@ func (db *DB) GetAllInspectionsByDeviceID(deviceID int) ([]models.Inspection, er
 
 func (db *DB) GetInspectionByID(inspectionID int) (*models.Inspection, error) {
 	query := `
-	SELECT edi.emergencydeviceinspectionid, edi.emergencydeviceid, ed.serialnumber, edi.userid, u.username, edi.inspectiondatetime AT TIME ZONE 'Pacific/Auckland' AS lastinspectiondate_nzdt, edi.createdat AT TIME ZONE 'Pacific/Auckland' AS createdat_nzdt,
+	SELECT edi.emergencydeviceinspectionid, edi.emergencydeviceid, ed.serialnumber, edi.userid, u.username, edi.inspectiondatetime, edi.createdat, s.timezone,
 		   edi.IsConspicuous, edi.IsAccessible, edi.IsAssignedLocation, edi.IsSignVisible, edi.IsAntiTamperDeviceIntact,
 		   edi.IsSupportBracketSecure, edi.AreOperatingInstructionsClear, edi.IsMaintenanceTagAttached,
 		   edi.isNoExternalDamage, edi.IsChargeGaugeNormal, edi.IsReplaced, edi.AreMaintenanceRecordsComplete, edi.WorkOrderRequired,
-		   edi.InspectionStatus, edi.Notes
+		   edi.InspectionStatus, edi.Notes, edi.ChecklistTemplateID, ct.templatename || ' v' || ct.version AS checklisttemplatename,
+		   edi.ComputedStatus, edi.OverriddenBy, ou.username AS overriddenbyname, edi.OverrideJustification,
+		   rev.action, rev.replacementinspectionid, prev.emergencydeviceinspectionid AS amendsinspectionid,
+		   edi.ClientUUID, edi.SignatureType, edi.SignedName, edi.AttestationText, edi.SignatureKey, edi.SignatureSHA256,
+		   edi.SignedAt, edi.ContentHash, edi.HashVersion
 	FROM emergency_device_inspectionT edi
 	JOIN userT u ON edi.userid = u.userid
 	JOIN emergency_deviceT ed ON edi.emergencydeviceid = ed.emergencydeviceid
+	JOIN roomT r ON ed.roomid = r.roomid
+	JOIN buildingT b ON r.buildingid = b.buildingid
+	JOIN siteT s ON b.siteid = s.siteid
+	LEFT JOIN checklist_templateT ct ON edi.checklisttemplateid = ct.checklisttemplateid
+	LEFT JOIN userT ou ON edi.overriddenby = ou.userid
+	LEFT JOIN inspection_revisionT rev ON rev.emergencydeviceinspectionid = edi.emergencydeviceinspectionid
+	LEFT JOIN inspection_revisionT prev ON prev.replacementinspectionid = edi.emergencydeviceinspectionid
 	WHERE edi.emergencydeviceinspectionid = $1
 	`
 
@@ -1477,6 +1705,7 @@ func (db *DB) GetInspectionByID(inspectionID int) (*models.Inspection, error) {
 		&inspection.InspectorName, // Scans the `username` field into `InspectorName`
 		&inspection.InspectionDateTime,
 		&inspection.CreatedAt,
+		&inspection.SiteTimeZone,
 		&inspection.IsConspicuous,
 		&inspection.IsAccessible,
 		&inspection.IsAssignedLocation,
@@ -1492,8 +1721,32 @@ func (db *DB) GetInspectionByID(inspectionID int) (*models.Inspection, error) {
 		&inspection.WorkOrderRequired,
 		&inspection.InspectionStatus,
 		&inspection.Notes,
+		&inspection.ChecklistTemplateID,
+		&inspection.ChecklistTemplateName,
+		&inspection.ComputedStatus,
+		&inspection.OverriddenBy,
+		&inspection.OverriddenByName,
+		&inspection.OverrideJustification,
+		&inspection.RevisionAction,
+		&inspection.ReplacedByID,
+		&inspection.AmendsInspectionID,
+		&inspection.ClientUUID,
+		&inspection.SignatureType,
+		&inspection.SignedName,
+		&inspection.AttestationText,
+		&inspection.SignatureKey,
+		&inspection.SignatureSHA256,
+		&inspection.SignedAt,
+		&inspection.ContentHash,
+		&inspection.HashVersion,
 	)
 
+	if err != nil {
+		return nil, err
+	}
+	inspectionTimesInSite(&inspection)
+
+	inspection.Responses, err = db.GetInspectionResponses(inspectionID)
 	if err != nil {
 		return nil, err
 	}
@@ -1501,45 +1754,91 @@ func (db *DB) GetInspectionByID(inspectionID int) (*models.Inspection, error) {
 	return &inspection, nil
 }
 
-func (db *DB) AddInspection(inspection *models.Inspection) error {
+// inspectionTimesInSite moves the times of an inspection into the time zone of its site
+func inspectionTimesInSite(inspection *models.Inspection) {
+	inspection.InspectionDateTime.Time = utils.InLocation(inspection.InspectionDateTime.Time, inspection.SiteTimeZone)
+	inspection.CreatedAt.Time = utils.InLocation(inspection.CreatedAt.Time, inspection.SiteTimeZone)
+}
 
-	query := `
-	INSERT INTO emergency_device_inspectionT (emergencydeviceid, userid, inspectiondatetime, IsConspicuous, IsAccessible, IsAssignedLocation, IsSignVisible, IsAntiTamperDeviceIntact, IsSupportBracketSecure, AreOperatingInstructionsClear, IsMaintenanceTagAttached, IsNoExternalDamage, IsChargeGaugeNormal, IsReplaced, AreMaintenanceRecordsComplete, WorkOrderRequired, InspectionStatus, Notes)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
-	`
-	insertStmt, err := db.Prepare(query)
+// AddInspection inserts the inspection and its checklist responses in one transaction
+// and returns the new inspection ID
+func (db *DB) AddInspection(inspection *models.Inspection, responses []models.InspectionResponse) (int, error) {
+	tx, err := db.Begin()
 	if err != nil {
-		return err
+		return 0, err
 	}
+	defer tx.Rollback()
 
-	defer insertStmt.Close()
+	inspectionID, err := insertInspection(tx, inspection, responses)
+	if err != nil {
+		return 0, err
+	}
 
-	_, err = insertStmt.Exec(
+	// The inspection completes the device on any open round it is waiting on
+	if err := completeRoundItems(tx, inspection.EmergencyDeviceID, inspectionID); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return inspectionID, nil
+}
+
+func insertInspection(tx *sql.Tx, inspection *models.Inspection, responses []models.InspectionResponse) (int, error) {
+	query := `
+	INSERT INTO emergency_device_inspectionT (emergencydeviceid, userid, inspectiondatetime, IsConspicuous, IsAccessible, IsAssignedLocation, IsSignVisible, IsAntiTamperDeviceIntact, IsSupportBracketSecure, AreOperatingInstructionsClear, IsMaintenanceTagAttached, IsNoExternalDamage, IsChargeGaugeNormal, IsReplaced, AreMaintenanceRecordsComplete, WorkOrderRequired, InspectionStatus, Notes, ChecklistTemplateID, ComputedStatus, OverriddenBy, OverrideJustification, ClientUUID,
+		SignatureType, SignedName, AttestationText, SignatureKey, SignatureSHA256, SignedAt, ContentHash, HashVersion)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31)
+	RETURNING emergencydeviceinspectionid
+	`
+
+	// The fixed checklist columns are only kept for inspections recorded before
+	// checklist templates, new answers are stored as responses
+	var inspectionID int
+	err := tx.QueryRow(query,
 		inspection.EmergencyDeviceID,
 		inspection.UserID,
 		inspection.InspectionDateTime,
-		inspection.IsConspicuous.Bool,
-		inspection.IsAccessible.Bool,
-		inspection.IsAssignedLocation.Bool,
-		inspection.IsSignVisible.Bool,
-		inspection.IsAntiTamperDeviceIntact.Bool,
-		inspection.IsSupportBracketSecure.Bool,
-		inspection.AreOperatingInstructionsClear.Bool,
-		inspection.IsMaintenanceTagAttached.Bool,
-		inspection.IsNoExternalDamage.Bool,
-		inspection.IsChargeGaugeNormal.Bool,
-		inspection.IsReplaced.Bool,
-		inspection.AreMaintenanceRecordsComplete.Bool,
+		inspection.IsConspicuous,
+		inspection.IsAccessible,
+		inspection.IsAssignedLocation,
+		inspection.IsSignVisible,
+		inspection.IsAntiTamperDeviceIntact,
+		inspection.IsSupportBracketSecure,
+		inspection.AreOperatingInstructionsClear,
+		inspection.IsMaintenanceTagAttached,
+		inspection.IsNoExternalDamage,
+		inspection.IsChargeGaugeNormal,
+		inspection.IsReplaced,
+		inspection.AreMaintenanceRecordsComplete,
 		inspection.WorkOrderRequired.Bool,
 		inspection.InspectionStatus,
 		inspection.Notes.String,
-	)
-
+		inspection.ChecklistTemplateID,
+		inspection.ComputedStatus,
+		inspection.OverriddenBy,
+		inspection.OverrideJustification,
+		inspection.ClientUUID,
+		inspection.SignatureType,
+		inspection.SignedName,
+		inspection.AttestationText,
+		inspection.SignatureKey,
+		inspection.SignatureSHA256,
+		inspection.SignedAt,
+		inspection.ContentHash,
+		inspection.HashVersion,
+	).Scan(&inspectionID)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	if err := addInspectionResponses(tx, inspectionID, responses); err != nil {
+		return 0, err
+	}
+
+	return inspectionID, nil
 }
 
 func (db *DB) UpdateDeviceStatus(deviceID int, status string) error {
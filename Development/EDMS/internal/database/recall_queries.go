@@ -0,0 +1,496 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+)
+
+// recallMatchCondition matches devices (ed, dm) against recalls (r). Serial numbers are
+// compared by length first so that "SN100" sorts after "SN99".
+const recallMatchCondition = `
+	r.manufacturerid = dm.manufacturerid
+	AND (r.devicemodelid IS NULL OR r.devicemodelid = ed.devicemodelid)
+	AND (r.batchnumber IS NULL OR r.batchnumber = ed.batchnumber)
+	AND (r.serialnumberfrom IS NULL OR (LENGTH(ed.serialnumber), ed.serialnumber) >= (LENGTH(r.serialnumberfrom), r.serialnumberfrom))
+	AND (r.serialnumberto IS NULL OR (LENGTH(ed.serialnumber), ed.serialnumber) <= (LENGTH(r.serialnumberto), r.serialnumberto))
+`
+
+func (db *DB) GetAllManufacturers() ([]models.Manufacturer, error) {
+	query := `
+	SELECT manufacturerid, manufacturername
+	FROM manufacturerT
+	ORDER BY manufacturername
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var manufacturers []models.Manufacturer
+
+	// Scan the results
+	for rows.Next() {
+		var manufacturer models.Manufacturer
+		err := rows.Scan(
+			&manufacturer.ManufacturerID,
+			&manufacturer.ManufacturerName,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		manufacturers = append(manufacturers, manufacturer)
+	}
+
+	return manufacturers, nil
+}
+
+func (db *DB) GetManufacturerByName(manufacturerName string) (*models.Manufacturer, error) {
+	query := `
+	SELECT manufacturerid, manufacturername
+	FROM manufacturerT
+	WHERE manufacturername = $1
+	`
+
+	var manufacturer models.Manufacturer
+	err := db.QueryRow(query, manufacturerName).Scan(
+		&manufacturer.ManufacturerID,
+		&manufacturer.ManufacturerName,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &manufacturer, nil
+}
+
+func (db *DB) AddManufacturer(manufacturerName string) error {
+	query := "INSERT INTO manufacturerT (manufacturername) VALUES ($1)"
+	insertStmt, err := db.Prepare(query)
+	if err != nil {
+		return err
+	}
+
+	defer insertStmt.Close()
+
+	_, err = insertStmt.Exec(manufacturerName)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db *DB) DeleteManufacturer(manufacturerID int) error {
+	query := "DELETE FROM manufacturerT WHERE manufacturerid = $1"
+	deleteStmt, err := db.Prepare(query)
+	if err != nil {
+		return err
+	}
+
+	defer deleteStmt.Close()
+
+	_, err = deleteStmt.Exec(manufacturerID)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db *DB) GetAllDeviceModels(manufacturerId string) ([]models.DeviceModel, error) {
+	var args []interface{}
+	query := `
+	SELECT dm.devicemodelid, dm.manufacturerid, m.manufacturername, dm.modelname
+	FROM device_modelT dm
+	JOIN manufacturerT m ON dm.manufacturerid = m.manufacturerid
+	`
+
+	// Add filtering by manufacturer if provided
+	if manufacturerId != "" {
+		query += ` WHERE dm.manufacturerid = $1`
+		args = append(args, manufacturerId)
+	}
+
+	query += ` ORDER BY m.manufacturername, dm.modelname`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deviceModels []models.DeviceModel
+
+	// Scan the results
+	for rows.Next() {
+		var deviceModel models.DeviceModel
+		err := rows.Scan(
+			&deviceModel.DeviceModelID,
+			&deviceModel.ManufacturerID,
+			&deviceModel.ManufacturerName,
+			&deviceModel.ModelName,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		deviceModels = append(deviceModels, deviceModel)
+	}
+
+	return deviceModels, nil
+}
+
+func (db *DB) GetDeviceModelByID(deviceModelID int) (*models.DeviceModel, error) {
+	query := `
+	SELECT dm.devicemodelid, dm.manufacturerid, m.manufacturername, dm.modelname
+	FROM device_modelT dm
+	JOIN manufacturerT m ON dm.manufacturerid = m.manufacturerid
+	WHERE dm.devicemodelid = $1
+	`
+
+	var deviceModel models.DeviceModel
+	err := db.QueryRow(query, deviceModelID).Scan(
+		&deviceModel.DeviceModelID,
+		&deviceModel.ManufacturerID,
+		&deviceModel.ManufacturerName,
+		&deviceModel.ModelName,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &deviceModel, nil
+}
+
+func (db *DB) AddDeviceModel(deviceModel *models.DeviceModel) error {
+	query := "INSERT INTO device_modelT (manufacturerid, modelname) VALUES ($1, $2)"
+	insertStmt, err := db.Prepare(query)
+	if err != nil {
+		return err
+	}
+
+	defer insertStmt.Close()
+
+	_, err = insertStmt.Exec(deviceModel.ManufacturerID, deviceModel.ModelName)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db *DB) DeleteDeviceModel(deviceModelID int) error {
+	query := "DELETE FROM device_modelT WHERE devicemodelid = $1"
+	deleteStmt, err := db.Prepare(query)
+	if err != nil {
+		return err
+	}
+
+	defer deleteStmt.Close()
+
+	_, err = deleteStmt.Exec(deviceModelID)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db *DB) GetAllRecalls() ([]models.Recall, error) {
+	query := `
+	SELECT r.recallid, r.manufacturerid, m.manufacturername, r.devicemodelid, dm.modelname,
+		   r.serialnumberfrom, r.serialnumberto, r.batchnumber, r.recalldate, r.actionrequired, r.isclosed,
+		   COUNT(dr.emergencydeviceid) AS affecteddevices,
+		   COUNT(dr.emergencydeviceid) FILTER (WHERE dr.resolvedat IS NULL) AS opendevices
+	FROM recallT r
+	JOIN manufacturerT m ON r.manufacturerid = m.manufacturerid
+	LEFT JOIN device_modelT dm ON r.devicemodelid = dm.devicemodelid
+	LEFT JOIN device_recallT dr ON r.recallid = dr.recallid
+	GROUP BY r.recallid, m.manufacturername, dm.modelname
+	ORDER BY r.recalldate DESC
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recalls []models.Recall
+
+	// Scan the results
+	for rows.Next() {
+		var recall models.Recall
+		err := rows.Scan(
+			&recall.RecallID,
+			&recall.ManufacturerID,
+			&recall.ManufacturerName,
+			&recall.DeviceModelID,
+			&recall.ModelName,
+			&recall.SerialNumberFrom,
+			&recall.SerialNumberTo,
+			&recall.BatchNumber,
+			&recall.RecallDate,
+			&recall.ActionRequired,
+			&recall.IsClosed,
+			&recall.AffectedDevices,
+			&recall.OpenDevices,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		recalls = append(recalls, recall)
+	}
+
+	return recalls, nil
+}
+
+func (db *DB) GetRecallByID(recallID int) (*models.Recall, error) {
+	query := `
+	SELECT r.recallid, r.manufacturerid, m.manufacturername, r.devicemodelid, dm.modelname,
+		   r.serialnumberfrom, r.serialnumberto, r.batchnumber, r.recalldate, r.actionrequired, r.isclosed
+	FROM recallT r
+	JOIN manufacturerT m ON r.manufacturerid = m.manufacturerid
+	LEFT JOIN device_modelT dm ON r.devicemodelid = dm.devicemodelid
+	WHERE r.recallid = $1
+	`
+
+	var recall models.Recall
+	err := db.QueryRow(query, recallID).Scan(
+		&recall.RecallID,
+		&recall.ManufacturerID,
+		&recall.ManufacturerName,
+		&recall.DeviceModelID,
+		&recall.ModelName,
+		&recall.SerialNumberFrom,
+		&recall.SerialNumberTo,
+		&recall.BatchNumber,
+		&recall.RecallDate,
+		&recall.ActionRequired,
+		&recall.IsClosed,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &recall, nil
+}
+
+// AddRecall inserts the recall and returns its new ID
+func (db *DB) AddRecall(recall *models.Recall) (int, error) {
+	query := `
+	INSERT INTO recallT (manufacturerid, devicemodelid, serialnumberfrom, serialnumberto, batchnumber, recalldate, actionrequired)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING recallid
+	`
+
+	var recallID int
+	err := db.QueryRow(query,
+		recall.ManufacturerID,
+		recall.DeviceModelID,
+		recall.SerialNumberFrom,
+		recall.SerialNumberTo,
+		recall.BatchNumber,
+		recall.RecallDate,
+		recall.ActionRequired,
+	).Scan(&recallID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return recallID, nil
+}
+
+func (db *DB) CloseRecall(recallID int) error {
+	query := "UPDATE recallT SET isclosed = TRUE WHERE recallid = $1"
+	updateStmt, err := db.Prepare(query)
+	if err != nil {
+		return err
+	}
+
+	defer updateStmt.Close()
+
+	_, err = updateStmt.Exec(recallID)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FlagRecalledDevices matches devices against open recalls, records each new match in
+// device_recallT and puts the device into the Recalled status. A recallID of 0 applies
+// every open recall. Devices that were already flagged by a recall are not flagged again,
+// so a resolved device stays resolved. A device still flagged by another recall keeps the
+// status it had before that recall, so resolving both restores it. Devices of an archived
+// building stay inactive, the flag is kept as the status they had before archiving. It
+// returns the IDs of the newly flagged devices.
+func (db *DB) FlagRecalledDevices(recallID int) ([]int, error) {
+	query := `
+	WITH matched AS (
+		SELECT ed.emergencydeviceid, r.recallid,
+			   CASE
+				   WHEN earliest.emergencydeviceid IS NOT NULL THEN earliest.previousstatus
+				   WHEN b.archivedat IS NOT NULL THEN COALESCE(ed.statusbeforearchive, ed.status)
+				   ELSE ed.status
+			   END AS status
+		FROM emergency_deviceT ed
+		JOIN roomT rm ON ed.roomid = rm.roomid
+		JOIN buildingT b ON rm.buildingid = b.buildingid
+		LEFT JOIN LATERAL (
+			SELECT dr.emergencydeviceid, dr.previousstatus
+			FROM device_recallT dr
+			WHERE dr.emergencydeviceid = ed.emergencydeviceid AND dr.resolvedat IS NULL
+			ORDER BY dr.flaggedat, dr.recallid
+			LIMIT 1
+		) earliest ON TRUE
+		JOIN device_modelT dm ON ed.devicemodelid = dm.devicemodelid
+		JOIN recallT r ON ` + recallMatchCondition + `
+		WHERE r.isclosed = FALSE AND ($1 = 0 OR r.recallid = $1)
+	), flagged AS (
+		INSERT INTO device_recallT (emergencydeviceid, recallid, previousstatus)
+		SELECT emergencydeviceid, recallid, status FROM matched
+		ON CONFLICT (emergencydeviceid, recallid) DO NOTHING
+		RETURNING emergencydeviceid
+	)
+	UPDATE emergency_deviceT ed
+	SET status = CASE WHEN b.archivedat IS NULL THEN 'Recalled' ELSE ed.status END,
+		statusbeforearchive = CASE WHEN b.archivedat IS NULL THEN ed.statusbeforearchive ELSE 'Recalled' END
+	FROM roomT rm
+	JOIN buildingT b ON rm.buildingid = b.buildingid
+	WHERE rm.roomid = ed.roomid
+	AND ed.emergencydeviceid IN (SELECT emergencydeviceid FROM flagged)
+	RETURNING ed.emergencydeviceid
+	`
+
+	rows, err := db.Query(query, recallID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deviceIDs []int
+	for rows.Next() {
+		var deviceID int
+		if err := rows.Scan(&deviceID); err != nil {
+			return nil, err
+		}
+		deviceIDs = append(deviceIDs, deviceID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deviceIDs, nil
+}
+
+func (db *DB) GetDevicesByRecallID(recallID int) ([]models.DeviceRecall, error) {
+	query := `
+	SELECT dr.emergencydeviceid, dr.recallid, ed.serialnumber, ed.batchnumber, r.roomcode, b.buildingcode, s.sitename,
+		   dr.previousstatus, dr.flaggedat, dr.resolvedat
+	FROM device_recallT dr
+	JOIN emergency_deviceT ed ON dr.emergencydeviceid = ed.emergencydeviceid
+	JOIN roomT r ON ed.roomid = r.roomid
+	JOIN buildingT b ON r.buildingid = b.buildingid
+	JOIN siteT s ON b.siteid = s.siteid
+	WHERE dr.recallid = $1
+	ORDER BY s.sitename, b.buildingcode, r.roomcode
+	`
+
+	rows, err := db.Query(query, recallID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deviceRecalls []models.DeviceRecall
+
+	// Scan the results
+	for rows.Next() {
+		var deviceRecall models.DeviceRecall
+		err := rows.Scan(
+			&deviceRecall.EmergencyDeviceID,
+			&deviceRecall.RecallID,
+			&deviceRecall.SerialNumber,
+			&deviceRecall.BatchNumber,
+			&deviceRecall.RoomCode,
+			&deviceRecall.BuildingCode,
+			&deviceRecall.SiteName,
+			&deviceRecall.PreviousStatus,
+			&deviceRecall.FlaggedAt,
+			&deviceRecall.ResolvedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		deviceRecalls = append(deviceRecalls, deviceRecall)
+	}
+
+	return deviceRecalls, nil
+}
+
+// ResolveDeviceRecall marks the device's recall action as done. The device leaves the
+// Recalled status only when no other recall is still open against it, returning to the
+// status it had before it was flagged. Devices of an archived building stay inactive.
+func (db *DB) ResolveDeviceRecall(deviceID int, recallID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var previousStatus sql.NullString
+	err = tx.QueryRow(`
+		UPDATE device_recallT
+		SET resolvedat = CURRENT_TIMESTAMP
+		WHERE emergencydeviceid = $1 AND recallid = $2 AND resolvedat IS NULL
+		RETURNING previousstatus
+	`, deviceID, recallID).Scan(&previousStatus)
+	if err != nil {
+		return err
+	}
+
+	// Devices of an archived building stay inactive, the status they return to is kept
+	// for when the building is back in use
+	_, err = tx.Exec(`
+		WITH restored AS (
+			SELECT CASE
+					   WHEN $2::VARCHAR IS NULL OR $2 = 'Recalled' THEN 'Active'
+					   ELSE $2
+				   END AS status
+		)
+		UPDATE emergency_deviceT ed
+		SET status = CASE WHEN b.archivedat IS NULL THEN restored.status ELSE 'Inactive' END,
+			statusbeforearchive = CASE
+									  WHEN b.archivedat IS NOT NULL AND ed.statusbeforearchive = 'Recalled' THEN restored.status
+									  ELSE ed.statusbeforearchive
+								  END
+		FROM restored, roomT r
+		JOIN buildingT b ON r.buildingid = b.buildingid
+		WHERE ed.emergencydeviceid = $1 AND r.roomid = ed.roomid
+		AND NOT EXISTS (
+			SELECT 1 FROM device_recallT
+			WHERE emergencydeviceid = $1 AND resolvedat IS NULL
+		)
+	`, deviceID, previousStatus)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -114,32 +114,60 @@ func createTriggerAndFunctionIfNotExists(db *sql.DB) error {
 	// Create the trigger function if it does not exist
 	if !functionExists {
 		createFunctionSQL := `
-		CREATE OR REPLACE FUNCTION update_device_status_on_inspection() 
-		RETURNS TRIGGER AS $$
+		CREATE OR REPLACE FUNCTION recompute_device_inspection_status(device_id INT)
+		RETURNS VOID AS $$
 		DECLARE
-			current_last_inspection_timestamp TIMESTAMP;
+			latest_inspection_timestamp TIMESTAMPTZ;
+			latest_inspection_status VARCHAR(20);
 			calculated_expire_date TIMESTAMP;
+			device_archived BOOLEAN;
+		BEGIN
+			SELECT edi.InspectionDateTime, edi.InspectionStatus INTO latest_inspection_timestamp, latest_inspection_status
+			FROM Emergency_Device_InspectionT edi
+			WHERE edi.EmergencyDeviceID = device_id
+			  AND NOT EXISTS (
+				  SELECT 1 FROM Inspection_RevisionT r
+				  WHERE r.EmergencyDeviceInspectionID = edi.EmergencyDeviceInspectionID
+			  )
+			ORDER BY edi.InspectionDateTime DESC, edi.EmergencyDeviceInspectionID DESC
+			LIMIT 1;
+
+			-- Calculate the expiration date as ManufactureDate + 5 years. Devices of an archived
+			-- building keep the status archiving gave them.
+			SELECT ed.ManufactureDate + INTERVAL '5 years', b.ArchivedAt IS NOT NULL
+			INTO calculated_expire_date, device_archived
+			FROM Emergency_DeviceT ed
+			JOIN RoomT r ON ed.RoomID = r.RoomID
+			JOIN BuildingT b ON r.BuildingID = b.BuildingID
+			WHERE ed.EmergencyDeviceID = device_id;
+
+			UPDATE Emergency_DeviceT
+			SET LastInspectionDateTime = latest_inspection_timestamp,
+				Status = CASE
+							WHEN Status = 'Recalled' OR device_archived THEN Status
+							WHEN latest_inspection_status = 'Failed' THEN 'Inspection Failed'
+							WHEN calculated_expire_date <= NOW() THEN 'Expired'
+							WHEN latest_inspection_status IN ('Passed', 'Passed with defects') THEN 'Active'
+							-- The failed inspection was voided and no other inspection is left
+							WHEN latest_inspection_status IS NULL AND Status = 'Inspection Failed' THEN 'Active'
+							ELSE Status
+						END
+			WHERE EmergencyDeviceID = device_id;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		CREATE OR REPLACE FUNCTION update_device_status_on_inspection()
+		RETURNS TRIGGER AS $$
+		DECLARE
+			current_last_inspection_timestamp TIMESTAMPTZ;
 		BEGIN
-			-- Retrieve the current last inspection timestamp and manufacture date for the device
-			SELECT LastInspectionDateTime, ManufactureDate INTO current_last_inspection_timestamp, calculated_expire_date
+			SELECT LastInspectionDateTime INTO current_last_inspection_timestamp
 			FROM Emergency_DeviceT
 			WHERE EmergencyDeviceID = NEW.EmergencyDeviceID;
-			
-			-- Calculate the expiration date as ManufactureDate + 5 years
-			calculated_expire_date := calculated_expire_date + INTERVAL '5 years';
 
-			-- Check if the new inspection timestamp is more recent than the current last inspection timestamp
+			-- An older inspection recorded late does not change the device
 			IF current_last_inspection_timestamp IS NULL OR NEW.InspectionDateTime > current_last_inspection_timestamp THEN
-				-- Determine the status based on inspection and expiration conditions
-				UPDATE Emergency_DeviceT
-				SET LastInspectionDateTime = NEW.InspectionDateTime,
-					Status = CASE 
-								WHEN NEW.InspectionStatus = 'Failed' THEN 'Inspection Failed'
-								WHEN calculated_expire_date <= NOW() THEN 'Expired'
-								WHEN NEW.InspectionStatus = 'Passed' THEN 'Active'
-								ELSE Status
-							END
-				WHERE EmergencyDeviceID = NEW.EmergencyDeviceID;
+				PERFORM recompute_device_inspection_status(NEW.EmergencyDeviceID);
 			END IF;
 
 			RETURN NEW;
@@ -238,15 +266,15 @@ func SeedData(db *sql.DB) {
 
 	// Insert Sites
 	err = db.QueryRow(`
-		INSERT INTO SiteT (SiteName, SiteAddress)
-		VALUES ('EIT Taradale', '501 Gloucester Street, Taradale, Napier 4112') RETURNING SiteID`).Scan(&siteID)
+		INSERT INTO SiteT (SiteName, SiteAddress, TimeZone)
+		VALUES ('EIT Taradale', '501 Gloucester Street, Taradale, Napier 4112', 'Pacific/Auckland') RETURNING SiteID`).Scan(&siteID)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	err = db.QueryRow(`
-			INSERT INTO SiteT (SiteName, SiteAddress, SiteMapImagePath)
-			VALUES ('EIT Hastings', '416 Heretaunga Street West, Hastings 4122', '/static/site_maps/EIT_Hastings.png') RETURNING SiteID`).Scan(&hastingsSiteID)
+			INSERT INTO SiteT (SiteName, SiteAddress, SiteMapImagePath, TimeZone)
+			VALUES ('EIT Hastings', '416 Heretaunga Street West, Hastings 4122', '/static/site_maps/EIT_Hastings.png', 'Pacific/Auckland') RETURNING SiteID`).Scan(&hastingsSiteID)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -310,22 +338,31 @@ func SeedData(db *sql.DB) {
 		log.Fatal(err)
 	}
 
+	// Insert a default floor for every building
+	_, err = db.Exec(`
+	INSERT INTO FloorT (BuildingID, FloorName, FloorOrder)
+	SELECT BuildingID, 'Ground', 0 FROM BuildingT
+	`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// Insert Rooms
 	err = db.QueryRow(`
-			INSERT INTO RoomT (BuildingID, RoomCode)
-			VALUES ($1, 'A1') RETURNING RoomID`, buildingIDA).Scan(&roomA1ID)
+			INSERT INTO RoomT (BuildingID, FloorID, RoomCode)
+			SELECT BuildingID, FloorID, 'A1' FROM FloorT WHERE BuildingID = $1 RETURNING RoomID`, buildingIDA).Scan(&roomA1ID)
 	if err != nil {
 		log.Fatal(err)
 	}
 	err = db.QueryRow(`
-			INSERT INTO RoomT (BuildingID, RoomCode)
-			VALUES ($1, 'B1') RETURNING RoomID`, buildingIDB).Scan(&roomB1ID)
+			INSERT INTO RoomT (BuildingID, FloorID, RoomCode)
+			SELECT BuildingID, FloorID, 'B1' FROM FloorT WHERE BuildingID = $1 RETURNING RoomID`, buildingIDB).Scan(&roomB1ID)
 	if err != nil {
 		log.Fatal(err)
 	}
 	err = db.QueryRow(`
-			INSERT INTO RoomT (BuildingID, RoomCode)
-			VALUES ($1, 'Main Room') RETURNING RoomID`, hastingsBuildingID).Scan(&hastingsMainRoomID)
+			INSERT INTO RoomT (BuildingID, FloorID, RoomCode)
+			SELECT BuildingID, FloorID, 'Main Room' FROM FloorT WHERE BuildingID = $1 RETURNING RoomID`, hastingsBuildingID).Scan(&hastingsMainRoomID)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -481,6 +518,42 @@ func SeedData(db *sql.DB) {
 		log.Fatal(err)
 	}
 
+	// Position the Taradale buildings on the site map, as the migration does for
+	// databases that already had them
+	_, err = db.Exec(`SELECT import_taradale_building_positions()`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Move the seeded inspections onto the default Fire Extinguisher checklist template
+	_, err = db.Exec(`SELECT migrate_legacy_inspections()`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Default escalation policy, as created by the escalation migration
+	_, err = db.Exec(`
+	WITH policy AS (
+		INSERT INTO Escalation_PolicyT (PolicyName)
+		SELECT 'Default'
+		WHERE NOT EXISTS (SELECT 1 FROM Escalation_PolicyT WHERE SiteID IS NULL AND EmergencyDeviceTypeID IS NULL)
+		RETURNING EscalationPolicyID
+	)
+	INSERT INTO Escalation_StepT (EscalationPolicyID, NotificationType, DaysAfter, Recipient)
+	SELECT policy.EscalationPolicyID, step.NotificationType, step.DaysAfter, step.Recipient
+	FROM policy
+	CROSS JOIN (VALUES
+		('Inspection Overdue', 0, 'Site Inspectors'),
+		('Inspection Overdue', 7, 'Site Managers'),
+		('Inspection Overdue', 30, 'Admins'),
+		('Inspection Failed', 0, 'Site Inspectors'),
+		('Inspection Failed', 7, 'Site Managers'),
+		('Inspection Failed', 30, 'Admins')
+	) AS step(NotificationType, DaysAfter, Recipient)`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// Create a temp file in .internal/ directory
 	tempFile, err := os.Create("internal/seed_complete")
 	if err != nil {
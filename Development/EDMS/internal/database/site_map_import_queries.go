@@ -0,0 +1,113 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+)
+
+// ErrRoomCodeInUse is returned when an imported room's code is already used by a room in
+// another building of the site
+var ErrRoomCodeInUse = errors.New("room code is already used at the site")
+
+// ApplySiteMapImport adds the buildings of an imported site map to the site, or moves
+// the site's buildings with the same code to their imported position, then adds the
+// rooms that the site does not have yet to the lowest floor of their building. Room codes
+// are unique across the site, so a room whose code another building already uses fails
+// the import with ErrRoomCodeInUse. Nothing is changed if any of it fails.
+func (db *DB) ApplySiteMapImport(siteID int, buildings []models.SiteMapImportBuilding, rooms []models.SiteMapImportRoom) (models.SiteMapImportResult, error) {
+	var result models.SiteMapImportResult
+
+	tx, err := db.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	for _, building := range buildings {
+		polygon, err := encodeMapPolygon(building.MapPolygon)
+		if err != nil {
+			return result, err
+		}
+
+		var buildingID int
+		err = tx.QueryRow(`
+		SELECT BuildingID FROM BuildingT WHERE SiteID = $1 AND BuildingCode = $2
+		`, siteID, building.BuildingCode).Scan(&buildingID)
+		switch {
+		case err == sql.ErrNoRows:
+			err = tx.QueryRow(`
+			INSERT INTO BuildingT (SiteID, BuildingCode, MapX, MapY, MapPolygon) VALUES ($1, $2, $3, $4, $5)
+			RETURNING BuildingID
+			`, siteID, building.BuildingCode, building.MapX, building.MapY, polygon).Scan(&buildingID)
+			if err != nil {
+				return result, err
+			}
+			if _, err := tx.Exec(`
+			INSERT INTO FloorT (BuildingID, FloorName, FloorOrder) VALUES ($1, $2, 0)
+			`, buildingID, DefaultFloorName); err != nil {
+				return result, err
+			}
+			result.BuildingsCreated++
+		case err != nil:
+			return result, err
+		default:
+			if _, err := tx.Exec(`
+			UPDATE BuildingT SET MapX = $1, MapY = $2, MapPolygon = $3 WHERE BuildingID = $4
+			`, building.MapX, building.MapY, polygon, buildingID); err != nil {
+				return result, err
+			}
+			result.BuildingsUpdated++
+		}
+	}
+
+	for _, room := range rooms {
+		var buildingID int
+		var floorID sql.NullInt64
+		err := tx.QueryRow(`
+		SELECT b.BuildingID,
+			   (SELECT f.FloorID FROM FloorT f WHERE f.BuildingID = b.BuildingID ORDER BY f.FloorOrder, f.FloorID LIMIT 1)
+		FROM BuildingT b
+		WHERE b.SiteID = $1 AND b.BuildingCode = $2
+		`, siteID, room.BuildingCode).Scan(&buildingID, &floorID)
+		if err == sql.ErrNoRows {
+			return result, fmt.Errorf("building %s of room %s is not at the site", room.BuildingCode, room.RoomCode)
+		} else if err != nil {
+			return result, err
+		}
+		if !floorID.Valid {
+			return result, fmt.Errorf("building %s has no floors", room.BuildingCode)
+		}
+
+		var usedBy string
+		err = tx.QueryRow(`
+		SELECT b.BuildingCode
+		FROM RoomT r
+		JOIN BuildingT b ON r.BuildingID = b.BuildingID
+		WHERE b.SiteID = $1 AND r.RoomCode = $2 AND r.BuildingID <> $3
+		LIMIT 1
+		`, siteID, room.RoomCode, buildingID).Scan(&usedBy)
+		if err == nil {
+			return result, fmt.Errorf("%w, room %s is in building %s", ErrRoomCodeInUse, room.RoomCode, usedBy)
+		} else if err != sql.ErrNoRows {
+			return result, err
+		}
+
+		res, err := tx.Exec(`
+		INSERT INTO RoomT (BuildingID, FloorID, RoomCode) VALUES ($1, $2, $3)
+		ON CONFLICT (BuildingID, RoomCode) DO NOTHING
+		`, buildingID, floorID.Int64, room.RoomCode)
+		if err != nil {
+			return result, err
+		}
+		created, err := res.RowsAffected()
+		if err != nil {
+			return result, err
+		}
+		result.RoomsCreated += int(created)
+	}
+
+	return result, tx.Commit()
+}
@@ -0,0 +1,223 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+)
+
+// GetSyncSnapshot returns the buildings, rooms, devices and checklists of a site, or of one
+// building in it, for an inspector to work offline. It is read in a single transaction so
+// GeneratedAt is no later than any change it includes.
+func (db *DB) GetSyncSnapshot(siteID int, buildingID sql.NullInt64) (*models.SyncSnapshot, error) {
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	snapshot := &models.SyncSnapshot{
+		Buildings:          []models.Building{},
+		Rooms:              []models.Room{},
+		Devices:            []models.EmergencyDevice{},
+		ChecklistTemplates: []models.ChecklistTemplate{},
+	}
+
+	err = tx.QueryRow(`
+	SELECT CURRENT_TIMESTAMP, siteid, sitename, siteaddress, timezone
+	FROM siteT
+	WHERE siteid = $1
+	`, siteID).Scan(
+		&snapshot.GeneratedAt,
+		&snapshot.Site.SiteID,
+		&snapshot.Site.SiteName,
+		&snapshot.Site.SiteAddress,
+		&snapshot.Site.TimeZone,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	buildingRows, err := tx.Query(`
+	SELECT b.buildingid, b.buildingcode, b.siteid
+	FROM buildingT b
+	WHERE b.siteid = $1 AND ($2::INT IS NULL OR b.buildingid = $2) AND b.archivedat IS NULL
+	ORDER BY b.buildingcode
+	`, siteID, buildingID)
+	if err != nil {
+		return nil, err
+	}
+	for buildingRows.Next() {
+		building := models.Building{SiteName: snapshot.Site.SiteName}
+		if err := buildingRows.Scan(&building.BuildingID, &building.BuildingCode, &building.SiteID); err != nil {
+			buildingRows.Close()
+			return nil, err
+		}
+		snapshot.Buildings = append(snapshot.Buildings, building)
+	}
+	buildingRows.Close()
+
+	roomRows, err := tx.Query(`
+	SELECT r.roomid, r.buildingid, r.roomcode, b.buildingcode, b.siteid
+	FROM roomT r
+	JOIN buildingT b ON r.buildingid = b.buildingid
+	WHERE b.siteid = $1 AND ($2::INT IS NULL OR b.buildingid = $2) AND b.archivedat IS NULL
+	ORDER BY b.buildingcode, r.roomcode
+	`, siteID, buildingID)
+	if err != nil {
+		return nil, err
+	}
+	for roomRows.Next() {
+		room := models.Room{SiteName: snapshot.Site.SiteName}
+		if err := roomRows.Scan(&room.RoomID, &room.BuildingID, &room.RoomCode, &room.BuildingCode, &room.SiteID); err != nil {
+			roomRows.Close()
+			return nil, err
+		}
+		snapshot.Rooms = append(snapshot.Rooms, room)
+	}
+	roomRows.Close()
+
+	deviceRows, err := tx.Query(`
+	SELECT
+		ed.emergencydeviceid,
+		ed.emergencydevicetypeid,
+		edt.emergencydevicetypename,
+		et.extinguishertypename,
+		ed.roomid,
+		r.roomcode,
+		b.buildingid,
+		b.buildingcode,
+		b.siteid,
+		ed.serialnumber,
+		ed.manufacturedate,
+		ed.LastInspectionDateTime,
+		ed.description,
+		ed.size,
+		ed.status,
+		dm.modelname,
+		m.manufacturername,
+		ed.batchnumber,
+		ed.updatedat
+	FROM emergency_deviceT ed
+	JOIN emergency_device_typeT edt ON ed.emergencydevicetypeid = edt.emergencydevicetypeid
+	LEFT JOIN Extinguisher_TypeT et ON ed.extinguishertypeid = et.extinguishertypeid
+	JOIN roomT r ON ed.roomid = r.roomid
+	JOIN buildingT b ON r.buildingid = b.buildingid
+	LEFT JOIN device_modelT dm ON ed.devicemodelid = dm.devicemodelid
+	LEFT JOIN manufacturerT m ON dm.manufacturerid = m.manufacturerid
+	WHERE b.siteid = $1 AND ($2::INT IS NULL OR b.buildingid = $2)
+	  AND COALESCE(ed.status, '') <> 'Inactive'
+	ORDER BY b.buildingcode, r.roomcode, ed.serialnumber
+	`, siteID, buildingID)
+	if err != nil {
+		return nil, err
+	}
+	deviceTypeIDs := []int{}
+	seenDeviceTypes := make(map[int]bool)
+	for deviceRows.Next() {
+		device := models.EmergencyDevice{SiteName: snapshot.Site.SiteName, SiteTimeZone: snapshot.Site.TimeZone}
+		err := deviceRows.Scan(
+			&device.EmergencyDeviceID,
+			&device.EmergencyDeviceTypeID,
+			&device.EmergencyDeviceTypeName,
+			&device.ExtinguisherTypeName,
+			&device.RoomID,
+			&device.RoomCode,
+			&device.BuildingID,
+			&device.BuildingCode,
+			&device.SiteID,
+			&device.SerialNumber,
+			&device.ManufactureDate,
+			&device.LastInspectionDateTime,
+			&device.Description,
+			&device.Size,
+			&device.Status,
+			&device.ModelName,
+			&device.ManufacturerName,
+			&device.BatchNumber,
+			&device.UpdatedAt,
+		)
+		if err != nil {
+			deviceRows.Close()
+			return nil, err
+		}
+		calculateDeviceDates(&device)
+		snapshot.Devices = append(snapshot.Devices, device)
+
+		if !seenDeviceTypes[device.EmergencyDeviceTypeID] {
+			seenDeviceTypes[device.EmergencyDeviceTypeID] = true
+			deviceTypeIDs = append(deviceTypeIDs, device.EmergencyDeviceTypeID)
+		}
+	}
+	deviceRows.Close()
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// Template versions never change once saved, so they can be read outside the snapshot
+	for _, deviceTypeID := range deviceTypeIDs {
+		template, err := db.GetLatestChecklistTemplate(deviceTypeID)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		snapshot.ChecklistTemplates = append(snapshot.ChecklistTemplates, *template)
+	}
+
+	return snapshot, nil
+}
+
+// GetInspectionByClientUUID returns the ID and status of an inspection uploaded by an
+// offline client
+func (db *DB) GetInspectionByClientUUID(clientUUID string) (int, string, error) {
+	query := `
+	SELECT emergencydeviceinspectionid, inspectionstatus
+	FROM emergency_device_inspectionT
+	WHERE clientuuid = $1
+	`
+
+	var inspectionID int
+	var status string
+	err := db.QueryRow(query, clientUUID).Scan(&inspectionID, &status)
+	return inspectionID, status, err
+}
+
+// GetSyncDeviceState returns the device as it is now and whether it was edited or
+// inspected since an offline snapshot was taken
+func (db *DB) GetSyncDeviceState(deviceID int, snapshotAt time.Time) (*models.SyncDeviceState, error) {
+	query := `
+	SELECT ed.emergencydeviceid, ed.roomid, r.roomcode, b.buildingcode, ed.status,
+		   ed.updatedat > $2 AS changed,
+		   EXISTS (
+			   SELECT 1
+			   FROM emergency_device_inspectionT edi
+			   WHERE edi.emergencydeviceid = ed.emergencydeviceid
+				 AND edi.createdat > $2
+				 AND NOT EXISTS (SELECT 1 FROM inspection_revisionT rev WHERE rev.emergencydeviceinspectionid = edi.emergencydeviceinspectionid)
+		   ) AS inspectedsince
+	FROM emergency_deviceT ed
+	JOIN roomT r ON ed.roomid = r.roomid
+	JOIN buildingT b ON r.buildingid = b.buildingid
+	WHERE ed.emergencydeviceid = $1
+	`
+
+	var state models.SyncDeviceState
+	err := db.QueryRow(query, deviceID, snapshotAt).Scan(
+		&state.EmergencyDeviceID,
+		&state.RoomID,
+		&state.RoomCode,
+		&state.BuildingCode,
+		&state.Status,
+		&state.Changed,
+		&state.InspectedSince,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
@@ -1,37 +1,85 @@
-CREATE OR REPLACE FUNCTION update_device_status_on_inspection() 
-RETURNS TRIGGER AS $$
+-- Sets the device's last inspection date and status from its latest inspection
+-- that has not been amended or voided
+CREATE OR REPLACE FUNCTION recompute_device_inspection_status(device_id INT)
+RETURNS VOID AS $$
 DECLARE
-    current_last_inspection_timestamp TIMESTAMP;
+    latest_inspection_timestamp TIMESTAMPTZ;
+    latest_inspection_status VARCHAR(20);
     calculated_expire_date TIMESTAMP;
+    device_archived BOOLEAN;
+BEGIN
+    SELECT edi.InspectionDateTime, edi.InspectionStatus INTO latest_inspection_timestamp, latest_inspection_status
+    FROM Emergency_Device_InspectionT edi
+    WHERE edi.EmergencyDeviceID = device_id
+      AND NOT EXISTS (
+          SELECT 1 FROM Inspection_RevisionT r
+          WHERE r.EmergencyDeviceInspectionID = edi.EmergencyDeviceInspectionID
+      )
+    ORDER BY edi.InspectionDateTime DESC, edi.EmergencyDeviceInspectionID DESC
+    LIMIT 1;
+
+    -- Calculate the expiration date as ManufactureDate + 5 years. Devices of an archived
+    -- building keep the status archiving gave them.
+    SELECT ed.ManufactureDate + INTERVAL '5 years', b.ArchivedAt IS NOT NULL
+    INTO calculated_expire_date, device_archived
+    FROM Emergency_DeviceT ed
+    JOIN RoomT r ON ed.RoomID = r.RoomID
+    JOIN BuildingT b ON r.BuildingID = b.BuildingID
+    WHERE ed.EmergencyDeviceID = device_id;
+
+    UPDATE Emergency_DeviceT
+    SET LastInspectionDateTime = latest_inspection_timestamp,
+        Status = CASE
+                    WHEN Status = 'Recalled' OR device_archived THEN Status
+                    WHEN latest_inspection_status = 'Failed' THEN 'Inspection Failed'
+                    WHEN calculated_expire_date <= NOW() THEN 'Expired'
+                    WHEN latest_inspection_status IN ('Passed', 'Passed with defects') THEN 'Active'
+                    -- The failed inspection was voided and no other inspection is left
+                    WHEN latest_inspection_status IS NULL AND Status = 'Inspection Failed' THEN 'Active'
+                    ELSE Status
+                END
+    WHERE EmergencyDeviceID = device_id;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION update_device_status_on_inspection()
+RETURNS TRIGGER AS $$
+DECLARE
+    current_last_inspection_timestamp TIMESTAMPTZ;
 BEGIN
-    -- Retrieve the current last inspection timestamp and manufacture date for the device
-    SELECT LastInspectionDateTime, ManufactureDate INTO current_last_inspection_timestamp, calculated_expire_date
+    SELECT LastInspectionDateTime INTO current_last_inspection_timestamp
     FROM Emergency_DeviceT
     WHERE EmergencyDeviceID = NEW.EmergencyDeviceID;
-    
-    -- Calculate the expiration date as ManufactureDate + 5 years
-    calculated_expire_date := calculated_expire_date + INTERVAL '5 years';
 
-    -- Check if the new inspection timestamp is more recent than the current last inspection timestamp
+    -- An older inspection recorded late does not change the device
     IF current_last_inspection_timestamp IS NULL OR NEW.InspectionDateTime > current_last_inspection_timestamp THEN
-        -- Determine the status based on inspection and expiration conditions
-        UPDATE Emergency_DeviceT
-        SET LastInspectionDateTime = NEW.InspectionDateTime,
-            Status = CASE 
-                        WHEN NEW.InspectionStatus = 'Failed' THEN 'Inspection Failed'
-                        WHEN calculated_expire_date <= NOW() THEN 'Expired'
-                        WHEN NEW.InspectionStatus = 'Passed' THEN 'Active'
-                        ELSE Status
-                    END
-        WHERE EmergencyDeviceID = NEW.EmergencyDeviceID;
+        PERFORM recompute_device_inspection_status(NEW.EmergencyDeviceID);
     END IF;
 
     RETURN NEW;
 END;
 $$ LANGUAGE plpgsql;
 
+CREATE OR REPLACE FUNCTION update_device_status_on_inspection_revision()
+RETURNS TRIGGER AS $$
+BEGIN
+    -- An amendment can move the inspection to another device, so recompute both
+    PERFORM recompute_device_inspection_status(edi.EmergencyDeviceID)
+    FROM Emergency_Device_InspectionT edi
+    WHERE edi.EmergencyDeviceInspectionID IN (NEW.EmergencyDeviceInspectionID, NEW.ReplacementInspectionID);
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
 -- Trigger to call the function after insert on Emergency_Device_InspectionT
 CREATE TRIGGER trg_update_device_status
 AFTER INSERT ON Emergency_Device_InspectionT
 FOR EACH ROW
 EXECUTE FUNCTION update_device_status_on_inspection();
+
+-- Trigger to recompute the device after an inspection is amended or voided
+CREATE TRIGGER trg_update_device_status_on_revision
+AFTER INSERT ON Inspection_RevisionT
+FOR EACH ROW
+EXECUTE FUNCTION update_device_status_on_inspection_revision();
@@ -0,0 +1,291 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/models"
+	"github.com/lib/pq"
+)
+
+// GetAllWebhookEndpoints returns every webhook endpoint, without their secrets
+func (db *DB) GetAllWebhookEndpoints() ([]models.WebhookEndpoint, error) {
+	rows, err := db.Query(`
+	SELECT webhookendpointid, description, url, events, active, createdat
+	FROM webhook_endpointT
+	ORDER BY webhookendpointid
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	endpoints := []models.WebhookEndpoint{}
+	for rows.Next() {
+		var endpoint models.WebhookEndpoint
+		err := rows.Scan(
+			&endpoint.WebhookEndpointID,
+			&endpoint.Description,
+			&endpoint.URL,
+			pq.Array(&endpoint.Events),
+			&endpoint.Active,
+			&endpoint.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	return endpoints, rows.Err()
+}
+
+// AddWebhookEndpoint saves a new endpoint and returns its ID
+func (db *DB) AddWebhookEndpoint(endpoint models.WebhookEndpoint) (int, error) {
+	var endpointID int
+	err := db.QueryRow(`
+	INSERT INTO webhook_endpointT (description, url, secret, events, active)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING webhookendpointid
+	`, endpoint.Description, endpoint.URL, endpoint.Secret, pq.Array(endpoint.Events), endpoint.Active).Scan(&endpointID)
+	return endpointID, err
+}
+
+// UpdateWebhookEndpoint changes an endpoint, keeping its secret. It returns
+// sql.ErrNoRows if there is no such endpoint.
+func (db *DB) UpdateWebhookEndpoint(endpoint models.WebhookEndpoint) error {
+	result, err := db.Exec(`
+	UPDATE webhook_endpointT
+	SET description = $2, url = $3, events = $4, active = $5
+	WHERE webhookendpointid = $1
+	`, endpoint.WebhookEndpointID, endpoint.Description, endpoint.URL, pq.Array(endpoint.Events), endpoint.Active)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(result)
+}
+
+// DeleteWebhookEndpoint removes an endpoint and its delivery log, it returns
+// sql.ErrNoRows if there is no such endpoint
+func (db *DB) DeleteWebhookEndpoint(endpointID int) error {
+	result, err := db.Exec(`DELETE FROM webhook_endpointT WHERE webhookendpointid = $1`, endpointID)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(result)
+}
+
+func requireRowsAffected(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DispatchWebhookEvents queues a delivery of each new event to every active endpoint
+// subscribed to it, and returns the number of deliveries queued
+func (db *DB) DispatchWebhookEvents() (int64, error) {
+	result, err := db.Exec(`
+	WITH events AS (
+		UPDATE webhook_eventT
+		SET dispatchedat = CURRENT_TIMESTAMP
+		WHERE dispatchedat IS NULL
+		RETURNING webhookeventid, eventtype, payload, createdat
+	)
+	INSERT INTO webhook_deliveryT (webhookendpointid, webhookeventid, eventtype, payload)
+	SELECT w.webhookendpointid, e.webhookeventid, e.eventtype,
+		   jsonb_build_object(
+			   'id', 'evt_' || e.webhookeventid,
+			   'event', e.eventtype,
+			   'created_at', e.createdat,
+			   'data', e.payload
+		   )
+	FROM events e
+	JOIN webhook_endpointT w ON w.active AND e.eventtype = ANY(w.events)
+	`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// AddWebhookPing queues a ping to an endpoint and returns the delivery ID, or
+// sql.ErrNoRows if there is no such endpoint
+func (db *DB) AddWebhookPing(endpointID int, eventType string) (int, error) {
+	var deliveryID int
+	err := db.QueryRow(`
+	INSERT INTO webhook_deliveryT (webhookendpointid, eventtype, payload)
+	SELECT webhookendpointid, $2::VARCHAR,
+		   jsonb_build_object('id', 'ping_' || webhookendpointid, 'event', $2::VARCHAR, 'created_at', CURRENT_TIMESTAMP, 'data', '{}'::JSONB)
+	FROM webhook_endpointT
+	WHERE webhookendpointid = $1
+	RETURNING webhookdeliveryid
+	`, endpointID, eventType).Scan(&deliveryID)
+	return deliveryID, err
+}
+
+const webhookDeliveryQuery = `
+	SELECT d.webhookdeliveryid, d.webhookendpointid, w.description, w.url, w.secret,
+		   d.webhookeventid, d.eventtype, d.payload, d.status, d.attempts,
+		   d.nextattemptat, d.createdat, d.deliveredat
+	FROM webhook_deliveryT d
+	JOIN webhook_endpointT w ON d.webhookendpointid = w.webhookendpointid
+	`
+
+func scanWebhookDelivery(row interface{ Scan(...any) error }) (models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	var payload []byte
+	err := row.Scan(
+		&delivery.WebhookDeliveryID,
+		&delivery.WebhookEndpointID,
+		&delivery.EndpointDescription,
+		&delivery.URL,
+		&delivery.Secret,
+		&delivery.WebhookEventID,
+		&delivery.EventType,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.CreatedAt,
+		&delivery.DeliveredAt,
+	)
+	delivery.Payload = payload
+	return delivery, err
+}
+
+func (db *DB) queryWebhookDeliveries(query string, args ...any) ([]models.WebhookDelivery, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// GetDueWebhookDeliveries returns pending deliveries whose next attempt is due, oldest first
+func (db *DB) GetDueWebhookDeliveries(limit int) ([]models.WebhookDelivery, error) {
+	return db.queryWebhookDeliveries(webhookDeliveryQuery+`
+	WHERE d.status = 'Pending' AND d.nextattemptat <= CURRENT_TIMESTAMP AND w.active
+	ORDER BY d.nextattemptat, d.webhookdeliveryid
+	LIMIT $1
+	`, limit)
+}
+
+// GetWebhookDeliveries returns the delivery log, latest first, optionally for one
+// endpoint or status. The dead-letter list is the deliveries with the Dead status.
+func (db *DB) GetWebhookDeliveries(endpointID int, status string, limit int) ([]models.WebhookDelivery, error) {
+	return db.queryWebhookDeliveries(webhookDeliveryQuery+`
+	WHERE ($1 = 0 OR d.webhookendpointid = $1)
+	  AND ($2 = '' OR d.status = $2)
+	ORDER BY d.createdat DESC, d.webhookdeliveryid DESC
+	LIMIT $3
+	`, endpointID, status, limit)
+}
+
+// GetWebhookDeliveryByID returns a delivery with its attempts, latest first
+func (db *DB) GetWebhookDeliveryByID(deliveryID int) (models.WebhookDelivery, error) {
+	delivery, err := scanWebhookDelivery(db.QueryRow(webhookDeliveryQuery+`WHERE d.webhookdeliveryid = $1`, deliveryID))
+	if err != nil {
+		return delivery, err
+	}
+
+	rows, err := db.Query(`
+	SELECT webhookdeliveryattemptid, webhookdeliveryid, attemptedat, responsestatus, responsebody, error, durationms
+	FROM webhook_delivery_attemptT
+	WHERE webhookdeliveryid = $1
+	ORDER BY attemptedat DESC, webhookdeliveryattemptid DESC
+	`, deliveryID)
+	if err != nil {
+		return delivery, err
+	}
+	defer rows.Close()
+
+	delivery.AttemptLog = []models.WebhookDeliveryAttempt{}
+	for rows.Next() {
+		var attempt models.WebhookDeliveryAttempt
+		err := rows.Scan(
+			&attempt.WebhookDeliveryAttemptID,
+			&attempt.WebhookDeliveryID,
+			&attempt.AttemptedAt,
+			&attempt.ResponseStatus,
+			&attempt.ResponseBody,
+			&attempt.Error,
+			&attempt.DurationMS,
+		)
+		if err != nil {
+			return delivery, err
+		}
+		delivery.AttemptLog = append(delivery.AttemptLog, attempt)
+	}
+
+	return delivery, rows.Err()
+}
+
+// RecordWebhookAttempt logs an attempt to deliver and moves the delivery on. A delivery
+// that succeeded is done, a failed one is retried at nextAttemptAt or dead-lettered when
+// dead is set.
+func (db *DB) RecordWebhookAttempt(attempt models.WebhookDeliveryAttempt, succeeded, dead bool, nextAttemptAt time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	INSERT INTO webhook_delivery_attemptT (webhookdeliveryid, responsestatus, responsebody, error, durationms)
+	VALUES ($1, $2, $3, $4, $5)
+	`, attempt.WebhookDeliveryID, attempt.ResponseStatus, attempt.ResponseBody, attempt.Error, attempt.DurationMS)
+	if err != nil {
+		return err
+	}
+
+	status := models.WebhookDeliveryStatusPending
+	if succeeded {
+		status = models.WebhookDeliveryStatusSucceeded
+	} else if dead {
+		status = models.WebhookDeliveryStatusDead
+	}
+
+	_, err = tx.Exec(`
+	UPDATE webhook_deliveryT
+	SET attempts = attempts + 1,
+		status = $2,
+		nextattemptat = $3,
+		deliveredat = CASE WHEN $4 THEN CURRENT_TIMESTAMP END
+	WHERE webhookdeliveryid = $1
+	`, attempt.WebhookDeliveryID, status, nextAttemptAt, succeeded)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RedeliverWebhook queues a delivery to be sent again straight away with a fresh set of
+// attempts, it returns sql.ErrNoRows if there is no such delivery
+func (db *DB) RedeliverWebhook(deliveryID int) error {
+	result, err := db.Exec(`
+	UPDATE webhook_deliveryT
+	SET status = 'Pending', attempts = 0, nextattemptat = CURRENT_TIMESTAMP, deliveredat = NULL
+	WHERE webhookdeliveryid = $1
+	`, deliveryID)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(result)
+}
@@ -0,0 +1,208 @@
+// Package events fans out the changes Postgres announces on the edms_events channel to
+// the clients streaming them. Any app instance may make a change, LISTEN/NOTIFY tells
+// every instance about it.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Channel the database triggers notify on
+const Channel = "edms_events"
+
+// Types of events
+const (
+	TypeDeviceStatusChanged  = "device.status_changed"
+	TypeInspectionCreated    = "inspection.created"
+	TypeNotificationsChanged = "notifications.changed"
+	// Sent after the connection to the database was lost, events may have been missed so
+	// clients should fetch everything again
+	TypeResync = "stream.resync"
+)
+
+// Event is a change announced by the database
+type Event struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+	// Set for events about one user only, such as them reading a notification
+	UserID int `json:"-"`
+}
+
+// Events buffered for each subscriber before further ones are dropped
+const subscriptionBuffer = 64
+
+// Subscription receives the events for one client until it is closed
+type Subscription struct {
+	C      <-chan Event
+	c      chan Event
+	userID int
+	// Set when an event was dropped, the client is sent a resync once there is room
+	lagging bool
+}
+
+// Broker listens for database notifications and passes them on to subscribers
+type Broker struct {
+	connStr string
+	logger  *log.Logger
+
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+	closed      bool
+	cancel      context.CancelFunc
+	done        chan struct{}
+}
+
+// NewBroker returns a broker that listens on the database at connStr once started
+func NewBroker(connStr string, logger *log.Logger) *Broker {
+	return &Broker{
+		connStr:     connStr,
+		logger:      logger,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe returns a subscription to the events the user may see
+func (b *Broker) Subscribe(userID int) *Subscription {
+	c := make(chan Event, subscriptionBuffer)
+	sub := &Subscription{C: c, c: c, userID: userID}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(c)
+		return sub
+	}
+	b.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe stops a subscription and closes its channel
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.c)
+	}
+}
+
+// Publish sends an event to the subscribers it is for. A subscriber that is not keeping
+// up misses events and is sent a resync instead.
+func (b *Broker) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscribers {
+		if event.UserID != 0 && event.UserID != sub.userID {
+			continue
+		}
+		if sub.lagging {
+			select {
+			case sub.c <- Event{Type: TypeResync, Data: json.RawMessage(`{}`)}:
+				sub.lagging = false
+			default:
+				continue
+			}
+		}
+		select {
+		case sub.c <- event:
+		default:
+			sub.lagging = true
+		}
+	}
+}
+
+// publishNotification publishes the JSON payload of a database notification
+func (b *Broker) publishNotification(payload string) {
+	var message struct {
+		Type   string          `json:"type"`
+		UserID *int            `json:"user_id"`
+		Data   json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(payload), &message); err != nil || message.Type == "" {
+		b.logger.Printf("Ignoring malformed %s notification: %q", Channel, payload)
+		return
+	}
+
+	event := Event{Type: message.Type, Data: message.Data}
+	if message.UserID != nil {
+		event.UserID = *message.UserID
+	}
+	if len(event.Data) == 0 {
+		event.Data = json.RawMessage(`{}`)
+	}
+	b.Publish(event)
+}
+
+// Start listens for notifications until Stop is called, reconnecting if the connection
+// to the database is lost
+func (b *Broker) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	b.mu.Lock()
+	b.cancel = cancel
+	b.done = make(chan struct{})
+	b.mu.Unlock()
+
+	go func() {
+		defer close(b.done)
+		b.listen(ctx)
+	}()
+}
+
+func (b *Broker) listen(ctx context.Context) {
+	listener := pq.NewListener(b.connStr, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			b.logger.Printf("Lost connection listening for %s: %v", Channel, err)
+		case pq.ListenerEventConnectionAttemptFailed:
+			b.logger.Printf("Error listening for %s: %v", Channel, err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(Channel); err != nil {
+		b.logger.Printf("Error listening for %s: %v", Channel, err)
+	}
+
+	// Pinging an idle connection finds out sooner if it was lost
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification := <-listener.Notify:
+			// A nil notification means the connection was re-established
+			if notification == nil {
+				b.Publish(Event{Type: TypeResync, Data: json.RawMessage(`{}`)})
+				continue
+			}
+			b.publishNotification(notification.Extra)
+		case <-ping.C:
+			go listener.Ping()
+		}
+	}
+}
+
+// Stop stops listening and closes every subscription, so the streams using them end
+func (b *Broker) Stop() {
+	b.mu.Lock()
+	cancel, done := b.cancel, b.done
+	b.closed = true
+	for sub := range b.subscribers {
+		delete(b.subscribers, sub)
+		close(sub.c)
+	}
+	b.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
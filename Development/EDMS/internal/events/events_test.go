@@ -0,0 +1,50 @@
+package events
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishNotificationRoutesByUser(t *testing.T) {
+	b := NewBroker("", log.New(io.Discard, "", 0))
+	alice := b.Subscribe(1)
+	bob := b.Subscribe(2)
+
+	b.publishNotification(`{"type":"device.status_changed","user_id":null,"data":{"emergency_device_id":7,"status":"Expired"}}`)
+	b.publishNotification(`{"type":"notifications.changed","user_id":2,"data":{}}`)
+	b.publishNotification(`not json`)
+
+	event := <-alice.C
+	assert.Equal(t, TypeDeviceStatusChanged, event.Type)
+	assert.JSONEq(t, `{"emergency_device_id":7,"status":"Expired"}`, string(event.Data))
+	assert.Empty(t, alice.C)
+
+	assert.Equal(t, TypeDeviceStatusChanged, (<-bob.C).Type)
+	assert.Equal(t, TypeNotificationsChanged, (<-bob.C).Type)
+	assert.Empty(t, bob.C)
+
+	b.Stop()
+	_, ok := <-alice.C
+	assert.False(t, ok, "subscriptions are closed when the broker stops")
+}
+
+func TestPublishResyncsLaggingSubscriber(t *testing.T) {
+	b := NewBroker("", log.New(io.Discard, "", 0))
+	sub := b.Subscribe(1)
+
+	for i := 0; i < subscriptionBuffer+5; i++ {
+		b.Publish(Event{Type: TypeInspectionCreated})
+	}
+	for i := 0; i < subscriptionBuffer; i++ {
+		<-sub.C
+	}
+	require.Empty(t, sub.C)
+
+	b.Publish(Event{Type: TypeInspectionCreated})
+	assert.Equal(t, TypeResync, (<-sub.C).Type)
+	assert.Equal(t, TypeInspectionCreated, (<-sub.C).Type)
+}
@@ -0,0 +1,129 @@
+// Package ical writes iCalendar (RFC 5545) feeds of all-day events, the format calendar
+// apps subscribe to.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Calendar is a feed of events
+type Calendar struct {
+	Name string
+	// How often subscribers are asked to fetch the feed again
+	RefreshInterval time.Duration
+	Events          []Event
+}
+
+// Event is an all-day event
+type Event struct {
+	// Stays the same while the event is in the feed, so apps update it rather than
+	// adding a copy
+	UID         string
+	Date        time.Time // Only the date is used
+	Summary     string
+	Location    string
+	Description string
+	URL         string
+}
+
+// Lines are folded at this many octets, not counting the line break
+const maxLineLength = 75
+
+// Write writes the calendar, stamped with the time it was generated
+func (cal Calendar) Write(w io.Writer, now time.Time) error {
+	bw := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeFolded(bw, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//EDMS//Inspections//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if cal.Name != "" {
+		line("X-WR-CALNAME", escapeText(cal.Name))
+	}
+	if cal.RefreshInterval > 0 {
+		interval := formatDuration(cal.RefreshInterval)
+		line("REFRESH-INTERVAL;VALUE=DURATION", interval)
+		line("X-PUBLISHED-TTL", interval)
+	}
+
+	stamp := now.UTC().Format("20060102T150405Z")
+	for _, event := range cal.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", escapeText(event.UID))
+		line("DTSTAMP", stamp)
+		line("DTSTART;VALUE=DATE", event.Date.Format("20060102"))
+		line("DTEND;VALUE=DATE", event.Date.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY", escapeText(event.Summary))
+		if event.Location != "" {
+			line("LOCATION", escapeText(event.Location))
+		}
+		if event.Description != "" {
+			line("DESCRIPTION", escapeText(event.Description))
+		}
+		if event.URL != "" {
+			line("URL;VALUE=URI", event.URL)
+		}
+		line("TRANSP", "TRANSPARENT")
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+
+	return bw.Flush()
+}
+
+// formatDuration formats a duration to the minute, such as PT1H30M
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	hours, minutes := int(d.Hours()), int(d.Minutes())%60
+	value := "PT"
+	if hours > 0 {
+		value += strconv.Itoa(hours) + "H"
+	}
+	if minutes > 0 || hours == 0 {
+		value += strconv.Itoa(minutes) + "M"
+	}
+	return value
+}
+
+// escapeText escapes a TEXT value
+func escapeText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", "",
+	).Replace(s)
+}
+
+// writeFolded writes a content line, folding it onto continuation lines that start with
+// a space. Lines are only broken between UTF-8 characters.
+func writeFolded(w *bufio.Writer, line string) {
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		// The leading space counts towards the continuation line's length
+		limit = maxLineLength - 1
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,53 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	cal := Calendar{
+		Name:            "EDMS inspections",
+		RefreshInterval: time.Hour,
+		Events: []Event{{
+			UID:         "inspection-7-20241201@edms",
+			Date:        time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC),
+			Summary:     "Inspection due: Fire Extinguisher",
+			Location:    "EIT Taradale, Building A, Room A1",
+			Description: "Status: Active\nSerial number: FE-001; batch 3",
+			URL:         "http://localhost:8080/dashboard?device=7",
+		}},
+	}
+
+	var b strings.Builder
+	require.NoError(t, cal.Write(&b, time.Date(2024, 11, 18, 9, 30, 0, 0, time.UTC)))
+	out := b.String()
+
+	assert.True(t, strings.HasPrefix(out, "BEGIN:VCALENDAR\r\n"))
+	assert.True(t, strings.HasSuffix(out, "END:VCALENDAR\r\n"))
+	assert.Contains(t, out, "REFRESH-INTERVAL;VALUE=DURATION:PT1H\r\n")
+	assert.Contains(t, out, "DTSTAMP:20241118T093000Z\r\n")
+	assert.Contains(t, out, "DTSTART;VALUE=DATE:20241201\r\nDTEND;VALUE=DATE:20241202\r\n")
+	assert.Contains(t, out, `LOCATION:EIT Taradale\, Building A\, Room A1`)
+	assert.Contains(t, out, `DESCRIPTION:Status: Active\nSerial number: FE-001\; batch 3`)
+}
+
+func TestWriteFoldsLongLines(t *testing.T) {
+	cal := Calendar{Events: []Event{{
+		UID:     "1",
+		Summary: strings.Repeat("Ā", 60), // Two octets each
+	}}}
+
+	var b strings.Builder
+	require.NoError(t, cal.Write(&b, time.Now()))
+
+	for _, line := range strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), maxLineLength)
+	}
+	unfolded := strings.ReplaceAll(b.String(), "\r\n ", "")
+	assert.Contains(t, unfolded, "SUMMARY:"+strings.Repeat("Ā", 60)+"\r\n")
+}
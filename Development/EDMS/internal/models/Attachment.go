@@ -0,0 +1,24 @@
+package models
+
+import "database/sql"
+
+// AttachmentT represents a photo or document uploaded against a device, an inspection or
+// the work order an inspection raised
+type Attachment struct {
+	AttachmentID                int            `json:"attachment_id"`
+	EmergencyDeviceID           sql.NullInt64  `json:"emergency_device_id"`
+	EmergencyDeviceInspectionID sql.NullInt64  `json:"emergency_device_inspection_id"`
+	WorkOrderInspectionID       sql.NullInt64  `json:"work_order_inspection_id"` // Inspection that raised the work order
+	FileName                    string         `json:"file_name"`
+	ContentType                 string         `json:"content_type"`
+	SizeBytes                   int64          `json:"size_bytes"`
+	StorageKey                  string         `json:"-"`
+	ThumbnailKey                sql.NullString `json:"-"`
+	HasThumbnail                bool           `json:"has_thumbnail"` // Calculated
+	Description                 sql.NullString `json:"description"`
+	UploadedBy                  int            `json:"uploaded_by"`
+	UploaderName                string         `json:"uploader_name"`
+	UploadedAt                  sql.NullTime   `json:"uploaded_at"`
+	SHA256                      sql.NullString `json:"-"`         // Hash of the file, set on upload
+	IsAnswer                    bool           `json:"is_answer"` // A checklist photo answer, kept with the inspection
+}
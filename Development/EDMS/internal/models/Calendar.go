@@ -0,0 +1,23 @@
+package models
+
+import "database/sql"
+
+// Calendar_FeedT represents a user's calendar feed, fetched with the token in its URL
+type CalendarFeed struct {
+	UserID        int          `json:"user_id"`
+	Token         string       `json:"-"`
+	CreatedAt     sql.NullTime `json:"created_at"`
+	LastFetchedAt sql.NullTime `json:"last_fetched_at"`
+}
+
+// CalendarSettings are the sites a user follows and the URL of their feed, empty if
+// they have not set one up
+type CalendarSettings struct {
+	FeedURL       string       `json:"feed_url"`
+	SiteIDs       []int        `json:"site_ids"`
+	LastFetchedAt sql.NullTime `json:"last_fetched_at"`
+}
+
+type CalendarSettingsDto struct {
+	SiteIDs []int `json:"site_ids"`
+}
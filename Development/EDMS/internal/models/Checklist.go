@@ -0,0 +1,74 @@
+package models
+
+import "database/sql"
+
+// Answer types a checklist question can ask for
+const (
+	AnswerTypeYesNoNA = "YesNoNA"
+	AnswerTypeNumber  = "Number"
+	AnswerTypeText    = "Text"
+	AnswerTypePhoto   = "Photo"
+)
+
+// Severities of a checklist question. A critical question answered "No" fails the
+// inspection, an advisory one passes it with defects and an informational one is only
+// recorded.
+const (
+	SeverityCritical      = "Critical"
+	SeverityAdvisory      = "Advisory"
+	SeverityInformational = "Informational"
+)
+
+// Checklist_TemplateT represents one version of the inspection questions for a device type
+type ChecklistTemplate struct {
+	ChecklistTemplateID     int                 `json:"checklist_template_id"`
+	EmergencyDeviceTypeID   int                 `json:"emergency_device_type_id"`
+	EmergencyDeviceTypeName string              `json:"emergency_device_type_name"`
+	TemplateName            string              `json:"template_name"`
+	Version                 int                 `json:"version"`
+	CreatedBy               sql.NullInt64       `json:"created_by"`
+	CreatedAt               sql.NullTime        `json:"created_at"`
+	InspectionCount         int                 `json:"inspection_count"` // Calculated
+	Questions               []ChecklistQuestion `json:"questions,omitempty"`
+}
+
+// Checklist_QuestionT represents a question of a checklist template
+type ChecklistQuestion struct {
+	ChecklistQuestionID int    `json:"checklist_question_id"`
+	ChecklistTemplateID int    `json:"checklist_template_id"`
+	SortOrder           int    `json:"sort_order"`
+	QuestionText        string `json:"question_text"`
+	AnswerType          string `json:"answer_type"`
+	IsRequired          bool   `json:"is_required"`
+	Severity            string `json:"severity"`
+}
+
+type ChecklistTemplateDto struct {
+	EmergencyDeviceTypeID string                 `json:"emergency_device_type_id"`
+	TemplateName          string                 `json:"template_name"`
+	Questions             []ChecklistQuestionDto `json:"questions"`
+}
+
+type ChecklistQuestionDto struct {
+	QuestionText string `json:"question_text"`
+	AnswerType   string `json:"answer_type"`
+	IsRequired   bool   `json:"is_required"`
+	Severity     string `json:"severity"` // Defaults to Critical
+}
+
+// Inspection_ResponseT represents the answer to one checklist question of an inspection
+type InspectionResponse struct {
+	InspectionResponseID        int             `json:"inspection_response_id"`
+	EmergencyDeviceInspectionID int             `json:"emergency_device_inspection_id"`
+	ChecklistQuestionID         int             `json:"checklist_question_id"`
+	SortOrder                   int             `json:"sort_order"`
+	QuestionText                string          `json:"question_text"`
+	AnswerType                  string          `json:"answer_type"`
+	Severity                    string          `json:"severity"`
+	AnswerYesNo                 sql.NullString  `json:"answer_yes_no"`
+	AnswerNumber                sql.NullFloat64 `json:"answer_number"`
+	AnswerText                  sql.NullString  `json:"answer_text"`
+	AttachmentID                sql.NullInt64   `json:"attachment_id"`
+	PhotoSHA256                 sql.NullString  `json:"photo_sha256"` // From attachmentT table
+	Photo                       *Attachment     `json:"-"`            // Set when saving a photo answer
+}
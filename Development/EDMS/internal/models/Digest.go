@@ -0,0 +1,48 @@
+package models
+
+import "database/sql"
+
+// How often a digest is sent
+const (
+	DigestFrequencyDaily  = "Daily"
+	DigestFrequencyWeekly = "Weekly"
+)
+
+// Digest_SubscriptionT represents a user's email digest settings
+type DigestSubscription struct {
+	UserID       int            `json:"user_id"`
+	Username     string         `json:"username"`
+	Email        string         `json:"email"`
+	Frequency    string         `json:"frequency"` // Empty when the user is not subscribed
+	SiteID       sql.NullInt64  `json:"site_id"`
+	SiteName     sql.NullString `json:"site_name"`
+	BuildingID   sql.NullInt64  `json:"building_id"`
+	BuildingCode sql.NullString `json:"building_code"`
+	LastSentAt   sql.NullTime   `json:"last_sent_at"`
+}
+
+type DigestSubscriptionDto struct {
+	Frequency  string `json:"frequency"` // Empty to unsubscribe
+	SiteID     string `json:"site_id"`
+	BuildingID string `json:"building_id"`
+}
+
+// Digest lists the devices needing attention, grouped by notification type
+type Digest struct {
+	Subscription DigestSubscription
+	Sections     []DigestSection
+}
+
+type DigestSection struct {
+	NotificationType string
+	Items            []DigestItem
+}
+
+type DigestItem struct {
+	EmergencyDeviceID       int
+	EmergencyDeviceTypeName string
+	SerialNumber            string
+	BuildingCode            string
+	RoomCode                string
+	ReferenceDate           sql.NullTime
+}
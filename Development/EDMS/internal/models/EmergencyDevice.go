@@ -5,25 +5,36 @@ import (
 )
 
 type EmergencyDevice struct {
-	EmergencyDeviceID       int            `json:"emergency_device_id"`        // From emergency_deviceT table
-	EmergencyDeviceTypeID   int            `json:"emergency_device_type_id"`   // From emergency_deviceT table (FK)
-	EmergencyDeviceTypeName string         `json:"emergency_device_type_name"` // From emergency_device_typeT table
-	ExtinguisherTypeName    sql.NullString `json:"extinguisher_type_name"`     // From Extinguisher_TypeT table
-	ExtinguisherTypeID      sql.NullInt64  `json:"extinguisher_type_id"`       // From Extinguisher_TypeT table
-	RoomID                  int            `json:"room_id"`                    // From emergency_deviceT table (FK)
-	RoomCode                string         `json:"room_code"`                  // From roomT table
-	BuildingID              int            `json:"building_id"`                // From buildingT table
-	BuildingCode            string         `json:"building_code"`              // From buildingT table
-	SiteID                  int            `json:"site_id"`                    // From siteT table
-	SiteName                string         `json:"site_name"`                  // From siteT table
-	SerialNumber            sql.NullString `json:"serial_number"`              // From emergency_deviceT table
-	ManufactureDate         sql.NullTime   `json:"manufacture_date"`           // From emergency_deviceT table
-	ExpireDate              sql.NullTime   `json:"expire_date"`                // Calculated
-	LastInspectionDateTime  sql.NullTime   `json:"last_inspection_datetime"`   // From emergency_deviceT table
-	NextInspectionDate      sql.NullTime   `json:"next_inspection_date"`       // Calculated
-	Description             sql.NullString `json:"description"`                // From emergency_deviceT table
-	Size                    sql.NullString `json:"size"`                       // From emergency_deviceT table
-	Status                  sql.NullString `json:"status"`                     // From emergency_deviceT table
+	EmergencyDeviceID       int             `json:"emergency_device_id"`        // From emergency_deviceT table
+	EmergencyDeviceTypeID   int             `json:"emergency_device_type_id"`   // From emergency_deviceT table (FK)
+	EmergencyDeviceTypeName string          `json:"emergency_device_type_name"` // From emergency_device_typeT table
+	ExtinguisherTypeName    sql.NullString  `json:"extinguisher_type_name"`     // From Extinguisher_TypeT table
+	ExtinguisherTypeID      sql.NullInt64   `json:"extinguisher_type_id"`       // From Extinguisher_TypeT table
+	RoomID                  int             `json:"room_id"`                    // From emergency_deviceT table (FK)
+	RoomCode                string          `json:"room_code"`                  // From roomT table
+	FloorID                 int             `json:"floor_id"`                   // From roomT table
+	FloorName               string          `json:"floor_name"`                 // From floorT table
+	BuildingID              int             `json:"building_id"`                // From buildingT table
+	BuildingCode            string          `json:"building_code"`              // From buildingT table
+	SiteID                  int             `json:"site_id"`                    // From siteT table
+	SiteName                string          `json:"site_name"`                  // From siteT table
+	SiteTimeZone            string          `json:"site_time_zone"`             // From siteT table
+	BuildingArchived        bool            `json:"building_archived"`          // From buildingT table
+	SerialNumber            sql.NullString  `json:"serial_number"`              // From emergency_deviceT table
+	ManufactureDate         sql.NullTime    `json:"manufacture_date"`           // From emergency_deviceT table
+	ExpireDate              sql.NullTime    `json:"expire_date"`                // Calculated
+	LastInspectionDateTime  sql.NullTime    `json:"last_inspection_datetime"`   // From emergency_deviceT table
+	NextInspectionDate      sql.NullTime    `json:"next_inspection_date"`       // Calculated
+	Description             sql.NullString  `json:"description"`                // From emergency_deviceT table
+	Size                    sql.NullString  `json:"size"`                       // From emergency_deviceT table
+	Status                  sql.NullString  `json:"status"`                     // From emergency_deviceT table
+	DeviceModelID           sql.NullInt64   `json:"device_model_id"`            // From emergency_deviceT table (FK)
+	ModelName               sql.NullString  `json:"model_name"`                 // From device_modelT table
+	ManufacturerName        sql.NullString  `json:"manufacturer_name"`          // From manufacturerT table
+	BatchNumber             sql.NullString  `json:"batch_number"`               // From emergency_deviceT table
+	PinX                    sql.NullFloat64 `json:"pin_x"`                      // From emergency_deviceT table, pixels on the floor plan
+	PinY                    sql.NullFloat64 `json:"pin_y"`                      // From emergency_deviceT table, pixels on the floor plan
+	UpdatedAt               sql.NullTime    `json:"updated_at"`                 // From emergency_deviceT table, only loaded for sync
 }
 
 type EmergencyDeviceDto struct {
@@ -36,4 +47,6 @@ type EmergencyDeviceDto struct {
 	Size                   string `json:"size"`
 	Description            string `json:"description"`
 	Status                 string `json:"status"`
+	DeviceModelID          string `json:"device_model"`
+	BatchNumber            string `json:"batch_number"`
 }
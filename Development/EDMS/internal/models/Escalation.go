@@ -0,0 +1,79 @@
+package models
+
+import "database/sql"
+
+// Roles a user can have at a site
+const (
+	SiteRoleInspector = "Inspector"
+	SiteRoleManager   = "Manager"
+)
+
+// Who an escalation step notifies
+const (
+	EscalationRecipientSiteInspectors = "Site Inspectors"
+	EscalationRecipientSiteManagers   = "Site Managers"
+	EscalationRecipientAdmins         = "Admins"
+)
+
+// Site_MemberT represents a user looking after a site
+type SiteMember struct {
+	SiteID   int    `json:"site_id"`
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"` // From userT table
+	Email    string `json:"email"`    // From userT table
+	SiteRole string `json:"site_role"`
+}
+
+type SiteMemberDto struct {
+	UserID   string `json:"user_id"`
+	SiteRole string `json:"site_role"`
+}
+
+// Escalation_PolicyT represents the escalation steps for a site and device type, a
+// policy without a site or device type applies to all of them
+type EscalationPolicy struct {
+	EscalationPolicyID      int              `json:"escalation_policy_id"`
+	PolicyName              string           `json:"policy_name"`
+	SiteID                  sql.NullInt64    `json:"site_id"`
+	SiteName                sql.NullString   `json:"site_name"` // From siteT table
+	EmergencyDeviceTypeID   sql.NullInt64    `json:"emergency_device_type_id"`
+	EmergencyDeviceTypeName sql.NullString   `json:"emergency_device_type_name"` // From emergency_device_typeT table
+	Steps                   []EscalationStep `json:"steps"`
+}
+
+// Escalation_StepT represents who is notified once a device has been overdue, or
+// failed, for a number of days
+type EscalationStep struct {
+	EscalationStepID   int    `json:"escalation_step_id"`
+	EscalationPolicyID int    `json:"escalation_policy_id"`
+	NotificationType   string `json:"notification_type"` // Inspection Overdue or Inspection Failed
+	DaysAfter          int    `json:"days_after"`
+	Recipient          string `json:"recipient"`
+}
+
+type EscalationPolicyDto struct {
+	PolicyName            string              `json:"policy_name"`
+	SiteID                string              `json:"site_id"`
+	EmergencyDeviceTypeID string              `json:"emergency_device_type_id"`
+	Steps                 []EscalationStepDto `json:"steps"`
+}
+
+type EscalationStepDto struct {
+	NotificationType string `json:"notification_type"`
+	DaysAfter        int    `json:"days_after"`
+	Recipient        string `json:"recipient"`
+}
+
+// Device_EscalationT represents an escalation step taken for a device
+type DeviceEscalation struct {
+	DeviceEscalationID int           `json:"device_escalation_id"`
+	EmergencyDeviceID  int           `json:"emergency_device_id"`
+	NotificationID     int           `json:"notification_id"`
+	EscalationStepID   sql.NullInt64 `json:"escalation_step_id"`
+	NotificationType   string        `json:"notification_type"`
+	DaysAfter          int           `json:"days_after"`
+	Recipient          string        `json:"recipient"`
+	SentTo             string        `json:"sent_to"`
+	PendingTo          string        `json:"pending_to"` // Addresses that could not be sent to yet
+	EscalatedAt        sql.NullTime  `json:"escalated_at"`
+}
@@ -1,29 +1,172 @@
 package models
 
-import "database/sql"
+import (
+	"database/sql"
+	"time"
+)
+
+// Outcomes of an inspection
+const (
+	InspectionStatusPassed            = "Passed"
+	InspectionStatusPassedWithDefects = "Passed with defects"
+	InspectionStatusFailed            = "Failed"
+)
 
 // Inspection represents the inspection of a device
 type Inspection struct {
-	EmergencyDeviceInspectionID   int            `json:"emergency_device_inspection_id"`
-	EmergencyDeviceID             int            `json:"emergency_device_id"`
-	SerialNumber                  string         `json:"serial_number"`
-	UserID                        int            `json:"user_id"`
-	InspectorName                 string         `json:"inspector_name"`
-	InspectionDateTime            sql.NullTime   `json:"inspection_datetime"`
-	CreatedAt                     sql.NullTime   `json:"created_at"`
-	IsConspicuous                 sql.NullBool   `json:"is_conspicuous"`
-	IsAccessible                  sql.NullBool   `json:"is_accessible"`
-	IsAssignedLocation            sql.NullBool   `json:"is_assigned_location"`
-	IsSignVisible                 sql.NullBool   `json:"is_sign_visible"`
-	IsAntiTamperDeviceIntact      sql.NullBool   `json:"is_anti_tamper_device_intact"`
-	IsSupportBracketSecure        sql.NullBool   `json:"is_support_bracket_secure"`
-	AreOperatingInstructionsClear sql.NullBool   `json:"are_operating_instructions_clear"`
-	IsMaintenanceTagAttached      sql.NullBool   `json:"is_maintenance_tag_attached"`
-	IsNoExternalDamage            sql.NullBool   `json:"is_no_external_damage"`
-	IsChargeGaugeNormal           sql.NullBool   `json:"is_charge_gauge_normal"`
-	IsReplaced                    sql.NullBool   `json:"is_replaced"`
-	AreMaintenanceRecordsComplete sql.NullBool   `json:"are_maintenance_records_complete"`
-	WorkOrderRequired             sql.NullBool   `json:"work_order_required"`
-	InspectionStatus              string         `json:"inspection_status"`
-	Notes                         sql.NullString `json:"notes"`
+	EmergencyDeviceInspectionID   int                  `json:"emergency_device_inspection_id"`
+	EmergencyDeviceID             int                  `json:"emergency_device_id"`
+	SerialNumber                  string               `json:"serial_number"`
+	UserID                        int                  `json:"user_id"`
+	InspectorName                 string               `json:"inspector_name"`
+	InspectionDateTime            sql.NullTime         `json:"inspection_datetime"`
+	CreatedAt                     sql.NullTime         `json:"created_at"`
+	SiteTimeZone                  string               `json:"site_time_zone"` // Time zone of the device's site
+	IsConspicuous                 sql.NullBool         `json:"is_conspicuous"`
+	IsAccessible                  sql.NullBool         `json:"is_accessible"`
+	IsAssignedLocation            sql.NullBool         `json:"is_assigned_location"`
+	IsSignVisible                 sql.NullBool         `json:"is_sign_visible"`
+	IsAntiTamperDeviceIntact      sql.NullBool         `json:"is_anti_tamper_device_intact"`
+	IsSupportBracketSecure        sql.NullBool         `json:"is_support_bracket_secure"`
+	AreOperatingInstructionsClear sql.NullBool         `json:"are_operating_instructions_clear"`
+	IsMaintenanceTagAttached      sql.NullBool         `json:"is_maintenance_tag_attached"`
+	IsNoExternalDamage            sql.NullBool         `json:"is_no_external_damage"`
+	IsChargeGaugeNormal           sql.NullBool         `json:"is_charge_gauge_normal"`
+	IsReplaced                    sql.NullBool         `json:"is_replaced"`
+	AreMaintenanceRecordsComplete sql.NullBool         `json:"are_maintenance_records_complete"`
+	WorkOrderRequired             sql.NullBool         `json:"work_order_required"`
+	InspectionStatus              string               `json:"inspection_status"`
+	Notes                         sql.NullString       `json:"notes"`
+	ChecklistTemplateID           sql.NullInt64        `json:"checklist_template_id"`
+	ChecklistTemplateName         sql.NullString       `json:"checklist_template_name"` // Calculated, e.g. "Fire Extinguisher v1"
+	Responses                     []InspectionResponse `json:"responses"`
+	ComputedStatus                sql.NullString       `json:"computed_status"` // Outcome calculated from the checklist answers
+	OverriddenBy                  sql.NullInt64        `json:"overridden_by"`
+	OverriddenByName              sql.NullString       `json:"overridden_by_name"` // Calculated
+	OverrideJustification         sql.NullString       `json:"override_justification"`
+	RevisionAction                sql.NullString       `json:"revision_action"`      // Calculated, "Amend" or "Void" once this inspection is no longer current
+	ReplacedByID                  sql.NullInt64        `json:"replaced_by_id"`       // Calculated, the amended copy of this inspection
+	AmendsInspectionID            sql.NullInt64        `json:"amends_inspection_id"` // Calculated, the inspection this one corrects
+	ClientUUID                    sql.NullString       `json:"client_uuid"`          // Set by offline clients, only written on insert
+	SignatureType                 sql.NullString       `json:"signature_type"`       // "Drawn" or "Typed", inspections before signatures are unsigned
+	SignedName                    sql.NullString       `json:"signed_name"`
+	AttestationText               sql.NullString       `json:"attestation_text"`
+	SignatureKey                  sql.NullString       `json:"-"`
+	SignatureSHA256               sql.NullString       `json:"signature_sha256"`
+	SignedAt                      sql.NullTime         `json:"signed_at"`
+	ContentHash                   sql.NullString       `json:"content_hash"`
+	HashVersion                   sql.NullInt64        `json:"hash_version"`
+}
+
+// Signature types
+const (
+	SignatureTypeDrawn = "Drawn"
+	SignatureTypeTyped = "Typed"
+)
+
+// InspectionAttestation is the statement an inspector signs, it is stored with each
+// inspection so later changes to the wording do not alter what was signed
+const InspectionAttestation = "I confirm that I personally carried out this inspection and that the answers recorded are a true and accurate record of the condition of the device."
+
+// InspectionSignatureDto is the inspector's signature of a new inspection. SignatureData
+// is a base64 PNG, optionally as a data URL, and only sent for drawn signatures. SignedAt
+// is only sent by offline clients, otherwise the inspection is signed when it is saved.
+type InspectionSignatureDto struct {
+	SignatureType string    `json:"signature_type"`
+	SignedName    string    `json:"signed_name"`
+	SignatureData string    `json:"signature_data"`
+	Attest        bool      `json:"attest"`
+	SignedAt      time.Time `json:"signed_at"`
+}
+
+// InspectionVerification is the result of checking an inspection against its sealed hash
+type InspectionVerification struct {
+	EmergencyDeviceInspectionID int    `json:"emergency_device_inspection_id"`
+	Sealed                      bool   `json:"sealed"` // Inspections recorded before sealing cannot be verified
+	ContentValid                bool   `json:"content_valid"`
+	SignatureValid              *bool  `json:"signature_valid"` // Only for drawn signatures
+	HashVersion                 int64  `json:"hash_version"`
+	Message                     string `json:"message"`
+}
+
+// Revision actions
+const (
+	RevisionActionAmend = "Amend"
+	RevisionActionVoid  = "Void"
+)
+
+// Inspection_RevisionT records an amendment or void of an inspection
+type InspectionRevision struct {
+	InspectionRevisionID        int            `json:"inspection_revision_id"`
+	EmergencyDeviceInspectionID int            `json:"emergency_device_inspection_id"`
+	ReplacementInspectionID     sql.NullInt64  `json:"replacement_inspection_id"`
+	Action                      string         `json:"action"`
+	Reason                      string         `json:"reason"`
+	RevisedBy                   sql.NullInt64  `json:"revised_by"`
+	RevisedByName               sql.NullString `json:"revised_by_name"` // Calculated
+	RevisedAt                   sql.NullTime   `json:"revised_at"`
+}
+
+// InspectionAmendDto holds the corrected values of an inspection, answers are keyed by
+// checklist question ID and only replace the answers that are given
+type InspectionAmendDto struct {
+	EmergencyDeviceID     string            `json:"device_id"`
+	InspectionDateTime    string            `json:"inspection_datetime"`
+	Notes                 *string           `json:"notes"`               // Nil keeps the original
+	WorkOrderRequired     *bool             `json:"work_order_required"` // Nil keeps the original
+	Answers               map[string]string `json:"answers"`
+	InspectionStatus      string            `json:"inspection_status"`
+	OverrideJustification string            `json:"override_justification"`
+	Reason                string            `json:"reason"`
+}
+
+type InspectionVoidDto struct {
+	Reason string `json:"reason"`
+}
+
+// InspectionHistoryFilter narrows the inspection history, zero values match everything.
+// Dates are local and inclusive.
+type InspectionHistoryFilter struct {
+	SiteID                int
+	BuildingID            int
+	RoomID                int
+	EmergencyDeviceTypeID int
+	UserID                int
+	Inspector             string // Username, matched case-insensitively
+	Statuses              []string
+	From                  sql.NullTime
+	To                    sql.NullTime
+	WorkOrderRequired     sql.NullBool
+	IncludeRevised        bool // Include inspections that were amended or voided
+}
+
+// InspectionHistoryItem is an inspection in the history with where it took place
+type InspectionHistoryItem struct {
+	EmergencyDeviceInspectionID int            `json:"emergency_device_inspection_id"`
+	EmergencyDeviceID           int            `json:"emergency_device_id"`
+	EmergencyDeviceTypeName     string         `json:"emergency_device_type_name"`
+	SerialNumber                sql.NullString `json:"serial_number"`
+	SiteID                      int            `json:"site_id"`
+	SiteName                    string         `json:"site_name"`
+	SiteTimeZone                string         `json:"site_time_zone"`
+	BuildingID                  int            `json:"building_id"`
+	BuildingCode                string         `json:"building_code"`
+	RoomID                      int            `json:"room_id"`
+	RoomCode                    string         `json:"room_code"`
+	UserID                      int            `json:"user_id"`
+	InspectorName               string         `json:"inspector_name"`
+	InspectionDateTime          sql.NullTime   `json:"inspection_datetime"`
+	InspectionStatus            string         `json:"inspection_status"`
+	WorkOrderRequired           sql.NullBool   `json:"work_order_required"`
+	Notes                       sql.NullString `json:"notes"`
+	RevisionAction              sql.NullString `json:"revision_action"` // Calculated, set once this inspection is no longer current
+}
+
+// InspectionHistoryPage is one page of the inspection history
+type InspectionHistoryPage struct {
+	Inspections []InspectionHistoryItem `json:"inspections"`
+	Page        int                     `json:"page"`
+	PageSize    int                     `json:"page_size"`
+	Total       int                     `json:"total"`
+	TotalPages  int                     `json:"total_pages"`
 }
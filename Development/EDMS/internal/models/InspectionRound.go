@@ -0,0 +1,89 @@
+package models
+
+import "database/sql"
+
+// Statuses of an inspection round
+const (
+	RoundStatusAssigned   = "Assigned"
+	RoundStatusInProgress = "In Progress"
+	RoundStatusCompleted  = "Completed"
+	RoundStatusCancelled  = "Cancelled"
+)
+
+// Statuses of a device on an inspection round
+const (
+	RoundItemStatusPending   = "Pending"
+	RoundItemStatusInspected = "Inspected"
+	RoundItemStatusSkipped   = "Skipped"
+)
+
+// Reasons a device on a round can be skipped
+var RoundSkipReasons = []string{"Locked Room", "Device Missing", "Access Blocked", "Other"}
+
+// Inspection_RoundT represents a planned route of devices for an inspector
+type InspectionRound struct {
+	InspectionRoundID int                   `json:"inspection_round_id"`
+	RoundName         string                `json:"round_name"`
+	SiteID            int                   `json:"site_id"`
+	SiteName          string                `json:"site_name"`
+	SiteTimeZone      string                `json:"site_time_zone"`
+	BuildingID        sql.NullInt64         `json:"building_id"`
+	BuildingCode      sql.NullString        `json:"building_code"`
+	AssignedTo        sql.NullInt64         `json:"assigned_to"`
+	AssignedToName    sql.NullString        `json:"assigned_to_name"`
+	DueDate           sql.NullTime          `json:"due_date"`
+	Status            string                `json:"status"`
+	CreatedBy         sql.NullInt64         `json:"created_by"`
+	CreatedAt         sql.NullTime          `json:"created_at"`
+	CompletedAt       sql.NullTime          `json:"completed_at"`
+	Stats             InspectionRoundStats  `json:"stats"`           // Calculated
+	Items             []InspectionRoundItem `json:"items,omitempty"` // Only loaded for a single round
+}
+
+// InspectionRoundStats summarises the progress of a round
+type InspectionRoundStats struct {
+	TotalItems        int            `json:"total_items"`
+	PendingItems      int            `json:"pending_items"`
+	InspectedItems    int            `json:"inspected_items"`
+	SkippedItems      int            `json:"skipped_items"`
+	PassedInspections int            `json:"passed_inspections"`
+	DefectInspections int            `json:"defect_inspections"` // Passed with defects
+	FailedInspections int            `json:"failed_inspections"`
+	PercentComplete   float64        `json:"percent_complete"`
+	SkippedByReason   map[string]int `json:"skipped_by_reason,omitempty"`
+	IsOverdue         bool           `json:"is_overdue"` // Worked out in the site's time zone
+}
+
+// Inspection_Round_ItemT represents a device on an inspection round
+type InspectionRoundItem struct {
+	InspectionRoundItemID       int            `json:"inspection_round_item_id"`
+	InspectionRoundID           int            `json:"inspection_round_id"`
+	EmergencyDeviceID           int            `json:"emergency_device_id"`
+	SerialNumber                sql.NullString `json:"serial_number"`
+	EmergencyDeviceTypeName     string         `json:"emergency_device_type_name"`
+	BuildingCode                string         `json:"building_code"`
+	RoomCode                    string         `json:"room_code"`
+	DeviceStatus                sql.NullString `json:"device_status"`
+	LastInspectionDateTime      sql.NullTime   `json:"last_inspection_datetime"`
+	SortOrder                   int            `json:"sort_order"`
+	Status                      string         `json:"status"`
+	SkipReason                  sql.NullString `json:"skip_reason"`
+	SkipNotes                   sql.NullString `json:"skip_notes"`
+	EmergencyDeviceInspectionID sql.NullInt64  `json:"emergency_device_inspection_id"`
+	InspectionStatus            sql.NullString `json:"inspection_status"`
+	UpdatedAt                   sql.NullTime   `json:"updated_at"`
+}
+
+type InspectionRoundDto struct {
+	RoundName  string `json:"round_name"`
+	SiteID     string `json:"site_id"`
+	BuildingID string `json:"building_id"`
+	AssignedTo string `json:"assigned_to"`
+	DueDate    string `json:"due_date"`
+}
+
+type InspectionRoundItemDto struct {
+	Status     string `json:"status"`
+	SkipReason string `json:"skip_reason"`
+	SkipNotes  string `json:"skip_notes"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "database/sql"
+
+// Statuses of a background job run
+const (
+	JobRunStatusRunning   = "Running"
+	JobRunStatusSucceeded = "Succeeded"
+	JobRunStatusFailed    = "Failed"
+)
+
+// Job_RunT represents one run of a background job
+type JobRun struct {
+	JobRunID   int            `json:"job_run_id"`
+	JobName    string         `json:"job_name"`
+	Instance   string         `json:"instance"`
+	StartedAt  sql.NullTime   `json:"started_at"`
+	FinishedAt sql.NullTime   `json:"finished_at"`
+	Status     string         `json:"status"`
+	Error      sql.NullString `json:"error"`
+}
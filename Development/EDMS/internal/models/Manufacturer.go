@@ -0,0 +1,20 @@
+package models
+
+// ManufacturerT represents the companies that make emergency devices
+type Manufacturer struct {
+	ManufacturerID   int    `json:"manufacturer_id"`
+	ManufacturerName string `json:"manufacturer_name"`
+}
+
+// Device_ModelT represents the catalog of models offered by each manufacturer
+type DeviceModel struct {
+	DeviceModelID    int    `json:"device_model_id"`
+	ManufacturerID   int    `json:"manufacturer_id"`
+	ManufacturerName string `json:"manufacturer_name"`
+	ModelName        string `json:"model_name"`
+}
+
+type DeviceModelDto struct {
+	ManufacturerID string `json:"manufacturer_id"`
+	ModelName      string `json:"model_name"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import "database/sql"
+
+// Notification types, from the most to the least urgent
+const (
+	NotificationTypeRecalled          = "Recalled"
+	NotificationTypeInspectionFailed  = "Inspection Failed"
+	NotificationTypeExpired           = "Expired"
+	NotificationTypeInspectionOverdue = "Inspection Overdue"
+	NotificationTypeExpiringSoon      = "Expiring Soon"
+	NotificationTypeInspectionDue     = "Inspection Due"
+)
+
+// NotificationTypePriority orders notification types, lower is more urgent
+var NotificationTypePriority = map[string]int{
+	NotificationTypeRecalled:          0,
+	NotificationTypeInspectionFailed:  1,
+	NotificationTypeExpired:           2,
+	NotificationTypeInspectionOverdue: 3,
+	NotificationTypeExpiringSoon:      4,
+	NotificationTypeInspectionDue:     5,
+}
+
+// NotificationT represents a condition of a device that needs attention, with the
+// current user's read and dismissed state
+type Notification struct {
+	NotificationID          int            `json:"notification_id"`
+	EmergencyDeviceID       int            `json:"emergency_device_id"`
+	NotificationType        string         `json:"notification_type"`
+	ReferenceDate           sql.NullTime   `json:"reference_date"`
+	Days                    int            `json:"days"` // Calculated, days since or until the reference date
+	CreatedAt               sql.NullTime   `json:"created_at"`
+	ResolvedAt              sql.NullTime   `json:"resolved_at"`
+	ReadAt                  sql.NullTime   `json:"read_at"`      // From notification_user_stateT table
+	DismissedAt             sql.NullTime   `json:"dismissed_at"` // From notification_user_stateT table
+	EmergencyDeviceTypeID   int            `json:"emergency_device_type_id"`
+	EmergencyDeviceTypeName string         `json:"emergency_device_type_name"`
+	SerialNumber            sql.NullString `json:"serial_number"`
+	RoomCode                string         `json:"room_code"`
+	BuildingCode            string         `json:"building_code"`
+	SiteID                  int            `json:"site_id"`
+	SiteName                string         `json:"site_name"`
+	SiteTimeZone            string         `json:"site_time_zone"`
+}
+
+// NotificationCount is shown on the navbar
+type NotificationCount struct {
+	Total  int `json:"total"` // Open notifications the user has not dismissed
+	Unread int `json:"unread"`
+}
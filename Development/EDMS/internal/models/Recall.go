@@ -0,0 +1,44 @@
+package models
+
+import "database/sql"
+
+// RecallT represents a manufacturer recall of a model, serial number range or batch
+type Recall struct {
+	RecallID         int            `json:"recall_id"`
+	ManufacturerID   int            `json:"manufacturer_id"`
+	ManufacturerName string         `json:"manufacturer_name"`
+	DeviceModelID    sql.NullInt64  `json:"device_model_id"`
+	ModelName        sql.NullString `json:"model_name"`
+	SerialNumberFrom sql.NullString `json:"serial_number_from"`
+	SerialNumberTo   sql.NullString `json:"serial_number_to"`
+	BatchNumber      sql.NullString `json:"batch_number"`
+	RecallDate       sql.NullTime   `json:"recall_date"`
+	ActionRequired   string         `json:"action_required"`
+	IsClosed         bool           `json:"is_closed"`
+	AffectedDevices  int            `json:"affected_devices"` // Calculated
+	OpenDevices      int            `json:"open_devices"`     // Calculated
+}
+
+type RecallDto struct {
+	ManufacturerID   string `json:"manufacturer_id"`
+	DeviceModelID    string `json:"device_model_id"`
+	SerialNumberFrom string `json:"serial_number_from"`
+	SerialNumberTo   string `json:"serial_number_to"`
+	BatchNumber      string `json:"batch_number"`
+	RecallDate       string `json:"recall_date"`
+	ActionRequired   string `json:"action_required"`
+}
+
+// Device_RecallT represents a device that has been flagged by a recall
+type DeviceRecall struct {
+	EmergencyDeviceID int            `json:"emergency_device_id"`
+	RecallID          int            `json:"recall_id"`
+	SerialNumber      sql.NullString `json:"serial_number"`
+	BatchNumber       sql.NullString `json:"batch_number"`
+	RoomCode          string         `json:"room_code"`
+	BuildingCode      string         `json:"building_code"`
+	SiteName          string         `json:"site_name"`
+	PreviousStatus    sql.NullString `json:"previous_status"`
+	FlaggedAt         sql.NullTime   `json:"flagged_at"`
+	ResolvedAt        sql.NullTime   `json:"resolved_at"`
+}
@@ -8,4 +8,5 @@ type Site struct {
 	SiteName         string         `json:"site_name"`
 	SiteAddress      string         `json:"site_address"`
 	SiteMapImagePath sql.NullString `json:"site_map_image_path"`
+	TimeZone         string         `json:"time_zone"` // IANA name, inspection times are entered and shown in it
 }
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Results of an inspection uploaded by an offline client
+const (
+	SyncResultCreated   = "created"
+	SyncResultDuplicate = "duplicate" // Already uploaded, the earlier result is returned
+	SyncResultConflict  = "conflict"  // Not recorded, resubmit with accept_conflicts once reviewed
+	SyncResultRejected  = "rejected"  // Not recorded, the inspection is invalid
+)
+
+// Conflicts between an offline inspection and the device as it is now
+const (
+	SyncConflictDeviceDeleted    = "device_deleted"
+	SyncConflictDeviceRelocated  = "device_relocated"
+	SyncConflictDeviceChanged    = "device_changed"
+	SyncConflictDeviceInactive   = "device_inactive"
+	SyncConflictInspectedSince   = "inspected_since"
+	SyncConflictBuildingArchived = "building_archived" // Rejected even with accept_conflicts
+)
+
+// SyncSnapshot is everything an inspector needs to record inspections offline in a site
+// or building. GeneratedAt is sent back with the upload to detect conflicts.
+type SyncSnapshot struct {
+	GeneratedAt        time.Time           `json:"generated_at"`
+	Site               Site                `json:"site"`
+	Buildings          []Building          `json:"buildings"`
+	Rooms              []Room              `json:"rooms"`
+	Devices            []EmergencyDevice   `json:"devices"`
+	ChecklistTemplates []ChecklistTemplate `json:"checklist_templates"` // Latest version per device type
+}
+
+// SyncDeviceState is the current state of a device an offline inspection was recorded against
+type SyncDeviceState struct {
+	EmergencyDeviceID int
+	RoomID            int
+	RoomCode          string
+	BuildingCode      string
+	Status            sql.NullString
+	Changed           bool // Edited since the snapshot
+	InspectedSince    bool // Inspected since the snapshot
+}
+
+type SyncUploadDto struct {
+	SnapshotAt  time.Time           `json:"snapshot_at"`
+	Inspections []SyncInspectionDto `json:"inspections"`
+}
+
+// SyncInspectionDto is an inspection recorded offline. The room is the device's room in
+// the snapshot, answers are keyed by checklist question ID.
+type SyncInspectionDto struct {
+	ClientUUID            string                  `json:"client_uuid"`
+	EmergencyDeviceID     int                     `json:"device_id"`
+	RoomID                int                     `json:"room_id"`
+	InspectionDateTime    time.Time               `json:"inspection_datetime"`
+	Notes                 string                  `json:"notes"`
+	WorkOrderRequired     bool                    `json:"work_order_required"`
+	ChecklistTemplateID   int                     `json:"checklist_template_id"`
+	Answers               map[string]string       `json:"answers"`
+	Photos                map[string]SyncPhotoDto `json:"photos"`
+	InspectionStatus      string                  `json:"inspection_status"`
+	OverrideJustification string                  `json:"override_justification"`
+	Signature             InspectionSignatureDto  `json:"signature"`
+	AcceptConflicts       bool                    `json:"accept_conflicts"`
+}
+
+// SyncPhotoDto is a photo answer, Data is base64 encoded
+type SyncPhotoDto struct {
+	FileName string `json:"file_name"`
+	Data     string `json:"data"`
+}
+
+type SyncConflict struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+type SyncResult struct {
+	ClientUUID                  string         `json:"client_uuid"`
+	Result                      string         `json:"result"`
+	EmergencyDeviceInspectionID int            `json:"emergency_device_inspection_id,omitempty"`
+	InspectionStatus            string         `json:"inspection_status,omitempty"`
+	Conflicts                   []SyncConflict `json:"conflicts,omitempty"`
+	Error                       string         `json:"error,omitempty"`
+}
+
+type SyncUploadResponse struct {
+	Results []SyncResult `json:"results"`
+	Created int          `json:"created"`
+	Skipped int          `json:"skipped"` // Duplicates, conflicts and rejections
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+// Statuses of a webhook delivery, dead deliveries ran out of attempts
+const (
+	WebhookDeliveryStatusPending   = "Pending"
+	WebhookDeliveryStatusSucceeded = "Succeeded"
+	WebhookDeliveryStatusDead      = "Dead"
+)
+
+// Webhook_EndpointT represents another system told about events it subscribed to
+type WebhookEndpoint struct {
+	WebhookEndpointID int          `json:"webhook_endpoint_id"`
+	Description       string       `json:"description"`
+	URL               string       `json:"url"`
+	Secret            string       `json:"secret,omitempty"` // Only returned when the endpoint is created
+	Events            []string     `json:"events"`
+	Active            bool         `json:"active"`
+	CreatedAt         sql.NullTime `json:"created_at"`
+}
+
+type WebhookEndpointDto struct {
+	Description string   `json:"description"`
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Active      bool     `json:"active"`
+}
+
+// Webhook_DeliveryT represents an event sent, or to be sent, to an endpoint
+type WebhookDelivery struct {
+	WebhookDeliveryID   int                      `json:"webhook_delivery_id"`
+	WebhookEndpointID   int                      `json:"webhook_endpoint_id"`
+	EndpointDescription string                   `json:"endpoint_description"` // From webhook_endpointT table
+	URL                 string                   `json:"url"`                  // From webhook_endpointT table
+	Secret              string                   `json:"-"`                    // From webhook_endpointT table
+	WebhookEventID      sql.NullInt64            `json:"webhook_event_id"`
+	EventType           string                   `json:"event_type"`
+	Payload             json.RawMessage          `json:"payload"`
+	Status              string                   `json:"status"`
+	Attempts            int                      `json:"attempts"`
+	NextAttemptAt       sql.NullTime             `json:"next_attempt_at"`
+	CreatedAt           sql.NullTime             `json:"created_at"`
+	DeliveredAt         sql.NullTime             `json:"delivered_at"`
+	AttemptLog          []WebhookDeliveryAttempt `json:"attempt_log,omitempty"`
+}
+
+// Webhook_Delivery_AttemptT represents one attempt to deliver, with the response
+type WebhookDeliveryAttempt struct {
+	WebhookDeliveryAttemptID int            `json:"webhook_delivery_attempt_id"`
+	WebhookDeliveryID        int            `json:"webhook_delivery_id"`
+	AttemptedAt              sql.NullTime   `json:"attempted_at"`
+	ResponseStatus           sql.NullInt64  `json:"response_status"`
+	ResponseBody             sql.NullString `json:"response_body"`
+	Error                    sql.NullString `json:"error"`
+	DurationMS               int            `json:"duration_ms"`
+}
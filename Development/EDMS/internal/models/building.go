@@ -1,11 +1,22 @@
 package models
 
+import "database/sql"
+
 // BuildingT represents the buildings in each site
 type Building struct {
 	BuildingID   int    `json:"building_id"`
 	SiteID       int    `json:"site_id"`
 	BuildingCode string `json:"building_code"`
 	SiteName     string `json:"site_name"`
+	// Position on the site map, in pixels of the site map image from its top left
+	MapX sql.NullFloat64 `json:"map_x"`
+	MapY sql.NullFloat64 `json:"map_y"`
+	// Optional outline of the building on the site map, as [x, y] points
+	MapPolygon [][2]float64 `json:"map_polygon"`
+	// Plan that devices are pinned on for floors without a plan of their own
+	FloorPlanImagePath sql.NullString `json:"floor_plan_image_path"`
+	// Set once the building is archived, archived buildings are not listed
+	ArchivedAt sql.NullTime `json:"archived_at"`
 }
 
 type BuildingDto struct {
@@ -13,4 +24,8 @@ type BuildingDto struct {
 	SiteID       string `json:"site_id"`
 	BuildingCode string `json:"building_code"`
 	SiteName     string `json:"site_name"`
+	MapX         string `json:"map_x"`
+	MapY         string `json:"map_y"`
+	// JSON array of [x, y] points
+	MapPolygon string `json:"map_polygon"`
 }
@@ -0,0 +1,30 @@
+package models
+
+import "database/sql"
+
+// DevicePin is a device on a floor plan, PinX and PinY are null until it is placed
+type DevicePin struct {
+	EmergencyDeviceID       int             `json:"emergency_device_id"`
+	EmergencyDeviceTypeName string          `json:"emergency_device_type_name"`
+	SerialNumber            sql.NullString  `json:"serial_number"`
+	RoomID                  int             `json:"room_id"`
+	RoomCode                string          `json:"room_code"`
+	FloorID                 int             `json:"floor_id"`
+	FloorName               string          `json:"floor_name"`
+	Status                  sql.NullString  `json:"status"`
+	StatusColour            string          `json:"status_colour"` // Hex colour the pin is drawn in
+	PinX                    sql.NullFloat64 `json:"pin_x"`
+	PinY                    sql.NullFloat64 `json:"pin_y"`
+}
+
+// FloorPlanPins are the devices on a floor's plan, or on a building's plan for the
+// building's floors without a plan of their own
+type FloorPlanPins struct {
+	BuildingID         int            `json:"building_id"`
+	BuildingCode       string         `json:"building_code"`
+	FloorID            sql.NullInt64  `json:"floor_id"` // Null for a building's plan
+	FloorName          string         `json:"floor_name"`
+	FloorPlanImagePath sql.NullString `json:"floor_plan_image_path"`
+	Pins               []DevicePin    `json:"pins"`
+	Unplaced           []DevicePin    `json:"unplaced"`
+}
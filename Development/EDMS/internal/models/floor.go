@@ -0,0 +1,15 @@
+package models
+
+import "database/sql"
+
+// FloorT represents the floors of each building, rooms belong to a floor
+type Floor struct {
+	FloorID            int            `json:"floor_id"`
+	BuildingID         int            `json:"building_id"`
+	FloorName          string         `json:"floor_name"`
+	FloorOrder         int            `json:"floor_order"` // Floors are listed from the lowest
+	FloorPlanImagePath sql.NullString `json:"floor_plan_image_path"`
+	BuildingCode       string         `json:"building_code"`
+	SiteID             int            `json:"site_id"`
+	SiteName           string         `json:"site_name"`
+}
@@ -0,0 +1,28 @@
+package models
+
+// Kinds of rows a location tree operation or import changes
+const (
+	LocationChangeSite               = "site"
+	LocationChangeBuilding           = "building"
+	LocationChangeFloor              = "floor"
+	LocationChangeRoom               = "room"
+	LocationChangeDevice             = "device"
+	LocationChangeInspectionRound    = "inspection_round"
+	LocationChangeDigestSubscription = "digest_subscription"
+)
+
+// LocationChangeRow is a row changed by a location tree operation, with a description of
+// the change
+type LocationChangeRow struct {
+	Kind   string `json:"kind"`
+	ID     int    `json:"id"`
+	Label  string `json:"label"`
+	Change string `json:"change"`
+}
+
+// LocationChange lists the rows a location tree operation, such as moving a room to
+// another building, changes. It is previewed before it is applied.
+type LocationChange struct {
+	Applied bool                `json:"applied"`
+	Rows    []LocationChangeRow `json:"rows"`
+}
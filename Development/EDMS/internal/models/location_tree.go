@@ -0,0 +1,67 @@
+package models
+
+// LocationTreeSite is a site with its buildings, as the location tree is exported and
+// imported. Sites are matched by name.
+type LocationTreeSite struct {
+	SiteName    string                 `json:"site_name"`
+	SiteAddress string                 `json:"site_address"`
+	TimeZone    string                 `json:"time_zone"`
+	Buildings   []LocationTreeBuilding `json:"buildings"`
+}
+
+// LocationTreeBuilding is a building of a site with its floors and rooms, matched by
+// building code at the site
+type LocationTreeBuilding struct {
+	BuildingCode string              `json:"building_code"`
+	Floors       []LocationTreeFloor `json:"floors"`
+	Rooms        []LocationTreeRoom  `json:"rooms"`
+	Archived     bool                `json:"-"` // Archived buildings are not exported or imported
+}
+
+// LocationTreeFloor is a floor of a building, matched by name. Floors added without an
+// order go above the building's other floors.
+type LocationTreeFloor struct {
+	FloorName  string `json:"floor_name"`
+	FloorOrder *int   `json:"floor_order,omitempty"`
+}
+
+// LocationTreeRoom is a room of a building, matched by room code in the building. Rooms
+// without a floor keep their floor, or go on the building's lowest floor when added.
+type LocationTreeRoom struct {
+	RoomCode  string `json:"room_code"`
+	FloorName string `json:"floor_name,omitempty"`
+}
+
+// LocationTree is the location tree of every site
+type LocationTree struct {
+	Sites []LocationTreeSite `json:"sites"`
+}
+
+// What importing the location tree does to each site, building, floor or room
+const (
+	LocationImportCreate   = "create"
+	LocationImportUpdate   = "update"
+	LocationImportConflict = "conflict"
+)
+
+// LocationImportRow is a site, building, floor or room that importing the location tree
+// creates or updates, or cannot import
+type LocationImportRow struct {
+	Action       string `json:"action"`
+	Kind         string `json:"kind"`
+	SiteName     string `json:"site_name"`
+	BuildingCode string `json:"building_code"`
+	FloorName    string `json:"floor_name"`
+	RoomCode     string `json:"room_code"`
+	Detail       string `json:"detail"`
+}
+
+// LocationImport reports what importing a location tree does, as a dry run before it is
+// applied. Rows are only listed for changes and conflicts.
+type LocationImport struct {
+	Creates   int                 `json:"creates"`
+	Updates   int                 `json:"updates"`
+	Unchanged int                 `json:"unchanged"`
+	Conflicts int                 `json:"conflicts"`
+	Rows      []LocationImportRow `json:"rows"`
+}
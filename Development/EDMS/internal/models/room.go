@@ -4,8 +4,10 @@ package models
 type Room struct {
 	RoomID       int    `json:"room_id"`
 	BuildingID   int    `json:"building_id"`
+	FloorID      int    `json:"floor_id"`
 	RoomCode     string `json:"room_code"`
 	BuildingCode string `json:"building_code"`
+	FloorName    string `json:"floor_name"`
 	SiteName     string `json:"site_name"`
 	SiteID       int    `json:"site_id"`
 }
@@ -13,6 +15,7 @@ type Room struct {
 type RoomDto struct {
 	RoomID       string `json:"room_id"`
 	BuildingID   string `json:"building_id"`
+	FloorID      string `json:"floor_id"`
 	RoomCode     string `json:"room_code"`
 	BuildingCode string `json:"building_code"`
 	SiteName     string `json:"site_name"`
@@ -0,0 +1,54 @@
+package models
+
+import "database/sql"
+
+// What importing a site map does to each building or room
+const (
+	SiteMapImportCreate    = "create"
+	SiteMapImportUpdate    = "update"
+	SiteMapImportUnchanged = "unchanged"
+	SiteMapImportConflict  = "conflict"
+)
+
+// SiteMapImportBuilding is a building found on an imported site map, with its position
+// in pixels of the map, and the position the building has at the site now
+type SiteMapImportBuilding struct {
+	Action            string          `json:"action"`
+	BuildingCode      string          `json:"building_code"`
+	MapX              float64         `json:"map_x"`
+	MapY              float64         `json:"map_y"`
+	MapPolygon        [][2]float64    `json:"map_polygon"`
+	CurrentMapX       sql.NullFloat64 `json:"current_map_x"`
+	CurrentMapY       sql.NullFloat64 `json:"current_map_y"`
+	CurrentMapPolygon [][2]float64    `json:"current_map_polygon"`
+}
+
+// SiteMapImportRoom is a room found on an imported site map. Rooms have no position of
+// their own, MapX and MapY only show the admin where the room was found and are not
+// saved. Detail says why a conflicting room cannot be imported.
+type SiteMapImportRoom struct {
+	Action       string  `json:"action"`
+	BuildingCode string  `json:"building_code"`
+	RoomCode     string  `json:"room_code"`
+	MapX         float64 `json:"map_x"`
+	MapY         float64 `json:"map_y"`
+	Detail       string  `json:"detail"`
+}
+
+// SiteMapImport is what importing a site map would change at a site, for the admin to
+// review before it is applied
+type SiteMapImport struct {
+	SiteID    int                     `json:"site_id"`
+	Width     float64                 `json:"width"`
+	Height    float64                 `json:"height"`
+	Buildings []SiteMapImportBuilding `json:"buildings"`
+	Rooms     []SiteMapImportRoom     `json:"rooms"`
+	Warnings  []string                `json:"warnings"`
+}
+
+// SiteMapImportResult counts what applying a site map import changed
+type SiteMapImportResult struct {
+	BuildingsCreated int `json:"buildings_created"`
+	BuildingsUpdated int `json:"buildings_updated"`
+	RoomsCreated     int `json:"rooms_created"`
+}
@@ -0,0 +1,395 @@
+// Package pdf writes simple A4 reports: headings, wrapped text, label and value fields,
+// tables that continue across pages and PNG images. It only uses the standard Helvetica
+// fonts so nothing has to be embedded.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+)
+
+// A4 page size and layout in points
+const (
+	PageWidth    = 595.28
+	PageHeight   = 841.89
+	Margin       = 50.0
+	ContentWidth = PageWidth - 2*Margin
+
+	bodySize    = 10.0
+	leading     = 1.3 // Line height as a multiple of the font size
+	cellPadding = 4.0
+	footerSize  = 8.0
+	labelWidth  = 150.0
+)
+
+// Column is a table column, Width is in points
+type Column struct {
+	Title string
+	Width float64
+}
+
+// Document is a PDF being built a block at a time from the top of the first page
+type Document struct {
+	title  string
+	footer string
+	pages  []*bytes.Buffer
+	page   *bytes.Buffer
+	y      float64 // Top of the next block, measured up from the bottom of the page
+	images []image.Image
+}
+
+// New starts a document. The title is stored in the document properties and the footer
+// is printed at the bottom of every page with the page number.
+func New(title, footer string) *Document {
+	d := &Document{title: title, footer: footer}
+	d.AddPage()
+	return d
+}
+
+// AddPage starts a new page
+func (d *Document) AddPage() {
+	d.page = &bytes.Buffer{}
+	d.pages = append(d.pages, d.page)
+	d.y = PageHeight - Margin
+}
+
+// Space moves down the page, starting a new page if there is no room left
+func (d *Document) Space(height float64) {
+	d.y -= height
+	if d.y < Margin {
+		d.AddPage()
+	}
+}
+
+// ensure starts a new page unless height fits above the bottom margin
+func (d *Document) ensure(height float64) {
+	if d.y-height < Margin {
+		d.AddPage()
+	}
+}
+
+// Title prints the large heading at the top of a report
+func (d *Document) Title(text string) {
+	d.paragraph(text, 18, true, Margin, ContentWidth)
+	d.Space(6)
+}
+
+// Heading prints a section heading
+func (d *Document) Heading(text string) {
+	// Keep the heading with at least two lines of what follows it
+	d.ensure(13*leading + 2*bodySize*leading + 10)
+	d.Space(8)
+	d.paragraph(text, 13, true, Margin, ContentWidth)
+	d.line(Margin, d.y+2, Margin+ContentWidth, d.y+2, 0.6)
+	d.Space(4)
+}
+
+// Paragraph prints wrapped body text
+func (d *Document) Paragraph(text string) {
+	d.paragraph(text, bodySize, false, Margin, ContentWidth)
+	d.Space(4)
+}
+
+// Note prints wrapped text in a smaller grey font
+func (d *Document) Note(text string) {
+	fmt.Fprint(d.page, "0.4 g\n")
+	d.paragraph(text, 8.5, false, Margin, ContentWidth)
+	fmt.Fprint(d.page, "0 g\n")
+	d.Space(4)
+}
+
+// Field prints a bold label with its value wrapped beside it
+func (d *Document) Field(label, value string) {
+	labelLines := wrap(label, bodySize, true, labelWidth-cellPadding)
+	valueLines := wrap(value, bodySize, false, ContentWidth-labelWidth)
+	lines := max(len(labelLines), len(valueLines))
+	d.ensure(float64(lines) * bodySize * leading)
+
+	top := d.y
+	d.lines(labelLines, bodySize, true, Margin)
+	d.y = top
+	d.lines(valueLines, bodySize, false, Margin+labelWidth)
+	d.y = top - float64(lines)*bodySize*leading
+	d.Space(2)
+}
+
+// Table prints rows under a header row, the header is repeated on each new page
+func (d *Document) Table(columns []Column, rows [][]string) {
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Title
+	}
+
+	d.tableRow(columns, header, true, false)
+	for _, row := range rows {
+		if d.tableRow(columns, row, false, false) {
+			d.tableRow(columns, header, true, false)
+			// Rows taller than a page are printed anyway rather than lost
+			d.tableRow(columns, row, false, true)
+		}
+	}
+	d.Space(6)
+}
+
+// tableRow prints one row, or reports that a new page was started instead so the
+// header can be repeated first. Forced rows are printed even if they do not fit.
+func (d *Document) tableRow(columns []Column, row []string, isHeader, force bool) bool {
+	size := bodySize - 1
+	cells := make([][]string, len(columns))
+	lines := 1
+	for i, column := range columns {
+		text := ""
+		if i < len(row) {
+			text = row[i]
+		}
+		cells[i] = wrap(text, size, isHeader, column.Width-2*cellPadding)
+		lines = max(lines, len(cells[i]))
+	}
+	height := float64(lines)*size*leading + 2*cellPadding
+
+	if d.y-height < Margin && !force {
+		d.AddPage()
+		if !isHeader {
+			return true
+		}
+	}
+
+	top := d.y
+	x := Margin
+	for i, column := range columns {
+		if isHeader {
+			fmt.Fprintf(d.page, "0.9 g %.2f %.2f %.2f %.2f re f 0 g\n", x, top-height, column.Width, height)
+		}
+		fmt.Fprintf(d.page, "0.7 G %.2f %.2f %.2f %.2f re S 0 G\n", x, top-height, column.Width, height)
+		d.y = top - cellPadding
+		d.lines(cells[i], size, isHeader, x+cellPadding)
+		x += column.Width
+	}
+	d.y = top - height
+	return false
+}
+
+// Image prints an image scaled to fit within width and height points, keeping its
+// aspect ratio
+func (d *Document) Image(img image.Image, width, height float64) {
+	bounds := img.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return
+	}
+	scale := min(width/float64(bounds.Dx()), height/float64(bounds.Dy()))
+	drawWidth := float64(bounds.Dx()) * scale
+	drawHeight := float64(bounds.Dy()) * scale
+
+	d.ensure(drawHeight)
+	d.images = append(d.images, img)
+	fmt.Fprintf(d.page, "q %.2f 0 0 %.2f %.2f %.2f cm /Im%d Do Q\n",
+		drawWidth, drawHeight, Margin, d.y-drawHeight, len(d.images))
+	d.Space(drawHeight + 4)
+}
+
+// paragraph prints text wrapped to width, starting new pages as needed
+func (d *Document) paragraph(text string, size float64, bold bool, x, width float64) {
+	d.lines(wrap(text, size, bold, width), size, bold, x)
+}
+
+func (d *Document) lines(lines []string, size float64, bold bool, x float64) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	for _, line := range lines {
+		d.ensure(size * leading)
+		d.y -= size * leading
+		fmt.Fprintf(d.page, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n",
+			font, size, x, d.y+size*(leading-1), escape(encode(line)))
+	}
+}
+
+func (d *Document) line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(d.page, "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, y1, x2, y2)
+}
+
+// wrap breaks text into lines no wider than width, keeping its own line breaks
+func wrap(text string, size float64, bold bool, width float64) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if textWidth(encode(candidate), size, bold) <= width {
+				line = candidate
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			// Break words too long for a line of their own
+			for len([]rune(word)) > 1 && textWidth(encode(word), size, bold) > width {
+				runes := []rune(word)
+				cut := len(runes) - 1
+				for cut > 1 && textWidth(encode(string(runes[:cut])), size, bold) > width {
+					cut--
+				}
+				lines = append(lines, string(runes[:cut]))
+				word = string(runes[cut:])
+			}
+			line = word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// escape makes encoded text safe inside a PDF string literal
+func escape(encoded []byte) string {
+	var b strings.Builder
+	for _, c := range encoded {
+		switch {
+		case c == '(' || c == ')' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c >= 128:
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// WriteTo writes the finished document, adding the footer to every page
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	out := &pdfWriter{}
+	out.buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1 to 4 are fixed, images come next followed by each page and its contents
+	imageIDs := make([]int, len(d.images))
+	next := 5
+	for i := range d.images {
+		imageIDs[i] = next
+		next += 2 // Each image has a soft mask for its transparency
+	}
+	pageIDs := make([]int, len(d.pages))
+	for i := range d.pages {
+		pageIDs[i] = next
+		next += 2
+	}
+
+	out.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+
+	var kids, xobjects strings.Builder
+	for _, id := range pageIDs {
+		fmt.Fprintf(&kids, "%d 0 R ", id)
+	}
+	for i, id := range imageIDs {
+		fmt.Fprintf(&xobjects, "/Im%d %d 0 R ", i+1, id)
+	}
+	out.object(2, fmt.Sprintf(
+		"<< /Type /Pages /Kids [%s] /Count %d /MediaBox [0 0 %.2f %.2f] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> /XObject << %s>> >> >>",
+		kids.String(), len(d.pages), PageWidth, PageHeight, xobjects.String()))
+	out.object(3, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	out.object(4, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, img := range d.images {
+		rgb, alpha := imageData(img)
+		bounds := img.Bounds()
+		out.stream(imageIDs[i], fmt.Sprintf(
+			"/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /SMask %d 0 R",
+			bounds.Dx(), bounds.Dy(), imageIDs[i]+1), rgb)
+		out.stream(imageIDs[i]+1, fmt.Sprintf(
+			"/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8",
+			bounds.Dx(), bounds.Dy()), alpha)
+	}
+
+	for i, page := range d.pages {
+		content := bytes.NewBuffer(page.Bytes())
+		footer := fmt.Sprintf("Page %d of %d", i+1, len(d.pages))
+		if d.footer != "" {
+			footer = d.footer + "   |   " + footer
+		}
+		fmt.Fprintf(content, "0.4 g BT /F1 %.1f Tf %.2f %.2f Td (%s) Tj ET 0 g\n",
+			footerSize, Margin, Margin/2, escape(encode(footer)))
+
+		out.object(pageIDs[i], fmt.Sprintf("<< /Type /Page /Parent 2 0 R /Contents %d 0 R >>", pageIDs[i]+1))
+		out.stream(pageIDs[i]+1, "", content.Bytes())
+	}
+
+	infoID := next
+	out.object(infoID, fmt.Sprintf("<< /Title (%s) /Producer (EDMS) >>", escape(encode(d.title))))
+
+	xref := out.buf.Len()
+	fmt.Fprintf(&out.buf, "xref\n0 %d\n0000000000 65535 f \n", infoID+1)
+	for id := 1; id <= infoID; id++ {
+		fmt.Fprintf(&out.buf, "%010d 00000 n \n", out.offsets[id])
+	}
+	fmt.Fprintf(&out.buf, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		infoID+1, infoID, xref)
+
+	n, err := w.Write(out.buf.Bytes())
+	return int64(n), err
+}
+
+// Bytes returns the finished document
+func (d *Document) Bytes() []byte {
+	var buf bytes.Buffer
+	d.WriteTo(&buf)
+	return buf.Bytes()
+}
+
+// pdfWriter collects numbered objects and their offsets for the cross-reference table
+type pdfWriter struct {
+	buf     bytes.Buffer
+	offsets map[int]int
+}
+
+func (w *pdfWriter) object(id int, body string) {
+	if w.offsets == nil {
+		w.offsets = make(map[int]int)
+	}
+	w.offsets[id] = w.buf.Len()
+	fmt.Fprintf(&w.buf, "%d 0 obj\n%s\nendobj\n", id, body)
+}
+
+// stream writes a Flate compressed stream object, dict holds any extra dictionary entries
+func (w *pdfWriter) stream(id int, dict string, data []byte) {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(data)
+	zw.Close()
+
+	if w.offsets == nil {
+		w.offsets = make(map[int]int)
+	}
+	w.offsets[id] = w.buf.Len()
+	fmt.Fprintf(&w.buf, "%d 0 obj\n<< %s /Filter /FlateDecode /Length %d >>\nstream\n",
+		id, dict, compressed.Len())
+	w.buf.Write(compressed.Bytes())
+	w.buf.WriteString("\nendstream\nendobj\n")
+}
+
+// imageData splits an image into 8 bit RGB samples and an alpha mask
+func imageData(img image.Image) ([]byte, []byte) {
+	bounds := img.Bounds()
+	rgb := make([]byte, 0, bounds.Dx()*bounds.Dy()*3)
+	alpha := make([]byte, 0, bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			// Colours are premultiplied, undo it so edges keep their colour
+			if a > 0 && a < 0xffff {
+				r, g, b = r*0xffff/a, g*0xffff/a, b*0xffff/a
+			}
+			rgb = append(rgb, byte(r>>8), byte(g>>8), byte(b>>8))
+			alpha = append(alpha, byte(a>>8))
+		}
+	}
+	return rgb, alpha
+}
@@ -0,0 +1,60 @@
+package pdf_test
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/pdf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentStructure(t *testing.T) {
+	doc := pdf.New("Compliance (B Block)", "EDMS test")
+	doc.Title("Building Compliance Report")
+	doc.Field("Building", "B Block – Taradale")
+	doc.Paragraph(strings.Repeat("A long paragraph that needs wrapping. ", 40))
+
+	rows := make([][]string, 120)
+	for i := range rows {
+		rows[i] = []string{fmt.Sprintf("Device %d", i), "Passed", "1 January 2025"}
+	}
+	doc.Table([]pdf.Column{
+		{Title: "Device", Width: 200},
+		{Title: "Status", Width: 150},
+		{Title: "Due", Width: pdf.ContentWidth - 350},
+	}, rows)
+
+	signature := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	signature.Set(1, 1, color.NRGBA{A: 255})
+	doc.Image(signature, 200, 60)
+
+	out := doc.Bytes()
+	require.True(t, bytes.HasPrefix(out, []byte("%PDF-1.4")))
+	require.True(t, bytes.HasSuffix(out, []byte("%%EOF\n")))
+
+	// The table does not fit on one page, every page gets a numbered footer
+	pages := regexp.MustCompile(`/Type /Page /Parent`).FindAll(out, -1)
+	assert.Greater(t, len(pages), 1)
+	assert.Contains(t, string(out), fmt.Sprintf("/Count %d", len(pages)))
+	assert.Contains(t, string(out), `/Title (Compliance \(B Block\))`)
+	assert.Contains(t, string(out), "/Im1 ")
+
+	// Every cross-reference entry points at the start of its object
+	startxref := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(out)
+	require.NotNil(t, startxref)
+	xrefOffset, err := strconv.Atoi(string(startxref[1]))
+	require.NoError(t, err)
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(out[xrefOffset:], -1)
+	require.NotEmpty(t, entries)
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		assert.True(t, bytes.HasPrefix(out[offset:], []byte(fmt.Sprintf("%d 0 obj", i+1))), "object %d", i+1)
+	}
+}
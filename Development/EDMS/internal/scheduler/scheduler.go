@@ -0,0 +1,179 @@
+// Package scheduler runs background jobs inside the server process. Every replica runs
+// the scheduler, a shared lock makes sure only one of them runs a job at a time and the
+// shared run history makes sure a job is not repeated before its interval is up.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Job is work run every Interval
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Store holds the job locks and run history shared by every replica
+type Store interface {
+	// TryLockJob takes the job's lock without waiting. When ok is true unlock must be
+	// called once the job has finished.
+	TryLockJob(ctx context.Context, name string) (unlock func(), ok bool, err error)
+	// LastJobRun returns when the job was last started, or the zero time
+	LastJobRun(ctx context.Context, name string) (time.Time, error)
+	// StartJobRun records that the job has started and returns the run ID
+	StartJobRun(ctx context.Context, name, instance string) (int, error)
+	// FinishJobRun records the outcome of a run, runErr is nil when it succeeded
+	FinishJobRun(ctx context.Context, runID int, runErr error) error
+}
+
+// ErrJobLocked is returned by RunNow when another replica is running the job
+var ErrJobLocked = errors.New("scheduler: job is running on another replica")
+
+// Longest wait between checks for a due job, so a job whose last run was on another
+// replica is picked up soon after it is due
+const maxCheckInterval = time.Minute
+
+// Scheduler runs registered jobs until it is stopped
+type Scheduler struct {
+	store    Store
+	logger   *log.Logger
+	instance string
+	jobs     []Job
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	now      func() time.Time
+}
+
+// New creates a scheduler, jobs are registered before it is started
+func New(store Store, logger *log.Logger) *Scheduler {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return &Scheduler{
+		store:    store,
+		logger:   logger,
+		instance: fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		now:      time.Now,
+	}
+}
+
+// Register adds a job, it must be called before Start
+func (s *Scheduler) Register(job Job) {
+	s.jobs = append(s.jobs, job)
+}
+
+// Jobs returns the registered jobs
+func (s *Scheduler) Jobs() []Job {
+	return s.jobs
+}
+
+// Start runs each job as soon as it is due and then every interval
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go func(job Job) {
+			defer s.wg.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+}
+
+// Stop cancels running jobs and waits for them to finish, or until ctx is done
+func (s *Scheduler) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RunNow runs a job straight away on this replica. It returns ErrJobLocked without
+// running the job when another replica is running it.
+func (s *Scheduler) RunNow(ctx context.Context, name string) error {
+	for _, job := range s.jobs {
+		if job.Name == name {
+			ran, err := s.run(ctx, job, true)
+			if err == nil && !ran {
+				return ErrJobLocked
+			}
+			return err
+		}
+	}
+	return fmt.Errorf("scheduler: unknown job %q", name)
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	checkInterval := min(job.Interval, maxCheckInterval)
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.run(ctx, job, false); err != nil && ctx.Err() == nil {
+			s.logger.Printf("\033[31mJob %s failed: %v\033[0m", job.Name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run runs the job if it is due, or always when force is set, and reports whether it ran
+func (s *Scheduler) run(ctx context.Context, job Job, force bool) (bool, error) {
+	unlock, ok, err := s.store.TryLockJob(ctx, job.Name)
+	if err != nil || !ok {
+		// Another replica is running the job
+		return false, err
+	}
+	defer unlock()
+
+	if !force {
+		lastRun, err := s.store.LastJobRun(ctx, job.Name)
+		if err != nil {
+			return false, err
+		}
+		if !lastRun.IsZero() && s.now().Sub(lastRun) < job.Interval {
+			return false, nil
+		}
+	}
+
+	runID, err := s.store.StartJobRun(ctx, job.Name, s.instance)
+	if err != nil {
+		return false, err
+	}
+
+	runErr := job.Run(ctx)
+
+	// Record the outcome even if the job was cancelled by a shutdown
+	if err := s.store.FinishJobRun(context.Background(), runID, runErr); err != nil {
+		s.logger.Printf("\033[31mError recording run of job %s: %v\033[0m", job.Name, err)
+	}
+
+	return true, runErr
+}
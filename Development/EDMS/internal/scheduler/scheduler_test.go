@@ -0,0 +1,169 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore is a Store shared by schedulers standing in for separate replicas
+type memoryStore struct {
+	mu      sync.Mutex
+	locked  map[string]bool
+	lastRun map[string]time.Time
+	runs    []error
+	now     func() time.Time
+}
+
+func newMemoryStore(now func() time.Time) *memoryStore {
+	return &memoryStore{locked: map[string]bool{}, lastRun: map[string]time.Time{}, now: now}
+}
+
+func (m *memoryStore) TryLockJob(ctx context.Context, name string) (func(), bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.locked[name] {
+		return nil, false, nil
+	}
+	m.locked[name] = true
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.locked, name)
+	}, true, nil
+}
+
+func (m *memoryStore) LastJobRun(ctx context.Context, name string) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastRun[name], nil
+}
+
+func (m *memoryStore) StartJobRun(ctx context.Context, name, instance string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastRun[name] = m.now()
+	m.runs = append(m.runs, nil)
+	return len(m.runs) - 1, nil
+}
+
+func (m *memoryStore) FinishJobRun(ctx context.Context, runID int, runErr error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runs[runID] = runErr
+	return nil
+}
+
+func newTestScheduler(store Store, now func() time.Time) *Scheduler {
+	s := New(store, log.New(io.Discard, "", 0))
+	s.now = now
+	return s
+}
+
+func TestRunSkipsJobsThatAreNotDue(t *testing.T) {
+	current := time.Date(2024, 11, 13, 9, 0, 0, 0, time.UTC)
+	now := func() time.Time { return current }
+	store := newMemoryStore(now)
+
+	runs := 0
+	job := Job{Name: "recompute", Interval: time.Hour, Run: func(ctx context.Context) error {
+		runs++
+		return nil
+	}}
+
+	// Two replicas sharing the run history only run the job once per interval
+	first := newTestScheduler(store, now)
+	second := newTestScheduler(store, now)
+
+	ran, err := first.run(context.Background(), job, false)
+	require.NoError(t, err)
+	assert.True(t, ran)
+
+	ran, err = second.run(context.Background(), job, false)
+	require.NoError(t, err)
+	assert.False(t, ran)
+
+	current = current.Add(time.Hour)
+	ran, err = second.run(context.Background(), job, false)
+	require.NoError(t, err)
+	assert.True(t, ran)
+	assert.Equal(t, 2, runs)
+}
+
+func TestRunSkipsJobLockedByAnotherReplica(t *testing.T) {
+	store := newMemoryStore(time.Now)
+	unlock, ok, _ := store.TryLockJob(context.Background(), "purge")
+	require.True(t, ok)
+
+	job := Job{Name: "purge", Interval: time.Hour, Run: func(ctx context.Context) error {
+		t.Fatal("job ran while locked by another replica")
+		return nil
+	}}
+	ran, err := newTestScheduler(store, time.Now).run(context.Background(), job, true)
+	require.NoError(t, err)
+	assert.False(t, ran)
+
+	unlock()
+}
+
+func TestRunNowReportsJobLockedByAnotherReplica(t *testing.T) {
+	store := newMemoryStore(time.Now)
+	unlock, ok, _ := store.TryLockJob(context.Background(), "purge")
+	require.True(t, ok)
+
+	runs := 0
+	s := newTestScheduler(store, time.Now)
+	s.Register(Job{Name: "purge", Interval: time.Hour, Run: func(ctx context.Context) error {
+		runs++
+		return nil
+	}})
+	assert.ErrorIs(t, s.RunNow(context.Background(), "purge"), ErrJobLocked)
+	assert.Equal(t, 0, runs)
+
+	unlock()
+	require.NoError(t, s.RunNow(context.Background(), "purge"))
+	assert.Equal(t, 1, runs)
+}
+
+func TestRunRecordsFailures(t *testing.T) {
+	store := newMemoryStore(time.Now)
+	failure := errors.New("database unavailable")
+	job := Job{Name: "notify", Interval: time.Hour, Run: func(ctx context.Context) error {
+		return failure
+	}}
+
+	_, err := newTestScheduler(store, time.Now).run(context.Background(), job, false)
+	assert.ErrorIs(t, err, failure)
+	require.Len(t, store.runs, 1)
+	assert.ErrorIs(t, store.runs[0], failure)
+}
+
+func TestStopWaitsForRunningJobs(t *testing.T) {
+	store := newMemoryStore(time.Now)
+	started := make(chan struct{})
+	finished := false
+
+	s := newTestScheduler(store, time.Now)
+	s.Register(Job{Name: "digest", Interval: time.Hour, Run: func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		finished = true
+		return ctx.Err()
+	}})
+	s.Start()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, s.Stop(ctx))
+	assert.True(t, finished)
+	assert.ErrorIs(t, store.runs[0], context.Canceled)
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrNotFound is returned when a key has no stored object
+var ErrNotFound = errors.New("storage: object not found")
+
+// Store keeps uploaded files outside the application container. Keys are slash
+// separated relative paths such as "site_maps/EIT_Hastings.png".
+type Store interface {
+	// Put writes the object, replacing any existing object with the same key
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Get opens the object for reading, the caller must close it
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object, deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// Config selects and configures the store implementation
+type Config struct {
+	Backend     string // "local" or "s3"
+	LocalDir    string
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+}
+
+// New creates the store described by cfg
+func New(cfg Config) (Store, error) {
+	switch cfg.Backend {
+	case "", "local":
+		return NewLocalStore(cfg.LocalDir)
+	case "s3":
+		return NewS3Store(S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+		})
+	default:
+		return nil, fmt.Errorf("storage: unknown backend %q", cfg.Backend)
+	}
+}
+
+// ReadAll reads a whole object into memory
+func ReadAll(ctx context.Context, s Store, key string) ([]byte, error) {
+	r, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// Move copies an object to a new key and removes the original
+func Move(ctx context.Context, s Store, from, to, contentType string) error {
+	if from == to {
+		return nil
+	}
+
+	r, err := s.Get(ctx, from)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := s.Put(ctx, to, r, contentType); err != nil {
+		return err
+	}
+
+	return s.Delete(ctx, from)
+}
+
+// validateKey rejects keys that could escape the store's root
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("storage: invalid key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("storage: invalid key %q", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package storage_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAccessKey = "minioadmin"
+	testSecretKey = "minioadmin-secret"
+	testRegion    = "us-east-1"
+	testBucket    = "edms"
+)
+
+// fakeS3 is a minimal in-memory stand-in for MinIO. It checks the Signature
+// Version 4 signature of every request before serving it.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if !f.validSignature(r, body) {
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+
+	prefix := "/" + testBucket + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, prefix)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[key] = body
+	case http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) validSignature(r *http.Request, body []byte) bool {
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+	if r.Header.Get("X-Amz-Content-Sha256") != payloadHash {
+		return false
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	if len(amzDate) < 8 {
+		return false
+	}
+	scope := amzDate[:8] + "/" + testRegion + "/s3/aws4_request"
+
+	canonicalRequest := r.Method + "\n" + r.URL.EscapedPath() + "\n" + r.URL.RawQuery + "\n" +
+		"host:" + r.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n\n" +
+		"host;x-amz-content-sha256;x-amz-date\n" + payloadHash
+	canonicalSum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalSum[:])
+
+	key := []byte("AWS4" + testSecretKey)
+	for _, part := range []string{amzDate[:8], testRegion, "s3", "aws4_request", stringToSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+
+	expected := "AWS4-HMAC-SHA256 Credential=" + testAccessKey + "/" + scope +
+		", SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=" + hex.EncodeToString(key)
+	return r.Header.Get("Authorization") == expected
+}
+
+func newStores(t *testing.T) map[string]storage.Store {
+	local, err := storage.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+
+	server := httptest.NewServer(&fakeS3{objects: map[string][]byte{}})
+	t.Cleanup(server.Close)
+
+	s3, err := storage.NewS3Store(storage.S3Config{
+		Endpoint:  server.URL,
+		Region:    testRegion,
+		Bucket:    testBucket,
+		AccessKey: testAccessKey,
+		SecretKey: testSecretKey,
+	})
+	require.NoError(t, err)
+
+	return map[string]storage.Store{"local": local, "s3": s3}
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	for name, store := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			key := "site_maps/EIT Taradale (v2).svg"
+
+			// Missing objects report ErrNotFound
+			_, err := store.Get(ctx, key)
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+
+			require.NoError(t, store.Put(ctx, key, strings.NewReader("<svg/>"), "image/svg+xml"))
+			data, err := storage.ReadAll(ctx, store, key)
+			require.NoError(t, err)
+			assert.Equal(t, "<svg/>", string(data))
+
+			// Put replaces an existing object
+			require.NoError(t, store.Put(ctx, key, strings.NewReader("<svg></svg>"), "image/svg+xml"))
+			data, err = storage.ReadAll(ctx, store, key)
+			require.NoError(t, err)
+			assert.Equal(t, "<svg></svg>", string(data))
+
+			// Move copies to the new key and removes the old one
+			newKey := "site_maps/EIT_Taradale.svg"
+			require.NoError(t, storage.Move(ctx, store, key, newKey, "image/svg+xml"))
+			_, err = store.Get(ctx, key)
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+			data, err = storage.ReadAll(ctx, store, newKey)
+			require.NoError(t, err)
+			assert.Equal(t, "<svg></svg>", string(data))
+
+			// Delete is idempotent
+			require.NoError(t, store.Delete(ctx, newKey))
+			require.NoError(t, store.Delete(ctx, newKey))
+			_, err = store.Get(ctx, newKey)
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+		})
+	}
+}
+
+func TestStoreRejectsInvalidKeys(t *testing.T) {
+	ctx := context.Background()
+	invalidKeys := []string{"", "/etc/passwd", "../secret", "site_maps/../../secret", "site_maps//map.png", `site_maps\map.png`}
+
+	for name, store := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, key := range invalidKeys {
+				assert.Error(t, store.Put(ctx, key, strings.NewReader("x"), ""), key)
+				_, err := store.Get(ctx, key)
+				assert.Error(t, err, key)
+				assert.Error(t, store.Delete(ctx, key), key)
+			}
+		})
+	}
+}
+
+func TestS3StoreReportsServiceErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	store, err := storage.NewS3Store(storage.S3Config{
+		Endpoint:  server.URL,
+		Bucket:    testBucket,
+		AccessKey: testAccessKey,
+		SecretKey: "wrong",
+	})
+	require.NoError(t, err)
+
+	err = store.Put(context.Background(), "attachments/a.png", strings.NewReader("x"), "image/png")
+	assert.ErrorContains(t, err, "403")
+	_, err = store.Get(context.Background(), "attachments/a.png")
+	assert.ErrorContains(t, err, "AccessDenied")
+}
@@ -0,0 +1,609 @@
+// Package svgmap reads the buildings and rooms drawn on an SVG site map. A shape, or a
+// group of shapes, is recognised by an id, inkscape:label or data-name following the
+// naming convention below, and a text element by its text:
+//
+//	building-<code>           a building, for example building-T or "Building T"
+//	building-<code>-<n>       another shape of the same building, for example building-T-2
+//	room-<building>-<room>    a room of a building, for example room-T-T101
+//
+// The prefix is case insensitive and the separators may be hyphens, underscores or
+// spaces. Maps drawn before the convention, such as EIT_Taradale.svg, name buildings by
+// a short id such as j or n1, which Options.ShortIDs reads as building codes. Positions
+// are in pixels of the image from its top left corner, as it is shown at its own size.
+package svgmap
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	buildingLabelRegex = regexp.MustCompile(`(?i)^\s*(?:building|bldg)[\s_-]+([a-z0-9]+)(?:[\s_-]+\d+)?\s*$`)
+	shortIDRegex       = regexp.MustCompile(`^[A-Za-z][0-9]?$`)
+	roomLabelRegex     = regexp.MustCompile(`(?i)^\s*room[\s_-]+([a-z0-9]+)[\s_-]+([a-z0-9][a-z0-9.]*)\s*$`)
+	transformRegex     = regexp.MustCompile(`([a-zA-Z]+)\s*\(([^)]*)\)`)
+	numberRegex        = regexp.MustCompile(`[+-]?(?:\d+\.?\d*|\.\d+)(?:[eE][+-]?\d+)?`)
+	lengthRegex        = regexp.MustCompile(`^\s*([+-]?(?:\d+\.?\d*|\.\d+)(?:[eE][+-]?\d+)?)\s*(px)?\s*$`)
+)
+
+const inkscapeNamespace = "http://www.inkscape.org/namespaces/inkscape"
+
+// ErrNotSVG is returned when the document has no svg element
+var ErrNotSVG = errors.New("svgmap: not an SVG document")
+
+// Elements whose content is not drawn
+var hiddenElements = map[string]bool{
+	"defs": true, "clipPath": true, "mask": true, "symbol": true, "pattern": true,
+	"marker": true, "title": true, "desc": true, "metadata": true, "style": true,
+	"script": true, "linearGradient": true, "radialGradient": true, "filter": true,
+}
+
+// Options change how shapes are recognised
+type Options struct {
+	// ShortIDs reads ids of a letter and an optional digit, such as j or n1, as the
+	// code of a building in upper case
+	ShortIDs bool
+}
+
+// Feature is a building, or a room when RoomCode is set, found on the map
+type Feature struct {
+	BuildingCode string
+	RoomCode     string
+	// Centre of the feature's shapes, or of its text labels when it has no shapes
+	X, Y float64
+	// Convex outline of the feature's shapes, nil when it is only labelled by text
+	Outline [][2]float64
+}
+
+// Map is what was found on an SVG site map
+type Map struct {
+	// Size the image is shown at, in pixels
+	Width, Height float64
+	Buildings     []Feature
+	Rooms         []Feature
+}
+
+// Label reads a name following the naming convention. The room code is empty for a
+// building and ok is false when the name does not follow the convention.
+func Label(name string) (buildingCode, roomCode string, ok bool) {
+	if m := roomLabelRegex.FindStringSubmatch(name); m != nil {
+		return m[1], m[2], true
+	}
+	if m := buildingLabelRegex.FindStringSubmatch(name); m != nil {
+		return m[1], "", true
+	}
+	return "", "", false
+}
+
+// matrix is an affine transform, x' = a*x + c*y + e and y' = b*x + d*y + f
+type matrix struct{ a, b, c, d, e, f float64 }
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// then returns the transform applying n and then m
+func (m matrix) then(n matrix) matrix {
+	return matrix{
+		a: m.a*n.a + m.c*n.b,
+		b: m.b*n.a + m.d*n.b,
+		c: m.a*n.c + m.c*n.d,
+		d: m.b*n.c + m.d*n.d,
+		e: m.a*n.e + m.c*n.f + m.e,
+		f: m.b*n.e + m.d*n.f + m.f,
+	}
+}
+
+func (m matrix) apply(x, y float64) [2]float64 {
+	return [2]float64{m.a*x + m.c*y + m.e, m.b*x + m.d*y + m.f}
+}
+
+func parseNumbers(s string) []float64 {
+	var numbers []float64
+	for _, n := range numberRegex.FindAllString(s, -1) {
+		if v, err := strconv.ParseFloat(n, 64); err == nil {
+			numbers = append(numbers, v)
+		}
+	}
+	return numbers
+}
+
+// parseTransform reads a transform attribute, unknown functions are ignored
+func parseTransform(s string) matrix {
+	m := identity
+	for _, fn := range transformRegex.FindAllStringSubmatch(s, -1) {
+		args := parseNumbers(fn[2])
+		arg := func(i int, def float64) float64 {
+			if i < len(args) {
+				return args[i]
+			}
+			return def
+		}
+
+		var t matrix
+		switch fn[1] {
+		case "matrix":
+			if len(args) != 6 {
+				continue
+			}
+			t = matrix{args[0], args[1], args[2], args[3], args[4], args[5]}
+		case "translate":
+			t = matrix{1, 0, 0, 1, arg(0, 0), arg(1, 0)}
+		case "scale":
+			sx := arg(0, 1)
+			t = matrix{sx, 0, 0, arg(1, sx), 0, 0}
+		case "rotate":
+			r := arg(0, 0) * math.Pi / 180
+			cx, cy := arg(1, 0), arg(2, 0)
+			t = matrix{1, 0, 0, 1, cx, cy}.
+				then(matrix{math.Cos(r), math.Sin(r), -math.Sin(r), math.Cos(r), 0, 0}).
+				then(matrix{1, 0, 0, 1, -cx, -cy})
+		case "skewX":
+			t = matrix{1, 0, math.Tan(arg(0, 0) * math.Pi / 180), 1, 0, 0}
+		case "skewY":
+			t = matrix{1, math.Tan(arg(0, 0) * math.Pi / 180), 0, 1, 0, 0}
+		default:
+			continue
+		}
+		m = m.then(t)
+	}
+	return m
+}
+
+// elementTransform returns an element's transform, moved to its CSS transform-origin
+// when its style has one
+func elementTransform(transform, style string) matrix {
+	m := parseTransform(transform)
+	for _, declaration := range strings.Split(style, ";") {
+		name, value, found := strings.Cut(declaration, ":")
+		if !found || strings.TrimSpace(name) != "transform-origin" {
+			continue
+		}
+		origin := parseNumbers(value)
+		if len(origin) >= 2 {
+			m = matrix{1, 0, 0, 1, origin[0], origin[1]}.
+				then(m).
+				then(matrix{1, 0, 0, 1, -origin[0], -origin[1]})
+		}
+	}
+	return m
+}
+
+// pathScanner reads the commands and numbers of path data
+type pathScanner struct {
+	s   string
+	pos int
+}
+
+func (p *pathScanner) skipSeparators() {
+	for p.pos < len(p.s) && strings.IndexByte(" \t\r\n,", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// command returns the next command letter, or 0 when numbers follow
+func (p *pathScanner) command() byte {
+	p.skipSeparators()
+	if p.pos < len(p.s) && strings.IndexByte("MmLlHhVvCcSsQqTtAaZz", p.s[p.pos]) >= 0 {
+		p.pos++
+		return p.s[p.pos-1]
+	}
+	return 0
+}
+
+func (p *pathScanner) number() (float64, bool) {
+	p.skipSeparators()
+	loc := numberRegex.FindStringIndex(p.s[p.pos:])
+	if loc == nil || loc[0] != 0 {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(p.s[p.pos:p.pos+loc[1]], 64)
+	if err != nil {
+		return 0, false
+	}
+	p.pos += loc[1]
+	return v, true
+}
+
+// flag reads an arc flag, which may be written without a separator after it
+func (p *pathScanner) flag() (float64, bool) {
+	p.skipSeparators()
+	if p.pos < len(p.s) && (p.s[p.pos] == '0' || p.s[p.pos] == '1') {
+		p.pos++
+		return float64(p.s[p.pos-1] - '0'), true
+	}
+	return 0, false
+}
+
+// pathPoints returns the end point of each segment of path data. Curves are represented
+// by their end points, which is close enough for finding where a shape is.
+func pathPoints(d string) [][2]float64 {
+	var points [][2]float64
+	p := &pathScanner{s: d}
+	var x, y, startX, startY float64
+	var cmd byte
+
+	for {
+		if next := p.command(); next != 0 {
+			cmd = next
+			if cmd == 'Z' || cmd == 'z' {
+				x, y = startX, startY
+				continue
+			}
+		} else if cmd == 0 || p.pos >= len(p.s) {
+			break
+		}
+
+		relative := cmd >= 'a'
+		// Number of arguments of the command and which of them is the end point
+		var args []float64
+		count := map[byte]int{'m': 2, 'l': 2, 'h': 1, 'v': 1, 'c': 6, 's': 4, 'q': 4, 't': 2, 'a': 7}[cmd|0x20]
+		if count == 0 {
+			break
+		}
+		for i := 0; i < count; i++ {
+			var v float64
+			var ok bool
+			if cmd|0x20 == 'a' && (i == 3 || i == 4) {
+				v, ok = p.flag()
+			} else {
+				v, ok = p.number()
+			}
+			if !ok {
+				return points
+			}
+			args = append(args, v)
+		}
+
+		switch cmd | 0x20 {
+		case 'h':
+			if relative {
+				x += args[0]
+			} else {
+				x = args[0]
+			}
+		case 'v':
+			if relative {
+				y += args[0]
+			} else {
+				y = args[0]
+			}
+		default:
+			endX, endY := args[count-2], args[count-1]
+			if relative {
+				x, y = x+endX, y+endY
+			} else {
+				x, y = endX, endY
+			}
+		}
+		points = append(points, [2]float64{x, y})
+
+		if cmd|0x20 == 'm' {
+			startX, startY = x, y
+			// Pairs after a move are lines
+			if relative {
+				cmd = 'l'
+			} else {
+				cmd = 'L'
+			}
+		}
+	}
+	return points
+}
+
+// ellipsePoints returns points around an ellipse
+func ellipsePoints(cx, cy, rx, ry float64) [][2]float64 {
+	points := make([][2]float64, 0, 8)
+	for i := 0; i < 8; i++ {
+		angle := float64(i) * math.Pi / 4
+		points = append(points, [2]float64{cx + rx*math.Cos(angle), cy + ry*math.Sin(angle)})
+	}
+	return points
+}
+
+// shapePoints returns the points of a drawn element in its own coordinates
+func shapePoints(name string, attr func(string) string) [][2]float64 {
+	num := func(key string) float64 {
+		v, _ := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(attr(key)), "px"), 64)
+		return v
+	}
+
+	switch name {
+	case "path":
+		return pathPoints(attr("d"))
+	case "rect":
+		x, y, w, h := num("x"), num("y"), num("width"), num("height")
+		if w <= 0 || h <= 0 {
+			return nil
+		}
+		return [][2]float64{{x, y}, {x + w, y}, {x + w, y + h}, {x, y + h}}
+	case "polygon", "polyline":
+		numbers := parseNumbers(attr("points"))
+		var points [][2]float64
+		for i := 0; i+1 < len(numbers); i += 2 {
+			points = append(points, [2]float64{numbers[i], numbers[i+1]})
+		}
+		return points
+	case "line":
+		return [][2]float64{{num("x1"), num("y1")}, {num("x2"), num("y2")}}
+	case "circle":
+		return ellipsePoints(num("cx"), num("cy"), num("r"), num("r"))
+	case "ellipse":
+		return ellipsePoints(num("cx"), num("cy"), num("rx"), num("ry"))
+	}
+	return nil
+}
+
+// feature collects the points found for a building or room
+type feature struct {
+	buildingCode string
+	roomCode     string
+	points       [][2]float64
+	labels       [][2]float64
+}
+
+type frame struct {
+	hidden  bool
+	ctm     matrix
+	feature *feature
+	text    *textLabel
+}
+
+type textLabel struct {
+	position [2]float64
+	placed   bool
+	content  strings.Builder
+	feature  *feature
+}
+
+// Parse reads the buildings and rooms drawn on an SVG
+func Parse(r io.Reader, options Options) (*Map, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+
+	result := &Map{}
+	features := map[string]*feature{}
+	var order []*feature
+	featureFor := func(buildingCode, roomCode string) *feature {
+		key := buildingCode + "\x00" + roomCode
+		f, ok := features[key]
+		if !ok {
+			f = &feature{buildingCode: buildingCode, roomCode: roomCode}
+			features[key] = f
+			order = append(order, f)
+		}
+		return f
+	}
+
+	var stack []frame
+	foundSVG := false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			attr := func(key string) string {
+				for _, a := range t.Attr {
+					if a.Name.Local == key && a.Name.Space == "" {
+						return a.Value
+					}
+				}
+				return ""
+			}
+
+			parent := frame{ctm: identity}
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			}
+
+			if !foundSVG {
+				if t.Name.Local != "svg" {
+					return nil, ErrNotSVG
+				}
+				foundSVG = true
+				parent.ctm = rootTransform(result, attr("viewBox"), attr("width"), attr("height"))
+			}
+
+			current := frame{
+				hidden:  parent.hidden || hiddenElements[t.Name.Local],
+				ctm:     parent.ctm.then(elementTransform(attr("transform"), attr("style"))),
+				feature: parent.feature,
+				text:    parent.text,
+			}
+			for _, a := range t.Attr {
+				isName := (a.Name.Local == "id" && a.Name.Space == "") ||
+					(a.Name.Local == "label" && (a.Name.Space == inkscapeNamespace || a.Name.Space == "inkscape")) ||
+					(a.Name.Local == "data-name" && a.Name.Space == "")
+				if !isName {
+					continue
+				}
+				if buildingCode, roomCode, ok := Label(a.Value); ok {
+					current.feature = featureFor(buildingCode, roomCode)
+					break
+				}
+				if options.ShortIDs && a.Name.Local == "id" && len(stack) > 0 && shortIDRegex.MatchString(a.Value) {
+					current.feature = featureFor(strings.ToUpper(a.Value), "")
+					break
+				}
+			}
+
+			if !current.hidden {
+				if t.Name.Local == "text" {
+					current.text = &textLabel{feature: current.feature}
+				}
+				if current.text != nil && !current.text.placed {
+					x, xErr := firstNumber(attr("x"))
+					y, yErr := firstNumber(attr("y"))
+					if xErr == nil && yErr == nil {
+						current.text.position = current.ctm.apply(x, y)
+						current.text.placed = true
+					}
+				}
+				if current.feature != nil && current.text == nil {
+					for _, point := range shapePoints(t.Name.Local, attr) {
+						current.feature.points = append(current.feature.points, current.ctm.apply(point[0], point[1]))
+					}
+				}
+			}
+			stack = append(stack, current)
+
+		case xml.CharData:
+			if len(stack) > 0 && stack[len(stack)-1].text != nil && !stack[len(stack)-1].hidden {
+				stack[len(stack)-1].text.content.Write(t)
+			}
+
+		case xml.EndElement:
+			if len(stack) == 0 {
+				continue
+			}
+			current := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			// A text element labels the feature its text names, or the feature it is in
+			if t.Name.Local == "text" && current.text != nil && current.text.placed {
+				label := current.text
+				if buildingCode, roomCode, ok := Label(label.content.String()); ok {
+					f := featureFor(buildingCode, roomCode)
+					f.labels = append(f.labels, label.position)
+				} else if label.feature != nil {
+					label.feature.labels = append(label.feature.labels, label.position)
+				}
+			}
+		}
+	}
+
+	if !foundSVG {
+		return nil, ErrNotSVG
+	}
+
+	for _, f := range order {
+		found := Feature{BuildingCode: f.buildingCode, RoomCode: f.roomCode}
+		switch {
+		case len(f.points) > 0:
+			found.Outline = convexHull(f.points)
+			found.X, found.Y = centroid(found.Outline)
+		case len(f.labels) > 0:
+			found.X, found.Y = average(f.labels)
+		default:
+			continue
+		}
+
+		if found.RoomCode == "" {
+			result.Buildings = append(result.Buildings, found)
+		} else {
+			result.Rooms = append(result.Rooms, found)
+		}
+	}
+
+	return result, nil
+}
+
+// rootTransform sets the size the image is shown at and returns the transform from the
+// SVG's user space to image pixels
+func rootTransform(m *Map, viewBox, width, height string) matrix {
+	box := parseNumbers(viewBox)
+	w, wErr := parseLength(width)
+	h, hErr := parseLength(height)
+
+	if len(box) != 4 || box[2] <= 0 || box[3] <= 0 {
+		m.Width, m.Height = w, h
+		return identity
+	}
+	if wErr != nil {
+		w = box[2]
+	}
+	if hErr != nil {
+		h = box[3]
+	}
+	m.Width, m.Height = w, h
+	return matrix{w / box[2], 0, 0, h / box[3], 0, 0}.then(matrix{1, 0, 0, 1, -box[0], -box[1]})
+}
+
+// parseLength reads a length in pixels, other units are not supported
+func parseLength(s string) (float64, error) {
+	m := lengthRegex.FindStringSubmatch(s)
+	if m == nil {
+		return 0, errors.New("svgmap: unsupported length")
+	}
+	return strconv.ParseFloat(m[1], 64)
+}
+
+// firstNumber reads the first of a list of numbers, as in a text element's x and y
+func firstNumber(s string) (float64, error) {
+	numbers := parseNumbers(s)
+	if len(numbers) == 0 {
+		return 0, errors.New("svgmap: no number")
+	}
+	return numbers[0], nil
+}
+
+func average(points [][2]float64) (float64, float64) {
+	var x, y float64
+	for _, p := range points {
+		x += p[0]
+		y += p[1]
+	}
+	return x / float64(len(points)), y / float64(len(points))
+}
+
+// centroid returns the centre of the area of a polygon, or the average of its points
+// when it has no area
+func centroid(polygon [][2]float64) (float64, float64) {
+	var area, cx, cy float64
+	for i := range polygon {
+		p, q := polygon[i], polygon[(i+1)%len(polygon)]
+		cross := p[0]*q[1] - q[0]*p[1]
+		area += cross
+		cx += (p[0] + q[0]) * cross
+		cy += (p[1] + q[1]) * cross
+	}
+	if math.Abs(area) < 1e-9 {
+		return average(polygon)
+	}
+	return cx / (3 * area), cy / (3 * area)
+}
+
+// convexHull returns the convex hull of the points, in order around it
+func convexHull(points [][2]float64) [][2]float64 {
+	sorted := append([][2]float64(nil), points...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i][0] != sorted[j][0] {
+			return sorted[i][0] < sorted[j][0]
+		}
+		return sorted[i][1] < sorted[j][1]
+	})
+	if len(sorted) < 3 {
+		return sorted
+	}
+
+	cross := func(o, a, b [2]float64) float64 {
+		return (a[0]-o[0])*(b[1]-o[1]) - (a[1]-o[1])*(b[0]-o[0])
+	}
+	hull := make([][2]float64, 0, 2*len(sorted))
+	for _, p := range sorted {
+		for len(hull) >= 2 && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	lower := len(hull) + 1
+	for i := len(sorted) - 2; i >= 0; i-- {
+		p := sorted[i]
+		for len(hull) >= lower && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	return hull[:len(hull)-1]
+}
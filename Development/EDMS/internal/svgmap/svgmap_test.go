@@ -0,0 +1,92 @@
+package svgmap_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AlexGithub777/BAP---Project/Development/EDMS/internal/svgmap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The viewBox starts at 100,100 and is shown at twice its size, so a point at x,y is at
+// 2*(x-100), 2*(y-100) on the image
+const testMap = `<?xml version="1.0" encoding="utf-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:inkscape="http://www.inkscape.org/namespaces/inkscape"
+	id="svg2" viewBox="100 100 200 100" width="400px" height="200px">
+	<defs>
+		<clipPath id="building-X"><rect x="100" y="100" width="200" height="100"/></clipPath>
+	</defs>
+	<g id="g10" transform="translate(100 100)">
+		<rect id="building-A" x="10" y="10" width="20" height="10"/>
+		<g inkscape:label="Building B" transform="scale(2)">
+			<path id="path14" d="M 40,10 h 10 v 10 H 40 Z"/>
+		</g>
+		<path id="room-A-A101" d="m 10,10 l 10,0 0,10 -10,0 z"/>
+		<text x="150" y="50"><tspan>Building C</tspan></text>
+		<path id="j" d="M 0,60 H 10 V 70 H 0 Z"/>
+		<path id="building-D-1" d="M 150,0 H 160 V 10 H 150 Z"/>
+		<path id="building-D-2" d="M 170,0 H 180 V 10 H 170 Z"/>
+	</g>
+</svg>`
+
+func TestParse(t *testing.T) {
+	m, err := svgmap.Parse(strings.NewReader(testMap), svgmap.Options{})
+	require.NoError(t, err)
+
+	assert.Equal(t, 400.0, m.Width)
+	assert.Equal(t, 200.0, m.Height)
+
+	buildings := map[string]svgmap.Feature{}
+	for _, b := range m.Buildings {
+		buildings[b.BuildingCode] = b
+	}
+	require.Len(t, buildings, 4, "the clip path and short id j are not buildings")
+
+	a := buildings["A"]
+	assert.InDelta(t, 40.0, a.X, 1e-9)
+	assert.InDelta(t, 30.0, a.Y, 1e-9)
+	assert.ElementsMatch(t, [][2]float64{{20, 20}, {60, 20}, {60, 40}, {20, 40}}, a.Outline)
+
+	// Transforms of the labelled group apply to its shapes
+	b := buildings["B"]
+	assert.InDelta(t, 180.0, b.X, 1e-9)
+	assert.InDelta(t, 60.0, b.Y, 1e-9)
+
+	// A text label gives a position without an outline
+	c := buildings["C"]
+	assert.InDelta(t, 300.0, c.X, 1e-9)
+	assert.InDelta(t, 100.0, c.Y, 1e-9)
+	assert.Nil(t, c.Outline)
+
+	// Numbered shapes of a building are outlined together
+	d := buildings["D"]
+	assert.InDelta(t, 330.0, d.X, 1e-9)
+	assert.Len(t, d.Outline, 4)
+
+	require.Len(t, m.Rooms, 1)
+	assert.Equal(t, "A", m.Rooms[0].BuildingCode)
+	assert.Equal(t, "A101", m.Rooms[0].RoomCode)
+	assert.InDelta(t, 30.0, m.Rooms[0].X, 1e-9)
+	assert.InDelta(t, 30.0, m.Rooms[0].Y, 1e-9)
+}
+
+func TestParseShortIDs(t *testing.T) {
+	m, err := svgmap.Parse(strings.NewReader(testMap), svgmap.Options{ShortIDs: true})
+	require.NoError(t, err)
+
+	var j *svgmap.Feature
+	for i := range m.Buildings {
+		if m.Buildings[i].BuildingCode == "J" {
+			j = &m.Buildings[i]
+		}
+	}
+	require.NotNil(t, j)
+	assert.InDelta(t, 10.0, j.X, 1e-9)
+	assert.InDelta(t, 130.0, j.Y, 1e-9)
+}
+
+func TestParseNotSVG(t *testing.T) {
+	_, err := svgmap.Parse(strings.NewReader(`<html><body></body></html>`), svgmap.Options{})
+	assert.ErrorIs(t, err, svgmap.ErrNotSVG)
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// locations caches the time zones loaded by LoadLocation, as time.LoadLocation reads the
+// zone database every time
+var locations sync.Map
+
+// LoadLocation returns the time zone with an IANA name such as Pacific/Auckland. Unlike
+// time.LoadLocation an empty name is an error rather than UTC.
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return nil, errors.New("time zone is required")
+	}
+	if location, ok := locations.Load(name); ok {
+		return location.(*time.Location), nil
+	}
+
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, location)
+	return location, nil
+}
+
+// InLocation moves a time into the named time zone, leaving it as it is when the zone is
+// not known
+func InLocation(t time.Time, name string) time.Time {
+	if location, err := LoadLocation(name); err == nil {
+		return t.In(location)
+	}
+	return t
+}
@@ -0,0 +1,150 @@
+// Package webhook sends signed JSON event payloads to other systems. Receivers check a
+// payload came from EDMS by recomputing the signature header with their endpoint secret:
+//
+//	X-EDMS-Signature: sha256=hex(HMAC-SHA256(secret, X-EDMS-Timestamp + "." + body))
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Events endpoints can subscribe to
+const (
+	EventDeviceCreated       = "device.created"
+	EventDeviceStatusChanged = "device.status_changed"
+	EventDeviceExpired       = "device.expired"
+	EventInspectionCreated   = "inspection.created"
+	EventInspectionFailed    = "inspection.failed"
+	// Sent on request to check an endpoint is set up, endpoints do not subscribe to it
+	EventPing = "webhook.ping"
+)
+
+// Events lists the events endpoints can subscribe to
+var Events = []string{
+	EventDeviceCreated,
+	EventDeviceStatusChanged,
+	EventDeviceExpired,
+	EventInspectionCreated,
+	EventInspectionFailed,
+}
+
+// Request headers sent with each delivery
+const (
+	HeaderEvent     = "X-EDMS-Event"
+	HeaderDelivery  = "X-EDMS-Delivery"
+	HeaderTimestamp = "X-EDMS-Timestamp"
+	HeaderSignature = "X-EDMS-Signature"
+)
+
+const (
+	// A delivery is dead-lettered after this many failed attempts, about 17 hours after
+	// the first
+	MaxAttempts = 12
+	// Wait before the first retry, doubled for each later one
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 12 * time.Hour
+	// Longest response body kept in the delivery log
+	maxResponseBody = 1024
+)
+
+// NewSecret returns a random endpoint secret
+func NewSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature header value of a payload sent at the given Unix time
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether a signature header value matches the payload
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Backoff returns how long to wait after the given number of failed attempts
+func Backoff(attempts int) time.Duration {
+	wait := baseBackoff
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return wait
+}
+
+// Delivery is a payload to send to an endpoint
+type Delivery struct {
+	ID     int
+	Event  string
+	URL    string
+	Secret string
+	Body   []byte
+}
+
+// Result is the outcome of one attempt to deliver
+type Result struct {
+	StatusCode   int // 0 if no response was received
+	ResponseBody string
+	Err          error
+	Duration     time.Duration
+}
+
+// OK reports whether the endpoint accepted the delivery with a 2xx response
+func (r Result) OK() bool {
+	return r.Err == nil && r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// Send posts a delivery to its endpoint
+func Send(ctx context.Context, client *http.Client, delivery Delivery, now time.Time) Result {
+	start := time.Now()
+	result := Result{}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Body))
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "EDMS-Webhooks/1")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.Itoa(delivery.ID))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, delivery.Body))
+
+	resp, err := client.Do(req)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	result.StatusCode = resp.StatusCode
+	result.ResponseBody = string(body)
+	if !result.OK() {
+		result.Err = fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+	return result
+}
@@ -0,0 +1,71 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendSignsPayload(t *testing.T) {
+	secret := "whsec_test"
+	body := []byte(`{"event":"device.created","data":{"device":{"emergency_device_id":1}}}`)
+
+	var received http.Header
+	var receivedBody []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		receivedBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	now := time.Date(2024, 11, 16, 9, 0, 0, 0, time.UTC)
+	result := Send(context.Background(), receiver.Client(), Delivery{
+		ID:     42,
+		Event:  EventDeviceCreated,
+		URL:    receiver.URL,
+		Secret: secret,
+		Body:   body,
+	}, now)
+
+	require.NoError(t, result.Err)
+	assert.True(t, result.OK())
+	assert.Equal(t, http.StatusNoContent, result.StatusCode)
+	assert.Equal(t, body, receivedBody)
+	assert.Equal(t, EventDeviceCreated, received.Get(HeaderEvent))
+	assert.Equal(t, "42", received.Get(HeaderDelivery))
+
+	timestamp, err := strconv.ParseInt(received.Get(HeaderTimestamp), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, now.Unix(), timestamp)
+	assert.True(t, Verify(secret, timestamp, receivedBody, received.Get(HeaderSignature)))
+	assert.False(t, Verify("other secret", timestamp, receivedBody, received.Get(HeaderSignature)))
+	assert.False(t, Verify(secret, timestamp+1, receivedBody, received.Get(HeaderSignature)))
+}
+
+func TestSendReportsRejectedDelivery(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "ticketing system unavailable", http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	result := Send(context.Background(), receiver.Client(), Delivery{URL: receiver.URL, Body: []byte(`{}`)}, time.Now())
+	assert.False(t, result.OK())
+	assert.Error(t, result.Err)
+	assert.Equal(t, http.StatusServiceUnavailable, result.StatusCode)
+	assert.Contains(t, result.ResponseBody, "ticketing system unavailable")
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, Backoff(1))
+	assert.Equal(t, time.Minute, Backoff(2))
+	assert.Equal(t, 4*time.Minute, Backoff(4))
+	assert.Equal(t, maxBackoff, Backoff(MaxAttempts))
+}
@@ -2,15 +2,24 @@
 import {
     updateNotificationsUI,
     refreshAfterChange,
+    handleNotificationCount,
 } from "/static/main/notifications.js";
+import { onServerEvent } from "/static/main/events.js";
 import {
     viewDeviceInspections,
     viewInspectionDetails,
     addInspection,
     initializeInspectionForm,
+    initializeReviseInspectionForm,
 } from "/static/main/inspections.js";
+import { initializeAttachmentForms } from "/static/main/attachments.js";
 
 initializeInspectionForm();
+initializeReviseInspectionForm();
+initializeAttachmentForms();
+
+// The navbar count follows other users' changes
+onServerEvent("notification.count", handleNotificationCount);
 
 document.addEventListener("DOMContentLoaded", async function () {
     if (role === "Admin") {
@@ -297,6 +306,16 @@ fetch("/api/site")
                                     <path d="m15 5 4 4"/>
                                 </svg>
                             </button>
+                            <button class="btn btn-info p-2"
+                                    onclick="importSiteMap(${site.site_id})"
+                                    title="Import Site Map">
+                                <svg xmlns="http://www.w3.org/2000/svg" width="20" height="20" viewBox="0 0 24 24" fill="none"
+                                    stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round">
+                                    <path d="M21 15v4a2 2 0 0 1-2 2H5a2 2 0 0 1-2-2v-4"/>
+                                    <polyline points="17 8 12 3 7 8"/>
+                                    <line x1="12" y1="3" x2="12" y2="15"/>
+                                </svg>
+                            </button>
                             <button class="btn btn-danger p-2 delete-button" 
                                     onclick="showDeleteModal(${site.site_id}, 'site', '${site.site_name}')" 
                                     title="Delete Site">
@@ -338,6 +357,44 @@ fetch("/api/building")
                             <path d="m15 5 4 4"/>
                         </svg>
                     </button>
+                    <button class="btn btn-info p-2" onclick="editBuildingFloorPlan(${building.building_id})"
+                            title="Building Floor Plan">
+                        <svg xmlns="http://www.w3.org/2000/svg" width="20" height="20" viewBox="0 0 24 24" fill="none" 
+                            stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round">
+                            <path d="M20 10c0 6-8 12-8 12s-8-6-8-12a8 8 0 0 1 16 0Z"/>
+                            <circle cx="12" cy="10" r="3"/>
+                        </svg>
+                    </button>
+                    <a class="btn btn-secondary p-2" href="/api/building/${building.building_id}/compliance-report"
+                            title="Download Compliance Report">
+                        <svg xmlns="http://www.w3.org/2000/svg" width="20" height="20" viewBox="0 0 24 24" fill="none" 
+                            stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round">
+                            <path d="M21 15v4a2 2 0 0 1-2 2H5a2 2 0 0 1-2-2v-4"/>
+                            <polyline points="7 10 12 15 17 10"/>
+                            <line x1="12" y1="15" x2="12" y2="3"/>
+                        </svg>
+                    </a>
+                    <button class="btn btn-secondary p-2" onclick="changeLocation('moveBuilding', ${building.building_id})"
+                            title="Move Building to Another Site">
+                        <svg xmlns="http://www.w3.org/2000/svg" width="20" height="20" viewBox="0 0 24 24" fill="none" 
+                            stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round">
+                            <polyline points="5 9 2 12 5 15"/>
+                            <polyline points="9 5 12 2 15 5"/>
+                            <polyline points="15 19 12 22 9 19"/>
+                            <polyline points="19 9 22 12 19 15"/>
+                            <line x1="2" y1="12" x2="22" y2="12"/>
+                            <line x1="12" y1="2" x2="12" y2="22"/>
+                        </svg>
+                    </button>
+                    <button class="btn btn-secondary p-2" onclick="changeLocation('archiveBuilding', ${building.building_id})"
+                            title="Archive Building">
+                        <svg xmlns="http://www.w3.org/2000/svg" width="20" height="20" viewBox="0 0 24 24" fill="none" 
+                            stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round">
+                            <rect x="2" y="3" width="20" height="5" rx="1"/>
+                            <path d="M4 8v11a2 2 0 0 0 2 2h12a2 2 0 0 0 2-2V8"/>
+                            <path d="M10 12h4"/>
+                        </svg>
+                    </button>
                     <button class="btn btn-danger p-2 delete-button" 
                             onclick="showDeleteModal(${building.building_id}, 'building', '${building.building_code}')" 
                             title="Delete Building">
@@ -383,6 +440,18 @@ export function editBuilding(buildingId) {
                 building.building_code;
             document.getElementById("editBuildingSite").value =
                 building.site_id;
+            document.getElementById("editBuildingMapX").value = building
+                .map_x.Valid
+                ? building.map_x.Float64
+                : "";
+            document.getElementById("editBuildingMapY").value = building
+                .map_y.Valid
+                ? building.map_y.Float64
+                : "";
+            document.getElementById("editBuildingMapPolygon").value =
+                building.map_polygon
+                    ? JSON.stringify(building.map_polygon)
+                    : "";
         })
         .catch((error) => {
             console.error("Fetch error: ", error);
@@ -444,6 +513,55 @@ export function editBuilding(buildingId) {
     });
 }
 
+// Fetch floors from the server
+fetch("/api/floor")
+    .then((response) => response.json())
+    .then((floors) => {
+        // Create a table row for each floor
+        const floorRows = floors.map(
+            (floor) => `
+        <tr>
+            <td data-label="Floor">${floor.floor_name}</td>
+            <td data-label="Order">${floor.floor_order}</td>
+            <td data-label="Building Code">${floor.building_code}</td>
+            <td data-label="Site Name">${floor.site_name}</td>
+            <td data-label="Floor Plan">${
+                floor.floor_plan_image_path.Valid
+                    ? `<a href="${floor.floor_plan_image_path.String}" target="_blank">View</a>`
+                    : ""
+            }</td>
+            <td>
+                <div class="btn-group">
+                    <button class="btn btn-warning p-2 edit-floor-button" onclick="editFloor(${floor.floor_id})" 
+                            title="Edit Floor">
+                        <svg xmlns="http://www.w3.org/2000/svg" width="20" height="20" viewBox="0 0 24 24" fill="none" 
+                            stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round">
+                            <path d="M17 3a2.85 2.83 0 1 1 4 4L7.5 20.5 2 22l1.5-5.5Z"/>
+                            <path d="m15 5 4 4"/>
+                        </svg>
+                    </button>
+                    <button class="btn btn-danger p-2 delete-button" 
+                            onclick="showDeleteModal(${floor.floor_id}, 'floor', '${floor.floor_name}')" 
+                            title="Delete Floor">
+                        <svg xmlns="http://www.w3.org/2000/svg" width="20" height="20" viewBox="0 0 24 24" fill="none" 
+                            stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round">
+                            <path d="M3 6h18"/>
+                            <path d="M19 6v14c0 1-1 2-2 2H7c-1 0-2-1-2-2V6"/>
+                            <path d="M8 6V4c0-1 1-2 2-2h4c1 0 2 1 2 2v2"/>
+                            <line x1="10" y1="11" x2="10" y2="17"/>
+                            <line x1="14" y1="11" x2="14" y2="17"/>
+                        </svg>
+                    </button>
+                </div>
+            </td>
+        </tr>
+        `
+        );
+
+        // Add the rows to the floors table
+        $("#floors-table tbody").html(floorRows.join(""));
+    });
+
 // Fetch rooms from the server
 fetch("/api/room")
     .then((response) => response.json())
@@ -453,6 +571,7 @@ fetch("/api/room")
             (room) => `
         <tr>
             <td data-label="Room Code">${room.room_code}</td>
+            <td data-label="Floor">${room.floor_name}</td>
             <td data-label="Building Code">${room.building_code}</td>
             <td data-label="Site Name">${room.site_name}</td>
             <td>
@@ -465,6 +584,27 @@ fetch("/api/room")
                             <path d="m15 5 4 4"/>
                         </svg>
                     </button>
+                    <button class="btn btn-secondary p-2" onclick="changeLocation('moveRoom', ${room.room_id})"
+                            title="Move Room to Another Building">
+                        <svg xmlns="http://www.w3.org/2000/svg" width="20" height="20" viewBox="0 0 24 24" fill="none" 
+                            stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round">
+                            <polyline points="5 9 2 12 5 15"/>
+                            <polyline points="9 5 12 2 15 5"/>
+                            <polyline points="15 19 12 22 9 19"/>
+                            <polyline points="19 9 22 12 19 15"/>
+                            <line x1="2" y1="12" x2="22" y2="12"/>
+                            <line x1="12" y1="2" x2="12" y2="22"/>
+                        </svg>
+                    </button>
+                    <button class="btn btn-secondary p-2" onclick="changeLocation('mergeRoom', ${room.room_id})"
+                            title="Merge Room Into Another">
+                        <svg xmlns="http://www.w3.org/2000/svg" width="20" height="20" viewBox="0 0 24 24" fill="none" 
+                            stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round">
+                            <path d="m8 6 4-4 4 4"/>
+                            <path d="M12 2v10.3a4 4 0 0 1-1.172 2.872L4 22"/>
+                            <path d="m20 22-5-5"/>
+                        </svg>
+                    </button>
                     <button class="btn btn-danger p-2 delete-button" 
                             onclick="showDeleteModal(${room.room_id}, 'room', '${room.room_code}')" 
                             title="Delete Room">
@@ -487,6 +627,33 @@ fetch("/api/room")
         $("#rooms-table tbody").html(roomRows.join(""));
     });
 
+// Fill a room's floor select with the floors of the building, rooms go on the
+// building's lowest floor when none is chosen
+function populateRoomFloors(floorSelect, buildingId, selectedFloorId = null) {
+    floorSelect.html(`<option value="">Default floor</option>`);
+    if (!buildingId) {
+        return;
+    }
+
+    fetch(`/api/floor?buildingId=${buildingId}`)
+        .then((response) => response.json())
+        .then((floors) => {
+            if (!floors || floors.length === 0) {
+                return;
+            }
+            const floorOptions = floors.map(
+                (floor) =>
+                    `<option value="${floor.floor_id}" ${
+                        floor.floor_id === selectedFloorId ? "selected" : ""
+                    }>${floor.floor_name}</option>`
+            );
+            floorSelect.append(floorOptions.join(""));
+        })
+        .catch((error) => {
+            console.error("Error loading floors:", error);
+        });
+}
+
 export function editRoom(roomId) {
     const id = roomId;
 
@@ -551,6 +718,12 @@ export function editRoom(roomId) {
                         );
                     }
 
+                    populateRoomFloors(
+                        $("#editRoomFloor"),
+                        room.building_id,
+                        room.floor_id
+                    );
+
                     // Set other form fields after dropdowns are populated
                     document.getElementById("editRoomID").value = room.room_id;
                     document.getElementById("editRoomCode").value =
@@ -573,6 +746,7 @@ export function editRoom(roomId) {
         .on("change", function () {
             const siteId = $(this).val();
             const buildingSelect = $(".buildingInput");
+            populateRoomFloors($("#editRoomFloor"), null);
 
             if (!siteId) {
                 buildingSelect.html(
@@ -613,6 +787,13 @@ export function editRoom(roomId) {
                 });
         });
 
+    // Reload the floors when the building changes
+    $("#editRoomBuildingCode")
+        .off("change.floor")
+        .on("change.floor", function () {
+            populateRoomFloors($("#editRoomFloor"), $(this).val());
+        });
+
     var editRoomForm = document.getElementById("editRoomForm");
 
     // Add change event listener to building select
@@ -743,6 +924,202 @@ fetch("/api/emergency-device-type")
         $("#device-types-table tbody").html(deviceTypeRows.join(""));
     });
 
+// Fetch the recall register, names are entered by users so they are only set as text
+function loadRecalls() {
+    fetch("/api/recall")
+        .then((response) => response.json())
+        .then((recalls) => {
+            const recallRows = (recalls || []).map((recall) => {
+                const serialNumbers = [
+                    recall.serial_number_from.Valid
+                        ? recall.serial_number_from.String
+                        : "",
+                    recall.serial_number_to.Valid
+                        ? recall.serial_number_to.String
+                        : "",
+                ]
+                    .filter(Boolean)
+                    .join(" to ");
+                const actions = $("<div>", { class: "btn-group" }).append(
+                    $("<button>", {
+                        class: "btn btn-info p-2",
+                        title: "View Recalled Devices",
+                        text: "Devices",
+                    }).click(() => viewRecallDevices(recall.recall_id))
+                );
+                if (!recall.is_closed) {
+                    actions.append(
+                        $("<button>", {
+                            class: "btn btn-secondary p-2",
+                            title: "Close Recall",
+                            text: "Close",
+                        }).click(() => closeRecall(recall.recall_id))
+                    );
+                }
+                return $("<tr>").append(
+                    $("<td>", { "data-label": "Manufacturer" }).text(
+                        recall.manufacturer_name
+                    ),
+                    $("<td>", { "data-label": "Model" }).text(
+                        recall.model_name.Valid ? recall.model_name.String : ""
+                    ),
+                    $("<td>", { "data-label": "Serial Numbers" }).text(
+                        serialNumbers
+                    ),
+                    $("<td>", { "data-label": "Batch Number" }).text(
+                        recall.batch_number.Valid
+                            ? recall.batch_number.String
+                            : ""
+                    ),
+                    $("<td>", { "data-label": "Recall Date" }).text(
+                        recall.recall_date.Valid
+                            ? recall.recall_date.Time.slice(0, 10)
+                            : ""
+                    ),
+                    $("<td>", { "data-label": "Action Required" }).text(
+                        recall.action_required
+                    ),
+                    $("<td>", { "data-label": "Open Devices" }).text(
+                        `${recall.open_devices} of ${recall.affected_devices}` +
+                            (recall.is_closed ? " (closed)" : "")
+                    ),
+                    $("<td>").append(actions)
+                );
+            });
+
+            // Add the rows to the recalls table
+            $("#recalls-table tbody").empty().append(recallRows);
+        })
+        .catch((error) => {
+            console.error("Fetch error:", error);
+        });
+}
+loadRecalls();
+
+// Function to register a recall, the model is optional so any model can be chosen
+export function AddRecall() {
+    // Clear the form before showing it
+    $("#addRecallForm")[0].reset();
+    $("#addRecallForm").removeClass("was-validated");
+    $("#addRecallModel").empty();
+
+    populateDropdown(
+        "#addRecallManufacturer",
+        "/api/manufacturer",
+        "Select a manufacturer",
+        "manufacturer_id",
+        "manufacturer_name"
+    );
+
+    // Show the modal
+    $("#addRecallModal").modal("show");
+}
+
+// Function to list the devices a recall flagged, with a button to resolve each
+export function viewRecallDevices(recallId) {
+    $("#recallDevicesTable tbody").empty();
+
+    fetch(`/api/recall/${recallId}/device`)
+        .then((response) => response.json())
+        .then((deviceRecalls) => {
+            const rows = (deviceRecalls || []).map((deviceRecall) => {
+                const resolved = deviceRecall.resolved_at.Valid
+                    ? $("<span>").text(
+                          deviceRecall.resolved_at.Time.slice(0, 10)
+                      )
+                    : $("<button>", {
+                          class: "btn btn-success btn-sm",
+                          text: "Resolve",
+                      }).click(() =>
+                          resolveDeviceRecall(
+                              recallId,
+                              deviceRecall.emergency_device_id
+                          )
+                      );
+                return $("<tr>").append(
+                    $("<td>", { "data-label": "Serial Number" }).text(
+                        deviceRecall.serial_number.Valid
+                            ? deviceRecall.serial_number.String
+                            : ""
+                    ),
+                    $("<td>", { "data-label": "Batch Number" }).text(
+                        deviceRecall.batch_number.Valid
+                            ? deviceRecall.batch_number.String
+                            : ""
+                    ),
+                    $("<td>", { "data-label": "Location" }).text(
+                        `${deviceRecall.site_name} ${deviceRecall.building_code} ${deviceRecall.room_code}`
+                    ),
+                    $("<td>", { "data-label": "Previous Status" }).text(
+                        deviceRecall.previous_status.Valid
+                            ? deviceRecall.previous_status.String
+                            : ""
+                    ),
+                    $("<td>", { "data-label": "Resolved" }).append(resolved)
+                );
+            });
+            if (rows.length === 0) {
+                rows.push(
+                    $("<tr>").append(
+                        $("<td>", { colspan: 5 }).text(
+                            "No devices match this recall"
+                        )
+                    )
+                );
+            }
+            $("#recallDevicesTable tbody").append(rows);
+        })
+        .catch((error) => {
+            console.error("Fetch error:", error);
+        });
+
+    // Show the modal
+    $("#recallDevicesModal").modal("show");
+}
+
+// Function to record the recall action has been done on a device
+function resolveDeviceRecall(recallId, deviceId) {
+    fetch(`/api/recall/${recallId}/device/${deviceId}/resolve`, {
+        method: "PUT",
+    })
+        .then((response) => response.json())
+        .then((data) => {
+            if (data.error) {
+                Toastify({
+                    text: data.error,
+                    duration: 6000,
+                    close: true,
+                    gravity: "top",
+                    position: "center",
+                    backgroundColor:
+                        "linear-gradient(to right, #ff5f6d, #ffc371)",
+                }).showToast();
+            }
+            viewRecallDevices(recallId);
+            loadRecalls();
+        })
+        .catch((error) => {
+            console.error("Fetch error:", error);
+        });
+}
+
+// Function to stop a recall flagging further devices
+function closeRecall(recallId) {
+    if (!confirm("Close this recall? Devices it has flagged stay flagged.")) {
+        return;
+    }
+    fetch(`/api/recall/${recallId}/close`, {
+        method: "PUT",
+    })
+        .then((response) => response.json())
+        .then((data) => {
+            window.location.href = data.redirectURL;
+        })
+        .catch((error) => {
+            console.error("Fetch error:", error);
+        });
+}
+
 export function editDeviceType(deviceTypeId) {
     const id = deviceTypeId;
     document.getElementById("editDeviceTypeID").value = id;
@@ -837,6 +1214,9 @@ export function editSite(siteId) {
             $("#editSiteForm input[name=editSiteAddress]").val(
                 site.site_address
             );
+            $("#editSiteForm input[name=editSiteTimeZone]").val(
+                site.time_zone
+            );
 
             // Set the form action to the update endpoint for this site
             $("#editSiteForm").attr("action", `/api/site/${site.site_id}`);
@@ -844,11 +1224,7 @@ export function editSite(siteId) {
             // Set the form method to POST
             $("#editSiteForm").attr("method", "POST");
 
-            // Check if the site is the main site
-            // If it is, hide the image input
-            if (site.site_id != 1) {
-                $("#editSiteImgInput").show();
-            }
+            $("#editSiteImgInput").show();
 
             // Check if the image path is valid
             if (site.site_map_image_path.Valid) {
@@ -859,14 +1235,6 @@ export function editSite(siteId) {
                 );
                 $("#currentSiteMapContainer").show();
             }
-            if (site.site_id == 1) {
-                $("#editSiteForm img[name=currentSiteMap]").attr(
-                    "src",
-                    "/static/site_maps/EIT_Taradale.svg"
-                );
-                $("#currentSiteMapContainer").show();
-                $("#editSiteImgInput").hide();
-            }
         });
     // Show the modal
 
@@ -941,6 +1309,408 @@ export function AddBuilding() {
     );
 }
 
+export function AddFloor() {
+    // Clear the form before showing it
+    document.getElementById("addFloorForm").reset();
+    document.getElementById("addFloorForm").classList.remove("was-validated");
+
+    // Floors are added to any building, so list them all with their site
+    fetch("/api/building")
+        .then((response) => response.json())
+        .then((buildings) => {
+            const buildingOptions = (buildings || []).map(
+                (building) =>
+                    `<option value="${building.building_id}">${building.building_code} (${building.site_name})</option>`
+            );
+            $("#addFloorBuilding").html(
+                `<option value="">Select a Building</option>` +
+                    buildingOptions.join("")
+            );
+        })
+        .catch((error) => {
+            console.error("Error loading buildings:", error);
+        });
+}
+
+// Function to upload or remove a building's floor plan
+export function editBuildingFloorPlan(buildingId) {
+    // Clear the form
+    $("#buildingFloorPlanForm")[0].reset();
+    $("#currentBuildingFloorPlanContainer").hide();
+
+    fetch(`/api/building/${buildingId}`)
+        .then((response) => response.json())
+        .then((building) => {
+            $("#buildingFloorPlanCode").text(building.building_code);
+            $("#buildingFloorPlanForm").attr(
+                "action",
+                `/api/building/${building.building_id}/floor-plan`
+            );
+
+            if (building.floor_plan_image_path.Valid) {
+                $("#currentBuildingFloorPlan").attr(
+                    "src",
+                    building.floor_plan_image_path.String
+                );
+                $("#currentBuildingFloorPlanContainer").show();
+            }
+        });
+
+    // Show the modal
+    $("#buildingFloorPlanModal").modal("show");
+}
+
+// Function to preview and apply the buildings and rooms drawn on an SVG site map
+export function importSiteMap(siteId) {
+    // Clear the form and any earlier preview
+    $("#importSiteMapForm")[0].reset();
+    $("#importSiteMapForm").removeClass("was-validated");
+    $("#importSiteMapForm").data("siteId", siteId);
+    $("#importSiteMapError, #importSiteMapWarnings, #importSiteMapPreview").hide();
+    $("#importSiteMapBuildings tbody, #importSiteMapRooms tbody").empty();
+    $("#applySiteMapBtn").prop("disabled", true);
+
+    fetch(`/api/site/${siteId}`)
+        .then((response) => response.json())
+        .then((site) => {
+            $("#importSiteMapSiteName").text(site.site_name);
+        });
+
+    // Show the modal
+    $("#importSiteMapModal").modal("show");
+}
+
+// Format a map position for the site map import preview
+function formatMapPosition(x, y) {
+    return `${x.toFixed(1)}, ${y.toFixed(1)}`;
+}
+
+// Add a row for each building and room of a site map import, codes are read from the
+// uploaded file so they are only ever set as text
+function showSiteMapImport(proposal) {
+    const actionLabels = {
+        create: "Add",
+        update: "Move",
+        unchanged: "No change",
+        conflict: "Conflict",
+    };
+    // Unchanged rows have nothing to save and conflicting rows cannot be saved
+    const rowCheckbox = (action, index, kind) =>
+        $("<input>", {
+            type: "checkbox",
+            class: "form-check-input import-row",
+            checked: action === "create" || action === "update",
+            disabled: action === "unchanged" || action === "conflict",
+        })
+            .data("index", index)
+            .data("kind", kind);
+
+    const buildingRows = proposal.buildings.map((building, index) => {
+        const current =
+            building.current_map_x.Valid && building.current_map_y.Valid
+                ? formatMapPosition(
+                      building.current_map_x.Float64,
+                      building.current_map_y.Float64
+                  )
+                : "";
+        return $("<tr>").append(
+            $("<td>").append(rowCheckbox(building.action, index, "building")),
+            $("<td>", { "data-label": "Building Code" }).text(
+                building.building_code
+            ),
+            $("<td>", { "data-label": "Change" }).text(
+                actionLabels[building.action]
+            ),
+            $("<td>", { "data-label": "Current Position" }).text(current),
+            $("<td>", { "data-label": "New Position" }).text(
+                formatMapPosition(building.map_x, building.map_y)
+            ),
+            $("<td>", { "data-label": "Outline Points" }).text(
+                building.map_polygon ? building.map_polygon.length : 0
+            )
+        );
+    });
+    const roomRows = proposal.rooms.map((room, index) =>
+        $("<tr>").append(
+            $("<td>").append(rowCheckbox(room.action, index, "room")),
+            $("<td>", { "data-label": "Building Code" }).text(
+                room.building_code
+            ),
+            $("<td>", { "data-label": "Room Code" }).text(room.room_code),
+            $("<td>", { "data-label": "Change" }).text(
+                room.detail
+                    ? `${actionLabels[room.action]}: ${room.detail}`
+                    : actionLabels[room.action]
+            ),
+            $("<td>", { "data-label": "Found At" }).text(
+                formatMapPosition(room.map_x, room.map_y)
+            )
+        )
+    );
+
+    $("#importSiteMapBuildings tbody").empty().append(buildingRows);
+    $("#importSiteMapRooms tbody").empty().append(roomRows);
+    $("#importSiteMapWarnings")
+        .empty()
+        .append(proposal.warnings.map((warning) => $("<li>").text(warning)))
+        .toggle(proposal.warnings.length > 0);
+    $("#importSiteMapPreview").show();
+    $("#applySiteMapBtn").prop(
+        "disabled",
+        $("#importSiteMapPreview .import-row:checked").length === 0
+    );
+}
+
+// Location tree operations, each previewed before it is applied. Fields are the inputs
+// of the location change form the operation uses.
+const locationOperations = {
+    moveRoom: {
+        title: "Move Room",
+        url: (id) => `/api/room/${id}/move`,
+        fields: ["Building", "Floor"],
+        description:
+            "The room's devices move with it. Their pins are cleared if the room changes floor.",
+    },
+    mergeRoom: {
+        title: "Merge Room",
+        url: (id) => `/api/room/${id}/merge`,
+        fields: ["Room"],
+        description:
+            "The room's devices are moved to the chosen room and the room is deleted.",
+    },
+    moveBuilding: {
+        title: "Move Building",
+        url: (id) => `/api/building/${id}/move`,
+        fields: ["Site"],
+        description:
+            "The building's floors, rooms and devices move with it. Its position on the old site map is cleared.",
+    },
+    archiveBuilding: {
+        title: "Archive Building",
+        url: (id) => `/api/building/${id}/archive`,
+        fields: [],
+        description:
+            "The building and its rooms are no longer listed and its devices are made inactive. Their inspection history is kept.",
+    },
+};
+
+// Function to preview and apply a change to the location tree
+export function changeLocation(operation, id) {
+    const settings = locationOperations[operation];
+
+    // Clear the form and any earlier preview
+    $("#locationChangeForm")[0].reset();
+    $("#locationChangeForm").removeClass("was-validated");
+    $("#locationChangeForm").data({ operation: operation, id: id });
+    $("#locationChangeError, #locationChangePreview").hide();
+    $("#locationChangeRows tbody").empty();
+    $("#applyLocationChangeBtn").prop("disabled", true);
+
+    $("#locationChangeTitle").text(settings.title);
+    $("#locationChangeName").text("");
+    $("#locationChangeDescription").text(settings.description);
+    $("#locationChangeForm .location-field").hide();
+    $("#locationChangeForm select").prop("required", false);
+    settings.fields.forEach((field) => {
+        $(`#locationChange${field}Field`).show();
+        $(`#locationChange${field}`).prop("required", field !== "Floor");
+    });
+
+    if (operation === "moveRoom" || operation === "mergeRoom") {
+        fetch(`/api/room/${id}`)
+            .then((response) => response.json())
+            .then((room) => {
+                $("#locationChangeName").text(
+                    `${room.building_code} ${room.room_code}`
+                );
+            });
+    } else {
+        fetch(`/api/building/${id}`)
+            .then((response) => response.json())
+            .then((building) => {
+                $("#locationChangeName").text(building.building_code);
+            });
+    }
+
+    if (settings.fields.includes("Site")) {
+        populateDropdown(
+            "#locationChangeSite",
+            "/api/site",
+            "Select a Site",
+            "site_id",
+            "site_name"
+        );
+    }
+    if (settings.fields.includes("Building")) {
+        populateDropdown(
+            "#locationChangeBuilding",
+            "/api/building",
+            "Select a Building",
+            "building_id",
+            "building_code"
+        ).then((buildings) => {
+            // Building codes are only unique at a site
+            (buildings || []).forEach((building) => {
+                $(
+                    `#locationChangeBuilding option[value="${building.building_id}"]`
+                ).text(`${building.site_name} ${building.building_code}`);
+            });
+        });
+        populateRoomFloors($("#locationChangeFloor"), null);
+    }
+    if (settings.fields.includes("Room")) {
+        // Rooms are only merged into another room at the same site
+        Promise.all([
+            fetch(`/api/room/${id}`).then((response) => response.json()),
+            fetch("/api/room").then((response) => response.json()),
+        ])
+            .then(([current, rooms]) => {
+                const options = (rooms || [])
+                    .filter(
+                        (room) =>
+                            room.room_id !== id &&
+                            room.site_name === current.site_name
+                    )
+                    .map((room) =>
+                        $("<option>", { value: room.room_id }).text(
+                            `${room.site_name} ${room.building_code} ${room.room_code}`
+                        )
+                    );
+                $("#locationChangeRoom")
+                    .empty()
+                    .append(
+                        $("<option>", {
+                            value: "",
+                            selected: true,
+                            disabled: true,
+                        }).text("Select a Room"),
+                        options
+                    );
+            });
+    }
+
+    // Show the modal
+    $("#locationChangeModal").modal("show");
+}
+
+// Add a row for each row a location change affects, names are set as text as they are
+// entered by users
+function showLocationChange(change) {
+    const kindLabels = {
+        building: "Building",
+        room: "Room",
+        device: "Device",
+        inspection_round: "Inspection Round",
+        digest_subscription: "Digest Subscription",
+    };
+    const rows = change.rows.map((row) =>
+        $("<tr>").append(
+            $("<td>", { "data-label": "Type" }).text(
+                kindLabels[row.kind] || row.kind
+            ),
+            $("<td>", { "data-label": "Name" }).text(row.label),
+            $("<td>", { "data-label": "Change" }).text(row.change)
+        )
+    );
+
+    $("#locationChangeRows tbody").empty().append(rows);
+    $("#locationChangePreview").show();
+    $("#applyLocationChangeBtn").prop("disabled", false);
+}
+
+// Function to dry run and apply an import of sites, buildings, floors and rooms
+export function importLocations() {
+    // Clear the form and any earlier dry run
+    $("#importLocationsForm")[0].reset();
+    $("#importLocationsForm").removeClass("was-validated");
+    $("#importLocationsError, #importLocationsPreview").hide();
+    $("#importLocationsRows tbody").empty();
+    $("#applyImportLocationsBtn").prop("disabled", true);
+
+    // Show the modal
+    $("#importLocationsModal").modal("show");
+}
+
+// Add a row for each site, building, floor and room a location import creates or
+// updates, or cannot import. Names are read from the uploaded file so they are only
+// ever set as text.
+function showLocationImport(result) {
+    const actionLabels = {
+        create: "Add",
+        update: "Update",
+        conflict: "Conflict",
+    };
+    const kindLabels = {
+        site: "Site",
+        building: "Building",
+        floor: "Floor",
+        room: "Room",
+    };
+    const rows = result.rows.map((row) =>
+        $("<tr>", {
+            class: row.action === "conflict" ? "table-danger" : "",
+        }).append(
+            $("<td>", { "data-label": "Change" }).text(
+                actionLabels[row.action]
+            ),
+            $("<td>", { "data-label": "Type" }).text(
+                kindLabels[row.kind] || row.kind
+            ),
+            $("<td>", { "data-label": "Site" }).text(row.site_name),
+            $("<td>", { "data-label": "Building" }).text(row.building_code),
+            $("<td>", { "data-label": "Floor" }).text(row.floor_name),
+            $("<td>", { "data-label": "Room" }).text(row.room_code),
+            $("<td>", { "data-label": "Detail" }).text(row.detail)
+        )
+    );
+
+    $("#importLocationsSummary").text(
+        `${result.creates} to add, ${result.updates} to update, ` +
+            `${result.unchanged} unchanged and ${result.conflicts} conflicts` +
+            (result.conflicts > 0 ? ", resolve the conflicts to import" : "")
+    );
+    $("#importLocationsRows tbody").empty().append(rows);
+    $("#importLocationsPreview").show();
+    $("#applyImportLocationsBtn").prop(
+        "disabled",
+        result.conflicts > 0 || result.creates + result.updates === 0
+    );
+}
+
+// Function to edit a floor in the database
+export function editFloor(floorId) {
+    // Clear the form
+    $("#editFloorForm")[0].reset();
+    $("#editFloorForm").removeClass("was-validated");
+    $("#currentFloorPlanContainer").hide();
+
+    // Fetch the floor data from the server
+    fetch(`/api/floor/${floorId}`)
+        .then((response) => response.json())
+        .then((floor) => {
+            // Fill in the form with the floor data
+            $("#editFloorBuilding").val(
+                `${floor.building_code} (${floor.site_name})`
+            );
+            $("#editFloorName").val(floor.floor_name);
+            $("#editFloorOrder").val(floor.floor_order);
+
+            // Set the form action to the update endpoint for this floor
+            $("#editFloorForm").attr("action", `/api/floor/${floor.floor_id}`);
+
+            if (floor.floor_plan_image_path.Valid) {
+                $("#currentFloorPlan").attr(
+                    "src",
+                    floor.floor_plan_image_path.String
+                );
+                $("#currentFloorPlanContainer").show();
+            }
+        });
+
+    // Show the modal
+    $("#editFloorModal").modal("show");
+}
+
 export function AddRoom() {
     // Clear the form before showing it
     document.getElementById("addRoomForm").reset();
@@ -952,10 +1722,18 @@ export function AddRoom() {
     buildingInput.disabled = false;
     buildingInput.classList.remove("is-invalid");
 
-    // Clear the building options
+    // Clear the building and floor options
     $(".buildingInput").html(
         `<option value="" disabled selected>Select a Building</option>`
     );
+    populateRoomFloors($("#addRoomFloor"), null);
+
+    // Reload the floors when the building changes
+    $("#addRoomBuildingCode")
+        .off("change.floor")
+        .on("change.floor", function () {
+            populateRoomFloors($("#addRoomFloor"), $(this).val());
+        });
 
     // populate the site select dropdown
     populateDropdown(
@@ -978,6 +1756,7 @@ export function AddRoom() {
         );
 
         var siteId = document.getElementById("addRoomSite").value;
+        populateRoomFloors($("#addRoomFloor"), null);
 
         // Fetch the buildings for the selected site
         fetch(`/api/building?siteId=${siteId}`)
@@ -1205,6 +1984,365 @@ export function AddRoom() {
     );
 })();
 
+(function () {
+    "use strict";
+
+    // Fetch the form and the submit button
+    var form = document.querySelector("#addFloorForm");
+    var submitButton = document.querySelector("#addFloorBtn");
+
+    // Add event listener to the submit button
+    submitButton.addEventListener(
+        "click",
+        function (event) {
+            if (!form.checkValidity()) {
+                event.preventDefault();
+                event.stopPropagation();
+            } else {
+                // If the form is valid, submit it
+                form.submit();
+            }
+
+            form.classList.add("was-validated");
+        },
+        false
+    );
+})();
+
+(function () {
+    "use strict";
+
+    // Fetch the form and the submit button
+    var form = document.querySelector("#editFloorForm");
+    var submitButton = document.querySelector("#editFloorBtn");
+
+    // Add event listener to the submit button
+    submitButton.addEventListener(
+        "click",
+        function (event) {
+            if (!form.checkValidity()) {
+                event.preventDefault();
+                event.stopPropagation();
+            } else {
+                // If the form is valid, submit it
+                form.submit();
+            }
+
+            form.classList.add("was-validated");
+        },
+        false
+    );
+})();
+
+(function () {
+    "use strict";
+
+    var form = document.querySelector("#buildingFloorPlanForm");
+    var submitButton = document.querySelector("#buildingFloorPlanBtn");
+
+    // Either a new plan or removing the current one is required
+    submitButton.addEventListener(
+        "click",
+        function () {
+            var fileInput = document.querySelector("#buildingFloorPlanImgInput");
+            var removeInput = document.querySelector("#removeBuildingFloorPlan");
+            if (fileInput.files.length === 0 && !removeInput.checked) {
+                fileInput.setCustomValidity("Please choose a floor plan");
+            } else {
+                fileInput.setCustomValidity("");
+            }
+
+            if (form.checkValidity()) {
+                form.submit();
+            }
+
+            form.classList.add("was-validated");
+        },
+        false
+    );
+})();
+
+// Preview and apply a site map import
+(function () {
+    "use strict";
+
+    var form = document.querySelector("#importSiteMapForm");
+    var proposal = null;
+
+    // Upload the site map and show what importing it would change
+    $("#previewSiteMapBtn").click(function () {
+        if (!form.checkValidity()) {
+            form.classList.add("was-validated");
+            return;
+        }
+
+        const siteId = $(form).data("siteId");
+        $("#importSiteMapError").hide();
+        $("#applySiteMapBtn").prop("disabled", true);
+        fetch(`/api/site/${siteId}/map-import`, {
+            method: "POST",
+            body: new FormData(form),
+        })
+            .then((response) => response.json())
+            .then((data) => {
+                if (data.error) {
+                    proposal = null;
+                    $("#importSiteMapPreview").hide();
+                    $("#importSiteMapError").text(data.error).show();
+                    return;
+                }
+                proposal = data;
+                showSiteMapImport(proposal);
+            })
+            .catch((error) => {
+                console.error("Fetch error:", error);
+            });
+    });
+
+    // Only allow applying once something is selected
+    $("#importSiteMapPreview").on("change", ".import-row", function () {
+        $("#applySiteMapBtn").prop(
+            "disabled",
+            $("#importSiteMapPreview .import-row:checked").length === 0
+        );
+    });
+
+    // Save the selected buildings and rooms
+    $("#applySiteMapBtn").click(function () {
+        if (!proposal) {
+            return;
+        }
+
+        const selected = { buildings: [], rooms: [] };
+        $("#importSiteMapPreview .import-row:checked").each(function () {
+            if ($(this).data("kind") === "building") {
+                selected.buildings.push(proposal.buildings[$(this).data("index")]);
+            } else {
+                selected.rooms.push(proposal.rooms[$(this).data("index")]);
+            }
+        });
+
+        fetch(`/api/site/${proposal.site_id}/map-import/apply`, {
+            method: "POST",
+            headers: {
+                "Content-Type": "application/json",
+            },
+            body: JSON.stringify(selected),
+        })
+            .then((response) => response.json())
+            .then((data) => {
+                if (data.error) {
+                    window.location.href = data.redirectURL;
+                } else if (data.message) {
+                    window.location.href = data.redirectURL;
+                } else {
+                    console.error("Unexpected response:", data);
+                    throw new Error("Unexpected response");
+                }
+            })
+            .catch((error) => {
+                console.error("Fetch error:", error);
+            });
+    });
+})();
+
+// Dry run and apply a location import
+(function () {
+    "use strict";
+
+    var form = document.querySelector("#importLocationsForm");
+
+    // A new file needs a new dry run
+    $("#locationTreeFile").change(function () {
+        $("#importLocationsPreview").hide();
+        $("#applyImportLocationsBtn").prop("disabled", true);
+    });
+
+    // Upload the file, it is only a dry run unless apply is set
+    function sendLocationImport(apply) {
+        const formData = new FormData(form);
+        formData.append("apply", apply);
+
+        $("#importLocationsError").hide();
+        return fetch("/api/location-tree/import", {
+            method: "POST",
+            body: formData,
+        }).then((response) => response.json());
+    }
+
+    // Show what importing the file would change
+    $("#previewImportLocationsBtn").click(function () {
+        if (!form.checkValidity()) {
+            form.classList.add("was-validated");
+            return;
+        }
+
+        $("#applyImportLocationsBtn").prop("disabled", true);
+        sendLocationImport(false)
+            .then((data) => {
+                if (data.error) {
+                    $("#importLocationsPreview").hide();
+                    $("#importLocationsError").text(data.error).show();
+                    return;
+                }
+                showLocationImport(data);
+            })
+            .catch((error) => {
+                console.error("Fetch error:", error);
+            });
+    });
+
+    // Import the file once the dry run has been checked
+    $("#applyImportLocationsBtn").click(function () {
+        sendLocationImport(true)
+            .then((data) => {
+                if (data.error) {
+                    window.location.href = data.redirectURL;
+                } else if (data.message) {
+                    window.location.href = data.redirectURL;
+                } else {
+                    console.error("Unexpected response:", data);
+                    throw new Error("Unexpected response");
+                }
+            })
+            .catch((error) => {
+                console.error("Fetch error:", error);
+            });
+    });
+})();
+
+// Preview and apply a change to the location tree
+(function () {
+    "use strict";
+
+    var form = document.querySelector("#locationChangeForm");
+
+    // The floors to move a room to are those of the chosen building
+    $("#locationChangeBuilding").change(function () {
+        populateRoomFloors($("#locationChangeFloor"), $(this).val());
+    });
+
+    // Any change to the form needs a new preview
+    $(form).on("change", "select", function () {
+        $("#locationChangePreview").hide();
+        $("#applyLocationChangeBtn").prop("disabled", true);
+    });
+
+    // Send the location change, it is only previewed unless apply is set
+    function sendLocationChange(apply) {
+        const { operation, id } = $(form).data();
+        const body = {
+            site_id: Number($("#locationChangeSite").val()) || 0,
+            building_id: Number($("#locationChangeBuilding").val()) || 0,
+            floor_id: $("#locationChangeFloor").val() || "",
+            room_id: Number($("#locationChangeRoom").val()) || 0,
+            apply: apply,
+        };
+
+        $("#locationChangeError").hide();
+        return fetch(locationOperations[operation].url(id), {
+            method: "POST",
+            headers: {
+                "Content-Type": "application/json",
+            },
+            body: JSON.stringify(body),
+        }).then((response) => response.json());
+    }
+
+    // Show the rows the change would affect
+    $("#previewLocationChangeBtn").click(function () {
+        if (!form.checkValidity()) {
+            form.classList.add("was-validated");
+            return;
+        }
+
+        $("#applyLocationChangeBtn").prop("disabled", true);
+        sendLocationChange(false)
+            .then((data) => {
+                if (data.error) {
+                    $("#locationChangePreview").hide();
+                    $("#locationChangeError").text(data.error).show();
+                    return;
+                }
+                showLocationChange(data);
+            })
+            .catch((error) => {
+                console.error("Fetch error:", error);
+            });
+    });
+
+    // Apply the previewed change
+    $("#applyLocationChangeBtn").click(function () {
+        sendLocationChange(true)
+            .then((data) => {
+                if (data.error) {
+                    window.location.href = data.redirectURL;
+                } else if (data.message) {
+                    window.location.href = data.redirectURL;
+                } else {
+                    console.error("Unexpected response:", data);
+                    throw new Error("Unexpected response");
+                }
+            })
+            .catch((error) => {
+                console.error("Fetch error:", error);
+            });
+    });
+})();
+
+// Register a recall
+(function () {
+    "use strict";
+
+    var form = document.querySelector("#addRecallForm");
+
+    // Any model of the chosen manufacturer can be recalled, or all of them
+    $("#addRecallManufacturer").change(function () {
+        populateDropdown(
+            "#addRecallModel",
+            `/api/device-model?manufacturer_id=${$(this).val()}`,
+            "Any model",
+            "device_model_id",
+            "model_name"
+        ).then(() => {
+            $("#addRecallModel option:first").prop("disabled", false);
+        });
+    });
+
+    $("#addRecallBtn").click(function () {
+        if (!form.checkValidity()) {
+            form.classList.add("was-validated");
+            return;
+        }
+
+        const jsonData = {};
+        for (const [key, value] of new FormData(form).entries()) {
+            jsonData[key] = value;
+        }
+        fetch("/api/recall", {
+            method: "POST",
+            headers: {
+                "Content-Type": "application/json",
+            },
+            body: JSON.stringify(jsonData),
+        })
+            .then((response) => response.json())
+            .then((data) => {
+                if (data.error) {
+                    window.location.href = data.redirectURL;
+                } else if (data.message) {
+                    window.location.href = data.redirectURL;
+                } else {
+                    console.error("Unexpected response:", data);
+                    throw new Error("Unexpected response");
+                }
+            })
+            .catch((error) => {
+                console.error("Fetch error:", error);
+            });
+    });
+})();
+
 // Make functions available globally
 window.editDeviceType = editDeviceType;
 window.editUser = editUser;
@@ -1213,3 +2351,11 @@ window.editRoom = editRoom;
 window.editSite = editSite;
 window.AddBuilding = AddBuilding;
 window.AddRoom = AddRoom;
+window.AddFloor = AddFloor;
+window.editFloor = editFloor;
+window.editBuildingFloorPlan = editBuildingFloorPlan;
+window.importSiteMap = importSiteMap;
+window.changeLocation = changeLocation;
+window.importLocations = importLocations;
+window.AddRecall = AddRecall;
+window.viewRecallDevices = viewRecallDevices;
@@ -4,17 +4,47 @@ import {
     updateNotificationsUI,
     refreshNotificationsPreservingCleared,
     refreshAfterChange,
+    handleNotificationCount,
 } from "/static/main/notifications.js";
 
+// dashboard.js
+import { onServerEvent } from "/static/main/events.js";
+
 // dashboard.js
 import {
     viewDeviceInspections,
     viewInspectionDetails,
     addInspection,
     initializeInspectionForm,
+    initializeReviseInspectionForm,
 } from "/static/main/inspections.js";
 
+// dashboard.js
+import {
+    viewInspectionRounds,
+    viewInspectionRound,
+    addInspectionRound,
+    inspectRoundItem,
+    skipRoundItem,
+    cancelSkipRoundItem,
+    submitSkipRoundItem,
+    reopenRoundItem,
+    initializeInspectionRoundForm,
+} from "/static/main/rounds.js";
+
+// dashboard.js
+import { viewFloorPlan, removeDevicePin } from "/static/dashboard/floor_plan.js";
+
+// dashboard.js
+import {
+    showAttachments,
+    initializeAttachmentForms,
+} from "/static/main/attachments.js";
+
 initializeInspectionForm();
+initializeReviseInspectionForm();
+initializeInspectionRoundForm();
+initializeAttachmentForms();
 
 // Leaflet map setup
 let map;
@@ -27,47 +57,39 @@ function initializeMap(containerId, options = {}) {
     map = L.map(containerId, { ...defaultOptions, ...options });
 }
 
-function createEitTaradaleMap() {
-    const svgDimensions = { width: 561.568, height: 962.941 };
-    const minCoordinates = { x: 128.009, y: 82.331 };
-    const imageUrl = "/static/site_maps/EIT_Taradale.svg";
-    const bounds = [
-        [0, 0],
-        [svgDimensions.height, svgDimensions.width],
-    ];
-
-    L.imageOverlay(imageUrl, bounds).addTo(map);
-
-    fetchBuildingsData()
-        .then((data) => renderBuildings(data, svgDimensions, minCoordinates))
-        .catch((error) =>
-            console.error("Error fetching building data:", error)
-        );
-
-    map.fitBounds(bounds);
-}
-
-function fetchBuildingsData() {
-    return fetch("static/assets/buildings.json").then((response) =>
-        response.json()
-    );
-}
-
-function renderBuildings(data, svgDimensions, minCoordinates) {
-    data.buildings.forEach((building) => {
-        const x = building.coordinates.x - minCoordinates.x;
-        const y =
-            svgDimensions.height - (building.coordinates.y - minCoordinates.y);
-
-        const rectangle = L.rectangle([
-            [y - 19, x],
-            [y, x + 19],
-        ]).addTo(map);
+// Size of the square drawn for buildings without an outline, in site map pixels
+const buildingMarkerSize = 19;
+
+// Draws the site's buildings on the map from their positions, which are in pixels of
+// the site map image from its top left corner
+function renderBuildings(buildings, imgHeight) {
+    // Leaflet's y axis points up from the bottom of the image
+    const toLatLng = ([x, y]) => [imgHeight - y, x];
+
+    buildings.forEach((building) => {
+        let shape;
+        if (building.map_polygon && building.map_polygon.length >= 3) {
+            shape = L.polygon(building.map_polygon.map(toLatLng));
+        } else if (building.map_x.Valid && building.map_y.Valid) {
+            const half = buildingMarkerSize / 2;
+            const x = building.map_x.Float64;
+            const y = building.map_y.Float64;
+            shape = L.rectangle([
+                toLatLng([x - half, y + half]),
+                toLatLng([x + half, y - half]),
+            ]);
+        } else {
+            return;
+        }
 
-        rectangle.on("click", () => {
-            filterByBuilding(building.name);
-            filterByRoom();
-        });
+        shape
+            .bindTooltip(building.building_code)
+            .addTo(map)
+            .on("click", () => {
+                filterByBuilding(building.building_code);
+                filterByFloor();
+                filterByRoom();
+            });
     });
 }
 
@@ -93,13 +115,16 @@ function getFilterOptions() {
 export function clearFilters() {
     // Reset each filter dropdown to its first option (except site filter)
     document.getElementById("buildingFilter").selectedIndex = 0;
+    document.getElementById("floorFilter").selectedIndex = 0;
     document.getElementById("roomFilter").selectedIndex = 0;
     document.getElementById("deviceTypeFilter").selectedIndex = 0;
     document.getElementById("statusFilter").selectedIndex = 0;
     document.getElementById("searchInput").value = ""; // Clear search input
+    updateFloorPlanButton();
 
     // Reset active filters
     activeFilters = {
+        floor: null,
         room: null,
         deviceType: null,
         status: null,
@@ -153,6 +178,7 @@ function addDefaultOption(select, text) {
 function setupBuildingFilter() {
     document.getElementById("buildingFilter").addEventListener("change", () => {
         filterByBuilding();
+        clearFloorFilter();
         clearRoomFilter();
         clearTableBody();
     });
@@ -160,10 +186,30 @@ function setupBuildingFilter() {
 
 function setupRoomFilter() {
     document.getElementById("buildingFilter").addEventListener("change", () => {
+        filterByFloor();
         filterByRoom();
     });
 }
 
+function clearFloorFilter() {
+    const floorSelect = document.getElementById("floorFilter");
+    floorSelect.innerHTML = "";
+    addDefaultOption(floorSelect, "All Floors");
+    activeFilters.floor = null;
+    updateFloorPlanButton();
+}
+
+// The floor plan button is shown once a building is selected
+function updateFloorPlanButton() {
+    const buildingId = document.getElementById("buildingFilter").value;
+    document
+        .getElementById("floorPlanBtn")
+        .classList.toggle(
+            "d-none",
+            !buildingId || buildingId === "All Buildings"
+        );
+}
+
 function clearRoomFilter() {
     const roomSelect = document.getElementById("roomFilter");
     roomSelect.innerHTML = "";
@@ -174,6 +220,7 @@ function clearBuildingFilter() {
     const buildingSelect = document.getElementById("buildingFilter");
     buildingSelect.innerHTML = "";
     addDefaultOption(buildingSelect, "All Buildings");
+    updateFloorPlanButton();
 }
 
 function filterBySite() {
@@ -191,6 +238,7 @@ function filterBySite() {
             "All Buildings"
         );
 
+        clearFloorFilter();
         clearRoomFilter();
     }
 
@@ -203,23 +251,6 @@ function filterBySite() {
         return;
     }
 
-    if (siteId === "1") {
-        // Hard coded - EIT Taradale should always also be id = 1, as its the first site inserted into the database (see seed.go)
-        // Clear the map layers
-        map.eachLayer((layer) => {
-            if (
-                layer instanceof L.ImageOverlay ||
-                layer instanceof L.Rectangle
-            ) {
-                map.removeLayer(layer);
-            }
-        });
-        showMap();
-        createEitTaradaleMap();
-        loadDevicesAndUpdateTable("", siteId);
-        return;
-    }
-
     loadDevicesAndUpdateTable("", siteId);
     clearRoomFilter();
     updateMapForSite(siteId);
@@ -227,10 +258,9 @@ function filterBySite() {
 
 function filterByBuilding(buildingCode) {
     const buildingFilter = document.getElementById("buildingFilter");
-    var siteId;
+    var siteId = document.getElementById("siteFilter").value;
 
     if (buildingCode) {
-        siteId = "1";
         // Loop through `buildingFilter` options to select the one with matching text
         for (const option of buildingFilter.options) {
             if (option.text === buildingCode) {
@@ -241,7 +271,6 @@ function filterByBuilding(buildingCode) {
     } else {
         // If `buildingCode` is not provided, use the selected dropdown value
         buildingCode = buildingFilter.selectedOptions[0].text;
-        siteId = document.getElementById("siteFilter").value;
     }
 
     // Fetch devices based on `buildingCode` and `siteId`
@@ -250,13 +279,33 @@ function filterByBuilding(buildingCode) {
     } else {
         loadDevicesAndUpdateTable(buildingCode, siteId);
     }
+    updateFloorPlanButton();
+}
+
+function filterByFloor() {
+    const selectedBuilding = document.getElementById("buildingFilter").value;
+
+    if (selectedBuilding != "All Buildings") {
+        fetchAndPopulateSelect(
+            `/api/floor?buildingId=${selectedBuilding}`,
+            "floorFilter",
+            "floor_name",
+            "floor_id",
+            "All Floors"
+        );
+    }
 }
 
 function filterByRoom() {
     const selectedBuilding = document.getElementById("buildingFilter").value;
+    const selectedFloor = document.getElementById("floorFilter").value;
 
     if (selectedBuilding != "All Buildings") {
-        fetch(`/api/room?buildingId=${selectedBuilding}`)
+        let url = `/api/room?buildingId=${selectedBuilding}`;
+        if (selectedFloor && selectedFloor !== "All Floors") {
+            url += `&floorId=${selectedFloor}`;
+        }
+        fetch(url)
             .then((response) => response.json())
             .then((data) => {
                 const roomSelect = document.getElementById("roomFilter");
@@ -313,7 +362,7 @@ function updateMapForSite(siteId) {
                 map.eachLayer((layer) => {
                     if (
                         layer instanceof L.ImageOverlay ||
-                        layer instanceof L.Rectangle
+                        layer instanceof L.Polygon
                     ) {
                         map.removeLayer(layer);
                     }
@@ -321,6 +370,15 @@ function updateMapForSite(siteId) {
 
                 L.imageOverlay(imageUrl, newBounds).addTo(map);
                 map.fitBounds(newBounds);
+
+                fetch(`/api/building?siteId=${siteId}`)
+                    .then((response) => response.json())
+                    .then((buildings) =>
+                        renderBuildings(buildings || [], imgHeight)
+                    )
+                    .catch((error) =>
+                        console.error("Error fetching building data:", error)
+                    );
             };
         })
         .catch((error) => console.error("Error updating map:", error));
@@ -359,12 +417,21 @@ let allDevices = [];
 
 // Keep track of active filters
 let activeFilters = {
+    floor: null,
     room: null,
     deviceType: null,
     status: null,
 };
 
 // Add event listeners for the new filters
+document.getElementById("floorFilter").addEventListener("change", () => {
+    filterTableByFloor();
+    clearRoomFilter();
+    filterByRoom();
+    clearTableBody();
+    updateTable();
+});
+
 document.getElementById("roomFilter").addEventListener("change", () => {
     filterTableByRoom();
     clearTableBody();
@@ -385,8 +452,13 @@ document.getElementById("statusFilter").addEventListener("change", () => {
 
 let filteredDevices = [];
 
+// The building and site the table was last loaded for, reloaded on live updates
+let deviceQuery = { buildingCode: "", siteId: "" };
+
 // Modify the dashboard version of getAllDevices to update the table
 async function loadDevicesAndUpdateTable(buildingCode = "", siteId = "") {
+    deviceQuery = { buildingCode, siteId };
+    linkedDeviceId = null;
     const devices = await getAllDevices(buildingCode, siteId);
     allDevices = devices; // Update global variable if needed
     filteredDevices = devices; // Initialize filtered devices
@@ -423,6 +495,15 @@ function updateTable() {
 }
 
 // Filter functions for each criteria
+function filterTableByFloor() {
+    const selectedFloor = document.getElementById("floorFilter").value;
+
+    activeFilters.floor =
+        selectedFloor === "All Floors" ? null : Number(selectedFloor);
+    activeFilters.room = null;
+    applyFilters();
+}
+
 function filterTableByRoom() {
     const roomSelect = document.getElementById("roomFilter");
     const selectedRoom = roomSelect.value;
@@ -474,9 +555,18 @@ function filterTableByStatus() {
 
 // Apply all active filters
 function applyFilters() {
+    linkedDeviceId = null;
+
     // Start with all devices
     filteredDevices = [...allDevices];
 
+    // Apply floor filter if active
+    if (activeFilters.floor) {
+        filteredDevices = filteredDevices.filter(
+            (device) => device.floor_id === activeFilters.floor
+        );
+    }
+
     // Apply room filter if active
     if (activeFilters.room && activeFilters.room !== "All Rooms") {
         filteredDevices = filteredDevices.filter(
@@ -632,8 +722,61 @@ document.getElementById("rowsPerPage").addEventListener("change", (e) => {
     updateTable();
 });
 
+// A link to a device, such as from a calendar event, shows only that device until the
+// filters or search are changed
+let linkedDeviceId = null;
+
+function showLinkedDevice() {
+    filteredDevices = allDevices.filter(
+        (device) => device.emergency_device_id === linkedDeviceId
+    );
+    currentPage = 1;
+    updateTable();
+}
+
 // Initial fetch without filtering
-loadDevicesAndUpdateTable();
+loadDevicesAndUpdateTable().then(() => {
+    const deviceId = parseInt(
+        new URLSearchParams(window.location.search).get("device")
+    );
+    if (!deviceId) {
+        return;
+    }
+    linkedDeviceId = deviceId;
+    showLinkedDevice();
+    if (role === "Admin" && filteredDevices.length > 0) {
+        viewDeviceInspections(deviceId);
+    }
+});
+
+// Another user's change reloads the table, keeping the filters, search and page. Changes
+// arriving together, such as a status recompute, are loaded once.
+let deviceReloadTimer = null;
+
+function scheduleDeviceReload() {
+    clearTimeout(deviceReloadTimer);
+    deviceReloadTimer = setTimeout(async () => {
+        const query = deviceQuery;
+        const devices = await getAllDevices(query.buildingCode, query.siteId);
+        // Skip devices loaded for a filter that has since changed
+        if (query !== deviceQuery) {
+            return;
+        }
+        allDevices = devices;
+        if (linkedDeviceId) {
+            showLinkedDevice();
+        } else {
+            searchDevices();
+        }
+    }, 1000);
+}
+
+onServerEvent("device.status_changed", scheduleDeviceReload);
+onServerEvent("inspection.created", scheduleDeviceReload);
+onServerEvent("stream.resync", scheduleDeviceReload);
+if (role === "Admin") {
+    onServerEvent("notification.count", handleNotificationCount);
+}
 
 document.addEventListener("DOMContentLoaded", async function () {
     if (role === "Admin") {
@@ -653,14 +796,19 @@ document.addEventListener("DOMContentLoaded", async function () {
 
 function formatDeviceRow(device) {
     if (!device) return "";
+    // Manufacture and expiry dates are calendar dates sent as UTC midnight
     const formatDateMonthYear = (dateString) =>
-        formatDate(dateString, { month: "short", year: "numeric" });
+        formatDate(dateString, {
+            month: "short",
+            year: "numeric",
+            timeZone: "UTC",
+        });
     const formatDateFull = (dateString) =>
         formatDate(dateString, {
             year: "numeric",
             month: "short",
             day: "numeric",
-            timeZone: "Pacific/Auckland",
+            timeZone: device.site_time_zone || undefined,
         });
 
     const badgeClass = getBadgeClass(device.status.String);
@@ -718,14 +866,12 @@ function formatDeviceRow(device) {
     `;
 }
 
+// formatDate formats a timestamp, options.timeZone should be the site's time zone
 function formatDate(dateString, options) {
     if (!dateString || dateString === "0001-01-01T00:00:00Z") {
         return "N/A";
     }
-    return new Date(dateString).toLocaleString("en-NZ", {
-        timeZone: "Pacific/Auckland", // Ensure the correct timezone
-        ...options,
-    });
+    return new Date(dateString).toLocaleString("en-NZ", options);
 }
 
 function getBadgeClass(status) {
@@ -735,6 +881,7 @@ function getBadgeClass(status) {
         case "Expired":
             return "text-bg-warning";
         case "Inspection Failed":
+        case "Recalled":
             return "text-bg-danger";
         case "Inactive":
             return "text-bg-secondary";
@@ -758,6 +905,14 @@ export function getActionButtons(device) {
                 <path d="M8 14h8"/>
                 <path d="M8 18h5"/>
             </svg>
+        </button>
+        <button class="btn btn-info p-2 ml-2" 
+                onclick="viewDeviceAttachments(${device.emergency_device_id}, '${device.serial_number.String}')" 
+                title="View Attachments">
+            <svg xmlns="http://www.w3.org/2000/svg" width="20" height="20" viewBox="0 0 24 24" fill="none" 
+                stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round">
+                <path d="m21.44 11.05-9.19 9.19a6 6 0 0 1-8.49-8.49l8.57-8.57A4 4 0 1 1 18 8.84l-8.59 8.57a2 2 0 0 1-2.83-2.83l8.49-8.48"/>
+            </svg>
         </button>`;
 
     if (role === "Admin") {
@@ -861,6 +1016,13 @@ export function addDevice() {
             "site_id",
             "site_name"
         ),
+        populateDropdown(
+            ".deviceModelInput",
+            "/api/device-model",
+            "Select a Model",
+            "device_model_id",
+            "model_name"
+        ),
     ];
 
     Promise.all(promises)
@@ -1065,11 +1227,20 @@ function editDevice(deviceId) {
         "site_name"
     );
 
+    const deviceModelPromise = populateDropdown(
+        ".deviceModelInput",
+        "/api/device-model",
+        "Select a Model",
+        "device_model_id",
+        "model_name"
+    );
+
     // Wait for all dropdowns to be populated before proceeding
     Promise.all([
         emergencyDeviceTypePromise,
         extinguisherTypePromise,
         sitePromise,
+        deviceModelPromise,
     ])
         .then(() => {
             // Event listener for site change
@@ -1107,6 +1278,12 @@ function editDevice(deviceId) {
                         data.extinguisher_type_id.Int64;
                     document.getElementById("editSerialNumberInput").value =
                         data.serial_number.String;
+                    if (data.device_model_id.Valid) {
+                        document.getElementById("editDeviceModelInput").value =
+                            data.device_model_id.Int64;
+                    }
+                    document.getElementById("editBatchNumberInput").value =
+                        data.batch_number.String;
                     document.getElementById("editManufactureDateInput").value =
                         data.manufacture_date.Time.split("T")[0];
                     document.getElementById("editSizeInput").value =
@@ -1132,24 +1309,28 @@ function editDevice(deviceId) {
                     // Check and update visibility of extinguisher fields
                     updateExtinguisherFields();
 
-                    // Check if status is "Inspection Failed" or "Inspection Due" and disable the dropdown
+                    // Check if status is "Inspection Failed", "Inspection Due" or "Recalled" and disable the dropdown
                     if (
                         data.status.String === "Inspection Failed" ||
-                        data.status.String === "Inspection Due"
+                        data.status.String === "Inspection Due" ||
+                        data.status.String === "Recalled"
                     ) {
                         document.getElementById(
                             "editStatusInput"
                         ).disabled = true;
 
-                        if (data.status.String === "Inspection Failed") {
+                        if (
+                            data.status.String === "Inspection Failed" ||
+                            data.status.String === "Recalled"
+                        ) {
                             var option = document.createElement("option");
-                            option.text = "Inspection Failed";
-                            option.value = "Inspection Failed";
+                            option.text = data.status.String;
+                            option.value = data.status.String;
                             document
                                 .getElementById("editStatusInput")
                                 .add(option);
                             document.getElementById("editStatusInput").value =
-                                "Inspection Failed";
+                                data.status.String;
                         }
 
                         if (data.status.String === "Inspection Due") {
@@ -1186,6 +1367,18 @@ function editDevice(deviceId) {
                         }
                     }
 
+                    if (data.status.String !== "Recalled") {
+                        // Remove the option from the dropdown where value = "Recalled"
+                        let statusInput =
+                            document.getElementById("editStatusInput");
+                        for (let i = 0; i < statusInput.options.length; i++) {
+                            if (statusInput.options[i].value === "Recalled") {
+                                statusInput.remove(i);
+                                break; // Exit loop after removing the option
+                            }
+                        }
+                    }
+
                     if (data.status.String !== "Inspection Due") {
                         // Remove the option from the dropdown where value = "Inspection Due"
                         let statusInput =
@@ -1662,6 +1855,17 @@ export function deviceNotes(description) {
     $("#notesModal").modal("show");
 }
 
+// viewDeviceAttachments lists a device's photos and documents and lets users add more
+export function viewDeviceAttachments(deviceId, serialNumber) {
+    document.getElementById("deviceAttachmentsSerialNumber").innerText =
+        serialNumber;
+    showAttachments(
+        document.getElementById("deviceAttachments"),
+        `/api/emergency-device/${deviceId}/attachment`
+    );
+    $("#deviceAttachmentsModal").modal("show");
+}
+
 // Function to toggle the map visibility
 export function toggleMap() {
     var map = document.getElementById("map");
@@ -1683,6 +1887,7 @@ export function toggleMap() {
 }
 
 document.getElementById("searchInput").addEventListener("input", () => {
+    linkedDeviceId = null;
     searchDevices();
 });
 
@@ -1696,6 +1901,11 @@ export async function searchDevices() {
     let baseFilteredDevices = [...allDevices];
 
     // Apply active filters to get our base filtered state
+    if (activeFilters.floor) {
+        baseFilteredDevices = baseFilteredDevices.filter(
+            (device) => device.floor_id === activeFilters.floor
+        );
+    }
     if (activeFilters.room && activeFilters.room !== "All Rooms") {
         baseFilteredDevices = baseFilteredDevices.filter(
             (device) => device.room_code === activeFilters.room
@@ -1757,6 +1967,7 @@ export async function searchDevices() {
                         day: "numeric",
                         month: "long",
                         year: "numeric",
+                        timeZone: device.site_time_zone || undefined,
                     })
                     .toLowerCase();
 
@@ -1767,6 +1978,7 @@ export async function searchDevices() {
                         day: "numeric",
                         month: "long",
                         year: "numeric",
+                        timeZone: device.site_time_zone || undefined,
                     })
                     .toLowerCase();
 
@@ -1814,4 +2026,15 @@ window.viewDeviceInspections = viewDeviceInspections;
 window.viewInspectionDetails = viewInspectionDetails;
 window.addInspection = addInspection;
 window.deviceNotes = deviceNotes;
+window.viewDeviceAttachments = viewDeviceAttachments;
 window.toggleMap = toggleMap;
+window.viewFloorPlan = viewFloorPlan;
+window.removeDevicePin = removeDevicePin;
+window.viewInspectionRounds = viewInspectionRounds;
+window.viewInspectionRound = viewInspectionRound;
+window.addInspectionRound = addInspectionRound;
+window.inspectRoundItem = inspectRoundItem;
+window.skipRoundItem = skipRoundItem;
+window.cancelSkipRoundItem = cancelSkipRoundItem;
+window.submitSkipRoundItem = submitSkipRoundItem;
+window.reopenRoundItem = reopenRoundItem;
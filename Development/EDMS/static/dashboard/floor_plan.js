@@ -0,0 +1,236 @@
+// floor_plan.js
+// Shows the devices of a floor, or of a building, as pins on its floor plan. Pin
+// positions are in pixels of the plan image from its top left corner.
+
+let planMap;
+let planUrl = null;
+let planFloorId = null;
+let planImgHeight = 0;
+let planImgWidth = 0;
+
+// Size of a pin, in screen pixels
+const pinSize = 16;
+
+function isAdmin() {
+    return typeof role !== "undefined" && role === "Admin";
+}
+
+// Leaflet's y axis points up from the bottom of the image
+function toLatLng(x, y) {
+    return [planImgHeight - y, x];
+}
+
+function toPlanPoint(latLng) {
+    return {
+        pin_x: Math.min(Math.max(latLng.lng, 0), planImgWidth),
+        pin_y: Math.min(Math.max(planImgHeight - latLng.lat, 0), planImgHeight),
+    };
+}
+
+function showPlanMessage(message) {
+    const messageElement = document.getElementById("floorPlanMessage");
+    messageElement.textContent = message;
+    messageElement.classList.toggle("d-none", !message);
+}
+
+// Opens the plan of the floor selected in the filters. When no floor is selected, or
+// the floor has no plan of its own, the building's plan is shown.
+export async function viewFloorPlan() {
+    const buildingId = document.getElementById("buildingFilter").value;
+    const floorId = document.getElementById("floorFilter").value;
+    if (!buildingId || buildingId === "All Buildings") {
+        return;
+    }
+
+    planFloorId = floorId && floorId !== "All Floors" ? Number(floorId) : null;
+    planUrl = `/api/building/${buildingId}/pin`;
+    if (planFloorId) {
+        const response = await fetch(`/api/floor/${planFloorId}/pin`);
+        const floorPlan = await response.json();
+        if (response.ok && floorPlan.floor_plan_image_path.Valid) {
+            planUrl = `/api/floor/${planFloorId}/pin`;
+        }
+    }
+
+    const modal = document.getElementById("floorPlanModal");
+    modal.addEventListener("shown.bs.modal", loadFloorPlan, { once: true });
+    $("#floorPlanModal").modal("show");
+}
+
+async function loadFloorPlan() {
+    let plan;
+    try {
+        const response = await fetch(planUrl);
+        plan = await response.json();
+        if (!response.ok) {
+            throw new Error(plan.error || "Error loading floor plan");
+        }
+    } catch (error) {
+        console.error("Error loading floor plan:", error);
+        showPlanMessage("Error loading floor plan");
+        return;
+    }
+
+    // Devices on other floors share the building's plan, only show the selected floor's
+    if (planFloorId && !plan.floor_id.Valid) {
+        plan.pins = plan.pins.filter((pin) => pin.floor_id === planFloorId);
+        plan.unplaced = plan.unplaced.filter(
+            (pin) => pin.floor_id === planFloorId
+        );
+    }
+
+    document.getElementById("floorPlanTitle").textContent = plan.floor_id.Valid
+        ? `Floor Plan - ${plan.building_code} ${plan.floor_name}`
+        : `Floor Plan - ${plan.building_code}`;
+
+    if (!plan.floor_plan_image_path.Valid) {
+        document.getElementById("floorPlanMap").classList.add("d-none");
+        document.getElementById("floorPlanLegend").innerHTML = "";
+        populateUnplaced([]);
+        showPlanMessage(
+            "No floor plan has been uploaded for this floor or building."
+        );
+        return;
+    }
+    document.getElementById("floorPlanMap").classList.remove("d-none");
+    showPlanMessage("");
+
+    const image = new Image();
+    image.src = plan.floor_plan_image_path.String;
+    image.onload = function () {
+        planImgWidth = this.width;
+        planImgHeight = this.height;
+        renderFloorPlan(plan);
+    };
+}
+
+function renderFloorPlan(plan) {
+    if (!planMap) {
+        planMap = L.map("floorPlanMap", { crs: L.CRS.Simple, minZoom: -3 });
+        planMap.on("click", placeDevice);
+    }
+    planMap.eachLayer((layer) => planMap.removeLayer(layer));
+    planMap.invalidateSize();
+
+    const bounds = [
+        [0, 0],
+        [planImgHeight, planImgWidth],
+    ];
+    L.imageOverlay(plan.floor_plan_image_path.String, bounds).addTo(planMap);
+    planMap.fitBounds(bounds);
+
+    plan.pins.forEach((pin) => {
+        const marker = L.marker(toLatLng(pin.pin_x.Float64, pin.pin_y.Float64), {
+            draggable: isAdmin(),
+            icon: L.divIcon({
+                className: "",
+                iconSize: [pinSize, pinSize],
+                html: `<span style="display: block; width: ${pinSize}px; height: ${pinSize}px;
+                    border-radius: 50%; border: 2px solid #fff; background: ${pin.status_colour};
+                    box-shadow: 0 0 2px #000;"></span>`,
+            }),
+        })
+            .bindTooltip(
+                `${pin.emergency_device_type_name} - ${pin.room_code} (${
+                    pin.status.String || "N/A"
+                })`
+            )
+            .addTo(planMap);
+
+        if (isAdmin()) {
+            marker.bindPopup(
+                `<button class="btn btn-sm btn-danger" onclick="removeDevicePin(${pin.emergency_device_id})">Remove pin</button>`
+            );
+            marker.on("dragend", (event) =>
+                saveDevicePin(
+                    pin.emergency_device_id,
+                    toPlanPoint(event.target.getLatLng())
+                )
+            );
+        }
+    });
+
+    renderLegend(plan.pins);
+    populateUnplaced(plan.unplaced);
+}
+
+// Lists the colour of each status shown on the plan
+function renderLegend(pins) {
+    const colours = new Map();
+    pins.forEach((pin) =>
+        colours.set(pin.status.String || "N/A", pin.status_colour)
+    );
+
+    document.getElementById("floorPlanLegend").innerHTML = [...colours]
+        .map(
+            ([status, colour]) => `
+            <span>
+                <span style="display: inline-block; width: 12px; height: 12px;
+                    border-radius: 50%; background: ${colour};"></span>
+                ${status}
+            </span>`
+        )
+        .join("");
+}
+
+function populateUnplaced(devices) {
+    const select = document.getElementById("floorPlanUnplaced");
+    if (!select) {
+        return;
+    }
+
+    select.innerHTML =
+        `<option value="">${
+            devices.length ? "Select a device..." : "All devices are placed"
+        }</option>` +
+        devices
+            .map(
+                (device) =>
+                    `<option value="${device.emergency_device_id}">${
+                        device.emergency_device_type_name
+                    } - ${device.room_code}${
+                        device.serial_number.Valid
+                            ? ` (${device.serial_number.String})`
+                            : ""
+                    }</option>`
+            )
+            .join("");
+}
+
+// Pins the device selected in the placement list where the plan was clicked
+function placeDevice(event) {
+    const select = document.getElementById("floorPlanUnplaced");
+    if (!select || !select.value) {
+        return;
+    }
+    saveDevicePin(Number(select.value), toPlanPoint(event.latlng));
+}
+
+async function saveDevicePin(deviceId, point) {
+    try {
+        const response = await fetch(`/api/emergency-device/${deviceId}/pin`, {
+            method: "PUT",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify(point),
+        });
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || "Error saving device pin");
+        }
+    } catch (error) {
+        console.error("Error saving device pin:", error);
+        Toastify({
+            text: error.message,
+            duration: 6000,
+            close: true,
+            gravity: "top",
+            position: "center",
+            backgroundColor: "linear-gradient(to right, #ff5f6d, #ffc371)",
+        }).showToast();
+    }
+    loadFloorPlan();
+}
+
+export function removeDevicePin(deviceId) {
+    saveDevicePin(deviceId, { pin_x: null, pin_y: null });
+}
@@ -0,0 +1,165 @@
+// attachments.js lists, uploads and deletes the photos and documents attached to a
+// device, an inspection or a work order. Each section holds an .attachment-list, an
+// .attachment-error and an .attachment-form with file and description inputs.
+
+// showAttachments points a section at an owner's attachment routes and lists them
+export function showAttachments(section, url) {
+    section.dataset.url = url;
+
+    const form = section.querySelector(".attachment-form");
+    form.reset();
+    form.classList.remove("was-validated");
+    setAttachmentError(section, "");
+
+    return loadAttachments(section);
+}
+
+// initializeAttachmentForms uploads the chosen file when an attachment form is submitted
+export function initializeAttachmentForms() {
+    document.querySelectorAll(".attachment-form").forEach((form) => {
+        form.addEventListener("submit", function (event) {
+            event.preventDefault();
+
+            const section = form.closest(".attachment-section");
+            if (!form.checkValidity()) {
+                form.classList.add("was-validated");
+                return;
+            }
+
+            const button = form.querySelector("button[type='submit']");
+            button.disabled = true;
+            setAttachmentError(section, "");
+
+            fetch(section.dataset.url, {
+                method: "POST",
+                body: new FormData(form),
+            })
+                .then((response) => response.json())
+                .then((data) => {
+                    if (data.error) {
+                        throw new Error(data.error);
+                    }
+                    form.reset();
+                    form.classList.remove("was-validated");
+                    return loadAttachments(section);
+                })
+                .catch((error) => {
+                    console.error("Error uploading attachment:", error);
+                    setAttachmentError(section, error.message);
+                })
+                .finally(() => {
+                    button.disabled = false;
+                });
+        });
+    });
+}
+
+function loadAttachments(section) {
+    const list = section.querySelector(".attachment-list");
+    list.innerHTML = "";
+
+    return fetch(section.dataset.url)
+        .then((response) => response.json())
+        .then((attachments) => {
+            if (!Array.isArray(attachments)) {
+                throw new Error(attachments.error || "Error fetching attachments");
+            }
+            if (attachments.length === 0) {
+                const empty = document.createElement("p");
+                empty.className = "text-muted";
+                empty.innerText = "No attachments";
+                list.appendChild(empty);
+            }
+            attachments.forEach((attachment) => {
+                list.appendChild(renderAttachment(section, attachment));
+            });
+        })
+        .catch((error) => {
+            console.error("Error fetching attachments:", error);
+            setAttachmentError(section, error.message);
+        });
+}
+
+// renderAttachment shows a thumbnail, or the file name for documents, linked to the file
+function renderAttachment(section, attachment) {
+    const item = document.createElement("div");
+    item.className = "d-flex align-items-center border rounded p-2 mb-2";
+
+    const link = document.createElement("a");
+    link.href = `/api/attachment/${attachment.attachment_id}`;
+    link.target = "_blank";
+    if (attachment.has_thumbnail) {
+        const thumbnail = document.createElement("img");
+        thumbnail.src = `/api/attachment/${attachment.attachment_id}/thumbnail`;
+        thumbnail.alt = attachment.file_name;
+        thumbnail.className = "img-thumbnail";
+        thumbnail.style.maxHeight = "80px";
+        link.appendChild(thumbnail);
+    } else {
+        link.innerText = attachment.file_name;
+    }
+    item.appendChild(link);
+
+    const details = document.createElement("div");
+    details.className = "ms-3 flex-grow-1";
+    if (attachment.description.Valid) {
+        const description = document.createElement("div");
+        description.innerText = attachment.description.String;
+        details.appendChild(description);
+    }
+    const uploaded = document.createElement("small");
+    uploaded.className = "text-muted";
+    uploaded.innerText = `Uploaded by ${attachment.uploader_name || "Unknown"}${
+        attachment.uploaded_at.Valid
+            ? ` on ${new Date(attachment.uploaded_at.Time).toLocaleString()}`
+            : ""
+    }`;
+    details.appendChild(uploaded);
+    item.appendChild(details);
+
+    // Users may only delete the device attachments they uploaded, and photos answering a
+    // checklist question are part of the inspection
+    if (
+        !attachment.is_answer &&
+        (role === "Admin" ||
+            (attachment.emergency_device_id.Valid &&
+                String(attachment.uploaded_by) === String(user_id)))
+    ) {
+        const deleteButton = document.createElement("button");
+        deleteButton.type = "button";
+        deleteButton.className = "btn btn-sm btn-outline-danger ms-2";
+        deleteButton.innerText = "Delete";
+        deleteButton.addEventListener("click", () =>
+            deleteAttachment(section, attachment)
+        );
+        item.appendChild(deleteButton);
+    }
+
+    return item;
+}
+
+function deleteAttachment(section, attachment) {
+    if (!confirm(`Delete ${attachment.file_name}?`)) {
+        return;
+    }
+
+    fetch(`/api/attachment/${attachment.attachment_id}`, { method: "DELETE" })
+        .then((response) => response.json())
+        .then((data) => {
+            if (data.error) {
+                throw new Error(data.error);
+            }
+            setAttachmentError(section, "");
+            return loadAttachments(section);
+        })
+        .catch((error) => {
+            console.error("Error deleting attachment:", error);
+            setAttachmentError(section, error.message);
+        });
+}
+
+function setAttachmentError(section, message) {
+    const error = section.querySelector(".attachment-error");
+    error.innerText = message;
+    error.classList.toggle("d-none", !message);
+}
@@ -0,0 +1,150 @@
+// calendar.js
+// Per-user calendar feed of upcoming inspections and expiries, opened from the account menu
+
+export async function viewCalendarSettings() {
+    hideCalendarError();
+
+    try {
+        const [settings, sites] = await Promise.all([
+            fetch("/api/calendar").then((response) => response.json()),
+            fetch("/api/site").then((response) => response.json()),
+        ]);
+
+        document.getElementById("calendarSites").innerHTML = sites
+            .map(
+                (site) => `
+                <div class="form-check">
+                    <input class="form-check-input" type="checkbox" name="calendarSite"
+                        id="calendarSite${site.site_id}" value="${site.site_id}"
+                        ${settings.site_ids.includes(site.site_id) ? "checked" : ""} />
+                    <label class="form-check-label" for="calendarSite${site.site_id}">${site.site_name}</label>
+                </div>`
+            )
+            .join("");
+
+        showCalendarFeed(settings);
+    } catch (error) {
+        console.error("Error fetching calendar settings:", error);
+    }
+
+    $("#calendarSettingsModal").modal("show");
+}
+
+function showCalendarFeed(settings) {
+    const hasFeed = settings.feed_url !== "";
+    document.getElementById("calendarFeed").classList.toggle("d-none", !hasFeed);
+    document
+        .getElementById("calendarFeedActions")
+        .classList.toggle("d-none", !hasFeed);
+    document.getElementById("calendarFeedUrl").value = settings.feed_url;
+    document.getElementById("calendarLastFetched").innerText =
+        hasFeed && settings.last_fetched_at.Valid
+            ? `Last fetched ${new Date(
+                  settings.last_fetched_at.Time
+              ).toLocaleString("en-NZ")}`
+            : "";
+}
+
+function hideCalendarError() {
+    document.getElementById("calendarSettingsError").classList.add("d-none");
+}
+
+function showCalendarError(message) {
+    const errorAlert = document.getElementById("calendarSettingsError");
+    errorAlert.innerText = message;
+    errorAlert.classList.remove("d-none");
+}
+
+// sendCalendarRequest sends a change to the feed and shows the settings it returns
+async function sendCalendarRequest(method, url, body, errorMessage) {
+    hideCalendarError();
+
+    try {
+        const response = await fetch(url, {
+            method: method,
+            headers: { "Content-Type": "application/json" },
+            body: body ? JSON.stringify(body) : undefined,
+        });
+        const data = await response.json();
+        if (!response.ok || data.error) {
+            showCalendarError(data.error || errorMessage);
+            return;
+        }
+        if (data.feed_url !== undefined) {
+            showCalendarFeed(data);
+        } else {
+            showCalendarFeed({ feed_url: "", last_fetched_at: { Valid: false } });
+        }
+    } catch (error) {
+        console.error(errorMessage, error);
+        showCalendarError(errorMessage);
+    }
+}
+
+function saveCalendarSettings() {
+    const siteIds = Array.from(
+        document.querySelectorAll('input[name="calendarSite"]:checked')
+    ).map((input) => parseInt(input.value));
+
+    sendCalendarRequest(
+        "PUT",
+        "/api/calendar",
+        { site_ids: siteIds },
+        "Error saving calendar settings"
+    );
+}
+
+function resetCalendarFeed() {
+    if (
+        !confirm(
+            "Calendar apps subscribed with the current URL will stop updating. Continue?"
+        )
+    ) {
+        return;
+    }
+    sendCalendarRequest(
+        "POST",
+        "/api/calendar/reset",
+        null,
+        "Error resetting calendar feed"
+    );
+}
+
+function deleteCalendarFeed() {
+    sendCalendarRequest(
+        "DELETE",
+        "/api/calendar",
+        null,
+        "Error turning off calendar feed"
+    );
+}
+
+async function copyCalendarFeedUrl() {
+    const input = document.getElementById("calendarFeedUrl");
+    try {
+        await navigator.clipboard.writeText(input.value);
+    } catch (error) {
+        // Clipboard access needs a secure context, fall back to selecting the URL
+        input.select();
+    }
+}
+
+document.addEventListener("DOMContentLoaded", () => {
+    const form = document.getElementById("calendarSettingsForm");
+    if (!form) {
+        return;
+    }
+
+    document
+        .getElementById("calendarSettingsSaveBtn")
+        .addEventListener("click", saveCalendarSettings);
+    document
+        .getElementById("calendarResetBtn")
+        .addEventListener("click", resetCalendarFeed);
+    document
+        .getElementById("calendarDeleteBtn")
+        .addEventListener("click", deleteCalendarFeed);
+    document
+        .getElementById("calendarCopyBtn")
+        .addEventListener("click", copyCalendarFeedUrl);
+});
@@ -0,0 +1,120 @@
+// digest.js
+// Per-user email digest settings, opened from the account menu
+
+export async function viewDigestSettings() {
+    document.getElementById("digestSettingsError").classList.add("d-none");
+
+    try {
+        const [subscription, sites] = await Promise.all([
+            fetch("/api/digest").then((response) => response.json()),
+            fetch("/api/site").then((response) => response.json()),
+        ]);
+
+        document.getElementById("digestFrequency").value =
+            subscription.frequency;
+
+        const siteSelect = document.getElementById("digestSiteId");
+        siteSelect.innerHTML =
+            `<option value="">All Sites</option>` +
+            sites
+                .map(
+                    (site) =>
+                        `<option value="${site.site_id}">${site.site_name}</option>`
+                )
+                .join("");
+        siteSelect.value = subscription.site_id.Valid
+            ? String(subscription.site_id.Int64)
+            : "";
+
+        await loadDigestBuildings();
+        document.getElementById("digestBuildingId").value = subscription
+            .building_id.Valid
+            ? String(subscription.building_id.Int64)
+            : "";
+
+        showDigestSubscriptionState(subscription);
+    } catch (error) {
+        console.error("Error fetching digest settings:", error);
+    }
+
+    $("#digestSettingsModal").modal("show");
+}
+
+function showDigestSubscriptionState(subscription) {
+    const subscribed = subscription.frequency !== "";
+    document
+        .getElementById("digestPreviewLink")
+        .classList.toggle("d-none", !subscribed);
+    document.getElementById("digestLastSent").innerText =
+        subscribed && subscription.last_sent_at.Valid
+            ? `Last sent ${new Date(
+                  subscription.last_sent_at.Time
+              ).toLocaleString("en-NZ")}`
+            : "";
+}
+
+async function loadDigestBuildings() {
+    const siteId = document.getElementById("digestSiteId").value;
+    const buildingSelect = document.getElementById("digestBuildingId");
+    buildingSelect.innerHTML = `<option value="">All Buildings</option>`;
+    if (!siteId) {
+        return;
+    }
+
+    try {
+        const response = await fetch(`/api/building?siteId=${siteId}`);
+        const buildings = await response.json();
+        buildingSelect.innerHTML += buildings
+            .map(
+                (building) =>
+                    `<option value="${building.building_id}">${building.building_code}</option>`
+            )
+            .join("");
+    } catch (error) {
+        console.error("Error fetching buildings:", error);
+    }
+}
+
+async function saveDigestSettings() {
+    const errorAlert = document.getElementById("digestSettingsError");
+    errorAlert.classList.add("d-none");
+
+    const body = {
+        frequency: document.getElementById("digestFrequency").value,
+        site_id: document.getElementById("digestSiteId").value,
+        building_id: document.getElementById("digestBuildingId").value,
+    };
+
+    try {
+        const response = await fetch("/api/digest", {
+            method: "PUT",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify(body),
+        });
+        const data = await response.json();
+        if (!response.ok || data.error) {
+            errorAlert.innerText = data.error || "Error saving digest settings";
+            errorAlert.classList.remove("d-none");
+            return;
+        }
+        $("#digestSettingsModal").modal("hide");
+    } catch (error) {
+        console.error("Error saving digest settings:", error);
+        errorAlert.innerText = "Error saving digest settings";
+        errorAlert.classList.remove("d-none");
+    }
+}
+
+document.addEventListener("DOMContentLoaded", () => {
+    const form = document.getElementById("digestSettingsForm");
+    if (!form) {
+        return;
+    }
+
+    document
+        .getElementById("digestSiteId")
+        .addEventListener("change", loadDigestBuildings);
+    document
+        .getElementById("digestSettingsSaveBtn")
+        .addEventListener("click", saveDigestSettings);
+});
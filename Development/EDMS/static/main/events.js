@@ -0,0 +1,37 @@
+// Live updates pushed by the server on /api/events. One stream is shared by every
+// handler on the page, the browser reconnects by itself if it drops.
+let eventSource = null;
+
+// onServerEvent calls handler with the parsed data of each event of the given type
+export function onServerEvent(type, handler) {
+    const source = connectServerEvents();
+    if (!source) {
+        return;
+    }
+
+    source.addEventListener(type, (event) => {
+        let data;
+        try {
+            data = JSON.parse(event.data);
+        } catch (error) {
+            console.error(`Malformed ${type} event:`, error);
+            return;
+        }
+        handler(data);
+    });
+}
+
+function connectServerEvents() {
+    if (eventSource || !window.EventSource) {
+        return eventSource;
+    }
+
+    eventSource = new EventSource("/api/events");
+
+    // The login has expired, pages fall back to loading data themselves
+    eventSource.addEventListener("stream.expired", () => {
+        eventSource.close();
+    });
+
+    return eventSource;
+}
@@ -1,13 +1,12 @@
 import { refreshNotificationsPreservingCleared } from "./notifications.js";
+import { showAttachments } from "./attachments.js";
 
+// formatDate formats a timestamp, options.timeZone should be the site's time zone
 function formatDate(dateString, options) {
     if (!dateString || dateString === "0001-01-01T00:00:00Z") {
         return "N/A";
     }
-    return new Date(dateString).toLocaleString("en-NZ", {
-        timeZone: "Pacific/Auckland", // Ensure the correct timezone
-        ...options,
-    });
+    return new Date(dateString).toLocaleString("en-NZ", options);
 }
 
 // inspections.js
@@ -34,20 +33,68 @@ export function initializeInspectionForm() {
         return;
     }
 
-    const checkboxes = Array.from(
-        addInspectionForm.querySelectorAll('input[type="checkbox"]')
-    ).filter(
-        (checkbox) => !["workOrderRequired", "isReplaced"].includes(checkbox.id)
+    const checklistContainer = document.querySelector("#inspectionChecklist");
+    const computedStatusText = document.querySelector(
+        "#computedInspectionStatus"
+    );
+    const overrideJustificationRow = document.querySelector(
+        "#overrideJustificationRow"
+    );
+    const overrideJustification = document.querySelector(
+        "#overrideJustification"
     );
 
+    // Mirrors the server: a critical "No" fails, an advisory "No" passes with defects and
+    // an informational "No" has no effect
+    function computeInspectionOutcome() {
+        const answers = Array.from(
+            checklistContainer.querySelectorAll(
+                "select[data-answer-type='YesNoNA']"
+            )
+        );
+        if (answers.length === 0) {
+            return null;
+        }
+        let outcome = "Passed";
+        for (const answer of answers) {
+            if (answer.value !== "No") {
+                continue;
+            }
+            if (answer.dataset.severity === "Critical") {
+                return "Failed";
+            }
+            if (answer.dataset.severity === "Advisory") {
+                outcome = "Passed with defects";
+            }
+        }
+        return outcome;
+    }
+
     function validateInspectionStatus() {
-        const allChecked = checkboxes.every((checkbox) => checkbox.checked);
-        if (inspectionStatus.value === "Passed" && !allChecked) {
+        const computedStatus = computeInspectionOutcome();
+        computedStatusText.textContent = computedStatus
+            ? `Calculated from the checklist: ${computedStatus}`
+            : "";
+
+        // Only admins can record a status that differs from the checklist answers
+        const overriding =
+            computedStatus &&
+            inspectionStatus.value &&
+            inspectionStatus.value !== computedStatus;
+        overrideJustificationRow.classList.toggle(
+            "d-none",
+            !(overriding && role === "Admin")
+        );
+        overrideJustification.required = overriding && role === "Admin";
+        if (!overriding) {
+            overrideJustification.value = "";
+        }
+
+        if (overriding && role !== "Admin") {
             inspectionStatus.setCustomValidity(
-                "All inspection criteria must be met to mark as Passed"
+                `The checklist answers give a status of ${computedStatus}`
             );
-            inspectionStatusFeedback.textContent =
-                "All inspection criteria must be met to mark as Passed";
+            inspectionStatusFeedback.textContent = `The checklist answers give a status of ${computedStatus}`;
             return false;
         } else if (!inspectionStatus.value) {
             inspectionStatus.setCustomValidity(
@@ -64,6 +111,7 @@ export function initializeInspectionForm() {
     }
 
     inspectionStatus.addEventListener("change", function () {
+        this.dataset.calculated = "false";
         validateInspectionStatus();
         if (addInspectionForm.classList.contains("was-validated")) {
             inspectionStatusFeedback.style.display = this.validationMessage
@@ -73,18 +121,25 @@ export function initializeInspectionForm() {
         }
     });
 
-    checkboxes.forEach((checkbox) => {
-        checkbox.addEventListener("change", () => {
-            if (inspectionStatus.value === "Passed") {
-                validateInspectionStatus();
-                if (addInspectionForm.classList.contains("was-validated")) {
-                    inspectionStatusFeedback.style.display =
-                        inspectionStatus.validationMessage ? "block" : "none";
-                    inspectionStatusFeedback.textContent =
-                        inspectionStatus.validationMessage;
-                }
-            }
-        });
+    // Checklist questions are rendered per device, so listen on the container.
+    // The status follows the answers until the user picks a different one.
+    checklistContainer.addEventListener("change", () => {
+        const computedStatus = computeInspectionOutcome();
+        if (
+            computedStatus &&
+            (!inspectionStatus.value ||
+                inspectionStatus.dataset.calculated === "true")
+        ) {
+            inspectionStatus.value = computedStatus;
+            inspectionStatus.dataset.calculated = "true";
+        }
+        validateInspectionStatus();
+        if (addInspectionForm.classList.contains("was-validated")) {
+            inspectionStatusFeedback.style.display =
+                inspectionStatus.validationMessage ? "block" : "none";
+            inspectionStatusFeedback.textContent =
+                inspectionStatus.validationMessage;
+        }
     });
 
     inspectionDateTimeInput.addEventListener("input", function () {
@@ -110,9 +165,12 @@ export function initializeInspectionForm() {
         }
     });
 
+    const signaturePad = initializeSignaturePad();
+
     // Add event listener to the form submit button
     addInspectionButton.addEventListener("click", async function (event) {
         event.preventDefault();
+        const signatureValid = signaturePad.validate();
         if (inspectionDateTimeInput.value) {
             const currentDateTime = new Date();
             const inputDateTime = new Date(inspectionDateTimeInput.value);
@@ -137,7 +195,7 @@ export function initializeInspectionForm() {
         validateInspectionStatus();
         addInspectionForm.classList.add("was-validated");
 
-        if (!addInspectionForm.checkValidity()) {
+        if (!addInspectionForm.checkValidity() || !signatureValid) {
             event.stopPropagation();
             if (inspectionStatus.validationMessage) {
                 inspectionStatusFeedback.style.display = "block";
@@ -150,6 +208,7 @@ export function initializeInspectionForm() {
                     inspectionDateTimeInput.validationMessage;
             }
         } else {
+            signaturePad.save();
             try {
                 sessionStorage.setItem("shouldRefreshNotifications", "true");
                 // Submit the form
@@ -164,6 +223,99 @@ export function initializeInspectionForm() {
     });
 }
 
+// initializeSignaturePad lets the inspector draw their signature on the add inspection
+// form, or switch to signing with their typed name only
+function initializeSignaturePad() {
+    const canvas = document.querySelector("#signaturePad");
+    const context = canvas.getContext("2d");
+    const padRow = document.querySelector("#signaturePadRow");
+    const signatureData = document.querySelector("#signatureData");
+    const signatureFeedback = document.querySelector("#signatureFeedback");
+    const typeInputs = document.querySelectorAll(
+        "#addInspectionForm input[name='signature_type']"
+    );
+    let drawing = false;
+    let signed = false;
+
+    function isDrawn() {
+        return document.querySelector("#signatureTypeDrawn").checked;
+    }
+
+    function clear() {
+        // Match the canvas to its displayed size so strokes follow the pointer
+        canvas.width = canvas.offsetWidth || canvas.width;
+        context.clearRect(0, 0, canvas.width, canvas.height);
+        context.lineWidth = 2;
+        context.lineCap = "round";
+        context.strokeStyle = "#000";
+        signatureData.value = "";
+        signed = false;
+        signatureFeedback.style.display = "none";
+    }
+
+    function point(event) {
+        const rect = canvas.getBoundingClientRect();
+        return {
+            x: ((event.clientX - rect.left) * canvas.width) / rect.width,
+            y: ((event.clientY - rect.top) * canvas.height) / rect.height,
+        };
+    }
+
+    canvas.addEventListener("pointerdown", (event) => {
+        drawing = true;
+        canvas.setPointerCapture(event.pointerId);
+        const { x, y } = point(event);
+        context.beginPath();
+        context.moveTo(x, y);
+    });
+    canvas.addEventListener("pointermove", (event) => {
+        if (!drawing) {
+            return;
+        }
+        const { x, y } = point(event);
+        context.lineTo(x, y);
+        context.stroke();
+        signed = true;
+    });
+    ["pointerup", "pointercancel"].forEach((type) => {
+        canvas.addEventListener(type, () => {
+            drawing = false;
+        });
+    });
+
+    document
+        .querySelector("#clearSignatureBtn")
+        .addEventListener("click", clear);
+    typeInputs.forEach((input) => {
+        input.addEventListener("change", () => {
+            padRow.classList.toggle("d-none", !isDrawn());
+            if (isDrawn()) {
+                clear();
+            }
+        });
+    });
+
+    // The form is reset whenever it is opened, start with an empty pad
+    $("#addInspectionModal").on("shown.bs.modal", () => {
+        padRow.classList.toggle("d-none", !isDrawn());
+        clear();
+    });
+
+    return {
+        // validate reports a missing drawn signature, hidden fields are not
+        // checked by the browser
+        validate() {
+            const missing = isDrawn() && !signed;
+            signatureFeedback.style.display = missing ? "block" : "none";
+            return !missing;
+        },
+        // save copies the drawing into the form, typed signatures send no image
+        save() {
+            signatureData.value = isDrawn() ? canvas.toDataURL("image/png") : "";
+        },
+    };
+}
+
 export function viewDeviceInspections(deviceId) {
     // Close the notification modal if open
     $("#notificationsModal").modal("hide");
@@ -197,6 +349,8 @@ export function viewDeviceInspections(deviceId) {
                                   day: "numeric",
                                   month: "long",
                                   year: "numeric",
+                                  timeZone:
+                                      inspection.site_time_zone || undefined,
                               })
                             : "No Date Available";
 
@@ -204,6 +358,11 @@ export function viewDeviceInspections(deviceId) {
                         let badgeClass = "badge text-bg-primary"; // default color
                         if (inspection.inspection_status === "Passed") {
                             badgeClass = "badge text-bg-success";
+                        } else if (
+                            inspection.inspection_status ===
+                            "Passed with defects"
+                        ) {
+                            badgeClass = "badge text-bg-warning";
                         } else if (inspection.inspection_status === "Failed") {
                             badgeClass = "badge text-bg-danger";
                         }
@@ -218,6 +377,7 @@ export function viewDeviceInspections(deviceId) {
                                     <span class="badge ${badgeClass}">${
                             inspection.inspection_status || "Not Set"
                         }</span>
+                                    ${revisionBadge(inspection)}
                                 </td>
                                 <td>
                                     <button class="btn btn-primary" onclick="viewInspectionDetails(${
@@ -255,6 +415,9 @@ export function viewDeviceInspections(deviceId) {
 
     // Set the device ID in the hidden input field
     document.getElementById("inspect_device_id").value = deviceId;
+    document.getElementById(
+        "deviceHistoryReportLink"
+    ).href = `/api/inspection/report?device_id=${deviceId}`;
 
     // Show the modal
     $("#viewInspectionModal").modal("show");
@@ -263,9 +426,6 @@ export function viewDeviceInspections(deviceId) {
 export function addInspection() {
     const deviceId = document.getElementById("inspect_device_id").value;
 
-    // Set the user ID in the hidden input field
-    document.getElementById("inspect_user_id").value = user_id;
-
     // Close the view inspection modal
     $("#viewInspectionModal").modal("hide");
 
@@ -282,20 +442,148 @@ export function addInspection() {
         element.textContent = "";
     });
 
+    // Reset the calculated status and any override
+    document.getElementById("inspectionStatus").dataset.calculated = "true";
+    document.getElementById("computedInspectionStatus").textContent = "";
+    document.getElementById("overrideJustificationRow").classList.add("d-none");
+    document.getElementById("overrideJustification").required = false;
+
     // Add the device ID to the hidden input field
     const deviceIdInput = document.getElementById("add_inspection_device_id");
     deviceIdInput.value = deviceId;
 
+    // Load the checklist for the device's type
+    const checklistContainer = document.getElementById("inspectionChecklist");
+    const checklistTitle = document.getElementById("inspectionChecklistTitle");
+    checklistContainer.innerHTML = "";
+    checklistTitle.innerText = "Inspection Checklist";
+
+    fetch(`/api/emergency-device/${deviceId}/checklist`)
+        .then((response) => {
+            if (response.status === 404) {
+                return null;
+            }
+            if (!response.ok) {
+                throw new Error("Failed to load checklist");
+            }
+            return response.json();
+        })
+        .then((template) => {
+            if (!template) {
+                checklistContainer.innerHTML = `
+                    <p class="text-muted">No checklist has been set up for this device type.</p>
+                `;
+                return;
+            }
+            checklistTitle.innerText = `Inspection Checklist - ${template.template_name} v${template.version}`;
+            template.questions.forEach((question) => {
+                checklistContainer.appendChild(renderChecklistQuestion(question));
+            });
+        })
+        .catch((error) => {
+            console.error("Error fetching checklist:", error);
+            checklistContainer.innerHTML = `
+                <p class="text-danger">Failed to load checklist</p>
+            `;
+        });
+
     // Show the add inspection modal
     $("#addInspectionModal").modal("show");
 }
 
+// renderChecklistQuestion builds the input for one checklist question
+function renderChecklistQuestion(question, idPrefix = "checklistQuestion") {
+    const inputId = `${idPrefix}${question.checklist_question_id}`;
+    const name = `answer_${question.checklist_question_id}`;
+
+    const wrapper = document.createElement("div");
+    wrapper.className = "col-md-6 col-12 mb-3";
+
+    const label = document.createElement("label");
+    label.className = "form-label";
+    label.htmlFor = inputId;
+    label.innerText = question.question_text + (question.is_required ? " *" : "");
+    if (question.severity !== "Critical") {
+        const severity = document.createElement("small");
+        severity.className = "text-muted ms-1";
+        severity.innerText = `(${question.severity.toLowerCase()})`;
+        label.appendChild(severity);
+    }
+    wrapper.appendChild(label);
+
+    let input;
+    switch (question.answer_type) {
+        case "YesNoNA":
+            input = document.createElement("select");
+            input.className = "form-control form-select";
+            input.name = name;
+            [
+                ["", "Select an answer"],
+                ["Yes", "Yes"],
+                ["No", "No"],
+                ["N/A", "N/A"],
+            ].forEach(([value, text]) => {
+                const option = document.createElement("option");
+                option.value = value;
+                option.innerText = text;
+                input.appendChild(option);
+            });
+            break;
+        case "Number":
+            input = document.createElement("input");
+            input.type = "number";
+            input.step = "any";
+            input.className = "form-control";
+            input.name = name;
+            break;
+        case "Photo":
+            input = document.createElement("input");
+            input.type = "file";
+            input.accept = "image/jpeg,image/png,image/gif";
+            input.className = "form-control";
+            input.name = `photo_${question.checklist_question_id}`;
+            break;
+        default:
+            input = document.createElement("textarea");
+            input.className = "form-control";
+            input.rows = 2;
+            input.maxLength = 1000;
+            input.name = name;
+    }
+    input.id = inputId;
+    input.dataset.answerType = question.answer_type;
+    input.dataset.severity = question.severity;
+    input.required = question.is_required;
+    wrapper.appendChild(input);
+
+    const feedback = document.createElement("div");
+    feedback.className = "invalid-feedback";
+    feedback.innerText = "This question is required.";
+    wrapper.appendChild(feedback);
+
+    return wrapper;
+}
+
+// revisionBadge marks inspections that were amended or voided
+function revisionBadge(inspection) {
+    if (!inspection.revision_action || !inspection.revision_action.Valid) {
+        return "";
+    }
+    return inspection.revision_action.String === "Void"
+        ? '<span class="badge text-bg-secondary">Voided</span>'
+        : '<span class="badge text-bg-secondary">Amended</span>';
+}
+
+// The inspection shown in the details modal, used to prefill the amend form
+let currentInspection = null;
+
 export function viewInspectionDetails(inspectionId) {
     $("#viewInspectionModal").modal("hide");
 
     fetch(`/api/inspection/${inspectionId}`)
         .then((response) => response.json())
         .then((data) => {
+            currentInspection = data;
             document.getElementById("inspector_username").innerText =
                 data.inspector_name || "Unknown";
 
@@ -304,7 +592,7 @@ export function viewInspectionDetails(inspectionId) {
                 day: "numeric",
                 month: "long",
                 year: "numeric",
-                timeZone: "Pacific/Auckland", // Ensure correct timezone here as well
+                timeZone: data.site_time_zone || undefined, // Shown in the site's time zone
             };
 
             const dateTimeOptions = {
@@ -312,7 +600,6 @@ export function viewInspectionDetails(inspectionId) {
                 hour: "numeric",
                 minute: "numeric",
                 hour12: true,
-                timeZone: "Pacific/Auckland",
             };
 
             // Format and display inspection date
@@ -336,6 +623,10 @@ export function viewInspectionDetails(inspectionId) {
                     statusBadge.classList.add("bg-success");
                     statusBadge.innerText = "Passed";
                     break;
+                case "Passed with defects":
+                    statusBadge.classList.add("bg-warning", "text-dark");
+                    statusBadge.innerText = "Passed with defects";
+                    break;
                 case "Failed":
                     statusBadge.classList.add("bg-danger");
                     statusBadge.innerText = "Failed";
@@ -351,50 +642,71 @@ export function viewInspectionDetails(inspectionId) {
             statusContainer.innerHTML = "";
             statusContainer.appendChild(statusBadge);
 
+            // Show where the inspection sits in its revision chain
+            showInspectionRevisions(data);
+
+            // Show who signed the inspection and offer to verify it
+            showInspectionSignature(data, dateTimeOptions);
+
+            document.getElementById(
+                "inspectionCertificateLink"
+            ).href = `/api/inspection/${data.emergency_device_inspection_id}/certificate`;
+
+            // Show who overrode the calculated status and why
+            const override = document.getElementById("ViewInspectionOverride");
+            if (data.override_justification.Valid) {
+                override.innerText = `Status overridden from ${
+                    data.computed_status.String
+                } by ${data.overridden_by_name.String || "Unknown"}: ${
+                    data.override_justification.String
+                }`;
+                override.classList.remove("d-none");
+            } else {
+                override.innerText = "";
+                override.classList.add("d-none");
+            }
+
             document.getElementById("viewNotes").innerText =
                 data.notes.String || "";
             document.getElementById("ViewdeviceSerialNumber").innerText =
                 data.serial_number || "Unknown";
 
-            // Populate checkboxes
-            document.getElementById("ViewIsConspicuous").checked =
-                data.is_conspicuous.Bool && data.is_conspicuous.Valid;
-            document.getElementById("ViewIsAccessible").checked =
-                data.is_accessible.Bool && data.is_accessible.Valid;
-            document.getElementById("ViewIsAssignedLocation").checked =
-                data.is_assigned_location.Bool &&
-                data.is_assigned_location.Valid;
-            document.getElementById("ViewIsSignVisible").checked =
-                data.is_sign_visible.Bool && data.is_sign_visible.Valid;
-            document.getElementById("ViewIsAntiTamperDeviceIntact").checked =
-                data.is_anti_tamper_device_intact.Bool &&
-                data.is_anti_tamper_device_intact.Valid;
-            document.getElementById("ViewIsSupportBracketSecure").checked =
-                data.is_support_bracket_secure.Bool &&
-                data.is_support_bracket_secure.Valid;
             document.getElementById("ViewWorkOrderRequired").checked =
                 data.work_order_required.Bool && data.work_order_required.Valid;
-            document.getElementById(
-                "ViewAreOperatingInstructionsClear"
-            ).checked =
-                data.are_operating_instructions_clear.Bool &&
-                data.are_operating_instructions_clear.Valid;
-            document.getElementById("ViewIsMaintenanceTagAttached").checked =
-                data.is_maintenance_tag_attached.Bool &&
-                data.is_maintenance_tag_attached.Valid;
-            document.getElementById("ViewIsNoExternalDamage").checked =
-                data.is_no_external_damage.Bool &&
-                data.is_no_external_damage.Valid;
-            document.getElementById("ViewIsChargeGaugeNormal").checked =
-                data.is_charge_gauge_normal.Bool &&
-                data.is_charge_gauge_normal.Valid;
-            document.getElementById("ViewIsReplaced").checked =
-                data.is_replaced.Bool && data.is_replaced.Valid;
-            document.getElementById(
-                "ViewAreMaintenanceRecordsComplete"
-            ).checked =
-                data.are_maintenance_records_complete.Bool &&
-                data.are_maintenance_records_complete.Valid;
+
+            // Populate checklist answers
+            document.getElementById("ViewChecklistTemplateName").innerText =
+                data.checklist_template_name.Valid
+                    ? data.checklist_template_name.String
+                    : "";
+            const checklist = document.getElementById("ViewInspectionChecklist");
+            checklist.innerHTML = "";
+            if (!data.responses || data.responses.length === 0) {
+                checklist.innerHTML = `
+                    <p class="text-muted">No checklist answers recorded</p>
+                `;
+            }
+            (data.responses || []).forEach((response) => {
+                checklist.appendChild(renderChecklistAnswer(response));
+            });
+
+            // List the photos and documents of the inspection and its work order
+            showAttachments(
+                document.getElementById("ViewInspectionAttachments"),
+                `/api/inspection/${inspectionId}/attachment`
+            );
+            const workOrderAttachments = document.getElementById(
+                "ViewWorkOrderAttachments"
+            );
+            const workOrderRequired =
+                data.work_order_required.Valid && data.work_order_required.Bool;
+            workOrderAttachments.classList.toggle("d-none", !workOrderRequired);
+            if (workOrderRequired) {
+                showAttachments(
+                    workOrderAttachments,
+                    `/api/inspection/${inspectionId}/work-order/attachment`
+                );
+            }
 
             // Show the modal
             $("#viewInspectionDetailsModal").modal("show");
@@ -403,3 +715,371 @@ export function viewInspectionDetails(inspectionId) {
             console.error("Error fetching inspection details:", error);
         });
 }
+
+// renderChecklistAnswer shows the recorded answer to one checklist question
+function renderChecklistAnswer(response) {
+    const wrapper = document.createElement("div");
+    wrapper.className = "col-md-6 col-12 mb-2";
+
+    const question = document.createElement("strong");
+    question.innerText = response.question_text;
+    wrapper.appendChild(question);
+    wrapper.appendChild(document.createElement("br"));
+
+    if (response.attachment_id.Valid) {
+        const link = document.createElement("a");
+        link.href = `/api/attachment/${response.attachment_id.Int64}`;
+        link.target = "_blank";
+        const thumbnail = document.createElement("img");
+        thumbnail.src = `/api/attachment/${response.attachment_id.Int64}/thumbnail`;
+        thumbnail.alt = response.question_text;
+        thumbnail.className = "img-thumbnail";
+        thumbnail.style.maxHeight = "120px";
+        link.appendChild(thumbnail);
+        wrapper.appendChild(link);
+        return wrapper;
+    }
+
+    const answer = document.createElement("span");
+    if (response.answer_yes_no.Valid) {
+        answer.className = "badge";
+        answer.classList.add(
+            response.answer_yes_no.String !== "No"
+                ? "bg-success"
+                : response.severity === "Advisory"
+                ? "bg-warning"
+                : response.severity === "Informational"
+                ? "bg-secondary"
+                : "bg-danger"
+        );
+        answer.innerText = response.answer_yes_no.String;
+    } else if (response.answer_number.Valid) {
+        answer.innerText = response.answer_number.Float64;
+    } else if (response.answer_text.Valid) {
+        answer.innerText = response.answer_text.String;
+    } else {
+        answer.innerText = "N/A";
+    }
+    wrapper.appendChild(answer);
+
+    return wrapper;
+}
+
+// showInspectionSignature shows the inspector's signature and lets sealed inspections
+// be checked for changes since they were recorded
+function showInspectionSignature(inspection, dateTimeOptions) {
+    const signature = document.getElementById("ViewInspectionSignature");
+    const image = document.getElementById("ViewSignatureImage");
+    const verifyButton = document.getElementById("verifyInspectionBtn");
+    const verification = document.getElementById("ViewInspectionVerification");
+    const inspectionId = inspection.emergency_device_inspection_id;
+
+    signature.classList.toggle("d-none", !inspection.signature_type.Valid);
+    document.getElementById("ViewSignedName").innerText = `${
+        inspection.signed_name.String
+    } (${(inspection.signature_type.String || "").toLowerCase()})`;
+    document.getElementById("ViewSignedAt").innerText = inspection.signed_at
+        .Valid
+        ? formatDate(inspection.signed_at.Time, dateTimeOptions)
+        : "";
+    document.getElementById("ViewAttestationText").innerText =
+        inspection.attestation_text.String || "";
+
+    const drawn = inspection.signature_type.String === "Drawn";
+    image.classList.toggle("d-none", !drawn);
+    image.src = drawn ? `/api/inspection/${inspectionId}/signature` : "";
+
+    verification.classList.add("d-none");
+    verification.innerText = "";
+    verifyButton.classList.toggle("d-none", !inspection.content_hash.Valid);
+    verifyButton.onclick = () => {
+        fetch(`/api/inspection/${inspectionId}/verify`)
+            .then((response) => response.json())
+            .then((result) => {
+                const valid =
+                    result.content_valid && result.signature_valid !== false;
+                verification.className = `alert ${
+                    valid ? "alert-success" : "alert-danger"
+                }`;
+                verification.innerText = result.message || result.error;
+            })
+            .catch((error) => {
+                console.error("Error verifying inspection:", error);
+            });
+    };
+}
+
+// showInspectionRevisions describes the amendments and voids of the inspection's
+// revision chain and only offers to revise current inspections
+function showInspectionRevisions(inspection) {
+    const revisionAlert = document.getElementById("ViewInspectionRevision");
+    const reviseButton = document.getElementById("reviseInspectionBtn");
+
+    reviseButton.classList.toggle(
+        "d-none",
+        role !== "Admin" || inspection.revision_action.Valid
+    );
+    revisionAlert.classList.add("d-none");
+    revisionAlert.innerHTML = "";
+
+    if (
+        !inspection.revision_action.Valid &&
+        !inspection.amends_inspection_id.Valid
+    ) {
+        return;
+    }
+
+    fetch(
+        `/api/inspection/${inspection.emergency_device_inspection_id}/revisions`
+    )
+        .then((response) => response.json())
+        .then((revisions) => {
+            const heading = document.createElement("strong");
+            if (inspection.revision_action.String === "Void") {
+                heading.innerText = "This inspection has been voided.";
+            } else if (inspection.revision_action.Valid) {
+                heading.innerText = `This inspection has been amended, see inspection #${inspection.replaced_by_id.Int64}.`;
+            } else {
+                heading.innerText = `This inspection amends inspection #${inspection.amends_inspection_id.Int64}.`;
+            }
+            revisionAlert.appendChild(heading);
+
+            const list = document.createElement("ul");
+            list.className = "mb-0 mt-2";
+            revisions.forEach((revision) => {
+                const item = document.createElement("li");
+                const action =
+                    revision.action === "Void" ? "Voided" : "Amended";
+                item.innerText = `${action} #${
+                    revision.emergency_device_inspection_id
+                } by ${
+                    revision.revised_by_name.String || "Unknown"
+                } on ${formatDate(revision.revised_at.Time, {
+                    timeZone: inspection.site_time_zone || undefined,
+                    day: "numeric",
+                    month: "long",
+                    year: "numeric",
+                })}: ${revision.reason}`;
+                list.appendChild(item);
+            });
+            revisionAlert.appendChild(list);
+            revisionAlert.classList.remove("d-none");
+        })
+        .catch((error) => {
+            console.error("Error fetching inspection revisions:", error);
+        });
+}
+
+// toDateTimeLocal formats a timestamp as a datetime-local value in the site's time zone
+function toDateTimeLocal(dateString, timeZone) {
+    return new Date(dateString)
+        .toLocaleString("sv-SE", { timeZone: timeZone || undefined })
+        .replace(" ", "T")
+        .slice(0, 16);
+}
+
+export function reviseInspection() {
+    const inspection = currentInspection;
+    if (!inspection) {
+        return;
+    }
+
+    $("#viewInspectionDetailsModal").modal("hide");
+
+    const form = document.getElementById("reviseInspectionForm");
+    form.reset();
+    form.classList.remove("was-validated");
+    document.getElementById("reviseInspectionError").classList.add("d-none");
+
+    document.getElementById("revise_inspection_id").value =
+        inspection.emergency_device_inspection_id;
+    document.getElementById(
+        "reviseInspectionModalTitle"
+    ).innerText = `Amend or Void Inspection - Serial Number: ${inspection.serial_number}`;
+    document.getElementById("reviseInspectionDateTime").value = inspection
+        .inspection_datetime.Valid
+        ? toDateTimeLocal(
+              inspection.inspection_datetime.Time,
+              inspection.site_time_zone
+          )
+        : "";
+    document.getElementById("reviseNotes").value = inspection.notes.String || "";
+    document.getElementById("reviseWorkOrderRequired").checked =
+        inspection.work_order_required.Bool;
+    document.getElementById("reviseInspectionStatus").value = inspection
+        .override_justification.Valid
+        ? inspection.inspection_status
+        : inspection.checklist_template_id.Valid
+        ? ""
+        : inspection.inspection_status;
+    document.getElementById("reviseOverrideJustification").value =
+        inspection.override_justification.String || "";
+    toggleReviseAction();
+
+    // The inspection can only move to another device of the same type
+    const deviceSelect = document.getElementById("reviseDeviceId");
+    deviceSelect.innerHTML = `<option value="${inspection.emergency_device_id}">${inspection.serial_number}</option>`;
+    fetch(`/api/emergency-device/${inspection.emergency_device_id}`)
+        .then((response) => response.json())
+        .then((device) =>
+            fetch("/api/emergency-device")
+                .then((response) => response.json())
+                .then((devices) => {
+                    devices
+                        .filter(
+                            (other) =>
+                                other.emergency_device_type_id ===
+                                    device.emergency_device_type_id &&
+                                other.emergency_device_id !==
+                                    inspection.emergency_device_id
+                        )
+                        .forEach((other) => {
+                            const option = document.createElement("option");
+                            option.value = other.emergency_device_id;
+                            option.innerText = `${
+                                other.serial_number.String || "No serial"
+                            } - ${other.building_code} ${other.room_code}`;
+                            deviceSelect.appendChild(option);
+                        });
+                })
+        )
+        .catch((error) => {
+            console.error("Error fetching devices:", error);
+        });
+
+    // Prefill the checklist with the recorded answers, photos cannot be changed
+    const checklist = document.getElementById("reviseInspectionChecklist");
+    checklist.innerHTML = "";
+    if (inspection.checklist_template_id.Valid) {
+        fetch(
+            `/api/checklist-template/${inspection.checklist_template_id.Int64}`
+        )
+            .then((response) => response.json())
+            .then((template) => {
+                template.questions
+                    .filter((question) => question.answer_type !== "Photo")
+                    .forEach((question) => {
+                        const field = renderChecklistQuestion(
+                            question,
+                            "reviseChecklistQuestion"
+                        );
+                        const input = field.querySelector("[data-answer-type]");
+                        const response = (inspection.responses || []).find(
+                            (r) =>
+                                r.checklist_question_id ===
+                                question.checklist_question_id
+                        );
+                        if (response) {
+                            if (response.answer_yes_no.Valid) {
+                                input.value = response.answer_yes_no.String;
+                            } else if (response.answer_number.Valid) {
+                                input.value = response.answer_number.Float64;
+                            } else if (response.answer_text.Valid) {
+                                input.value = response.answer_text.String;
+                            }
+                        }
+                        checklist.appendChild(field);
+                    });
+            })
+            .catch((error) => {
+                console.error("Error fetching checklist:", error);
+            });
+    } else {
+        checklist.innerHTML = `
+            <p class="text-muted">This inspection has no checklist</p>
+        `;
+    }
+
+    $("#reviseInspectionModal").modal("show");
+}
+
+function toggleReviseAction() {
+    const amending = document.getElementById("reviseActionAmend").checked;
+    const amendFields = document.getElementById("reviseAmendFields");
+    amendFields.classList.toggle("d-none", !amending);
+    document.getElementById("reviseInspectionDateTime").required = amending;
+}
+
+export function initializeReviseInspectionForm() {
+    const form = document.getElementById("reviseInspectionForm");
+    const submitButton = document.getElementById("reviseInspectionSubmitBtn");
+    const reviseButton = document.getElementById("reviseInspectionBtn");
+    const errorAlert = document.getElementById("reviseInspectionError");
+
+    if (!form || !submitButton || !reviseButton) {
+        console.error("Required elements not found in the DOM.");
+        return;
+    }
+
+    reviseButton.addEventListener("click", reviseInspection);
+    form.querySelectorAll("input[name='revise_action']").forEach((radio) => {
+        radio.addEventListener("change", toggleReviseAction);
+    });
+
+    submitButton.addEventListener("click", async function (event) {
+        event.preventDefault();
+        form.classList.add("was-validated");
+        if (!form.checkValidity()) {
+            event.stopPropagation();
+            return;
+        }
+
+        const inspectionId = document.getElementById(
+            "revise_inspection_id"
+        ).value;
+        const reason = document.getElementById("reviseReason").value;
+        const amending = document.getElementById("reviseActionAmend").checked;
+
+        let url = `/api/inspection/${inspectionId}/void`;
+        let body = { reason };
+        if (amending) {
+            const answers = {};
+            document
+                .querySelectorAll(
+                    "#reviseInspectionChecklist [data-answer-type]"
+                )
+                .forEach((input) => {
+                    answers[input.name.replace("answer_", "")] = input.value;
+                });
+            url = `/api/inspection/${inspectionId}/amend`;
+            body = {
+                reason,
+                device_id: document.getElementById("reviseDeviceId").value,
+                inspection_datetime: document.getElementById(
+                    "reviseInspectionDateTime"
+                ).value,
+                notes: document.getElementById("reviseNotes").value,
+                work_order_required: document.getElementById(
+                    "reviseWorkOrderRequired"
+                ).checked,
+                answers,
+                inspection_status: document.getElementById(
+                    "reviseInspectionStatus"
+                ).value,
+                override_justification: document.getElementById(
+                    "reviseOverrideJustification"
+                ).value,
+            };
+        }
+
+        try {
+            const response = await fetch(url, {
+                method: "POST",
+                headers: { "Content-Type": "application/json" },
+                body: JSON.stringify(body),
+            });
+            const data = await response.json();
+            if (!response.ok || data.error) {
+                errorAlert.innerText = data.error || "Error saving changes";
+                errorAlert.classList.remove("d-none");
+                return;
+            }
+            sessionStorage.setItem("shouldRefreshNotifications", "true");
+            window.location.href = data.redirectURL;
+        } catch (error) {
+            console.error("Error revising inspection:", error);
+            errorAlert.innerText = "Error saving changes";
+            errorAlert.classList.remove("d-none");
+        }
+    });
+}
@@ -1,8 +1,11 @@
 import {
     clearAllNotifications,
     clearNotificationById,
+    markNotificationsRead,
     updateNotificationsUI,
 } from "/static/main/notifications.js";
+import { viewDigestSettings } from "/static/main/digest.js";
+import { viewCalendarSettings } from "/static/main/calendar.js";
 
 export function logout() {
     window.location.href = "/logout";
@@ -10,14 +13,16 @@ export function logout() {
 
 export function viewNotifications() {
     $("#notificationsModal").modal("show");
+    // Notifications stay marked as new while the modal is open
+    markNotificationsRead();
 }
 
 export function clearAllNotificationsHandler() {
     clearAllNotifications(); // Calls the function in notifications.js
 }
 
-export function clearNotificationHandler(deviceId) {
-    clearNotificationById(deviceId); // Calls the function in notifications.js
+export function clearNotificationHandler(notificationId) {
+    clearNotificationById(notificationId); // Calls the function in notifications.js
 }
 
 export async function refreshNotificationsHandler() {
@@ -33,10 +38,8 @@ export async function refreshNotificationsHandler() {
             }
         }
 
-        // Clear session storage to force fresh data
-        sessionStorage.removeItem("notifications");
-        // Get fresh notifications and update UI
-        await updateNotificationsUI();
+        // Regenerate notifications on the server and update UI
+        await updateNotificationsUI(null, true);
     } catch (error) {
         console.error("Error refreshing notifications:", error);
     } finally {
@@ -227,6 +230,8 @@ if (savedTheme) {
 // Make functions available to the browser
 window.logout = logout;
 window.viewNotifications = viewNotifications;
+window.viewDigestSettings = viewDigestSettings;
+window.viewCalendarSettings = viewCalendarSettings;
 window.clearAllNotificationsHandler = clearAllNotificationsHandler;
 window.clearNotificationHandler = clearNotificationHandler;
 window.refreshNotificationsHandler = refreshNotificationsHandler;
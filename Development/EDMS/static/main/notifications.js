@@ -55,216 +55,41 @@ export async function updateDeviceStatus(deviceId, status) {
     }
 }
 
-// Initialize currentNotifications from sessionStorage or empty array
-let currentNotifications =
-    JSON.parse(sessionStorage.getItem("notifications")) || [];
+// Notifications are generated on the server, read and dismissed state is kept per user
+let currentNotifications = [];
+
+// fetchNotifications returns the logged in user's notifications, most urgent first
+export async function fetchNotifications() {
+    const response = await fetch("/api/notification");
+    if (!response.ok) {
+        throw new Error(`HTTP error! status: ${response.status}`);
+    }
+    return response.json();
+}
 
+// generateNotifications asks the server to bring device statuses and notifications up to
+// date straight away, instead of waiting for the background job, then returns the user's
+// notifications. Only admins can run the jobs, other users get the current notifications.
 export async function generateNotifications() {
-    const allDevices = await getAllDevices();
-
-    const currentDate = new Date();
-    const thirtyDaysFromNow = new Date();
-    thirtyDaysFromNow.setDate(currentDate.getDate() + 30);
-
-    // Helper function to calculate days difference
-    const calculateDaysOverdue = (date) => {
-        const diffTime = currentDate - new Date(date);
-        return Math.ceil(diffTime / (1000 * 60 * 60 * 24));
-    };
-
-    // Helper function to check if a date is today or in the past
-    const isDateDueOrPast = (date) => {
-        const targetDate = new Date(date);
-        targetDate.setHours(0, 0, 0, 0);
-        const today = new Date();
-        today.setHours(0, 0, 0, 0);
-        return targetDate <= today;
-    };
-
-    // Update device statuses first
-    for (const device of allDevices) {
-        let statusUpdated = false;
-
-        // Skip updating if the status is already "Inspection Failed"
-        if (device.status.String === "Inspection Failed") {
-            continue; // Skip this device as it already has the "Inspection Failed" status
-        }
-
-        // Check inspection date
-        if (
-            device.next_inspection_date.Valid &&
-            isDateDueOrPast(device.next_inspection_date.Time) &&
-            device.status.String !== "Inspection Due"
-        ) {
-            const success = await updateDeviceStatus(
-                device.emergency_device_id,
-                "Inspection Due"
-            );
-            if (success) {
-                device.status.String = "Inspection Due";
-                statusUpdated = true;
-            }
-        }
-
-        // Check expire date
-        if (
-            device.expire_date.Valid &&
-            isDateDueOrPast(device.expire_date.Time) &&
-            device.status.String !== "Expired" &&
-            !statusUpdated
-        ) {
-            const success = await updateDeviceStatus(
-                device.emergency_device_id,
-                "Expired"
-            );
-            if (success) {
-                device.status.String = "Expired";
-            }
-        }
+    if (role !== "Admin") {
+        return fetchNotifications();
     }
 
-    // Clear all existing notifications for devices that had status changes
-    const clearedDevices = getClearedNotifications();
-
-    // Create notifications map
-    const notificationMap = new Map();
-
-    // Helper function to add or update device notification
-    const updateDeviceNotification = (device, reason, days = null) => {
-        // Always create a fresh notification entry
-        notificationMap.set(device.emergency_device_id, {
-            ...device,
-            notification_details: [
-                {
-                    reason: reason,
-                    days: days,
-                },
-            ],
-        });
-    };
-
-    // Process each device for notifications
-    allDevices.forEach((device) => {
-        // Skip inactive devices
-        if (device.status.String === "Inactive") {
-            return;
-        }
-
-        // Clear any existing notifications for this device
-        if (notificationMap.has(device.emergency_device_id)) {
-            notificationMap.delete(device.emergency_device_id);
-        }
-
-        // Process notifications based on current status
-        // Priority order is maintained by the order of these checks
-        if (device.status.String === "Inspection Failed") {
-            updateDeviceNotification(device, "Inspection Failed");
-        } else if (
-            device.status.String === "Expired" &&
-            device.expire_date.Valid
-        ) {
-            const daysOverdue = calculateDaysOverdue(device.expire_date.Time);
-            updateDeviceNotification(device, "Expired", daysOverdue);
-        } else if (
-            device.status.String === "Inspection Due" &&
-            device.next_inspection_date.Valid
-        ) {
-            const daysOverdue = calculateDaysOverdue(
-                device.next_inspection_date.Time
-            );
-            updateDeviceNotification(device, "Inspection Due", daysOverdue);
-        } else {
-            // Check for upcoming issues only if no current issues
-            if (device.expire_date.Valid) {
-                const expireDate = new Date(device.expire_date.Time);
-                if (
-                    expireDate > currentDate &&
-                    expireDate <= thirtyDaysFromNow
-                ) {
-                    const daysUntil = Math.ceil(
-                        (expireDate - currentDate) / (1000 * 60 * 60 * 24)
-                    );
-                    updateDeviceNotification(
-                        device,
-                        "Expiring Soon",
-                        daysUntil
-                    );
-                }
-            }
-
-            if (
-                !notificationMap.has(device.emergency_device_id) &&
-                device.next_inspection_date.Valid
-            ) {
-                const inspectionDate = new Date(
-                    device.next_inspection_date.Time
-                );
-                if (
-                    inspectionDate > currentDate &&
-                    inspectionDate <= thirtyDaysFromNow
-                ) {
-                    const daysUntil = Math.ceil(
-                        (inspectionDate - currentDate) / (1000 * 60 * 60 * 24)
-                    );
-                    updateDeviceNotification(
-                        device,
-                        "Inspection Due Soon",
-                        daysUntil
-                    );
-                }
-            }
-        }
-    });
-
-    // Convert map to array
-    const notifications = Array.from(notificationMap.values());
-
-    // Sort notifications by priority
-    const priorityOrder = {
-        "Inspection Failed": 0,
-        Expired: 1,
-        "Inspection Due": 2,
-        "Expiring Soon": 3,
-        "Inspection Due Soon": 4,
-    };
-
-    notifications.sort((a, b) => {
-        const aPriority = priorityOrder[a.notification_details[0].reason];
-        const bPriority = priorityOrder[b.notification_details[0].reason];
-
-        if (aPriority !== bPriority) {
-            return aPriority - bPriority;
-        }
-
-        // If same priority, sort by days overdue (highest first)
-        return (
-            (b.notification_details[0].days || 0) -
-            (a.notification_details[0].days || 0)
-        );
+    const response = await fetch("/api/notification/generate", {
+        method: "POST",
     });
+    if (!response.ok) {
+        console.error("Failed to generate notifications:", response.status);
+    }
 
-    // Update global notifications list
-    currentNotifications = notifications;
-
-    // Filter out manually cleared notifications
-    const filteredNotifications = notifications.filter(
-        (device) => !clearedDevices.includes(device.emergency_device_id)
-    );
-
-    return filteredNotifications;
+    return fetchNotifications();
 }
 
 export async function refreshNotificationsPreservingCleared() {
     try {
-        // Generate fresh notifications (this will already exclude cleared ones)
+        // Dismissed notifications stay dismissed on the server
         const freshNotifications = await generateNotifications();
-
-        // Update session storage with new notifications
-        saveNotificationsToSession(freshNotifications);
-
-        // Update the UI
         await updateNotificationsUI(freshNotifications);
-
         return freshNotifications;
     } catch (error) {
         console.error("Failed to refresh notifications:", error);
@@ -276,11 +101,6 @@ export async function refreshNotificationsPreservingCleared() {
 export async function refreshAfterChange() {
     try {
         const freshNotifications = await generateNotifications();
-        currentNotifications = freshNotifications;
-        sessionStorage.setItem(
-            "notifications",
-            JSON.stringify(freshNotifications)
-        );
         await updateNotificationsUI(freshNotifications);
     } catch (error) {
         console.error("Error refreshing notifications after change:", error);
@@ -298,13 +118,18 @@ export function generateNotificationHTML(notifications) {
         `;
     }
 
-    const getStatusBadge = (detail) => {
-        const { reason, days } = detail;
+    const getStatusBadge = (notification) => {
+        const days = notification.days;
         let badgeClass = "";
         let icon = "";
         let text = "";
 
-        switch (reason) {
+        switch (notification.notification_type) {
+            case "Recalled":
+                badgeClass = "bg-danger text-light";
+                icon = '<i class="text-danger fa fa-exclamation-circle"></i>';
+                text = "Recalled by manufacturer";
+                break;
             case "Inspection Failed":
                 badgeClass = "bg-danger text-light";
                 icon = '<i class="text-danger fa fa-exclamation-circle"></i>';
@@ -315,7 +140,7 @@ export function generateNotificationHTML(notifications) {
                 icon = '<i class="text-danger fa fa-exclamation-circle"></i>';
                 text = `Expired (${days} days ago)`;
                 break;
-            case "Inspection Due":
+            case "Inspection Overdue":
                 badgeClass = "bg-danger text-light";
                 icon = '<i class="text-danger fa fa-exclamation-circle"></i>';
                 text = `Inspection Due (${days} days ago)`;
@@ -326,7 +151,7 @@ export function generateNotificationHTML(notifications) {
                     '<i class="text-warning fa-solid fa-exclamation-triangle"></i>';
                 text = `Expires (In ${days} days)`;
                 break;
-            case "Inspection Due Soon":
+            case "Inspection Due":
                 badgeClass = "bg-warning text-black";
                 icon =
                     '<i class="text-warning fa-solid fa-exclamation-triangle"></i>';
@@ -339,28 +164,30 @@ export function generateNotificationHTML(notifications) {
 
     let html = "";
 
-    notifications.forEach((device) => {
-        // Get highest priority notification detail
-        const mainDetail = device.notification_details.reduce((a, b) =>
-            priorityOrder[a.reason] < priorityOrder[b.reason] ? a : b
-        );
-
-        const { badgeClass, icon, text } = getStatusBadge(mainDetail);
+    notifications.forEach((notification) => {
+        const { badgeClass, icon, text } = getStatusBadge(notification);
 
         html += `
             <div class="card mb-3">
                 <div class="card-body">
                     <h5 class="card-title">
-                        ${device.emergency_device_type_name}
+                        ${notification.emergency_device_type_name}
                         ${icon}
+                        ${
+                            notification.read_at.Valid
+                                ? ""
+                                : '<span class="badge bg-primary ms-1">New</span>'
+                        }
                     </h5>
                     <div class="card-text">
                         <div class="d-flex justify-content-between">
                             <div>
                                 <span>Serial Number: ${
-                                    device.serial_number.String
+                                    notification.serial_number.String || "N/A"
                                 }</span><br />
-                                <span>Room: ${device.room_code}</span><br />
+                                <span>Location: ${notification.site_name}, ${
+            notification.building_code
+        } ${notification.room_code}</span><br />
                                 <span>Status: 
                                     <span class="badge ${badgeClass}">
                                         ${text}
@@ -369,14 +196,16 @@ export function generateNotificationHTML(notifications) {
                             </div>
                             <div>
                                 ${
-                                    mainDetail.reason.includes("Inspection")
-                                        ? `<button class="btn btn-primary" onclick="viewDeviceInspections(${device.emergency_device_id})">
+                                    notification.notification_type.includes(
+                                        "Inspection"
+                                    )
+                                        ? `<button class="btn btn-primary" onclick="viewDeviceInspections(${notification.emergency_device_id})">
                                         Inspect
                                     </button>`
                                         : ""
                                 }
                                 <button class="btn btn-secondary" onclick="clearNotificationHandler(${
-                                    device.emergency_device_id
+                                    notification.notification_id
                                 })">
                                     Clear
                                 </button>
@@ -391,54 +220,60 @@ export function generateNotificationHTML(notifications) {
     return html;
 }
 
-function getClearedNotifications() {
-    const cleared = sessionStorage.getItem("clearedNotifications");
-    return cleared ? JSON.parse(cleared) : [];
-}
-
-function addToClearedNotifications(deviceId) {
-    const clearedNotifications = getClearedNotifications();
-    if (!clearedNotifications.includes(deviceId)) {
-        clearedNotifications.push(deviceId);
-        sessionStorage.setItem(
-            "clearedNotifications",
-            JSON.stringify(clearedNotifications)
+export async function clearNotificationById(notificationId) {
+    try {
+        const response = await fetch(
+            `/api/notification/${notificationId}/dismiss`,
+            { method: "PUT" }
+        );
+        if (!response.ok) {
+            throw new Error(`HTTP error! status: ${response.status}`);
+        }
+    } catch (error) {
+        console.error(
+            `Failed to dismiss notification ${notificationId}:`,
+            error
         );
     }
-}
-
-// Function to save notifications to sessionStorage
-function saveNotificationsToSession(notifications) {
-    sessionStorage.setItem("notifications", JSON.stringify(notifications));
-}
-
-export function clearNotificationById(deviceId) {
-    addToClearedNotifications(deviceId);
     currentNotifications = currentNotifications.filter(
-        (device) => device.emergency_device_id !== deviceId
+        (notification) => notification.notification_id !== notificationId
     );
-    saveNotificationsToSession(currentNotifications);
     updateNotificationsUI(currentNotifications);
 }
 
 // Function to clear all notifications
-export function clearAllNotifications() {
-    currentNotifications = [];
-    saveNotificationsToSession(currentNotifications);
+export async function clearAllNotifications() {
+    try {
+        const response = await fetch("/api/notification/dismiss-all", {
+            method: "POST",
+        });
+        if (!response.ok) {
+            throw new Error(`HTTP error! status: ${response.status}`);
+        }
+        currentNotifications = [];
+    } catch (error) {
+        console.error("Failed to dismiss notifications:", error);
+    }
     updateNotificationsUI(currentNotifications);
 }
 
-export async function checkForNewNotifications() {
+// markNotificationsRead marks the listed notifications as read once they have been seen
+export async function markNotificationsRead() {
+    if (!currentNotifications.some((notification) => !notification.read_at.Valid)) {
+        return;
+    }
     try {
-        // Generate fresh notifications
-        const freshNotifications = await generateNotifications();
-
-        // Save to session storage
-        saveNotificationsToSession(freshNotifications);
+        await fetch("/api/notification/read-all", { method: "POST" });
+        updateNotificationCount(0);
+    } catch (error) {
+        console.error("Failed to mark notifications as read:", error);
+    }
+}
 
-        // Update the UI with new notifications
+export async function checkForNewNotifications() {
+    try {
+        const freshNotifications = await fetchNotifications();
         await updateNotificationsUI(freshNotifications);
-
         return freshNotifications;
     } catch (error) {
         console.error("Failed to refresh notifications:", error);
@@ -446,30 +281,42 @@ export async function checkForNewNotifications() {
     }
 }
 
+function updateNotificationCount(count) {
+    const notificationCountElement = document.querySelector(
+        ".notification-count"
+    );
+    if (notificationCountElement) {
+        notificationCountElement.textContent = count;
+    } else {
+        console.error("Notification count element not found");
+    }
+}
+
+// Set once the first count pushed by /api/events has arrived
+let liveNotificationCount = null;
+
+// handleNotificationCount updates the navbar with the count pushed by /api/events and
+// reloads the list when the notifications changed after the page loaded
+export async function handleNotificationCount(count) {
+    const changed = liveNotificationCount !== null;
+    liveNotificationCount = count;
+    updateNotificationCount(count.unread);
+
+    if (changed) {
+        await updateNotificationsUI();
+    }
+}
+
 // Modify updateNotificationsUI to accept a forceRefresh parameter
 export async function updateNotificationsUI(
     notifications,
     forceRefresh = false
 ) {
     try {
-        if (!notifications || forceRefresh) {
-            if (forceRefresh) {
-                // Generate fresh notifications if force refresh
-                notifications = await generateNotifications();
-                saveNotificationsToSession(notifications);
-            } else {
-                // Check session storage first
-                const storedNotifications =
-                    sessionStorage.getItem("notifications");
-                // check if storedNotifications is null
-                if (storedNotifications) {
-                    notifications = JSON.parse(storedNotifications);
-                    // if storedNotifications is null then generate new notifications
-                } else {
-                    notifications = await generateNotifications();
-                    saveNotificationsToSession(notifications);
-                }
-            }
+        if (forceRefresh) {
+            notifications = await generateNotifications();
+        } else if (!notifications) {
+            notifications = await fetchNotifications();
         }
 
         const html = generateNotificationHTML(notifications);
@@ -484,15 +331,11 @@ export async function updateNotificationsUI(
             console.error("Notifications element not found");
         }
 
-        // Update the notification count
-        const notificationCountElement = document.querySelector(
-            ".notification-count"
+        // The navbar counts notifications the user has not read yet
+        updateNotificationCount(
+            notifications.filter((notification) => !notification.read_at.Valid)
+                .length
         );
-        if (notificationCountElement) {
-            notificationCountElement.textContent = notifications.length;
-        } else {
-            console.error("Notification count element not found");
-        }
 
         // Keep currentNotifications in sync
         currentNotifications = notifications;
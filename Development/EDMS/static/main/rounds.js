@@ -0,0 +1,410 @@
+// rounds.js
+function formatDueDate(dateString) {
+    if (!dateString) {
+        return "N/A";
+    }
+    // Due dates are calendar dates, show them without converting the time zone
+    return new Date(dateString).toLocaleDateString("en-NZ", {
+        timeZone: "UTC",
+        day: "numeric",
+        month: "long",
+        year: "numeric",
+    });
+}
+
+function roundStatusBadge(round) {
+    let badgeClass = "text-bg-primary";
+    if (round.status === "Completed") {
+        badgeClass = "text-bg-success";
+    } else if (round.status === "Cancelled") {
+        badgeClass = "text-bg-secondary";
+    } else if (round.stats.is_overdue) {
+        return `<span class="badge text-bg-danger">Overdue</span>`;
+    } else if (round.status === "In Progress") {
+        badgeClass = "text-bg-info";
+    }
+    return `<span class="badge ${badgeClass}">${round.status}</span>`;
+}
+
+function roundProgress(round) {
+    const percent = Math.round(round.stats.percent_complete);
+    return `
+        <div class="progress" role="progressbar" aria-valuenow="${percent}" aria-valuemin="0" aria-valuemax="100">
+            <div class="progress-bar" style="width: ${percent}%">${percent}%</div>
+        </div>
+        <small>${round.stats.inspected_items} inspected, ${round.stats.skipped_items} skipped of ${round.stats.total_items}</small>
+    `;
+}
+
+function roundLocation(round) {
+    return round.building_code.Valid
+        ? `${round.site_name} - ${round.building_code.String}`
+        : `${round.site_name} - All Buildings`;
+}
+
+export function viewInspectionRounds() {
+    const assignedToMe = document.getElementById("roundsAssignedToMe").checked;
+    const url = assignedToMe
+        ? "/api/inspection-round?assigned_to=me"
+        : "/api/inspection-round";
+
+    fetch(url)
+        .then((response) => response.json())
+        .then((data) => {
+            const roundTable = document.getElementById("inspectionRoundTable");
+
+            if (!data || !Array.isArray(data) || data.length === 0) {
+                roundTable.innerHTML = `
+                    <tr>
+                        <td colspan="7" class="text-center">No inspection rounds found</td>
+                    </tr>
+                `;
+                return;
+            }
+
+            roundTable.innerHTML = data
+                .map(
+                    (round) => `
+                    <tr>
+                        <td data-label="Round">${round.round_name}</td>
+                        <td data-label="Location">${roundLocation(round)}</td>
+                        <td data-label="Inspector">${
+                            round.assigned_to_name.String || "Unassigned"
+                        }</td>
+                        <td data-label="Due Date">${formatDueDate(
+                            round.due_date.Time
+                        )}</td>
+                        <td data-label="Status">${roundStatusBadge(round)}</td>
+                        <td data-label="Progress">${roundProgress(round)}</td>
+                        <td>
+                            <button class="btn btn-primary" onclick="viewInspectionRound(${
+                                round.inspection_round_id
+                            })">View</button>
+                        </td>
+                    </tr>
+                `
+                )
+                .join("");
+        })
+        .catch((error) => {
+            console.error("Error fetching inspection rounds:", error);
+            document.getElementById("inspectionRoundTable").innerHTML = `
+                <tr>
+                    <td colspan="7" class="text-center">Failed to load inspection rounds</td>
+                </tr>
+            `;
+        });
+
+    $("#inspectionRoundsModal").modal("show");
+}
+
+export function viewInspectionRound(roundId) {
+    $("#inspectionRoundsModal").modal("hide");
+    cancelSkipRoundItem();
+    document.getElementById("inspectionRoundError").classList.add("d-none");
+
+    fetch(`/api/inspection-round/${roundId}`)
+        .then((response) => response.json())
+        .then((round) => {
+            const open =
+                round.status !== "Completed" && round.status !== "Cancelled";
+
+            document.getElementById(
+                "inspectionRoundModalTitle"
+            ).innerText = `Inspection Round - ${round.round_name}`;
+
+            const skipped = Object.entries(round.stats.skipped_by_reason || {})
+                .map(([reason, count]) => `${reason}: ${count}`)
+                .join(", ");
+            document.getElementById("inspectionRoundSummary").innerHTML = `
+                <p class="mb-1"><strong>Location:</strong> ${roundLocation(
+                    round
+                )}</p>
+                <p class="mb-1"><strong>Inspector:</strong> ${
+                    round.assigned_to_name.String || "Unassigned"
+                } &middot; <strong>Due:</strong> ${formatDueDate(
+                round.due_date.Time
+            )} ${roundStatusBadge(round)}</p>
+                <p class="mb-1"><strong>Results:</strong> ${
+                    round.stats.passed_inspections
+                } passed, ${
+                round.stats.defect_inspections
+            } passed with defects, ${round.stats.failed_inspections} failed</p>
+                ${
+                    skipped
+                        ? `<p class="mb-1"><strong>Skipped:</strong> ${skipped}</p>`
+                        : ""
+                }
+                ${roundProgress(round)}
+            `;
+
+            document.getElementById("inspectionRoundItemTable").innerHTML =
+                round.items
+                    .map((item) => {
+                        let badgeClass = "text-bg-secondary";
+                        if (item.status === "Inspected") {
+                            badgeClass = "text-bg-success";
+                        } else if (item.status === "Skipped") {
+                            badgeClass = "text-bg-warning";
+                        }
+
+                        let actions = "";
+                        if (open && item.status === "Pending") {
+                            actions = `
+                                <button class="btn btn-primary" onclick="inspectRoundItem(${item.emergency_device_id})">Inspect</button>
+                                <button class="btn btn-warning" onclick="skipRoundItem(${round.inspection_round_id}, ${item.inspection_round_item_id})">Skip</button>
+                            `;
+                        } else if (open && item.status === "Skipped") {
+                            actions = `<button class="btn btn-secondary" onclick="reopenRoundItem(${round.inspection_round_id}, ${item.inspection_round_item_id})">Reopen</button>`;
+                        }
+
+                        return `
+                            <tr>
+                                <td data-label="#">${item.sort_order}</td>
+                                <td data-label="Building">${item.building_code}</td>
+                                <td data-label="Room">${item.room_code}</td>
+                                <td data-label="Device">${
+                                    item.emergency_device_type_name
+                                } ${item.serial_number.String || ""}</td>
+                                <td data-label="Last Inspection">${
+                                    item.last_inspection_datetime.Valid
+                                        ? formatDueDate(
+                                              item.last_inspection_datetime.Time
+                                          )
+                                        : "Never"
+                                }</td>
+                                <td data-label="Status">
+                                    <span class="badge ${badgeClass}">${
+                            item.status
+                        }</span>
+                                    ${
+                                        item.inspection_status.Valid
+                                            ? `<small>${item.inspection_status.String}</small>`
+                                            : ""
+                                    }
+                                    ${
+                                        item.skip_reason.Valid
+                                            ? `<small>${item.skip_reason.String}${
+                                                  item.skip_notes.Valid
+                                                      ? ` - ${item.skip_notes.String}`
+                                                      : ""
+                                              }</small>`
+                                            : ""
+                                    }
+                                </td>
+                                <td>${actions}</td>
+                            </tr>
+                        `;
+                    })
+                    .join("");
+
+            const cancelButton = document.getElementById(
+                "cancelInspectionRoundBtn"
+            );
+            cancelButton.classList.toggle("d-none", !open);
+            cancelButton.onclick = () =>
+                cancelInspectionRound(round.inspection_round_id);
+        })
+        .catch((error) => {
+            console.error("Error fetching inspection round:", error);
+            document.getElementById("inspectionRoundItemTable").innerHTML = `
+                <tr>
+                    <td colspan="7" class="text-center">Failed to load inspection round</td>
+                </tr>
+            `;
+        });
+
+    $("#inspectionRoundModal").modal("show");
+}
+
+export function inspectRoundItem(deviceId) {
+    $("#inspectionRoundModal").modal("hide");
+    viewDeviceInspections(deviceId);
+}
+
+export function skipRoundItem(roundId, itemId) {
+    const form = document.getElementById("skipRoundItemForm");
+    form.dataset.roundId = roundId;
+    document.getElementById("skip_round_item_id").value = itemId;
+    document.getElementById("skipNotes").value = "";
+    form.classList.remove("d-none");
+    form.scrollIntoView({ behavior: "smooth" });
+}
+
+export function cancelSkipRoundItem() {
+    document.getElementById("skipRoundItemForm").classList.add("d-none");
+}
+
+export function submitSkipRoundItem() {
+    const form = document.getElementById("skipRoundItemForm");
+    updateRoundItem(
+        form.dataset.roundId,
+        document.getElementById("skip_round_item_id").value,
+        {
+            status: "Skipped",
+            skip_reason: document.getElementById("skipReason").value,
+            skip_notes: document.getElementById("skipNotes").value,
+        }
+    );
+}
+
+export function reopenRoundItem(roundId, itemId) {
+    updateRoundItem(roundId, itemId, { status: "Pending" });
+}
+
+async function updateRoundItem(roundId, itemId, body) {
+    const errorAlert = document.getElementById("inspectionRoundError");
+    try {
+        const response = await fetch(
+            `/api/inspection-round/${roundId}/item/${itemId}`,
+            {
+                method: "PUT",
+                headers: { "Content-Type": "application/json" },
+                body: JSON.stringify(body),
+            }
+        );
+        const data = await response.json();
+        if (!response.ok || data.error) {
+            errorAlert.innerText = data.error || "Error updating round";
+            errorAlert.classList.remove("d-none");
+            return;
+        }
+        viewInspectionRound(roundId);
+    } catch (error) {
+        console.error("Error updating inspection round:", error);
+        errorAlert.innerText = "Error updating round";
+        errorAlert.classList.remove("d-none");
+    }
+}
+
+async function cancelInspectionRound(roundId) {
+    if (!confirm("Cancel this inspection round?")) {
+        return;
+    }
+    const response = await fetch(`/api/inspection-round/${roundId}/cancel`, {
+        method: "POST",
+    });
+    const data = await response.json();
+    window.location.href = data.redirectURL;
+}
+
+export function addInspectionRound() {
+    $("#inspectionRoundsModal").modal("hide");
+
+    const form = document.getElementById("addInspectionRoundForm");
+    form.reset();
+    form.classList.remove("was-validated");
+    document.getElementById("addInspectionRoundError").classList.add("d-none");
+
+    const siteSelect = document.getElementById("roundSiteId");
+    fetch("/api/site")
+        .then((response) => response.json())
+        .then((sites) => {
+            siteSelect.innerHTML =
+                `<option value="">Select a site</option>` +
+                sites
+                    .map(
+                        (site) =>
+                            `<option value="${site.site_id}">${site.site_name}</option>`
+                    )
+                    .join("");
+            loadRoundBuildings();
+        })
+        .catch((error) => console.error("Error fetching sites:", error));
+
+    // Only admins can record inspections, so only they can be assigned a round
+    const inspectorSelect = document.getElementById("roundAssignedTo");
+    fetch("/api/user")
+        .then((response) => response.json())
+        .then((users) => {
+            inspectorSelect.innerHTML = users
+                .filter((user) => user.role === "Admin")
+                .map(
+                    (user) =>
+                        `<option value="${user.user_id}" ${
+                            String(user.user_id) === user_id ? "selected" : ""
+                        }>${user.username}</option>`
+                )
+                .join("");
+        })
+        .catch((error) => console.error("Error fetching users:", error));
+
+    $("#addInspectionRoundModal").modal("show");
+}
+
+function loadRoundBuildings() {
+    const siteId = document.getElementById("roundSiteId").value;
+    const buildingSelect = document.getElementById("roundBuildingId");
+    buildingSelect.innerHTML = `<option value="">All Buildings</option>`;
+    if (!siteId) {
+        return;
+    }
+
+    fetch(`/api/building?siteId=${siteId}`)
+        .then((response) => response.json())
+        .then((buildings) => {
+            buildingSelect.innerHTML += buildings
+                .map(
+                    (building) =>
+                        `<option value="${building.building_id}">${building.building_code}</option>`
+                )
+                .join("");
+        })
+        .catch((error) => console.error("Error fetching buildings:", error));
+}
+
+export function initializeInspectionRoundForm() {
+    const form = document.getElementById("addInspectionRoundForm");
+    const submitButton = document.getElementById("addInspectionRoundSubmitBtn");
+    const errorAlert = document.getElementById("addInspectionRoundError");
+
+    if (!form || !submitButton) {
+        console.error("Required elements not found in the DOM.");
+        return;
+    }
+
+    document
+        .getElementById("roundSiteId")
+        .addEventListener("change", loadRoundBuildings);
+    document
+        .getElementById("roundsAssignedToMe")
+        .addEventListener("change", viewInspectionRounds);
+
+    submitButton.addEventListener("click", async function (event) {
+        event.preventDefault();
+        form.classList.add("was-validated");
+        if (!form.checkValidity()) {
+            event.stopPropagation();
+            return;
+        }
+
+        const body = {
+            round_name: document.getElementById("roundName").value,
+            site_id: document.getElementById("roundSiteId").value,
+            building_id: document.getElementById("roundBuildingId").value,
+            assigned_to: document.getElementById("roundAssignedTo").value,
+            due_date: document.getElementById("roundDueDate").value,
+        };
+
+        try {
+            const response = await fetch("/api/inspection-round", {
+                method: "POST",
+                headers: { "Content-Type": "application/json" },
+                body: JSON.stringify(body),
+            });
+            const data = await response.json();
+            if (!response.ok || data.error) {
+                errorAlert.innerText =
+                    data.error || "Error creating inspection round";
+                errorAlert.classList.remove("d-none");
+                return;
+            }
+            $("#addInspectionRoundModal").modal("hide");
+            viewInspectionRound(data.inspection_round_id);
+        } catch (error) {
+            console.error("Error creating inspection round:", error);
+            errorAlert.innerText = "Error creating inspection round";
+            errorAlert.classList.remove("d-none");
+        }
+    });
+}